@@ -2,20 +2,41 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
+	"github.com/davoodharun/terragrunt-scaffolder/internal/appsettings"
 	"github.com/davoodharun/terragrunt-scaffolder/internal/azure"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/catalog"
 	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
 	"github.com/davoodharun/terragrunt-scaffolder/internal/diagram"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/docs"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/events"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/graph"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/importer"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/lock"
 	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/mirror"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/naming"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
 	"github.com/davoodharun/terragrunt-scaffolder/internal/pipeline"
 	"github.com/davoodharun/terragrunt-scaffolder/internal/scaffold"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/scan"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/schema"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/stackdiff"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/state"
 	"github.com/davoodharun/terragrunt-scaffolder/internal/template"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/tui"
 	"github.com/davoodharun/terragrunt-scaffolder/internal/validate"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/workspace"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
 var (
@@ -28,46 +49,277 @@ var rootCmd = &cobra.Command{
 	Short:   "TGS - Terraform Generator Scaffold",
 	Long:    `TGS is a tool for generating and managing Terraform infrastructure using Terragrunt.`,
 	Version: Version,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := configureLogger(cmd); err != nil {
+			return err
+		}
+		if err := configureEvents(cmd); err != nil {
+			return err
+		}
+
+		projectDir, _ := cmd.Flags().GetString("project-dir")
+		workspaceName, _ := cmd.Flags().GetString("workspace")
+		if projectDir != "" && workspaceName != "" {
+			return fmt.Errorf("--project-dir and --workspace can't be combined")
+		}
+		if err := workspace.Enter(workspaceName, projectDir); err != nil {
+			return err
+		}
+
+		outputDir, _ := cmd.Flags().GetString("output-dir")
+		output.SetDir(outputDir)
+		return output.Resolve()
+	},
 }
 
 func init() {
 	// Add version flag
 	rootCmd.SetVersionTemplate(`{{printf "%s version %s\n" .Name .Version}}`)
 
+	// Add global flags selecting the project
+	rootCmd.PersistentFlags().String("project-dir", "", "Run in the TGS project of this directory")
+	rootCmd.PersistentFlags().StringP("workspace", "w", "", "Run in a workspace of .tgs/workspaces.yaml")
+	rootCmd.PersistentFlags().String("output-dir", "", "Directory of the generated infrastructure, overriding output_dir of tgs.yaml")
+
+	// Add global flags configuring the log output
+	rootCmd.PersistentFlags().Bool("verbose", false, "Also log debug messages")
+	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Only log warnings and errors")
+	rootCmd.PersistentFlags().String("log-format", logger.FormatText, "Log format ("+strings.Join(logger.Formats, ", ")+")")
+	rootCmd.PersistentFlags().String("log-file", "", "Also append every log message, debug ones included, to this file")
+	rootCmd.PersistentFlags().Bool("no-color", false, "Log without ANSI colors (the default when stdout isn't a terminal or NO_COLOR is set)")
+	rootCmd.PersistentFlags().Bool("pretty", false, "Pace log messages with a short delay for following a run interactively")
+	rootCmd.PersistentFlags().String("events", "", "Write generation and validation events as JSON lines to this file")
+
 	// Add subcommands to create command
 	createCmd.AddCommand(createStackCmd)
 	createCmd.AddCommand(createContainerCmd)
+	createStackCmd.Flags().BoolP("interactive", "i", false, "Build the stack from the catalog in a terminal UI")
+	createStackCmd.Flags().String("template", template.DefaultStackTemplate, "Stack template ("+strings.Join(template.StackTemplates(), ", ")+")")
+
+	// Add subcommands to scaffold command
+	repoScaffoldCmd.AddCommand(repoScaffoldRepoCmd)
+
+	// Add flags to import command
+	importCmd.Flags().Bool("force", false, "Overwrite an existing .tgs configuration")
+
+	// Add flags to graph command
+	graphCmd.Flags().StringP("format", "f", "text", "Output format (text, dot, json)")
+	graphCmd.Flags().StringP("output", "o", "", "Write the graph to a file instead of stdout")
+
+	// Add flags to query command
+	queryCmd.Flags().StringP("format", "f", "json", "Output format (json, text)")
+
+	// Add flags to validate commands
+	validateCmd.Flags().StringP("format", "f", "text", "Output format (text, json, sarif)")
+	validateCmd.Flags().Bool("offline", false, "Check provider versions against the local registry cache only")
+	validateCmd.Flags().Bool("schema", false, "Also check the stack file against its JSON Schema")
+	validateCmd.Flags().Bool("strict", false, "Fail on required module variables without a value")
+	validateTGSCmd.Flags().StringP("format", "f", "text", "Output format (text, json, sarif)")
+	validateTGSCmd.Flags().Bool("schema", false, "Also check tgs.yaml against its JSON Schema")
+	validateTGSCmd.Flags().Bool("online", false, "Also check that the remote state resource groups, storage accounts and containers exist and are readable")
+
+	// Add subcommands to schema command
+	schemaCmd.AddCommand(schemaExportCmd)
+	schemaExportCmd.Flags().StringP("output", "o", schema.Dir, "Directory to write the schemas to")
+
+	// Add flags to generate command
+	scaffoldCmd.Flags().StringP("output", "o", "", "Directory to generate into, overriding output_dir of tgs.yaml")
+	scaffoldCmd.Flags().MarkDeprecated("output", "use --output-dir")
+	scaffoldCmd.Flags().Bool("full", false, "Regenerate every component and environment, not only the ones whose configuration changed")
+	scaffoldCmd.Flags().Bool("commit", false, "Commit the generated changes to a new branch")
+	scaffoldCmd.Flags().String("branch", "", "Branch of --commit (default tgs/generate-<timestamp>)")
+	scaffoldCmd.Flags().Bool("pr", false, "Push the branch of --commit and open a pull request on GitHub or Azure DevOps")
+
+	// Add flags to plan command
+	planCmd.Flags().StringP("output", "o", "text", "Output format (text, json, markdown)")
+	planCmd.Flags().Bool("detailed-exitcode", false, "Exit with 2 when there are changes and 0 when there are none")
+	planCmd.Flags().Bool("cost", false, "Add infracost monthly cost estimates per environment")
+	planCmd.Flags().Bool("pr-comment", false, "Post the plan as a collapsed comment on the pull request of the CI run")
+
+	// Add flags to diff command
+	diffCmd.Flags().String("git-ref", "", "Compare the stack against its revision at a git ref")
+	diffCmd.Flags().StringP("output", "o", stackdiff.FormatText, "Output format (text, json, markdown)")
+
+	// Add flags to apply command
+	applyCmd.Flags().Bool("auto-approve", false, "Apply changes without asking for confirmation")
+
+	// Add flags to diagram command
+	diagramCmd.Flags().String("format", "mermaid", "Diagram format: mermaid, plantuml, dot, svg or structurizr")
+	diagramCmd.Flags().Bool("pipelines", false, "Draw the pipeline stage graph of every environment")
+	diagramCmd.Flags().String("stack", "", "Only draw the environments of a stack")
+	diagramCmd.Flags().String("env", "", "Only draw an environment")
+	diagramCmd.Flags().String("region", "", "Only draw the components of a region")
+	diagramCmd.Flags().Bool("overview", false, "Draw a diagram per stack covering all its environments (mermaid or dot)")
+	diagramCmd.Flags().String("render", "", "Render PlantUML diagrams to png or svg with a PlantUML server")
+	diagramCmd.Flags().String("plantuml-server", "", "PlantUML server rendering diagrams (default diagrams.plantuml_server of tgs.yaml or the public server)")
+
+	// Add flags to docs command
+	docsCmd.Flags().String("dir", "", "Directory the site is written to (default <output dir>/docs)")
+
+	// Add flags to verify command
+	verifyCmd.Flags().Int("parallel", 1, "Number of components verified at once")
+	verifyCmd.Flags().Bool("changed", false, "Only verify components with uncommitted changes")
+
+	// Add flags to pipeline command
+	pipelineCmd.Flags().String("agent", pipeline.AgentLinux, "Build agent OS of the generated pipelines (linux, windows)")
+
+	// Add flags to scan command
+	scanCmd.Flags().StringSlice("tool", nil, "Scanners to run instead of security.tools (tfsec, checkov, conftest)")
+
+	// Add test subcommands
+	testCmd.AddCommand(testScaffoldCmd)
+	testScaffoldCmd.Flags().String("dir", "test", "Directory to write the tests into")
+	testScaffoldCmd.Flags().String("agent", pipeline.AgentLinux, "Build agent OS of the test pipeline (linux, windows)")
+
+	// Add add subcommands
+	addCmd.AddCommand(addComponentCmd)
+	addComponentCmd.Flags().String("stack", "main", "Stack to add the component to")
+	addComponentCmd.Flags().String("source", "", "Azure resource type of the component (e.g. azurerm_key_vault)")
+	addComponentCmd.Flags().String("provider", "azurerm", "Provider of the resource type")
+	addComponentCmd.Flags().String("version", "", "Provider version (defaults to the version the stack uses)")
+	addComponentCmd.Flags().String("description", "", "Description of the component")
+	addComponentCmd.Flags().StringSlice("deps", nil, "Dependencies in dependency notation (e.g. {region}.keyvault)")
+	addComponentCmd.Flags().StringSlice("regions", nil, "Regions to deploy the component to")
+	addComponentCmd.Flags().StringSlice("apps", nil, "App instances of the component in each region")
+
+	// Add remove subcommands
+	removeCmd.AddCommand(removeComponentCmd)
+	removeCmd.AddCommand(removeAppCmd)
+	removeCmd.AddCommand(removeRegionCmd)
+	removeCmd.AddCommand(removeEnvironmentCmd)
+	removeCmd.PersistentFlags().Bool("auto-approve", false, "Remove without asking for confirmation")
+	for _, cmd := range []*cobra.Command{removeComponentCmd, removeAppCmd, removeRegionCmd} {
+		cmd.Flags().String("stack", "main", "Stack to remove from")
+	}
+	removeAppCmd.Flags().String("region", "", "Only remove the app from this region")
+
+	// Add rename subcommands
+	renameCmd.AddCommand(renameComponentCmd)
+	renameComponentCmd.Flags().String("stack", "main", "Stack defining the component")
+
+	// Add subcommands to catalog command
+	catalogCmd.AddCommand(catalogListCmd)
+	catalogCmd.AddCommand(catalogAddCmd)
+	catalogAddCmd.Flags().String("stack", "main", "Stack to add the components to")
+	catalogAddCmd.Flags().StringSlice("regions", nil, "Regions to deploy the components to")
+	catalogAddCmd.Flags().StringSlice("apps", nil, "App instances of the entry's app components in each region")
+
+	// Add subcommands to workspace command
+	workspaceCmd.AddCommand(workspaceListCmd)
+
+	// Add subcommands to mirror command
+	mirrorCmd.AddCommand(mirrorSyncCmd)
+
+	// Add subcommands to regions command
+	regionsCmd.AddCommand(regionsListCmd)
+	regionsCmd.AddCommand(regionsRefreshCmd)
+	regionsListCmd.Flags().String("cloud", azure.CloudPublic, "Azure cloud to list regions of (public, usgov, china)")
+
+	// Add subcommands to state command
+	stateCmd.AddCommand(stateListCmd)
+	stateCmd.AddCommand(stateBackupCmd)
+	stateBackupCmd.Flags().StringSlice("subscription", nil, "Only back up these subscriptions")
+	stateListCmd.Flags().StringP("format", "f", "text", "Output format (text, json)")
+	stateListCmd.Flags().Bool("orphaned", false, "Only list state blobs no generated folder uses")
+
+	// Add subcommands and flags to name command
+	nameCmd.AddCommand(namePreviewCmd)
+	namePreviewCmd.Flags().StringP("format", "f", "text", "Output format (text, json)")
+
+	// Add subcommands and flags to appsettings command
+	appSettingsCmd.AddCommand(appSettingsRenderCmd)
+	appSettingsRenderCmd.Flags().StringP("subscription", "s", "", "Subscription of the environment, when several define it")
+	appSettingsRenderCmd.Flags().StringP("component", "c", "", "Component of the app, when several have it")
+	appSettingsRenderCmd.Flags().Bool("sources", false, "Print the layer each setting comes from")
+
+	// Add flags to list command
+	listStacksCmd.Flags().Bool("json", false, "Print the stacks as JSON")
+
+	// Add flags to details command
+	detailsCmd.Flags().StringP("format", "f", "text", "Output format (text, json, yaml)")
 
 	// Add commands to root command
 	rootCmd.AddCommand(initCmd)
+	rootCmd.AddCommand(importCmd)
 	rootCmd.AddCommand(createCmd)
 	rootCmd.AddCommand(scaffoldCmd)
 	rootCmd.AddCommand(listStacksCmd)
 	rootCmd.AddCommand(diagramCmd)
+	rootCmd.AddCommand(docsCmd)
 	rootCmd.AddCommand(validateCmd)
 	rootCmd.AddCommand(validateTGSCmd)
+	rootCmd.AddCommand(schemaCmd)
 	rootCmd.AddCommand(detailsCmd)
 	rootCmd.AddCommand(planCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(applyCmd)
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(testCmd)
+	rootCmd.AddCommand(scanCmd)
+	rootCmd.AddCommand(addCmd)
+	rootCmd.AddCommand(renameCmd)
+	rootCmd.AddCommand(removeCmd)
+	rootCmd.AddCommand(catalogCmd)
 	rootCmd.AddCommand(pipelineCmd)
+	rootCmd.AddCommand(spaceliftCmd)
+	rootCmd.AddCommand(mirrorCmd)
+	rootCmd.AddCommand(workspaceCmd)
+	rootCmd.AddCommand(graphCmd)
+	rootCmd.AddCommand(queryCmd)
+	rootCmd.AddCommand(nameCmd)
+	rootCmd.AddCommand(appSettingsCmd)
+	rootCmd.AddCommand(regionsCmd)
+	rootCmd.AddCommand(stateCmd)
+	rootCmd.AddCommand(unlockCmd)
+	rootCmd.AddCommand(repoScaffoldCmd)
 }
 
 // detailsCmd shows detailed information about a stack
 var detailsCmd = &cobra.Command{
 	Use:   "details [stack]",
 	Short: "Show detailed information about a stack configuration",
-	Args:  cobra.MaximumNArgs(1),
+	Long: `Show the components, resources and regions of a stack. The json and yaml
+formats add the versions, dependencies and apps of every component and the
+computed resource names per environment, for tooling such as dashboards or a
+CMDB sync.`,
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		stackName := "main"
 		if len(args) > 0 {
 			stackName = args[0]
 		}
 
+		format, _ := cmd.Flags().GetString("format")
+		if format != "text" && format != "json" && format != "yaml" {
+			return fmt.Errorf("unsupported format %q: must be one of text, json, yaml", format)
+		}
+
 		// Read the stack configuration
 		mainConfig, err := scaffold.ReadMainConfig(stackName)
 		if err != nil {
 			return fmt.Errorf("failed to read stack config: %w", err)
 		}
 
+		if format != "text" {
+			tgsConfig, err := config.ReadTGSConfig()
+			if err != nil {
+				return fmt.Errorf("failed to read TGS config: %w", err)
+			}
+			details := scaffold.Details(tgsConfig, stackName, mainConfig)
+
+			var data []byte
+			if format == "json" {
+				data, err = json.MarshalIndent(details, "", "  ")
+			} else {
+				data, err = yaml.Marshal(details)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to marshal stack details: %w", err)
+			}
+			fmt.Println(strings.TrimSuffix(string(data), "\n"))
+			return nil
+		}
+
 		// Print stack details
 		fmt.Printf("\nStack: %s\n", mainConfig.Stack.Name)
 		fmt.Printf("Version: %s\n", mainConfig.Stack.Version)
@@ -116,10 +368,84 @@ var detailsCmd = &cobra.Command{
 	},
 }
 
+// configureLogger applies the global log flags
+func configureLogger(cmd *cobra.Command) error {
+	verbose, _ := cmd.Flags().GetBool("verbose")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	if verbose && quiet {
+		return fmt.Errorf("--verbose and --quiet can't be combined")
+	}
+	switch {
+	case verbose:
+		logger.SetLevel(logger.LevelDebug)
+	case quiet:
+		logger.SetLevel(logger.LevelWarning)
+	}
+
+	if noColor, _ := cmd.Flags().GetBool("no-color"); noColor {
+		logger.SetColor(false)
+	}
+	pretty, _ := cmd.Flags().GetBool("pretty")
+	logger.SetPretty(pretty)
+
+	logFormat, _ := cmd.Flags().GetString("log-format")
+	if err := logger.SetFormat(logFormat); err != nil {
+		return err
+	}
+	if logFile, _ := cmd.Flags().GetString("log-file"); logFile != "" {
+		if err := logger.SetLogFile(logFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eventsFile receives the events of --events
+var eventsFile *os.File
+
+// configureEvents writes the events of the run to the file of --events
+func configureEvents(cmd *cobra.Command) error {
+	path, _ := cmd.Flags().GetString("events")
+	if path == "" {
+		return nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to open events file: %w", err)
+	}
+	eventsFile = file
+	events.WriteJSONLines(file)
+	return nil
+}
+
+// exitCode is returned by a command exiting with a status without an error
+// to log, so main still closes the log and events files
+type exitCode int
+
+func (c exitCode) Error() string {
+	return fmt.Sprintf("exit status %d", int(c))
+}
+
+// exitWith makes cmd exit with code, without printing an error or its usage
+func exitWith(cmd *cobra.Command, code int) error {
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+	return exitCode(code)
+}
+
 func main() {
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	var code exitCode
+	if err != nil && !errors.As(err, &code) {
 		logger.Error("Error: %v", err)
-		os.Exit(1)
+		code = 1
+	}
+	logger.Close()
+	if eventsFile != nil {
+		eventsFile.Close()
+	}
+	if code != 0 {
+		os.Exit(int(code))
 	}
 }
 
@@ -128,7 +454,68 @@ var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialize a new project with tgs.yaml",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return template.InitProject()
+		if err := template.InitProject(); err != nil {
+			return err
+		}
+		return scaffold.ScaffoldRepo()
+	},
+}
+
+// repoScaffoldCmd groups the commands scaffolding the repository around the
+// generated tree
+var repoScaffoldCmd = &cobra.Command{
+	Use:   "scaffold",
+	Short: "Scaffold the repository around the generated infrastructure",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+// Scaffold repo subcommand
+var repoScaffoldRepoCmd = &cobra.Command{
+	Use:   "repo",
+	Short: "Write .gitignore, CODEOWNERS and README.md for the project",
+	Long: `Append the terragrunt caches and local tgs files missing from .gitignore, and
+write a CODEOWNERS mapping the generated folders to the owners of tgs.yaml and
+a README.md describing the generated layout. A CODEOWNERS or README.md that
+wasn't generated by tgs is left alone. tgs init runs it for new projects.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return scaffold.ScaffoldRepo()
+	},
+}
+
+// importCmd infers tgs configuration from an existing terragrunt tree
+var importCmd = &cobra.Command{
+	Use:   "import [path]",
+	Short: "Create tgs configuration from an existing terragrunt repository",
+	Long: `Walk an existing terragrunt tree (default .infrastructure, or the current
+directory) and write a best-effort tgs.yaml and stack configuration to .tgs,
+inferring subscriptions, regions, environments, components, apps and
+dependencies from the folders, includes and dependency blocks.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		force, _ := cmd.Flags().GetBool("force")
+
+		root := "."
+		if len(args) > 0 {
+			root = args[0]
+		} else if info, err := os.Stat(".infrastructure"); err == nil && info.IsDir() {
+			root = ".infrastructure"
+		}
+
+		logger.Info("Importing terragrunt configuration from %s...", root)
+		result, err := importer.Import(root)
+		if err != nil {
+			return fmt.Errorf("failed to import %s: %w", root, err)
+		}
+		for _, warning := range result.Warnings {
+			logger.Warning("%s", warning)
+		}
+		if err := importer.Write(result, force); err != nil {
+			return err
+		}
+		logger.Success("Imported %d stack(s) into .tgs; review the configuration and run tgs validate", len(result.Stacks))
+		return nil
 	},
 }
 
@@ -145,14 +532,25 @@ var createCmd = &cobra.Command{
 var createStackCmd = &cobra.Command{
 	Use:   "stack [name]",
 	Short: "Create a new stack configuration (main.yaml)",
-	Args:  cobra.MaximumNArgs(1),
+	Long: `Create a new stack configuration from a stack template. Available templates:
+  default        service plan, web apps and Redis in two regions
+  web-app        web app with Redis and Key Vault in two regions
+  microservices  services behind API Management with Service Bus and Cosmos DB
+  data-platform  Event Hubs ingestion, processing functions, storage and SQL
+  landing-zone   shared network, private DNS, logging and Key Vault`,
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		stackName := "main"
 		if len(args) > 0 {
 			stackName = args[0]
 		}
+		templateName, _ := cmd.Flags().GetString("template")
+		interactive, _ := cmd.Flags().GetBool("interactive")
 
-		return template.CreateStack(stackName)
+		if interactive {
+			return tui.BuildStack(stackName)
+		}
+		return template.CreateStack(stackName, templateName)
 	},
 }
 
@@ -169,8 +567,9 @@ var createContainerCmd = &cobra.Command{
 
 		// Create a map of available storage accounts
 		storageAccounts := make(map[int]struct {
-			name string
-			sub  string
+			name  string
+			sub   string
+			cloud string
 		})
 		i := 1
 
@@ -178,11 +577,13 @@ var createContainerCmd = &cobra.Command{
 		for subName, sub := range tgsConfig.Subscriptions {
 			fmt.Printf("%d. %s (Subscription: %s)\n", i, sub.RemoteState.Name, subName)
 			storageAccounts[i] = struct {
-				name string
-				sub  string
+				name  string
+				sub   string
+				cloud string
 			}{
-				name: sub.RemoteState.Name,
-				sub:  subName,
+				name:  sub.RemoteState.Name,
+				sub:   subName,
+				cloud: sub.Cloud,
 			}
 			i++
 		}
@@ -208,7 +609,7 @@ var createContainerCmd = &cobra.Command{
 			tgsConfig.Name, selectedAccount.name, selectedAccount.sub)
 
 		// Create the container using Azure SDK
-		if err := azure.CreateContainer(selectedAccount.name, tgsConfig.Name); err != nil {
+		if err := azure.CreateContainer(selectedAccount.name, tgsConfig.Name, selectedAccount.cloud); err != nil {
 			return fmt.Errorf("failed to create container: %w", err)
 		}
 
@@ -223,8 +624,58 @@ var createContainerCmd = &cobra.Command{
 var listStacksCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List available stacks",
+	Long: `List the stack files of .tgs/stacks with their version, description, number of
+components and the environments of tgs.yaml using them.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return template.ListStacks()
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+
+		// Environments are only listed when the project has a tgs.yaml
+		tgsConfig, err := config.ReadTGSConfig()
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to read TGS config: %w", err)
+			}
+			tgsConfig = nil
+		}
+
+		stacks, err := template.ListStacks(tgsConfig)
+		if err != nil {
+			return err
+		}
+
+		if jsonOutput {
+			data, err := json.MarshalIndent(stacks, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal stacks: %w", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		fmt.Println("\nAvailable stacks:")
+		for _, stack := range stacks {
+			if stack.Error != "" {
+				fmt.Printf("- %s (invalid: %s)\n", stack.Name, stack.Error)
+				continue
+			}
+			version := ""
+			if stack.Version != "" {
+				version = " " + stack.Version
+			}
+			fmt.Printf("- %s%s: %d components\n", stack.Name, version, stack.Components)
+			if stack.Description != "" {
+				fmt.Printf("    %s\n", stack.Description)
+			}
+			var envs []string
+			for _, env := range stack.Environments {
+				envs = append(envs, fmt.Sprintf("%s (%s)", env.Name, env.Subscription))
+			}
+			if len(envs) == 0 {
+				envs = []string{"none"}
+			}
+			fmt.Printf("    Environments: %s\n", strings.Join(envs, ", "))
+		}
+		return nil
 	},
 }
 
@@ -234,6 +685,10 @@ var validateCmd = &cobra.Command{
 	Short: "Validate a stack configuration",
 	Args:  cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		offline, _ := cmd.Flags().GetBool("offline")
+		checkSchema, _ := cmd.Flags().GetBool("schema")
+		strict, _ := cmd.Flags().GetBool("strict")
 		stackName := "main"
 		if len(args) > 0 {
 			stackName = args[0]
@@ -245,8 +700,30 @@ var validateCmd = &cobra.Command{
 			return fmt.Errorf("failed to read stack config: %w", err)
 		}
 
-		// Validate the stack
-		if errors := validate.ValidateStack(mainConfig); len(errors) > 0 {
+		// Validate the stack and its provider versions, and resolved resource
+		// names when the project config is available
+		tgsConfig, err := config.ReadTGSConfig()
+		if err != nil {
+			tgsConfig = nil
+		}
+		report := validate.Stack(tgsConfig, stackName, mainConfig, validate.Options{
+			Full:      true,
+			Strict:    strict,
+			Providers: true,
+			Offline:   offline,
+			Schema:    checkSchema,
+		})
+		findings, stackFile := report.Findings, report.File
+
+		events.ValidationFindings(stackFile, findings)
+
+		// Emit a machine readable report if requested
+		if format != "text" {
+			return printValidationReport(cmd, format, findings, stackFile)
+		}
+
+		printWarnings(findings)
+		if errors := validate.Errors(findings); len(errors) > 0 {
 			fmt.Println("Stack validation failed:")
 			for _, err := range errors {
 				fmt.Printf("  - %v\n", err)
@@ -263,15 +740,36 @@ var validateCmd = &cobra.Command{
 var validateTGSCmd = &cobra.Command{
 	Use:   "validate-tgs",
 	Short: "Validate TGS configuration",
+	Long: `Validate .tgs/tgs.yaml. With --schema the files are also checked against the
+JSON Schema of tgs.yaml. With --online the remote state of every subscription
+is checked in Azure as the signed in Azure CLI account: its resource group,
+storage account and container must exist, and the account keys or, with
+use_azuread_auth, the blobs must be readable.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		checkSchema, _ := cmd.Flags().GetBool("schema")
+		online, _ := cmd.Flags().GetBool("online")
+
 		// Read TGS config to validate
 		tgsConfig, err := config.ReadTGSConfig()
 		if err != nil {
 			return fmt.Errorf("failed to read TGS config: %w", err)
 		}
 
-		// Validate the configuration
-		if errors := validate.ValidateTGSConfig(tgsConfig); len(errors) > 0 {
+		// Validate the configuration and the name prefixes of the stacks that
+		// can be read; stack errors are reported by tgs validate
+		report := validate.Project(tgsConfig, validate.Options{Schema: checkSchema, Online: online})
+		findings := append(report.Config.Findings, report.Prefixes.Findings...)
+
+		events.ValidationFindings(validate.ConfigFile, findings)
+
+		// Emit a machine readable report if requested
+		if format != "text" {
+			return printValidationReport(cmd, format, findings, validate.ConfigFile)
+		}
+
+		printWarnings(findings)
+		if errors := validate.Errors(findings); len(errors) > 0 {
 			fmt.Println("TGS configuration validation failed:")
 			for _, err := range errors {
 				fmt.Printf("  - %v\n", err)
@@ -284,6 +782,66 @@ var validateTGSCmd = &cobra.Command{
 	},
 }
 
+// Schema commands
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Manage JSON Schemas of the configuration files",
+}
+
+var schemaExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Write JSON Schemas for tgs.yaml and stack files",
+	Long: `Write JSON Schemas for tgs.yaml and the stack files, derived from the
+configuration TGS reads. Point your editor's YAML language server at them for
+autocompletion and inline errors, or run validate --schema to check the files
+against them.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output, _ := cmd.Flags().GetString("output")
+		paths, err := schema.Export(output)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			logger.Success("Wrote %s", path)
+		}
+		return nil
+	},
+}
+
+// printWarnings prints validation findings that don't fail validation
+func printWarnings(findings []error) {
+	for _, warning := range validate.Warnings(findings) {
+		fmt.Printf("  - %s: %v\n", validate.SeverityOf(warning), warning)
+	}
+}
+
+// printValidationReport prints validation errors as JSON or SARIF and makes
+// cmd exit with status 1 if there are any errors, keeping stdout machine
+// readable
+func printValidationReport(cmd *cobra.Command, format string, errs []error, file string) error {
+	results := validate.NewResults(errs, file)
+
+	var output string
+	var err error
+	switch format {
+	case "json":
+		output, err = validate.FormatJSON(results)
+	case "sarif":
+		output, err = validate.FormatSARIF(results)
+	default:
+		return fmt.Errorf("unsupported format: %s (use text, json or sarif)", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(output)
+	if len(validate.Errors(errs)) > 0 {
+		return exitWith(cmd, 1)
+	}
+	return nil
+}
+
 // Generate scaffold command
 var scaffoldCmd = &cobra.Command{
 	Use:   "generate",
@@ -295,8 +853,18 @@ var scaffoldCmd = &cobra.Command{
 			return fmt.Errorf("failed to read TGS config: %w", err)
 		}
 
-		// Validate tgs.yaml first
-		if errors := validate.ValidateTGSConfig(tgsConfig); len(errors) > 0 {
+		// Generate into the --output directory instead of output_dir
+		if outputDir, _ := cmd.Flags().GetString("output"); outputDir != "" {
+			output.SetDir(outputDir)
+			if err := output.Resolve(); err != nil {
+				return err
+			}
+		}
+
+		// Validate tgs.yaml first, then all stacks referenced in environments
+		report := validate.Project(tgsConfig, validate.Options{Stacks: true})
+		printWarnings(report.Config.Findings)
+		if errors := validate.Errors(report.Config.Findings); len(errors) > 0 {
 			fmt.Println("TGS configuration validation failed:")
 			for _, err := range errors {
 				fmt.Printf("  - %v\n", err)
@@ -305,46 +873,30 @@ var scaffoldCmd = &cobra.Command{
 		}
 		fmt.Println("TGS configuration validation successful")
 
-		// Track processed stacks to avoid duplicate validation
-		processedStacks := make(map[string]bool)
-
-		// Validate all stacks referenced in environments
-		for _, sub := range tgsConfig.Subscriptions {
-			for _, env := range sub.Environments {
-				stackName := "main"
-				if env.Stack != "" {
-					stackName = env.Stack
-				}
-
-				// Skip if we've already validated this stack
-				if processedStacks[stackName] {
-					continue
-				}
-				processedStacks[stackName] = true
-
-				fmt.Printf("Validating stack '%s'...\n", stackName)
-
-				// Read and validate the stack
-				mainConfig, err := scaffold.ReadMainConfig(stackName)
-				if err != nil {
-					return fmt.Errorf("failed to read stack config %s: %w", stackName, err)
-				}
-
-				if errors := validate.ValidateStack(mainConfig); len(errors) > 0 {
-					fmt.Printf("Stack '%s' validation failed:\n", stackName)
-					for _, err := range errors {
-						fmt.Printf("  - %v\n", err)
-					}
-					return fmt.Errorf("stack '%s' validation failed with %d errors", stackName, len(errors))
+		for _, stackReport := range report.Stacks {
+			fmt.Printf("Validating stack '%s'...\n", stackReport.Stack)
+			printWarnings(stackReport.Findings)
+			if errors := validate.Errors(stackReport.Findings); len(errors) > 0 {
+				fmt.Printf("Stack '%s' validation failed:\n", stackReport.Stack)
+				for _, err := range errors {
+					fmt.Printf("  - %v\n", err)
 				}
-
-				fmt.Printf("Stack '%s' validation successful\n", stackName)
+				return fmt.Errorf("stack '%s' validation failed with %d errors", stackReport.Stack, len(errors))
 			}
+			fmt.Printf("Stack '%s' validation successful\n", stackReport.Stack)
 		}
 
 		fmt.Println("All configurations validated successfully, proceeding with generation...")
 
 		// If all validations pass, proceed with generation
+		full, _ := cmd.Flags().GetBool("full")
+		scaffold.SetFullGeneration(full)
+		commit, _ := cmd.Flags().GetBool("commit")
+		branch, _ := cmd.Flags().GetString("branch")
+		pr, _ := cmd.Flags().GetBool("pr")
+		if commit || pr || branch != "" {
+			return scaffold.GenerateAndCommit(scaffold.CommitOptions{Branch: branch, PullRequest: pr})
+		}
 		return scaffold.Generate()
 	},
 }
@@ -353,9 +905,56 @@ var scaffoldCmd = &cobra.Command{
 var diagramCmd = &cobra.Command{
 	Use:   "diagram",
 	Short: "Generate infrastructure diagrams",
-	Long:  `Generate both PlantUML architectural diagrams and a folder structure tree diagram that shows the complete infrastructure layout`,
+	Long: `Generate an architecture diagram per stack and environment and a folder
+structure tree diagram that shows the complete infrastructure layout. Diagrams
+are written as Mermaid markdown, PlantUML, Graphviz DOT or SVG; SVG is rendered
+with a local dot binary when Graphviz is installed. PlantUML diagrams can be
+rendered to PNG or SVG images by a PlantUML server with --render.
+
+With --pipelines, the stage graph of the deployment pipeline of every
+environment is drawn instead, showing the order stages run in. --stack, --env
+and --region restrict the diagrams, and --overview draws a diagram per stack
+covering all its environments.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		render, _ := cmd.Flags().GetString("render")
+		server, _ := cmd.Flags().GetString("plantuml-server")
+		pipelines, _ := cmd.Flags().GetBool("pipelines")
+		stack, _ := cmd.Flags().GetString("stack")
+		env, _ := cmd.Flags().GetString("env")
+		region, _ := cmd.Flags().GetString("region")
+		overview, _ := cmd.Flags().GetBool("overview")
+		return diagram.GenerateDiagram(diagram.Options{
+			Format:    format,
+			Render:    render,
+			Server:    server,
+			Pipelines: pipelines,
+			Stack:     stack,
+			Env:       env,
+			Region:    region,
+			Overview:  overview,
+		})
+	},
+}
+
+// Docs command
+var docsCmd = &cobra.Command{
+	Use:   "docs",
+	Short: "Generate a documentation site of the infrastructure",
+	Long: `Generate a markdown site for mkdocs with an overview of the subscriptions and
+environments, and a page per stack with its components, architecture,
+dependency graph as a Mermaid diagram, deployment order and resource names.
+Build it with mkdocs build -f <dir>/mkdocs.yml.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return diagram.GenerateDiagram()
+		dir, _ := cmd.Flags().GetString("dir")
+		if dir == "" {
+			dir = output.Path(docs.DefaultDir)
+		}
+		if err := docs.Generate(dir); err != nil {
+			return err
+		}
+		logger.Success("Generated documentation site in %s", dir)
+		return nil
 	},
 }
 
@@ -363,15 +962,27 @@ var diagramCmd = &cobra.Command{
 var planCmd = &cobra.Command{
 	Use:   "plan",
 	Short: "Show planned changes to infrastructure",
+	Long: `Show planned changes to infrastructure.
+With --detailed-exitcode the command exits with 0 when the generated tree is up to date
+and 2 when there are changes, so CI can gate on drift. With --cost the output also
+lists the infracost monthly estimate of every generated environment. With
+--pr-comment the plan is posted as a collapsed comment on the pull request a
+GitHub Actions or Azure Pipelines run builds, updating the comment of earlier runs.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("output")
+		detailedExitCode, _ := cmd.Flags().GetBool("detailed-exitcode")
+		withCost, _ := cmd.Flags().GetBool("cost")
+		prComment, _ := cmd.Flags().GetBool("pr-comment")
+
 		// Read TGS config to get environments
 		tgsConfig, err := config.ReadTGSConfig()
 		if err != nil {
 			return fmt.Errorf("failed to read TGS config: %w", err)
 		}
 
-		// Validate tgs.yaml first
-		if errors := validate.ValidateTGSConfig(tgsConfig); len(errors) > 0 {
+		// Validate tgs.yaml first; rendering the plan logs its warnings
+		findings := validate.ValidateTGSConfig(tgsConfig)
+		if errors := validate.Errors(findings); len(errors) > 0 {
 			fmt.Println("TGS configuration validation failed:")
 			for _, err := range errors {
 				fmt.Printf("  - %v\n", err)
@@ -379,24 +990,1014 @@ var planCmd = &cobra.Command{
 			return fmt.Errorf("tgs.yaml validation failed with %d errors", len(errors))
 		}
 
-		return scaffold.Plan()
+		changes, err := scaffold.Plan(format, withCost, prComment)
+		if err != nil {
+			return err
+		}
+
+		if detailedExitCode && len(changes) > 0 {
+			return exitWith(cmd, 2)
+		}
+		return nil
 	},
 }
 
-// Pipeline command
-var pipelineCmd = &cobra.Command{
-	Use:   "pipeline",
-	Short: "Generate Azure DevOps pipeline templates",
-	Long: `Generate Azure DevOps pipeline templates for each environment.
-This command creates:
-1. A deployment template (component-deploy.yml) that defines how to deploy each component
-2. A pipeline file for each environment that uses the deployment template and respects component dependencies`,
+// diffCmd compares two stack configurations
+var diffCmd = &cobra.Command{
+	Use:   "diff <stackA> [stackB]",
+	Short: "Compare stack configurations",
+	Long: `Report the components, versions, dependencies and architecture that differ
+between two stacks, or with --git-ref between a stack and its revision at a git ref:
+
+  tgs diff main platform
+  tgs diff main --git-ref origin/main`,
+	Args: cobra.RangeArgs(1, 2),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		logger.Info("Generating pipeline templates...")
-		if err := pipeline.GeneratePipelineTemplates(); err != nil {
+		ref, _ := cmd.Flags().GetString("git-ref")
+		format, _ := cmd.Flags().GetString("output")
+
+		var from, to *config.MainConfig
+		var fromLabel, toLabel string
+		var err error
+		if ref != "" {
+			if len(args) != 1 {
+				return fmt.Errorf("--git-ref compares a single stack")
+			}
+			fromLabel, toLabel = fmt.Sprintf("%s@%s", args[0], ref), args[0]
+			if from, err = stackdiff.ReadRevision(args[0], ref); err != nil {
+				return err
+			}
+		} else {
+			if len(args) != 2 {
+				return fmt.Errorf("specify two stacks to compare, or one stack and --git-ref")
+			}
+			fromLabel, toLabel = args[0], args[1]
+			if from, err = config.ReadMainConfig(args[0]); err != nil {
+				return fmt.Errorf("failed to read stack %s: %w", args[0], err)
+			}
+		}
+		if to, err = config.ReadMainConfig(args[len(args)-1]); err != nil {
+			return fmt.Errorf("failed to read stack %s: %w", args[len(args)-1], err)
+		}
+
+		report, err := stackdiff.Format(stackdiff.Compare(from, to), format, fromLabel, toLabel)
+		if err != nil {
 			return err
 		}
-		logger.Success("Pipeline templates generated successfully")
+		fmt.Print(report)
+		return nil
+	},
+}
+
+// Add command with subcommands
+var addCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Add parts to a stack",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+// Add component subcommand
+var addComponentCmd = &cobra.Command{
+	Use:   "component <name>",
+	Short: "Add a component to a stack",
+	Long: `Add a component to a stack configuration and place it in the architecture
+of the given regions. The resource type is checked against the provider schema
+and the stack is validated before it's written. The resource type and regions
+are prompted for when their flags aren't set.
+
+  tgs add component keyvault --source azurerm_key_vault --regions eastus2,westus2
+  tgs add component appservice --source azurerm_linux_web_app \
+    --deps "{region}.serviceplan.{app}" --regions eastus2 --apps api,web`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stack, _ := cmd.Flags().GetString("stack")
+		spec := scaffold.ComponentSpec{Name: args[0]}
+		spec.Source, _ = cmd.Flags().GetString("source")
+		spec.Provider, _ = cmd.Flags().GetString("provider")
+		spec.Version, _ = cmd.Flags().GetString("version")
+		spec.Description, _ = cmd.Flags().GetString("description")
+		spec.Deps, _ = cmd.Flags().GetStringSlice("deps")
+		spec.Regions, _ = cmd.Flags().GetStringSlice("regions")
+		spec.Apps, _ = cmd.Flags().GetStringSlice("apps")
+
+		reader := bufio.NewReader(os.Stdin)
+		prompt := func(label string) (string, error) {
+			fmt.Print(label)
+			input, err := reader.ReadString('\n')
+			if err != nil {
+				return "", fmt.Errorf("failed to read input: %w", err)
+			}
+			return strings.TrimSpace(input), nil
+		}
+
+		var err error
+		if spec.Source == "" {
+			if spec.Source, err = prompt("Resource type (e.g. azurerm_key_vault): "); err != nil {
+				return err
+			}
+			if spec.Source == "" {
+				return fmt.Errorf("a resource type is required")
+			}
+		}
+		if !cmd.Flags().Changed("regions") {
+			input, err := prompt("Regions to deploy to (comma separated, empty for none): ")
+			if err != nil {
+				return err
+			}
+			for _, region := range strings.Split(input, ",") {
+				if region = strings.TrimSpace(region); region != "" {
+					spec.Regions = append(spec.Regions, region)
+				}
+			}
+		}
+
+		return scaffold.AddComponent(stack, spec)
+	},
+}
+
+// Rename command with subcommands
+var renameCmd = &cobra.Command{
+	Use:   "rename",
+	Short: "Rename parts of a stack",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+// Rename component subcommand
+var renameComponentCmd = &cobra.Command{
+	Use:   "component <old> <new>",
+	Short: "Rename a component and move its state",
+	Long: `Rename a component in the stack configuration, move its generated folders
+and regenerate the infrastructure. A script per environment is written to
+.tgs/migrations copying the Terraform state of every instance to its new key.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stack, _ := cmd.Flags().GetString("stack")
+		return scaffold.RenameComponent(stack, args[0], args[1])
+	},
+}
+
+// Apply command
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Apply planned changes to the generated infrastructure",
+	Long: `Reconcile the .infrastructure tree with the configuration.
+Shows the same changes as plan, then creates new environments and components,
+deletes removed ones and updates changed files.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		autoApprove, _ := cmd.Flags().GetBool("auto-approve")
+
+		// Read TGS config to get environments
+		tgsConfig, err := config.ReadTGSConfig()
+		if err != nil {
+			return fmt.Errorf("failed to read TGS config: %w", err)
+		}
+
+		// Validate tgs.yaml first
+		findings := validate.ValidateTGSConfig(tgsConfig)
+		printWarnings(findings)
+		if errors := validate.Errors(findings); len(errors) > 0 {
+			fmt.Println("TGS configuration validation failed:")
+			for _, err := range errors {
+				fmt.Printf("  - %v\n", err)
+			}
+			return fmt.Errorf("tgs.yaml validation failed with %d errors", len(errors))
+		}
+
+		return scaffold.Apply(confirmChanges(autoApprove))
+	},
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Smoke test the generated infrastructure",
+	Long: `Run terragrunt hclvalidate over the generated tree, and terraform init
+-backend=false and terraform validate in every component module, without
+touching remote state. The modules are validated in temporary copies, so the
+tree keeps no .terraform folders or lock files.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		parallel, _ := cmd.Flags().GetInt("parallel")
+		changed, _ := cmd.Flags().GetBool("changed")
+
+		results, err := scaffold.Verify(scaffold.VerifyOptions{Parallel: parallel, Changed: changed})
+		if err != nil {
+			return err
+		}
+
+		failed := 0
+		for _, result := range results {
+			if result.Err == nil {
+				fmt.Printf("ok    %s\n", result.Name)
+				continue
+			}
+			failed++
+			fmt.Printf("FAIL  %s: %v\n", result.Name, result.Err)
+			if result.Output != "" {
+				for _, line := range strings.Split(result.Output, "\n") {
+					fmt.Printf("    %s\n", line)
+				}
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("verification failed for %d of %d checks", failed, len(results))
+		}
+		fmt.Printf("\nAll %d checks passed\n", len(results))
+		return nil
+	},
+}
+
+var scanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "Run policy-as-code scanners over the component modules",
+	Long: `Run the tfsec, checkov and conftest scans of security.tools in tgs.yaml over
+the component modules of the generated tree, with the same command lines as the
+generated pipelines. Findings at or above security.severity fail the scan.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tools, _ := cmd.Flags().GetStringSlice("tool")
+
+		tgsConfig, err := config.ReadTGSConfig()
+		if err != nil {
+			return fmt.Errorf("failed to read TGS config: %w", err)
+		}
+		return scan.Run(tgsConfig.Security, output.Path("_components"), tools)
+	},
+}
+
+// Test command with subcommands
+var testCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Manage tests of the generated components",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var testScaffoldCmd = &cobra.Command{
+	Use:   "scaffold",
+	Short: "Generate terratest files for the components",
+	Long: `Generate a Go terratest file per component of every stack, planning the
+component module with mocked inputs and dependency outputs, and a pipeline
+running them in .azure-pipelines/terratest.yml. Existing test files are kept.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, _ := cmd.Flags().GetString("dir")
+		agent, _ := cmd.Flags().GetString("agent")
+
+		if err := scaffold.GenerateTests(dir); err != nil {
+			return err
+		}
+		if err := pipeline.GenerateTestPipeline(agent, dir); err != nil {
+			return err
+		}
+		logger.Success("Generated .azure-pipelines/terratest.yml")
+		return nil
+	},
+}
+
+// confirmChanges asks for the planned changes to be approved unless
+// autoApprove is set
+func confirmChanges(autoApprove bool) func([]scaffold.Change) (bool, error) {
+	return func(changes []scaffold.Change) (bool, error) {
+		if autoApprove {
+			return true, nil
+		}
+
+		reader := bufio.NewReader(os.Stdin)
+		fmt.Print("\nDo you want to apply these changes? Only 'yes' will be accepted: ")
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			return false, fmt.Errorf("failed to read input: %w", err)
+		}
+		return strings.TrimSpace(input) == "yes", nil
+	}
+}
+
+// Remove command with subcommands
+var removeCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Remove parts of the configuration and prune the tree",
+	Long: `Remove components, apps, regions or environments from the configuration.
+The changes to the generated tree and the deployed folders they orphan are
+shown before the configuration is edited and the tree is pruned.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+// Remove component subcommand
+var removeComponentCmd = &cobra.Command{
+	Use:   "component <name>",
+	Short: "Remove a component from a stack",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stack, _ := cmd.Flags().GetString("stack")
+		autoApprove, _ := cmd.Flags().GetBool("auto-approve")
+		return scaffold.RemoveComponent(stack, args[0], confirmChanges(autoApprove))
+	},
+}
+
+// Remove app subcommand
+var removeAppCmd = &cobra.Command{
+	Use:   "app <component> <app>",
+	Short: "Remove an app instance of a component",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stack, _ := cmd.Flags().GetString("stack")
+		region, _ := cmd.Flags().GetString("region")
+		autoApprove, _ := cmd.Flags().GetBool("auto-approve")
+		return scaffold.RemoveApp(stack, args[0], args[1], region, confirmChanges(autoApprove))
+	},
+}
+
+// Remove region subcommand
+var removeRegionCmd = &cobra.Command{
+	Use:   "region <region>",
+	Short: "Remove a region from the architecture of a stack",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stack, _ := cmd.Flags().GetString("stack")
+		autoApprove, _ := cmd.Flags().GetBool("auto-approve")
+		return scaffold.RemoveRegion(stack, args[0], confirmChanges(autoApprove))
+	},
+}
+
+// Remove environment subcommand
+var removeEnvironmentCmd = &cobra.Command{
+	Use:   "environment <subscription> <environment>",
+	Short: "Remove an environment from a subscription",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		autoApprove, _ := cmd.Flags().GetBool("auto-approve")
+		return scaffold.RemoveEnvironment(args[0], args[1], confirmChanges(autoApprove))
+	},
+}
+
+// Catalog command with subcommands
+var catalogCmd = &cobra.Command{
+	Use:   "catalog",
+	Short: "Add curated component definitions to a stack",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+// Catalog list subcommand
+var catalogListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the catalog entries",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries, err := catalog.List()
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Catalog entries:")
+		for _, entry := range entries {
+			source := ""
+			if entry.Source == "mirror" {
+				source = " (mirror)"
+			}
+			fmt.Printf("  - %s%s: %s\n", entry.Name, source, entry.Description)
+			for _, name := range entry.ComponentNames() {
+				comp := entry.Components[name]
+				fmt.Printf("      %s: %s (%s %s)\n", name, comp.Source, comp.Provider, comp.Version)
+			}
+		}
+		return nil
+	},
+}
+
+// Catalog add subcommand
+var catalogAddCmd = &cobra.Command{
+	Use:   "add <entry>",
+	Short: "Add the components of a catalog entry to a stack",
+	Long: `Add the components of a catalog entry to a stack and place them in the given
+regions. Components the stack already defines with the same resource type are
+reused, so entries sharing a service plan or key vault can be combined:
+
+  tgs catalog add appservice-linux --regions eastus2,westus2 --apps api,web`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stack, _ := cmd.Flags().GetString("stack")
+		regions, _ := cmd.Flags().GetStringSlice("regions")
+		apps, _ := cmd.Flags().GetStringSlice("apps")
+
+		entry, err := catalog.Get(args[0])
+		if err != nil {
+			return err
+		}
+		return scaffold.AddCatalogEntry(stack, entry, regions, apps)
+	},
+}
+
+// Pipeline command
+var pipelineCmd = &cobra.Command{
+	Use:   "pipeline",
+	Short: "Generate Azure DevOps pipeline templates",
+	Long: `Generate Azure DevOps pipeline templates for each environment.
+This command creates:
+1. A deployment template (component-deploy.yml) that defines how to deploy each component
+2. A pipeline file for each environment that uses the deployment template and respects component dependencies
+3. A change detection stage so only components affected by a change are deployed`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		agent, _ := cmd.Flags().GetString("agent")
+
+		logger.Info("Generating pipeline templates...")
+		if err := pipeline.GeneratePipelineTemplates(agent); err != nil {
+			return err
+		}
+		logger.Success("Pipeline templates generated successfully")
+		return nil
+	},
+}
+
+// spaceliftCmd generates Spacelift stack definitions
+var spaceliftCmd = &cobra.Command{
+	Use:   "spacelift",
+	Short: "Generate Spacelift stack definitions",
+	Long: `Generate Terraform configuration for the Spacelift provider in .spacelift/stacks.tf.
+Every environment, region and component leaf becomes a Spacelift stack, with
+stack dependencies wired from the component dependencies of the stack.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger.Info("Generating Spacelift stacks...")
+		if err := pipeline.GenerateSpacelift(); err != nil {
+			return err
+		}
+		logger.Success("Spacelift stacks generated in %s", pipeline.SpaceliftDir)
+		return nil
+	},
+}
+
+// Mirror command with subcommands
+// Workspace commands
+var workspaceCmd = &cobra.Command{
+	Use:   "workspace",
+	Short: "Manage the TGS projects of a repository",
+	Long: `A repository can host several TGS projects by listing them in
+.tgs/workspaces.yaml at its root. Each workspace is a directory with its own
+.tgs configuration and generated files. Select one with --workspace (-w) or
+run tgs from its directory.`,
+}
+
+var workspaceListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the workspaces of the repository",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, cfg, err := workspace.List()
+		if err != nil {
+			return err
+		}
+		if err := workspace.Validate(cfg); err != nil {
+			return err
+		}
+
+		projects := make(map[string]string)
+		for _, name := range cfg.Names() {
+			ws := cfg.Workspaces[name]
+			project := "(no .tgs/tgs.yaml)"
+			if data, err := os.ReadFile(filepath.Join(root, ws.Path, ".tgs", "tgs.yaml")); err == nil {
+				var tgsConfig config.TGSConfig
+				if _, err := config.Unmarshal(data, &tgsConfig); err == nil && tgsConfig.Name != "" {
+					project = tgsConfig.Name
+					if other, ok := projects[project]; ok {
+						logger.Warning("Workspaces %s and %s both use project name %s; their resource names and state containers will collide", other, name, project)
+					}
+					projects[project] = name
+				}
+			}
+			fmt.Printf("%-20s %-30s %-20s %s\n", name, ws.Path, project, ws.Description)
+		}
+		return nil
+	},
+}
+
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror",
+	Short: "Manage the template and schema mirror",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+// Mirror sync subcommand
+var mirrorSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Pull signed template, catalog and schema updates from the configured mirror",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tgsConfig, err := config.ReadTGSConfig()
+		if err != nil {
+			return fmt.Errorf("failed to read TGS config: %w", err)
+		}
+
+		logger.Info("Syncing mirror %s...", tgsConfig.Mirror.URL)
+		manifest, err := mirror.Sync(tgsConfig.Mirror)
+		if err != nil {
+			return fmt.Errorf("failed to sync mirror: %w", err)
+		}
+
+		counts := make(map[string]int)
+		for _, file := range manifest.Files {
+			counts[file.Kind()]++
+		}
+
+		logger.Success("Synced mirror version %s into %s", manifest.Version, mirror.CacheDir)
+		fmt.Printf("  - templates: %d\n", counts[mirror.KindTemplate])
+		fmt.Printf("  - catalog:   %d\n", counts[mirror.KindCatalog])
+		fmt.Printf("  - schemas:   %d\n", counts[mirror.KindSchema])
+		return nil
+	},
+}
+
+// Graph command
+var graphCmd = &cobra.Command{
+	Use:   "graph [stack]",
+	Short: "Show the component dependency graph of a stack",
+	Long: `Build the component/app dependency graph of a stack, detect dependency cycles
+and print the deployment order. The graph can also be exported as DOT or JSON.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stackName := "main"
+		if len(args) > 0 {
+			stackName = args[0]
+		}
+
+		format, _ := cmd.Flags().GetString("format")
+		outputPath, _ := cmd.Flags().GetString("output")
+
+		mainConfig, err := scaffold.ReadMainConfig(stackName)
+		if err != nil {
+			return fmt.Errorf("failed to read stack config: %w", err)
+		}
+
+		g := graph.Build(mainConfig)
+		cycle := g.FindCycle()
+
+		var output string
+		switch format {
+		case "dot":
+			output = g.ToDOT(stackName)
+		case "json":
+			data, err := g.ToJSON()
+			if err != nil {
+				return fmt.Errorf("failed to render graph: %w", err)
+			}
+			output = string(data) + "\n"
+		case "text":
+			if cycle != nil {
+				break
+			}
+			waves, err := g.Waves()
+			if err != nil {
+				return err
+			}
+			var b strings.Builder
+			b.WriteString(fmt.Sprintf("\nDeployment order for stack '%s':\n", stackName))
+			for i, wave := range waves {
+				b.WriteString(fmt.Sprintf("\nWave %d:\n", i+1))
+				for _, id := range wave {
+					if deps := g.Edges[id]; len(deps) > 0 {
+						b.WriteString(fmt.Sprintf("  - %s (depends on: %s)\n", id, strings.Join(deps, ", ")))
+					} else {
+						b.WriteString(fmt.Sprintf("  - %s\n", id))
+					}
+				}
+			}
+			output = b.String()
+		default:
+			return fmt.Errorf("unsupported format %q: must be one of text, dot, json", format)
+		}
+
+		if outputPath != "" {
+			if err := os.WriteFile(outputPath, []byte(output), 0644); err != nil {
+				return fmt.Errorf("failed to write graph: %w", err)
+			}
+			logger.Success("Wrote dependency graph to %s", outputPath)
+		} else {
+			fmt.Print(output)
+		}
+
+		if cycle != nil {
+			return &graph.CycleError{Path: cycle}
+		}
+		return nil
+	},
+}
+
+// Query command
+var queryCmd = &cobra.Command{
+	Use:   "query [selector...]",
+	Short: "List the generated folders, names, dependencies and state keys matching selectors",
+	Long: `List every component and app deployed by the environments of tgs.yaml that
+matches all selectors, with its generated folder, resource name, the folders it
+depends on and its state key. Selectors are key=value or key!=value, where the
+value may be a glob pattern, on the keys stack, subscription, env, region,
+component, app, type (the resource type) and name:
+
+  tgs query component=appservice env=prod
+  tgs query region=eastus2 app!=web
+  tgs query --format text type=azurerm_linux_web_app | xargs -n1 terragrunt plan --terragrunt-working-dir
+
+The json format is computed from the configuration, so it doesn't need a
+generated tree; text prints the folders only.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		if format != "json" && format != "text" {
+			return fmt.Errorf("unsupported format %q: must be one of json, text", format)
+		}
+
+		var selectors []scaffold.Selector
+		for _, arg := range args {
+			selector, err := scaffold.ParseSelector(arg)
+			if err != nil {
+				return err
+			}
+			selectors = append(selectors, selector)
+		}
+
+		tgsConfig, err := config.ReadTGSConfig()
+		if err != nil {
+			return fmt.Errorf("failed to read TGS config: %w", err)
+		}
+		stacks := make(map[string]*config.MainConfig)
+		for _, sub := range tgsConfig.Subscriptions {
+			for _, env := range sub.Environments {
+				stackName := env.Stack
+				if stackName == "" {
+					stackName = "main"
+				}
+				if _, ok := stacks[stackName]; ok {
+					continue
+				}
+				mainConfig, err := scaffold.ReadMainConfig(stackName)
+				if err != nil {
+					return fmt.Errorf("failed to read stack config %s: %w", stackName, err)
+				}
+				stacks[stackName] = mainConfig
+			}
+		}
+
+		entries := scaffold.Query(tgsConfig, stacks, selectors)
+		if format == "text" {
+			for _, entry := range entries {
+				fmt.Println(entry.Path)
+			}
+			return nil
+		}
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal query results: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	},
+}
+
+// Name command with subcommands
+var nameCmd = &cobra.Command{
+	Use:   "name",
+	Short: "Inspect the resource naming convention",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+// Name preview subcommand
+var namePreviewCmd = &cobra.Command{
+	Use:   "preview [stack]",
+	Short: "Print the resolved resource name of every component and app",
+	Long: `Resolve the resource name of every component and app in each environment and
+region of a stack using the naming configuration of tgs.yaml, including
+component_formats, without generating any files. Names that break the Azure
+naming rules of their resource type are flagged.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stackName := "main"
+		if len(args) > 0 {
+			stackName = args[0]
+		}
+
+		format, _ := cmd.Flags().GetString("format")
+		if format != "text" && format != "json" {
+			return fmt.Errorf("unsupported format %q: must be one of text, json", format)
+		}
+
+		tgsConfig, err := config.ReadTGSConfig()
+		if err != nil {
+			return fmt.Errorf("failed to read TGS config: %w", err)
+		}
+
+		mainConfig, err := scaffold.ReadMainConfig(stackName)
+		if err != nil {
+			return fmt.Errorf("failed to read stack config: %w", err)
+		}
+
+		entries := naming.Resolved(tgsConfig, stackName, mainConfig)
+
+		if format == "json" {
+			if entries == nil {
+				entries = []naming.Entry{}
+			}
+			data, err := json.MarshalIndent(entries, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal names: %w", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		if len(entries) == 0 {
+			fmt.Printf("No environments use stack '%s'\n", stackName)
+			return nil
+		}
+
+		width := 0
+		for _, entry := range entries {
+			if label := len(entry.Deployment()); label > width {
+				width = label
+			}
+		}
+
+		invalid := 0
+		group := ""
+		for _, entry := range entries {
+			if current := fmt.Sprintf("%s/%s", entry.Subscription, entry.Environment); current != group {
+				group = current
+				fmt.Printf("\n%s (%s):\n", entry.Environment, entry.Subscription)
+			}
+
+			line := fmt.Sprintf("  %-*s  %s", width, entry.Deployment(), entry.Name)
+			if violations := naming.Check(entry.ResourceType, entry.Name); len(violations) > 0 {
+				invalid++
+				line += fmt.Sprintf("  (invalid: %s)", strings.Join(violations, ", "))
+			}
+			fmt.Println(line)
+		}
+
+		fmt.Printf("\n%d names resolved", len(entries))
+		if invalid > 0 {
+			fmt.Printf(", %d invalid", invalid)
+		}
+		fmt.Println()
+		return nil
+	},
+}
+
+// App settings command with subcommands
+var appSettingsCmd = &cobra.Command{
+	Use:   "appsettings",
+	Short: "Inspect the app settings files of the generated tree",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+// App settings render subcommand
+var appSettingsRenderCmd = &cobra.Command{
+	Use:   "render <environment> <app>",
+	Short: "Print the merged app settings of an app in an environment",
+	Long: `Merge the global, environment and app settings files of an app generated for
+a component with app_settings, in that order, like its appsettings.hcl does,
+and print the result as JSON. Run tgs generate first.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		subName, _ := cmd.Flags().GetString("subscription")
+		compName, _ := cmd.Flags().GetString("component")
+		sources, _ := cmd.Flags().GetBool("sources")
+
+		tgsConfig, err := config.ReadTGSConfig()
+		if err != nil {
+			return fmt.Errorf("failed to read TGS config: %w", err)
+		}
+
+		target, err := appsettings.Find(tgsConfig, args[0], args[1], subName, compName)
+		if err != nil {
+			return err
+		}
+		settings, err := appsettings.Merge(target.Layers())
+		if err != nil {
+			return err
+		}
+
+		if sources {
+			width := 0
+			for _, setting := range settings {
+				if len(setting.Name) > width {
+					width = len(setting.Name)
+				}
+			}
+			for _, setting := range settings {
+				fmt.Printf("%-*s  %-11s  %s\n", width, setting.Name, setting.Layer, setting.Value)
+			}
+			return nil
+		}
+
+		values := make(map[string]string, len(settings))
+		for _, setting := range settings {
+			values[setting.Name] = setting.Value
+		}
+		data, err := json.MarshalIndent(values, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal app settings: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	},
+}
+
+// State command with subcommands
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Inspect the remote state of the project",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+// State list subcommand
+var stateListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the state blobs of every subscription and flag orphaned state",
+	Long: `List the Terraform state blobs in the remote state container of every
+subscription of tgs.yaml and cross-reference them with the generated tree.
+State blobs no generated folder uses are flagged as orphaned, and generated
+folders without state as missing. Blobs are listed with the signed in Azure
+CLI account, which needs read access to the containers.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		if format != "text" && format != "json" {
+			return fmt.Errorf("unsupported format %q: must be one of text, json", format)
+		}
+		orphanedOnly, _ := cmd.Flags().GetBool("orphaned")
+
+		tgsConfig, err := config.ReadTGSConfig()
+		if err != nil {
+			return fmt.Errorf("failed to read TGS config: %w", err)
+		}
+
+		entries, err := state.List(tgsConfig, output.Dir())
+		if err != nil {
+			return err
+		}
+
+		counts := make(map[string]int)
+		var listed []state.Entry
+		for _, entry := range entries {
+			counts[entry.Status]++
+			if !orphanedOnly || entry.Status == state.StatusOrphaned {
+				listed = append(listed, entry)
+			}
+		}
+
+		if format == "json" {
+			if listed == nil {
+				listed = []state.Entry{}
+			}
+			data, err := json.MarshalIndent(listed, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal state: %w", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		group := ""
+		for _, entry := range listed {
+			if entry.Subscription != group {
+				group = entry.Subscription
+				fmt.Printf("\n%s (%s/%s):\n", entry.Subscription, entry.Account, entry.Container)
+			}
+			modified := ""
+			if !entry.LastModified.IsZero() {
+				modified = entry.LastModified.Local().Format("2006-01-02 15:04")
+			}
+			fmt.Printf("  %-9s %-16s %s\n", entry.Status, modified, entry.Key)
+		}
+
+		fmt.Printf("\n%d tracked, %d orphaned, %d missing\n", counts[state.StatusTracked], counts[state.StatusOrphaned], counts[state.StatusMissing])
+		return nil
+	},
+}
+
+// State backup subcommand
+var stateBackupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Copy the state blobs of every subscription to its backup container",
+	Long: `Copy every Terraform state blob in the remote state container of the
+subscriptions with a remotestate.backup of tgs.yaml into their backup
+container, under a folder named after the UTC time of the backup. Blobs are
+copied as the signed in Azure CLI account.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		names, _ := cmd.Flags().GetStringSlice("subscription")
+
+		tgsConfig, err := config.ReadTGSConfig()
+		if err != nil {
+			return fmt.Errorf("failed to read TGS config: %w", err)
+		}
+
+		subs, err := state.BackupSubscriptions(tgsConfig, names)
+		if err != nil {
+			return err
+		}
+		if len(subs) == 0 {
+			logger.Warning("No subscription sets remotestate.backup")
+			return nil
+		}
+
+		now := time.Now()
+		for _, name := range subs {
+			count, err := state.Backup(tgsConfig, name, now)
+			if err != nil {
+				return err
+			}
+			backup := tgsConfig.Subscriptions[name].RemoteState
+			logger.Success("Backed up %d state files of %s to %s/%s/%s", count, name, backup.BackupAccount(), backup.Backup.Container, state.BackupPrefix(now))
+		}
+		return nil
+	},
+}
+
+// Regions command with subcommands
+var regionsCmd = &cobra.Command{
+	Use:   "regions",
+	Short: "Manage the Azure region catalog",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+// Regions list subcommand
+var regionsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the Azure regions known to tgs",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cloudName, _ := cmd.Flags().GetString("cloud")
+		cloud, err := azure.CloudFor(cloudName)
+		if err != nil {
+			return err
+		}
+		regions := azure.Regions(cloud.Name)
+
+		// Mark the regions of the allowlist if the project has one
+		allowed := make(map[string]bool)
+		if tgsConfig, err := config.ReadTGSConfig(); err == nil {
+			for _, region := range tgsConfig.Regions {
+				allowed[region] = true
+			}
+		}
+
+		if regions.Source == "builtin" {
+			fmt.Printf("Azure %s regions (built-in catalog, run 'tgs regions refresh' to update):\n", cloud.Name)
+		} else {
+			fmt.Printf("Azure %s regions (refreshed %s):\n", cloud.Name, regions.Source)
+		}
+		for _, region := range regions.Regions {
+			if allowed[region] {
+				fmt.Printf("  - %s (allowed)\n", region)
+			} else {
+				fmt.Printf("  - %s\n", region)
+			}
+		}
+		return nil
+	},
+}
+
+// Regions refresh subcommand
+var regionsRefreshCmd = &cobra.Command{
+	Use:   "refresh",
+	Short: "Refresh the region catalog of the active Azure CLI cloud",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		catalog, err := azure.RefreshRegions()
+		if err != nil {
+			return fmt.Errorf("failed to refresh region catalog: %w", err)
+		}
+
+		logger.Success("Cached %d Azure %s regions in %s", len(catalog.Regions), catalog.Cloud, azure.RegionCacheDir)
+		return nil
+	},
+}
+
+// unlockCmd removes the lock of a run that is gone
+var unlockCmd = &cobra.Command{
+	Use:   "unlock",
+	Short: "Remove the lock of an interrupted run",
+	Long: `Remove .tgs/lock, taken by generate, plan, apply and the pipeline commands
+while they write into the project. Only remove the lock of a run that is gone:
+locks of exited processes of this host are taken over automatically.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		owner, err := lock.Read()
+		if err != nil {
+			return err
+		}
+		if owner == nil {
+			logger.Info("Project is not locked")
+			return nil
+		}
+		if err := lock.Break(); err != nil {
+			return err
+		}
+		logger.Success("Removed the lock of %s", owner)
 		return nil
 	},
 }
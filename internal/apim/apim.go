@@ -0,0 +1,250 @@
+// Package apim checks API Management policy documents: the policies of an
+// instance or an operation and the policy fragments they include
+package apim
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// Root elements of policy documents
+const (
+	RootPolicies = "policies"
+	RootFragment = "fragment"
+)
+
+// PolicySkeleton is the policy document generated for an instance or
+// operation, inheriting the policies of its parent scope in every section
+const PolicySkeleton = `<policies>
+  <inbound>
+    <base />
+  </inbound>
+  <backend>
+    <base />
+  </backend>
+  <outbound>
+    <base />
+  </outbound>
+  <on-error>
+    <base />
+  </on-error>
+</policies>
+`
+
+// FragmentSkeleton is the document generated for a fragment without content
+const FragmentSkeleton = `<fragment>
+</fragment>
+`
+
+// sections of a policies document
+var sections = map[string]bool{
+	"inbound":  true,
+	"backend":  true,
+	"outbound": true,
+	"on-error": true,
+}
+
+// Policies are the policy elements of API Management. Their configuration
+// elements, such as the value of set-header, aren't checked.
+var Policies = map[string]bool{
+	"authentication-basic":               true,
+	"authentication-certificate":         true,
+	"authentication-managed-identity":    true,
+	"azure-openai-emit-token-metric":     true,
+	"azure-openai-semantic-cache-lookup": true,
+	"azure-openai-semantic-cache-store":  true,
+	"azure-openai-token-limit":           true,
+	"base":                               true,
+	"cache-lookup":                       true,
+	"cache-lookup-value":                 true,
+	"cache-remove-value":                 true,
+	"cache-store":                        true,
+	"cache-store-value":                  true,
+	"check-header":                       true,
+	"choose":                             true,
+	"cors":                               true,
+	"cosmosdb-data-source":               true,
+	"cross-domain":                       true,
+	"emit-metric":                        true,
+	"find-and-replace":                   true,
+	"forward-request":                    true,
+	"get-authorization-context":          true,
+	"http-data-source":                   true,
+	"include-fragment":                   true,
+	"invoke-dapr-binding":                true,
+	"ip-filter":                          true,
+	"json-to-xml":                        true,
+	"jsonp":                              true,
+	"limit-concurrency":                  true,
+	"llm-content-safety":                 true,
+	"llm-emit-token-metric":              true,
+	"llm-semantic-cache-lookup":          true,
+	"llm-semantic-cache-store":           true,
+	"llm-token-limit":                    true,
+	"log-to-eventhub":                    true,
+	"mock-response":                      true,
+	"proxy":                              true,
+	"publish-event":                      true,
+	"publish-to-dapr":                    true,
+	"quota":                              true,
+	"quota-by-key":                       true,
+	"rate-limit":                         true,
+	"rate-limit-by-key":                  true,
+	"redirect-content-urls":              true,
+	"retry":                              true,
+	"return-response":                    true,
+	"rewrite-uri":                        true,
+	"send-one-way-request":               true,
+	"send-request":                       true,
+	"set-backend-service":                true,
+	"set-body":                           true,
+	"set-graphql-resolver":               true,
+	"set-header":                         true,
+	"set-method":                         true,
+	"set-query-parameter":                true,
+	"set-status":                         true,
+	"set-variable":                       true,
+	"sql-data-source":                    true,
+	"trace":                              true,
+	"validate-azure-ad-token":            true,
+	"validate-client-certificate":        true,
+	"validate-content":                   true,
+	"validate-graphql-request":           true,
+	"validate-headers":                   true,
+	"validate-jwt":                       true,
+	"validate-odata-request":             true,
+	"validate-parameters":                true,
+	"validate-status-code":               true,
+	"wait":                               true,
+	"xml-to-json":                        true,
+	"xsl-transform":                      true,
+}
+
+// namePattern matches fragment ids and the API and operation of operation
+// policies
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,79}$`)
+
+// ValidName reports whether name is a valid fragment id, API or operation
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// Problem is an issue of a policy document at Line. Unknown problems are
+// elements that aren't API Management policies, which may be newer than
+// Policies; the others make the document invalid.
+type Problem struct {
+	Line    int
+	Message string
+	Unknown bool
+}
+
+// Document is a checked policy document
+type Document struct {
+	// Fragments are the fragment ids of its include-fragment policies
+	Fragments []string
+	Problems  []Problem
+}
+
+// Check parses a policy document with the root element root: it must be
+// well-formed, hold its policies in the sections of a policies document or
+// directly in a fragment, and only use known policy elements there
+func Check(data []byte, root string) Document {
+	var doc Document
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	// frame is an open element and whether its children are policies
+	type frame struct {
+		name     string
+		policies bool
+	}
+	var stack []frame
+	sawRoot := false
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var syntaxErr *xml.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				doc.Problems = append(doc.Problems, Problem{Line: syntaxErr.Line, Message: syntaxErr.Msg})
+			} else {
+				doc.Problems = append(doc.Problems, Problem{Message: err.Error()})
+			}
+			return doc
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			line := lineOf(data, offset)
+			name := t.Name.Local
+			current := frame{name: name}
+			switch {
+			case len(stack) == 0:
+				if sawRoot {
+					doc.Problems = append(doc.Problems, Problem{Line: line, Message: fmt.Sprintf("unexpected element <%s> after the root element", name)})
+				} else if name != root {
+					doc.Problems = append(doc.Problems, Problem{Line: line, Message: fmt.Sprintf("root element must be <%s>, not <%s>", root, name)})
+				}
+				sawRoot = true
+				current.policies = name == RootFragment
+			case len(stack) == 1 && stack[0].name == RootPolicies:
+				if !sections[name] {
+					doc.Problems = append(doc.Problems, Problem{Line: line, Message: fmt.Sprintf("<%s> is not a section of <policies>, must be inbound, backend, outbound or on-error", name)})
+				}
+				current.policies = true
+			case stack[len(stack)-1].name == "choose":
+				// The conditions of choose hold policies
+				if name != "when" && name != "otherwise" {
+					doc.Problems = append(doc.Problems, Problem{Line: line, Message: fmt.Sprintf("<%s> is not a condition of <choose>, must be when or otherwise", name)})
+				}
+				current.policies = true
+			case stack[len(stack)-1].policies:
+				if !Policies[name] {
+					doc.Problems = append(doc.Problems, Problem{Line: line, Message: fmt.Sprintf("<%s> is not a known API Management policy", name), Unknown: true})
+				}
+				if name == "include-fragment" {
+					if id := attr(t, "fragment-id"); id != "" {
+						doc.Fragments = append(doc.Fragments, id)
+					} else {
+						doc.Problems = append(doc.Problems, Problem{Line: line, Message: "<include-fragment> must set fragment-id"})
+					}
+				}
+				current.policies = name == "retry"
+			}
+			stack = append(stack, current)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	if !sawRoot {
+		doc.Problems = append(doc.Problems, Problem{Message: fmt.Sprintf("document must have a <%s> root element", root)})
+	} else if len(stack) > 0 {
+		doc.Problems = append(doc.Problems, Problem{Line: lineOf(data, int64(len(data))), Message: fmt.Sprintf("element <%s> is not closed", stack[len(stack)-1].name)})
+	}
+	return doc
+}
+
+// attr returns the value of an attribute of an element
+func attr(element xml.StartElement, name string) string {
+	for _, a := range element.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// lineOf returns the line of a byte offset of data
+func lineOf(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
@@ -0,0 +1,56 @@
+package apim
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	if doc := Check([]byte(PolicySkeleton), RootPolicies); len(doc.Problems) > 0 {
+		t.Errorf("Check(PolicySkeleton) problems = %v, want none", doc.Problems)
+	}
+	if doc := Check([]byte(FragmentSkeleton), RootFragment); len(doc.Problems) > 0 {
+		t.Errorf("Check(FragmentSkeleton) problems = %v, want none", doc.Problems)
+	}
+
+	policy := `<policies>
+  <inbound>
+    <base />
+    <include-fragment fragment-id="cors" />
+    <choose>
+      <when condition="@(context.Request.Method == &quot;GET&quot;)">
+        <set-headr name="x" exists-action="override"><value>1</value></set-headr>
+      </when>
+    </choose>
+    <set-header name="y" exists-action="override"><value>2</value></set-header>
+  </inbound>
+  <frontend />
+</policies>`
+	doc := Check([]byte(policy), RootPolicies)
+	if !reflect.DeepEqual(doc.Fragments, []string{"cors"}) {
+		t.Errorf("Fragments = %v, want [cors]", doc.Fragments)
+	}
+	want := []Problem{
+		{Line: 7, Message: "<set-headr> is not a known API Management policy", Unknown: true},
+		{Line: 12, Message: "<frontend> is not a section of <policies>, must be inbound, backend, outbound or on-error"},
+	}
+	if !reflect.DeepEqual(doc.Problems, want) {
+		t.Errorf("Problems = %v, want %v", doc.Problems, want)
+	}
+
+	tests := []struct {
+		data string
+		root string
+		line int
+	}{
+		{"<policies>\n  <inbound>\n</policies>", RootPolicies, 3},
+		{"<configuration>\n</configuration>", RootPolicies, 1},
+		{"<policies>\n</policies>", RootFragment, 1},
+	}
+	for _, tt := range tests {
+		doc := Check([]byte(tt.data), tt.root)
+		if len(doc.Problems) != 1 || doc.Problems[0].Line != tt.line || doc.Problems[0].Unknown {
+			t.Errorf("Check(%q) problems = %v, want one invalid document problem at line %d", tt.data, doc.Problems, tt.line)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+// Package appsettings reads the app settings files generated for components
+// with app_settings. Settings are layered: the global file, then the file of
+// the environment, then the file of the app, each replacing the settings of
+// the same name of the layers before it. The generated appsettings.hcl merges
+// them the same way.
+package appsettings
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+)
+
+// Layers of the settings, in merge order
+const (
+	LayerGlobal      = "global"
+	LayerEnvironment = "environment"
+	LayerApp         = "app"
+)
+
+// FileSuffix ends the name of every settings file
+const FileSuffix = ".appsettings.json"
+
+// ReservedKeys are the settings the azurerm web and function app resources
+// manage through their own arguments. Setting them in a file conflicts with
+// those arguments and makes every plan show a change.
+var ReservedKeys = []string{
+	"APPINSIGHTS_INSTRUMENTATIONKEY",
+	"APPLICATIONINSIGHTS_CONNECTION_STRING",
+	"AzureWebJobsDashboard",
+	"AzureWebJobsStorage",
+	"DOCKER_REGISTRY_SERVER_PASSWORD",
+	"DOCKER_REGISTRY_SERVER_URL",
+	"DOCKER_REGISTRY_SERVER_USERNAME",
+	"FUNCTIONS_EXTENSION_VERSION",
+	"FUNCTIONS_WORKER_RUNTIME",
+	"WEBSITE_CONTENTAZUREFILECONNECTIONSTRING",
+	"WEBSITE_CONTENTSHARE",
+	"WEBSITE_NODE_DEFAULT_VERSION",
+}
+
+// Reserved reports whether a setting is one of ReservedKeys. App settings
+// names are case-insensitive.
+func Reserved(key string) bool {
+	for _, reserved := range ReservedKeys {
+		if strings.EqualFold(key, reserved) {
+			return true
+		}
+	}
+	return false
+}
+
+// Layer is a settings file merged into the settings of an app
+type Layer struct {
+	Name string
+	Path string
+}
+
+// Dir returns the directory holding the settings files of a component
+func Dir(stackName, compName string) string {
+	return output.Path("config", stackName, "app_settings_"+compName)
+}
+
+// Layers returns the settings files of an app in an environment, in merge
+// order
+func Layers(stackName, compName, subName, envName, appName string) []Layer {
+	dir := Dir(stackName, compName)
+	envDir := filepath.Join(dir, subName, envName)
+	return []Layer{
+		{Name: LayerGlobal, Path: filepath.Join(dir, LayerGlobal+FileSuffix)},
+		{Name: LayerEnvironment, Path: filepath.Join(envDir, envName+FileSuffix)},
+		{Name: LayerApp, Path: filepath.Join(envDir, appName+FileSuffix)},
+	}
+}
+
+// Error is a problem of a settings file, at Line when it's known
+type Error struct {
+	Line    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+	}
+	return e.Message
+}
+
+// Parse parses a settings file: a JSON object of settings whose values are
+// strings, numbers or booleans. Numbers and booleans are returned as their
+// JSON text, like Terraform converts them for app_settings.
+func Parse(data []byte) (map[string]string, error) {
+	var raw interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return nil, &Error{Line: lineOf(data, syntaxErr.Offset), Message: syntaxErr.Error()}
+		}
+		return nil, &Error{Message: err.Error()}
+	}
+	if decoder.More() {
+		return nil, &Error{Message: "unexpected content after the settings object"}
+	}
+
+	object, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, &Error{Message: "settings must be a JSON object"}
+	}
+	settings := make(map[string]string, len(object))
+	for key, value := range object {
+		switch v := value.(type) {
+		case string:
+			settings[key] = v
+		case json.Number:
+			settings[key] = v.String()
+		case bool:
+			settings[key] = fmt.Sprint(v)
+		default:
+			return nil, &Error{Line: lineOf(data, int64(bytes.Index(data, []byte(fmt.Sprintf("%q", key))))+1), Message: fmt.Sprintf("setting %s must be a string, number or boolean", key)}
+		}
+	}
+	return settings, nil
+}
+
+// lineOf returns the line of a byte offset of data
+func lineOf(data []byte, offset int64) int {
+	if offset <= 0 {
+		return 0
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// Read reads and parses a settings file
+func Read(path string) (map[string]string, error) {
+	data, err := project.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read app settings file: %w", err)
+	}
+	settings, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// Setting is a merged setting and the layer it comes from
+type Setting struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Layer string `json:"layer"`
+}
+
+// Merge reads the layers in order, the settings of a layer replacing those
+// of the same name before it, and returns the result sorted by name
+func Merge(layers []Layer) ([]Setting, error) {
+	merged := make(map[string]Setting)
+	for _, layer := range layers {
+		settings, err := Read(layer.Path)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range settings {
+			merged[name] = Setting{Name: name, Value: value, Layer: layer.Name}
+		}
+	}
+
+	result := make([]Setting, 0, len(merged))
+	for _, setting := range merged {
+		result = append(result, setting)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// Target is an app of a component with app_settings in an environment
+type Target struct {
+	Subscription string
+	Environment  string
+	Stack        string
+	Component    string
+	App          string
+}
+
+// Layers returns the settings files of the target, in merge order
+func (t Target) Layers() []Layer {
+	return Layers(t.Stack, t.Component, t.Subscription, t.Environment, t.App)
+}
+
+// Find resolves an app of an environment to its subscription, stack and
+// component. subName and compName narrow the search and are required when
+// the environment or app name alone is ambiguous.
+func Find(tgsConfig *config.TGSConfig, envName, appName, subName, compName string) (Target, error) {
+	target := Target{Environment: envName, App: appName}
+
+	var subs []string
+	for name, sub := range tgsConfig.Subscriptions {
+		if subName != "" && name != subName {
+			continue
+		}
+		for _, env := range sub.Environments {
+			if env.Name == envName {
+				subs = append(subs, name)
+				target.Stack = env.Stack
+			}
+		}
+	}
+	sort.Strings(subs)
+	switch {
+	case len(subs) == 0 && subName != "":
+		return target, fmt.Errorf("environment %s is not defined in subscription %s", envName, subName)
+	case len(subs) == 0:
+		return target, fmt.Errorf("environment %s is not defined", envName)
+	case len(subs) > 1:
+		return target, fmt.Errorf("environment %s is defined in subscriptions %s: select one with --subscription", envName, strings.Join(subs, ", "))
+	}
+	target.Subscription = subs[0]
+	if target.Stack == "" {
+		target.Stack = "main"
+	}
+
+	mainConfig, err := config.ReadMainConfig(target.Stack)
+	if err != nil {
+		return target, err
+	}
+
+	var comps []string
+	for name, comp := range mainConfig.Stack.Components {
+		if !comp.AppSettings || (compName != "" && name != compName) {
+			continue
+		}
+		if hasApp(mainConfig, name, appName) {
+			comps = append(comps, name)
+		}
+	}
+	sort.Strings(comps)
+	switch {
+	case len(comps) == 0 && compName != "":
+		return target, fmt.Errorf("component %s of stack %s has no app_settings or no app %s", compName, target.Stack, appName)
+	case len(comps) == 0:
+		return target, fmt.Errorf("no component with app_settings of stack %s has an app %s", target.Stack, appName)
+	case len(comps) > 1:
+		return target, fmt.Errorf("app %s belongs to components %s: select one with --component", appName, strings.Join(comps, ", "))
+	}
+	target.Component = comps[0]
+	return target, nil
+}
+
+// hasApp reports whether a component has an app in any region
+func hasApp(mainConfig *config.MainConfig, compName, appName string) bool {
+	for _, comps := range mainConfig.Stack.Architecture.Regions {
+		for _, rc := range comps {
+			if rc.Component != compName {
+				continue
+			}
+			for _, app := range rc.Apps {
+				if app == appName {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package appsettings
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+)
+
+func TestParse(t *testing.T) {
+	settings, err := Parse([]byte(`{"A": "a", "N": 3, "T": true}`))
+	if err != nil {
+		t.Fatalf("Parse() unexpected error: %v", err)
+	}
+	if want := map[string]string{"A": "a", "N": "3", "T": "true"}; !reflect.DeepEqual(settings, want) {
+		t.Errorf("Parse() = %v, want %v", settings, want)
+	}
+
+	tests := []struct {
+		data string
+		line int
+	}{
+		{"{\n  \"A\": \"a\",\n  \"B\": \n}", 4},
+		{"{\n  \"A\": {\"nested\": true}\n}", 2},
+		{`["A"]`, 0},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.data))
+		var fileErr *Error
+		if !errors.As(err, &fileErr) {
+			t.Errorf("Parse(%q) error = %v, want an *Error", tt.data, err)
+			continue
+		}
+		if fileErr.Line != tt.line {
+			t.Errorf("Parse(%q) line = %d, want %d", tt.data, fileErr.Line, tt.line)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"global.json": `{"A": "global", "B": "global", "C": "global"}`,
+		"env.json":    `{"B": "env", "C": "env"}`,
+		"app.json":    `{"C": "app"}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	settings, err := Merge([]Layer{
+		{Name: LayerGlobal, Path: filepath.Join(dir, "global.json")},
+		{Name: LayerEnvironment, Path: filepath.Join(dir, "env.json")},
+		{Name: LayerApp, Path: filepath.Join(dir, "app.json")},
+	})
+	if err != nil {
+		t.Fatalf("Merge() unexpected error: %v", err)
+	}
+	want := []Setting{
+		{Name: "A", Value: "global", Layer: LayerGlobal},
+		{Name: "B", Value: "env", Layer: LayerEnvironment},
+		{Name: "C", Value: "app", Layer: LayerApp},
+	}
+	if !reflect.DeepEqual(settings, want) {
+		t.Errorf("Merge() = %v, want %v", settings, want)
+	}
+}
+
+func TestFind(t *testing.T) {
+	tgsConfig := &config.TGSConfig{Subscriptions: map[string]config.Subscription{
+		"nonprod": {Environments: []config.Environment{{Name: "dev"}}},
+		"prod":    {Environments: []config.Environment{{Name: "prod"}, {Name: "dev"}}},
+	}}
+	stack := &config.MainConfig{Stack: config.StackConfig{
+		Components: map[string]config.Component{
+			"appservice":  {AppSettings: true},
+			"functionapp": {AppSettings: true},
+			"serviceplan": {},
+		},
+		Architecture: config.ArchitectureConfig{Regions: map[string][]config.RegionComponent{
+			"eastus2": {
+				{Component: "serviceplan", Apps: []string{"api"}},
+				{Component: "appservice", Apps: []string{"api", "web"}},
+				{Component: "functionapp", Apps: []string{"api"}},
+			},
+		}},
+	}}
+	config.Use(tgsConfig, map[string]*config.MainConfig{"main": stack})
+	defer config.Use(nil, nil)
+
+	target, err := Find(tgsConfig, "dev", "web", "nonprod", "")
+	if err != nil {
+		t.Fatalf("Find() unexpected error: %v", err)
+	}
+	if want := (Target{Subscription: "nonprod", Environment: "dev", Stack: "main", Component: "appservice", App: "web"}); target != want {
+		t.Errorf("Find() = %+v, want %+v", target, want)
+	}
+
+	// dev is in two subscriptions and api belongs to two components with
+	// app_settings
+	if _, err := Find(tgsConfig, "dev", "web", "", ""); err == nil {
+		t.Error("Find() without subscription expected an error")
+	}
+	if _, err := Find(tgsConfig, "prod", "api", "", ""); err == nil {
+		t.Error("Find() without component expected an error")
+	}
+	if target, err := Find(tgsConfig, "prod", "api", "", "functionapp"); err != nil || target.Component != "functionapp" {
+		t.Errorf("Find() = %+v, %v, want component functionapp", target, err)
+	}
+}
@@ -0,0 +1,126 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	azcloud "github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+)
+
+// backendTimeout bounds the checks of a state backend
+const backendTimeout = 30 * time.Second
+
+// StateBackend is the azurerm backend storing the state of a subscription
+type StateBackend struct {
+	SubscriptionID string
+	ResourceGroup  string
+	StorageAccount string
+	Container      string
+	Cloud          string
+	// AzureADAuth reads the state with Entra ID instead of account keys
+	AzureADAuth bool
+}
+
+// CheckStateBackend confirms that the resource group, storage account and
+// container of a backend exist and that the signed in Azure CLI account can
+// read the state the way the backend does: listing the account keys, or
+// reading the container with Entra ID. It returns the first problem found.
+func CheckStateBackend(backend StateBackend) error {
+	cloud, err := CloudFor(backend.Cloud)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), backendTimeout)
+	defer cancel()
+
+	options := &arm.ClientOptions{ClientOptions: policy.ClientOptions{Cloud: cloud.configuration()}}
+	factory, err := armstorage.NewClientFactory(backend.SubscriptionID, cliCredential{}, options)
+	if err != nil {
+		return fmt.Errorf("failed to create storage management client: %w", err)
+	}
+
+	if _, err := factory.NewAccountsClient().GetProperties(ctx, backend.ResourceGroup, backend.StorageAccount, nil); err != nil {
+		return describeBackendError(backend, "storage account", err)
+	}
+	if _, err := factory.NewBlobContainersClient().Get(ctx, backend.ResourceGroup, backend.StorageAccount, backend.Container, nil); err != nil {
+		return describeBackendError(backend, "container", err)
+	}
+
+	if !backend.AzureADAuth {
+		if _, err := factory.NewAccountsClient().ListKeys(ctx, backend.ResourceGroup, backend.StorageAccount, nil); err != nil {
+			return describeBackendError(backend, "account keys", err)
+		}
+		return nil
+	}
+
+	serviceURL := fmt.Sprintf("https://%s.blob.%s/", backend.StorageAccount, cloud.StorageSuffix)
+	client, err := azblob.NewClient(serviceURL, cliCredential{}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create storage client: %w", err)
+	}
+	if _, err := client.ServiceClient().NewContainerClient(backend.Container).GetProperties(ctx, nil); err != nil {
+		return describeBackendError(backend, "blobs", err)
+	}
+	return nil
+}
+
+// describeBackendError explains the error of checking target of a backend:
+// what doesn't exist or what the signed in account may not do
+func describeBackendError(backend StateBackend, target string, err error) error {
+	var responseErr *azcore.ResponseError
+	if !errors.As(err, &responseErr) {
+		return fmt.Errorf("failed to reach storage account %s: %w", backend.StorageAccount, err)
+	}
+
+	switch {
+	case responseErr.ErrorCode == "SubscriptionNotFound" || responseErr.ErrorCode == "InvalidSubscriptionId":
+		return fmt.Errorf("subscription %s doesn't exist or isn't visible to the signed in account", backend.SubscriptionID)
+	case responseErr.ErrorCode == "ResourceGroupNotFound":
+		return fmt.Errorf("resource group %s doesn't exist in subscription %s", backend.ResourceGroup, backend.SubscriptionID)
+	case responseErr.ErrorCode == "ContainerNotFound" || (target == "container" && responseErr.StatusCode == http.StatusNotFound):
+		return fmt.Errorf("container %s doesn't exist in storage account %s, create it with tgs create container", backend.Container, backend.StorageAccount)
+	case responseErr.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("storage account %s doesn't exist in resource group %s", backend.StorageAccount, backend.ResourceGroup)
+	case responseErr.StatusCode == http.StatusForbidden || responseErr.StatusCode == http.StatusUnauthorized:
+		switch target {
+		case "account keys":
+			return fmt.Errorf("the signed in account can't list the keys of storage account %s (%s), which the backend reads the state with", backend.StorageAccount, responseErr.ErrorCode)
+		case "blobs":
+			return fmt.Errorf("the signed in account can't read container %s with Entra ID (%s), it needs the Storage Blob Data Contributor role", backend.Container, responseErr.ErrorCode)
+		}
+		return fmt.Errorf("the signed in account can't read %s %s (%s)", target, backend.StorageAccount, responseErr.ErrorCode)
+	}
+	return fmt.Errorf("failed to check %s of storage account %s: %s %d", target, backend.StorageAccount, responseErr.ErrorCode, responseErr.StatusCode)
+}
+
+// CLISubscription returns the id of the subscription the Azure CLI is
+// signed in to
+func CLISubscription() (string, error) {
+	out, err := exec.Command("az", "account", "show", "--query", "id", "--output", "tsv").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read the subscription of the Azure CLI (run az login): %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// configuration returns the azcore configuration of the cloud's Azure
+// Resource Manager endpoint
+func (c Cloud) configuration() azcloud.Configuration {
+	switch c.Name {
+	case CloudUSGov:
+		return azcloud.AzureGovernment
+	case CloudChina:
+		return azcloud.AzureChina
+	}
+	return azcloud.AzurePublic
+}
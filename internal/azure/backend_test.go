@@ -0,0 +1,30 @@
+package azure
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+func TestDescribeBackendError(t *testing.T) {
+	backend := StateBackend{SubscriptionID: "sub", ResourceGroup: "rg-state", StorageAccount: "stprojectstate", Container: "project"}
+	tests := []struct {
+		target string
+		err    error
+		want   string
+	}{
+		{"storage account", &azcore.ResponseError{ErrorCode: "ResourceGroupNotFound", StatusCode: http.StatusNotFound}, "resource group rg-state doesn't exist"},
+		{"storage account", &azcore.ResponseError{ErrorCode: "ResourceNotFound", StatusCode: http.StatusNotFound}, "storage account stprojectstate doesn't exist"},
+		{"container", &azcore.ResponseError{ErrorCode: "ContainerNotFound", StatusCode: http.StatusNotFound}, "container project doesn't exist"},
+		{"account keys", &azcore.ResponseError{ErrorCode: "AuthorizationFailed", StatusCode: http.StatusForbidden}, "can't list the keys"},
+		{"storage account", errors.New("no such host"), "failed to reach storage account stprojectstate"},
+	}
+	for _, tt := range tests {
+		if got := describeBackendError(backend, tt.target, tt.err).Error(); !strings.Contains(got, tt.want) {
+			t.Errorf("describeBackendError(%s, %v) = %s, want it to contain %q", tt.target, tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package azure
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Supported Azure clouds
+const (
+	CloudPublic = "public"
+	CloudUSGov  = "usgov"
+	CloudChina  = "china"
+)
+
+// Cloud describes the endpoints and names of an Azure cloud
+type Cloud struct {
+	Name string
+	// TerraformEnvironment is the azurerm provider and backend environment
+	TerraformEnvironment string
+	// StorageSuffix is the storage endpoint suffix, e.g. core.windows.net
+	StorageSuffix string
+	// CLIName is the cloud name used by the Azure CLI
+	CLIName string
+}
+
+// Clouds lists the supported Azure clouds by name
+var Clouds = map[string]Cloud{
+	CloudPublic: {Name: CloudPublic, TerraformEnvironment: "public", StorageSuffix: "core.windows.net", CLIName: "AzureCloud"},
+	CloudUSGov:  {Name: CloudUSGov, TerraformEnvironment: "usgovernment", StorageSuffix: "core.usgovcloudapi.net", CLIName: "AzureUSGovernment"},
+	CloudChina:  {Name: CloudChina, TerraformEnvironment: "china", StorageSuffix: "core.chinacloudapi.cn", CLIName: "AzureChinaCloud"},
+}
+
+// CloudFor returns the cloud with the given name, defaulting to the public
+// cloud when name is empty
+func CloudFor(name string) (Cloud, error) {
+	if name == "" {
+		name = CloudPublic
+	}
+
+	cloud, ok := Clouds[name]
+	if !ok {
+		return Cloud{}, fmt.Errorf("unsupported Azure cloud %q: must be one of %s", name, strings.Join(CloudNames(), ", "))
+	}
+	return cloud, nil
+}
+
+// CloudNames returns the names of the supported clouds in order
+func CloudNames() []string {
+	var names []string
+	for name := range Clouds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cloudForCLIName maps an Azure CLI cloud name to a supported cloud
+func cloudForCLIName(cliName string) (Cloud, error) {
+	for _, cloud := range Clouds {
+		if strings.EqualFold(cloud.CLIName, cliName) {
+			return cloud, nil
+		}
+	}
+	return Cloud{}, fmt.Errorf("unsupported Azure CLI cloud: %s", cliName)
+}
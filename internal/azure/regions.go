@@ -0,0 +1,204 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+)
+
+// RegionCacheDir is where region catalogs refreshed from Azure are cached
+const RegionCacheDir = ".tgs/cache"
+
+// builtinRegions are the region catalogs of each cloud used until they are
+// refreshed from Azure
+var builtinRegions = map[string][]string{
+	CloudPublic: builtinPublicRegions,
+	CloudUSGov: {
+		"usdodcentral", "usdodeast",
+		"usgovarizona", "usgovtexas", "usgovvirginia",
+	},
+	CloudChina: {
+		"chinaeast", "chinaeast2", "chinaeast3",
+		"chinanorth", "chinanorth2", "chinanorth3",
+	},
+}
+
+var builtinPublicRegions = []string{
+	"australiacentral", "australiaeast", "australiasoutheast",
+	"brazilsouth", "brazilsoutheast",
+	"canadacentral", "canadaeast",
+	"centralindia", "southindia", "westindia",
+	"centralus", "eastus", "eastus2", "northcentralus", "southcentralus",
+	"westcentralus", "westus", "westus2", "westus3",
+	"eastasia", "southeastasia",
+	"francecentral", "francesouth",
+	"germanynorth", "germanywestcentral",
+	"israelcentral",
+	"italynorth",
+	"japaneast", "japanwest",
+	"koreacentral", "koreasouth",
+	"mexicocentral",
+	"newzealandnorth",
+	"northeurope", "westeurope",
+	"norwayeast", "norwaywest",
+	"polandcentral",
+	"qatarcentral",
+	"southafricanorth", "southafricawest",
+	"spaincentral",
+	"swedencentral",
+	"switzerlandnorth", "switzerlandwest",
+	"uaecentral", "uaenorth",
+	"uksouth", "ukwest",
+}
+
+// activeCloud returns the name of the cloud the Azure CLI is set to
+var activeCloud = func() (string, error) {
+	output, err := exec.Command("az", "cloud", "show", "--query", "name", "--output", "tsv").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read the active Azure CLI cloud (is the Azure CLI installed?): %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// listLocations returns the physical Azure regions available to the signed
+// in account as a JSON array of names
+var listLocations = func() ([]byte, error) {
+	cmd := exec.Command("az", "account", "list-locations",
+		"--query", "[?metadata.regionType=='Physical'].name", "--output", "json")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Azure locations (is the Azure CLI installed and logged in?): %w", err)
+	}
+	return output, nil
+}
+
+// RegionCatalog is the set of regions of an Azure cloud known to tgs
+type RegionCatalog struct {
+	Cloud string
+	// Source is "builtin" or the time the catalog was refreshed from Azure
+	Source  string
+	Regions []string
+	names   map[string]bool
+}
+
+// regionCache is the on-disk format of the refreshed region catalog
+type regionCache struct {
+	FetchedAt time.Time `json:"fetched_at"`
+	Regions   []string  `json:"regions"`
+}
+
+var loadedCatalogs = make(map[string]*RegionCatalog)
+
+// Regions returns the region catalog of a cloud, reading the catalog
+// refreshed from Azure if there is one and falling back to the built-in
+// regions. An empty cloud is the public cloud.
+func Regions(cloud string) *RegionCatalog {
+	if cloud == "" {
+		cloud = CloudPublic
+	}
+	if loadedCatalogs[cloud] == nil {
+		loadedCatalogs[cloud] = loadRegions(RegionCacheDir, cloud)
+	}
+	return loadedCatalogs[cloud]
+}
+
+// IsRegion reports whether name is a region of any supported cloud
+func IsRegion(name string) bool {
+	for _, cloud := range CloudNames() {
+		if Regions(cloud).Has(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Has reports whether the catalog contains a region
+func (c *RegionCatalog) Has(name string) bool {
+	return c.names[name]
+}
+
+// RefreshRegions fetches the region catalog of the cloud the Azure CLI is
+// set to and caches it
+func RefreshRegions() (*RegionCatalog, error) {
+	catalog, err := refreshRegions(RegionCacheDir)
+	if err != nil {
+		return nil, err
+	}
+	loadedCatalogs[catalog.Cloud] = catalog
+	return catalog, nil
+}
+
+// regionCachePath returns the cache file of a cloud's region catalog
+func regionCachePath(cacheDir, cloud string) string {
+	if cloud == CloudPublic {
+		return filepath.Join(cacheDir, "regions.json")
+	}
+	return filepath.Join(cacheDir, fmt.Sprintf("regions-%s.json", cloud))
+}
+
+func refreshRegions(cacheDir string) (*RegionCatalog, error) {
+	cliName, err := activeCloud()
+	if err != nil {
+		return nil, err
+	}
+	cloud, err := cloudForCLIName(cliName)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := listLocations()
+	if err != nil {
+		return nil, err
+	}
+
+	var regions []string
+	if err := json.Unmarshal(output, &regions); err != nil {
+		return nil, fmt.Errorf("failed to parse Azure locations: %w", err)
+	}
+	if len(regions) == 0 {
+		return nil, fmt.Errorf("no Azure locations returned")
+	}
+
+	entry := regionCache{FetchedAt: time.Now().UTC(), Regions: regions}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal region catalog: %w", err)
+	}
+	if err := project.MkdirAll(cacheDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	if err := project.WriteFile(regionCachePath(cacheDir, cloud.Name), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write region catalog: %w", err)
+	}
+
+	return newRegionCatalog(cloud.Name, entry.FetchedAt.Format(time.RFC3339), regions), nil
+}
+
+func loadRegions(cacheDir, cloud string) *RegionCatalog {
+	data, err := project.ReadFile(regionCachePath(cacheDir, cloud))
+	if err == nil {
+		var entry regionCache
+		if err := json.Unmarshal(data, &entry); err == nil && len(entry.Regions) > 0 {
+			return newRegionCatalog(cloud, entry.FetchedAt.Format(time.RFC3339), entry.Regions)
+		}
+	}
+	return newRegionCatalog(cloud, "builtin", builtinRegions[cloud])
+}
+
+func newRegionCatalog(cloud, source string, regions []string) *RegionCatalog {
+	catalog := &RegionCatalog{Cloud: cloud, Source: source, names: make(map[string]bool)}
+	for _, region := range regions {
+		if !catalog.names[region] {
+			catalog.names[region] = true
+			catalog.Regions = append(catalog.Regions, region)
+		}
+	}
+	sort.Strings(catalog.Regions)
+	return catalog
+}
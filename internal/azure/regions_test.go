@@ -0,0 +1,57 @@
+package azure
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestRegionCatalog(t *testing.T) {
+	cacheDir := t.TempDir()
+
+	// Without a cache the built-in catalogs are used
+	catalog := loadRegions(cacheDir, CloudPublic)
+	if catalog.Source != "builtin" || !catalog.Has("eastus2") || catalog.Has("usgovvirginia") {
+		t.Fatalf("Unexpected built-in public catalog: %s %v", catalog.Source, catalog.Regions)
+	}
+	if gov := loadRegions(cacheDir, CloudUSGov); !gov.Has("usgovvirginia") || gov.Has("eastus2") {
+		t.Fatalf("Unexpected built-in usgov catalog: %v", gov.Regions)
+	}
+
+	oldCloud, oldList := activeCloud, listLocations
+	t.Cleanup(func() { activeCloud, listLocations = oldCloud, oldList })
+
+	activeCloud = func() (string, error) { return "AzureUSGovernment", nil }
+	listLocations = func() ([]byte, error) {
+		return []byte(`["usgovtexas", "usgovmars", "usgovvirginia", "usgovtexas"]`), nil
+	}
+	refreshed, err := refreshRegions(cacheDir)
+	if err != nil {
+		t.Fatalf("Failed to refresh regions: %v", err)
+	}
+	if refreshed.Cloud != CloudUSGov {
+		t.Errorf("Expected the usgov catalog to be refreshed, got %s", refreshed.Cloud)
+	}
+
+	// The refreshed catalog replaces the built-in one of its cloud only
+	catalog = loadRegions(cacheDir, CloudUSGov)
+	want := []string{"usgovmars", "usgovtexas", "usgovvirginia"}
+	if !reflect.DeepEqual(catalog.Regions, want) {
+		t.Errorf("Expected %v, got %v", want, catalog.Regions)
+	}
+	if catalog.Source == "builtin" {
+		t.Errorf("Expected the refreshed catalog, got %s", catalog.Source)
+	}
+	if public := loadRegions(cacheDir, CloudPublic); public.Source != "builtin" {
+		t.Errorf("Expected the public catalog to stay built-in, got %s", public.Source)
+	}
+
+	// A failed refresh keeps the cached catalog
+	listLocations = func() ([]byte, error) { return nil, fmt.Errorf("az not logged in") }
+	if _, err := refreshRegions(cacheDir); err == nil {
+		t.Error("Expected an error when the Azure CLI fails")
+	}
+	if catalog = loadRegions(cacheDir, CloudUSGov); !catalog.Has("usgovmars") {
+		t.Errorf("Expected the cached catalog to be kept, got %v", catalog.Regions)
+	}
+}
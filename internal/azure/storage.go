@@ -2,14 +2,27 @@ package azure
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"strings"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
 )
 
 // CreateContainer creates a new container in the specified storage account
-func CreateContainer(storageAccountName, containerName string) error {
+// of the given Azure cloud
+func CreateContainer(storageAccountName, containerName, cloudName string) error {
+	cloud, err := CloudFor(cloudName)
+	if err != nil {
+		return err
+	}
+
 	// Get the storage account key from environment variable
 	storageAccountKey := os.Getenv("AZURE_STORAGE_KEY")
 	if storageAccountKey == "" {
@@ -23,7 +36,7 @@ func CreateContainer(storageAccountName, containerName string) error {
 	}
 
 	// Create a service client
-	serviceURL := fmt.Sprintf("https://%s.blob.core.windows.net/", storageAccountName)
+	serviceURL := fmt.Sprintf("https://%s.blob.%s/", storageAccountName, cloud.StorageSuffix)
 	client, err := azblob.NewClientWithSharedKeyCredential(serviceURL, cred, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create storage client: %w", err)
@@ -37,3 +50,118 @@ func CreateContainer(storageAccountName, containerName string) error {
 
 	return nil
 }
+
+// Blob is a blob listed from a storage container
+type Blob struct {
+	Name         string
+	Size         int64
+	LastModified time.Time
+}
+
+// ListBlobs lists the blobs of a container, signing in as the Azure CLI
+// account the way the migration scripts run az storage --auth-mode login
+func ListBlobs(storageAccountName, containerName, cloudName string) ([]Blob, error) {
+	cloud, err := CloudFor(cloudName)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceURL := fmt.Sprintf("https://%s.blob.%s/", storageAccountName, cloud.StorageSuffix)
+	client, err := azblob.NewClient(serviceURL, cliCredential{}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage client: %w", err)
+	}
+
+	var blobs []Blob
+	pager := client.NewListBlobsFlatPager(containerName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list blobs of %s/%s: %w", storageAccountName, containerName, err)
+		}
+		for _, item := range page.Segment.BlobItems {
+			blob := Blob{Name: *item.Name}
+			if item.Properties != nil {
+				if item.Properties.ContentLength != nil {
+					blob.Size = *item.Properties.ContentLength
+				}
+				if item.Properties.LastModified != nil {
+					blob.LastModified = *item.Properties.LastModified
+				}
+			}
+			blobs = append(blobs, blob)
+		}
+	}
+	return blobs, nil
+}
+
+// CopyBlobs copies blobs to another container, possibly of another storage
+// account, under destinationPrefix as the signed in Azure CLI account. State
+// blobs are small, so copies go through memory instead of a server side copy
+// needing the service to read the source account.
+func CopyBlobs(sourceAccount, sourceContainer string, blobs []string, destinationAccount, destinationContainer, destinationPrefix, cloudName string) error {
+	cloud, err := CloudFor(cloudName)
+	if err != nil {
+		return err
+	}
+
+	source, err := azblob.NewClient(fmt.Sprintf("https://%s.blob.%s/", sourceAccount, cloud.StorageSuffix), cliCredential{}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create storage client: %w", err)
+	}
+	destination := source
+	if destinationAccount != sourceAccount {
+		destination, err = azblob.NewClient(fmt.Sprintf("https://%s.blob.%s/", destinationAccount, cloud.StorageSuffix), cliCredential{}, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create storage client: %w", err)
+		}
+	}
+
+	for _, blob := range blobs {
+		resp, err := source.DownloadStream(context.Background(), sourceContainer, blob, nil)
+		if err != nil {
+			return fmt.Errorf("failed to download %s: %w", blob, err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to download %s: %w", blob, err)
+		}
+
+		if _, err := destination.UploadBuffer(context.Background(), destinationContainer, destinationPrefix+blob, data, nil); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", destinationPrefix+blob, err)
+		}
+	}
+	return nil
+}
+
+// cliCredential gets tokens from the signed in Azure CLI account
+type cliCredential struct{}
+
+var _ azcore.TokenCredential = cliCredential{}
+
+// GetToken runs az account get-access-token for the requested scope
+func (cliCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	if len(options.Scopes) != 1 {
+		return azcore.AccessToken{}, fmt.Errorf("expected a single token scope, got %d", len(options.Scopes))
+	}
+
+	out, err := exec.CommandContext(ctx, "az", "account", "get-access-token", "--scope", options.Scopes[0], "--output", "json").Output()
+	if err != nil {
+		return azcore.AccessToken{}, fmt.Errorf("failed to get an access token from the Azure CLI (run az login): %w", err)
+	}
+
+	var token struct {
+		AccessToken string `json:"accessToken"`
+		ExpiresOn   int64  `json:"expires_on"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(string(out))), &token); err != nil {
+		return azcore.AccessToken{}, fmt.Errorf("failed to parse Azure CLI access token: %w", err)
+	}
+	expiresOn := time.Unix(token.ExpiresOn, 0)
+	if token.ExpiresOn == 0 {
+		// Azure CLI releases before expires_on only report a local time
+		expiresOn = time.Now().Add(5 * time.Minute)
+	}
+	return azcore.AccessToken{Token: token.AccessToken, ExpiresOn: expiresOn}, nil
+}
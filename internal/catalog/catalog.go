@@ -0,0 +1,144 @@
+// Package catalog provides curated component definitions that can be added
+// to a stack instead of writing components by hand
+package catalog
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/mirror"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed definitions/*.yaml
+var definitionsFS embed.FS
+
+// Entry is a curated set of components deployed together
+type Entry struct {
+	Name        string                      `yaml:"name"`
+	Description string                      `yaml:"description"`
+	Components  map[string]config.Component `yaml:"components"`
+	// Apps lists the components that get the app instances of a placement
+	Apps []string `yaml:"apps,omitempty"`
+	// Source is "builtin" or "mirror"
+	Source string `yaml:"-"`
+}
+
+// ComponentNames returns the names of the entry's components with
+// dependencies before their dependents
+func (e *Entry) ComponentNames() []string {
+	var names []string
+	for name := range e.Components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var ordered []string
+	added := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		if added[name] {
+			return
+		}
+		added[name] = true
+		for _, dep := range e.Components[name].Deps {
+			if parts := strings.Split(dep, "."); len(parts) >= 2 {
+				if _, ok := e.Components[parts[1]]; ok {
+					visit(parts[1])
+				}
+			}
+		}
+		ordered = append(ordered, name)
+	}
+	for _, name := range names {
+		visit(name)
+	}
+	return ordered
+}
+
+// List returns the entries of the catalog by name. Entries synced from the
+// mirror replace built-in entries of the same name.
+func List() ([]*Entry, error) {
+	entries := make(map[string]*Entry)
+
+	builtin, err := definitionsFS.ReadDir("definitions")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read built-in catalog: %w", err)
+	}
+	for _, file := range builtin {
+		data, err := definitionsFS.ReadFile(path.Join("definitions", file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read catalog entry %s: %w", file.Name(), err)
+		}
+		entry, err := parse(data, file.Name())
+		if err != nil {
+			return nil, err
+		}
+		entry.Source = "builtin"
+		entries[entry.Name] = entry
+	}
+
+	mirrored, err := project.Glob(filepath.Join(mirror.CacheDir, mirror.KindCatalog, "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mirrored catalog: %w", err)
+	}
+	for _, file := range mirrored {
+		data, err := project.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read catalog entry %s: %w", file, err)
+		}
+		entry, err := parse(data, filepath.Base(file))
+		if err != nil {
+			return nil, err
+		}
+		entry.Source = "mirror"
+		entries[entry.Name] = entry
+	}
+
+	var list []*Entry
+	for _, entry := range entries {
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Get returns the catalog entry with the given name
+func Get(name string) (*Entry, error) {
+	entries, err := List()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Name == name {
+			return entry, nil
+		}
+	}
+	return nil, fmt.Errorf("catalog entry %s not found, run 'tgs catalog list' to see the available entries", name)
+}
+
+// parse reads a catalog entry, naming it after its file when it has no name
+func parse(data []byte, file string) (*Entry, error) {
+	var entry Entry
+	if err := yaml.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse catalog entry %s: %w", file, err)
+	}
+	if entry.Name == "" {
+		entry.Name = strings.TrimSuffix(file, filepath.Ext(file))
+	}
+	if len(entry.Components) == 0 {
+		return nil, fmt.Errorf("catalog entry %s defines no components", entry.Name)
+	}
+	for _, app := range entry.Apps {
+		if _, ok := entry.Components[app]; !ok {
+			return nil, fmt.Errorf("catalog entry %s: apps references unknown component %s", entry.Name, app)
+		}
+	}
+	return &entry, nil
+}
@@ -0,0 +1,44 @@
+package catalog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuiltinEntries(t *testing.T) {
+	entries, err := List()
+	if err != nil {
+		t.Fatalf("List() unexpected error: %v", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+		if entry.Source != "builtin" {
+			t.Errorf("entry %s source = %s, want builtin", entry.Name, entry.Source)
+		}
+		for name, comp := range entry.Components {
+			if comp.Source == "" || comp.Provider == "" || comp.Version == "" || comp.Description == "" {
+				t.Errorf("entry %s component %s is incomplete: %+v", entry.Name, name, comp)
+			}
+		}
+	}
+	want := []string{"aks", "apim", "appservice-linux", "frontdoor", "keyvault", "serviceplan", "storage", "trafficmanager"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("List() names = %v, want %v", names, want)
+	}
+}
+
+func TestComponentNames(t *testing.T) {
+	entry, err := Get("appservice-linux")
+	if err != nil {
+		t.Fatalf("Get() unexpected error: %v", err)
+	}
+	if got, want := entry.ComponentNames(), []string{"serviceplan", "appservice"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ComponentNames() = %v, want %v", got, want)
+	}
+
+	if _, err := Get("missing"); err == nil {
+		t.Error("Get() of a missing entry should fail")
+	}
+}
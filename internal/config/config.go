@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
 	"gopkg.in/yaml.v3"
 )
 
@@ -13,6 +16,227 @@ type TGSConfig struct {
 	Name          string                  `yaml:"name"`
 	Subscriptions map[string]Subscription `yaml:"subscriptions"`
 	Naming        NamingConfig            `yaml:"naming"`
+	Prefixes      PrefixConfig            `yaml:"prefixes,omitempty"`
+	// Regions optionally restricts the regions stacks may deploy to
+	Regions []string `yaml:"regions,omitempty"`
+	// Tags are set on every resource, overridden by the tags of
+	// subscriptions and environments
+	Tags map[string]string `yaml:"tags,omitempty"`
+	// RequiredTags must be set on every environment by the tags of the
+	// project, its subscription or the environment
+	RequiredTags []string      `yaml:"required_tags,omitempty"`
+	Mirror       MirrorConfig  `yaml:"mirror,omitempty"`
+	Tooling      ToolingConfig `yaml:"tooling,omitempty"`
+	// Layout selects how environments are generated: folders (a folder per
+	// component, default) or stacks (a terragrunt.stack.hcl of units)
+	Layout string `yaml:"layout,omitempty"`
+	// SharedModules generates the identical modules of components once under
+	// _components/_shared/<hash>, their component.hcl sourcing it
+	SharedModules bool `yaml:"shared_modules,omitempty"`
+	// GenerationMode selects how the optional attributes of the resource
+	// schemas are generated: compact (commented out, default) or full
+	GenerationMode string `yaml:"generation_mode,omitempty"`
+	// OutputDir is the directory the infrastructure is generated into,
+	// relative to the project (default .infrastructure)
+	OutputDir string `yaml:"output_dir,omitempty"`
+	// Root sets Terragrunt options rendered in the generated root.hcl
+	Root RootConfig `yaml:"root,omitempty"`
+	// Hooks are shell commands run around tgs generate
+	Hooks HooksConfig `yaml:"hooks,omitempty"`
+	// Security enables policy-as-code scans of the component modules
+	Security SecurityConfig `yaml:"security,omitempty"`
+	// Diagrams configures the rendering of tgs diagram
+	Diagrams DiagramConfig `yaml:"diagrams,omitempty"`
+	// Owners maps generated folders to the teams owning them in the
+	// CODEOWNERS written by tgs scaffold repo
+	Owners OwnersConfig `yaml:"owners,omitempty"`
+	// Include lists files, relative to .tgs and optionally glob patterns,
+	// merged into this configuration
+	Include []string `yaml:"include,omitempty"`
+	// IncludedFiles lists the files read for Include, in merge order
+	IncludedFiles []string `yaml:"-"`
+	// Unresolved lists the ${env:VAR} placeholders left unexpanded on read
+	Unresolved []string `yaml:"-"`
+}
+
+// OwnersConfig lists the owners, GitHub users or teams (@org/team) or
+// emails, of the generated folders. Later entries win: environments override
+// stacks, which override the default.
+type OwnersConfig struct {
+	// Default owns every file of the repository
+	Default []string `yaml:"default,omitempty"`
+	// Stacks own the component modules and environments of a stack
+	Stacks map[string][]string `yaml:"stacks,omitempty"`
+	// Environments own the folders of an environment in every stack
+	Environments map[string][]string `yaml:"environments,omitempty"`
+}
+
+// Layouts of the generated architecture folders
+const (
+	LayoutFolders = "folders"
+	LayoutStacks  = "stacks"
+)
+
+// Generation modes of the component modules: compact comments optional
+// attributes out, full assigns them from variables defaulting to null
+const (
+	GenerationModeCompact = "compact"
+	GenerationModeFull    = "full"
+)
+
+// GenerationModeOf returns the generation mode of a component, its own or
+// the one of the project
+func (c *TGSConfig) GenerationModeOf(comp Component) string {
+	if comp.GenerationMode != "" {
+		return comp.GenerationMode
+	}
+	return c.GenerationMode
+}
+
+// Default tool versions used when tgs.yaml doesn't pin them
+const (
+	DefaultTerraformVersion  = "1.11.2"
+	DefaultTerragruntVersion = "0.69.10"
+)
+
+// Version file formats written by generate
+const (
+	VersionFilesTfenv = "tfenv"
+	VersionFilesAsdf  = "asdf"
+	VersionFilesNone  = "none"
+)
+
+// ToolingConfig pins the Terraform and Terragrunt versions used by the
+// generated pipelines and version files
+type ToolingConfig struct {
+	Terraform  string `yaml:"terraform,omitempty"`
+	Terragrunt string `yaml:"terragrunt,omitempty"`
+	// VersionFiles selects the version files written by generate: tfenv
+	// (.terraform-version and .terragrunt-version, default), asdf
+	// (.tool-versions, also read by mise) or none
+	VersionFiles string `yaml:"version_files,omitempty"`
+	// Infracost pins the infracost version of the cost estimate step of the
+	// generated pipelines, which is only added when it's set
+	Infracost string `yaml:"infracost,omitempty"`
+}
+
+// TerragruntTag returns the Terragrunt release tag, e.g. v0.69.10
+func (t ToolingConfig) TerragruntTag() string {
+	return "v" + t.Terragrunt
+}
+
+// RootConfig represents Terragrunt options rendered in root.hcl and inherited
+// by every component
+type RootConfig struct {
+	TerraformVersionConstraint  string `yaml:"terraform_version_constraint,omitempty"`
+	TerragruntVersionConstraint string `yaml:"terragrunt_version_constraint,omitempty"`
+	// RetryableErrors are regular expressions of errors Terragrunt retries
+	RetryableErrors       []string `yaml:"retryable_errors,omitempty"`
+	RetryMaxAttempts      int      `yaml:"retry_max_attempts,omitempty"`
+	RetrySleepIntervalSec int      `yaml:"retry_sleep_interval_sec,omitempty"`
+	// ExtraArguments are passed to Terraform for the listed commands
+	ExtraArguments []ExtraArguments `yaml:"extra_arguments,omitempty"`
+	// Generate lists files, e.g. provider blocks, generated into every
+	// component
+	Generate []GenerateBlock `yaml:"generate,omitempty"`
+}
+
+// ExtraArguments represents an extra_arguments block of root.hcl
+type ExtraArguments struct {
+	Name      string            `yaml:"name"`
+	Commands  []string          `yaml:"commands"`
+	Arguments []string          `yaml:"arguments,omitempty"`
+	EnvVars   map[string]string `yaml:"env_vars,omitempty"`
+}
+
+// GenerateBlock represents a generate block of root.hcl
+type GenerateBlock struct {
+	Name string `yaml:"name"`
+	Path string `yaml:"path"`
+	// IfExists defaults to overwrite_terragrunt
+	IfExists string `yaml:"if_exists,omitempty"`
+	Contents string `yaml:"contents"`
+}
+
+// HooksConfig lists shell commands run from the project directory before and
+// after tgs generate
+type HooksConfig struct {
+	PreGenerate  []string `yaml:"pre_generate,omitempty"`
+	PostGenerate []string `yaml:"post_generate,omitempty"`
+}
+
+// SecurityConfig selects the scanners run over the component modules by tgs
+// scan and the generated pipelines. Scans are off without tools.
+type SecurityConfig struct {
+	// Tools are tfsec, checkov or conftest
+	Tools []string `yaml:"tools,omitempty"`
+	// Severity is the lowest severity failing a scan: low, medium, high
+	// (default) or critical
+	Severity string `yaml:"severity,omitempty"`
+	// Policies is the folder of the conftest Rego policies, relative to the
+	// project (default .tgs/policies)
+	Policies string `yaml:"policies,omitempty"`
+}
+
+// Security scanners
+const (
+	SecurityToolTfsec    = "tfsec"
+	SecurityToolCheckov  = "checkov"
+	SecurityToolConftest = "conftest"
+)
+
+// SecurityTools lists the supported scanners
+var SecurityTools = []string{SecurityToolTfsec, SecurityToolCheckov, SecurityToolConftest}
+
+// SecuritySeverities are the scan severities, from lowest to highest
+var SecuritySeverities = []string{"low", "medium", "high", "critical"}
+
+// SeverityThreshold returns the lowest severity failing a scan
+func (s SecurityConfig) SeverityThreshold() string {
+	if s.Severity == "" {
+		return "high"
+	}
+	return s.Severity
+}
+
+// PolicyDir returns the folder of the conftest policies
+func (s SecurityConfig) PolicyDir() string {
+	if s.Policies == "" {
+		return ".tgs/policies"
+	}
+	return s.Policies
+}
+
+// DefaultPlantUMLServer is the public PlantUML server rendering diagrams
+const DefaultPlantUMLServer = "https://www.plantuml.com/plantuml"
+
+// DiagramConfig configures the rendering of diagrams
+type DiagramConfig struct {
+	// PlantUMLServer is the base URL of the PlantUML server rendering the
+	// PlantUML diagrams (default the public server)
+	PlantUMLServer string `yaml:"plantuml_server,omitempty"`
+}
+
+// Server returns the base URL of the PlantUML server
+func (d DiagramConfig) Server() string {
+	if d.PlantUMLServer == "" {
+		return DefaultPlantUMLServer
+	}
+	return strings.TrimSuffix(d.PlantUMLServer, "/")
+}
+
+// MirrorConfig represents an internal HTTPS mirror distributing template,
+// catalog and provider schema updates
+type MirrorConfig struct {
+	URL       string `yaml:"url"`
+	PublicKey string `yaml:"public_key"`
+}
+
+// PrefixConfig overrides the region and environment prefixes used in
+// resource names, keyed by region and environment name
+type PrefixConfig struct {
+	Regions      map[string]string `yaml:"regions,omitempty"`
+	Environments map[string]string `yaml:"environments,omitempty"`
 }
 
 // NamingConfig represents the resource naming configuration
@@ -23,10 +247,11 @@ type NamingConfig struct {
 	ComponentFormats map[string]ComponentFormat `yaml:"component_formats,omitempty"`
 }
 
-// ComponentFormat represents a custom format for a specific component
+// ComponentFormat represents a custom format for a specific component. A nil
+// Separator inherits the default, while "" joins name parts without one.
 type ComponentFormat struct {
-	Format    string `yaml:"format"`
-	Separator string `yaml:"separator,omitempty"`
+	Format    string  `yaml:"format"`
+	Separator *string `yaml:"separator,omitempty"`
 }
 
 // Subscription represents an Azure subscription configuration
@@ -35,12 +260,73 @@ type Subscription struct {
 	RemoteState     RemoteState   `yaml:"remotestate"`
 	Environments    []Environment `yaml:"environments"`
 	CIVariableGroup string        `yaml:"ci_variable_group"`
+	// ServiceConnection is the Azure DevOps service connection using workload
+	// identity federation; when empty pipelines authenticate with the
+	// ARM_CLIENT_SECRET of the variable group
+	ServiceConnection string `yaml:"service_connection,omitempty"`
+	// Cloud is the Azure cloud of the subscription: public (default), usgov or china
+	Cloud string `yaml:"cloud,omitempty"`
+	// SubscriptionID and TenantID pin the provider to a subscription and tenant
+	// instead of relying on ARM_SUBSCRIPTION_ID and ARM_TENANT_ID
+	SubscriptionID string `yaml:"subscription_id,omitempty"`
+	TenantID       string `yaml:"tenant_id,omitempty"`
+	// Tags are set on the resources of the subscription's environments
+	Tags map[string]string `yaml:"tags,omitempty"`
 }
 
 // RemoteState represents the remote state configuration
 type RemoteState struct {
 	Name          string `yaml:"name"`
 	ResourceGroup string `yaml:"resource_group"`
+	// UseAzureADAuth authenticates to the storage account with Entra ID
+	// instead of access keys
+	UseAzureADAuth bool `yaml:"use_azuread_auth,omitempty"`
+	// UseOIDC authenticates the backend with the workload identity of the
+	// pipeline service connection
+	UseOIDC bool `yaml:"use_oidc,omitempty"`
+	// Snapshot takes a blob snapshot of the state before each write
+	Snapshot bool `yaml:"snapshot,omitempty"`
+	// Versioning declares that the storage account has blob versioning
+	// enabled
+	Versioning bool `yaml:"versioning,omitempty"`
+	// KeyPrefix is prepended to the state keys of the subscription
+	KeyPrefix string `yaml:"key_prefix,omitempty"`
+	// Backup is where tgs state backup and the apply pipelines copy the
+	// state blobs to
+	Backup *StateBackup `yaml:"backup,omitempty"`
+}
+
+// StateBackup represents the container remote state is backed up to
+type StateBackup struct {
+	// StorageAccount defaults to the remote state storage account
+	StorageAccount string `yaml:"storage_account,omitempty"`
+	Container      string `yaml:"container"`
+}
+
+// BackupAccount returns the storage account state is backed up to, or ""
+// without a backup
+func (r RemoteState) BackupAccount() string {
+	if r.Backup == nil {
+		return ""
+	}
+	if r.Backup.StorageAccount != "" {
+		return r.Backup.StorageAccount
+	}
+	return r.Name
+}
+
+// StateKey returns the blob key of the state of the terragrunt folder at
+// path, relative to root.hcl, prefixed with componentPrefix or KeyPrefix
+func (r RemoteState) StateKey(componentPrefix, path string) string {
+	prefix := r.KeyPrefix
+	if componentPrefix != "" {
+		prefix = componentPrefix
+	}
+	key := path + "/terraform.tfstate"
+	if prefix != "" {
+		key = prefix + "/" + key
+	}
+	return key
 }
 
 // Environment represents an environment configuration
@@ -48,11 +334,73 @@ type Environment struct {
 	Name   string `yaml:"name"`
 	Prefix string `yaml:"prefix"`
 	Stack  string `yaml:"stack,omitempty"`
+	// PipelineEnvironment is the Azure DevOps environment gating applies,
+	// defaulting to the environment name
+	PipelineEnvironment string    `yaml:"pipeline_environment,omitempty"`
+	Approval            *Approval `yaml:"approval,omitempty"`
+	// Protected environments get no destroy pipeline
+	Protected bool `yaml:"protected,omitempty"`
+	// Secrets set sensitive component attributes of the environment config
+	// from references, keyed by <component>.<attribute>
+	Secrets map[string]string `yaml:"secrets,omitempty"`
+	// Tags are set on the resources of the environment
+	Tags map[string]string `yaml:"tags,omitempty"`
+}
+
+// Approval configures the approval check of an Azure DevOps environment
+type Approval struct {
+	Approvers      []string `yaml:"approvers,omitempty"`
+	MinApprovers   int      `yaml:"min_approvers,omitempty"`
+	TimeoutMinutes int      `yaml:"timeout_minutes,omitempty"`
+	Instructions   string   `yaml:"instructions,omitempty"`
+}
+
+// EnvironmentTags returns the tags of an environment of a subscription: the
+// project tags, overridden by the subscription's, overridden by the
+// environment's
+func (c *TGSConfig) EnvironmentTags(subName string, env Environment) map[string]string {
+	tags := make(map[string]string)
+	for _, layer := range []map[string]string{c.Tags, c.Subscriptions[subName].Tags, env.Tags} {
+		for key, value := range layer {
+			tags[key] = value
+		}
+	}
+	return tags
+}
+
+// UsedStacks returns the stacks deployed by the environments in order
+func (c *TGSConfig) UsedStacks() []string {
+	seen := make(map[string]bool)
+	var stacks []string
+	for _, sub := range c.Subscriptions {
+		for _, env := range sub.Environments {
+			name := env.Stack
+			if name == "" {
+				name = "main"
+			}
+			if !seen[name] {
+				seen[name] = true
+				stacks = append(stacks, name)
+			}
+		}
+	}
+	sort.Strings(stacks)
+	return stacks
+}
+
+// PipelineEnvironmentName returns the Azure DevOps environment of the environment
+func (e Environment) PipelineEnvironmentName() string {
+	if e.PipelineEnvironment != "" {
+		return e.PipelineEnvironment
+	}
+	return e.Name
 }
 
 // MainConfig represents the main stack configuration
 type MainConfig struct {
 	Stack StackConfig `yaml:"stack"`
+	// Unresolved lists the ${env:VAR} placeholders left unexpanded on read
+	Unresolved []string `yaml:"-"`
 }
 
 // StackConfig represents the stack configuration
@@ -62,46 +410,391 @@ type StackConfig struct {
 	Description  string               `yaml:"description"`
 	Architecture ArchitectureConfig   `yaml:"architecture"`
 	Components   map[string]Component `yaml:"components"`
+	// ExternalDependencies declares infrastructure not managed by this repo
+	ExternalDependencies map[string]ExternalDependency `yaml:"external_dependencies,omitempty"`
+	// Migrations run by generate when the stack version is bumped past theirs
+	Migrations []Migration `yaml:"migrations,omitempty"`
+	// Observability adds diagnostic settings to the components
+	Observability *ObservabilityConfig `yaml:"observability,omitempty"`
+}
+
+// Migration moves generated folders and Terraform state when upgrading a
+// stack to Version
+type Migration struct {
+	Version string `yaml:"version"`
+	// Renames maps old component names to new ones
+	Renames map[string]string `yaml:"renames,omitempty"`
+	// Moves relocates components or apps, in dependency notation
+	Moves []Move `yaml:"moves,omitempty"`
+	// StateMoves renames resource addresses in the state of a component
+	StateMoves []StateMove `yaml:"state_moves,omitempty"`
+}
+
+// Move relocates a component or app, e.g. from eastus2.redis to westus2.redis
+type Move struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// StateMove renames a resource address in the state of every instance of a
+// component
+type StateMove struct {
+	Component string `yaml:"component"`
+	From      string `yaml:"from"`
+	To        string `yaml:"to"`
+}
+
+// ExternalDependency represents state of infrastructure managed outside this
+// repo, referenced either through a terragrunt config path or a remote state
+type ExternalDependency struct {
+	ConfigPath  string               `yaml:"config_path,omitempty"`
+	RemoteState *ExternalRemoteState `yaml:"remote_state,omitempty"`
+	SkipOutputs bool                 `yaml:"skip_outputs,omitempty"`
+	MockOutputs map[string]string    `yaml:"mock_outputs,omitempty"`
+}
+
+// ExternalRemoteState represents an azurerm backend holding external state
+type ExternalRemoteState struct {
+	ResourceGroup  string `yaml:"resource_group"`
+	StorageAccount string `yaml:"storage_account"`
+	Container      string `yaml:"container"`
+	Key            string `yaml:"key"`
 }
 
 // ArchitectureConfig represents the architecture configuration
 type ArchitectureConfig struct {
 	Regions map[string][]RegionComponent `yaml:"regions"`
+	// PairedRegions maps regions to the region they fail over to, which
+	// {paired_region} dependencies of their components refer to
+	PairedRegions map[string]string `yaml:"paired_regions,omitempty"`
+}
+
+// DependencyRegion returns the region of a dependency in dependency notation
+// of a component deployed to region: {region} is region and {paired_region}
+// pairedRegion, "" when the region has no pair
+func DependencyRegion(depRegion, region, pairedRegion string) string {
+	switch depRegion {
+	case "{region}":
+		return region
+	case "{paired_region}":
+		return pairedRegion
+	}
+	return depRegion
 }
 
 // RegionComponent represents a component in a region
 type RegionComponent struct {
 	Component string   `yaml:"component"`
 	Apps      []string `yaml:"apps,omitempty"`
+	// AppMetadata holds the apps written as objects, keyed by name
+	AppMetadata map[string]App `yaml:"-"`
+}
+
+// App is an app instance of a component with its own settings and sizing. In
+// YAML an app is its name or an object with the name and metadata.
+type App struct {
+	Name string `yaml:"name"`
+	// Settings are app settings of the instance
+	Settings AppSettings `yaml:"settings,omitempty"`
+	// SKU is passed to the instance as its sku_name input
+	SKU   string   `yaml:"sku,omitempty"`
+	Slots []string `yaml:"slots,omitempty"`
+	// Operations are API Management operation policies of the instance keyed
+	// by <api>/<operation>, generated with an inheriting policy when empty
+	Operations map[string]string `yaml:"operations,omitempty"`
+}
+
+// App returns the metadata of an app of the component, only the name for
+// apps written as plain strings
+func (rc RegionComponent) App(name string) App {
+	if app, ok := rc.AppMetadata[name]; ok {
+		return app
+	}
+	return App{Name: name}
+}
+
+// Inputs returns the terragrunt inputs set by the metadata of the app.
+// Settings of components with app_settings seed the app's settings file
+// instead, so they merge with the global and environment settings, and
+// their secret settings name the Key Vault secrets the module references.
+func (a App) Inputs(comp Component) map[string]interface{} {
+	inputs := make(map[string]interface{})
+	if a.SKU != "" {
+		inputs["sku_name"] = a.SKU
+	}
+	if len(a.Slots) > 0 {
+		inputs["slots"] = a.Slots
+	}
+	if values := a.Settings.Values(); len(values) > 0 && !comp.AppSettings {
+		inputs["app_settings"] = values
+	}
+	if secrets := a.Settings.Secrets(); len(secrets) > 0 && comp.KeyVaultSecrets {
+		inputs[KeyVaultSecretsInput] = secrets
+	}
+	if len(inputs) == 0 {
+		return nil
+	}
+	return inputs
+}
+
+// UnmarshalYAML reads apps written as names or objects
+func (rc *RegionComponent) UnmarshalYAML(node *yaml.Node) error {
+	var raw struct {
+		Component string      `yaml:"component"`
+		Apps      []yaml.Node `yaml:"apps,omitempty"`
+	}
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+
+	rc.Component = raw.Component
+	rc.Apps = nil
+	rc.AppMetadata = nil
+	for _, appNode := range raw.Apps {
+		if appNode.Kind != yaml.MappingNode {
+			var name string
+			if err := appNode.Decode(&name); err != nil {
+				return err
+			}
+			rc.Apps = append(rc.Apps, name)
+			continue
+		}
+
+		var app App
+		if err := appNode.Decode(&app); err != nil {
+			return err
+		}
+		if app.Name == "" {
+			return fmt.Errorf("line %d: app of component %s has no name", appNode.Line, raw.Component)
+		}
+		if rc.AppMetadata == nil {
+			rc.AppMetadata = make(map[string]App)
+		}
+		rc.Apps = append(rc.Apps, app.Name)
+		rc.AppMetadata[app.Name] = app
+	}
+	return nil
+}
+
+// MarshalYAML writes apps with metadata as objects and the others as names
+func (rc RegionComponent) MarshalYAML() (interface{}, error) {
+	var apps []interface{}
+	for _, name := range rc.Apps {
+		if app, ok := rc.AppMetadata[name]; ok {
+			apps = append(apps, app)
+		} else {
+			apps = append(apps, name)
+		}
+	}
+	return struct {
+		Component string        `yaml:"component"`
+		Apps      []interface{} `yaml:"apps,omitempty"`
+	}{rc.Component, apps}, nil
 }
 
 // Component represents a component configuration
 type Component struct {
-	Source              string   `yaml:"source"`
-	Provider            string   `yaml:"provider"`
-	Version             string   `yaml:"version"`
-	Description         string   `yaml:"description"`
-	Deps                []string `yaml:"deps,omitempty"`
-	AppSettings         bool     `yaml:"app_settings,omitempty"`
-	PolicyFiles         bool     `yaml:"policy_files,omitempty"`
-	AdditionalResources []string `yaml:"additional_resources,omitempty"`
+	Source      string   `yaml:"source"`
+	Provider    string   `yaml:"provider"`
+	Version     string   `yaml:"version"`
+	Description string   `yaml:"description"`
+	Deps        []string `yaml:"deps,omitempty"`
+	AppSettings bool     `yaml:"app_settings,omitempty"`
+	PolicyFiles bool     `yaml:"policy_files,omitempty"`
+	// PolicyFragments are API Management policy fragments keyed by fragment
+	// id, generated empty when their XML is empty
+	PolicyFragments     map[string]string `yaml:"policy_fragments,omitempty"`
+	AdditionalResources []string          `yaml:"additional_resources,omitempty"`
+	// DependencyOptions holds per-dependency settings keyed by the entry in Deps
+	DependencyOptions map[string]DependencyOptions `yaml:"dependency_options,omitempty"`
+	// ExternalDeps references entries of the stack's external_dependencies
+	ExternalDeps []string `yaml:"external_deps,omitempty"`
+	// Providers lists providers the component requires besides azurerm
+	Providers []ProviderRequirement `yaml:"providers,omitempty"`
+	// Inputs sets module inputs in component.hcl, {dep:name.output}
+	// placeholders reference the outputs of a dependency
+	Inputs map[string]string `yaml:"inputs,omitempty"`
+	// DataSources are Terraform data sources written to data.tf of the
+	// module, keyed by name, {data:name.attribute} inputs read them
+	DataSources map[string]DataSource `yaml:"data_sources,omitempty"`
+	// Outputs lists resource attributes exported besides id and name
+	Outputs Outputs `yaml:"outputs,omitempty"`
+	// Instances deploy the primary resource once per entry with for_each,
+	// keyed by instance name, their inputs replacing those of the component
+	Instances map[string]map[string]string `yaml:"instances,omitempty"`
+	// Slots are deployment slots of web and function apps
+	Slots []string `yaml:"slots,omitempty"`
+	// SlotSwap is the slot the pipelines swap into production after apply
+	SlotSwap string `yaml:"slot_swap,omitempty"`
+	// StateKeyPrefix replaces the key_prefix of the remote state for the
+	// component
+	StateKeyPrefix string `yaml:"state_key_prefix,omitempty"`
+	// KeyVault is the Key Vault component holding the secret app settings,
+	// in dependency notation, e.g. {region}.keyvault
+	KeyVault string `yaml:"key_vault,omitempty"`
+	// EnvConfig adds keys to the environment config schema of the component
+	// or replaces those of its resource type, keyed by name
+	EnvConfig map[string]EnvConfigField `yaml:"env_config,omitempty"`
+	// GenerationMode replaces the generation mode of tgs.yaml for the
+	// component
+	GenerationMode string `yaml:"generation_mode,omitempty"`
+	// SchemaGeneration generates the module from the provider schema even
+	// when its resource type has a curated module
+	SchemaGeneration bool `yaml:"schema_generation,omitempty"`
+	// ExtraHCL is appended verbatim to the generated component.hcl
+	ExtraHCL string `yaml:"extra_hcl,omitempty"`
+	// Routing routes global traffic to the regional instances of another
+	// component, passed to the module as the origins and endpoints inputs
+	Routing *RoutingConfig `yaml:"routing,omitempty"`
+	// Diagnostics is set by ApplyObservability for components that get a
+	// diagnostic setting
+	Diagnostics bool `yaml:"-"`
+	// KeyVaultSecrets is set by ApplyKeyVault for components whose apps have
+	// secret settings
+	KeyVaultSecrets bool `yaml:"-"`
+	// Origins is set by ApplyRouting for components with routing
+	Origins []Origin `yaml:"-"`
+}
+
+// DataSource is a Terraform data source read by the module of a component
+type DataSource struct {
+	// Type is the data source type, e.g. azurerm_key_vault
+	Type string `yaml:"type"`
+	// Arguments are written as strings, except references to var., local.
+	// or data. and number and bool literals
+	Arguments map[string]string `yaml:"arguments,omitempty"`
+}
+
+// EnvConfigField is a key of the environment config of a component, passed
+// to its module as the input of the same name
+type EnvConfigField struct {
+	// Type is string, number, bool, list or map
+	Type        string `yaml:"type"`
+	Required    bool   `yaml:"required,omitempty"`
+	Description string `yaml:"description,omitempty"`
+	// Default is used when an environment doesn't set an optional key, as
+	// an HCL expression for types other than string
+	Default string `yaml:"default,omitempty"`
+}
+
+// slotResources maps app resource types to their deployment slot resource
+// and the attribute referencing the app
+var slotResources = map[string][2]string{
+	"azurerm_linux_web_app":        {"azurerm_linux_web_app_slot", "app_service_id"},
+	"azurerm_windows_web_app":      {"azurerm_windows_web_app_slot", "app_service_id"},
+	"azurerm_linux_function_app":   {"azurerm_linux_function_app_slot", "function_app_id"},
+	"azurerm_windows_function_app": {"azurerm_windows_function_app_slot", "function_app_id"},
+}
+
+// SlotResource returns the deployment slot resource type of the component's
+// source and its attribute referencing the app, ok is false when the source
+// has no slots
+func (c Component) SlotResource() (resourceType, appAttribute string, ok bool) {
+	slot, ok := slotResources[c.Source]
+	return slot[0], slot[1], ok
 }
 
-// ReadTGSConfig reads the TGS configuration file
+// Outputs selects the attributes a component exports in outputs.tf. In YAML
+// it's either a list of attribute names or a mapping with all and names.
+type Outputs struct {
+	// All exports every computed attribute of the primary resource
+	All bool `yaml:"all,omitempty"`
+	// Names are attributes of the primary resource, or resource_type.attribute
+	// for an additional resource
+	Names []string `yaml:"names,omitempty"`
+}
+
+// UnmarshalYAML accepts a list of names or the all/names mapping
+func (o *Outputs) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.SequenceNode {
+		o.All = false
+		return node.Decode(&o.Names)
+	}
+	type plain Outputs
+	return node.Decode((*plain)(o))
+}
+
+// MarshalYAML writes the short list form unless all is set
+func (o Outputs) MarshalYAML() (interface{}, error) {
+	if !o.All {
+		return o.Names, nil
+	}
+	type plain Outputs
+	return plain(o), nil
+}
+
+// ProviderRequirement is an additional provider required by a component
+type ProviderRequirement struct {
+	Name    string `yaml:"name"`
+	Source  string `yaml:"source,omitempty"`
+	Version string `yaml:"version"`
+}
+
+// SourceAddress returns the registry source of the provider, defaulting to
+// the hashicorp namespace (e.g. "random" is hashicorp/random)
+func (p ProviderRequirement) SourceAddress() string {
+	if p.Source != "" {
+		return p.Source
+	}
+	return "hashicorp/" + p.Name
+}
+
+// DependencyOptions represents settings for a generated dependency block
+type DependencyOptions struct {
+	SkipOutputs bool              `yaml:"skip_outputs,omitempty"`
+	MockOutputs map[string]string `yaml:"mock_outputs,omitempty"`
+}
+
+// source holds the configuration set with Use in place of the files of .tgs
+var source struct {
+	tgsConfig *TGSConfig
+	stacks    map[string]*MainConfig
+}
+
+// Use makes ReadTGSConfig and ReadMainConfig return copies of tgsConfig and
+// the stacks, keyed by name, instead of reading the files of .tgs. A nil
+// tgsConfig reads the files again.
+func Use(tgsConfig *TGSConfig, stacks map[string]*MainConfig) {
+	source.tgsConfig = tgsConfig
+	source.stacks = stacks
+}
+
+// ReadTGSConfig reads the TGS configuration file and the files it includes
 func ReadTGSConfig() (*TGSConfig, error) {
-	data, err := os.ReadFile(".tgs/tgs.yaml")
+	if source.tgsConfig != nil {
+		config := *source.tgsConfig
+		if err := applyTGSDefaults(&config); err != nil {
+			return nil, err
+		}
+		return &config, nil
+	}
+
+	doc, files, unresolved, err := readTGSDocument()
 	if err != nil {
 		return nil, fmt.Errorf("failed to read TGS config: %w", err)
 	}
 
 	var config TGSConfig
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	if err := doc.Decode(&config); err != nil {
 		return nil, fmt.Errorf("failed to parse TGS config: %w", err)
 	}
+	config.IncludedFiles = files
+	config.Unresolved = unresolved
+
+	if err := applyTGSDefaults(&config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
 
-	// Validate project name
-	if err := validateProjectName(config.Name); err != nil {
-		return nil, fmt.Errorf("invalid project name: %w", err)
+// applyTGSDefaults checks the project name and sets the defaults of unset
+// fields
+func applyTGSDefaults(config *TGSConfig) error {
+	// Validate project name, leaving unresolved placeholders to tgs validate-tgs
+	if !envPlaceholder.MatchString(config.Name) {
+		if err := validateProjectName(config.Name); err != nil {
+			return fmt.Errorf("invalid project name: %w", err)
+		}
 	}
 
 	// Set default naming configuration if not provided
@@ -112,7 +805,27 @@ func ReadTGSConfig() (*TGSConfig, error) {
 		config.Naming.DefaultSeparator = "-"
 	}
 
-	return &config, nil
+	// Set default tool versions if not pinned
+	if config.Tooling.Terraform == "" {
+		config.Tooling.Terraform = DefaultTerraformVersion
+	}
+	if config.Tooling.Terragrunt == "" {
+		config.Tooling.Terragrunt = DefaultTerragruntVersion
+	}
+	config.Tooling.Terraform = strings.TrimPrefix(config.Tooling.Terraform, "v")
+	config.Tooling.Terragrunt = strings.TrimPrefix(config.Tooling.Terragrunt, "v")
+	config.Tooling.Infracost = strings.TrimPrefix(config.Tooling.Infracost, "v")
+	if config.Tooling.VersionFiles == "" {
+		config.Tooling.VersionFiles = VersionFilesTfenv
+	}
+	if config.Layout == "" {
+		config.Layout = LayoutFolders
+	}
+	if config.GenerationMode == "" {
+		config.GenerationMode = GenerationModeCompact
+	}
+
+	return nil
 }
 
 // validateProjectName ensures the project name follows the required format:
@@ -155,19 +868,63 @@ func validateProjectName(name string) error {
 	return nil
 }
 
+// ValidateConfig represents the optional .tgs/validate.yaml rules file
+type ValidateConfig struct {
+	// Rules maps a rule ID to a severity (error, warning, info) or "off"
+	Rules map[string]string `yaml:"rules"`
+}
+
+// ReadValidateConfig reads .tgs/validate.yaml, returning an empty
+// configuration if the file doesn't exist
+func ReadValidateConfig() (*ValidateConfig, error) {
+	data, err := project.ReadFile(".tgs/validate.yaml")
+	if os.IsNotExist(err) {
+		return &ValidateConfig{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read validate config: %w", err)
+	}
+
+	var config ValidateConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse validate config: %w", err)
+	}
+
+	return &config, nil
+}
+
 // ReadMainConfig reads the main stack configuration file
 func ReadMainConfig(stackName string) (*MainConfig, error) {
-	data, err := os.ReadFile(filepath.Join(".tgs/stacks", stackName+".yaml"))
+	if source.tgsConfig != nil {
+		stack, ok := source.stacks[stackName]
+		if !ok || stack == nil {
+			return nil, fmt.Errorf("failed to read stack config: stack %s is not defined", stackName)
+		}
+		config := *stack
+		config.Stack.Components = make(map[string]Component, len(stack.Stack.Components))
+		for name, comp := range stack.Stack.Components {
+			config.Stack.Components[name] = comp
+		}
+		config.ApplyObservability()
+		config.ApplyKeyVault()
+		config.ApplyRouting()
+		return &config, nil
+	}
+
+	data, err := project.ReadFile(filepath.Join(".tgs/stacks", stackName+".yaml"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to read stack config: %w", err)
 	}
 
 	var config MainConfig
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	unresolved, err := Unmarshal(data, &config)
+	if err != nil {
 		return nil, fmt.Errorf("failed to parse stack config: %w", err)
 	}
-
-	// Log the architecture configuratio
+	config.Unresolved = unresolved
+	config.ApplyObservability()
+	config.ApplyKeyVault()
+	config.ApplyRouting()
 
 	return &config, nil
 }
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestRegionComponentApps(t *testing.T) {
+	data := `component: appservice
+apps:
+  - name: api
+    sku: P1v3
+    slots: [staging]
+    settings:
+      FEATURE: "on"
+  - web
+`
+	var rc RegionComponent
+	if err := yaml.Unmarshal([]byte(data), &rc); err != nil {
+		t.Fatalf("Unmarshal() unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(rc.Apps, []string{"api", "web"}) {
+		t.Errorf("Apps = %v, want [api web]", rc.Apps)
+	}
+	want := App{Name: "api", SKU: "P1v3", Slots: []string{"staging"}, Settings: AppSettings{"FEATURE": {Value: "on"}}}
+	if got := rc.App("api"); !reflect.DeepEqual(got, want) {
+		t.Errorf("App(api) = %+v, want %+v", got, want)
+	}
+	if got := rc.App("web"); !reflect.DeepEqual(got, App{Name: "web"}) {
+		t.Errorf("App(web) = %+v, want only the name", got)
+	}
+
+	out, err := yaml.Marshal(rc)
+	if err != nil {
+		t.Fatalf("Marshal() unexpected error: %v", err)
+	}
+	if !strings.Contains(string(out), "- name: api") || !strings.Contains(string(out), "- web") {
+		t.Errorf("Marshal() = %s, want api as an object and web as a name", out)
+	}
+
+	if err := yaml.Unmarshal([]byte("component: appservice\napps:\n  - sku: P1v3\n"), &rc); err == nil {
+		t.Error("Unmarshal() of an app without a name should fail")
+	}
+}
+
+func TestAppInputs(t *testing.T) {
+	app := App{Name: "api", SKU: "P1v3", Settings: AppSettings{"FEATURE": {Value: "on"}, "DB_PASSWORD": {Secret: true}}}
+
+	want := map[string]interface{}{"sku_name": "P1v3", "app_settings": map[string]string{"FEATURE": "on"}}
+	if got := app.Inputs(Component{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Inputs() = %v, want %v", got, want)
+	}
+
+	// Settings files hold the values, the module reads the secrets
+	want = map[string]interface{}{"sku_name": "P1v3", KeyVaultSecretsInput: map[string]string{"DB_PASSWORD": "db-password"}}
+	if got := app.Inputs(Component{AppSettings: true, KeyVaultSecrets: true}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Inputs() = %v, want %v", got, want)
+	}
+
+	if got := (App{Name: "web"}).Inputs(Component{}); got != nil {
+		t.Errorf("Inputs() = %v, want nil", got)
+	}
+}
+
+func TestEnvironmentTags(t *testing.T) {
+	env := Environment{Name: "dev", Tags: map[string]string{"DataClass": "internal"}}
+	cfg := &TGSConfig{
+		Tags: map[string]string{"Owner": "platform", "CostCenter": "1234"},
+		Subscriptions: map[string]Subscription{
+			"nonprod": {Tags: map[string]string{"CostCenter": "5678", "DataClass": "public"}, Environments: []Environment{env}},
+		},
+	}
+
+	want := map[string]string{"Owner": "platform", "CostCenter": "5678", "DataClass": "internal"}
+	if got := cfg.EnvironmentTags("nonprod", env); !reflect.DeepEqual(got, want) {
+		t.Errorf("EnvironmentTags() = %v, want %v", got, want)
+	}
+}
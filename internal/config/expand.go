@@ -0,0 +1,69 @@
+package config
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPlaceholder matches ${env:VAR} and ${env:VAR:-default}
+var envPlaceholder = regexp.MustCompile(`\$\{env:([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// Unmarshal parses a config file like yaml.Unmarshal, first expanding
+// ${env:VAR} placeholders in its keys and values. A placeholder of an unset
+// variable falls back to its default, ${env:VAR:-default}, or is left as it
+// is and returned as unresolved.
+func Unmarshal(data []byte, out interface{}) ([]string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+
+	unresolved := ExpandNode(&doc)
+	if err := doc.Decode(out); err != nil {
+		return nil, err
+	}
+	return unresolved, nil
+}
+
+// ExpandEnv expands the ${env:VAR} placeholders of a string, returning the
+// placeholders that couldn't be resolved
+func ExpandEnv(value string) (string, []string) {
+	var unresolved []string
+	expanded := envPlaceholder.ReplaceAllStringFunc(value, func(placeholder string) string {
+		match := envPlaceholder.FindStringSubmatch(placeholder)
+		if v, ok := os.LookupEnv(match[1]); ok {
+			return v
+		}
+		if strings.Contains(placeholder, ":-") {
+			return match[2]
+		}
+		unresolved = append(unresolved, placeholder)
+		return placeholder
+	})
+	return expanded, unresolved
+}
+
+// ExpandNode expands the placeholders of every scalar below a parsed YAML
+// node, returning the unresolved ones. Plain scalars are retyped after
+// expansion, so ${env:COUNT} can fill an integer.
+func ExpandNode(node *yaml.Node) []string {
+	var unresolved []string
+	if node.Kind == yaml.ScalarNode && envPlaceholder.MatchString(node.Value) {
+		expanded, missing := ExpandEnv(node.Value)
+		unresolved = append(unresolved, missing...)
+		node.Value = expanded
+		if node.Style == 0 {
+			node.Tag = ""
+		}
+	}
+	for _, child := range node.Content {
+		unresolved = append(unresolved, ExpandNode(child)...)
+	}
+	return unresolved
+}
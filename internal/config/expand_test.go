@@ -0,0 +1,53 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnmarshalExpandsEnvPlaceholders(t *testing.T) {
+	t.Setenv("TGS_TEST_ACCOUNT", "stshared")
+	t.Setenv("TGS_TEST_APPROVERS", "2")
+
+	data := []byte(`name: proj
+naming:
+  format: "${project}-${region}${env}-${type}"
+subscriptions:
+  prod:
+    subscription_id: ${env:TGS_TEST_SUBSCRIPTION}
+    tenant_id: ${env:TGS_TEST_TENANT:-00000000-0000-0000-0000-000000000000}
+    remotestate:
+      name: ${env:TGS_TEST_ACCOUNT}tf
+      resource_group: rg-${env:TGS_TEST_ACCOUNT}
+    environments:
+      - name: prod
+        approval:
+          min_approvers: ${env:TGS_TEST_APPROVERS}
+`)
+
+	var cfg TGSConfig
+	unresolved, err := Unmarshal(data, &cfg)
+	if err != nil {
+		t.Fatalf("Unmarshal() unexpected error: %v", err)
+	}
+
+	if want := []string{"${env:TGS_TEST_SUBSCRIPTION}"}; !reflect.DeepEqual(unresolved, want) {
+		t.Errorf("unresolved = %v, want %v", unresolved, want)
+	}
+	sub := cfg.Subscriptions["prod"]
+	if sub.RemoteState.Name != "stsharedtf" || sub.RemoteState.ResourceGroup != "rg-stshared" {
+		t.Errorf("remote state = %+v", sub.RemoteState)
+	}
+	if sub.TenantID != "00000000-0000-0000-0000-000000000000" {
+		t.Errorf("tenant_id = %q, want the default", sub.TenantID)
+	}
+	if sub.SubscriptionID != "${env:TGS_TEST_SUBSCRIPTION}" {
+		t.Errorf("subscription_id = %q, want the unresolved placeholder", sub.SubscriptionID)
+	}
+	if got := sub.Environments[0].Approval.MinApprovers; got != 2 {
+		t.Errorf("min_approvers = %d, want 2", got)
+	}
+	if cfg.Naming.Format != "${project}-${region}${env}-${type}" {
+		t.Errorf("naming format = %q, naming placeholders must be kept", cfg.Naming.Format)
+	}
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"gopkg.in/yaml.v3"
+)
+
+// tgsPath is the project configuration file; include paths are relative to
+// its directory
+const tgsPath = ".tgs/tgs.yaml"
+
+// readTGSDocument reads tgs.yaml merged with the files of its include list.
+// Included files are merged in order, each overriding the ones before it,
+// and tgs.yaml overrides them all: mappings are merged key by key while
+// lists and values are replaced. It returns the merged document, the
+// included files, and the placeholders left unresolved.
+func readTGSDocument() (*yaml.Node, []string, []string, error) {
+	root, unresolved, err := readConfigFile(tgsPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var patterns []string
+	if include := mapValue(root, "include"); include != nil {
+		if err := include.Decode(&patterns); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to parse include of %s: %w", tgsPath, err)
+		}
+	}
+
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := project.Glob(filepath.Join(filepath.Dir(tgsPath), pattern))
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return nil, nil, nil, fmt.Errorf("included file %s not found", pattern)
+		}
+		sort.Strings(matches)
+
+		for _, file := range matches {
+			included, missing, err := readConfigFile(file)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			if mapValue(included, "include") != nil {
+				return nil, nil, nil, fmt.Errorf("included file %s can't include other files", file)
+			}
+			unresolved = append(unresolved, missing...)
+			mergeMapping(merged, included)
+			files = append(files, filepath.ToSlash(file))
+		}
+	}
+	mergeMapping(merged, root)
+
+	return merged, files, unresolved, nil
+}
+
+// readConfigFile parses a YAML config file into its root mapping, expanding
+// its ${env:VAR} placeholders
+func readConfigFile(path string) (*yaml.Node, []string, error) {
+	data, err := project.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil, nil
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("failed to parse %s: expected a mapping", path)
+	}
+	return doc.Content[0], ExpandNode(&doc), nil
+}
+
+// mergeMapping merges the keys of src into dst, recursing into mappings both
+// define and replacing everything else
+func mergeMapping(dst, src *yaml.Node) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		existing := mapValue(dst, key.Value)
+		switch {
+		case existing == nil:
+			dst.Content = append(dst.Content, key, value)
+		case existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			mergeMapping(existing, value)
+		default:
+			*existing = *value
+		}
+	}
+}
+
+// mapValue returns the value of key in a YAML mapping node, or nil
+func mapValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
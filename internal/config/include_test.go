@@ -0,0 +1,88 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadTGSConfigMergesIncludes(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	files := map[string]string{
+		".tgs/tgs.yaml": `name: proj
+include:
+  - naming.yaml
+  - subscriptions/*.yaml
+naming:
+  separator: "_"
+subscriptions:
+  prod:
+    remotestate:
+      resource_group: rg-override
+`,
+		".tgs/naming.yaml": `naming:
+  format: "${project}-${type}"
+  separator: "-"
+`,
+		".tgs/subscriptions/nonprod.yaml": `subscriptions:
+  nonprod:
+    remotestate:
+      name: stnonprod
+      resource_group: rg-nonprod
+    environments:
+      - name: dev
+`,
+		".tgs/subscriptions/prod.yaml": `subscriptions:
+  prod:
+    remotestate:
+      name: stprod
+      resource_group: rg-prod
+    environments:
+      - name: prod
+`,
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg, err := ReadTGSConfig()
+	if err != nil {
+		t.Fatalf("ReadTGSConfig() unexpected error: %v", err)
+	}
+
+	wantFiles := []string{".tgs/naming.yaml", ".tgs/subscriptions/nonprod.yaml", ".tgs/subscriptions/prod.yaml"}
+	if !reflect.DeepEqual(cfg.IncludedFiles, wantFiles) {
+		t.Errorf("IncludedFiles = %v, want %v", cfg.IncludedFiles, wantFiles)
+	}
+	if cfg.Naming.Format != "${project}-${type}" || cfg.Naming.DefaultSeparator != "_" {
+		t.Errorf("naming = %+v, want the included format and the tgs.yaml separator", cfg.Naming)
+	}
+	if len(cfg.Subscriptions) != 2 || cfg.Subscriptions["nonprod"].RemoteState.Name != "stnonprod" {
+		t.Errorf("subscriptions = %+v", cfg.Subscriptions)
+	}
+	if prod := cfg.Subscriptions["prod"]; prod.RemoteState != (RemoteState{Name: "stprod", ResourceGroup: "rg-override"}) || len(prod.Environments) != 1 {
+		t.Errorf("prod = %+v, want the included subscription with the tgs.yaml resource group", prod)
+	}
+
+	if err := os.WriteFile(".tgs/tgs.yaml", []byte("name: proj\ninclude:\n  - missing.yaml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadTGSConfig(); err == nil {
+		t.Error("ReadTGSConfig() with a missing include should fail")
+	}
+}
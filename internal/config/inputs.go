@@ -0,0 +1,123 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// depPlaceholder matches {dep:name.output} in component inputs, where name is
+// a dependency of the component and output one of its outputs
+var depPlaceholder = regexp.MustCompile(`\{dep:([A-Za-z0-9_-]+)\.([A-Za-z0-9_.]+)\}`)
+
+// dataPlaceholder matches an input that is a {data:name.attribute}
+// placeholder, where name is a data source of the component
+var dataPlaceholder = regexp.MustCompile(`^\{data:([A-Za-z_][A-Za-z0-9_]*)\.([A-Za-z0-9_.\[\]]+)\}$`)
+
+// DependencyReference is a {dep:name.output} placeholder of an input
+type DependencyReference struct {
+	Name   string
+	Output string
+}
+
+// DependencyReferences returns the {dep:name.output} placeholders of an input
+// value in order
+func DependencyReferences(value string) []DependencyReference {
+	var refs []DependencyReference
+	for _, match := range depPlaceholder.FindAllStringSubmatch(value, -1) {
+		refs = append(refs, DependencyReference{Name: match[1], Output: match[2]})
+	}
+	return refs
+}
+
+// ResolveInput renders an input value as an HCL expression. A value that is a
+// single placeholder becomes the output reference itself, any other value an
+// HCL string interpolating its placeholders. outputs maps dependency names to
+// the expression holding their outputs.
+func ResolveInput(value string, outputs map[string]string) (string, error) {
+	var unknown []string
+	resolve := func(ref DependencyReference) string {
+		expr, ok := outputs[ref.Name]
+		if !ok {
+			unknown = append(unknown, ref.Name)
+		}
+		return expr + "." + ref.Output
+	}
+
+	if refs := DependencyReferences(value); len(refs) == 1 && depPlaceholder.FindString(value) == value {
+		expr := resolve(refs[0])
+		if len(unknown) > 0 {
+			return "", fmt.Errorf("input references unknown dependency %s", unknown[0])
+		}
+		return expr, nil
+	}
+
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "${", "$${", "%{", "%%{").Replace(value)
+	expr := depPlaceholder.ReplaceAllStringFunc(escaped, func(placeholder string) string {
+		return "${" + resolve(DependencyReferences(placeholder)[0]) + "}"
+	})
+	if len(unknown) > 0 {
+		return "", fmt.Errorf("input references unknown dependency %s", unknown[0])
+	}
+	return `"` + expr + `"`, nil
+}
+
+// DataReference is a {data:name.attribute} input
+type DataReference struct {
+	Name      string
+	Attribute string
+}
+
+// ParseDataReference parses an input that is a {data:name.attribute}
+// placeholder, ok is false for other values
+func ParseDataReference(value string) (DataReference, bool) {
+	match := dataPlaceholder.FindStringSubmatch(value)
+	if match == nil {
+		return DataReference{}, false
+	}
+	return DataReference{Name: match[1], Attribute: match[2]}, true
+}
+
+// DataInputs maps the inputs of a component read from its data sources to
+// the attribute they reference, e.g. data.azurerm_key_vault.shared.id.
+// Inputs referencing an unknown data source are left out.
+func (c Component) DataInputs() map[string]string {
+	inputs := make(map[string]string)
+	for name, value := range c.Inputs {
+		ref, ok := ParseDataReference(value)
+		if !ok {
+			continue
+		}
+		if source, ok := c.DataSources[ref.Name]; ok {
+			inputs[name] = fmt.Sprintf("data.%s.%s.%s", source.Type, ref.Name, ref.Attribute)
+		}
+	}
+	return inputs
+}
+
+// DependencyNames returns the names of the dependency blocks generated for
+// deps entries, in order: the component, component_app for a fixed app,
+// prefixed with paired_ for the paired region, and a numeric suffix when a
+// name is taken
+func DependencyNames(deps []string) []string {
+	var names []string
+	used := make(map[string]bool)
+	for _, dep := range deps {
+		name := dep
+		if parts := strings.Split(dep, "."); len(parts) >= 2 {
+			name = parts[1]
+			if len(parts) > 2 && parts[2] != "{app}" && parts[2] != "" {
+				name = fmt.Sprintf("%s_%s", parts[1], parts[2])
+			}
+			if parts[0] == "{paired_region}" {
+				name = "paired_" + name
+			}
+		}
+		if used[name] {
+			name = fmt.Sprintf("%s_%d", name, len(used)+1)
+		}
+		used[name] = true
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveInput(t *testing.T) {
+	outputs := map[string]string{
+		"serviceplan": "dependency.serviceplan.outputs",
+		"apim":        "dependency.apim.outputs",
+	}
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"{dep:serviceplan.id}", "dependency.serviceplan.outputs.id", false},
+		{"https://{dep:apim.gateway_url}/api", `"https://${dependency.apim.outputs.gateway_url}/api"`, false},
+		{`plain "value"`, `"plain \"value\""`, false},
+		{"${literal}", `"$${literal}"`, false},
+		{"{dep:redis.hostname}", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ResolveInput(tt.value, outputs)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ResolveInput(%q) = %q, %v, want %q (error %v)", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDependencyNames(t *testing.T) {
+	deps := []string{"{region}.serviceplan", "eastus2.redis", "westus2.redis", "{region}.appservice.{app}", "westus2.appservice.web", "{paired_region}.redis"}
+	want := []string{"serviceplan", "redis", "redis_3", "appservice", "appservice_web", "paired_redis"}
+	if got := DependencyNames(deps); !reflect.DeepEqual(got, want) {
+		t.Errorf("DependencyNames() = %v, want %v", got, want)
+	}
+}
+
+func TestDataInputs(t *testing.T) {
+	comp := Component{
+		Inputs: map[string]string{
+			"key_vault_id": "{data:shared.id}",
+			"tenant_id":    "{data:current.tenant_id}",
+			"unknown_id":   "{data:missing.id}",
+			"sku_name":     "B1",
+			"embedded":     "prefix-{data:shared.id}",
+		},
+		DataSources: map[string]DataSource{
+			"shared":  {Type: "azurerm_key_vault", Arguments: map[string]string{"name": "kv-shared"}},
+			"current": {Type: "azurerm_client_config"},
+		},
+	}
+	want := map[string]string{
+		"key_vault_id": "data.azurerm_key_vault.shared.id",
+		"tenant_id":    "data.azurerm_client_config.current.tenant_id",
+	}
+	if got := comp.DataInputs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("DataInputs() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// KeyVaultInput is the input holding the Key Vault of the secrets referenced
+// by secret app settings
+const KeyVaultInput = "key_vault_id"
+
+// KeyVaultSecretsInput is the input mapping the secret app settings of an app
+// to the names of their Key Vault secrets
+const KeyVaultSecretsInput = "key_vault_secrets"
+
+// AppSetting is an app setting. In YAML a setting is its value, or an
+// object marking it as a secret read from the component's Key Vault.
+type AppSetting struct {
+	Value string `yaml:"value,omitempty"`
+	// Secret renders the setting as a Key Vault reference instead of its value
+	Secret bool `yaml:"secret,omitempty"`
+	// SecretName is the Key Vault secret of the setting, derived from the
+	// setting name when empty
+	SecretName string `yaml:"secret_name,omitempty"`
+}
+
+// UnmarshalYAML reads settings written as values or objects
+func (s *AppSetting) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*s = AppSetting{Value: node.Value}
+		return nil
+	}
+	type plain AppSetting
+	return node.Decode((*plain)(s))
+}
+
+// MarshalYAML writes plain settings as their value
+func (s AppSetting) MarshalYAML() (interface{}, error) {
+	if !s.Secret {
+		return s.Value, nil
+	}
+	type plain AppSetting
+	return plain(s), nil
+}
+
+// AppSettings are the app settings of an app, keyed by setting name
+type AppSettings map[string]AppSetting
+
+// Values returns the values of the settings that aren't secrets
+func (s AppSettings) Values() map[string]string {
+	values := make(map[string]string)
+	for name, setting := range s {
+		if !setting.Secret {
+			values[name] = setting.Value
+		}
+	}
+	return values
+}
+
+// Secrets maps the secret settings to the names of their Key Vault secrets
+func (s AppSettings) Secrets() map[string]string {
+	secrets := make(map[string]string)
+	for name, setting := range s {
+		if !setting.Secret {
+			continue
+		}
+		secretName := setting.SecretName
+		if secretName == "" {
+			secretName = KeyVaultSecretName(name)
+		}
+		secrets[name] = secretName
+	}
+	return secrets
+}
+
+// nonSecretNameChars matches the characters Key Vault secret names can't hold
+var nonSecretNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// KeyVaultSecretName derives the Key Vault secret name of an app setting,
+// e.g. db-password for DB_PASSWORD and connectionstrings-db for
+// ConnectionStrings__Db
+func KeyVaultSecretName(setting string) string {
+	return strings.Trim(nonSecretNameChars.ReplaceAllString(strings.ToLower(setting), "-"), "-")
+}
+
+// KeyVaultComponent returns the component of the key_vault dependency, or ""
+// when it isn't set or in dependency notation
+func (c Component) KeyVaultComponent() string {
+	return dependencyComponent(c.KeyVault)
+}
+
+// AppSecrets returns the secret app settings of the component's apps by app
+// name. Settings only become Key Vault references for components with
+// app_settings and a key_vault.
+func (m *MainConfig) AppSecrets(compName string) map[string]map[string]string {
+	secrets := make(map[string]map[string]string)
+	comp := m.Stack.Components[compName]
+	if !comp.AppSettings || comp.KeyVaultComponent() == "" {
+		return secrets
+	}
+
+	var regions []string
+	for region := range m.Stack.Architecture.Regions {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	for _, region := range regions {
+		for _, rc := range m.Stack.Architecture.Regions[region] {
+			if rc.Component != compName {
+				continue
+			}
+			for _, app := range rc.Apps {
+				if appSecrets := rc.App(app).Settings.Secrets(); len(appSecrets) > 0 {
+					secrets[app] = appSecrets
+				}
+			}
+		}
+	}
+	return secrets
+}
+
+// ApplyKeyVault wires the components with secret app settings to their Key
+// Vault: each gets a dependency on the vault, its id as the key_vault_id
+// input and KeyVaultSecrets set. Reading a stack applies it, like
+// ApplyObservability.
+func (m *MainConfig) ApplyKeyVault() {
+	for name, comp := range m.Stack.Components {
+		if len(m.AppSecrets(name)) == 0 {
+			continue
+		}
+
+		deps := append([]string(nil), comp.Deps...)
+		index := indexOf(deps, comp.KeyVault)
+		if index < 0 {
+			deps = append(deps, comp.KeyVault)
+			index = len(deps) - 1
+		}
+
+		inputs := make(map[string]string, len(comp.Inputs)+1)
+		for key, value := range comp.Inputs {
+			inputs[key] = value
+		}
+		if _, set := inputs[KeyVaultInput]; !set {
+			inputs[KeyVaultInput] = "{dep:" + DependencyNames(deps)[index] + ".id}"
+		}
+
+		comp.Deps = deps
+		comp.Inputs = inputs
+		comp.KeyVaultSecrets = true
+		m.Stack.Components[name] = comp
+	}
+}
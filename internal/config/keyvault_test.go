@@ -0,0 +1,74 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestApplyKeyVault(t *testing.T) {
+	data := `stack:
+  components:
+    keyvault:
+      source: azurerm_key_vault
+    appservice:
+      source: azurerm_linux_web_app
+      app_settings: true
+      key_vault: "{region}.keyvault"
+    functionapp:
+      source: azurerm_linux_function_app
+      app_settings: true
+      key_vault: "{region}.keyvault"
+  architecture:
+    regions:
+      eastus2:
+        - component: appservice
+          apps:
+            - name: api
+              settings:
+                FEATURE: "on"
+                DB_PASSWORD:
+                  secret: true
+                ConnectionStrings__Redis:
+                  secret: true
+                  secret_name: redis-connection
+        - component: functionapp
+          apps: [jobs]
+`
+	var m MainConfig
+	if err := yaml.Unmarshal([]byte(data), &m); err != nil {
+		t.Fatalf("Unmarshal() unexpected error: %v", err)
+	}
+	m.ApplyKeyVault()
+
+	settings := m.Stack.Architecture.Regions["eastus2"][0].App("api").Settings
+	if want := map[string]string{"FEATURE": "on"}; !reflect.DeepEqual(settings.Values(), want) {
+		t.Errorf("Values() = %v, want %v", settings.Values(), want)
+	}
+	want := map[string]map[string]string{"api": {"DB_PASSWORD": "db-password", "ConnectionStrings__Redis": "redis-connection"}}
+	if got := m.AppSecrets("appservice"); !reflect.DeepEqual(got, want) {
+		t.Errorf("AppSecrets(appservice) = %v, want %v", got, want)
+	}
+
+	app := m.Stack.Components["appservice"]
+	if !app.KeyVaultSecrets || !reflect.DeepEqual(app.Deps, []string{"{region}.keyvault"}) || app.Inputs[KeyVaultInput] != "{dep:keyvault.id}" {
+		t.Errorf("appservice = %+v, want a dependency on the vault and its id as input", app)
+	}
+	// Components without secret settings aren't wired to the vault
+	if fn := m.Stack.Components["functionapp"]; fn.KeyVaultSecrets || len(fn.Deps) > 0 {
+		t.Errorf("functionapp = %+v, want no vault dependency", fn)
+	}
+}
+
+func TestKeyVaultSecretName(t *testing.T) {
+	for setting, want := range map[string]string{
+		"DB_PASSWORD":            "db-password",
+		"ConnectionStrings__Db":  "connectionstrings-db",
+		"_Leading.And.Trailing_": "leading-and-trailing",
+	} {
+		if got := KeyVaultSecretName(setting); got != want {
+			t.Errorf("KeyVaultSecretName(%q) = %q, want %q", setting, got, want)
+		}
+	}
+}
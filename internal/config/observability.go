@@ -0,0 +1,90 @@
+package config
+
+import (
+	"strings"
+)
+
+// WorkspaceInput is the input holding the Log Analytics workspace that
+// diagnostic settings send to
+const WorkspaceInput = "log_analytics_workspace_id"
+
+// ObservabilityConfig sends the diagnostics of the stack's components to a
+// Log Analytics workspace component
+type ObservabilityConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Workspace is the workspace component in dependency notation, e.g.
+	// {region}.loganalytics
+	Workspace string `yaml:"workspace"`
+	// Exclude lists components without diagnostic settings
+	Exclude []string `yaml:"exclude,omitempty"`
+}
+
+// WorkspaceComponent returns the component of the workspace dependency, or ""
+// when it isn't in dependency notation
+func (o *ObservabilityConfig) WorkspaceComponent() string {
+	return dependencyComponent(o.Workspace)
+}
+
+// dependencyComponent returns the component of a dependency in dependency
+// notation, or "" when it isn't in dependency notation
+func dependencyComponent(dep string) string {
+	parts := strings.Split(dep, ".")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// ApplyObservability wires the components of an enabled observability block
+// to its workspace: each gets a dependency on the workspace, its id as the
+// log_analytics_workspace_id input and Diagnostics set. Reading a stack
+// applies it, so generation, pipelines and validation see the dependencies.
+func (m *MainConfig) ApplyObservability() {
+	obs := m.Stack.Observability
+	if obs == nil || !obs.Enabled {
+		return
+	}
+	workspace := obs.WorkspaceComponent()
+	if workspace == "" {
+		return
+	}
+
+	for name, comp := range m.Stack.Components {
+		if name == workspace || containsString(obs.Exclude, name) {
+			continue
+		}
+
+		deps := append([]string(nil), comp.Deps...)
+		index := indexOf(deps, obs.Workspace)
+		if index < 0 {
+			deps = append(deps, obs.Workspace)
+			index = len(deps) - 1
+		}
+
+		inputs := make(map[string]string, len(comp.Inputs)+1)
+		for key, value := range comp.Inputs {
+			inputs[key] = value
+		}
+		if _, set := inputs[WorkspaceInput]; !set {
+			inputs[WorkspaceInput] = "{dep:" + DependencyNames(deps)[index] + ".id}"
+		}
+
+		comp.Deps = deps
+		comp.Inputs = inputs
+		comp.Diagnostics = true
+		m.Stack.Components[name] = comp
+	}
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+func containsString(values []string, value string) bool {
+	return indexOf(values, value) >= 0
+}
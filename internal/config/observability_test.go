@@ -0,0 +1,33 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyObservability(t *testing.T) {
+	m := &MainConfig{Stack: StackConfig{
+		Components: map[string]Component{
+			"logs":        {Source: "azurerm_log_analytics_workspace"},
+			"serviceplan": {Source: "azurerm_service_plan"},
+			"redis":       {Source: "azurerm_redis_cache", Deps: []string{"eastus2.logs"}},
+			"appservice":  {Source: "azurerm_linux_web_app", Deps: []string{"{region}.serviceplan"}},
+		},
+		Observability: &ObservabilityConfig{Enabled: true, Workspace: "{region}.logs", Exclude: []string{"serviceplan"}},
+	}}
+	m.ApplyObservability()
+
+	app := m.Stack.Components["appservice"]
+	if !app.Diagnostics || !reflect.DeepEqual(app.Deps, []string{"{region}.serviceplan", "{region}.logs"}) || app.Inputs[WorkspaceInput] != "{dep:logs.id}" {
+		t.Errorf("appservice = %+v, want a dependency on the workspace and its id as input", app)
+	}
+	// A different dependency on the same component gets a suffixed block name
+	if redis := m.Stack.Components["redis"]; redis.Inputs[WorkspaceInput] != "{dep:logs_2.id}" {
+		t.Errorf("redis inputs = %v, want the second logs dependency", redis.Inputs)
+	}
+	for _, name := range []string{"logs", "serviceplan"} {
+		if comp := m.Stack.Components[name]; comp.Diagnostics || len(comp.Deps) > 0 {
+			t.Errorf("%s = %+v, want no diagnostics", name, comp)
+		}
+	}
+}
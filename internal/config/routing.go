@@ -0,0 +1,139 @@
+package config
+
+import (
+	"sort"
+)
+
+// DefaultHostOutput is the output of origin instances holding their host name
+const DefaultHostOutput = "default_hostname"
+
+// RoutingConfig routes the global traffic of a component, e.g. a Front Door
+// or Traffic Manager profile, to the regional instances of another component
+type RoutingConfig struct {
+	// Origins is the component whose instances in every region deploying it
+	// are the origins
+	Origins string `yaml:"origins"`
+	// Apps limits the origins to instances of these apps, all by default
+	Apps []string `yaml:"apps,omitempty"`
+	// HostOutput is the output of the origins holding their host name,
+	// default_hostname by default
+	HostOutput string `yaml:"host_output,omitempty"`
+}
+
+// HostOutputName returns the output holding the host name of the origins
+func (r *RoutingConfig) HostOutputName() string {
+	if r.HostOutput != "" {
+		return r.HostOutput
+	}
+	return DefaultHostOutput
+}
+
+// Origin is a regional instance a routing component routes to
+type Origin struct {
+	// Name is <region>-<app>, or the region for origins without apps
+	Name   string
+	Region string
+	App    string
+	// Endpoint groups the origins of an app, the origins component for
+	// origins without apps
+	Endpoint string
+	// Dependency is the dependency block of the instance
+	Dependency string
+	// Priority is 2 for regions only failed over to from another region of
+	// the endpoint by paired_regions, 1 otherwise
+	Priority int
+}
+
+// ApplyRouting wires the components with routing to the instances of their
+// origins component in every region: each gets a dependency on the
+// instance in dependency notation and Origins set, and the origins component
+// outputs its host name. Reading a stack applies it, like
+// ApplyObservability.
+func (m *MainConfig) ApplyRouting() {
+	var regions []string
+	for region := range m.Stack.Architecture.Regions {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+
+	var names []string
+	for name := range m.Stack.Components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		comp := m.Stack.Components[name]
+		routing := comp.Routing
+		if routing == nil || routing.Origins == name {
+			continue
+		}
+		originComp, ok := m.Stack.Components[routing.Origins]
+		if !ok {
+			continue
+		}
+
+		deps := append([]string(nil), comp.Deps...)
+		var origins []Origin
+		var indexes []int
+		for _, region := range regions {
+			for _, rc := range m.Stack.Architecture.Regions[region] {
+				if rc.Component != routing.Origins {
+					continue
+				}
+				instances := []Origin{{Name: region, Region: region, Endpoint: routing.Origins}}
+				if len(rc.Apps) > 0 {
+					instances = nil
+					for _, app := range rc.Apps {
+						if len(routing.Apps) == 0 || containsString(routing.Apps, app) {
+							instances = append(instances, Origin{Name: region + "-" + app, Region: region, App: app, Endpoint: app})
+						}
+					}
+				}
+				for _, origin := range instances {
+					dep := region + "." + routing.Origins
+					if origin.App != "" {
+						dep += "." + origin.App
+					}
+					index := indexOf(deps, dep)
+					if index < 0 {
+						deps = append(deps, dep)
+						index = len(deps) - 1
+					}
+					origins = append(origins, origin)
+					indexes = append(indexes, index)
+				}
+			}
+		}
+
+		depNames := DependencyNames(deps)
+		for i := range origins {
+			origins[i].Dependency = depNames[indexes[i]]
+			origins[i].Priority = 1
+			if m.failoverOnly(origins[i], origins) {
+				origins[i].Priority = 2
+			}
+		}
+
+		comp.Deps = deps
+		comp.Origins = origins
+		m.Stack.Components[name] = comp
+
+		if host := routing.HostOutputName(); !containsString(originComp.Outputs.Names, host) {
+			originComp.Outputs.Names = append(append([]string(nil), originComp.Outputs.Names...), host)
+			m.Stack.Components[routing.Origins] = originComp
+		}
+	}
+}
+
+// failoverOnly reports whether the region of an origin is the paired region
+// of another origin of its endpoint without being paired back
+func (m *MainConfig) failoverOnly(origin Origin, origins []Origin) bool {
+	pairs := m.Stack.Architecture.PairedRegions
+	for _, other := range origins {
+		if other.Endpoint == origin.Endpoint && other.Region != origin.Region && pairs[other.Region] == origin.Region && pairs[origin.Region] != other.Region {
+			return true
+		}
+	}
+	return false
+}
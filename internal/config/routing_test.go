@@ -0,0 +1,39 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyRouting(t *testing.T) {
+	m := &MainConfig{Stack: StackConfig{
+		Components: map[string]Component{
+			"appservice": {Source: "azurerm_linux_web_app"},
+			"frontdoor":  {Source: "azurerm_cdn_frontdoor_profile", Routing: &RoutingConfig{Origins: "appservice", Apps: []string{"api"}}},
+		},
+		Architecture: ArchitectureConfig{
+			Regions: map[string][]RegionComponent{
+				"eastus2":   {{Component: "appservice", Apps: []string{"api", "web"}}, {Component: "frontdoor"}},
+				"centralus": {{Component: "appservice", Apps: []string{"api"}}},
+			},
+			PairedRegions: map[string]string{"eastus2": "centralus"},
+		},
+	}}
+	m.ApplyRouting()
+
+	frontdoor := m.Stack.Components["frontdoor"]
+	if want := []string{"centralus.appservice.api", "eastus2.appservice.api"}; !reflect.DeepEqual(frontdoor.Deps, want) {
+		t.Errorf("frontdoor deps = %v, want %v", frontdoor.Deps, want)
+	}
+	// centralus only serves as the paired region of eastus2
+	want := []Origin{
+		{Name: "centralus-api", Region: "centralus", App: "api", Endpoint: "api", Dependency: "appservice_api", Priority: 2},
+		{Name: "eastus2-api", Region: "eastus2", App: "api", Endpoint: "api", Dependency: "appservice_api_2", Priority: 1},
+	}
+	if !reflect.DeepEqual(frontdoor.Origins, want) {
+		t.Errorf("frontdoor origins = %+v, want %+v", frontdoor.Origins, want)
+	}
+	if names := m.Stack.Components["appservice"].Outputs.Names; !reflect.DeepEqual(names, []string{DefaultHostOutput}) {
+		t.Errorf("appservice outputs = %v, want the host name", names)
+	}
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Schemes of environment secret references
+const (
+	SecretKeyVault = "keyvault"
+	SecretSops     = "sops"
+	SecretEnv      = "env"
+)
+
+var (
+	// secretKey matches <component>.<attribute> keys of environment secrets
+	secretKey = regexp.MustCompile(`^([A-Za-z0-9_-]+)\.([A-Za-z_][A-Za-z0-9_]*)$`)
+	// keyVaultName and keyVaultSecret follow the Azure naming rules of vaults
+	// and their secrets
+	keyVaultName   = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]{1,22}[A-Za-z0-9]$`)
+	keyVaultSecret = regexp.MustCompile(`^[A-Za-z0-9-]{1,127}$`)
+	envVariable    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// sopsFile and sopsKey limit sops references to plain relative paths and
+	// dotted keys, which are written into HCL strings
+	sopsFile = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_./-]*$`)
+	sopsKey  = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+)
+
+// hclEscaper escapes a value for a quoted HCL string, keeping ${ and %{
+// literal
+var hclEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`, "${", "$${", "%{", "%%{")
+
+// hclQuote returns a value as a quoted HCL string written literally
+func hclQuote(value string) string {
+	return `"` + hclEscaper.Replace(value) + `"`
+}
+
+// Secret is a reference to a sensitive value of an environment, such as a SQL
+// admin password. It's resolved when Terragrunt reads the environment config,
+// so the value itself never ends up in generated files.
+type Secret struct {
+	Scheme string
+	// Vault and Name are the Key Vault and secret of keyvault://<vault>/<name>
+	Vault string
+	Name  string
+	// File and Key are the sops encrypted YAML or JSON file, relative to the
+	// project, and the dotted key of sops://<file>#<key>
+	File string
+	Key  string
+	// Variable is the environment variable of env://<variable>
+	Variable string
+}
+
+// SecretKey splits a <component>.<attribute> key of environment secrets
+func SecretKey(key string) (component, attribute string, err error) {
+	match := secretKey.FindStringSubmatch(key)
+	if match == nil {
+		return "", "", fmt.Errorf("secret key %q must be <component>.<attribute>", key)
+	}
+	return match[1], match[2], nil
+}
+
+// ParseSecret parses a keyvault://<vault>/<name>, sops://<file>#<key> or
+// env://<variable> reference. Plain values are rejected, since they'd be
+// written to the generated files as they are.
+func ParseSecret(value string) (Secret, error) {
+	scheme, ref, ok := strings.Cut(value, "://")
+	if !ok {
+		return Secret{}, fmt.Errorf("secret must be a keyvault://, sops:// or env:// reference, not a plain value")
+	}
+
+	switch scheme {
+	case SecretKeyVault:
+		vault, name, _ := strings.Cut(ref, "/")
+		if !keyVaultName.MatchString(vault) || !keyVaultSecret.MatchString(name) {
+			return Secret{}, fmt.Errorf("invalid Key Vault reference %q: must be keyvault://<vault>/<secret>", value)
+		}
+		return Secret{Scheme: scheme, Vault: vault, Name: name}, nil
+	case SecretSops:
+		file, key, _ := strings.Cut(ref, "#")
+		if file == "" || key == "" {
+			return Secret{}, fmt.Errorf("invalid sops reference %q: must be sops://<file>#<key>", value)
+		}
+		if !sopsFile.MatchString(file) || strings.Contains("/"+file+"/", "/../") {
+			return Secret{}, fmt.Errorf("invalid sops file %q: must be a path relative to the project of letters, digits, _, -, . and /", file)
+		}
+		if !sopsKey.MatchString(key) {
+			return Secret{}, fmt.Errorf("invalid sops key %q: must be dotted keys of letters, digits, _ and -", key)
+		}
+		return Secret{Scheme: scheme, File: file, Key: key}, nil
+	case SecretEnv:
+		if !envVariable.MatchString(ref) {
+			return Secret{}, fmt.Errorf("invalid environment variable reference %q: must be env://<variable>", value)
+		}
+		return Secret{Scheme: scheme, Variable: ref}, nil
+	}
+	return Secret{}, fmt.Errorf("unsupported secret scheme %q: must be one of %s, %s, %s", scheme, SecretKeyVault, SecretSops, SecretEnv)
+}
+
+// Expression renders the Terragrunt expression resolving a secret. Key Vault
+// secrets are read with the Azure CLI, sops files are decrypted by Terragrunt
+// from projectPrefix, the project directory relative to the repository root.
+func (s Secret) Expression(projectPrefix string) string {
+	switch s.Scheme {
+	case SecretKeyVault:
+		return fmt.Sprintf(`run_cmd("--terragrunt-quiet", "az", "keyvault", "secret", "show", "--vault-name", %s, "--name", %s, "--query", "value", "--output", "tsv")`, hclQuote(s.Vault), hclQuote(s.Name))
+	case SecretSops:
+		expr := fmt.Sprintf(`yamldecode(sops_decrypt_file("${get_repo_root()}/%s"))`, hclEscaper.Replace(projectPrefix+s.File))
+		for _, part := range strings.Split(s.Key, ".") {
+			expr += "[" + hclQuote(part) + "]"
+		}
+		return expr
+	case SecretEnv:
+		return fmt.Sprintf(`get_env(%s)`, hclQuote(s.Variable))
+	}
+	return `""`
+}
@@ -0,0 +1,65 @@
+package config
+
+import "testing"
+
+func TestParseSecret(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"keyvault://kv-dev-shared/sql-admin", `run_cmd("--terragrunt-quiet", "az", "keyvault", "secret", "show", "--vault-name", "kv-dev-shared", "--name", "sql-admin", "--query", "value", "--output", "tsv")`},
+		{"sops://secrets/dev.enc.yaml#sql.password", `yamldecode(sops_decrypt_file("${get_repo_root()}/infra/secrets/dev.enc.yaml"))["sql"]["password"]`},
+		{"env://SQL_PASSWORD", `get_env("SQL_PASSWORD")`},
+	}
+	for _, tt := range tests {
+		secret, err := ParseSecret(tt.value)
+		if err != nil {
+			t.Errorf("ParseSecret(%q) unexpected error: %v", tt.value, err)
+			continue
+		}
+		if got := secret.Expression("infra/"); got != tt.want {
+			t.Errorf("ParseSecret(%q).Expression() = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+
+	for _, value := range []string{
+		"hunter2", "keyvault://kv/sql-admin", "sops://secrets/dev.enc.yaml", "env://1PASSWORD", "vault://kv/secret",
+		// sops files and keys are written into HCL strings
+		"sops://secrets/${local.x}.yaml#sql", `sops://secrets/dev".yaml#sql`, `sops://secrets\dev.yaml#sql`,
+		"sops:///etc/dev.yaml#sql", "sops://../dev.yaml#sql", "sops://secrets/../../dev.yaml#sql",
+		`sops://dev.yaml#sql"]`, "sops://dev.yaml#%{sql}", "sops://dev.yaml#sql..password", "sops://dev.yaml#sql\u00e9",
+	} {
+		if _, err := ParseSecret(value); err == nil {
+			t.Errorf("ParseSecret(%q) expected an error", value)
+		}
+	}
+}
+
+func TestSecretExpressionEscapes(t *testing.T) {
+	// Values are escaped for HCL even when they bypass ParseSecret
+	tests := []struct {
+		secret Secret
+		prefix string
+		want   string
+	}{
+		{Secret{Scheme: SecretSops, File: `a"${b}.yaml`, Key: `c\d.%{e}`}, "", `yamldecode(sops_decrypt_file("${get_repo_root()}/a\"$${b}.yaml"))["c\\d"]["%%{e}"]`},
+		{Secret{Scheme: SecretSops, File: "dev.yaml", Key: "sql"}, "${x}/", `yamldecode(sops_decrypt_file("${get_repo_root()}/$${x}/dev.yaml"))["sql"]`},
+		{Secret{Scheme: SecretKeyVault, Vault: "kv\u00e9", Name: `a"b`}, "", `run_cmd("--terragrunt-quiet", "az", "keyvault", "secret", "show", "--vault-name", "kvé", "--name", "a\"b", "--query", "value", "--output", "tsv")`},
+		{Secret{Scheme: SecretEnv, Variable: "${X}"}, "", `get_env("$${X}")`},
+	}
+	for _, tt := range tests {
+		if got := tt.secret.Expression(tt.prefix); got != tt.want {
+			t.Errorf("%+v.Expression(%q) = %s, want %s", tt.secret, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestSecretKey(t *testing.T) {
+	component, attribute, err := SecretKey("sql.administrator_login_password")
+	if err != nil || component != "sql" || attribute != "administrator_login_password" {
+		t.Errorf("SecretKey() = %q, %q, %v", component, attribute, err)
+	}
+	if _, _, err := SecretKey("sql"); err == nil {
+		t.Error("SecretKey(sql) expected an error")
+	}
+}
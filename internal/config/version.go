@@ -0,0 +1,35 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareVersions compares two semantic versions, returning -1, 0 or 1.
+// Pre-release suffixes are ignored.
+func CompareVersions(a, b string) int {
+	pa := versionParts(a)
+	pb := versionParts(b)
+	for i := 0; i < 3; i++ {
+		switch {
+		case pa[i] < pb[i]:
+			return -1
+		case pa[i] > pb[i]:
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionParts returns the major, minor and patch numbers of a version
+func versionParts(version string) [3]int {
+	var parts [3]int
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	for i, part := range strings.SplitN(version, ".", 3) {
+		parts[i], _ = strconv.Atoi(part)
+	}
+	return parts
+}
@@ -0,0 +1,114 @@
+// Package cost estimates the monthly cost of the generated environments with
+// infracost
+package cost
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+)
+
+// Estimate is the monthly cost estimate of an environment, summed over its
+// regions
+type Estimate struct {
+	Subscription string   `json:"subscription"`
+	Environment  string   `json:"environment"`
+	Regions      []string `json:"regions"`
+	MonthlyCost  float64  `json:"monthly_cost"`
+	Currency     string   `json:"currency"`
+}
+
+// breakdown is the part of the JSON output of infracost breakdown tgs reads
+type breakdown struct {
+	Currency         string  `json:"currency"`
+	TotalMonthlyCost *string `json:"totalMonthlyCost"`
+}
+
+// Environments estimates every environment of tgs.yaml from the tree
+// generated in infraPath, running infracost breakdown in each region folder
+// of the environment. Environments that aren't generated yet are skipped.
+func Environments(tgsConfig *config.TGSConfig, infraPath string) ([]Estimate, error) {
+	if _, err := exec.LookPath("infracost"); err != nil {
+		return nil, fmt.Errorf("infracost is required to estimate costs: %w", err)
+	}
+
+	var subs []string
+	for name := range tgsConfig.Subscriptions {
+		subs = append(subs, name)
+	}
+	sort.Strings(subs)
+
+	var estimates []Estimate
+	for _, subName := range subs {
+		for _, env := range tgsConfig.Subscriptions[subName].Environments {
+			stack := env.Stack
+			if stack == "" {
+				stack = "main"
+			}
+
+			dirs, err := project.Glob(filepath.Join(infraPath, "architecture", stack, subName, "*", env.Name))
+			if err != nil {
+				return nil, fmt.Errorf("failed to find folders of environment %s: %w", env.Name, err)
+			}
+			if len(dirs) == 0 {
+				continue
+			}
+			sort.Strings(dirs)
+
+			estimate := Estimate{Subscription: subName, Environment: env.Name}
+			for _, dir := range dirs {
+				result, err := runBreakdown(dir)
+				if err != nil {
+					return nil, fmt.Errorf("failed to estimate environment %s: %w", env.Name, err)
+				}
+				estimate.Regions = append(estimate.Regions, filepath.Base(filepath.Dir(dir)))
+				estimate.Currency = result.Currency
+				if result.TotalMonthlyCost != nil {
+					monthly, err := strconv.ParseFloat(*result.TotalMonthlyCost, 64)
+					if err != nil {
+						return nil, fmt.Errorf("failed to parse cost of %s: %w", dir, err)
+					}
+					estimate.MonthlyCost += monthly
+				}
+			}
+			estimates = append(estimates, estimate)
+		}
+	}
+	return estimates, nil
+}
+
+// runBreakdown runs infracost breakdown in a folder of the tree
+func runBreakdown(dir string) (*breakdown, error) {
+	cmd := project.Command("infracost", "breakdown", "--path", dir, "--format", "json", "--log-level", "error")
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("infracost breakdown failed for %s: %w", dir, err)
+	}
+	return parseBreakdown(out)
+}
+
+// parseBreakdown parses the JSON output of infracost breakdown
+func parseBreakdown(data []byte) (*breakdown, error) {
+	var result breakdown
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse infracost output: %w", err)
+	}
+	return &result, nil
+}
+
+// Total returns the sum of the estimates
+func Total(estimates []Estimate) float64 {
+	var total float64
+	for _, estimate := range estimates {
+		total += estimate.MonthlyCost
+	}
+	return total
+}
@@ -0,0 +1,23 @@
+package cost
+
+import "testing"
+
+func TestParseBreakdown(t *testing.T) {
+	result, err := parseBreakdown([]byte(`{"version":"0.2","currency":"USD","projects":[],"totalMonthlyCost":"123.45"}`))
+	if err != nil {
+		t.Fatalf("parseBreakdown() error = %v", err)
+	}
+	if result.Currency != "USD" || result.TotalMonthlyCost == nil || *result.TotalMonthlyCost != "123.45" {
+		t.Errorf("parseBreakdown() = %+v", result)
+	}
+
+	// Folders without priced resources have no total
+	result, err = parseBreakdown([]byte(`{"currency":"USD","totalMonthlyCost":null}`))
+	if err != nil || result.TotalMonthlyCost != nil {
+		t.Errorf("parseBreakdown() without cost = %+v, %v", result, err)
+	}
+
+	if total := Total([]Estimate{{MonthlyCost: 10.5}, {MonthlyCost: 2}}); total != 12.5 {
+		t.Errorf("Total() = %v, want 12.5", total)
+	}
+}
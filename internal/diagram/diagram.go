@@ -2,28 +2,94 @@ package diagram
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
 	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
-	"gopkg.in/yaml.v3"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
 )
 
-// GenerateDiagram generates Mermaid diagrams for all stacks
-func GenerateDiagram() error {
+// Formats lists the diagram formats of GenerateDiagram
+var Formats = []string{"mermaid", "plantuml", "dot", "svg", "structurizr"}
+
+// RenderFormats lists the image formats PlantUML diagrams are rendered to
+var RenderFormats = []string{"png", "svg"}
+
+// Options select what GenerateDiagram generates
+type Options struct {
+	// Format is the format of the architecture diagrams, one of Formats
+	Format string
+	// Render is an image format the PlantUML diagrams are rendered to by a
+	// PlantUML server, one of RenderFormats
+	Render string
+	// Server overrides the PlantUML server of tgs.yaml
+	Server string
+	// Pipelines generates the pipeline stage graph of every environment
+	// instead of the architecture diagrams
+	Pipelines bool
+	// Stack, Env and Region restrict the diagrams to a stack, environment
+	// and region
+	Stack  string
+	Env    string
+	Region string
+	// Overview generates a diagram per stack covering all its environments
+	// instead of a diagram per environment
+	Overview bool
+}
+
+// GenerateDiagram generates the folder structure of all stacks and a diagram
+// per stack and environment in the format of opts: mermaid markdown, PlantUML,
+// Graphviz DOT or SVG. The structurizr format and overviews write a diagram
+// per stack covering all its environments.
+func GenerateDiagram(opts Options) error {
+	format := opts.Format
+	if format == "" {
+		format = "mermaid"
+	}
+	if !contains(Formats, format) {
+		return fmt.Errorf("unsupported format %q: must be one of %s", format, strings.Join(Formats, ", "))
+	}
+	if opts.Pipelines {
+		if format != "mermaid" || opts.Render != "" || opts.Overview || opts.Stack != "" {
+			return fmt.Errorf("pipeline diagrams are only generated in the mermaid format, filtered by environment and region")
+		}
+		envs, err := generatePipelineDiagrams(opts.Env, opts.Region)
+		if err != nil {
+			return err
+		}
+		logger.Success("Generated pipeline stage diagrams for %d environments in %s/ directory", len(envs), filepath.ToSlash(output.Path("diagrams")))
+		return nil
+	}
+	if opts.Overview && format != "mermaid" && format != "dot" {
+		return fmt.Errorf("overviews are only generated in the mermaid and dot formats")
+	}
+	if opts.Render != "" {
+		if !contains(RenderFormats, opts.Render) {
+			return fmt.Errorf("unsupported render format %q: must be one of %s", opts.Render, strings.Join(RenderFormats, ", "))
+		}
+		if format != "plantuml" {
+			return fmt.Errorf("rendering with a PlantUML server requires the plantuml format")
+		}
+	}
+
 	logger.Info("Generating infrastructure diagrams")
 
 	// Read TGS config to get subscription and environment structure
-	tgsConfig, err := readTGSConfig()
+	tgsConfig, err := config.ReadTGSConfig()
 	if err != nil {
 		return fmt.Errorf("failed to read TGS config: %w", err)
 	}
+	tgsConfig = filterEnvironments(tgsConfig, opts.Stack, opts.Env)
+	if len(tgsConfig.Subscriptions) == 0 {
+		return fmt.Errorf("no environment matches the stack and environment filters")
+	}
 
-	// Create diagrams directory in .infrastructure if it doesn't exist
-	outputDir := filepath.Join(".infrastructure", "diagrams")
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
+	// Create diagrams directory in the output if it doesn't exist
+	outputDir := output.Path("diagrams")
+	if err := project.MkdirAll(outputDir, 0755); err != nil {
 		return fmt.Errorf("failed to create diagrams directory: %w", err)
 	}
 
@@ -43,6 +109,49 @@ func GenerateDiagram() error {
 		}
 	}
 
+	// Read the stacks once, keeping only the region of the filter
+	stackNames := append([]string(nil), stacks...)
+	sort.Strings(stackNames)
+	stackConfigs := make(map[string]*config.MainConfig)
+	for _, stackName := range stackNames {
+		mainConfig, err := readStackConfig(stackName)
+		if err != nil {
+			return fmt.Errorf("failed to read stack config: %w", err)
+		}
+		if opts.Region != "" {
+			regionComps, ok := mainConfig.Stack.Architecture.Regions[opts.Region]
+			if !ok {
+				continue
+			}
+			mainConfig.Stack.Architecture.Regions = map[string][]config.RegionComponent{opts.Region: regionComps}
+		}
+		stackConfigs[stackName] = mainConfig
+	}
+	if len(stackConfigs) == 0 {
+		return fmt.Errorf("region %q is not in the architecture of any stack", opts.Region)
+	}
+
+	// Structurizr workspaces and overviews model every environment of a stack
+	if format == "structurizr" || opts.Overview {
+		for _, stackName := range stackNames {
+			mainConfig, ok := stackConfigs[stackName]
+			if !ok {
+				continue
+			}
+			if format == "structurizr" {
+				err = generateStructurizrWorkspace(stackName, tgsConfig, mainConfig)
+			} else {
+				err = generateOverviewDiagram(stackName, tgsConfig, mainConfig, format)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to generate diagram for stack %s: %w", stackName, err)
+			}
+			logger.Info("Generated diagram for stack %s", stackName)
+		}
+		logger.Info("Generated infrastructure diagrams in %s/ directory", filepath.ToSlash(outputDir))
+		return nil
+	}
+
 	// Track which stacks we've processed to avoid duplicates
 	processedStacks := make(map[string]bool)
 
@@ -54,6 +163,10 @@ func GenerateDiagram() error {
 			if env.Stack != "" {
 				stackName = env.Stack
 			}
+			mainConfig, ok := stackConfigs[stackName]
+			if !ok {
+				continue
+			}
 
 			// Skip if we've already processed this stack for this environment
 			key := fmt.Sprintf("%s_%s", stackName, env.Name)
@@ -62,7 +175,24 @@ func GenerateDiagram() error {
 			}
 			processedStacks[key] = true
 
-			if err := generateMermaidDiagram(stackName, tgsConfig, env.Name); err != nil {
+			switch format {
+			case "plantuml":
+				err = generatePlantUMLDiagram(stackName, tgsConfig, mainConfig, env.Name)
+				if err == nil && opts.Render != "" {
+					server := opts.Server
+					if server == "" {
+						server = tgsConfig.Diagrams.Server()
+					}
+					err = renderPlantUML(server, output.Path("diagrams", fmt.Sprintf("%s_%s.puml", stackName, env.Name)), opts.Render)
+				}
+			case "dot":
+				_, err = generateDOTDiagram(stackName, tgsConfig, mainConfig, env.Name)
+			case "svg":
+				err = generateSVGDiagram(stackName, tgsConfig, mainConfig, env.Name)
+			default:
+				err = generateMermaidDiagram(stackName, tgsConfig, mainConfig, env.Name)
+			}
+			if err != nil {
 				return fmt.Errorf("failed to generate diagram for stack %s, environment %s: %w", stackName, env.Name, err)
 			}
 
@@ -70,10 +200,38 @@ func GenerateDiagram() error {
 		}
 	}
 
-	logger.Info("Generated infrastructure diagrams in .infrastructure/diagrams/ directory")
+	logger.Info("Generated infrastructure diagrams in %s/ directory", filepath.ToSlash(outputDir))
 	return nil
 }
 
+// filterEnvironments returns a copy of tgsConfig keeping only the
+// environments of a stack and with a name, when they're set
+func filterEnvironments(tgsConfig *config.TGSConfig, stackName, envName string) *config.TGSConfig {
+	if stackName == "" && envName == "" {
+		return tgsConfig
+	}
+
+	filtered := *tgsConfig
+	filtered.Subscriptions = make(map[string]config.Subscription)
+	for name, sub := range tgsConfig.Subscriptions {
+		var envs []config.Environment
+		for _, env := range sub.Environments {
+			envStack := env.Stack
+			if envStack == "" {
+				envStack = "main"
+			}
+			if (stackName == "" || envStack == stackName) && (envName == "" || env.Name == envName) {
+				envs = append(envs, env)
+			}
+		}
+		if len(envs) > 0 {
+			sub.Environments = envs
+			filtered.Subscriptions[name] = sub
+		}
+	}
+	return &filtered
+}
+
 // GenerateTreeDiagram creates markdown files with folder structure trees for each stack
 func GenerateTreeDiagram(tgsConfig *config.TGSConfig, outputDir string) ([]string, error) {
 	// Collect all stacks
@@ -106,7 +264,7 @@ func GenerateTreeDiagram(tgsConfig *config.TGSConfig, outputDir string) ([]strin
 		// Add folder structure tree section
 		content.WriteString("## Folder Structure\n\n")
 		content.WriteString("```\n")
-		content.WriteString(".infrastructure/\n")
+		content.WriteString(output.Dir() + "/\n")
 		content.WriteString("├── _components/                      # Component templates\n")
 
 		// Add components for this stack
@@ -397,7 +555,7 @@ func GenerateTreeDiagram(tgsConfig *config.TGSConfig, outputDir string) ([]strin
 		content.WriteString("## Usage\n\n")
 		content.WriteString("To apply this infrastructure, use Terragrunt:\n\n")
 		content.WriteString("```bash\n")
-		content.WriteString(fmt.Sprintf("cd .infrastructure/architecture/%s/{subscription}/{region}/{environment}/{component}\n", stackName))
+		content.WriteString(fmt.Sprintf("cd %s/architecture/%s/{subscription}/{region}/{environment}/{component}\n", output.Dir(), stackName))
 		content.WriteString("terragrunt init\n")
 		content.WriteString("terragrunt plan\n")
 		content.WriteString("terragrunt apply\n")
@@ -421,49 +579,43 @@ func GenerateTreeDiagram(tgsConfig *config.TGSConfig, outputDir string) ([]strin
 	return processedStacks, nil
 }
 
+// contains reports whether values holds value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// pairedRegions returns the sorted regions of a stack paired with another
+// region of its architecture
+func pairedRegions(mainConfig *config.MainConfig) []string {
+	var regions []string
+	for region, pair := range mainConfig.Stack.Architecture.PairedRegions {
+		_, hasRegion := mainConfig.Stack.Architecture.Regions[region]
+		_, hasPair := mainConfig.Stack.Architecture.Regions[pair]
+		if hasRegion && hasPair {
+			regions = append(regions, region)
+		}
+	}
+	sort.Strings(regions)
+	return regions
+}
+
 // writeFile creates a file with the given content
 func writeFile(path string, content string) error {
 	// Ensure the parent directory exists
 	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	if err := project.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("failed to create directory %s: %w", dir, err)
 	}
 
-	return os.WriteFile(path, []byte(content), 0644)
+	return project.WriteFile(path, []byte(content), 0644)
 }
 
 // readStackConfig reads a specific stack configuration
 func readStackConfig(stackName string) (*config.MainConfig, error) {
-	stacksDir := filepath.Join(".tgs", "stacks")
-	stackPath := filepath.Join(stacksDir, fmt.Sprintf("%s.yaml", stackName))
-
-	data, err := os.ReadFile(stackPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read stack file %s: %w", stackPath, err)
-	}
-
-	var cfg config.MainConfig
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse stack file %s: %w", stackPath, err)
-	}
-
-	return &cfg, nil
-}
-
-// readTGSConfig reads the tgs.yaml configuration
-func readTGSConfig() (*config.TGSConfig, error) {
-	configDir := ".tgs"
-	configPath := filepath.Join(configDir, "tgs.yaml")
-
-	data, err := os.ReadFile(configPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read tgs.yaml: %w", err)
-	}
-
-	var cfg config.TGSConfig
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse tgs.yaml: %w", err)
-	}
-
-	return &cfg, nil
+	return config.ReadMainConfig(stackName)
 }
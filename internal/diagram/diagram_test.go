@@ -0,0 +1,619 @@
+package diagram
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+)
+
+// testProject deploys the main stack to dev and prod and the data stack to
+// analytics
+var testProject = map[string]string{
+	".tgs/tgs.yaml": `name: projecta
+subscriptions:
+  nonprod:
+    remotestate:
+      name: stprojectanonprodtf
+      resource_group: rg-projecta-nonprod-tf
+    environments:
+      - name: dev
+      - name: analytics
+        stack: data
+  prod:
+    remotestate:
+      name: stprojectaprodtf
+      resource_group: rg-projecta-prod-tf
+    environments:
+      - name: prod
+`,
+	".tgs/stacks/main.yaml": `stack:
+  name: main
+  version: "1.0.0"
+  description: "Main stack"
+  components:
+    redis:
+      source: azurerm_redis_cache
+      provider: azurerm
+      version: 4.22.0
+    appservice:
+      source: azurerm_linux_web_app
+      provider: azurerm
+      version: 4.22.0
+      deps:
+        - "{region}.redis"
+  architecture:
+    regions:
+      eastus2:
+        - component: redis
+        - component: appservice
+          apps: [api]
+      westus2:
+        - component: redis
+`,
+	".tgs/stacks/data.yaml": `stack:
+  name: data
+  version: "1.0.0"
+  description: "Data stack"
+  components:
+    storage:
+      source: azurerm_storage_account
+      provider: azurerm
+      version: 4.22.0
+  architecture:
+    regions:
+      eastus2:
+        - component: storage
+`,
+}
+
+// useProject writes testProject to a temporary project root
+func useProject(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range testProject {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	project.SetRoot(dir)
+	output.SetDir("")
+	t.Cleanup(func() { project.SetRoot("") })
+	return dir
+}
+
+// diagramFiles returns the sorted files of the diagrams directory
+func diagramFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(filepath.Join(dir, output.Dir(), "diagrams"))
+	if err != nil {
+		t.Fatalf("Failed to read diagrams directory: %v", err)
+	}
+	var files []string
+	for _, entry := range entries {
+		files = append(files, entry.Name())
+	}
+	sort.Strings(files)
+	return files
+}
+
+// readDiagram returns the content of a file of the diagrams directory
+func readDiagram(t *testing.T, dir, name string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(dir, output.Dir(), "diagrams", name))
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", name, err)
+	}
+	return string(data)
+}
+
+func TestDOTDiagram(t *testing.T) {
+	dir := useProject(t)
+
+	if err := GenerateDiagram(Options{Format: "dot"}); err != nil {
+		t.Fatalf("GenerateDiagram() unexpected error: %v", err)
+	}
+
+	want := []string{"data_analytics.dot", "folder_structure_data.md", "folder_structure_main.md", "main_dev.dot", "main_prod.dot"}
+	if got := diagramFiles(t, dir); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("GenerateDiagram() wrote %v, want %v", got, want)
+	}
+
+	wantDOT := `digraph "main_dev" {
+  rankdir=LR;
+  label="Stack main - dev";
+  labelloc=t;
+  node [shape=box, style="rounded,filled", fillcolor="#0072C6", fontcolor=white, fontname=Helvetica];
+
+  subgraph "cluster_nonprod" {
+    label="nonprod";
+    subgraph "cluster_nonprod_eastus2" {
+      label="eastus2";
+      "nonprod.eastus2.appservice.api" [label="appservice/api\nprojecta-E2D-app-api"];
+      "nonprod.eastus2.redis" [label="redis\nprojecta-E2D-redis"];
+    }
+    subgraph "cluster_nonprod_westus2" {
+      label="westus2";
+      "nonprod.westus2.redis" [label="redis\nprojecta-W2D-redis"];
+    }
+  }
+
+  "nonprod.eastus2.appservice.api" -> "nonprod.eastus2.redis";
+}
+`
+	if got := readDiagram(t, dir, "main_dev.dot"); got != wantDOT {
+		t.Errorf("main_dev.dot = %s, want %s", got, wantDOT)
+	}
+}
+
+func TestSVGDiagram(t *testing.T) {
+	dir := useProject(t)
+	// Without Graphviz the diagram is laid out by deployment wave
+	t.Setenv("PATH", t.TempDir())
+
+	if err := GenerateDiagram(Options{Format: "svg"}); err != nil {
+		t.Fatalf("GenerateDiagram() unexpected error: %v", err)
+	}
+
+	var svg struct {
+		Width  int `xml:"width,attr"`
+		Height int `xml:"height,attr"`
+		Rects  []struct {
+			X int `xml:"x,attr"`
+			Y int `xml:"y,attr"`
+		} `xml:"rect"`
+		Lines []struct {
+			X1 int `xml:"x1,attr"`
+			X2 int `xml:"x2,attr"`
+		} `xml:"line"`
+		Texts []string `xml:"text"`
+	}
+	if err := xml.Unmarshal([]byte(readDiagram(t, dir, "main_dev.svg")), &svg); err != nil {
+		t.Fatalf("main_dev.svg is not valid XML: %v", err)
+	}
+
+	// Three nodes in the nonprod band, redis in the first wave and the app
+	// depending on it in the second
+	if len(svg.Rects) != 3 || len(svg.Lines) != 1 {
+		t.Fatalf("main_dev.svg has %d boxes and %d arrows, want 3 and 1", len(svg.Rects), len(svg.Lines))
+	}
+	if svg.Lines[0].X1 <= svg.Lines[0].X2 {
+		t.Errorf("arrow from x=%d to x=%d should point back to the earlier wave", svg.Lines[0].X1, svg.Lines[0].X2)
+	}
+	for _, rect := range svg.Rects {
+		if rect.X+svgNodeWidth > svg.Width || rect.Y+svgNodeHeight > svg.Height {
+			t.Errorf("box at %d,%d is outside the %dx%d diagram", rect.X, rect.Y, svg.Width, svg.Height)
+		}
+	}
+	for _, text := range []string{"Stack main - dev", "nonprod", "appservice/api (eastus2)", "projecta-E2D-app-api", "redis (westus2)", "projecta-W2D-redis"} {
+		found := false
+		for _, got := range svg.Texts {
+			found = found || got == text
+		}
+		if !found {
+			t.Errorf("main_dev.svg texts %q don't include %q", svg.Texts, text)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, output.Dir(), "diagrams", "main_dev.dot")); !os.IsNotExist(err) {
+		t.Errorf("GenerateDiagram() wrote a DOT file without Graphviz: %v", err)
+	}
+}
+
+func TestSVGDiagramGraphviz(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake dot is a shell script")
+	}
+	dir := useProject(t)
+
+	// dot records its arguments and writes the -o file
+	bin := t.TempDir()
+	script := "#!/bin/sh\necho \"$@\" > \"" + filepath.Join(bin, "args") + "\"\necho '<svg/>' > \"$3\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "dot"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	if err := GenerateDiagram(Options{Format: "svg", Env: "dev"}); err != nil {
+		t.Fatalf("GenerateDiagram() unexpected error: %v", err)
+	}
+
+	args, err := os.ReadFile(filepath.Join(bin, "args"))
+	if err != nil {
+		t.Fatalf("GenerateDiagram() didn't run dot: %v", err)
+	}
+	// dot runs from the project root
+	want := "-Tsvg -o " + output.Path("diagrams", "main_dev.svg") + " " + output.Path("diagrams", "main_dev.dot")
+	if got := strings.TrimSpace(string(args)); got != want {
+		t.Errorf("dot arguments = %q, want %q", got, want)
+	}
+	if got := readDiagram(t, dir, "main_dev.svg"); got != "<svg/>\n" {
+		t.Errorf("main_dev.svg = %q, want the dot output", got)
+	}
+}
+
+// newPlantUMLServer serves rendered diagrams, answering requests with a body
+// of bad with a 400, and records the diagrams posted to it by path
+func newPlantUMLServer(t *testing.T, bad string) (*httptest.Server, map[string]string) {
+	t.Helper()
+
+	posted := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		posted[r.URL.Path] = string(body)
+		if bad != "" && strings.Contains(string(body), bad) {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		w.Write([]byte("rendered " + r.URL.Path))
+	}))
+	t.Cleanup(server.Close)
+	return server, posted
+}
+
+func TestRenderPlantUML(t *testing.T) {
+	dir := useProject(t)
+	server, posted := newPlantUMLServer(t, "")
+
+	// The server of tgs.yaml is used unless overridden
+	tgsYAML := testProject[".tgs/tgs.yaml"] + "diagrams:\n  plantuml_server: " + server.URL + "/plantuml/\n"
+	if err := os.WriteFile(filepath.Join(dir, ".tgs", "tgs.yaml"), []byte(tgsYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := GenerateDiagram(Options{Format: "plantuml", Render: "png", Env: "dev"}); err != nil {
+		t.Fatalf("GenerateDiagram() unexpected error: %v", err)
+	}
+	if got, want := posted["/plantuml/png"], readDiagram(t, dir, "main_dev.puml"); got != want {
+		t.Errorf("posted diagram = %q, want main_dev.puml %q", got, want)
+	}
+	if got := readDiagram(t, dir, "main_dev.png"); got != "rendered /plantuml/png" {
+		t.Errorf("main_dev.png = %q, want the rendered image", got)
+	}
+
+	if err := GenerateDiagram(Options{Format: "plantuml", Render: "svg", Server: server.URL, Env: "prod"}); err != nil {
+		t.Fatalf("GenerateDiagram() unexpected error: %v", err)
+	}
+	if got := readDiagram(t, dir, "main_prod.svg"); got != "rendered /svg" {
+		t.Errorf("main_prod.svg = %q, want the image rendered by the --server", got)
+	}
+}
+
+func TestRenderPlantUMLErrors(t *testing.T) {
+	dir := useProject(t)
+	server, _ := newPlantUMLServer(t, "@startuml")
+
+	err := GenerateDiagram(Options{Format: "plantuml", Render: "png", Server: server.URL, Env: "dev"})
+	if err == nil || !strings.Contains(err.Error(), "400 Bad Request") {
+		t.Errorf("GenerateDiagram() error = %v, want the status of the server", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, output.Dir(), "diagrams", "main_dev.png")); !os.IsNotExist(err) {
+		t.Errorf("GenerateDiagram() wrote the image of a failed render: %v", err)
+	}
+
+	testCases := []struct {
+		name        string
+		opts        Options
+		errContains string
+	}{
+		{name: "Unsupported render format", opts: Options{Format: "plantuml", Render: "pdf"}, errContains: "unsupported render format"},
+		{name: "Render without plantuml", opts: Options{Format: "mermaid", Render: "png"}, errContains: "requires the plantuml format"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := GenerateDiagram(tc.opts); err == nil || !strings.Contains(err.Error(), tc.errContains) {
+				t.Errorf("GenerateDiagram() error = %v, want error containing %q", err, tc.errContains)
+			}
+		})
+	}
+}
+
+func TestStructurizrWorkspace(t *testing.T) {
+	dir := useProject(t)
+
+	if err := GenerateDiagram(Options{Format: "structurizr"}); err != nil {
+		t.Fatalf("GenerateDiagram() unexpected error: %v", err)
+	}
+
+	want := []string{"data.dsl", "folder_structure_data.md", "folder_structure_main.md", "main.dsl"}
+	if got := diagramFiles(t, dir); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("GenerateDiagram() wrote %v, want %v", got, want)
+	}
+
+	wantDSL := `workspace "projecta" "Stack data, generated by tgs diagram" {
+
+  model {
+    nonprod = softwareSystem "nonprod" "Azure subscription nonprod" {
+      nonprod_eastus2_storage = container "storage (eastus2)" "" "azurerm_storage_account"
+    }
+
+    deploymentEnvironment "analytics" {
+      deploymentNode "nonprod" "Azure subscription" "Azure" {
+        deploymentNode "eastus2" "Azure region" "Azure" {
+          containerInstance nonprod_eastus2_storage
+        }
+      }
+    }
+  }
+
+  views {
+    container nonprod "nonprod_containers" {
+      include *
+      autoLayout lr
+    }
+    deployment * "analytics" "analytics_deployment" {
+      include *
+      autoLayout lr
+    }
+    theme default
+  }
+}
+`
+	if got := readDiagram(t, dir, "data.dsl"); got != wantDSL {
+		t.Errorf("data.dsl = %s, want %s", got, wantDSL)
+	}
+
+	// A system per subscription, a container per component and app, a
+	// relationship per dependency and a deployment per environment
+	dsl := readDiagram(t, dir, "main.dsl")
+	for _, line := range []string{
+		`nonprod = softwareSystem "nonprod" "Azure subscription nonprod" {`,
+		`prod = softwareSystem "prod" "Azure subscription prod" {`,
+		`prod_eastus2_appservice_api = container "appservice/api (eastus2)" "" "azurerm_linux_web_app"`,
+		`prod_westus2_redis = container "redis (westus2)" "" "azurerm_redis_cache"`,
+		`nonprod_eastus2_appservice_api -> nonprod_eastus2_redis "Depends on"`,
+		`prod_eastus2_appservice_api -> prod_eastus2_redis "Depends on"`,
+		`deploymentEnvironment "dev" {`,
+		`deploymentEnvironment "prod" {`,
+		`containerInstance prod_westus2_redis`,
+		`deployment * "dev" "dev_deployment" {`,
+	} {
+		if !strings.Contains(dsl, line) {
+			t.Errorf("main.dsl doesn't contain %q:\n%s", line, dsl)
+		}
+	}
+	if strings.Contains(dsl, "analytics") {
+		t.Errorf("main.dsl contains the analytics environment of the data stack:\n%s", dsl)
+	}
+}
+
+func TestStructurizrQuoting(t *testing.T) {
+	testCases := []struct {
+		fn    func(string) string
+		value string
+		want  string
+	}{
+		{fn: identifier, value: "eastus2.appservice.api", want: "eastus2_appservice_api"},
+		{fn: identifier, value: "rg-app/web", want: "rg_app_web"},
+		{fn: dslString, value: "plain", want: `"plain"`},
+		{fn: dslString, value: `say "hi"`, want: `"say 'hi'"`},
+	}
+	for _, tc := range testCases {
+		if got := tc.fn(tc.value); got != tc.want {
+			t.Errorf("quoting %q = %s, want %s", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestPipelineDiagrams(t *testing.T) {
+	dir := useProject(t)
+
+	if err := GenerateDiagram(Options{Pipelines: true}); err != nil {
+		t.Fatalf("GenerateDiagram() unexpected error: %v", err)
+	}
+
+	want := []string{"pipeline_analytics.md", "pipeline_dev.md", "pipeline_prod.md"}
+	if got := diagramFiles(t, dir); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("GenerateDiagram() wrote %v, want %v", got, want)
+	}
+
+	wantDev := "# Pipeline Stages - dev\n\n" +
+		"Stages of the dev deployment pipeline. A stage starts once the stages pointing to it succeeded.\n\n" +
+		"```mermaid\n" +
+		`graph LR
+  subgraph nonprod [nonprod]
+    nonprod_DetectChanges["DetectChanges"]
+    nonprod_eastus2_appservice_api["eastus2_appservice_api"]
+    nonprod_eastus2_redis["eastus2_redis"]
+    nonprod_westus2_redis["westus2_redis"]
+    nonprod_eastus2_redis --> nonprod_eastus2_appservice_api
+    nonprod_DetectChanges --> nonprod_eastus2_redis
+    nonprod_DetectChanges --> nonprod_westus2_redis
+  end
+` + "```\n"
+	if got := readDiagram(t, dir, "pipeline_dev.md"); got != wantDev {
+		t.Errorf("pipeline_dev.md = %s, want %s", got, wantDev)
+	}
+}
+
+func TestPipelineDiagramFilters(t *testing.T) {
+	dir := useProject(t)
+
+	if err := GenerateDiagram(Options{Pipelines: true, Env: "dev", Region: "westus2"}); err != nil {
+		t.Fatalf("GenerateDiagram() unexpected error: %v", err)
+	}
+	if got := diagramFiles(t, dir); strings.Join(got, " ") != "pipeline_dev.md" {
+		t.Errorf("GenerateDiagram() wrote %v, want only pipeline_dev.md", got)
+	}
+	diagram := readDiagram(t, dir, "pipeline_dev.md")
+	if !strings.Contains(diagram, "nonprod_DetectChanges --> nonprod_westus2_redis") || strings.Contains(diagram, "eastus2") {
+		t.Errorf("pipeline_dev.md should only have the westus2 stages:\n%s", diagram)
+	}
+
+	testCases := []struct {
+		name        string
+		opts        Options
+		errContains string
+	}{
+		{name: "Region without components", opts: Options{Pipelines: true, Env: "analytics", Region: "westus2"}, errContains: "no environment matches"},
+		{name: "Unknown environment", opts: Options{Pipelines: true, Env: "staging"}, errContains: "no environment matches"},
+		{name: "Other format", opts: Options{Pipelines: true, Format: "dot"}, errContains: "only generated in the mermaid format"},
+		{name: "Stack filter", opts: Options{Pipelines: true, Stack: "main"}, errContains: "only generated in the mermaid format"},
+		{name: "Overview", opts: Options{Pipelines: true, Overview: true}, errContains: "only generated in the mermaid format"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := GenerateDiagram(tc.opts); err == nil || !strings.Contains(err.Error(), tc.errContains) {
+				t.Errorf("GenerateDiagram() error = %v, want error containing %q", err, tc.errContains)
+			}
+		})
+	}
+}
+
+func TestFilterEnvironments(t *testing.T) {
+	tgsConfig := &config.TGSConfig{Subscriptions: map[string]config.Subscription{
+		"nonprod": {Environments: []config.Environment{{Name: "dev"}, {Name: "analytics", Stack: "data"}}},
+		"prod":    {Environments: []config.Environment{{Name: "prod", Stack: "main"}}},
+	}}
+
+	testCases := []struct {
+		name  string
+		stack string
+		env   string
+		want  map[string][]string
+	}{
+		{name: "No filters", want: map[string][]string{"nonprod": {"dev", "analytics"}, "prod": {"prod"}}},
+		{name: "Default stack", stack: "main", want: map[string][]string{"nonprod": {"dev"}, "prod": {"prod"}}},
+		{name: "Stack", stack: "data", want: map[string][]string{"nonprod": {"analytics"}}},
+		{name: "Environment", env: "prod", want: map[string][]string{"prod": {"prod"}}},
+		{name: "Stack and environment", stack: "main", env: "dev", want: map[string][]string{"nonprod": {"dev"}}},
+		{name: "Environment of another stack", stack: "main", env: "analytics", want: map[string][]string{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filtered := filterEnvironments(tgsConfig, tc.stack, tc.env)
+			got := make(map[string][]string)
+			for name, sub := range filtered.Subscriptions {
+				for _, env := range sub.Environments {
+					got[name] = append(got[name], env.Name)
+				}
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("filterEnvironments(%q, %q) = %v, want %v", tc.stack, tc.env, got, tc.want)
+			}
+		})
+	}
+	if len(tgsConfig.Subscriptions["nonprod"].Environments) != 2 {
+		t.Errorf("filterEnvironments() modified the config: %v", tgsConfig.Subscriptions)
+	}
+}
+
+func TestGenerateDiagramFilters(t *testing.T) {
+	testCases := []struct {
+		name  string
+		opts  Options
+		files []string
+	}{
+		{name: "No filters", files: []string{"data_analytics.md", "folder_structure_data.md", "folder_structure_main.md", "main_dev.md", "main_prod.md"}},
+		{name: "Stack", opts: Options{Stack: "data"}, files: []string{"data_analytics.md", "folder_structure_data.md"}},
+		{name: "Environment", opts: Options{Env: "prod"}, files: []string{"folder_structure_main.md", "main_prod.md"}},
+		{name: "Region", opts: Options{Region: "westus2"}, files: []string{"folder_structure_data.md", "folder_structure_main.md", "main_dev.md", "main_prod.md"}},
+		{name: "Overview", opts: Options{Overview: true}, files: []string{"data_overview.md", "folder_structure_data.md", "folder_structure_main.md", "main_overview.md"}},
+		{name: "Overview of a stack", opts: Options{Overview: true, Format: "dot", Stack: "main"}, files: []string{"folder_structure_main.md", "main_overview.dot"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := useProject(t)
+			if err := GenerateDiagram(tc.opts); err != nil {
+				t.Fatalf("GenerateDiagram() unexpected error: %v", err)
+			}
+			if got := diagramFiles(t, dir); !reflect.DeepEqual(got, tc.files) {
+				t.Errorf("GenerateDiagram(%+v) wrote %v, want %v", tc.opts, got, tc.files)
+			}
+		})
+	}
+
+	// The region filter drops the components of other regions
+	dir := useProject(t)
+	if err := GenerateDiagram(Options{Format: "dot", Env: "dev", Region: "westus2"}); err != nil {
+		t.Fatalf("GenerateDiagram() unexpected error: %v", err)
+	}
+	if diagram := readDiagram(t, dir, "main_dev.dot"); !strings.Contains(diagram, `"nonprod.westus2.redis"`) || strings.Contains(diagram, "eastus2") {
+		t.Errorf("main_dev.dot should only have the westus2 components:\n%s", diagram)
+	}
+}
+
+func TestOverviewDiagram(t *testing.T) {
+	dir := useProject(t)
+
+	if err := GenerateDiagram(Options{Overview: true, Format: "dot", Region: "westus2"}); err != nil {
+		t.Fatalf("GenerateDiagram() unexpected error: %v", err)
+	}
+
+	// Every environment of the stack is a cluster of the diagram
+	want := `digraph "main_overview" {
+  rankdir=LR;
+  label="Stack main - all environments";
+  labelloc=t;
+  node [shape=box, style="rounded,filled", fillcolor="#0072C6", fontcolor=white, fontname=Helvetica];
+
+  subgraph "cluster_nonprod.dev" {
+    label="nonprod / dev";
+    subgraph "cluster_nonprod.dev.westus2" {
+      label="westus2";
+      "nonprod.dev.westus2.redis" [label="redis\nprojecta-W2D-redis"];
+    }
+  }
+
+  subgraph "cluster_prod.prod" {
+    label="prod / prod";
+    subgraph "cluster_prod.prod.westus2" {
+      label="westus2";
+      "prod.prod.westus2.redis" [label="redis\nprojecta-W2P-redis"];
+    }
+  }
+
+}
+`
+	if got := readDiagram(t, dir, "main_overview.dot"); got != want {
+		t.Errorf("main_overview.dot = %s, want %s", got, want)
+	}
+}
+
+func TestGenerateDiagramFilterErrors(t *testing.T) {
+	useProject(t)
+
+	testCases := []struct {
+		name        string
+		opts        Options
+		errContains string
+	}{
+		{name: "Unknown environment", opts: Options{Env: "staging"}, errContains: "no environment matches"},
+		{name: "Environment of another stack", opts: Options{Stack: "data", Env: "dev"}, errContains: "no environment matches"},
+		{name: "Unknown region", opts: Options{Region: "centralus"}, errContains: `region "centralus" is not in the architecture`},
+		{name: "Region of another stack", opts: Options{Stack: "data", Region: "westus2"}, errContains: `region "westus2" is not in the architecture`},
+		{name: "Overview format", opts: Options{Overview: true, Format: "plantuml"}, errContains: "only generated in the mermaid and dot formats"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := GenerateDiagram(tc.opts); err == nil || !strings.Contains(err.Error(), tc.errContains) {
+				t.Errorf("GenerateDiagram() error = %v, want error containing %q", err, tc.errContains)
+			}
+		})
+	}
+}
+
+func TestGenerateDiagramFormat(t *testing.T) {
+	useProject(t)
+
+	if err := GenerateDiagram(Options{Format: "drawio"}); err == nil || !strings.Contains(err.Error(), "unsupported format") {
+		t.Errorf("GenerateDiagram() error = %v, want an unsupported format error", err)
+	}
+}
@@ -0,0 +1,225 @@
+package diagram
+
+import (
+	"fmt"
+	"html"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/graph"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/naming"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+)
+
+// Box sizes of the SVG layout used without Graphviz
+const (
+	svgNodeWidth  = 220
+	svgNodeHeight = 50
+	svgColumnGap  = 80
+	svgRowGap     = 24
+	svgMargin     = 20
+	svgTitle      = 30
+)
+
+// generateDOTDiagram writes the Graphviz diagram of a stack and environment to
+// <stack>_<env>.dot, returning its path
+func generateDOTDiagram(stackName string, tgsConfig *config.TGSConfig, mainConfig *config.MainConfig, envName string) (string, error) {
+	outputPath := output.Path("diagrams", fmt.Sprintf("%s_%s.dot", stackName, envName))
+	if err := writeFile(outputPath, dotDiagram(stackName, tgsConfig, mainConfig, envName)); err != nil {
+		return "", fmt.Errorf("failed to write diagram file: %w", err)
+	}
+	return outputPath, nil
+}
+
+// generateSVGDiagram writes the diagram of a stack and environment to
+// <stack>_<env>.svg. It's rendered by Graphviz from the DOT diagram when dot
+// is on the PATH, and laid out by deployment wave otherwise.
+func generateSVGDiagram(stackName string, tgsConfig *config.TGSConfig, mainConfig *config.MainConfig, envName string) error {
+	outputPath := output.Path("diagrams", fmt.Sprintf("%s_%s.svg", stackName, envName))
+
+	if _, err := exec.LookPath("dot"); err == nil {
+		dotPath, err := generateDOTDiagram(stackName, tgsConfig, mainConfig, envName)
+		if err != nil {
+			return err
+		}
+		if out, err := project.Command("dot", "-Tsvg", "-o", outputPath, dotPath).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to render %s with dot: %w: %s", dotPath, err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+
+	logger.Info("Graphviz dot not found, laying out %s by deployment wave", outputPath)
+	svg, err := svgDiagram(stackName, tgsConfig, mainConfig, envName)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(outputPath, svg); err != nil {
+		return fmt.Errorf("failed to write diagram file: %w", err)
+	}
+	return nil
+}
+
+// dotDiagram renders the components and apps of a stack deployed to an
+// environment in DOT, clustered by subscription and region and labelled with
+// their resource names. Edges point from a component to its dependencies.
+func dotDiagram(stackName string, tgsConfig *config.TGSConfig, mainConfig *config.MainConfig, envName string) string {
+	g := graph.Build(mainConfig)
+	names := resourceNames(tgsConfig, stackName, mainConfig, envName)
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("digraph %q {\n", stackName+"_"+envName))
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString(fmt.Sprintf("  label=%q;\n", fmt.Sprintf("Stack %s - %s", stackName, envName)))
+	b.WriteString("  labelloc=t;\n")
+	b.WriteString("  node [shape=box, style=\"rounded,filled\", fillcolor=\"#0072C6\", fontcolor=white, fontname=Helvetica];\n\n")
+
+	for _, sub := range environmentSubscriptions(tgsConfig, stackName, envName) {
+		b.WriteString(fmt.Sprintf("  subgraph %q {\n", "cluster_"+sub))
+		b.WriteString(fmt.Sprintf("    label=%q;\n", sub))
+		for _, region := range regionsOf(g) {
+			b.WriteString(fmt.Sprintf("    subgraph %q {\n", "cluster_"+sub+"_"+region))
+			b.WriteString(fmt.Sprintf("      label=%q;\n", region))
+			for _, id := range g.NodeIDs() {
+				node := g.Nodes[id]
+				if node.Region != region {
+					continue
+				}
+				b.WriteString(fmt.Sprintf("      %q [label=%q];\n", sub+"."+id, nodeLabel(node)+"\n"+names[sub+"/"+id]))
+			}
+			b.WriteString("    }\n")
+		}
+		b.WriteString("  }\n\n")
+
+		for _, id := range g.NodeIDs() {
+			for _, dep := range g.Edges[id] {
+				b.WriteString(fmt.Sprintf("  %q -> %q;\n", sub+"."+id, sub+"."+dep))
+			}
+		}
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// svgDiagram lays out the diagram of dotDiagram without Graphviz: a column
+// per deployment wave and a band per subscription, with straight arrows from
+// a component to its dependencies
+func svgDiagram(stackName string, tgsConfig *config.TGSConfig, mainConfig *config.MainConfig, envName string) (string, error) {
+	g := graph.Build(mainConfig)
+	waves, err := g.Waves()
+	if err != nil {
+		return "", fmt.Errorf("failed to lay out diagram: %w", err)
+	}
+	names := resourceNames(tgsConfig, stackName, mainConfig, envName)
+	subs := environmentSubscriptions(tgsConfig, stackName, envName)
+
+	rows := 0
+	column := make(map[string]int)
+	row := make(map[string]int)
+	for i, wave := range waves {
+		for j, id := range wave {
+			column[id], row[id] = i, j
+		}
+		if len(wave) > rows {
+			rows = len(wave)
+		}
+	}
+	bandHeight := svgTitle + rows*(svgNodeHeight+svgRowGap)
+	width := 2*svgMargin + len(waves)*svgNodeWidth + (len(waves)-1)*svgColumnGap
+	height := 2*svgMargin + svgTitle + len(subs)*bandHeight
+	if width < 2*svgMargin+svgNodeWidth {
+		width = 2*svgMargin + svgNodeWidth
+	}
+
+	position := func(band int, id string) (int, int) {
+		x := svgMargin + column[id]*(svgNodeWidth+svgColumnGap)
+		y := svgMargin + svgTitle + band*bandHeight + svgTitle + row[id]*(svgNodeHeight+svgRowGap)
+		return x, y
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\" font-family=\"Helvetica, Arial, sans-serif\" font-size=\"12\">\n", width, height, width, height))
+	b.WriteString("  <defs><marker id=\"arrow\" markerWidth=\"10\" markerHeight=\"7\" refX=\"10\" refY=\"3.5\" orient=\"auto\"><polygon points=\"0 0, 10 3.5, 0 7\" fill=\"#555\"/></marker></defs>\n")
+	b.WriteString(fmt.Sprintf("  <text x=\"%d\" y=\"%d\" font-size=\"16\" font-weight=\"bold\">%s</text>\n", svgMargin, svgMargin+16, html.EscapeString(fmt.Sprintf("Stack %s - %s", stackName, envName))))
+
+	for band, sub := range subs {
+		top := svgMargin + svgTitle + band*bandHeight
+		b.WriteString(fmt.Sprintf("  <text x=\"%d\" y=\"%d\" font-size=\"14\" font-weight=\"bold\">%s</text>\n", svgMargin, top+18, html.EscapeString(sub)))
+
+		for _, id := range g.NodeIDs() {
+			x, y := position(band, id)
+			for _, dep := range g.Edges[id] {
+				depX, depY := position(band, dep)
+				b.WriteString(fmt.Sprintf("  <line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"#555\" marker-end=\"url(#arrow)\"/>\n", x, y+svgNodeHeight/2, depX+svgNodeWidth, depY+svgNodeHeight/2))
+			}
+		}
+		for _, id := range g.NodeIDs() {
+			x, y := position(band, id)
+			node := g.Nodes[id]
+			b.WriteString(fmt.Sprintf("  <rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" rx=\"6\" fill=\"#0072C6\"/>\n", x, y, svgNodeWidth, svgNodeHeight))
+			b.WriteString(fmt.Sprintf("  <text x=\"%d\" y=\"%d\" fill=\"white\" text-anchor=\"middle\">%s</text>\n", x+svgNodeWidth/2, y+20, html.EscapeString(nodeLabel(node)+" ("+node.Region+")")))
+			b.WriteString(fmt.Sprintf("  <text x=\"%d\" y=\"%d\" fill=\"white\" text-anchor=\"middle\" font-size=\"11\">%s</text>\n", x+svgNodeWidth/2, y+38, html.EscapeString(names[sub+"/"+id])))
+		}
+	}
+
+	b.WriteString("</svg>\n")
+	return b.String(), nil
+}
+
+// resourceNames maps <subscription>/<node ID> to the resource name of the
+// components and apps deployed to an environment
+func resourceNames(tgsConfig *config.TGSConfig, stackName string, mainConfig *config.MainConfig, envName string) map[string]string {
+	names := make(map[string]string)
+	for _, entry := range naming.Resolved(tgsConfig, stackName, mainConfig) {
+		if entry.Environment == envName {
+			names[entry.Subscription+"/"+graph.NodeID(entry.Region, entry.Component, entry.App)] = entry.Name
+		}
+	}
+	return names
+}
+
+// environmentSubscriptions returns the sorted subscriptions deploying a stack
+// to an environment
+func environmentSubscriptions(tgsConfig *config.TGSConfig, stackName, envName string) []string {
+	var subs []string
+	for name, sub := range tgsConfig.Subscriptions {
+		for _, env := range sub.Environments {
+			envStack := env.Stack
+			if envStack == "" {
+				envStack = "main"
+			}
+			if env.Name == envName && envStack == stackName {
+				subs = append(subs, name)
+				break
+			}
+		}
+	}
+	sort.Strings(subs)
+	return subs
+}
+
+// regionsOf returns the sorted regions of the nodes of a graph
+func regionsOf(g *graph.Graph) []string {
+	seen := make(map[string]bool)
+	var regions []string
+	for _, node := range g.Nodes {
+		if !seen[node.Region] {
+			seen[node.Region] = true
+			regions = append(regions, node.Region)
+		}
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// nodeLabel returns the component, or component/app, of a node
+func nodeLabel(node *graph.Node) string {
+	if node.App != "" {
+		return node.Component + "/" + node.App
+	}
+	return node.Component
+}
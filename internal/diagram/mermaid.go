@@ -2,12 +2,13 @@ package diagram
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
 	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
 )
 
 // Azure resource type to Mermaid icon mapping
@@ -60,16 +61,11 @@ func nodeID(component, sub, region, env, app string) string {
 	return fmt.Sprintf("%s_%s_%s_%s", id, abbr(sub), abbr(region), abbr(env))
 }
 
-func generateMermaidDiagram(stackName string, tgsConfig *config.TGSConfig, envName string) error {
+func generateMermaidDiagram(stackName string, tgsConfig *config.TGSConfig, mainConfig *config.MainConfig, envName string) error {
 	logger.Info("Generating Mermaid diagram for stack %s, environment %s", stackName, envName)
 
-	mainConfig, err := readStackConfig(stackName)
-	if err != nil {
-		return fmt.Errorf("failed to read stack config: %w", err)
-	}
-
-	outputDir := filepath.Join(".infrastructure", "diagrams")
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
+	outputDir := output.Path("diagrams")
+	if err := project.MkdirAll(outputDir, 0755); err != nil {
 		return fmt.Errorf("failed to create diagrams directory: %w", err)
 	}
 
@@ -158,6 +154,11 @@ func generateMermaidDiagram(stackName string, tgsConfig *config.TGSConfig, envNa
 		diagram.WriteString("  end\n\n")
 	}
 
+	// Link regions to the regions they fail over to
+	for _, region := range pairedRegions(mainConfig) {
+		diagram.WriteString(fmt.Sprintf("  %s_%s -.->|fails over to| %s_%s\n", region, envName, mainConfig.Stack.Architecture.PairedRegions[region], envName))
+	}
+
 	diagram.WriteString("\nclassDef azure fill:#0072C6,stroke:#0072C6,color:white\n\n")
 	diagram.WriteString("```\n")
 
@@ -197,10 +198,7 @@ func generateMermaidDiagram(stackName string, tgsConfig *config.TGSConfig, envNa
 				for _, dep := range n.deps {
 					parts := strings.Split(dep, ".")
 					if len(parts) >= 2 {
-						depRegion := parts[0]
-						if depRegion == "{region}" {
-							depRegion = n.region
-						}
+						depRegion := config.DependencyRegion(parts[0], n.region, mainConfig.Stack.Architecture.PairedRegions[n.region])
 						depComp := parts[1]
 						depApp := ""
 						if len(parts) > 2 {
@@ -248,10 +246,7 @@ func generateMermaidDiagram(stackName string, tgsConfig *config.TGSConfig, envNa
 		for _, dep := range n.deps {
 			parts := strings.Split(dep, ".")
 			if len(parts) >= 2 {
-				depRegion := parts[0]
-				if depRegion == "{region}" {
-					depRegion = n.region
-				}
+				depRegion := config.DependencyRegion(parts[0], n.region, mainConfig.Stack.Architecture.PairedRegions[n.region])
 				depComp := parts[1]
 				depApp := ""
 				if len(parts) > 2 {
@@ -328,10 +323,7 @@ func generateMermaidDiagram(stackName string, tgsConfig *config.TGSConfig, envNa
 				for _, dep := range n.deps {
 					parts := strings.Split(dep, ".")
 					if len(parts) >= 2 {
-						depRegion := parts[0]
-						if depRegion == "{region}" {
-							depRegion = n.region
-						}
+						depRegion := config.DependencyRegion(parts[0], n.region, mainConfig.Stack.Architecture.PairedRegions[n.region])
 						depComp := parts[1]
 						depApp := ""
 						if len(parts) > 2 {
@@ -375,7 +367,7 @@ func generateMermaidDiagram(stackName string, tgsConfig *config.TGSConfig, envNa
 	}
 
 	outputPath := filepath.Join(outputDir, fmt.Sprintf("%s_%s.md", stackName, envName))
-	if err := os.WriteFile(outputPath, []byte(diagram.String()), 0644); err != nil {
+	if err := project.WriteFile(outputPath, []byte(diagram.String()), 0644); err != nil {
 		return fmt.Errorf("failed to write diagram file: %w", err)
 	}
 
@@ -0,0 +1,130 @@
+package diagram
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/graph"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+)
+
+// generateOverviewDiagram writes the diagram of a stack covering all its
+// environments to <stack>_overview.md in the mermaid format, or
+// <stack>_overview.dot in the dot format
+func generateOverviewDiagram(stackName string, tgsConfig *config.TGSConfig, mainConfig *config.MainConfig, format string) error {
+	var content, outputPath string
+	if format == "dot" {
+		content = overviewDOT(stackName, tgsConfig, mainConfig)
+		outputPath = output.Path("diagrams", stackName+"_overview.dot")
+	} else {
+		content = overviewMermaid(stackName, tgsConfig, mainConfig)
+		outputPath = output.Path("diagrams", stackName+"_overview.md")
+	}
+	if err := writeFile(outputPath, content); err != nil {
+		return fmt.Errorf("failed to write diagram file: %w", err)
+	}
+	return nil
+}
+
+// stackEnvironment is an environment of a subscription deploying a stack
+type stackEnvironment struct {
+	sub, env string
+}
+
+// stackEnvironments returns the environments deploying a stack, sorted by
+// subscription and in the order of tgs.yaml within a subscription
+func stackEnvironments(tgsConfig *config.TGSConfig, stackName string) []stackEnvironment {
+	var subs []string
+	for name := range tgsConfig.Subscriptions {
+		subs = append(subs, name)
+	}
+	sort.Strings(subs)
+
+	var envs []stackEnvironment
+	for _, sub := range subs {
+		for _, env := range tgsConfig.Subscriptions[sub].Environments {
+			envStack := env.Stack
+			if envStack == "" {
+				envStack = "main"
+			}
+			if envStack == stackName {
+				envs = append(envs, stackEnvironment{sub, env.Name})
+			}
+		}
+	}
+	return envs
+}
+
+// overviewMermaid renders a stack as a Mermaid graph with a subgraph per
+// environment and region, labelling nodes with their resource names
+func overviewMermaid(stackName string, tgsConfig *config.TGSConfig, mainConfig *config.MainConfig) string {
+	g := graph.Build(mainConfig)
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("# Stack %s - All Environments\n\n", stackName))
+	b.WriteString("Components and apps of every environment of the stack. Arrows point from a component to the component it depends on.\n\n")
+	b.WriteString("```mermaid\ngraph LR\n")
+	for _, env := range stackEnvironments(tgsConfig, stackName) {
+		prefix := env.sub + "_" + env.env
+		names := resourceNames(tgsConfig, stackName, mainConfig, env.env)
+		b.WriteString(fmt.Sprintf("  subgraph %s [%s / %s]\n", identifier(prefix), env.sub, env.env))
+		for _, region := range regionsOf(g) {
+			b.WriteString(fmt.Sprintf("    subgraph %s [%s]\n", identifier(prefix+"_"+region), region))
+			for _, id := range g.NodeIDs() {
+				node := g.Nodes[id]
+				if node.Region == region {
+					b.WriteString(fmt.Sprintf("      %s[\"%s<br/>%s\"]\n", identifier(prefix+"_"+id), nodeLabel(node), names[env.sub+"/"+id]))
+				}
+			}
+			b.WriteString("    end\n")
+		}
+		b.WriteString("  end\n")
+		for _, id := range g.NodeIDs() {
+			for _, dep := range g.Edges[id] {
+				b.WriteString(fmt.Sprintf("  %s --> %s\n", identifier(prefix+"_"+id), identifier(prefix+"_"+dep)))
+			}
+		}
+	}
+	b.WriteString("```\n")
+	return b.String()
+}
+
+// overviewDOT renders a stack in DOT with a cluster per environment and
+// region, labelling nodes with their resource names
+func overviewDOT(stackName string, tgsConfig *config.TGSConfig, mainConfig *config.MainConfig) string {
+	g := graph.Build(mainConfig)
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("digraph %q {\n", stackName+"_overview"))
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString(fmt.Sprintf("  label=%q;\n", fmt.Sprintf("Stack %s - all environments", stackName)))
+	b.WriteString("  labelloc=t;\n")
+	b.WriteString("  node [shape=box, style=\"rounded,filled\", fillcolor=\"#0072C6\", fontcolor=white, fontname=Helvetica];\n\n")
+	for _, env := range stackEnvironments(tgsConfig, stackName) {
+		prefix := env.sub + "." + env.env
+		names := resourceNames(tgsConfig, stackName, mainConfig, env.env)
+		b.WriteString(fmt.Sprintf("  subgraph %q {\n", "cluster_"+prefix))
+		b.WriteString(fmt.Sprintf("    label=%q;\n", env.sub+" / "+env.env))
+		for _, region := range regionsOf(g) {
+			b.WriteString(fmt.Sprintf("    subgraph %q {\n", "cluster_"+prefix+"."+region))
+			b.WriteString(fmt.Sprintf("      label=%q;\n", region))
+			for _, id := range g.NodeIDs() {
+				node := g.Nodes[id]
+				if node.Region == region {
+					b.WriteString(fmt.Sprintf("      %q [label=%q];\n", prefix+"."+id, nodeLabel(node)+"\n"+names[env.sub+"/"+id]))
+				}
+			}
+			b.WriteString("    }\n")
+		}
+		b.WriteString("  }\n\n")
+		for _, id := range g.NodeIDs() {
+			for _, dep := range g.Edges[id] {
+				b.WriteString(fmt.Sprintf("  %q -> %q;\n", prefix+"."+id, prefix+"."+dep))
+			}
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,111 @@
+package diagram
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/pipeline"
+)
+
+// generatePipelineDiagrams writes the stage graph of the deployment pipeline
+// of every environment to pipeline_<env>.md, returning the environments. A
+// set envName or region restricts the diagrams to them.
+func generatePipelineDiagrams(envName, region string) ([]string, error) {
+	envComponents, err := pipeline.AnalyzeInfrastructure()
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze infrastructure: %w", err)
+	}
+
+	var envNames []string
+	for name, components := range envComponents {
+		if envName != "" && name != envName {
+			continue
+		}
+		if region != "" {
+			var kept []pipeline.Component
+			for _, comp := range components {
+				if comp.Region == region {
+					kept = append(kept, comp)
+				}
+			}
+			if len(kept) == 0 {
+				continue
+			}
+			envComponents[name] = kept
+		}
+		envNames = append(envNames, name)
+	}
+	if len(envNames) == 0 {
+		return nil, fmt.Errorf("no environment matches the environment and region filters")
+	}
+	sort.Strings(envNames)
+
+	for _, envName := range envNames {
+		outputPath := output.Path("diagrams", fmt.Sprintf("pipeline_%s.md", envName))
+		if err := writeFile(outputPath, pipelineDiagram(envName, envComponents[envName])); err != nil {
+			return nil, fmt.Errorf("failed to write diagram file: %w", err)
+		}
+	}
+	return envNames, nil
+}
+
+// pipelineDiagram renders the stages BuildDependencyChain derives for the
+// components of an environment as a Mermaid graph, with a subgraph per
+// subscription. Arrows point in deployment order, from the change detection
+// stage every stage waits for to the stages depending on a stage.
+func pipelineDiagram(envName string, components []pipeline.Component) string {
+	bySub := make(map[string][]pipeline.Component)
+	var subs []string
+	for _, comp := range components {
+		if bySub[comp.Sub] == nil {
+			subs = append(subs, comp.Sub)
+		}
+		bySub[comp.Sub] = append(bySub[comp.Sub], comp)
+	}
+	sort.Strings(subs)
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("# Pipeline Stages - %s\n\n", envName))
+	b.WriteString(fmt.Sprintf("Stages of the %s deployment pipeline. A stage starts once the stages pointing to it succeeded.\n\n", envName))
+	b.WriteString("```mermaid\ngraph LR\n")
+	for _, sub := range subs {
+		stages := pipeline.BuildDependencyChain(bySub[sub])
+		sort.Slice(stages, func(i, j int) bool { return stages[i].Name < stages[j].Name })
+
+		detect := identifier(sub + "_DetectChanges")
+		b.WriteString(fmt.Sprintf("  subgraph %s [%s]\n", identifier(sub), sub))
+		b.WriteString(fmt.Sprintf("    %s[\"DetectChanges\"]\n", detect))
+		for _, stage := range stages {
+			b.WriteString(fmt.Sprintf("    %s[\"%s\"]\n", identifier(sub+"_"+stage.Name), stage.Name))
+		}
+		for _, stage := range stages {
+			id := identifier(sub + "_" + stage.Name)
+			deps := uniqueSorted(stage.DependsOn)
+			if len(deps) == 0 {
+				b.WriteString(fmt.Sprintf("    %s --> %s\n", detect, id))
+			}
+			for _, dep := range deps {
+				b.WriteString(fmt.Sprintf("    %s --> %s\n", identifier(sub+"_"+dep), id))
+			}
+		}
+		b.WriteString("  end\n")
+	}
+	b.WriteString("```\n")
+	return b.String()
+}
+
+// uniqueSorted returns the distinct values, sorted
+func uniqueSorted(values []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
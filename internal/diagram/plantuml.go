@@ -2,13 +2,14 @@ package diagram
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
 	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
-	"github.com/davoodharun/terragrunt-scaffolder/internal/scaffold"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/naming"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
 )
 
 // Azure resource type to PlantUML sprite mapping
@@ -30,14 +31,10 @@ var azureSprites = map[string]string{
 }
 
 // generatePlantUMLDiagram generates a PlantUML diagram for a specific stack and environment
-func generatePlantUMLDiagram(stackName string, tgsConfig *config.TGSConfig, envName string) error {
+func generatePlantUMLDiagram(stackName string, tgsConfig *config.TGSConfig, mainConfig *config.MainConfig, envName string) error {
 	logger.Info("Generating PlantUML diagram for stack: %s, environment: %s", stackName, envName)
 
-	// Read stack config
-	mainConfig, err := readStackConfig(stackName)
-	if err != nil {
-		return fmt.Errorf("failed to read stack config: %w", err)
-	}
+	prefixes := naming.NewPrefixes(tgsConfig.Prefixes)
 
 	// Start building the PlantUML diagram
 	var diagram strings.Builder
@@ -149,8 +146,8 @@ func generatePlantUMLDiagram(stackName string, tgsConfig *config.TGSConfig, envN
 				diagram.WriteString(fmt.Sprintf("    Provider Version: %s\n", component.Version))
 
 				// Get region and environment prefixes for example
-				regionPrefix := getRegionPrefix(res.region)
-				envPrefix := getEnvironmentPrefix(envName)
+				regionPrefix := prefixes.Region(res.region)
+				envPrefix := prefixes.Environment(envName)
 
 				if res.app != "" {
 					// Resource with app
@@ -182,18 +179,13 @@ func generatePlantUMLDiagram(stackName string, tgsConfig *config.TGSConfig, envN
 		for _, dep := range res.deps {
 			parts := strings.Split(dep, ".")
 			if len(parts) >= 2 {
-				depRegion := parts[0]
+				depRegion := config.DependencyRegion(parts[0], res.region, mainConfig.Stack.Architecture.PairedRegions[res.region])
 				depComp := parts[1]
 				depApp := ""
 				if len(parts) > 2 {
 					depApp = parts[2]
 				}
 
-				// Handle {region} placeholder
-				if depRegion == "{region}" {
-					depRegion = res.region
-				}
-
 				// Construct the dependency key
 				var depKey string
 				if depApp != "" && depApp != "{app}" {
@@ -218,17 +210,22 @@ func generatePlantUMLDiagram(stackName string, tgsConfig *config.TGSConfig, envN
 		}
 	}
 
+	// Link regions to the regions they fail over to
+	for _, region := range pairedRegions(mainConfig) {
+		diagram.WriteString(fmt.Sprintf("  %s ..> %s : fails over to\n", region, mainConfig.Stack.Architecture.PairedRegions[region]))
+	}
+
 	// End the diagram
 	diagram.WriteString("\n@enduml\n")
 
-	// Write the diagram to a file in the .infrastructure/diagrams directory
-	outputDir := filepath.Join(".infrastructure", "diagrams")
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
+	// Write the diagram to a file in the diagrams directory of the output
+	outputDir := output.Path("diagrams")
+	if err := project.MkdirAll(outputDir, 0755); err != nil {
 		return fmt.Errorf("failed to create diagrams directory: %w", err)
 	}
 
 	outputPath := filepath.Join(outputDir, fmt.Sprintf("%s_%s.puml", stackName, envName))
-	if err := os.WriteFile(outputPath, []byte(diagram.String()), 0644); err != nil {
+	if err := project.WriteFile(outputPath, []byte(diagram.String()), 0644); err != nil {
 		return fmt.Errorf("failed to write diagram file: %w", err)
 	}
 
@@ -236,28 +233,6 @@ func generatePlantUMLDiagram(stackName string, tgsConfig *config.TGSConfig, envN
 	return nil
 }
 
-// Helper function to get region prefix
-func getRegionPrefix(region string) string {
-	return scaffold.GetRegionPrefix(region)
-}
-
-// Helper function to get environment prefix
-func getEnvironmentPrefix(env string) string {
-	envPrefixMap := map[string]string{
-		"dev":   "D",
-		"test":  "T",
-		"stage": "S",
-		"prod":  "P",
-		"qa":    "Q",
-		"uat":   "U",
-	}
-
-	if prefix, ok := envPrefixMap[env]; ok {
-		return prefix
-	}
-	return strings.ToUpper(env[0:1])
-}
-
 // Helper function to get resource type abbreviation
 func getResourceTypeAbbreviation(resourceType string) string {
 	resourceAbbreviations := map[string]string{
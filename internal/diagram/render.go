@@ -0,0 +1,48 @@
+package diagram
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+)
+
+// httpClient posts diagrams to the PlantUML server
+var httpClient = &http.Client{Timeout: 60 * time.Second}
+
+// renderPlantUML posts a PlantUML diagram to the server and writes the image
+// rendered in format, png or svg, next to it
+func renderPlantUML(server, pumlPath, format string) error {
+	source, err := project.ReadFile(pumlPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", pumlPath, err)
+	}
+
+	target := strings.TrimSuffix(server, "/") + "/" + format
+	resp, err := httpClient.Post(target, "text/plain; charset=utf-8", bytes.NewReader(source))
+	if err != nil {
+		return fmt.Errorf("failed to render %s with %s: %w", pumlPath, server, err)
+	}
+	defer resp.Body.Close()
+
+	image, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read rendered %s: %w", pumlPath, err)
+	}
+	// The server answers syntax errors with an image of the error and a 400
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to render %s with %s: %s", pumlPath, server, resp.Status)
+	}
+
+	imagePath := strings.TrimSuffix(pumlPath, ".puml") + "." + format
+	if err := project.WriteFile(imagePath, image, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", imagePath, err)
+	}
+	logger.Info("Rendered diagram at: %s", imagePath)
+	return nil
+}
@@ -0,0 +1,123 @@
+package diagram
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/graph"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+)
+
+// generateStructurizrWorkspace writes the C4 model of a stack as a Structurizr
+// DSL workspace to <stack>.dsl
+func generateStructurizrWorkspace(stackName string, tgsConfig *config.TGSConfig, mainConfig *config.MainConfig) error {
+	outputPath := output.Path("diagrams", stackName+".dsl")
+	if err := writeFile(outputPath, structurizrWorkspace(stackName, tgsConfig, mainConfig)); err != nil {
+		return fmt.Errorf("failed to write diagram file: %w", err)
+	}
+	return nil
+}
+
+// structurizrWorkspace renders a stack in Structurizr DSL: a software system
+// per subscription deploying the stack, holding a container per component and
+// app instance with a relationship per dependency, and a deployment
+// environment per tgs environment with its regions as deployment nodes
+func structurizrWorkspace(stackName string, tgsConfig *config.TGSConfig, mainConfig *config.MainConfig) string {
+	g := graph.Build(mainConfig)
+	ids := g.NodeIDs()
+	regions := regionsOf(g)
+
+	// Environments deployed by several subscriptions get a deployment node
+	// per subscription
+	var subs, envNames []string
+	envSubs := make(map[string][]string)
+	for name, sub := range tgsConfig.Subscriptions {
+		deploys := false
+		for _, env := range sub.Environments {
+			envStack := env.Stack
+			if envStack == "" {
+				envStack = "main"
+			}
+			if envStack == stackName {
+				deploys = true
+				if envSubs[env.Name] == nil {
+					envNames = append(envNames, env.Name)
+				}
+				envSubs[env.Name] = append(envSubs[env.Name], name)
+			}
+		}
+		if deploys {
+			subs = append(subs, name)
+		}
+	}
+	sort.Strings(subs)
+	sort.Strings(envNames)
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("workspace %s %s {\n\n", dslString(tgsConfig.Name), dslString("Stack "+stackName+", generated by tgs diagram")))
+	b.WriteString("  model {\n")
+	for _, sub := range subs {
+		b.WriteString(fmt.Sprintf("    %s = softwareSystem %s %s {\n", identifier(sub), dslString(sub), dslString("Azure subscription "+sub)))
+		for _, id := range ids {
+			node := g.Nodes[id]
+			comp := mainConfig.Stack.Components[node.Component]
+			b.WriteString(fmt.Sprintf("      %s = container %s %s %s\n", identifier(sub+"."+id), dslString(nodeLabel(node)+" ("+node.Region+")"), dslString(comp.Description), dslString(comp.Source)))
+		}
+		b.WriteString("    }\n")
+		for _, id := range ids {
+			for _, dep := range g.Edges[id] {
+				b.WriteString(fmt.Sprintf("    %s -> %s \"Depends on\"\n", identifier(sub+"."+id), identifier(sub+"."+dep)))
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	for _, envName := range envNames {
+		b.WriteString(fmt.Sprintf("    deploymentEnvironment %s {\n", dslString(envName)))
+		sort.Strings(envSubs[envName])
+		for _, sub := range envSubs[envName] {
+			b.WriteString(fmt.Sprintf("      deploymentNode %s \"Azure subscription\" \"Azure\" {\n", dslString(sub)))
+			for _, region := range regions {
+				b.WriteString(fmt.Sprintf("        deploymentNode %s \"Azure region\" \"Azure\" {\n", dslString(region)))
+				for _, id := range ids {
+					if g.Nodes[id].Region == region {
+						b.WriteString(fmt.Sprintf("          containerInstance %s\n", identifier(sub+"."+id)))
+					}
+				}
+				b.WriteString("        }\n")
+			}
+			b.WriteString("      }\n")
+		}
+		b.WriteString("    }\n")
+	}
+	b.WriteString("  }\n\n")
+
+	b.WriteString("  views {\n")
+	for _, sub := range subs {
+		b.WriteString(fmt.Sprintf("    container %s %s {\n      include *\n      autoLayout lr\n    }\n", identifier(sub), dslString(identifier(sub)+"_containers")))
+	}
+	for _, envName := range envNames {
+		b.WriteString(fmt.Sprintf("    deployment * %s %s {\n      include *\n      autoLayout lr\n    }\n", dslString(envName), dslString(identifier(envName)+"_deployment")))
+	}
+	b.WriteString("    theme default\n")
+	b.WriteString("  }\n}\n")
+	return b.String()
+}
+
+// identifier returns value as a Structurizr or Mermaid identifier, made of
+// letters, digits and underscores
+func identifier(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, value)
+}
+
+// dslString quotes a Structurizr string
+func dslString(value string) string {
+	return `"` + strings.ReplaceAll(value, `"`, `'`) + `"`
+}
@@ -0,0 +1,257 @@
+// Package docs generates a markdown documentation site of the infrastructure
+// repository, built with mkdocs
+package docs
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/graph"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/naming"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+)
+
+// DefaultDir is the directory of the site below the output directory
+const DefaultDir = "docs"
+
+// deployment is an environment of a subscription deploying a stack
+type deployment struct {
+	subscription string
+	env          config.Environment
+}
+
+// Generate writes the documentation site of tgs.yaml and its stacks into
+// dir: mkdocs.yml and a pages folder holding an overview and a page per stack
+// used by an environment. Pages are rewritten on every run.
+func Generate(dir string) error {
+	tgsConfig, err := config.ReadTGSConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read TGS config: %w", err)
+	}
+
+	deployments := make(map[string][]deployment)
+	var subs []string
+	for name := range tgsConfig.Subscriptions {
+		subs = append(subs, name)
+	}
+	sort.Strings(subs)
+	for _, sub := range subs {
+		for _, env := range tgsConfig.Subscriptions[sub].Environments {
+			stack := env.Stack
+			if stack == "" {
+				stack = "main"
+			}
+			deployments[stack] = append(deployments[stack], deployment{sub, env})
+		}
+	}
+
+	var stackNames []string
+	for name := range deployments {
+		stackNames = append(stackNames, name)
+	}
+	sort.Strings(stackNames)
+
+	stacks := make(map[string]*config.MainConfig)
+	for _, name := range stackNames {
+		stack, err := config.ReadMainConfig(name)
+		if err != nil {
+			return fmt.Errorf("failed to read stack config %s: %w", name, err)
+		}
+		stacks[name] = stack
+	}
+
+	pages := map[string]string{
+		"index.md": overviewPage(tgsConfig, subs, stackNames, stacks),
+	}
+	for _, name := range stackNames {
+		pages[filepath.Join("stacks", name+".md")] = stackPage(tgsConfig, name, stacks[name], deployments[name])
+	}
+
+	for path, content := range pages {
+		path = filepath.Join(dir, "pages", path)
+		if err := project.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create docs directory: %w", err)
+		}
+		if err := project.WriteFile(path, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+
+	if err := project.WriteFile(filepath.Join(dir, "mkdocs.yml"), []byte(mkdocsConfig(tgsConfig.Name, stackNames)), 0644); err != nil {
+		return fmt.Errorf("failed to write mkdocs.yml: %w", err)
+	}
+	return nil
+}
+
+// mkdocsConfig returns the mkdocs.yml of the site, rendering mermaid fences as
+// diagrams with the material theme
+func mkdocsConfig(project string, stackNames []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by tgs docs\nsite_name: %q\ndocs_dir: pages\n\ntheme:\n  name: material\n\nnav:\n  - Overview: index.md\n  - Stacks:\n", project+" infrastructure")
+	for _, name := range stackNames {
+		fmt.Fprintf(&b, "      - %s: stacks/%s.md\n", name, name)
+	}
+	b.WriteString(`
+markdown_extensions:
+  - tables
+  - pymdownx.superfences:
+      custom_fences:
+        - name: mermaid
+          class: mermaid
+          format: !!python/name:pymdownx.superfences.fence_code_format
+`)
+	return b.String()
+}
+
+// overviewPage returns the index page: the environment matrix of every
+// subscription and the stacks they deploy
+func overviewPage(tgsConfig *config.TGSConfig, subs, stackNames []string, stacks map[string]*config.MainConfig) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", tgsConfig.Name)
+	b.WriteString("Infrastructure generated by tgs from `.tgs/tgs.yaml` and the stack files in `.tgs/stacks`. `tgs docs` regenerates this site.\n\n")
+
+	b.WriteString("## Environments\n\n| Subscription | Environment | Stack | Regions | Pipeline environment | Protected |\n|---|---|---|---|---|---|\n")
+	for _, sub := range subs {
+		for _, env := range tgsConfig.Subscriptions[sub].Environments {
+			stack := env.Stack
+			if stack == "" {
+				stack = "main"
+			}
+			protected := "no"
+			if env.Protected {
+				protected = "yes"
+			}
+			fmt.Fprintf(&b, "| %s | %s | [%s](stacks/%s.md) | %s | %s | %s |\n", sub, env.Name, stack, stack, strings.Join(regionsOf(stacks[stack]), ", "), env.PipelineEnvironmentName(), protected)
+		}
+	}
+
+	b.WriteString("\n## Stacks\n\n| Stack | Version | Components | Description |\n|---|---|---|---|\n")
+	for _, name := range stackNames {
+		stack := stacks[name].Stack
+		fmt.Fprintf(&b, "| [%s](stacks/%s.md) | %s | %d | %s |\n", name, name, stack.Version, len(stack.Components), cell(stack.Description))
+	}
+
+	if tgsConfig.Tooling.Terraform != "" || tgsConfig.Tooling.Terragrunt != "" {
+		b.WriteString("\n## Tooling\n\n| Tool | Version |\n|---|---|\n")
+		if tgsConfig.Tooling.Terraform != "" {
+			fmt.Fprintf(&b, "| Terraform | %s |\n", tgsConfig.Tooling.Terraform)
+		}
+		if tgsConfig.Tooling.Terragrunt != "" {
+			fmt.Fprintf(&b, "| Terragrunt | %s |\n", tgsConfig.Tooling.Terragrunt)
+		}
+	}
+	return b.String()
+}
+
+// stackPage returns the page of a stack: its components, architecture,
+// dependency graph, deployment order and resource names by environment
+func stackPage(tgsConfig *config.TGSConfig, stackName string, stack *config.MainConfig, deployments []deployment) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Stack %s\n\n", stackName)
+	if stack.Stack.Description != "" {
+		fmt.Fprintf(&b, "%s\n\n", stack.Stack.Description)
+	}
+	if stack.Stack.Version != "" {
+		fmt.Fprintf(&b, "Version %s, deployed to ", stack.Stack.Version)
+	} else {
+		b.WriteString("Deployed to ")
+	}
+	var envs []string
+	for _, d := range deployments {
+		envs = append(envs, fmt.Sprintf("%s (%s)", d.env.Name, d.subscription))
+	}
+	fmt.Fprintf(&b, "%s.\n\n", strings.Join(envs, ", "))
+
+	var compNames []string
+	for name := range stack.Stack.Components {
+		compNames = append(compNames, name)
+	}
+	sort.Strings(compNames)
+
+	b.WriteString("## Components\n\n| Component | Resource type | azurerm version | Dependencies | Description |\n|---|---|---|---|---|\n")
+	for _, name := range compNames {
+		comp := stack.Stack.Components[name]
+		deps := append(append([]string(nil), comp.Deps...), comp.ExternalDeps...)
+		for i, dep := range deps {
+			deps[i] = "`" + dep + "`"
+		}
+		fmt.Fprintf(&b, "| %s | `%s` | %s | %s | %s |\n", name, comp.Source, comp.Version, strings.Join(deps, ", "), cell(comp.Description))
+	}
+
+	b.WriteString("\n## Architecture\n\n| Region | Component | Apps |\n|---|---|---|\n")
+	for _, region := range regionsOf(stack) {
+		for _, regionComp := range stack.Stack.Architecture.Regions[region] {
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", region, regionComp.Component, strings.Join(regionComp.Apps, ", "))
+		}
+	}
+
+	g := graph.Build(stack)
+	b.WriteString("\n## Dependency Graph\n\nAn arrow points from a component to the component it depends on.\n\n```mermaid\n")
+	b.WriteString(g.ToMermaid())
+	b.WriteString("```\n")
+
+	b.WriteString("\n## Deployment Order\n\n")
+	if waves, err := g.Waves(); err != nil {
+		fmt.Fprintf(&b, "The stack can't be deployed: %v.\n", err)
+	} else {
+		for i, wave := range waves {
+			fmt.Fprintf(&b, "%d. %s\n", i+1, strings.Join(wave, ", "))
+		}
+	}
+
+	entries := naming.Resolved(tgsConfig, stackName, stack)
+	if len(entries) > 0 {
+		var columns []string
+		seen := make(map[string]bool)
+		names := make(map[string]map[string]string)
+		var rows []string
+		for _, entry := range entries {
+			column := fmt.Sprintf("%s (%s)", entry.Environment, entry.Subscription)
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+			row := strings.TrimPrefix(entry.Deployment(), entry.Environment+"/")
+			if names[row] == nil {
+				names[row] = make(map[string]string)
+				rows = append(rows, row)
+			}
+			names[row][column] = entry.Name
+		}
+
+		b.WriteString("\n## Resource Names\n\n| Deployment | " + strings.Join(columns, " | ") + " |\n|---" + strings.Repeat("|---", len(columns)) + "|\n")
+		for _, row := range rows {
+			cells := []string{row}
+			for _, column := range columns {
+				name := "-"
+				if names[row][column] != "" {
+					name = "`" + names[row][column] + "`"
+				}
+				cells = append(cells, name)
+			}
+			fmt.Fprintf(&b, "| %s |\n", strings.Join(cells, " | "))
+		}
+	}
+	return b.String()
+}
+
+// regionsOf returns the sorted regions of a stack's architecture
+func regionsOf(stack *config.MainConfig) []string {
+	if stack == nil {
+		return nil
+	}
+	var regions []string
+	for region := range stack.Stack.Architecture.Regions {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// cell makes a value fit a single cell of a markdown table
+func cell(value string) string {
+	return strings.ReplaceAll(strings.Join(strings.Fields(value), " "), "|", "\\|")
+}
@@ -0,0 +1,43 @@
+package docs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+)
+
+func TestStackPage(t *testing.T) {
+	tgsConfig := &config.TGSConfig{
+		Name:   "projecta",
+		Naming: config.NamingConfig{Format: "${project}-${region}${env}-${type}"},
+	}
+	stack := &config.MainConfig{}
+	stack.Stack.Name = "main"
+	stack.Stack.Components = map[string]config.Component{
+		"serviceplan": {Source: "azurerm_service_plan", Version: "4.22.0", Description: "Plan | shared"},
+		"appservice":  {Source: "azurerm_linux_web_app", Version: "4.22.0", Deps: []string{"{region}.serviceplan"}},
+	}
+	stack.Stack.Architecture.Regions = map[string][]config.RegionComponent{
+		"eastus2": {{Component: "serviceplan"}, {Component: "appservice"}},
+	}
+	tgsConfig.Subscriptions = map[string]config.Subscription{
+		"nonprod": {Environments: []config.Environment{{Name: "dev"}}},
+	}
+
+	page := stackPage(tgsConfig, "main", stack, []deployment{{"nonprod", config.Environment{Name: "dev"}}})
+	for _, want := range []string{
+		"Deployed to dev (nonprod).",
+		"| serviceplan | `azurerm_service_plan` | 4.22.0 |  | Plan \\| shared |",
+		"| appservice | `azurerm_linux_web_app` | 4.22.0 | `{region}.serviceplan` |  |",
+		"```mermaid\nflowchart LR\n",
+		"  eastus2_appservice --> eastus2_serviceplan\n",
+		"1. eastus2.serviceplan\n2. eastus2.appservice\n",
+		"| Deployment | dev (nonprod) |",
+		"| eastus2/appservice | `projecta-E2D-app` |",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("stackPage() is missing %q:\n%s", want, page)
+		}
+	}
+}
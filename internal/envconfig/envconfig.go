@@ -0,0 +1,421 @@
+// Package envconfig defines the schema of the environment configs: the keys
+// the block of a component holds in <environment>.env.hcl, their types and
+// whether environments must set them. component.hcl passes the keys to the
+// module as inputs and tgs validate checks the configs against the schema.
+package envconfig
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Types of environment config keys
+const (
+	TypeString = "string"
+	TypeNumber = "number"
+	TypeBool   = "bool"
+	TypeList   = "list"
+	TypeMap    = "map"
+)
+
+// Types lists the valid types of environment config keys
+var Types = []string{TypeString, TypeNumber, TypeBool, TypeList, TypeMap}
+
+// Field is a key of the environment config of a component
+type Field struct {
+	Name        string
+	Type        string
+	Required    bool
+	Description string
+	// Default is the HCL expression the component uses when an environment
+	// doesn't set an optional key
+	Default string
+	// Value returns the value of a required key generated for an
+	// environment, null when it isn't set
+	Value func(env string) string
+}
+
+// Schema is the environment config schema of a component
+type Schema struct {
+	// Title introduces the inputs read from the environment config in
+	// component.hcl
+	Title  string
+	Fields []Field
+}
+
+// Field returns the field of a key and whether the schema has it
+func (s Schema) Field(name string) (Field, bool) {
+	for _, field := range s.Fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return Field{}, false
+}
+
+// sku returns the App Service plan SKU of an environment
+func sku(env string) string {
+	switch env {
+	case "prod", "stage":
+		return `"P1v2"`
+	case "test":
+		return `"S1"`
+	default:
+		return `"B1"`
+	}
+}
+
+// redisSKU returns the Redis cache SKU of an environment
+func redisSKU(env string) string {
+	switch env {
+	case "prod":
+		return `"Premium"`
+	case "stage", "test":
+		return `"Standard"`
+	default:
+		return `"Basic"`
+	}
+}
+
+// servicePlanID is the key of the App Service plan of web and function apps
+var servicePlanID = Field{Name: "service_plan_id", Type: TypeString, Required: true, Description: "ID of the App Service plan hosting the app"}
+
+// resourceSchemas are the schemas of the resource types, without the
+// azurerm_ prefix
+var resourceSchemas = map[string]Schema{
+	"web_app": {Title: "Web App specific settings", Fields: []Field{
+		servicePlanID,
+		{Name: "app_settings", Type: TypeMap, Description: "App settings of the app", Default: "{}"},
+		{Name: "site_config", Type: TypeMap, Description: "Site configuration of the app", Default: "{}"},
+	}},
+	"service_plan": {Title: "Service Plan specific settings", Fields: []Field{
+		{Name: "sku_name", Type: TypeString, Required: true, Description: "SKU of the plan", Value: sku},
+		{Name: "os_type", Type: TypeString, Description: "Operating system of the plan", Default: `"Linux"`},
+	}},
+	"function_app": {Title: "Function App specific settings", Fields: []Field{
+		servicePlanID,
+		{Name: "app_settings", Type: TypeMap, Description: "App settings of the app", Default: "{}"},
+	}},
+	"sql_database": {Title: "SQL Database specific settings", Fields: []Field{
+		{Name: "server_id", Type: TypeString, Required: true, Description: "ID of the SQL server hosting the database"},
+		{Name: "sku_name", Type: TypeString, Description: "SKU of the database", Default: `"Basic"`},
+	}},
+	"redis_cache": {Title: "Redis Cache specific settings", Fields: []Field{
+		{Name: "sku_name", Type: TypeString, Required: true, Description: "SKU of the cache", Value: redisSKU},
+		{Name: "family", Type: TypeString, Description: "SKU family of the cache, P for Premium", Default: `"C"`},
+	}},
+	"key_vault": {Title: "Key Vault specific settings", Fields: []Field{
+		{Name: "sku_name", Type: TypeString, Description: "SKU of the vault", Default: `"standard"`},
+		{Name: "purge_protection_enabled", Type: TypeBool, Description: "Protect deleted secrets from being purged", Default: "false"},
+	}},
+	"storage_account": {Title: "Storage Account specific settings", Fields: []Field{
+		{Name: "account_tier", Type: TypeString, Description: "Performance tier of the account", Default: `"Standard"`},
+		{Name: "account_replication_type", Type: TypeString, Description: "Replication of the account", Default: `"LRS"`},
+	}},
+	"sql_server": {Title: "SQL Server specific settings", Fields: []Field{
+		{Name: "version", Type: TypeString, Description: "Version of the server", Default: `"12.0"`},
+		{Name: "administrator_login", Type: TypeString, Description: "Login of the administrator", Default: `"sqladmin"`},
+		{Name: "administrator_login_password", Type: TypeString, Required: true, Description: "Password of the administrator, best set as a secret"},
+	}},
+	"api_management": {Title: "API Management specific settings", Fields: []Field{
+		{Name: "publisher_name", Type: TypeString, Description: "Name of the publisher", Default: "local.project_name"},
+		{Name: "publisher_email", Type: TypeString, Required: true, Description: "Email of the publisher"},
+		{Name: "sku_name", Type: TypeString, Description: "SKU of the instance", Default: `"Developer_1"`},
+	}},
+	"kubernetes_cluster": {Title: "Kubernetes Cluster specific settings", Fields: []Field{
+		{Name: "dns_prefix", Type: TypeString, Description: "DNS prefix of the cluster", Default: "local.resource_name"},
+		{Name: "sku_tier", Type: TypeString, Description: "SKU tier of the cluster", Default: `"Free"`},
+		{Name: "kubernetes_version", Type: TypeString, Description: "Kubernetes version, the latest by default", Default: "null"},
+	}},
+	"cdn_frontdoor_profile": {Title: "Front Door specific settings", Fields: []Field{
+		{Name: "sku_name", Type: TypeString, Description: "SKU of the profile", Default: `"Standard_AzureFrontDoor"`},
+		{Name: "health_probe_path", Type: TypeString, Description: "Path the origins are probed at", Default: `"/"`},
+	}},
+	"traffic_manager_profile": {Title: "Traffic Manager specific settings", Fields: []Field{
+		{Name: "traffic_routing_method", Type: TypeString, Description: "How traffic is routed to the endpoints", Default: `"Priority"`},
+		{Name: "health_probe_path", Type: TypeString, Description: "Path the endpoints are probed at", Default: `"/"`},
+	}},
+	"cosmosdb_account": {Title: "Cosmos DB specific settings", Fields: []Field{
+		{Name: "offer_type", Type: TypeString, Description: "Offer type of the account", Default: `"Standard"`},
+		{Name: "consistency_level", Type: TypeString, Description: "Default consistency level", Default: `"Session"`},
+	}},
+}
+
+// For returns the schema of a component: the keys of its resource type and
+// its env_config, without the inputs set in the stack file
+func For(comp config.Component) Schema {
+	compType := strings.TrimPrefix(comp.Source, "azurerm_")
+	// Handle web app variants
+	if strings.Contains(compType, "web_app") || compType == "app_service" {
+		compType = "web_app"
+	}
+	schema, ok := resourceSchemas[compType]
+	if !ok {
+		schema.Title = "Environment specific settings"
+	}
+
+	fields := make(map[string]Field)
+	for _, field := range schema.Fields {
+		fields[field.Name] = field
+	}
+	for name, field := range comp.EnvConfig {
+		fields[name] = Field{
+			Name:        name,
+			Type:        field.Type,
+			Required:    field.Required,
+			Description: field.Description,
+			Default:     DefaultExpression(field),
+		}
+	}
+
+	var names []string
+	for name := range fields {
+		if _, set := comp.Inputs[name]; !set {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	result := Schema{Title: schema.Title}
+	for _, name := range names {
+		result.Fields = append(result.Fields, fields[name])
+	}
+	return result
+}
+
+// DefaultExpression returns the HCL expression of the default of a field of
+// env_config: string defaults are quoted, missing defaults are null
+func DefaultExpression(field config.EnvConfigField) string {
+	switch {
+	case field.Default == "":
+		return "null"
+	case field.Type == TypeString:
+		return fmt.Sprintf("%q", field.Default)
+	default:
+		return field.Default
+	}
+}
+
+// Inputs returns the component.hcl inputs reading the keys of the schema
+// from the block of component compName in the environment config. Required
+// keys are read directly, so Terragrunt fails when an environment misses one.
+func (s Schema) Inputs(compName string) []string {
+	var inputs []string
+	for _, field := range s.Fields {
+		if field.Required {
+			inputs = append(inputs, fmt.Sprintf("%s = local.env_config.locals.%s.%s", field.Name, compName, field.Name))
+		} else {
+			inputs = append(inputs, fmt.Sprintf("%s = lookup(local.env_config.locals.%s, %q, %s)", field.Name, compName, field.Name, field.Default))
+		}
+	}
+	return inputs
+}
+
+// Skeleton writes the documented block of component compName in the
+// environment config of env. Required keys are set, optional keys commented
+// out with their default, and values replace the value of a key, or add one,
+// e.g. for secrets.
+func (s Schema) Skeleton(b *strings.Builder, compName, source, env string, values map[string]string) {
+	if len(s.Fields) == 0 && len(values) == 0 {
+		return
+	}
+	b.WriteString(fmt.Sprintf("  # %s Configuration (%s)\n", compName, source))
+	b.WriteString(fmt.Sprintf("  %s = {\n", compName))
+	for i, field := range s.Fields {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		requirement := "required"
+		if !field.Required {
+			requirement = "optional, defaults to " + field.Default
+		}
+		b.WriteString(fmt.Sprintf("    # %s (%s, %s)", field.Name, field.Type, requirement))
+		if field.Description != "" {
+			b.WriteString(": " + field.Description)
+		}
+		b.WriteString("\n")
+
+		value, set := values[field.Name]
+		switch {
+		case set:
+			b.WriteString(fmt.Sprintf("    %s = %s\n", field.Name, value))
+		case field.Required && field.Value != nil:
+			b.WriteString(fmt.Sprintf("    %s = %s\n", field.Name, field.Value(env)))
+		case field.Required:
+			b.WriteString(fmt.Sprintf("    %s = null # Required: Set this in environment config\n", field.Name))
+		default:
+			b.WriteString(fmt.Sprintf("    # %s = %s\n", field.Name, field.Default))
+		}
+	}
+
+	// Values of keys outside the schema
+	var names []string
+	for name := range values {
+		if _, ok := s.Field(name); !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if len(names) > 0 && len(s.Fields) > 0 {
+		b.WriteString("\n")
+	}
+	for _, name := range names {
+		b.WriteString(fmt.Sprintf("    %s = %s\n", name, values[name]))
+	}
+	b.WriteString("  }\n\n")
+}
+
+// Problem is an issue of an environment config at Line. Unknown problems
+// are keys the schema of the component doesn't have, which the component
+// ignores; the others fail the Terragrunt run or pass invalid inputs.
+type Problem struct {
+	Line    int
+	Message string
+	Unknown bool
+}
+
+// Check checks the blocks of the components of an environment config
+// against their schemas, keyed by component. Blocks of components without
+// keys may be missing and keys of known aren't reported as unknown.
+func Check(data []byte, filename string, schemas map[string]Schema, known map[string]map[string]bool) []Problem {
+	file, diags := hclparse.NewParser().ParseHCL(data, filename)
+	if diags.HasErrors() {
+		line, message := diagnostic(diags)
+		return []Problem{{Line: line, Message: message}}
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil
+	}
+
+	blocks := make(map[string]*hclsyntax.Attribute)
+	for _, block := range body.Blocks {
+		if block.Type != "locals" {
+			continue
+		}
+		for name, attr := range block.Body.Attributes {
+			blocks[name] = attr
+		}
+	}
+
+	var problems []Problem
+	var compNames []string
+	for name := range schemas {
+		compNames = append(compNames, name)
+	}
+	sort.Strings(compNames)
+	for _, compName := range compNames {
+		schema := schemas[compName]
+		attr, ok := blocks[compName]
+		if !ok {
+			if required := requiredNames(schema); len(required) > 0 {
+				problems = append(problems, Problem{Message: fmt.Sprintf("component %s is missing, it must set %s", compName, strings.Join(required, ", "))})
+			}
+			continue
+		}
+		object, ok := attr.Expr.(*hclsyntax.ObjectConsExpr)
+		if !ok {
+			problems = append(problems, Problem{Line: attr.SrcRange.Start.Line, Message: fmt.Sprintf("component %s must be an object of its settings", compName)})
+			continue
+		}
+
+		keys := make(map[string]bool)
+		for _, item := range object.Items {
+			name := hcl.ExprAsKeyword(item.KeyExpr)
+			if name == "" {
+				if value, diags := item.KeyExpr.Value(nil); !diags.HasErrors() && value.Type() == cty.String && value.IsKnown() && !value.IsNull() {
+					name = value.AsString()
+				}
+			}
+			line := item.KeyExpr.Range().Start.Line
+			keys[name] = true
+
+			field, ok := schema.Field(name)
+			if !ok {
+				if !known[compName][name] {
+					problems = append(problems, Problem{Line: line, Message: fmt.Sprintf("%s.%s is not a setting of the component", compName, name), Unknown: true})
+				}
+				continue
+			}
+
+			// Expressions such as secrets are only known when Terragrunt runs
+			value, diags := item.ValueExpr.Value(nil)
+			if diags.HasErrors() || !value.IsWhollyKnown() {
+				continue
+			}
+			if value.IsNull() {
+				if field.Required {
+					problems = append(problems, Problem{Line: line, Message: fmt.Sprintf("%s.%s is required", compName, name)})
+				}
+				continue
+			}
+			if !hasType(value.Type(), field.Type) {
+				problems = append(problems, Problem{Line: line, Message: fmt.Sprintf("%s.%s must be a %s, not a %s", compName, name, field.Type, value.Type().FriendlyName())})
+			}
+		}
+
+		var missing []string
+		for _, name := range requiredNames(schema) {
+			if !keys[name] {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			problems = append(problems, Problem{Line: attr.SrcRange.Start.Line, Message: fmt.Sprintf("component %s must set %s", compName, strings.Join(missing, ", "))})
+		}
+	}
+	return problems
+}
+
+// requiredNames returns the names of the required keys of a schema
+func requiredNames(schema Schema) []string {
+	var names []string
+	for _, field := range schema.Fields {
+		if field.Required {
+			names = append(names, field.Name)
+		}
+	}
+	return names
+}
+
+// hasType reports whether a value of type t can be passed as a key of type
+func hasType(t cty.Type, typ string) bool {
+	switch typ {
+	case TypeString:
+		return t == cty.String
+	case TypeNumber:
+		return t == cty.Number
+	case TypeBool:
+		return t == cty.Bool
+	case TypeList:
+		return t.IsTupleType() || t.IsListType() || t.IsSetType()
+	case TypeMap:
+		return t.IsObjectType() || t.IsMapType()
+	default:
+		return true
+	}
+}
+
+// diagnostic returns the line and message of the first error of diagnostics
+func diagnostic(diags hcl.Diagnostics) (int, string) {
+	for _, diag := range diags {
+		if diag.Severity != hcl.DiagError {
+			continue
+		}
+		line := 0
+		if diag.Subject != nil {
+			line = diag.Subject.Start.Line
+		}
+		if diag.Detail != "" {
+			return line, fmt.Sprintf("%s: %s", diag.Summary, diag.Detail)
+		}
+		return line, diag.Summary
+	}
+	return 0, diags.Error()
+}
@@ -0,0 +1,105 @@
+package envconfig
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+)
+
+func TestFor(t *testing.T) {
+	schema := For(config.Component{
+		Source: "azurerm_linux_web_app",
+		Inputs: map[string]string{"service_plan_id": "{dep:serviceplan.id}"},
+		EnvConfig: map[string]config.EnvConfigField{
+			"always_on":    {Type: TypeBool, Default: "true"},
+			"health_path":  {Type: TypeString, Default: "/health"},
+			"app_settings": {Type: TypeMap, Required: true},
+		},
+	})
+
+	want := []string{
+		`always_on = lookup(local.env_config.locals.api, "always_on", true)`,
+		`app_settings = local.env_config.locals.api.app_settings`,
+		`health_path = lookup(local.env_config.locals.api, "health_path", "/health")`,
+		`site_config = lookup(local.env_config.locals.api, "site_config", {})`,
+	}
+	if got := schema.Inputs("api"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Inputs() = %v, want %v", got, want)
+	}
+
+	if schema := For(config.Component{Source: "azurerm_dns_zone"}); len(schema.Fields) > 0 {
+		t.Errorf("For(azurerm_dns_zone) fields = %v, want none", schema.Fields)
+	}
+}
+
+func TestSkeleton(t *testing.T) {
+	schema := For(config.Component{Source: "azurerm_redis_cache"})
+	var b strings.Builder
+	schema.Skeleton(&b, "redis", "azurerm_redis_cache", "prod", map[string]string{"access_key": `get_env("REDIS_KEY")`})
+	content := b.String()
+
+	for _, line := range []string{`    sku_name = "Premium"`, `    # family = "C"`, `    access_key = get_env("REDIS_KEY")`} {
+		if !strings.Contains(content, line+"\n") {
+			t.Errorf("Skeleton() = %q, want line %q", content, line)
+		}
+	}
+
+	// The skeleton passes its own schema
+	data := []byte("locals {\n" + content + "}\n")
+	schemas := map[string]Schema{"redis": schema}
+	known := map[string]map[string]bool{"redis": {"access_key": true}}
+	if problems := Check(data, "prod.env.hcl", schemas, known); len(problems) > 0 {
+		t.Errorf("Check(skeleton) = %v, want none", problems)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	schemas := map[string]Schema{
+		"redis":  For(config.Component{Source: "azurerm_redis_cache"}),
+		"plan":   For(config.Component{Source: "azurerm_service_plan"}),
+		"zone":   For(config.Component{Source: "azurerm_dns_zone"}),
+		"zoned":  {Fields: []Field{{Name: "zones", Type: TypeList}, {Name: "tags", Type: TypeMap}}},
+		"secret": For(config.Component{Source: "azurerm_sql_server"}),
+	}
+	data := []byte(`locals {
+  redis = {
+    sku_name = 1
+    sku      = "Basic"
+  }
+  plan = "B1"
+  zoned = {
+    zones = ["1", "2"]
+    tags  = { team = "platform" }
+  }
+  secret = {
+    administrator_login_password = get_env("SQL_PASSWORD")
+  }
+}
+`)
+
+	want := []Problem{
+		{Line: 6, Message: "component plan must be an object of its settings"},
+		{Line: 3, Message: "redis.sku_name must be a string, not a number"},
+		{Line: 4, Message: "redis.sku is not a setting of the component", Unknown: true},
+	}
+	if got := Check(data, "dev.env.hcl", schemas, nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("Check() = %v, want %v", got, want)
+	}
+
+	// Required keys of a component without a block, and a missing key
+	data = []byte("locals {\n  secret = {\n    version = \"12.0\"\n  }\n}\n")
+	got := Check(data, "dev.env.hcl", map[string]Schema{"secret": schemas["secret"], "redis": schemas["redis"]}, nil)
+	want = []Problem{
+		{Message: "component redis is missing, it must set sku_name"},
+		{Line: 2, Message: "component secret must set administrator_login_password"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check() = %v, want %v", got, want)
+	}
+
+	if got := Check([]byte("locals {\n  redis = {\n}\n"), "dev.env.hcl", schemas, nil); len(got) != 1 || got[0].Line == 0 {
+		t.Errorf("Check(invalid HCL) = %v, want one problem with a line", got)
+	}
+}
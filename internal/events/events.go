@@ -0,0 +1,129 @@
+// Package events publishes the progress of generation and validation as
+// structured events, so wrappers such as IDEs and web UIs can report progress
+// without parsing the log output
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/validate"
+)
+
+// Event types
+const (
+	TypeFileWritten        = "file_written"
+	TypeComponentGenerated = "component_generated"
+	TypeValidationFinding  = "validation_finding"
+)
+
+// Event is a step of a run. Only the fields of its type are set.
+type Event struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	Path      string    `json:"path,omitempty"`
+	Stack     string    `json:"stack,omitempty"`
+	Component string    `json:"component,omitempty"`
+	Rule      string    `json:"rule,omitempty"`
+	Severity  string    `json:"severity,omitempty"`
+	Line      int       `json:"line,omitempty"`
+	Context   string    `json:"context,omitempty"`
+	Message   string    `json:"message,omitempty"`
+}
+
+var (
+	mu          sync.Mutex
+	nextID      int
+	subscribers = make(map[int]func(Event))
+	quiet       bool
+)
+
+// Subscribe calls handler with every published event, in order, until the
+// returned function is called. Handlers must not publish events themselves.
+func Subscribe(handler func(Event)) func() {
+	mu.Lock()
+	defer mu.Unlock()
+	id := nextID
+	nextID++
+	subscribers[id] = handler
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(subscribers, id)
+	}
+}
+
+// WriteJSONLines subscribes a writer receiving every event as a JSON line
+func WriteJSONLines(w io.Writer) func() {
+	return Subscribe(func(e Event) {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return
+		}
+		fmt.Fprintln(w, string(data))
+	})
+}
+
+// SetQuiet drops published events when enabled, e.g. while plan renders the
+// tree into a temporary directory
+func SetQuiet(enabled bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	quiet = enabled
+}
+
+// Publish sends an event to the subscribers, setting its time if unset
+func Publish(e Event) {
+	mu.Lock()
+	defer mu.Unlock()
+	if quiet {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for id := 0; id < nextID; id++ {
+		if handler, ok := subscribers[id]; ok {
+			handler(e)
+		}
+	}
+}
+
+// FileWritten publishes that a generated file was written, with its path
+// relative to the project directory
+func FileWritten(path string) {
+	if filepath.IsAbs(path) {
+		if cwd, err := project.Abs("."); err == nil {
+			if rel, err := filepath.Rel(cwd, path); err == nil {
+				path = rel
+			}
+		}
+	}
+	Publish(Event{Type: TypeFileWritten, Path: filepath.ToSlash(path)})
+}
+
+// ComponentGenerated publishes that the module of a component was generated
+func ComponentGenerated(stack, component string) {
+	Publish(Event{Type: TypeComponentGenerated, Stack: stack, Component: component})
+}
+
+// ValidationFindings publishes the findings of a validation of file, errors
+// and warnings alike
+func ValidationFindings(file string, findings []error) {
+	for _, result := range validate.NewResults(findings, file) {
+		Publish(Event{
+			Type:     TypeValidationFinding,
+			Path:     result.File,
+			Rule:     result.Rule,
+			Severity: result.Severity,
+			Line:     result.Line,
+			Context:  result.Context,
+			Message:  result.Message,
+		})
+	}
+}
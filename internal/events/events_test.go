@@ -0,0 +1,50 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/validate"
+)
+
+func TestPublish(t *testing.T) {
+	var received []Event
+	unsubscribe := Subscribe(func(e Event) { received = append(received, e) })
+
+	var buf bytes.Buffer
+	stopJSON := WriteJSONLines(&buf)
+	defer stopJSON()
+
+	FileWritten("infra/root.hcl")
+	ComponentGenerated("main", "redis")
+	SetQuiet(true)
+	FileWritten("ignored.hcl")
+	SetQuiet(false)
+	ValidationFindings(".tgs/stacks/main.yaml", []error{validate.ValidationError{Context: "components.redis", Message: "missing version", Rule: validate.RuleComponentRequiredField}})
+	unsubscribe()
+	FileWritten("after.hcl")
+
+	if len(received) != 3 {
+		t.Fatalf("received %d events, want 3: %+v", len(received), received)
+	}
+	if received[0].Type != TypeFileWritten || received[0].Path != "infra/root.hcl" || received[0].Time.IsZero() {
+		t.Errorf("file event = %+v", received[0])
+	}
+	if received[1].Type != TypeComponentGenerated || received[1].Stack != "main" || received[1].Component != "redis" {
+		t.Errorf("component event = %+v", received[1])
+	}
+	if received[2].Type != TypeValidationFinding || received[2].Rule != validate.RuleComponentRequiredField || received[2].Severity != validate.SeverityError || received[2].Path != ".tgs/stacks/main.yaml" {
+		t.Errorf("validation event = %+v", received[2])
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("wrote %d JSON lines, want 4:\n%s", len(lines), buf.String())
+	}
+	var e Event
+	if err := json.Unmarshal([]byte(lines[3]), &e); err != nil || e.Path != "after.hcl" {
+		t.Errorf("last JSON line = %s (%v)", lines[3], err)
+	}
+}
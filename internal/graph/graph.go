@@ -0,0 +1,337 @@
+// Package graph builds the component/app dependency DAG of a stack
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+)
+
+// Node represents a deployable component instance in a region
+type Node struct {
+	ID        string `json:"id"`
+	Region    string `json:"region"`
+	Component string `json:"component"`
+	App       string `json:"app,omitempty"`
+}
+
+// Graph represents the dependency graph of a stack. An edge from A to B
+// means A depends on B, so B must be deployed first.
+type Graph struct {
+	Nodes map[string]*Node
+	Edges map[string][]string
+	// pairs are the paired regions of the architecture
+	pairs map[string]string
+}
+
+// CycleError is returned when the graph contains a dependency cycle
+type CycleError struct {
+	Path []string
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("dependency cycle detected: %s", strings.Join(e.Path, " -> "))
+}
+
+// NodeID returns the identifier of a component instance
+func NodeID(region, component, app string) string {
+	if app != "" {
+		return fmt.Sprintf("%s.%s.%s", region, component, app)
+	}
+	return fmt.Sprintf("%s.%s", region, component)
+}
+
+// Build constructs the dependency graph for a stack from its architecture
+// and the deps declared on each component
+func Build(stack *config.MainConfig) *Graph {
+	g := &Graph{
+		Nodes: make(map[string]*Node),
+		Edges: make(map[string][]string),
+		pairs: stack.Stack.Architecture.PairedRegions,
+	}
+
+	// First pass: create a node for every component instance
+	for region, components := range stack.Stack.Architecture.Regions {
+		for _, comp := range components {
+			if len(comp.Apps) > 0 {
+				for _, app := range comp.Apps {
+					g.addNode(&Node{ID: NodeID(region, comp.Component, app), Region: region, Component: comp.Component, App: app})
+				}
+			} else {
+				g.addNode(&Node{ID: NodeID(region, comp.Component, ""), Region: region, Component: comp.Component})
+			}
+		}
+	}
+
+	// Second pass: resolve dependencies into edges
+	for _, id := range g.NodeIDs() {
+		node := g.Nodes[id]
+		for _, dep := range stack.Stack.Components[node.Component].Deps {
+			for _, target := range g.resolve(node, dep) {
+				g.addEdge(id, target)
+			}
+		}
+	}
+
+	return g
+}
+
+// resolve returns the node IDs a dependency string refers to for a node
+func (g *Graph) resolve(node *Node, dep string) []string {
+	parts := strings.Split(dep, ".")
+	if len(parts) < 2 {
+		return nil
+	}
+
+	region := config.DependencyRegion(parts[0], node.Region, g.pairs[node.Region])
+	component := parts[1]
+	app := ""
+	if len(parts) > 2 {
+		app = parts[2]
+	}
+
+	// Handle special placeholders
+	if app == "{app}" {
+		app = node.App
+	}
+
+	if _, ok := g.Nodes[NodeID(region, component, app)]; ok {
+		return []string{NodeID(region, component, app)}
+	}
+
+	if app != "" {
+		return nil
+	}
+
+	// Component-level dependency on a component deployed per app: prefer the
+	// matching app instance, otherwise depend on every instance
+	if node.App != "" {
+		if _, ok := g.Nodes[NodeID(region, component, node.App)]; ok {
+			return []string{NodeID(region, component, node.App)}
+		}
+	}
+
+	var targets []string
+	for _, id := range g.NodeIDs() {
+		candidate := g.Nodes[id]
+		if candidate.Region == region && candidate.Component == component {
+			targets = append(targets, id)
+		}
+	}
+	return targets
+}
+
+func (g *Graph) addNode(node *Node) {
+	g.Nodes[node.ID] = node
+}
+
+func (g *Graph) addEdge(from, to string) {
+	for _, existing := range g.Edges[from] {
+		if existing == to {
+			return
+		}
+	}
+	g.Edges[from] = append(g.Edges[from], to)
+	sort.Strings(g.Edges[from])
+}
+
+// NodeIDs returns all node IDs in sorted order
+func (g *Graph) NodeIDs() []string {
+	ids := make([]string, 0, len(g.Nodes))
+	for id := range g.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// FindCycle returns the first dependency cycle found, as a path that starts
+// and ends with the same node, or nil if the graph is acyclic
+func (g *Graph) FindCycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+
+	state := make(map[string]int)
+	var stack []string
+	var cycle []string
+
+	var visit func(id string) bool
+	visit = func(id string) bool {
+		state[id] = visiting
+		stack = append(stack, id)
+
+		for _, dep := range g.Edges[id] {
+			switch state[dep] {
+			case visiting:
+				// Extract the cycle from the current DFS stack
+				for i, s := range stack {
+					if s == dep {
+						cycle = append(append([]string{}, stack[i:]...), dep)
+						break
+					}
+				}
+				return true
+			case unvisited:
+				if visit(dep) {
+					return true
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[id] = done
+		return false
+	}
+
+	for _, id := range g.NodeIDs() {
+		if state[id] == unvisited && visit(id) {
+			return cycle
+		}
+	}
+
+	return nil
+}
+
+// Waves groups nodes into deployment waves: every node only depends on nodes
+// in earlier waves. A CycleError is returned if the graph is not a DAG.
+func (g *Graph) Waves() ([][]string, error) {
+	if cycle := g.FindCycle(); cycle != nil {
+		return nil, &CycleError{Path: cycle}
+	}
+
+	deployed := make(map[string]bool)
+	var waves [][]string
+
+	for len(deployed) < len(g.Nodes) {
+		var wave []string
+		for _, id := range g.NodeIDs() {
+			if deployed[id] {
+				continue
+			}
+			ready := true
+			for _, dep := range g.Edges[id] {
+				if !deployed[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				wave = append(wave, id)
+			}
+		}
+
+		for _, id := range wave {
+			deployed[id] = true
+		}
+		waves = append(waves, wave)
+	}
+
+	return waves, nil
+}
+
+// TopologicalSort returns the nodes in dependency order
+func (g *Graph) TopologicalSort() ([]string, error) {
+	waves, err := g.Waves()
+	if err != nil {
+		return nil, err
+	}
+
+	var order []string
+	for _, wave := range waves {
+		order = append(order, wave...)
+	}
+	return order, nil
+}
+
+// ToDOT renders the graph in Graphviz DOT format
+func (g *Graph) ToDOT(name string) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("digraph %q {\n", name))
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box];\n\n")
+
+	for _, id := range g.NodeIDs() {
+		node := g.Nodes[id]
+		label := node.Component
+		if node.App != "" {
+			label = fmt.Sprintf("%s/%s", node.Component, node.App)
+		}
+		b.WriteString(fmt.Sprintf("  %q [label=\"%s\\n%s\"];\n", id, label, node.Region))
+	}
+
+	b.WriteString("\n")
+	for _, id := range g.NodeIDs() {
+		for _, dep := range g.Edges[id] {
+			b.WriteString(fmt.Sprintf("  %q -> %q;\n", id, dep))
+		}
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// ToMermaid renders the graph as a Mermaid flowchart, with node IDs made of
+// letters, digits and underscores
+func (g *Graph) ToMermaid() string {
+	ids := g.NodeIDs()
+	nodeIDs := make(map[string]string, len(ids))
+	for _, id := range ids {
+		nodeIDs[id] = strings.NewReplacer(".", "_", "-", "_", "{", "", "}", "").Replace(id)
+	}
+
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for _, id := range ids {
+		node := g.Nodes[id]
+		label := node.Component
+		if node.App != "" {
+			label = fmt.Sprintf("%s/%s", node.Component, node.App)
+		}
+		b.WriteString(fmt.Sprintf("  %s[\"%s<br/>%s\"]\n", nodeIDs[id], label, node.Region))
+	}
+	for _, id := range ids {
+		for _, dep := range g.Edges[id] {
+			b.WriteString(fmt.Sprintf("  %s --> %s\n", nodeIDs[id], nodeIDs[dep]))
+		}
+	}
+	return b.String()
+}
+
+// jsonGraph is the JSON representation of a graph
+type jsonGraph struct {
+	Nodes []*Node    `json:"nodes"`
+	Edges []jsonEdge `json:"edges"`
+	Order []string   `json:"order,omitempty"`
+	Cycle []string   `json:"cycle,omitempty"`
+}
+
+type jsonEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ToJSON renders the graph, its deployment order and any cycle as JSON
+func (g *Graph) ToJSON() ([]byte, error) {
+	out := jsonGraph{Nodes: []*Node{}, Edges: []jsonEdge{}}
+	for _, id := range g.NodeIDs() {
+		out.Nodes = append(out.Nodes, g.Nodes[id])
+		for _, dep := range g.Edges[id] {
+			out.Edges = append(out.Edges, jsonEdge{From: id, To: dep})
+		}
+	}
+
+	order, err := g.TopologicalSort()
+	if cycleErr, ok := err.(*CycleError); ok {
+		out.Cycle = cycleErr.Path
+	} else {
+		out.Order = order
+	}
+
+	return json.MarshalIndent(out, "", "  ")
+}
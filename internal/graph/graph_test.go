@@ -0,0 +1,108 @@
+package graph
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+)
+
+func testStack(components map[string][]string, regions map[string][]config.RegionComponent) *config.MainConfig {
+	stack := &config.MainConfig{}
+	stack.Stack.Components = make(map[string]config.Component)
+	for name, deps := range components {
+		stack.Stack.Components[name] = config.Component{Deps: deps}
+	}
+	stack.Stack.Architecture.Regions = regions
+	return stack
+}
+
+func TestWaves(t *testing.T) {
+	stack := testStack(map[string][]string{
+		"serviceplan": nil,
+		"redis":       nil,
+		"appservice":  {"{region}.serviceplan.{app}", "eastus2.redis"},
+	}, map[string][]config.RegionComponent{
+		"eastus2": {
+			{Component: "redis"},
+			{Component: "serviceplan", Apps: []string{"api"}},
+			{Component: "appservice", Apps: []string{"api"}},
+		},
+	})
+
+	waves, err := Build(stack).Waves()
+	if err != nil {
+		t.Fatalf("Waves() unexpected error: %v", err)
+	}
+
+	want := [][]string{
+		{"eastus2.redis", "eastus2.serviceplan.api"},
+		{"eastus2.appservice.api"},
+	}
+	if !reflect.DeepEqual(waves, want) {
+		t.Errorf("Waves() = %v, want %v", waves, want)
+	}
+}
+
+func TestPairedRegionDeps(t *testing.T) {
+	stack := testStack(map[string][]string{
+		"redis":         nil,
+		"redis_replica": {"{region}.redis", "{paired_region}.redis"},
+	}, map[string][]config.RegionComponent{
+		"eastus2":   {{Component: "redis"}},
+		"centralus": {{Component: "redis"}, {Component: "redis_replica"}},
+	})
+	stack.Stack.Architecture.PairedRegions = map[string]string{"centralus": "eastus2"}
+
+	got := Build(stack).Edges["centralus.redis_replica"]
+	want := []string{"centralus.redis", "eastus2.redis"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Edges[centralus.redis_replica] = %v, want %v", got, want)
+	}
+}
+
+func TestFindCycle(t *testing.T) {
+	stack := testStack(map[string][]string{
+		"appservice":  {"{region}.functionapp"},
+		"functionapp": {"{region}.appservice"},
+	}, map[string][]config.RegionComponent{
+		"eastus2": {
+			{Component: "appservice"},
+			{Component: "functionapp"},
+		},
+	})
+
+	g := Build(stack)
+	want := []string{"eastus2.appservice", "eastus2.functionapp", "eastus2.appservice"}
+	if cycle := g.FindCycle(); !reflect.DeepEqual(cycle, want) {
+		t.Errorf("FindCycle() = %v, want %v", cycle, want)
+	}
+
+	var cycleErr *CycleError
+	if _, err := g.TopologicalSort(); !errors.As(err, &cycleErr) {
+		t.Errorf("TopologicalSort() error = %v, want CycleError", err)
+	}
+}
+
+func TestToMermaid(t *testing.T) {
+	stack := testStack(map[string][]string{
+		"serviceplan": nil,
+		"appservice":  {"{region}.serviceplan.{app}"},
+	}, map[string][]config.RegionComponent{
+		"eastus2": {
+			{Component: "serviceplan", Apps: []string{"api"}},
+			{Component: "appservice", Apps: []string{"api"}},
+		},
+	})
+
+	got := Build(stack).ToMermaid()
+	want := `flowchart LR
+  eastus2_appservice_api["appservice/api<br/>eastus2"]
+  eastus2_serviceplan_api["serviceplan/api<br/>eastus2"]
+  eastus2_appservice_api --> eastus2_serviceplan_api
+`
+	if got != want {
+		t.Errorf("ToMermaid() =\n%s\nwant\n%s", got, want)
+	}
+}
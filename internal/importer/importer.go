@@ -0,0 +1,673 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/azure"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/naming"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"gopkg.in/yaml.v3"
+)
+
+// Placeholders written by generate into dependency config paths
+const (
+	regionPlaceholder = "${local.region_vars.locals.region_name}"
+	appPlaceholder    = "${local.app_name}"
+)
+
+// architecturePathPattern matches dependency config paths of a tgs tree,
+// capturing the region and the component folder
+var architecturePathPattern = regexp.MustCompile(`architecture/[^/]+/[^/]+/([^/]+)/[^/]+/(?:\.terragrunt-stack/)?(.+)$`)
+
+// resourcePattern matches azurerm resources declared in Terraform files
+var resourcePattern = regexp.MustCompile(`resource\s+"(azurerm_[a-z0-9_]+)"`)
+
+// providerVersionPattern matches the azurerm version constraint of a
+// required_providers block
+var providerVersionPattern = regexp.MustCompile(`(?s)azurerm\s*=\s*\{[^}]*version\s*=\s*"[~>=< ]*([0-9]+\.[0-9]+\.[0-9]+)"`)
+
+// projectNamePattern matches characters not allowed in project names
+var projectNamePattern = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// Result is the configuration inferred from a terragrunt tree
+type Result struct {
+	TGSConfig *config.TGSConfig
+	Stacks    map[string]*config.MainConfig
+	// Warnings lists what couldn't be inferred and needs review
+	Warnings []string
+}
+
+// module is a terragrunt module of the imported tree
+type module struct {
+	Dir          string
+	Stack        string
+	Subscription string
+	Region       string
+	Environment  string
+	Component    string
+	App          string
+}
+
+// dependency is a dependency block of a module
+type dependency struct {
+	Name        string
+	ConfigPath  string
+	SkipOutputs bool
+}
+
+// Import walks the terragrunt tree at root and infers the subscriptions,
+// environments, regions, components, apps and dependencies of a tgs.yaml
+// and stack configurations. Trees generated by tgs are recognised by their
+// architecture folder; other trees are read from their region folders and
+// subscription, region and environment files.
+func Import(root string) (*Result, error) {
+	root, err := project.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve import path: %w", err)
+	}
+	if info, err := project.Stat(root); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("import path %s is not a directory", root)
+	}
+
+	// get_repo_root() of a tgs tree is the parent of .infrastructure
+	repoRoot := root
+	if filepath.Base(root) == ".infrastructure" {
+		repoRoot = filepath.Dir(root)
+	}
+
+	result := &Result{Stacks: make(map[string]*config.MainConfig)}
+
+	var modules []*module
+	err = project.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			switch info.Name() {
+			case ".terragrunt-cache", ".terraform", ".git", "_components", "_units":
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Name() != "terragrunt.hcl" {
+			return nil
+		}
+
+		dir := filepath.Dir(path)
+		mod, ok := identify(root, dir)
+		if !ok {
+			rel, _ := filepath.Rel(root, dir)
+			if rel != "." {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("skipped %s: no region folder found", rel))
+			}
+			return nil
+		}
+		modules = append(modules, mod)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", root, err)
+	}
+	if len(modules) == 0 {
+		return nil, fmt.Errorf("no terragrunt modules found in %s", root)
+	}
+
+	byDir := make(map[string]*module)
+	for _, mod := range modules {
+		byDir[mod.Dir] = mod
+	}
+
+	tgsConfig := &config.TGSConfig{
+		Name:          projectName(root, repoRoot),
+		Subscriptions: make(map[string]config.Subscription),
+		Naming: config.NamingConfig{
+			Format:           "${project}-${region}${env}-${type}",
+			DefaultSeparator: "-",
+		},
+	}
+	result.TGSConfig = tgsConfig
+
+	// Only prefixes differing from the defaults are kept as overrides
+	defaults := naming.NewPrefixes(config.PrefixConfig{})
+
+	// Components are read once per stack, deps are merged across instances
+	seenEnv := make(map[string]bool)
+	seenComponent := make(map[string]bool)
+	for _, mod := range modules {
+		stack := result.stack(mod.Stack)
+
+		sub, ok := tgsConfig.Subscriptions[mod.Subscription]
+		if !ok {
+			sub = subscription(mod, root)
+			if sub.RemoteState.Name == "" {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("subscription %s: set remotestate name and resource_group", mod.Subscription))
+			}
+		}
+		envKey := mod.Subscription + "/" + mod.Environment
+		if !seenEnv[envKey] {
+			seenEnv[envKey] = true
+			env := config.Environment{Name: mod.Environment}
+			if mod.Stack != "main" {
+				env.Stack = mod.Stack
+			}
+			if prefix := readLocals(findUp(mod.Dir, root, "environment.hcl", "env.hcl"))["environment_prefix"]; prefix != "" && prefix != defaults.Environment(mod.Environment) {
+				setPrefix(&tgsConfig.Prefixes.Environments, mod.Environment, prefix)
+			}
+			sub.Environments = append(sub.Environments, env)
+		}
+		tgsConfig.Subscriptions[mod.Subscription] = sub
+
+		if prefix := readLocals(findUp(mod.Dir, root, "region.hcl"))["region_prefix"]; prefix != "" && prefix != defaults.Region(mod.Region) {
+			setPrefix(&tgsConfig.Prefixes.Regions, mod.Region, prefix)
+		}
+		addToArchitecture(stack, mod)
+
+		compKey := mod.Stack + "/" + mod.Component
+		comp := stack.Stack.Components[mod.Component]
+		if !seenComponent[compKey] {
+			seenComponent[compKey] = true
+			comp = component(mod, repoRoot)
+			if comp.Source == "" {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("component %s: no azurerm resource found, set its source", mod.Component))
+			}
+		}
+
+		for _, dep := range dependencies(mod.Dir, repoRoot) {
+			ref, ok := resolveDependency(mod, dep, byDir)
+			if !ok {
+				if stack.Stack.ExternalDependencies == nil {
+					stack.Stack.ExternalDependencies = make(map[string]config.ExternalDependency)
+				}
+				stack.Stack.ExternalDependencies[dep.Name] = config.ExternalDependency{ConfigPath: dep.ConfigPath, SkipOutputs: dep.SkipOutputs}
+				if !contains(comp.ExternalDeps, dep.Name) {
+					result.Warnings = append(result.Warnings, fmt.Sprintf("component %s: dependency %s is outside the imported tree, kept as an external dependency with config_path %s", mod.Component, dep.Name, dep.ConfigPath))
+				}
+				comp.ExternalDeps = appendUnique(comp.ExternalDeps, dep.Name)
+				continue
+			}
+			comp.Deps = appendUnique(comp.Deps, ref)
+			if dep.SkipOutputs {
+				if comp.DependencyOptions == nil {
+					comp.DependencyOptions = make(map[string]config.DependencyOptions)
+				}
+				comp.DependencyOptions[ref] = config.DependencyOptions{SkipOutputs: true}
+			}
+		}
+		stack.Stack.Components[mod.Component] = comp
+	}
+
+	return result, nil
+}
+
+// stack returns the stack configuration of name, creating it on first use
+func (r *Result) stack(name string) *config.MainConfig {
+	if stack, ok := r.Stacks[name]; ok {
+		return stack
+	}
+	stack := &config.MainConfig{Stack: config.StackConfig{
+		Name:         name,
+		Version:      "1.0.0",
+		Description:  "Imported by tgs import",
+		Components:   make(map[string]config.Component),
+		Architecture: config.ArchitectureConfig{Regions: make(map[string][]config.RegionComponent)},
+	}}
+	r.Stacks[name] = stack
+	return stack
+}
+
+// identify infers the module of a directory holding a terragrunt.hcl from its
+// path below root
+func identify(root, dir string) (*module, bool) {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return nil, false
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(filepath.ToSlash(rel), "/") {
+		if segment != ".terragrunt-stack" {
+			segments = append(segments, segment)
+		}
+	}
+
+	// Trees generated by tgs: architecture/<stack>/<sub>/<region>/<env>/<component>[/<app>]
+	if segments[0] == "architecture" && len(segments) >= 6 && len(segments) <= 7 {
+		mod := &module{
+			Dir:          dir,
+			Stack:        segments[1],
+			Subscription: segments[2],
+			Region:       segments[3],
+			Environment:  segments[4],
+			Component:    segments[5],
+		}
+		if len(segments) == 7 {
+			mod.App = segments[6]
+		}
+		return mod, true
+	}
+
+	// Other trees: find the region folder, then the environment and
+	// subscription folders from their files or their position
+	has := func(i int, names ...string) bool {
+		path := filepath.Join(root, filepath.FromSlash(strings.Join(segments[:i+1], "/")))
+		for _, name := range names {
+			if _, err := project.Stat(filepath.Join(path, name)); err == nil {
+				return true
+			}
+		}
+		return false
+	}
+
+	region, env, sub := -1, -1, -1
+	for i, segment := range segments {
+		if region < 0 && (azure.IsRegion(segment) || has(i, "region.hcl")) {
+			region = i
+		}
+		if env < 0 && has(i, "environment.hcl", "env.hcl") {
+			env = i
+		}
+		if sub < 0 && has(i, "subscription.hcl", "account.hcl") {
+			sub = i
+		}
+	}
+	if region < 0 {
+		return nil, false
+	}
+	if env < 0 {
+		if len(segments)-region > 2 {
+			env = region + 1
+		} else if region > 0 {
+			env = region - 1
+		} else {
+			return nil, false
+		}
+	}
+
+	comp := region + 1
+	if env > region {
+		comp = env + 1
+	}
+	if comp >= len(segments) || len(segments)-comp > 2 {
+		return nil, false
+	}
+
+	first := region
+	if env < first {
+		first = env
+	}
+	subName := "default"
+	if sub >= 0 && sub < first {
+		subName = segments[sub]
+	} else if first > 0 {
+		subName = segments[first-1]
+	}
+
+	mod := &module{
+		Dir:          dir,
+		Stack:        "main",
+		Subscription: subName,
+		Region:       segments[region],
+		Environment:  segments[env],
+		Component:    segments[comp],
+	}
+	if comp+1 < len(segments) {
+		mod.App = segments[comp+1]
+	}
+	return mod, true
+}
+
+// subscription returns the subscription of a module, reading the remote state
+// and IDs from its subscription.hcl when there is one
+func subscription(mod *module, root string) config.Subscription {
+	locals := readLocals(findUp(mod.Dir, root, "subscription.hcl", "account.hcl"))
+	return config.Subscription{
+		RemoteState: config.RemoteState{
+			Name:          locals["remote_state_storage_account"],
+			ResourceGroup: locals["remote_state_resource_group"],
+		},
+		SubscriptionID: locals["subscription_id"],
+		TenantID:       locals["tenant_id"],
+	}
+}
+
+// component infers the component of a module from the component.hcl
+// generated by tgs, or from the Terraform files of its source
+func component(mod *module, repoRoot string) config.Component {
+	comp := config.Component{
+		Provider:    "azurerm",
+		Description: fmt.Sprintf("Imported from %s", mod.Component),
+	}
+
+	for _, include := range includes(mod.Dir, repoRoot) {
+		locals := readLocals(include)
+		if locals["provider_source"] != "" {
+			comp.Source = locals["provider_source"]
+			comp.Version = locals["provider_version"]
+			return comp
+		}
+	}
+
+	source := terraformSource(mod.Dir, repoRoot)
+	if source == "" {
+		source = mod.Dir
+	}
+	files, _ := project.Glob(filepath.Join(source, "*.tf"))
+	sort.Strings(files)
+	for _, file := range files {
+		content, err := project.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		if match := resourcePattern.FindSubmatch(content); match != nil && comp.Source == "" {
+			comp.Source = string(match[1])
+		}
+		if match := providerVersionPattern.FindSubmatch(content); match != nil && comp.Version == "" {
+			comp.Version = string(match[1])
+		}
+	}
+	return comp
+}
+
+// addToArchitecture adds the module to the regions of its stack
+func addToArchitecture(stack *config.MainConfig, mod *module) {
+	regions := stack.Stack.Architecture.Regions
+	for i, rc := range regions[mod.Region] {
+		if rc.Component == mod.Component {
+			if mod.App != "" {
+				regions[mod.Region][i].Apps = appendUnique(rc.Apps, mod.App)
+			}
+			return
+		}
+	}
+	rc := config.RegionComponent{Component: mod.Component}
+	if mod.App != "" {
+		rc.Apps = []string{mod.App}
+	}
+	regions[mod.Region] = append(regions[mod.Region], rc)
+}
+
+// resolveDependency returns the tgs dependency notation of a dependency
+// block, or false when it points outside the imported tree
+func resolveDependency(mod *module, dep dependency, byDir map[string]*module) (string, bool) {
+	if match := architecturePathPattern.FindStringSubmatch(dep.ConfigPath); match != nil {
+		region := match[1]
+		if region == regionPlaceholder {
+			region = "{region}"
+		}
+		parts := strings.Split(match[2], "/")
+		ref := region + "." + parts[0]
+		if len(parts) > 1 {
+			app := parts[1]
+			if app == appPlaceholder {
+				app = "{app}"
+			}
+			ref += "." + app
+		}
+		return ref, true
+	}
+
+	if strings.Contains(dep.ConfigPath, "${") {
+		return "", false
+	}
+	path := dep.ConfigPath
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(mod.Dir, path)
+	}
+	target, ok := byDir[filepath.Clean(path)]
+	if !ok {
+		return "", false
+	}
+
+	region := target.Region
+	if region == mod.Region {
+		region = "{region}"
+	}
+	ref := region + "." + target.Component
+	if target.App != "" {
+		app := target.App
+		if app == mod.App {
+			app = "{app}"
+		}
+		ref += "." + app
+	}
+	return ref, true
+}
+
+// dependencies returns the dependency blocks of the terragrunt.hcl of a
+// directory and of the files it includes
+func dependencies(dir, repoRoot string) []dependency {
+	var deps []dependency
+	files := append([]string{filepath.Join(dir, "terragrunt.hcl")}, includes(dir, repoRoot)...)
+	for _, file := range files {
+		body, content, ok := parseFile(file)
+		if !ok {
+			continue
+		}
+		for _, block := range body.Blocks {
+			if block.Type != "dependency" || len(block.Labels) == 0 {
+				continue
+			}
+			attr, ok := block.Body.Attributes["config_path"]
+			if !ok {
+				continue
+			}
+			dep := dependency{
+				Name:       block.Labels[0],
+				ConfigPath: expressionText(attr.Expr, content),
+			}
+			if skip, ok := block.Body.Attributes["skip_outputs"]; ok {
+				dep.SkipOutputs = expressionText(skip.Expr, content) == "true"
+			}
+			deps = append(deps, dep)
+		}
+	}
+	return deps
+}
+
+// includes returns the files included by the terragrunt.hcl of a directory,
+// except those found with find_in_parent_folders such as root.hcl
+func includes(dir, repoRoot string) []string {
+	body, content, ok := parseFile(filepath.Join(dir, "terragrunt.hcl"))
+	if !ok {
+		return nil
+	}
+
+	var paths []string
+	for _, block := range body.Blocks {
+		if block.Type != "include" {
+			continue
+		}
+		attr, ok := block.Body.Attributes["path"]
+		if !ok {
+			continue
+		}
+		if path, ok := localPath(expressionText(attr.Expr, content), dir, repoRoot); ok {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// terraformSource returns the local directory of the terraform source of the
+// terragrunt.hcl of a directory
+func terraformSource(dir, repoRoot string) string {
+	body, content, ok := parseFile(filepath.Join(dir, "terragrunt.hcl"))
+	if !ok {
+		return ""
+	}
+	for _, block := range body.Blocks {
+		if block.Type != "terraform" {
+			continue
+		}
+		if attr, ok := block.Body.Attributes["source"]; ok {
+			if path, ok := localPath(expressionText(attr.Expr, content), dir, repoRoot); ok {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// localPath resolves a path expression relative to dir or the repo root,
+// returning false for remote sources and dynamic paths
+func localPath(path, dir, repoRoot string) (string, bool) {
+	path = strings.ReplaceAll(path, "${get_repo_root()}", repoRoot)
+	if strings.Contains(path, "${") || strings.Contains(path, "(") || strings.Contains(path, "::") {
+		return "", false
+	}
+	if strings.HasPrefix(path, "git@") || strings.Contains(path, "//") {
+		return "", false
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	return filepath.Clean(path), true
+}
+
+// readLocals returns the string literal locals of an HCL file
+func readLocals(path string) map[string]string {
+	locals := make(map[string]string)
+	if path == "" {
+		return locals
+	}
+	body, _, ok := parseFile(path)
+	if !ok {
+		return locals
+	}
+	for _, block := range body.Blocks {
+		if block.Type != "locals" {
+			continue
+		}
+		for name, attr := range block.Body.Attributes {
+			value, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() || !value.IsKnown() || value.IsNull() || value.Type().FriendlyName() != "string" {
+				continue
+			}
+			locals[name] = value.AsString()
+		}
+	}
+	return locals
+}
+
+// findUp returns the first of the named files in dir or its parents up to root
+func findUp(dir, root string, names ...string) string {
+	for {
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+			if _, err := project.Stat(path); err == nil {
+				return path
+			}
+		}
+		if dir == root || dir == filepath.Dir(dir) {
+			return ""
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// parseFile parses an HCL file
+func parseFile(path string) (*hclsyntax.Body, []byte, bool) {
+	content, err := project.ReadFile(path)
+	if err != nil {
+		return nil, nil, false
+	}
+	file, diags := hclparse.NewParser().ParseHCL(content, path)
+	if diags.HasErrors() {
+		return nil, nil, false
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	return body, content, ok
+}
+
+// expressionText returns the source of an expression without quotes
+func expressionText(expr hclsyntax.Expression, content []byte) string {
+	text := strings.TrimSpace(string(expr.Range().SliceBytes(content)))
+	return strings.TrimSuffix(strings.TrimPrefix(text, `"`), `"`)
+}
+
+// projectName returns the project name of a tgs tree from its global.hcl,
+// or one derived from the repository folder
+func projectName(root, repoRoot string) string {
+	if name := readLocals(filepath.Join(root, "config", "global.hcl"))["project_name"]; name != "" {
+		return name
+	}
+	name := projectNamePattern.ReplaceAllString(strings.ToLower(filepath.Base(repoRoot)), "-")
+	if name = strings.Trim(name, "-"); name == "" {
+		return "project"
+	}
+	return name
+}
+
+// setPrefix records a prefix override, creating the map on first use
+func setPrefix(prefixes *map[string]string, name, prefix string) {
+	if *prefixes == nil {
+		*prefixes = make(map[string]string)
+	}
+	(*prefixes)[name] = prefix
+}
+
+// contains reports whether values holds value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// appendUnique appends value unless values already holds it
+func appendUnique(values []string, value string) []string {
+	if contains(values, value) {
+		return values
+	}
+	return append(values, value)
+}
+
+// Write writes the imported tgs.yaml and stack configurations into .tgs.
+// Existing configuration is only replaced with force.
+func Write(result *Result, force bool) error {
+	tgsPath := filepath.Join(".tgs", "tgs.yaml")
+	if _, err := project.Stat(tgsPath); err == nil && !force {
+		return fmt.Errorf("%s already exists: use --force to overwrite it", tgsPath)
+	}
+
+	if err := project.MkdirAll(filepath.Join(".tgs", "stacks"), 0755); err != nil {
+		return fmt.Errorf("failed to create stacks directory: %w", err)
+	}
+
+	if err := writeYAML(tgsPath, result.TGSConfig); err != nil {
+		return fmt.Errorf("failed to write tgs.yaml: %w", err)
+	}
+	for name, stack := range result.Stacks {
+		for region := range stack.Stack.Architecture.Regions {
+			components := stack.Stack.Architecture.Regions[region]
+			sort.Slice(components, func(i, j int) bool { return components[i].Component < components[j].Component })
+		}
+		if err := writeYAML(filepath.Join(".tgs", "stacks", name+".yaml"), stack); err != nil {
+			return fmt.Errorf("failed to write stack %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// writeYAML writes value as YAML with two space indentation
+func writeYAML(path string, value interface{}) error {
+	f, err := project.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	encoder := yaml.NewEncoder(f)
+	encoder.SetIndent(2)
+	return encoder.Encode(value)
+}
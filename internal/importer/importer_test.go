@@ -0,0 +1,156 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportTGSTree(t *testing.T) {
+	root := filepath.Join(t.TempDir(), ".infrastructure")
+	arch := filepath.Join(root, "architecture", "main", "nonprod", "eastus2", "dev")
+
+	writeFile(t, filepath.Join(root, "config", "global.hcl"), `locals {
+  project_name = "projecta"
+}
+`)
+	writeFile(t, filepath.Join(root, "architecture", "main", "nonprod", "subscription.hcl"), `locals {
+  remote_state_storage_account = "stprojectanonprodtf"
+  remote_state_resource_group  = "rg-projecta-nonprod-tf"
+}
+`)
+	writeFile(t, filepath.Join(root, "_components", "main", "redis", "component.hcl"), `locals {
+  provider_source  = "azurerm_redis_cache"
+  provider_version = "4.22.0"
+}
+`)
+	writeFile(t, filepath.Join(root, "_components", "main", "appservice", "component.hcl"), `locals {
+  provider_source  = "azurerm_linux_web_app"
+  provider_version = "4.22.0"
+}
+
+dependency "redis" {
+  config_path  = "${get_repo_root()}/.infrastructure/architecture/${local.stack_name}/${local.subscription_vars.locals.subscription_name}/${local.region_vars.locals.region_name}/${local.environment_vars.locals.environment_name}/redis"
+  skip_outputs = true
+}
+`)
+	writeFile(t, filepath.Join(arch, "redis", "terragrunt.hcl"), `include "component" {
+  path = "${get_repo_root()}/.infrastructure/_components/main/redis/component.hcl"
+}
+`)
+	writeFile(t, filepath.Join(arch, "appservice", "api", "terragrunt.hcl"), `include "root" {
+  path = find_in_parent_folders("root.hcl")
+}
+
+include "component" {
+  path = "${get_repo_root()}/.infrastructure/_components/main/appservice/component.hcl"
+}
+`)
+
+	result, err := Import(root)
+	if err != nil {
+		t.Fatalf("Import() unexpected error: %v", err)
+	}
+
+	if result.TGSConfig.Name != "projecta" {
+		t.Errorf("project name = %q, want projecta", result.TGSConfig.Name)
+	}
+	sub := result.TGSConfig.Subscriptions["nonprod"]
+	if sub.RemoteState.Name != "stprojectanonprodtf" || len(sub.Environments) != 1 || sub.Environments[0].Name != "dev" {
+		t.Errorf("subscription nonprod = %+v", sub)
+	}
+
+	stack := result.Stacks["main"]
+	if stack == nil {
+		t.Fatal("stack main not imported")
+	}
+	appservice := stack.Stack.Components["appservice"]
+	if appservice.Source != "azurerm_linux_web_app" || !reflect.DeepEqual(appservice.Deps, []string{"{region}.redis"}) {
+		t.Errorf("appservice = %+v", appservice)
+	}
+	if !appservice.DependencyOptions["{region}.redis"].SkipOutputs {
+		t.Errorf("skip_outputs of {region}.redis not imported")
+	}
+	if got := len(stack.Stack.Architecture.Regions["eastus2"]); got != 2 {
+		t.Errorf("eastus2 has %d components, want 2", got)
+	}
+}
+
+func TestImportGenericTree(t *testing.T) {
+	root := t.TempDir()
+
+	writeFile(t, filepath.Join(root, "prod", "account.hcl"), `locals {
+  remote_state_storage_account = "stlive"
+  remote_state_resource_group  = "rg-live"
+}
+`)
+	writeFile(t, filepath.Join(root, "prod", "eastus", "prod", "env.hcl"), "locals {}\n")
+	writeFile(t, filepath.Join(root, "prod", "westus", "prod", "env.hcl"), "locals {}\n")
+	writeFile(t, filepath.Join(root, "modules", "kv", "main.tf"), `terraform {
+  required_providers {
+    azurerm = {
+      source  = "hashicorp/azurerm"
+      version = "~> 4.10.0"
+    }
+  }
+}
+
+resource "azurerm_key_vault" "this" {}
+`)
+	for _, region := range []string{"eastus", "westus"} {
+		writeFile(t, filepath.Join(root, "prod", region, "prod", "keyvault", "terragrunt.hcl"), `terraform {
+  source = "../../../../modules/kv"
+}
+`)
+	}
+	writeFile(t, filepath.Join(root, "prod", "eastus", "prod", "app", "api", "terragrunt.hcl"), `dependency "kv" {
+  config_path = "../../keyvault"
+}
+
+dependency "west" {
+  config_path = "../../../../westus/prod/keyvault"
+}
+
+dependency "network" {
+  config_path = "../../../../../../platform/network"
+}
+`)
+
+	result, err := Import(root)
+	if err != nil {
+		t.Fatalf("Import() unexpected error: %v", err)
+	}
+
+	sub, ok := result.TGSConfig.Subscriptions["prod"]
+	if !ok || sub.RemoteState.Name != "stlive" {
+		t.Errorf("subscription prod = %+v", sub)
+	}
+
+	stack := result.Stacks["main"]
+	keyvault := stack.Stack.Components["keyvault"]
+	if keyvault.Source != "azurerm_key_vault" || keyvault.Version != "4.10.0" {
+		t.Errorf("keyvault = %+v", keyvault)
+	}
+
+	app := stack.Stack.Components["app"]
+	if want := []string{"{region}.keyvault", "westus.keyvault"}; !reflect.DeepEqual(app.Deps, want) {
+		t.Errorf("app deps = %v, want %v", app.Deps, want)
+	}
+	if !reflect.DeepEqual(app.ExternalDeps, []string{"network"}) {
+		t.Errorf("app external deps = %v, want [network]", app.ExternalDeps)
+	}
+	if rc := stack.Stack.Architecture.Regions["eastus"]; len(rc) != 2 || !reflect.DeepEqual(rc[0].Apps, []string{"api"}) {
+		t.Errorf("eastus components = %+v", rc)
+	}
+}
@@ -0,0 +1,169 @@
+// Package lock keeps concurrent tgs runs, e.g. a pipeline and a developer,
+// from interleaving writes into the same project
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"gopkg.in/yaml.v3"
+)
+
+// File is the lock of a project, relative to its root
+const File = ".tgs/lock"
+
+// Owner describes the run holding the lock
+type Owner struct {
+	Command  string    `yaml:"command"`
+	User     string    `yaml:"user"`
+	Host     string    `yaml:"host"`
+	PID      int       `yaml:"pid"`
+	Acquired time.Time `yaml:"acquired"`
+}
+
+func (o Owner) String() string {
+	return fmt.Sprintf("tgs %s by %s on %s (pid %d) since %s", o.Command, o.User, o.Host, o.PID, o.Acquired.Format(time.RFC3339))
+}
+
+// held counts the nested acquisitions of this process, e.g. generate run by
+// rename, which share the lock
+var (
+	mu   sync.Mutex
+	held int
+)
+
+// Acquire takes the lock of the project for command, returning the function
+// releasing it. A lock held by another running process fails with an error
+// naming its owner. Locks left by processes of this host that exited are
+// taken over.
+func Acquire(command string) (func(), error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if held == 0 {
+		if err := create(command); err != nil {
+			return nil, err
+		}
+	}
+	held++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			mu.Lock()
+			defer mu.Unlock()
+			if held--; held == 0 {
+				project.Remove(File)
+			}
+		})
+	}, nil
+}
+
+// create writes the lock file, taking over a stale one
+func create(command string) error {
+	owner := currentOwner(command)
+	data, err := yaml.Marshal(owner)
+	if err != nil {
+		return fmt.Errorf("failed to marshal lock: %w", err)
+	}
+	if err := project.MkdirAll(filepath.Dir(File), 0755); err != nil {
+		return fmt.Errorf("failed to create lock directory: %w", err)
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := project.OpenFile(File, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = file.Write(data)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				project.Remove(File)
+				return fmt.Errorf("failed to write lock: %w", err)
+			}
+			return nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("failed to create lock: %w", err)
+		}
+
+		holder, err := Read()
+		if err != nil {
+			return err
+		}
+		if holder != nil && !stale(*holder, owner.Host) {
+			return fmt.Errorf("project is locked by %s, remove %s or run tgs unlock if that run is gone", holder, File)
+		}
+		if err := project.Remove(File); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove stale lock: %w", err)
+		}
+	}
+	return fmt.Errorf("failed to acquire lock %s", File)
+}
+
+// Read returns the owner of the lock, nil when the project isn't locked
+func Read() (*Owner, error) {
+	data, err := project.ReadFile(File)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock: %w", err)
+	}
+
+	var owner Owner
+	if err := yaml.Unmarshal(data, &owner); err != nil {
+		return nil, fmt.Errorf("failed to parse lock %s: %w", File, err)
+	}
+	return &owner, nil
+}
+
+// Break removes the lock regardless of its owner
+func Break() error {
+	if err := project.Remove(File); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove lock: %w", err)
+	}
+	return nil
+}
+
+// stale reports whether the owner of a lock was a process of host that
+// exited. Locks of other hosts are never stale, their processes can't be
+// checked.
+func stale(owner Owner, host string) bool {
+	return owner.Host == host && !running(owner.PID)
+}
+
+// running reports whether a process exists
+func running(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// FindProcess only succeeds for existing processes on Windows
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// currentOwner describes this process running command
+func currentOwner(command string) Owner {
+	owner := Owner{Command: command, PID: os.Getpid(), Acquired: time.Now().UTC().Truncate(time.Second)}
+	owner.Host, _ = os.Hostname()
+	if current, err := user.Current(); err == nil {
+		owner.User = current.Username
+	}
+	return owner
+}
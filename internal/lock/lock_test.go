@@ -0,0 +1,56 @@
+package lock
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestAcquire(t *testing.T) {
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// Nested acquisitions share the lock
+	release, err := Acquire("generate")
+	if err != nil {
+		t.Fatalf("Acquire() unexpected error: %v", err)
+	}
+	nested, err := Acquire("plan")
+	if err != nil {
+		t.Fatalf("nested Acquire() unexpected error: %v", err)
+	}
+	nested()
+	if owner, _ := Read(); owner == nil || owner.Command != "generate" {
+		t.Errorf("Read() = %v, want the lock of generate", owner)
+	}
+	release()
+	if owner, _ := Read(); owner != nil {
+		t.Errorf("Read() = %v after release, want no lock", owner)
+	}
+
+	// Locks of other hosts fail, locks of exited processes are taken over
+	writeLock := func(owner Owner) {
+		data, _ := yaml.Marshal(owner)
+		if err := os.WriteFile(File, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeLock(Owner{Command: "generate", Host: "ci-agent", PID: os.Getpid()})
+	if _, err := Acquire("plan"); err == nil || !strings.Contains(err.Error(), "ci-agent") {
+		t.Errorf("Acquire() error = %v, want the owner of the lock", err)
+	}
+
+	host, _ := os.Hostname()
+	writeLock(Owner{Command: "generate", Host: host, PID: -1})
+	release, err = Acquire("plan")
+	if err != nil {
+		t.Fatalf("Acquire() should take over a stale lock: %v", err)
+	}
+	release()
+}
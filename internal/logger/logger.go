@@ -1,12 +1,15 @@
 package logger
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/schollz/progressbar/v3"
+	"golang.org/x/term"
 )
 
 const (
@@ -20,13 +23,142 @@ const (
 	ClearLine    = "\r\033[K"
 )
 
+// Level is the severity of a log message
+type Level int
+
+// Log levels, from the most verbose
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarning
+	LevelError
+)
+
+// Log formats of SetFormat
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Formats lists the supported log formats
+var Formats = []string{FormatText, FormatJSON}
+
 var (
 	bar     *progressbar.ProgressBar
 	history []string
+	quiet   bool
+	level   = LevelInfo
+	format  = FormatText
+	logFile *os.File
+	pretty  bool
+	out     io.Writer = os.Stdout
+	// colors and progress bars are only written to terminals
+	colors   = detectColors(os.Stdout)
+	progress = isTerminal(os.Stderr)
+	// colorForced is the choice of SetColor, which SetOutput keeps
+	colorForced *bool
 )
 
-// StartProgress initializes a progress bar with the given description and total
+// detectColors reports whether messages written to w are colored by default
+func detectColors(w io.Writer) bool {
+	return isTerminal(w) && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb"
+}
+
+// isTerminal reports whether a writer is a terminal
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(file.Fd()))
+}
+
+// SetOutput writes log messages to w instead of stdout. Colors, unless set
+// with SetColor, and progress bars are only kept when w is a terminal.
+func SetOutput(w io.Writer) {
+	out = w
+	colors = detectColors(w)
+	if colorForced != nil {
+		colors = *colorForced
+	}
+	progress = w == os.Stdout && isTerminal(os.Stderr)
+}
+
+// String returns the name of a level as written in JSON logs
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelWarning:
+		return "warning"
+	case LevelError:
+		return "error"
+	}
+	return "info"
+}
+
+// Output returns the writer of log messages
+func Output() io.Writer {
+	return out
+}
+
+// SetQuiet suppresses log output below the warning level and progress bars
+// when enabled, so warnings and errors are still reported
+func SetQuiet(enabled bool) {
+	quiet = enabled
+}
+
+// SetColor enables or disables ANSI colors, for every output. They're
+// enabled by default when the output is a terminal and NO_COLOR isn't set.
+func SetColor(enabled bool) {
+	colors = enabled
+	colorForced = &enabled
+}
+
+// SetPretty paces log messages with a short delay between them, for
+// following a run interactively
+func SetPretty(enabled bool) {
+	pretty = enabled
+}
+
+// SetLevel sets the lowest level of the messages printed
+func SetLevel(l Level) {
+	level = l
+}
+
+// SetFormat prints messages as colored text or as JSON lines with the time,
+// level and message. JSON output has no progress bars.
+func SetFormat(f string) error {
+	if f != FormatText && f != FormatJSON {
+		return fmt.Errorf("unsupported log format %q: must be one of %s", f, strings.Join(Formats, ", "))
+	}
+	format = f
+	return nil
+}
+
+// SetLogFile appends every message, debug ones included, to a file in the log
+// format without colors. Close closes it.
+func SetLogFile(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	logFile = file
+	return nil
+}
+
+// Close closes the log file of SetLogFile
+func Close() {
+	if logFile != nil {
+		logFile.Close()
+		logFile = nil
+	}
+}
+
+// StartProgress initializes a progress bar with the given description and
+// total. Bars are only shown on terminals, for text logs at the info level.
 func StartProgress(description string, total int) {
+	if quiet || !progress || format == FormatJSON || level > LevelInfo {
+		return
+	}
+
 	// Clear any existing progress bar
 	if bar != nil {
 		bar.Finish()
@@ -73,11 +205,22 @@ func FinishProgress() {
 	}
 }
 
-// sleep adds a small delay between log messages for better readability
+// sleep adds a small delay between log messages in pretty mode
 func sleep() {
+	if quiet || !pretty {
+		return
+	}
 	time.Sleep(100 * time.Millisecond)
 }
 
+// paint colors a message with a color format when colors are enabled
+func paint(color, message string) string {
+	if !colors {
+		return message
+	}
+	return fmt.Sprintf(color, message)
+}
+
 // shouldKeepInHistory determines if a success message should be kept in history
 func shouldKeepInHistory(message string) bool {
 	// Keep important success messages
@@ -115,60 +258,105 @@ func printWithHistory(message string, isSuccess bool) {
 
 		// Move up enough lines to show all history
 		for i := 0; i < len(history); i++ {
-			fmt.Print(MoveUp + ClearLine)
+			fmt.Fprint(out, MoveUp+ClearLine)
 		}
 
 		// Print all history
 		for _, msg := range history {
-			fmt.Println(msg)
+			fmt.Fprintln(out, msg)
 		}
 
 		// Print the current message
-		fmt.Println(message)
+		fmt.Fprintln(out, message)
 
 		// Move back down to the progress bar
 		for i := 0; i < len(history)+1; i++ {
-			fmt.Print(MoveDown)
+			fmt.Fprint(out, MoveDown)
 		}
 	} else {
-		fmt.Println(message)
+		fmt.Fprintln(out, message)
 	}
 }
 
+// Info logs a message at the info level
 func Info(format string, args ...interface{}) {
-	sleep()
-	message := fmt.Sprintf(InfoColor, fmt.Sprintf("ℹ️  "+format, args...))
-	printWithHistory(message, false)
+	log(LevelInfo, InfoColor, "ℹ️  ", false, fmt.Sprintf(format, args...))
 }
 
+// Success logs the success of a step at the info level
 func Success(format string, args ...interface{}) {
-	sleep()
-	message := fmt.Sprintf(NoticeColor, fmt.Sprintf("✅ "+format, args...))
-	printWithHistory(message, true)
+	log(LevelInfo, NoticeColor, "✅ ", true, fmt.Sprintf(format, args...))
 }
 
+// Warning logs a message at the warning level
 func Warning(format string, args ...interface{}) {
-	sleep()
-	message := fmt.Sprintf(WarningColor, fmt.Sprintf("⚠️  "+format, args...))
-	printWithHistory(message, false)
+	log(LevelWarning, WarningColor, "⚠️  ", false, fmt.Sprintf(format, args...))
 }
 
+// Error logs a message at the error level
 func Error(format string, args ...interface{}) {
-	sleep()
-	message := fmt.Sprintf(ErrorColor, fmt.Sprintf("❌ "+format, args...))
-	printWithHistory(message, false)
+	log(LevelError, ErrorColor, "❌ ", false, fmt.Sprintf(format, args...))
 }
 
+// Debug logs a message at the debug level, only printed when verbose
 func Debug(format string, args ...interface{}) {
-	sleep()
-	message := fmt.Sprintf(DebugColor, fmt.Sprintf("🔍 "+format, args...))
-	printWithHistory(message, false)
+	log(LevelDebug, DebugColor, "🔍 ", false, fmt.Sprintf(format, args...))
 }
 
+// Section logs the heading of a group of messages at the info level
 func Section(name string) {
+	if format == FormatJSON {
+		log(LevelInfo, "%s", "", false, name)
+		return
+	}
 	sleep()
-	message := fmt.Sprintf("\n%s\n%s", strings.Repeat("=", len(name)+4), name)
-	printWithHistory(message, false)
+	if quiet {
+		return
+	}
+	if level <= LevelInfo {
+		printWithHistory(fmt.Sprintf("\n%s\n%s", strings.Repeat("=", len(name)+4), name), false)
+	}
+	writeLogFile(LevelInfo, name)
+}
+
+// log prints a message of a level in the log format and writes it to the log
+// file
+func log(l Level, color, prefix string, isSuccess bool, message string) {
+	if quiet && l < LevelWarning {
+		return
+	}
+	writeLogFile(l, message)
+	if l < level {
+		return
+	}
+	if format == FormatJSON {
+		writeJSON(out, l, message)
+		return
+	}
+	sleep()
+	printWithHistory(paint(color, prefix+message), isSuccess)
+}
+
+// writeLogFile writes a message to the log file, if any
+func writeLogFile(l Level, message string) {
+	if logFile == nil || (quiet && l < LevelWarning) {
+		return
+	}
+	if format == FormatJSON {
+		writeJSON(logFile, l, message)
+		return
+	}
+	fmt.Fprintf(logFile, "%s %-7s %s\n", time.Now().Format(time.RFC3339), strings.ToUpper(l.String()), message)
+}
+
+// writeJSON writes a message as a JSON line
+func writeJSON(w io.Writer, l Level, message string) {
+	data, _ := json.Marshal(struct {
+		Time    string `json:"time"`
+		Level   string `json:"level"`
+		Message string `json:"message"`
+	}{time.Now().Format(time.RFC3339), l.String(), message})
+	fmt.Fprintln(w, string(data))
 }
 
 // StartSpinner starts a loading spinner with the given message
@@ -0,0 +1,262 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useBuffer logs to a buffer for the test, restoring the logger settings
+// afterwards
+func useBuffer(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	t.Cleanup(func() {
+		colorForced = nil
+		quiet = false
+		pretty = false
+		level = LevelInfo
+		format = FormatText
+		Close()
+		SetOutput(os.Stdout)
+	})
+	SetOutput(&buf)
+	return &buf
+}
+
+func TestSetColor(t *testing.T) {
+	buf := useBuffer(t)
+
+	// A buffer isn't a terminal
+	Warning("default")
+	if strings.Contains(buf.String(), "\033[") {
+		t.Errorf("Warning() to a buffer = %q, want no colors", buf.String())
+	}
+
+	// An explicit choice survives changing the output, like --no-color while
+	// plan renders to stderr
+	for _, enabled := range []bool{true, false} {
+		SetColor(enabled)
+		SetOutput(os.Stderr)
+		buf.Reset()
+		SetOutput(buf)
+		Warning("forced")
+		if got := strings.Contains(buf.String(), "\033[1;33m"); got != enabled {
+			t.Errorf("Warning() after SetColor(%v) and SetOutput() = %q, want colors %v", enabled, buf.String(), enabled)
+		}
+	}
+}
+
+func TestLevels(t *testing.T) {
+	testCases := []struct {
+		name  string
+		level Level
+		quiet bool
+		want  []string
+	}{
+		{name: "Info", level: LevelInfo, want: []string{"info", "success", "warning", "error"}},
+		{name: "Verbose", level: LevelDebug, want: []string{"debug", "info", "success", "warning", "error"}},
+		{name: "Warning", level: LevelWarning, want: []string{"warning", "error"}},
+		{name: "Quiet", level: LevelDebug, quiet: true, want: []string{"warning", "error"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := useBuffer(t)
+			SetLevel(tc.level)
+			SetQuiet(tc.quiet)
+
+			Debug("debug")
+			Info("info")
+			Success("success")
+			Warning("warning")
+			Error("error")
+
+			var got []string
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				fields := strings.Fields(line)
+				got = append(got, fields[len(fields)-1])
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("logged %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	buf := useBuffer(t)
+	if err := SetFormat(FormatJSON); err != nil {
+		t.Fatalf("SetFormat() unexpected error: %v", err)
+	}
+	SetColor(true)
+
+	Info("generated %d components", 3)
+	Section("Validation")
+	Warning("missing \"source\"")
+
+	type entry struct {
+		Time    string `json:"time"`
+		Level   string `json:"level"`
+		Message string `json:"message"`
+	}
+	var got []entry
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", line, err)
+		}
+		if _, err := time.Parse(time.RFC3339, e.Time); err != nil {
+			t.Errorf("log line %q has an invalid time: %v", line, err)
+		}
+		e.Time = ""
+		got = append(got, e)
+	}
+
+	// JSON messages have no colors or emoji prefixes
+	want := []entry{
+		{Level: "info", Message: "generated 3 components"},
+		{Level: "info", Message: "Validation"},
+		{Level: "warning", Message: `missing "source"`},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JSON logs = %+v, want %+v", got, want)
+	}
+
+	if err := SetFormat("xml"); err == nil {
+		t.Error("SetFormat(xml) expected an error")
+	}
+}
+
+func TestLogFile(t *testing.T) {
+	buf := useBuffer(t)
+	SetColor(true)
+	path := filepath.Join(t.TempDir(), "tgs.log")
+	if err := os.WriteFile(path, []byte("previous run\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetLogFile(path); err != nil {
+		t.Fatalf("SetLogFile() unexpected error: %v", err)
+	}
+
+	// The file gets debug messages the output doesn't show, without colors
+	Debug("resolving providers")
+	Warning("deprecated field")
+	Close()
+
+	if strings.Contains(buf.String(), "resolving providers") {
+		t.Errorf("output %q has the debug message", buf.String())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 || lines[0] != "previous run" {
+		t.Fatalf("log file = %q, want the previous run and 2 messages appended", data)
+	}
+	for i, want := range []string{"DEBUG   resolving providers", "WARNING deprecated field"} {
+		line := lines[i+1]
+		timestamp, message, _ := strings.Cut(line, " ")
+		if _, err := time.Parse(time.RFC3339, timestamp); err != nil || message != want {
+			t.Errorf("log file line %q, want a time and %q", line, want)
+		}
+	}
+
+	// Quiet runs only keep warnings and errors in the file too
+	if err := SetLogFile(path); err != nil {
+		t.Fatalf("SetLogFile() unexpected error: %v", err)
+	}
+	SetQuiet(true)
+	SetFormat(FormatJSON)
+	Info("skipped")
+	Error("failed")
+	Close()
+
+	data, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	lines = strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 4 || !strings.Contains(lines[3], `"level":"error","message":"failed"`) {
+		t.Errorf("quiet JSON log file = %q, want only the error appended", data)
+	}
+
+	if err := SetLogFile(filepath.Join(t.TempDir(), "missing", "tgs.log")); err == nil {
+		t.Error("SetLogFile() in a missing directory expected an error")
+	}
+}
+
+func TestDetectColors(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	defer writer.Close()
+
+	// Pipes and buffers, like CI logs, are not terminals
+	t.Setenv("NO_COLOR", "")
+	t.Setenv("TERM", "xterm-256color")
+	for _, w := range []io.Writer{writer, &bytes.Buffer{}} {
+		if isTerminal(w) || detectColors(w) {
+			t.Errorf("%T is detected as a colored terminal", w)
+		}
+	}
+
+	// A terminal is colored unless NO_COLOR is set or TERM is dumb
+	if tty, err := os.Open("/dev/tty"); err == nil && isTerminal(tty) {
+		defer tty.Close()
+		if !detectColors(tty) {
+			t.Error("detectColors() of a terminal = false, want true")
+		}
+		t.Setenv("NO_COLOR", "1")
+		if detectColors(tty) {
+			t.Error("detectColors() with NO_COLOR = true, want false")
+		}
+		t.Setenv("NO_COLOR", "")
+		t.Setenv("TERM", "dumb")
+		if detectColors(tty) {
+			t.Error("detectColors() with TERM=dumb = true, want false")
+		}
+	}
+}
+
+func TestCIOutput(t *testing.T) {
+	buf := useBuffer(t)
+
+	// Logging to a buffer has no sleeps, progress bars or colors
+	start := time.Now()
+	StartProgress("Generating", 20)
+	for i := 0; i < 20; i++ {
+		Info("component %d", i)
+		Success("component %d done", i)
+		UpdateProgress()
+	}
+	FinishProgress()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("logging 40 messages took %v, want no delays", elapsed)
+	}
+	if bar != nil {
+		t.Error("StartProgress() created a progress bar for a buffer")
+	}
+	if strings.Contains(buf.String(), "\033[") {
+		t.Errorf("output to a buffer has escape sequences: %q", buf.String())
+	}
+	if !strings.HasPrefix(buf.String(), "ℹ️  component 0\n✅ component 0 done\n") {
+		t.Errorf("output = %q, want plain prefixed lines", buf.String())
+	}
+
+	// Pretty mode paces the messages
+	SetPretty(true)
+	start = time.Now()
+	Info("paced")
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Info() in pretty mode took %v, want a delay", elapsed)
+	}
+}
@@ -0,0 +1,273 @@
+// Package mirror synchronizes templates, catalog definitions and provider
+// schemas from an internal HTTPS mirror into the local .tgs cache
+package mirror
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+)
+
+const (
+	// CacheDir is where verified mirror content is stored
+	CacheDir = ".tgs/cache/mirror"
+
+	// File kinds distributed by a mirror
+	KindTemplate = "templates"
+	KindCatalog  = "catalog"
+	KindSchema   = "schemas"
+
+	manifestName  = "manifest.json"
+	signatureName = "manifest.json.sig"
+)
+
+// httpClient is used for all mirror requests
+var httpClient = &http.Client{Timeout: 60 * time.Second}
+
+// Manifest describes the content published by a mirror
+type Manifest struct {
+	Version string         `json:"version"`
+	Files   []ManifestFile `json:"files"`
+}
+
+// ManifestFile describes a single file published by a mirror
+type ManifestFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// Kind returns the file kind derived from the first path segment
+func (f ManifestFile) Kind() string {
+	return strings.SplitN(f.Path, "/", 2)[0]
+}
+
+// Sync downloads the signed manifest from the mirror, verifies its signature
+// and every listed file, and writes the verified files into the cache
+func Sync(cfg config.MirrorConfig) (*Manifest, error) {
+	return syncTo(cfg, CacheDir)
+}
+
+func syncTo(cfg config.MirrorConfig, cacheDir string) (*Manifest, error) {
+	baseURL, err := parseMirrorURL(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := decodePublicKey(cfg.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestData, err := fetch(baseURL, manifestName)
+	if err != nil {
+		return nil, err
+	}
+
+	signatureData, err := fetch(baseURL, signatureName)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signatureData)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode manifest signature: %w", err)
+	}
+
+	if !ed25519.Verify(publicKey, manifestData, signature) {
+		return nil, fmt.Errorf("manifest signature verification failed")
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	// Download and verify everything before touching the cache so a bad
+	// mirror never leaves a half-updated cache behind
+	contents := make(map[string][]byte)
+	for _, file := range manifest.Files {
+		if err := validateFilePath(file.Path); err != nil {
+			return nil, err
+		}
+
+		data, err := fetch(baseURL, file.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		sum := sha256.Sum256(data)
+		if !strings.EqualFold(hex.EncodeToString(sum[:]), file.SHA256) {
+			return nil, fmt.Errorf("checksum mismatch for %s", file.Path)
+		}
+
+		contents[file.Path] = data
+	}
+
+	// Write the files next to the cache and swap it in, so a failed write
+	// leaves the previous sync in place
+	if err := project.MkdirAll(filepath.Dir(cacheDir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create mirror cache directory: %w", err)
+	}
+	staging := cacheDir + ".new"
+	if err := project.RemoveAll(staging); err != nil {
+		return nil, fmt.Errorf("failed to clear mirror staging directory: %w", err)
+	}
+	if err := writeCache(staging, contents, manifestData); err != nil {
+		project.RemoveAll(staging)
+		return nil, err
+	}
+
+	previous := cacheDir + ".old"
+	if err := project.RemoveAll(previous); err != nil {
+		project.RemoveAll(staging)
+		return nil, fmt.Errorf("failed to clear previous mirror cache: %w", err)
+	}
+	if _, err := project.Stat(cacheDir); err == nil {
+		if err := project.Rename(cacheDir, previous); err != nil {
+			project.RemoveAll(staging)
+			return nil, fmt.Errorf("failed to replace mirror cache: %w", err)
+		}
+	}
+	if err := project.Rename(staging, cacheDir); err != nil {
+		project.Rename(previous, cacheDir)
+		project.RemoveAll(staging)
+		return nil, fmt.Errorf("failed to replace mirror cache: %w", err)
+	}
+	project.RemoveAll(previous)
+
+	return &manifest, nil
+}
+
+// writeCache writes the mirrored files and their manifest into dir
+func writeCache(dir string, contents map[string][]byte, manifestData []byte) error {
+	for filePath, data := range contents {
+		target := filepath.Join(dir, filepath.FromSlash(filePath))
+		if err := project.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", filePath, err)
+		}
+		if err := project.WriteFile(target, data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", filePath, err)
+		}
+	}
+
+	if err := project.WriteFile(filepath.Join(dir, manifestName), manifestData, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// Lookup returns the cached path of a mirrored file if it exists
+func Lookup(kind, name string) (string, bool) {
+	target := filepath.Join(CacheDir, kind, filepath.FromSlash(name))
+	if info, err := project.Stat(target); err == nil && !info.IsDir() {
+		return target, true
+	}
+	return "", false
+}
+
+// SchemaPath returns the mirror path of a pre-baked provider schema
+func SchemaPath(provider, version string) string {
+	return path.Join(provider, version+".json")
+}
+
+// parseMirrorURL ensures the mirror is served over HTTPS
+func parseMirrorURL(raw string) (*url.URL, error) {
+	if raw == "" {
+		return nil, fmt.Errorf("mirror url is not configured")
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mirror url: %w", err)
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("mirror url must use https: %s", raw)
+	}
+
+	return u, nil
+}
+
+// decodePublicKey decodes a base64 encoded ed25519 public key, either the
+// raw 32 byte key or its DER encoded SubjectPublicKeyInfo as printed by
+// openssl pkey -pubout, with or without the PEM armor
+func decodePublicKey(raw string) (ed25519.PublicKey, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, fmt.Errorf("mirror public_key is not configured")
+	}
+
+	if block, _ := pem.Decode([]byte(raw)); block != nil {
+		raw = base64.StdEncoding.EncodeToString(block.Bytes)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(raw), ""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode mirror public key: %w", err)
+	}
+	if len(key) == ed25519.PublicKeySize {
+		return ed25519.PublicKey(key), nil
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("mirror public key must be a %d byte ed25519 key or its SubjectPublicKeyInfo, got %d bytes", ed25519.PublicKeySize, len(key))
+	}
+	publicKey, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("mirror public key must be an ed25519 key, got %T", parsed)
+	}
+	return publicKey, nil
+}
+
+// validateFilePath rejects manifest entries that could escape the cache,
+// including Windows separators and drives the slash path checks don't see
+func validateFilePath(filePath string) error {
+	clean := path.Clean(filePath)
+	if clean != filePath || path.IsAbs(clean) || strings.HasPrefix(clean, "../") || clean == ".." ||
+		strings.ContainsAny(filePath, `\:`) || filepath.VolumeName(filePath) != "" {
+		return fmt.Errorf("invalid file path in manifest: %s", filePath)
+	}
+
+	switch (ManifestFile{Path: clean}).Kind() {
+	case KindTemplate, KindCatalog, KindSchema:
+		return nil
+	default:
+		return fmt.Errorf("unsupported file kind in manifest: %s", filePath)
+	}
+}
+
+// fetch downloads a file relative to the mirror base URL
+func fetch(baseURL *url.URL, name string) ([]byte, error) {
+	target := baseURL.JoinPath(name)
+
+	resp, err := httpClient.Get(target.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", name, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,244 @@
+package mirror
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+)
+
+// newTestMirror serves the given files plus a manifest signed with key
+func newTestMirror(t *testing.T, key ed25519.PrivateKey, files map[string]string, tamper bool) *httptest.Server {
+	t.Helper()
+
+	var manifest Manifest
+	manifest.Version = "1"
+	for name, content := range files {
+		sum := sha256.Sum256([]byte(content))
+		manifest.Files = append(manifest.Files, ManifestFile{Path: name, SHA256: hex.EncodeToString(sum[:])})
+	}
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("Failed to marshal manifest: %v", err)
+	}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, manifestData))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/mirror/")
+		switch name {
+		case manifestName:
+			w.Write(manifestData)
+		case signatureName:
+			w.Write([]byte(signature))
+		default:
+			content, ok := files[name]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			if tamper {
+				content += "tampered"
+			}
+			w.Write([]byte(content))
+		}
+	})
+
+	server := httptest.NewTLSServer(mux)
+	previous := httpClient
+	httpClient = server.Client()
+	t.Cleanup(func() {
+		httpClient = previous
+		server.Close()
+	})
+	return server
+}
+
+func TestSync(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	files := map[string]string{
+		"templates/environment/root.hcl.tmpl": "# custom root",
+		"schemas/azurerm/4.22.0.json":         `{"provider_schemas":{}}`,
+	}
+	encodedKey := base64.StdEncoding.EncodeToString(publicKey)
+
+	testCases := []struct {
+		name        string
+		signingKey  ed25519.PrivateKey
+		files       map[string]string
+		tamper      bool
+		errContains string
+	}{
+		{name: "Valid mirror", signingKey: privateKey, files: files},
+		{name: "Wrong signing key", signingKey: otherKey, files: files, errContains: "signature verification failed"},
+		{name: "Tampered file", signingKey: privateKey, files: files, tamper: true, errContains: "checksum mismatch"},
+		{name: "Path traversal", signingKey: privateKey, files: map[string]string{"../evil": "x"}, errContains: "invalid file path"},
+		{name: "Backslash path traversal", signingKey: privateKey, files: map[string]string{`templates\..\..\evil`: "x"}, errContains: "invalid file path"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestMirror(t, tc.signingKey, tc.files, tc.tamper)
+			cacheDir := t.TempDir()
+
+			_, err := syncTo(config.MirrorConfig{URL: server.URL + "/mirror", PublicKey: encodedKey}, cacheDir)
+			if tc.errContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errContains) {
+					t.Fatalf("syncTo() error = %v, want error containing %q", err, tc.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("syncTo() unexpected error: %v", err)
+			}
+
+			for name, content := range tc.files {
+				data, err := os.ReadFile(filepath.Join(cacheDir, filepath.FromSlash(name)))
+				if err != nil {
+					t.Fatalf("Expected %s in cache: %v", name, err)
+				}
+				if string(data) != content {
+					t.Errorf("Cached %s = %q, want %q", name, data, content)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncRequiresHTTPS(t *testing.T) {
+	_, err := syncTo(config.MirrorConfig{URL: "http://mirror.example.com", PublicKey: "x"}, t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "must use https") {
+		t.Fatalf("syncTo() error = %v, want https error", err)
+	}
+}
+
+func TestSyncReplacesCache(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	encodedKey := base64.StdEncoding.EncodeToString(publicKey)
+	cacheDir := filepath.Join(t.TempDir(), "mirror")
+
+	server := newTestMirror(t, privateKey, map[string]string{"templates/old.tmpl": "old"}, false)
+	if _, err := syncTo(config.MirrorConfig{URL: server.URL + "/mirror", PublicKey: encodedKey}, cacheDir); err != nil {
+		t.Fatalf("syncTo() unexpected error: %v", err)
+	}
+
+	// A failed sync keeps the previous files
+	server = newTestMirror(t, privateKey, map[string]string{"templates/new.tmpl": "new"}, true)
+	if _, err := syncTo(config.MirrorConfig{URL: server.URL + "/mirror", PublicKey: encodedKey}, cacheDir); err == nil {
+		t.Fatal("syncTo() expected an error for a tampered file")
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "templates", "old.tmpl")); err != nil {
+		t.Errorf("failed syncTo() removed the previous cache: %v", err)
+	}
+
+	// A successful sync replaces them
+	server = newTestMirror(t, privateKey, map[string]string{"templates/new.tmpl": "new"}, false)
+	if _, err := syncTo(config.MirrorConfig{URL: server.URL + "/mirror", PublicKey: encodedKey}, cacheDir); err != nil {
+		t.Fatalf("syncTo() unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "templates", "old.tmpl")); !os.IsNotExist(err) {
+		t.Errorf("syncTo() kept a file the mirror no longer serves: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "templates", "new.tmpl")); err != nil {
+		t.Errorf("syncTo() didn't write the new file: %v", err)
+	}
+	for _, leftover := range []string{cacheDir + ".new", cacheDir + ".old"} {
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			t.Errorf("syncTo() left %s behind", leftover)
+		}
+	}
+}
+
+func TestValidateFilePath(t *testing.T) {
+	testCases := []struct {
+		path  string
+		valid bool
+	}{
+		{path: "templates/environment/root.hcl.tmpl", valid: true},
+		{path: "catalog/redis.yaml", valid: true},
+		{path: "schemas/azurerm/4.22.0.json", valid: true},
+		{path: "templates/../../evil"},
+		{path: "../templates/x"},
+		{path: "/templates/x"},
+		{path: "templates//x"},
+		{path: `templates\..\..\evil`},
+		{path: `templates\x.tmpl`},
+		{path: "C:/templates/x"},
+		{path: "templates/C:x"},
+		{path: `\\server\share\templates\x`},
+		{path: "docs/readme.md"},
+	}
+
+	for _, tc := range testCases {
+		if err := validateFilePath(tc.path); (err == nil) != tc.valid {
+			t.Errorf("validateFilePath(%q) error = %v, want valid %v", tc.path, err, tc.valid)
+		}
+	}
+}
+
+func TestDecodePublicKey(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	spki := base64.StdEncoding.EncodeToString(der)
+	armored := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	testCases := []struct {
+		name        string
+		raw         string
+		errContains string
+	}{
+		{name: "Raw key", raw: base64.StdEncoding.EncodeToString(publicKey)},
+		{name: "SubjectPublicKeyInfo", raw: spki},
+		{name: "PEM", raw: armored},
+		{name: "Empty", raw: "", errContains: "not configured"},
+		{name: "Not base64", raw: "not a key!", errContains: "failed to decode"},
+		{name: "Wrong length", raw: base64.StdEncoding.EncodeToString([]byte("short")), errContains: "32 byte"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			key, err := decodePublicKey(tc.raw)
+			if tc.errContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errContains) {
+					t.Fatalf("decodePublicKey() error = %v, want error containing %q", err, tc.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodePublicKey() unexpected error: %v", err)
+			}
+			if !key.Equal(publicKey) {
+				t.Errorf("decodePublicKey() = %x, want %x", key, publicKey)
+			}
+		})
+	}
+}
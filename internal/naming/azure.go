@@ -0,0 +1,95 @@
+package naming
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Scopes within which Azure requires a resource name to be unique
+const (
+	ScopeGlobal        = "global"
+	ScopeResourceGroup = "resource group"
+)
+
+// AzureRule describes the naming constraints of an Azure resource type
+type AzureRule struct {
+	MinLength int
+	MaxLength int
+	// Pattern is the allowed character set and shape, described by Charset
+	Pattern *regexp.Regexp
+	Charset string
+	// NoConsecutiveHyphens rejects names containing "--"
+	NoConsecutiveHyphens bool
+	Scope                string
+}
+
+var (
+	lowerAlphanumeric     = regexp.MustCompile(`^[a-z0-9]+$`)
+	alphanumeric          = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+	alphanumericHyphens   = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?$`)
+	letterFirstHyphens    = regexp.MustCompile(`^[a-zA-Z]([a-zA-Z0-9-]*[a-zA-Z0-9])?$`)
+	lowerHyphens          = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+	alphanumericUnderDash = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9_-]*[a-zA-Z0-9])?$`)
+	alphanumericPeriods   = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9_.-]*[a-zA-Z0-9_])?$`)
+)
+
+const (
+	charsetLowerAlphanumeric     = "lowercase letters and numbers"
+	charsetAlphanumeric          = "letters and numbers"
+	charsetAlphanumericHyphens   = "letters, numbers and hyphens, starting and ending with a letter or number"
+	charsetLetterFirstHyphens    = "letters, numbers and hyphens, starting with a letter and ending with a letter or number"
+	charsetLowerHyphens          = "lowercase letters, numbers and hyphens, starting and ending with a letter or number"
+	charsetAlphanumericUnderDash = "letters, numbers, underscores and hyphens, starting and ending with a letter or number"
+	charsetAlphanumericPeriods   = "letters, numbers, underscores, periods and hyphens, starting with a letter or number"
+)
+
+// AzureRules holds the naming rules of supported resource types, keyed by
+// terraform resource type
+var AzureRules = map[string]AzureRule{
+	"azurerm_storage_account":         {3, 24, lowerAlphanumeric, charsetLowerAlphanumeric, false, ScopeGlobal},
+	"azurerm_key_vault":               {3, 24, letterFirstHyphens, charsetLetterFirstHyphens, true, ScopeGlobal},
+	"azurerm_linux_web_app":           {2, 60, alphanumericHyphens, charsetAlphanumericHyphens, false, ScopeGlobal},
+	"azurerm_windows_web_app":         {2, 60, alphanumericHyphens, charsetAlphanumericHyphens, false, ScopeGlobal},
+	"azurerm_app_service":             {2, 60, alphanumericHyphens, charsetAlphanumericHyphens, false, ScopeGlobal},
+	"azurerm_linux_function_app":      {2, 60, alphanumericHyphens, charsetAlphanumericHyphens, false, ScopeGlobal},
+	"azurerm_windows_function_app":    {2, 60, alphanumericHyphens, charsetAlphanumericHyphens, false, ScopeGlobal},
+	"azurerm_function_app":            {2, 60, alphanumericHyphens, charsetAlphanumericHyphens, false, ScopeGlobal},
+	"azurerm_service_plan":            {1, 60, alphanumericHyphens, charsetAlphanumericHyphens, false, ScopeResourceGroup},
+	"azurerm_app_service_plan":        {1, 60, alphanumericHyphens, charsetAlphanumericHyphens, false, ScopeResourceGroup},
+	"azurerm_redis_cache":             {1, 63, alphanumericHyphens, charsetAlphanumericHyphens, true, ScopeGlobal},
+	"azurerm_cosmosdb_account":        {3, 44, lowerHyphens, charsetLowerHyphens, false, ScopeGlobal},
+	"azurerm_sql_server":              {1, 63, lowerHyphens, charsetLowerHyphens, false, ScopeGlobal},
+	"azurerm_container_registry":      {5, 50, alphanumeric, charsetAlphanumeric, false, ScopeGlobal},
+	"azurerm_api_management":          {1, 50, letterFirstHyphens, charsetLetterFirstHyphens, false, ScopeGlobal},
+	"azurerm_servicebus_namespace":    {6, 50, letterFirstHyphens, charsetLetterFirstHyphens, false, ScopeGlobal},
+	"azurerm_eventhub_namespace":      {6, 50, letterFirstHyphens, charsetLetterFirstHyphens, false, ScopeGlobal},
+	"azurerm_kubernetes_cluster":      {1, 63, alphanumericUnderDash, charsetAlphanumericUnderDash, false, ScopeResourceGroup},
+	"azurerm_log_analytics_workspace": {4, 63, alphanumericHyphens, charsetAlphanumericHyphens, false, ScopeResourceGroup},
+	"azurerm_virtual_network":         {2, 64, alphanumericPeriods, charsetAlphanumericPeriods, false, ScopeResourceGroup},
+	"azurerm_static_site":             {1, 40, alphanumericHyphens, charsetAlphanumericHyphens, false, ScopeResourceGroup},
+	"azurerm_cdn_frontdoor_profile":   {1, 90, alphanumericHyphens, charsetAlphanumericHyphens, false, ScopeResourceGroup},
+	"azurerm_cdn_frontdoor_endpoint":  {1, 46, alphanumericHyphens, charsetAlphanumericHyphens, false, ScopeGlobal},
+	"azurerm_traffic_manager_profile": {1, 63, alphanumericHyphens, charsetAlphanumericHyphens, false, ScopeGlobal},
+}
+
+// Check returns the Azure naming rules a name of the given resource type
+// violates. Resource types without known rules always pass.
+func Check(resourceType, name string) []string {
+	rule, ok := AzureRules[resourceType]
+	if !ok {
+		return nil
+	}
+
+	var violations []string
+	if len(name) < rule.MinLength || len(name) > rule.MaxLength {
+		violations = append(violations, fmt.Sprintf("must be %d-%d characters long, got %d", rule.MinLength, rule.MaxLength, len(name)))
+	}
+	if !rule.Pattern.MatchString(name) {
+		violations = append(violations, fmt.Sprintf("may only contain %s", rule.Charset))
+	}
+	if rule.NoConsecutiveHyphens && strings.Contains(name, "--") {
+		violations = append(violations, "must not contain consecutive hyphens")
+	}
+	return violations
+}
@@ -0,0 +1,163 @@
+// Package naming resolves Azure resource names from the naming configuration
+// and checks them against Azure naming rules
+package naming
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+)
+
+// Values are the parts substituted into a naming format: the project name,
+// region and environment prefixes, resource type abbreviation and app name
+type Values struct {
+	Project     string
+	Region      string
+	Environment string
+	Type        string
+	App         string
+	Separator   string
+}
+
+// Entry is the resolved resource name of a component or app deployed to an
+// environment and region
+type Entry struct {
+	Subscription string `json:"subscription" yaml:"subscription"`
+	Environment  string `json:"environment" yaml:"environment"`
+	Region       string `json:"region" yaml:"region"`
+	Component    string `json:"component" yaml:"component"`
+	App          string `json:"app,omitempty" yaml:"app,omitempty"`
+	ResourceType string `json:"resource_type" yaml:"resource_type"`
+	Format       string `json:"format" yaml:"format"`
+	Separator    string `json:"separator" yaml:"separator"`
+	Name         string `json:"name" yaml:"name"`
+}
+
+// Deployment identifies where an entry is deployed, e.g. dev/eastus2/appservice/api
+func (e Entry) Deployment() string {
+	deployment := e.Environment + "/" + e.Region + "/" + e.Component
+	if e.App != "" {
+		deployment += "/" + e.App
+	}
+	return deployment
+}
+
+// formatKeys are the parts a naming format places
+var formatKeys = []string{"project", "region", "env", "type", "app"}
+
+// NormalizeFormat returns a naming format with its parts written ${key},
+// accepting the {key} form too
+func NormalizeFormat(format string) string {
+	var braced, dollar []string
+	for _, key := range formatKeys {
+		braced = append(braced, "${"+key+"}", "{"+key+"}")
+		dollar = append(dollar, "{"+key+"}", "${"+key+"}")
+	}
+	return strings.NewReplacer(dollar...).Replace(strings.NewReplacer(braced...).Replace(format))
+}
+
+// Resolve returns the resource name generated for values, mirroring the
+// substitution done by component.hcl. The app name is appended with the
+// separator unless the format places it with ${app}. Parts may be written
+// ${key} or {key}.
+func Resolve(format string, values Values) string {
+	format = NormalizeFormat(format)
+	name := strings.NewReplacer(
+		"${project}", values.Project,
+		"${region}", values.Region,
+		"${env}", values.Environment,
+		"${type}", values.Type,
+		"${app}", values.App,
+	).Replace(format)
+
+	if values.App != "" && !strings.Contains(format, "${app}") {
+		name += values.Separator + values.App
+	}
+	return name
+}
+
+// ForComponent returns the naming format and separator of a component,
+// applying its component_formats override, with the format normalized
+func ForComponent(cfg config.NamingConfig, component string) (string, string) {
+	format, separator := cfg.Format, cfg.DefaultSeparator
+
+	if override, ok := cfg.ComponentFormats[component]; ok {
+		if override.Format != "" {
+			format = override.Format
+		}
+		if override.Separator != nil {
+			separator = *override.Separator
+		}
+	}
+	return NormalizeFormat(format), separator
+}
+
+// Resolved returns the resource name of every component and app of a stack in
+// each environment and region it is deployed to, ordered by subscription,
+// environment, region and architecture order
+func Resolved(cfg *config.TGSConfig, stackName string, stack *config.MainConfig) []Entry {
+	var subs []string
+	for sub := range cfg.Subscriptions {
+		subs = append(subs, sub)
+	}
+	sort.Strings(subs)
+
+	var regions []string
+	for region := range stack.Stack.Architecture.Regions {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+
+	prefixes := NewPrefixes(cfg.Prefixes)
+
+	var entries []Entry
+	for _, sub := range subs {
+		for _, env := range cfg.Subscriptions[sub].Environments {
+			envStack := env.Stack
+			if envStack == "" {
+				envStack = "main"
+			}
+			if envStack != stackName {
+				continue
+			}
+
+			for _, region := range regions {
+				for _, regionComp := range stack.Stack.Architecture.Regions[region] {
+					comp, ok := stack.Stack.Components[regionComp.Component]
+					if !ok {
+						continue
+					}
+
+					apps := regionComp.Apps
+					if len(apps) == 0 {
+						apps = []string{""}
+					}
+
+					format, separator := ForComponent(cfg.Naming, regionComp.Component)
+					for _, app := range apps {
+						entries = append(entries, Entry{
+							Subscription: sub,
+							Environment:  env.Name,
+							Region:       region,
+							Component:    regionComp.Component,
+							App:          app,
+							ResourceType: comp.Source,
+							Format:       format,
+							Separator:    separator,
+							Name: Resolve(format, Values{
+								Project:     cfg.Name,
+								Region:      prefixes.Region(region),
+								Environment: prefixes.Environment(env.Name),
+								Type:        Abbreviation(regionComp.Component),
+								App:         app,
+								Separator:   separator,
+							}),
+						})
+					}
+				}
+			}
+		}
+	}
+	return entries
+}
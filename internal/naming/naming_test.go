@@ -0,0 +1,131 @@
+package naming
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		values Values
+		want   string
+	}{
+		{
+			name:   "Default format",
+			format: "${project}-${region}${env}-${type}",
+			values: Values{Project: "myproj", Region: "E2", Environment: "D", Type: "kv", Separator: "-"},
+			want:   "myproj-E2D-kv",
+		},
+		{
+			name:   "App appended with separator",
+			format: "${project}-${region}${env}-${type}",
+			values: Values{Project: "myproj", Region: "W", Environment: "P", Type: "app", App: "api", Separator: "_"},
+			want:   "myproj-WP-app_api",
+		},
+		{
+			name:   "App placed by format",
+			format: "${type}${app}${project}${env}",
+			values: Values{Project: "myproj", Region: "W", Environment: "T", Type: "st", App: "logs"},
+			want:   "stlogsmyprojT",
+		},
+		{
+			name:   "Braced format",
+			format: "{project}-{region}{env}-{type}",
+			values: Values{Project: "myproj", Region: "E2", Environment: "D", Type: "app", App: "api", Separator: "-"},
+			want:   "myproj-E2D-app-api",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Resolve(tt.format, tt.values); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestForComponent(t *testing.T) {
+	none := ""
+	cfg := config.NamingConfig{
+		Format:           "${project}-${region}${env}-${type}",
+		DefaultSeparator: "-",
+		ComponentFormats: map[string]config.ComponentFormat{
+			"keyvault": {Format: "${project}-${type}-${env}"},
+			"storage":  {Format: "${project}${type}${env}", Separator: &none},
+		},
+	}
+
+	tests := []struct {
+		component string
+		format    string
+		separator string
+	}{
+		{"appservice", "${project}-${region}${env}-${type}", "-"},
+		{"keyvault", "${project}-${type}-${env}", "-"},
+		{"storage", "${project}${type}${env}", ""},
+	}
+
+	for _, tt := range tests {
+		format, separator := ForComponent(cfg, tt.component)
+		if format != tt.format || separator != tt.separator {
+			t.Errorf("%s: expected %q/%q, got %q/%q", tt.component, tt.format, tt.separator, format, separator)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name         string
+		resourceType string
+		resource     string
+		violations   []string
+	}{
+		{"Valid storage account", "azurerm_storage_account", "myprojstdev", nil},
+		{"Storage account charset", "azurerm_storage_account", "myproj-E2D-st", []string{"lowercase letters and numbers"}},
+		{"Storage account length", "azurerm_storage_account", "averyveryverylongstorageaccount", []string{"3-24 characters"}},
+		{"Key vault consecutive hyphens", "azurerm_key_vault", "myproj--kv", []string{"consecutive hyphens"}},
+		{"Key vault starting with a number", "azurerm_key_vault", "1myproj-kv", []string{"starting with a letter"}},
+		{"Web app ending with hyphen", "azurerm_linux_web_app", "myproj-app-", []string{"starting and ending"}},
+		{"Unknown resource type", "azurerm_subnet", "--anything--", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Check(tt.resourceType, tt.resource)
+			if len(got) != len(tt.violations) {
+				t.Fatalf("Expected %d violations, got %v", len(tt.violations), got)
+			}
+			for i, want := range tt.violations {
+				if !strings.Contains(got[i], want) {
+					t.Errorf("Expected violation containing %q, got %q", want, got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPrefixes(t *testing.T) {
+	prefixes := NewPrefixes(config.PrefixConfig{
+		Regions:      map[string]string{"brazilsouth": "BRS", "eastus2": "EUS2"},
+		Environments: map[string]string{"sandbox": "X"},
+	})
+
+	regions := map[string]string{"brazilsouth": "BRS", "eastus2": "EUS2", "westus2": "W2", "japaneast": "J"}
+	for region, want := range regions {
+		if got := prefixes.Region(region); got != want {
+			t.Errorf("Region %s: expected %s, got %s", region, want, got)
+		}
+	}
+
+	envs := map[string]string{"sandbox": "X", "stage": "S", "dev": "D", "perf": "P"}
+	for env, want := range envs {
+		if got := prefixes.Environment(env); got != want {
+			t.Errorf("Environment %s: expected %s, got %s", env, want, got)
+		}
+	}
+}
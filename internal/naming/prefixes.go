@@ -0,0 +1,118 @@
+package naming
+
+import (
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+)
+
+// DefaultRegionPrefixes are the region prefixes used unless tgs.yaml
+// overrides them
+var DefaultRegionPrefixes = map[string]string{
+	"eastus":        "E",
+	"eastus2":       "E2",
+	"canadacentral": "CC",
+	"canadaeast":    "CE",
+	"westus":        "W",
+	"westus2":       "W2",
+	"centralus":     "C",
+	"northeurope":   "NE",
+	"westeurope":    "WE",
+	"uksouth":       "UKS",
+	"ukwest":        "UKW",
+	"southeastasia": "SEA",
+	"eastasia":      "EA",
+}
+
+// DefaultEnvironmentPrefixes are the environment prefixes used unless
+// tgs.yaml overrides them
+var DefaultEnvironmentPrefixes = map[string]string{
+	"dev":   "D",
+	"test":  "T",
+	"stage": "S",
+	"prod":  "P",
+	"qa":    "Q",
+	"uat":   "U",
+}
+
+// Prefixes resolves the region and environment prefixes used in resource
+// names from the defaults and the prefixes section of tgs.yaml
+type Prefixes struct {
+	regions      map[string]string
+	environments map[string]string
+}
+
+// NewPrefixes returns the default prefixes merged with the configured ones
+func NewPrefixes(cfg config.PrefixConfig) *Prefixes {
+	p := &Prefixes{
+		regions:      make(map[string]string),
+		environments: make(map[string]string),
+	}
+	for region, prefix := range DefaultRegionPrefixes {
+		p.regions[region] = prefix
+	}
+	for region, prefix := range cfg.Regions {
+		p.regions[region] = prefix
+	}
+	for env, prefix := range DefaultEnvironmentPrefixes {
+		p.environments[env] = prefix
+	}
+	for env, prefix := range cfg.Environments {
+		p.environments[env] = prefix
+	}
+	return p
+}
+
+// Region returns the prefix of a region, falling back to its first letter
+// in upper case
+func (p *Prefixes) Region(region string) string {
+	if prefix, ok := p.regions[region]; ok {
+		return prefix
+	}
+
+	if len(region) > 0 {
+		return strings.ToUpper(region[0:1])
+	}
+	return "R" // Default fallback
+}
+
+// Environment returns the prefix of an environment, falling back to its
+// first letter in upper case
+func (p *Prefixes) Environment(env string) string {
+	if prefix, ok := p.environments[env]; ok {
+		return prefix
+	}
+
+	if len(env) > 0 {
+		return strings.ToUpper(env[0:1])
+	}
+	return "E" // Default fallback
+}
+
+// Abbreviation returns the resource type abbreviation used for a component
+func Abbreviation(componentName string) string {
+	abbreviations := map[string]string{
+		"serviceplan": "asp",
+		"appservice":  "app",
+		"functionapp": "func",
+		"redis":       "redis",
+		"storage":     "st",
+		"keyvault":    "kv",
+		"sql":         "sql",
+		"cosmos":      "cos",
+		"frontdoor":   "afd",
+		"traffic":     "traf",
+	}
+
+	for key, abbr := range abbreviations {
+		if strings.Contains(strings.ToLower(componentName), key) {
+			return abbr
+		}
+	}
+
+	// Default to first three letters if no match
+	if len(componentName) >= 3 {
+		return strings.ToLower(componentName[0:3])
+	}
+	return strings.ToLower(componentName)
+}
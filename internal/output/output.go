@@ -0,0 +1,124 @@
+// Package output resolves the directory the infrastructure tree is generated
+// into
+package output
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/workspace"
+)
+
+// DefaultDir is the output directory when tgs.yaml doesn't set output_dir
+const DefaultDir = ".infrastructure"
+
+// override is set by the --output-dir flag
+var override string
+
+// dir is the output directory of the run, set by Resolve
+var dir string
+
+// SetDir overrides the output directory of tgs.yaml for this run. Resolve
+// must run again for it to take effect.
+func SetDir(d string) {
+	override = d
+	dir = ""
+}
+
+// Resolve resolves the output directory of the run once, before anything
+// uses it: the directory set with SetDir, the output_dir of tgs.yaml, or
+// .infrastructure. A tgs.yaml that doesn't exist yet leaves the default; one
+// that can't be read or a directory outside the project is an error.
+func Resolve() error {
+	dir = ""
+	d := override
+	if d == "" {
+		tgsConfig, err := config.ReadTGSConfig()
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to resolve output directory: %w", err)
+		}
+		if tgsConfig != nil {
+			d = tgsConfig.OutputDir
+		}
+	}
+	if d == "" {
+		dir = DefaultDir
+		return nil
+	}
+	if err := Check(d); err != nil {
+		return err
+	}
+	dir = clean(d)
+	return nil
+}
+
+// Check returns an error unless d is a directory inside the project,
+// outside .tgs
+func Check(d string) error {
+	c := clean(d)
+	if filepath.IsAbs(d) || c == "." || c == ".." || strings.HasPrefix(c, "../") || c == ".tgs" || strings.HasPrefix(c, ".tgs/") {
+		return fmt.Errorf("output directory %q must be a directory inside the project, outside .tgs", d)
+	}
+	return nil
+}
+
+// Dir returns the output directory relative to the project, as resolved by
+// Resolve. Before Resolve it's the directory set with SetDir or
+// .infrastructure.
+func Dir() string {
+	if dir != "" {
+		return dir
+	}
+	if override != "" {
+		return clean(override)
+	}
+	return DefaultDir
+}
+
+// RepoPath returns the output directory relative to the repository root, the
+// way generated files reference it with get_repo_root()
+func RepoPath() string {
+	return workspace.Prefix() + Dir()
+}
+
+// Path joins elements to the output directory
+func Path(elem ...string) string {
+	return filepath.Join(append([]string{Dir()}, elem...)...)
+}
+
+// sharedModulePattern matches the source of a component.hcl using a module
+// shared by identical components
+var sharedModulePattern = regexp.MustCompile(`/_components/(_shared/[0-9a-f]+)"`)
+
+// ModuleDir returns the directory of the Terraform module of a component:
+// its component directory, or the shared module its component.hcl sources
+func ModuleDir(stackName, compName string) string {
+	dir := Path("_components", stackName, compName)
+	if shared, ok := SharedModule(dir); ok {
+		return Path("_components", filepath.FromSlash(shared))
+	}
+	return dir
+}
+
+// SharedModule returns the shared module the component.hcl of a component
+// directory sources, relative to _components, e.g. _shared/<hash>
+func SharedModule(componentDir string) (string, bool) {
+	content, err := project.ReadFile(filepath.Join(componentDir, "component.hcl"))
+	if err != nil {
+		return "", false
+	}
+	if match := sharedModulePattern.FindSubmatch(content); match != nil {
+		return string(match[1]), true
+	}
+	return "", false
+}
+
+func clean(d string) string {
+	return filepath.ToSlash(filepath.Clean(d))
+}
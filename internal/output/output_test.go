@@ -0,0 +1,162 @@
+package output
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/workspace"
+)
+
+// useProject makes a temporary directory the project root, writing tgs.yaml
+// when it isn't empty
+func useProject(t *testing.T, tgsYAML string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	if tgsYAML != "" {
+		if err := os.MkdirAll(filepath.Join(dir, ".tgs"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, ".tgs", "tgs.yaml"), []byte(tgsYAML), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	project.SetRoot(dir)
+	t.Cleanup(func() {
+		project.SetRoot("")
+		SetDir("")
+		workspace.Detect()
+	})
+	return dir
+}
+
+func TestResolve(t *testing.T) {
+	testCases := []struct {
+		name        string
+		tgsYAML     string
+		override    string
+		want        string
+		errContains string
+	}{
+		{name: "No tgs.yaml", want: DefaultDir},
+		{name: "Default", tgsYAML: "name: projecta\n", want: DefaultDir},
+		{name: "output_dir", tgsYAML: "name: projecta\noutput_dir: ./infra/generated/\n", want: "infra/generated"},
+		{name: "Override", tgsYAML: "name: projecta\noutput_dir: infra\n", override: "out", want: "out"},
+		{name: "Override ignores an unreadable tgs.yaml", tgsYAML: "name: [", override: "out", want: "out"},
+		{name: "Unreadable tgs.yaml", tgsYAML: "name: [", errContains: "failed to resolve output directory"},
+		{name: "output_dir outside the project", tgsYAML: "name: projecta\noutput_dir: ../infra\n", errContains: "inside the project"},
+		{name: "Override inside .tgs", override: ".tgs/out", errContains: "outside .tgs"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			useProject(t, tc.tgsYAML)
+			SetDir(tc.override)
+
+			err := Resolve()
+			if tc.errContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errContains) {
+					t.Fatalf("Resolve() error = %v, want error containing %q", err, tc.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve() unexpected error: %v", err)
+			}
+			if got := Dir(); got != tc.want {
+				t.Errorf("Dir() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolveOnce(t *testing.T) {
+	dir := useProject(t, "name: projecta\noutput_dir: infra\n")
+	if err := Resolve(); err != nil {
+		t.Fatalf("Resolve() unexpected error: %v", err)
+	}
+
+	// Later changes to tgs.yaml don't move the output of the run
+	if err := os.WriteFile(filepath.Join(dir, ".tgs", "tgs.yaml"), []byte("name: ["), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := Dir(); got != "infra" {
+		t.Errorf("Dir() = %q after tgs.yaml changed, want infra", got)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	testCases := []struct {
+		dir   string
+		valid bool
+	}{
+		{dir: "infra", valid: true},
+		{dir: "./infra/generated", valid: true},
+		{dir: ".tgsout", valid: true},
+		{dir: ".", valid: false},
+		{dir: "infra/..", valid: false},
+		{dir: "..", valid: false},
+		{dir: "../infra", valid: false},
+		{dir: "/tmp/infra", valid: false},
+		{dir: ".tgs", valid: false},
+		{dir: ".tgs/infra", valid: false},
+	}
+
+	for _, tc := range testCases {
+		if err := Check(tc.dir); (err == nil) != tc.valid {
+			t.Errorf("Check(%q) = %v, want valid %v", tc.dir, err, tc.valid)
+		}
+	}
+}
+
+func TestPaths(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, ".tgs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, ".tgs", "workspaces.yaml"), []byte("workspaces:\n  app:\n    path: apps/app\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(root, "apps", "app")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	useProject(t, "")
+	project.SetRoot(dir)
+	if err := workspace.Detect(); err != nil {
+		t.Fatal(err)
+	}
+	SetDir("infra")
+	if err := Resolve(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := Path("_components", "main"), filepath.Join("infra", "_components", "main"); got != want {
+		t.Errorf("Path() = %q, want %q", got, want)
+	}
+	if got, want := RepoPath(), "apps/app/infra"; got != want {
+		t.Errorf("RepoPath() = %q, want %q", got, want)
+	}
+
+	// A component sourcing a shared module uses its directory
+	shared := filepath.Join(dir, "infra", "_components", "main", "redis")
+	if err := os.MkdirAll(shared, 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := `terraform {
+  source = "${get_repo_root()}/apps/app/infra/_components/_shared/0a1b2c"
+}
+`
+	if err := os.WriteFile(filepath.Join(shared, "component.hcl"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ModuleDir("main", "redis"), filepath.Join("infra", "_components", "_shared", "0a1b2c"); got != want {
+		t.Errorf("ModuleDir() = %q, want %q", got, want)
+	}
+	if got, want := ModuleDir("main", "cosmos"), filepath.Join("infra", "_components", "main", "cosmos"); got != want {
+		t.Errorf("ModuleDir() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,112 @@
+package output
+
+import (
+	"bytes"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+)
+
+// Result is how WriteFile changed a file
+type Result int
+
+const (
+	Created Result = iota
+	Updated
+	Unchanged
+)
+
+// Summary counts the files written since ResetSummary by how they changed
+type Summary struct {
+	Created   int
+	Updated   int
+	Unchanged int
+}
+
+// Total returns the number of files written
+func (s Summary) Total() int {
+	return s.Created + s.Updated + s.Unchanged
+}
+
+var (
+	mu      sync.Mutex
+	results = make(map[string]Result)
+)
+
+// WriteFile writes content to path, creating its directory, unless the file
+// already holds exactly that content, so unchanged files keep their mtime.
+// It reports whether the file changed.
+func WriteFile(path string, content []byte) (bool, error) {
+	if err := project.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+
+	result := Created
+	if existing, err := project.ReadFile(path); err == nil {
+		result = Updated
+		if bytes.Equal(existing, content) {
+			result = Unchanged
+		}
+	}
+	if result != Unchanged {
+		if err := project.WriteFile(path, content, 0644); err != nil {
+			return false, err
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// A file written twice keeps the result of its first write against disk
+	if previous, ok := results[path]; !ok || previous == Unchanged {
+		results[path] = result
+	}
+	return result != Unchanged, nil
+}
+
+// RemoveFile removes a file written since ResetSummary, e.g. one moved
+// elsewhere, and drops it from the summary
+func RemoveFile(path string) error {
+	mu.Lock()
+	delete(results, path)
+	mu.Unlock()
+	return project.Remove(path)
+}
+
+// ResetSummary starts counting written files anew
+func ResetSummary() {
+	mu.Lock()
+	defer mu.Unlock()
+	results = make(map[string]Result)
+}
+
+// CurrentSummary counts the files written since ResetSummary
+func CurrentSummary() Summary {
+	mu.Lock()
+	defer mu.Unlock()
+	var summary Summary
+	for _, result := range results {
+		switch result {
+		case Created:
+			summary.Created++
+		case Updated:
+			summary.Updated++
+		default:
+			summary.Unchanged++
+		}
+	}
+	return summary
+}
+
+// WrittenFiles returns the files written since ResetSummary in order
+func WrittenFiles() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	var paths []string
+	for path := range results {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,55 @@
+package output
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	ResetSummary()
+
+	unchanged := filepath.Join(dir, "unchanged.hcl")
+	if err := os.WriteFile(unchanged, []byte("same"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(unchanged, old, old); err != nil {
+		t.Fatal(err)
+	}
+	updated := filepath.Join(dir, "updated.hcl")
+	if err := os.WriteFile(updated, []byte("before"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, content := range map[string]string{
+		unchanged:                             "same",
+		updated:                               "after",
+		filepath.Join(dir, "new", "file.hcl"): "new",
+	} {
+		if _, err := WriteFile(path, []byte(content)); err != nil {
+			t.Fatalf("WriteFile(%s) unexpected error: %v", path, err)
+		}
+	}
+
+	if info, err := os.Stat(unchanged); err != nil || !info.ModTime().Equal(old) {
+		t.Errorf("unchanged file should keep its mtime %v, got %v (%v)", old, info.ModTime(), err)
+	}
+	want := Summary{Created: 1, Updated: 1, Unchanged: 1}
+	if got := CurrentSummary(); got != want {
+		t.Errorf("CurrentSummary() = %+v, want %+v", got, want)
+	}
+
+	// Removed files leave the summary
+	if err := RemoveFile(filepath.Join(dir, "new", "file.hcl")); err != nil {
+		t.Fatal(err)
+	}
+	if got := CurrentSummary(); got.Created != 0 || got.Total() != 2 {
+		t.Errorf("CurrentSummary() after RemoveFile = %+v, want 2 files, none created", got)
+	}
+	if got := WrittenFiles(); len(got) != 2 || got[0] != unchanged || got[1] != updated {
+		t.Errorf("WrittenFiles() = %v, want [%s %s]", got, unchanged, updated)
+	}
+}
@@ -0,0 +1,356 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Build agent operating systems supported by the generated pipelines
+const (
+	AgentLinux   = "linux"
+	AgentWindows = "windows"
+)
+
+// agentProfile holds the agent specific parts of the generated pipelines
+type agentProfile struct {
+	name             string
+	vmImage          string
+	deployScriptName string
+	deployScript     string
+	installTemplate  string
+	deploySteps      string
+}
+
+// agentProfiles lists the supported build agents by operating system
+var agentProfiles = map[string]agentProfile{
+	AgentLinux: {
+		name:             AgentLinux,
+		vmImage:          "ubuntu-latest",
+		deployScriptName: "deploy.sh",
+		deployScript:     linuxDeployScript,
+		installTemplate:  linuxInstallTemplate,
+		deploySteps:      linuxDeploySteps,
+	},
+	AgentWindows: {
+		name:             AgentWindows,
+		vmImage:          "windows-latest",
+		deployScriptName: "deploy.ps1",
+		deployScript:     windowsDeployScript,
+		installTemplate:  windowsInstallTemplate,
+		deploySteps:      windowsDeploySteps,
+	},
+}
+
+// agentFor returns the profile of a build agent OS, defaulting to linux
+func agentFor(name string) (agentProfile, error) {
+	if name == "" {
+		name = AgentLinux
+	}
+
+	agent, ok := agentProfiles[name]
+	if !ok {
+		var names []string
+		for n := range agentProfiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return agentProfile{}, fmt.Errorf("unsupported agent %q: must be one of %s", name, strings.Join(names, ", "))
+	}
+	return agent, nil
+}
+
+// linuxDeployScript runs terragrunt for a component on Linux agents
+const linuxDeployScript = `#!/bin/bash
+set -e
+
+# Set the working directory
+env_dir=.infrastructure/architecture/$2/$3/$4
+if [ -f "$env_dir/terragrunt.stack.hcl" ]; then
+  # Stacks layout: generate the units of the environment first
+  (cd "$env_dir" && terragrunt stack generate)
+  env_dir=$env_dir/.terragrunt-stack
+fi
+if [ -n "$1" ]; then
+  cd $env_dir/$5/$1
+else
+  cd $env_dir/$5
+fi
+
+# Function to convert JSON to terragrunt var arguments
+convert_json_to_vars() {
+  if [ -n "$INLINE_VARS" ] && [ "$INLINE_VARS" != '""' ]; then
+    # Use jq to parse the JSON and convert it to var arguments
+    echo "$INLINE_VARS" | jq -r 'to_entries | .[] | "-var=\"\(.key)=\(.value)\""' | tr '\n' ' '
+  fi
+}
+
+# Get the var arguments
+VAR_ARGS=$(convert_json_to_vars)
+
+# Always run init
+terragrunt init
+
+# Run the appropriate command based on runMode. When PLAN_FILE is set, plan
+# saves the plan to it and apply applies exactly that plan.
+case "$6" in
+  "plan")
+    if [ -n "$PLAN_FILE" ]; then
+      terragrunt plan $VAR_ARGS -out="$PLAN_FILE"
+    else
+      terragrunt plan $VAR_ARGS
+    fi
+    ;;
+  "apply")
+    if [ -n "$PLAN_FILE" ]; then
+      terragrunt apply "$PLAN_FILE"
+    else
+      terragrunt plan $VAR_ARGS
+      terragrunt apply --auto-approve $VAR_ARGS
+    fi
+    terragrunt output
+    ;;
+  "destroy")
+    terragrunt destroy --auto-approve $VAR_ARGS
+    ;;
+  "swap")
+    # Swap the deployment slot in SWAP_SLOT into production
+    if ! az account show > /dev/null 2>&1; then
+      az login --service-principal -u "$ARM_CLIENT_ID" -p "$ARM_CLIENT_SECRET" --tenant "$ARM_TENANT_ID" > /dev/null
+    fi
+    az webapp deployment slot swap --ids "$(terragrunt output -raw id)" --slot "$SWAP_SLOT" --target-slot production
+    ;;
+  *)
+    echo "Invalid runMode: $6"
+    exit 1
+    ;;
+esac`
+
+// linuxInstallTemplate installs Terraform and Terragrunt on Linux agents,
+// caching the binaries by version so they're only downloaded once
+const linuxInstallTemplate = `parameters:
+  - name: terraform_version
+    type: string
+  - name: terragrunt_version
+    type: string
+
+steps:
+  - task: Cache@2
+    displayName: Cache Terraform and Terragrunt
+    inputs:
+      key: 'tools | "$(Agent.OS)" | terraform ${{ parameters.terraform_version }} | terragrunt ${{ parameters.terragrunt_version }}'
+      path: $(Pipeline.Workspace)/.tools
+      cacheHitVar: TOOLS_CACHE_RESTORED
+
+  - script: |
+      set -e
+      mkdir -p "$(Pipeline.Workspace)/.tools"
+      cd "$(Pipeline.Workspace)/.tools"
+      curl -fsSLo terraform.zip "https://releases.hashicorp.com/terraform/${{ parameters.terraform_version }}/terraform_${{ parameters.terraform_version }}_linux_amd64.zip"
+      unzip -o terraform.zip terraform
+      rm terraform.zip
+      curl -fsSLo terragrunt "https://github.com/gruntwork-io/terragrunt/releases/download/${{ parameters.terragrunt_version }}/terragrunt_linux_amd64"
+      chmod +x terraform terragrunt
+    displayName: Install Terraform and Terragrunt
+    condition: ne(variables.TOOLS_CACHE_RESTORED, 'true')
+
+  - script: echo "##vso[task.prependpath]$(Pipeline.Workspace)/.tools"
+    displayName: Add Terraform and Terragrunt to PATH
+`
+
+// linuxDeploySteps run the deploy script with a client secret or a workload
+// identity service connection on Linux agents
+const linuxDeploySteps = `  - ${{ if eq(parameters.serviceConnection, '') }}:
+    - script: |
+        chmod +x .azure-pipelines/scripts/deploy.sh
+        .azure-pipelines/scripts/deploy.sh "${{ parameters.app }}" "${{ parameters.subscription }}" "${{ parameters.region }}" "${{ parameters.environment }}" "${{ parameters.component }}" "${{ parameters.runMode }}"
+      displayName: Deploy Infrastructure
+      workingDirectory: ${{ parameters.workingDirectory }}
+      env:
+        PLAN_FILE: ${{ parameters.planFile }}
+        SWAP_SLOT: ${{ parameters.swapSlot }}
+        ARM_CLIENT_ID: $(ARM_CLIENT_ID)
+        ARM_CLIENT_SECRET: $(ARM_CLIENT_SECRET)
+        ARM_SUBSCRIPTION_ID: $(ARM_SUBSCRIPTION_ID)
+        ARM_TENANT_ID: $(ARM_TENANT_ID)
+
+  # Authenticate with the workload identity federation of the service
+  # connection instead of a stored client secret
+  - ${{ if ne(parameters.serviceConnection, '') }}:
+    - task: AzureCLI@2
+      displayName: Deploy Infrastructure
+      inputs:
+        azureSubscription: ${{ parameters.serviceConnection }}
+        scriptType: bash
+        scriptLocation: inlineScript
+        addSpnToEnvironment: true
+        workingDirectory: ${{ parameters.workingDirectory }}
+        inlineScript: |
+          export ARM_USE_OIDC=true
+          export ARM_OIDC_TOKEN="$idToken"
+          export ARM_CLIENT_ID="$servicePrincipalId"
+          export ARM_TENANT_ID="$tenantId"
+          export ARM_SUBSCRIPTION_ID="$(az account show --query id --output tsv)"
+          chmod +x .azure-pipelines/scripts/deploy.sh
+          .azure-pipelines/scripts/deploy.sh "${{ parameters.app }}" "${{ parameters.subscription }}" "${{ parameters.region }}" "${{ parameters.environment }}" "${{ parameters.component }}" "${{ parameters.runMode }}"
+      env:
+        PLAN_FILE: ${{ parameters.planFile }}
+        SWAP_SLOT: ${{ parameters.swapSlot }}
+`
+
+// windowsDeployScript runs terragrunt for a component on Windows agents
+const windowsDeployScript = `param(
+  [string]$App,
+  [string]$Subscription,
+  [string]$Region,
+  [string]$Environment,
+  [string]$Component,
+  [string]$RunMode
+)
+
+$ErrorActionPreference = 'Stop'
+
+# Set the working directory
+$envDir = ".infrastructure/architecture/$Subscription/$Region/$Environment"
+if (Test-Path "$envDir/terragrunt.stack.hcl") {
+  # Stacks layout: generate the units of the environment first
+  Push-Location $envDir
+  terragrunt stack generate
+  if ($LASTEXITCODE -ne 0) { exit $LASTEXITCODE }
+  Pop-Location
+  $envDir = "$envDir/.terragrunt-stack"
+}
+if ($App) {
+  Set-Location "$envDir/$Component/$App"
+} else {
+  Set-Location "$envDir/$Component"
+}
+
+# Convert JSON to terragrunt var arguments
+$varArgs = @()
+if ($env:INLINE_VARS -and $env:INLINE_VARS -ne '""') {
+  foreach ($property in ($env:INLINE_VARS | ConvertFrom-Json).PSObject.Properties) {
+    $varArgs += "-var=$($property.Name)=$($property.Value)"
+  }
+}
+
+# Run terragrunt, failing the script when it fails
+function Invoke-Terragrunt {
+  & terragrunt @args
+  if ($LASTEXITCODE -ne 0) {
+    exit $LASTEXITCODE
+  }
+}
+
+# Always run init
+Invoke-Terragrunt init
+
+# Run the appropriate command based on RunMode. When PLAN_FILE is set, plan
+# saves the plan to it and apply applies exactly that plan.
+switch ($RunMode) {
+  'plan' {
+    if ($env:PLAN_FILE) {
+      Invoke-Terragrunt plan @varArgs "-out=$env:PLAN_FILE"
+    } else {
+      Invoke-Terragrunt plan @varArgs
+    }
+  }
+  'apply' {
+    if ($env:PLAN_FILE) {
+      Invoke-Terragrunt apply $env:PLAN_FILE
+    } else {
+      Invoke-Terragrunt plan @varArgs
+      Invoke-Terragrunt apply --auto-approve @varArgs
+    }
+    Invoke-Terragrunt output
+  }
+  'destroy' {
+    Invoke-Terragrunt destroy --auto-approve @varArgs
+  }
+  'swap' {
+    # Swap the deployment slot in SWAP_SLOT into production
+    az account show *> $null
+    if ($LASTEXITCODE -ne 0) {
+      az login --service-principal -u $env:ARM_CLIENT_ID -p $env:ARM_CLIENT_SECRET --tenant $env:ARM_TENANT_ID | Out-Null
+    }
+    $appId = terragrunt output -raw id
+    az webapp deployment slot swap --ids $appId --slot $env:SWAP_SLOT --target-slot production
+    if ($LASTEXITCODE -ne 0) {
+      exit $LASTEXITCODE
+    }
+  }
+  default {
+    Write-Error "Invalid runMode: $RunMode"
+    exit 1
+  }
+}
+`
+
+// windowsInstallTemplate installs Terraform and Terragrunt on Windows agents,
+// caching the binaries by version so they're only downloaded once
+const windowsInstallTemplate = `parameters:
+  - name: terraform_version
+    type: string
+  - name: terragrunt_version
+    type: string
+
+steps:
+  - task: Cache@2
+    displayName: Cache Terraform and Terragrunt
+    inputs:
+      key: 'tools | "$(Agent.OS)" | terraform ${{ parameters.terraform_version }} | terragrunt ${{ parameters.terragrunt_version }}'
+      path: $(Pipeline.Workspace)/.tools
+      cacheHitVar: TOOLS_CACHE_RESTORED
+
+  - pwsh: |
+      $ErrorActionPreference = 'Stop'
+      $tools = "$(Pipeline.Workspace)/.tools"
+      New-Item -ItemType Directory -Force -Path $tools | Out-Null
+      Invoke-WebRequest -Uri "https://releases.hashicorp.com/terraform/${{ parameters.terraform_version }}/terraform_${{ parameters.terraform_version }}_windows_amd64.zip" -OutFile "$tools/terraform.zip"
+      Expand-Archive -Path "$tools/terraform.zip" -DestinationPath $tools -Force
+      Remove-Item "$tools/terraform.zip"
+      Invoke-WebRequest -Uri "https://github.com/gruntwork-io/terragrunt/releases/download/${{ parameters.terragrunt_version }}/terragrunt_windows_amd64.exe" -OutFile "$tools/terragrunt.exe"
+    displayName: Install Terraform and Terragrunt
+    condition: ne(variables.TOOLS_CACHE_RESTORED, 'true')
+
+  - pwsh: Write-Host "##vso[task.prependpath]$(Pipeline.Workspace)/.tools"
+    displayName: Add Terraform and Terragrunt to PATH
+`
+
+// windowsDeploySteps run the deploy script with a client secret or a
+// workload identity service connection on Windows agents
+const windowsDeploySteps = `  - ${{ if eq(parameters.serviceConnection, '') }}:
+    - pwsh: |
+        ./.azure-pipelines/scripts/deploy.ps1 -App "${{ parameters.app }}" -Subscription "${{ parameters.subscription }}" -Region "${{ parameters.region }}" -Environment "${{ parameters.environment }}" -Component "${{ parameters.component }}" -RunMode "${{ parameters.runMode }}"
+      displayName: Deploy Infrastructure
+      workingDirectory: ${{ parameters.workingDirectory }}
+      env:
+        PLAN_FILE: ${{ parameters.planFile }}
+        SWAP_SLOT: ${{ parameters.swapSlot }}
+        ARM_CLIENT_ID: $(ARM_CLIENT_ID)
+        ARM_CLIENT_SECRET: $(ARM_CLIENT_SECRET)
+        ARM_SUBSCRIPTION_ID: $(ARM_SUBSCRIPTION_ID)
+        ARM_TENANT_ID: $(ARM_TENANT_ID)
+
+  # Authenticate with the workload identity federation of the service
+  # connection instead of a stored client secret
+  - ${{ if ne(parameters.serviceConnection, '') }}:
+    - task: AzureCLI@2
+      displayName: Deploy Infrastructure
+      inputs:
+        azureSubscription: ${{ parameters.serviceConnection }}
+        scriptType: pscore
+        scriptLocation: inlineScript
+        addSpnToEnvironment: true
+        workingDirectory: ${{ parameters.workingDirectory }}
+        inlineScript: |
+          $env:ARM_USE_OIDC = 'true'
+          $env:ARM_OIDC_TOKEN = $env:idToken
+          $env:ARM_CLIENT_ID = $env:servicePrincipalId
+          $env:ARM_TENANT_ID = $env:tenantId
+          $env:ARM_SUBSCRIPTION_ID = az account show --query id --output tsv
+          ./.azure-pipelines/scripts/deploy.ps1 -App "${{ parameters.app }}" -Subscription "${{ parameters.subscription }}" -Region "${{ parameters.region }}" -Environment "${{ parameters.environment }}" -Component "${{ parameters.component }}" -RunMode "${{ parameters.runMode }}"
+      env:
+        PLAN_FILE: ${{ parameters.planFile }}
+        SWAP_SLOT: ${{ parameters.swapSlot }}
+`
@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+)
+
+// linuxBackupScript copies every state blob of the container to a folder of
+// the backup container named after the UTC time
+const linuxBackupScript = `backup=$(date -u +%Y%m%dT%H%M%SZ)
+dir="$AGENT_TEMPDIRECTORY/state"
+mkdir -p "$dir"
+az storage blob download-batch --auth-mode login --account-name "$STATE_ACCOUNT" --source "$STATE_CONTAINER" --pattern '*terraform.tfstate' --destination "$dir" --output none
+az storage blob upload-batch --auth-mode login --account-name "$BACKUP_ACCOUNT" --destination "$BACKUP_CONTAINER" --destination-path "$backup" --source "$dir" --output none
+echo "Backed up remote state to $BACKUP_ACCOUNT/$BACKUP_CONTAINER/$backup"
+`
+
+// windowsBackupScript is linuxBackupScript for Windows agents
+const windowsBackupScript = `$ErrorActionPreference = 'Stop'
+$backup = (Get-Date).ToUniversalTime().ToString('yyyyMMddTHHmmssZ')
+$dir = Join-Path $env:AGENT_TEMPDIRECTORY 'state'
+New-Item -ItemType Directory -Force -Path $dir | Out-Null
+az storage blob download-batch --auth-mode login --account-name $env:STATE_ACCOUNT --source $env:STATE_CONTAINER --pattern '*terraform.tfstate' --destination $dir --output none
+if ($LASTEXITCODE -ne 0) { exit $LASTEXITCODE }
+az storage blob upload-batch --auth-mode login --account-name $env:BACKUP_ACCOUNT --destination $env:BACKUP_CONTAINER --destination-path $backup --source $dir --output none
+if ($LASTEXITCODE -ne 0) { exit $LASTEXITCODE }
+Write-Host "Backed up remote state to $env:BACKUP_ACCOUNT/$env:BACKUP_CONTAINER/$backup"
+`
+
+// generateStateBackupJob returns the job of the change detection stage that
+// backs up the remote state of the subscription before apply stages run. It's
+// only compiled into apply runs of environments whose subscription sets
+// remotestate.backup.
+func generateStateBackupJob(container string, agent agentProfile) string {
+	scriptStep, scriptType, script := "bash", "bash", linuxBackupScript
+	login := `az login --service-principal --username "$ARM_CLIENT_ID" --password "$ARM_CLIENT_SECRET" --tenant "$ARM_TENANT_ID" --output none
+`
+	if agent.name == AgentWindows {
+		scriptStep, scriptType, script = "pwsh", "pscore", windowsBackupScript
+		login = `az login --service-principal --username $env:ARM_CLIENT_ID --password $env:ARM_CLIENT_SECRET --tenant $env:ARM_TENANT_ID --output none
+if ($LASTEXITCODE -ne 0) { exit $LASTEXITCODE }
+`
+	}
+
+	env := fmt.Sprintf(`                  STATE_ACCOUNT: ${{ parameters.stateAccount }}
+                  STATE_CONTAINER: '%s'
+                  BACKUP_ACCOUNT: ${{ parameters.stateBackupAccount }}
+                  BACKUP_CONTAINER: ${{ parameters.stateBackupContainer }}
+`, container)
+
+	return fmt.Sprintf(`      - ${{ if and(eq(parameters.runMode, 'apply'), ne(parameters.stateBackupContainer, '')) }}:
+        - job: backupState
+          displayName: 'Back up remote state'
+          pool:
+            vmImage: %s
+          steps:
+            - checkout: none
+            - ${{ if eq(parameters.serviceConnection, '') }}:
+              - %s: |
+%s                displayName: 'Back up remote state'
+                env:
+                  ARM_CLIENT_ID: $(ARM_CLIENT_ID)
+                  ARM_CLIENT_SECRET: $(ARM_CLIENT_SECRET)
+                  ARM_TENANT_ID: $(ARM_TENANT_ID)
+%s            - ${{ if ne(parameters.serviceConnection, '') }}:
+              - task: AzureCLI@2
+                displayName: 'Back up remote state'
+                inputs:
+                  azureSubscription: ${{ parameters.serviceConnection }}
+                  scriptType: %s
+                  scriptLocation: inlineScript
+                  inlineScript: |
+%s                env:
+%s
+`, agent.vmImage, scriptStep, indentLines(login+script, "                  "), env, scriptType, indentLines(script, "                    "), env)
+}
+
+// indentLines prefixes every line of s with indent
+func indentLines(s, indent string) string {
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(s, "\n") {
+		if line != "" {
+			b.WriteString(indent + line)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,193 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+)
+
+// changeStage is the stage detecting which components a change affects
+const changeStage = "DetectChanges"
+
+// changeKey returns the change detection output of a component in a region
+func changeKey(region, comp string) string {
+	return fmt.Sprintf("%s_%s", region, comp)
+}
+
+// changeCondition returns the stage condition deploying a component in a
+// region only when the change detection stage marked it affected. Skipped
+// dependencies don't block the stage.
+func changeCondition(region, comp string) string {
+	return fmt.Sprintf("and(not(failed()), not(canceled()), eq(dependencies.%s.outputs['detect.changes.%s'], 'true'))", changeStage, changeKey(region, comp))
+}
+
+// componentPaths returns the path prefixes whose changes affect a component
+// in a region: its shared component folder, its architecture folders in the
+// deployed environment and its config files
+func componentPaths(stackName, region, comp string) []string {
+	dir := output.Dir()
+	return []string{
+		fmt.Sprintf("%s/_components/%s/%s/", dir, stackName, comp),
+		fmt.Sprintf("%s/_units/%s/%s/", dir, stackName, comp),
+		fmt.Sprintf("%s/architecture/%s/${{ parameters.subscription }}/%s/${{ parameters.environment }}/%s/", dir, stackName, region, comp),
+		fmt.Sprintf("%s/config/%s/app_settings_%s/", dir, stackName, comp),
+		fmt.Sprintf("%s/config/%s/policy_files_%s/", dir, stackName, comp),
+	}
+}
+
+// affectedPaths returns the paths of a component in a region and of every
+// component it depends on, so dependents are re-planned when an upstream
+// component changes
+func affectedPaths(stackName string, mainConfig *config.MainConfig, region, comp string, visited map[string]bool) []string {
+	key := changeKey(region, comp)
+	if visited[key] {
+		return nil
+	}
+	visited[key] = true
+
+	paths := componentPaths(stackName, region, comp)
+	for _, dep := range mainConfig.Stack.Components[comp].Deps {
+		depParts := strings.Split(dep, ".")
+		if len(depParts) < 2 {
+			continue
+		}
+
+		depRegion := config.DependencyRegion(depParts[0], region, mainConfig.Stack.Architecture.PairedRegions[region])
+		if depRegion == "" {
+			continue
+		}
+		paths = append(paths, affectedPaths(stackName, mainConfig, depRegion, depParts[1], visited)...)
+	}
+	return paths
+}
+
+// generateChangeDetectionStage returns the stage that diffs the commit against
+// the pull request target branch, or the previous commit, and sets an output
+// for every component of the stack telling whether it's affected. Changes to
+// shared files such as root.hcl or the environment config affect every
+// component.
+func generateChangeDetectionStage(stackName string, mainConfig *config.MainConfig, agent agentProfile) string {
+	var regions []string
+	for region := range mainConfig.Stack.Architecture.Regions {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+
+	var checks strings.Builder
+	for _, region := range regions {
+		for _, rc := range mainConfig.Stack.Architecture.Regions[region] {
+			var quoted []string
+			for _, path := range affectedPaths(stackName, mainConfig, region, rc.Component, make(map[string]bool)) {
+				quoted = append(quoted, fmt.Sprintf("'%s'", path))
+			}
+
+			if agent.name == AgentWindows {
+				checks.WriteString(fmt.Sprintf("              Detect %s @(%s)\n", changeKey(region, rc.Component), strings.Join(quoted, ", ")))
+			} else {
+				checks.WriteString(fmt.Sprintf("              detect %s %s\n", changeKey(region, rc.Component), strings.Join(quoted, " ")))
+			}
+		}
+	}
+
+	shared := []string{
+		`root\.hcl`,
+		`config/global\.hcl`,
+		fmt.Sprintf(`config/%s/environments/${{ parameters.subscription }}/${{ parameters.environment }}\.env\.hcl`, stackName),
+		fmt.Sprintf(`architecture/%s/${{ parameters.subscription }}/subscription\.hcl`, stackName),
+		fmt.Sprintf(`architecture/%s/${{ parameters.subscription }}/[^/]+/region\.hcl`, stackName),
+		fmt.Sprintf(`architecture/%s/${{ parameters.subscription }}/[^/]+/${{ parameters.environment }}/environment\.hcl`, stackName),
+		fmt.Sprintf(`architecture/%s/${{ parameters.subscription }}/[^/]+/${{ parameters.environment }}/terragrunt\.stack\.hcl`, stackName),
+	}
+
+	pattern := fmt.Sprintf(`^%s/(%s)$`, regexp.QuoteMeta(output.Dir()), strings.Join(shared, "|"))
+
+	script := fmt.Sprintf(`          - bash: |
+              all=false
+              if [ "$DEPLOY_ALL" = "True" ]; then
+                all=true
+              elif [ "$BUILD_REASON" = "PullRequest" ]; then
+                changed=$(git diff --relative --name-only "origin/${SYSTEM_PULLREQUEST_TARGETBRANCH#refs/heads/}...HEAD") || all=true
+              else
+                changed=$(git diff --relative --name-only HEAD~1 HEAD) || all=true
+              fi
+
+              # Shared configuration affects every component
+              if grep -Eq '%s' <<< "$changed"; then
+                all=true
+              fi
+
+              detect() {
+                key=$1
+                shift
+                affected=$all
+                for path in "$@"; do
+                  while read -r file; do
+                    case "$file" in "$path"*) affected=true ;; esac
+                  done <<< "$changed"
+                done
+                echo "$key: $affected"
+                echo "##vso[task.setvariable variable=$key;isOutput=true]$affected"
+              }
+
+%s`, pattern, checks.String())
+	if agent.name == AgentWindows {
+		script = fmt.Sprintf(`          - pwsh: |
+              $all = $env:DEPLOY_ALL -eq 'True'
+              $changed = @()
+              if (-not $all) {
+                if ($env:BUILD_REASON -eq 'PullRequest') {
+                  $target = 'origin/' + ($env:SYSTEM_PULLREQUEST_TARGETBRANCH -replace '^refs/heads/', '')
+                  $changed = @(git diff --relative --name-only "$target...HEAD")
+                } else {
+                  $changed = @(git diff --relative --name-only HEAD~1 HEAD)
+                }
+                if ($LASTEXITCODE -ne 0) {
+                  $all = $true
+                }
+              }
+
+              # Shared configuration affects every component
+              if ($changed | Where-Object { $_ -match '%s' }) {
+                $all = $true
+              }
+
+              function Detect([string]$key, [string[]]$paths) {
+                $affected = $all
+                foreach ($file in $changed) {
+                  foreach ($path in $paths) {
+                    if ($file.StartsWith($path)) {
+                      $affected = $true
+                    }
+                  }
+                }
+                $value = if ($affected) { 'true' } else { 'false' }
+                Write-Host "${key}: $value"
+                Write-Host "##vso[task.setvariable variable=$key;isOutput=true]$value"
+              }
+
+%s`, pattern, checks.String())
+	}
+
+	return fmt.Sprintf(`  - stage: '%s'
+    displayName: 'Detect changed components'
+    dependsOn: []
+    jobs:
+      - job: detect
+        displayName: 'Detect changed components'
+        pool:
+          vmImage: %s
+        steps:
+          - checkout: self
+            fetchDepth: 0
+%s            name: changes
+            displayName: 'Detect changed components'
+            workingDirectory: %s
+            env:
+              DEPLOY_ALL: ${{ or(eq(parameters.changedOnly, false), eq(parameters.runMode, 'destroy')) }}
+
+`, changeStage, agent.vmImage, script, projectDirectory())
+}
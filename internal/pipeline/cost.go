@@ -0,0 +1,86 @@
+package pipeline
+
+import (
+	"fmt"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+)
+
+// linuxCostScript runs infracost breakdown in every region folder of the
+// environment, then prints the estimates, adds them to the run summary and
+// comments them on pull requests
+const linuxCostScript = `set -e
+tools="$AGENT_TEMPDIRECTORY/infracost-bin"
+out="$AGENT_TEMPDIRECTORY/infracost"
+mkdir -p "$tools" "$out"
+curl -fsSL "https://github.com/infracost/infracost/releases/download/v$INFRACOST_VERSION/infracost-linux-amd64.tar.gz" | tar -xz -C "$tools"
+infracost="$tools/infracost-linux-amd64"
+for dir in architecture/%s/"$SUBSCRIPTION"/*/"$ENVIRONMENT"; do
+  [ -d "$dir" ] || continue
+  region=$(basename "$(dirname "$dir")")
+  "$infracost" breakdown --path "$dir" --format json --out-file "$out/$region.json"
+done
+"$infracost" output --path "$out/*.json" --format table
+"$infracost" output --path "$out/*.json" --format azure-repos-comment --out-file "$out/summary.md"
+echo "##vso[task.uploadsummary]$out/summary.md"
+if [ "$BUILD_REASON" = "PullRequest" ]; then
+  "$infracost" comment azure-repos --path "$out/*.json" --azure-access-token "$SYSTEM_ACCESSTOKEN" --pull-request "$SYSTEM_PULLREQUEST_PULLREQUESTID" --repo-url "$BUILD_REPOSITORY_URI" --behavior update
+fi
+`
+
+// windowsCostScript is linuxCostScript for Windows agents
+const windowsCostScript = `$ErrorActionPreference = 'Stop'
+$tools = Join-Path $env:AGENT_TEMPDIRECTORY 'infracost-bin'
+$out = Join-Path $env:AGENT_TEMPDIRECTORY 'infracost'
+New-Item -ItemType Directory -Force -Path $tools, $out | Out-Null
+Invoke-WebRequest -Uri "https://github.com/infracost/infracost/releases/download/v$env:INFRACOST_VERSION/infracost-windows-amd64.tar.gz" -OutFile "$tools/infracost.tar.gz"
+tar -xzf "$tools/infracost.tar.gz" -C $tools
+$infracost = Join-Path $tools 'infracost-windows-amd64.exe'
+foreach ($dir in Get-Item -Path "architecture/%s/$env:SUBSCRIPTION/*/$env:ENVIRONMENT" -ErrorAction SilentlyContinue) {
+  $region = Split-Path -Leaf (Split-Path -Parent $dir.FullName)
+  & $infracost breakdown --path $dir.FullName --format json --out-file (Join-Path $out "$region.json")
+  if ($LASTEXITCODE -ne 0) { exit $LASTEXITCODE }
+}
+& $infracost output --path "$out/*.json" --format table
+if ($LASTEXITCODE -ne 0) { exit $LASTEXITCODE }
+& $infracost output --path "$out/*.json" --format azure-repos-comment --out-file "$out/summary.md"
+if ($LASTEXITCODE -ne 0) { exit $LASTEXITCODE }
+Write-Host "##vso[task.uploadsummary]$out/summary.md"
+if ($env:BUILD_REASON -eq 'PullRequest') {
+  & $infracost comment azure-repos --path "$out/*.json" --azure-access-token $env:SYSTEM_ACCESSTOKEN --pull-request $env:SYSTEM_PULLREQUEST_PULLREQUESTID --repo-url $env:BUILD_REPOSITORY_URI --behavior update
+  if ($LASTEXITCODE -ne 0) { exit $LASTEXITCODE }
+}
+`
+
+// generateCostJob returns the job of the change detection stage that
+// estimates the monthly cost of the environment with infracost. It's only
+// compiled into plan runs, and only generated when tooling.infracost is set.
+func generateCostJob(stackName, version string, agent agentProfile) string {
+	if version == "" {
+		return ""
+	}
+
+	scriptStep, script := "bash", linuxCostScript
+	if agent.name == AgentWindows {
+		scriptStep, script = "pwsh", windowsCostScript
+	}
+
+	return fmt.Sprintf(`      - ${{ if eq(parameters.runMode, 'plan') }}:
+        - job: costEstimate
+          displayName: 'Estimate monthly cost'
+          pool:
+            vmImage: %s
+          steps:
+            - checkout: self
+            - %s: |
+%s              displayName: 'Estimate monthly cost'
+              workingDirectory: %s
+              env:
+                INFRACOST_VERSION: '%s'
+                INFRACOST_API_KEY: $(INFRACOST_API_KEY)
+                SYSTEM_ACCESSTOKEN: $(System.AccessToken)
+                SUBSCRIPTION: ${{ parameters.subscription }}
+                ENVIRONMENT: ${{ parameters.environment }}
+
+`, agent.vmImage, scriptStep, indentLines(fmt.Sprintf(script, stackName), "                "), projectDirectory()+"/"+output.Dir(), version)
+}
@@ -0,0 +1,158 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/graph"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+)
+
+// generateDestroyTemplate generates the stack template destroying every
+// component in reverse dependency order: a component is only destroyed once
+// everything depending on it is gone
+func generateDestroyTemplate(stackName string, mainConfig *config.MainConfig, agent agentProfile) error {
+	g := graph.Build(mainConfig)
+
+	// Reverse the dependency graph
+	dependents := make(map[string][]string)
+	for _, id := range g.NodeIDs() {
+		for _, dep := range g.Edges[id] {
+			dependents[dep] = append(dependents[dep], nodeStage(g.Nodes[id]))
+		}
+	}
+
+	confirmStep := `          - bash: |
+              if [ "$CONFIRM" != "$ENVIRONMENT" ]; then
+                echo "##vso[task.logissue type=error]Type the environment name '$ENVIRONMENT' in the confirm parameter to destroy it"
+                exit 1
+              fi
+`
+	if agent.name == AgentWindows {
+		confirmStep = `          - pwsh: |
+              if ($env:CONFIRM -ne $env:ENVIRONMENT) {
+                Write-Host "##vso[task.logissue type=error]Type the environment name '$env:ENVIRONMENT' in the confirm parameter to destroy it"
+                exit 1
+              }
+`
+	}
+
+	template := fmt.Sprintf(`# Stack destroy template for %s
+parameters:
+  - name: environment
+    type: string
+  - name: subscription
+    type: string
+  - name: confirm
+    type: string
+  - name: pipelineEnvironment
+    type: string
+    default: ''
+  - name: serviceConnection
+    type: string
+    default: ''
+
+stages:
+  - stage: 'ConfirmDestroy'
+    displayName: 'Confirm destroy'
+    dependsOn: []
+    jobs:
+      - job: confirm
+        displayName: 'Confirm destroy'
+        pool:
+          vmImage: %s
+        steps:
+          - checkout: none
+%s            displayName: 'Check confirmation'
+            env:
+              CONFIRM: ${{ parameters.confirm }}
+              ENVIRONMENT: ${{ parameters.environment }}
+
+`, stackName, agent.vmImage, confirmStep)
+
+	for _, id := range g.NodeIDs() {
+		node := g.Nodes[id]
+		stage := nodeStage(node)
+		displayName := fmt.Sprintf("destroy %s/%s", node.Region, node.Component)
+		if node.App != "" {
+			displayName += "/" + node.App
+		}
+
+		template += fmt.Sprintf(`  - stage: '%s'
+    displayName: '%s'
+    dependsOn:
+      - 'ConfirmDestroy'
+`, stage, displayName)
+		for _, dependent := range dependents[id] {
+			template += fmt.Sprintf("      - '%s'\n", dependent)
+		}
+
+		template += fmt.Sprintf(`    jobs:
+      - template: component-jobs.yml
+        parameters:
+          component: '%s'
+          region: '%s'
+          environment: ${{ parameters.environment }}
+          subscription: ${{ parameters.subscription }}
+          app: '%s'
+          runMode: destroy
+          pipelineEnvironment: ${{ parameters.pipelineEnvironment }}
+          serviceConnection: ${{ parameters.serviceConnection }}
+
+`, node.Component, node.Region, node.App)
+	}
+
+	templatePath := filepath.Join(".azure-pipelines/templates", fmt.Sprintf("stack-%s-destroy.yml", stackName))
+	if err := writeFile(templatePath, template, 0644); err != nil {
+		return fmt.Errorf("failed to write stack destroy template: %w", err)
+	}
+
+	return nil
+}
+
+// generateDestroyPipeline generates the destroy pipeline of an environment.
+// Protected environments get no destroy pipeline.
+func generateDestroyPipeline(envName, sub, stackName, varGroup, pipelineEnv, serviceConnection string, protected bool) error {
+	pipelinePath := filepath.Join(".azure-pipelines", fmt.Sprintf("%s-destroy-pipeline.yml", envName))
+	if protected {
+		if err := project.Remove(pipelinePath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove destroy pipeline of protected environment: %w", err)
+		}
+		return nil
+	}
+
+	pipeline := fmt.Sprintf(`# Destroy pipeline for %s environment
+trigger: none
+pr: none
+
+parameters:
+  - name: confirm
+    displayName: Type the environment name (%s) to confirm destroying it
+    type: string
+    default: ''
+
+variables:
+  - name: environment
+    value: '%s'
+  - name: subscription
+    value: '%s'
+  - group: %s
+
+stages:
+  - template: templates/stack-%s-destroy.yml
+    parameters:
+      environment: '%s'
+      subscription: '%s'
+      confirm: ${{ parameters.confirm }}
+      pipelineEnvironment: '%s'
+      serviceConnection: '%s'
+`, envName, envName, envName, sub, varGroup, stackName, envName, sub, pipelineEnv, serviceConnection)
+
+	if err := writeFile(pipelinePath, pipeline, 0644); err != nil {
+		return fmt.Errorf("failed to write destroy pipeline file: %w", err)
+	}
+
+	return nil
+}
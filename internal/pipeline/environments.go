@@ -0,0 +1,103 @@
+package pipeline
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"gopkg.in/yaml.v3"
+)
+
+// Defaults of approval checks
+const (
+	defaultMinApprovers   = 1
+	defaultTimeoutMinutes = 1440
+)
+
+// pipelineEnvironment is an Azure DevOps environment used by the generated pipelines
+type pipelineEnvironment struct {
+	Name         string           `yaml:"name"`
+	Environments []string         `yaml:"environments"`
+	Approval     *config.Approval `yaml:"approval,omitempty"`
+}
+
+// environmentsHeader explains how to apply the generated environments config
+const environmentsHeader = `# Azure DevOps environments used by the generated pipelines. Apply jobs run
+# as deployment jobs targeting these environments, so approvals and checks
+# configured on them gate every apply.
+#
+# Create each environment under Pipelines > Environments and add an
+# Approvals check with the settings listed below. Production environments
+# get an approval by default; set their approvers in tgs.yaml.
+`
+
+// defaultApproval returns the approval of environments that don't configure
+// one: production environments require a human approval, others none
+func defaultApproval(env config.Environment) *config.Approval {
+	if env.Name == "prod" || env.Name == "production" {
+		return &config.Approval{}
+	}
+	return nil
+}
+
+// generateEnvironmentsConfig writes .azure-pipelines/environments.yml
+// listing the Azure DevOps environments and their approval checks
+func generateEnvironmentsConfig(tgsConfig *config.TGSConfig) error {
+	var subs []string
+	for sub := range tgsConfig.Subscriptions {
+		subs = append(subs, sub)
+	}
+	sort.Strings(subs)
+
+	var environments []*pipelineEnvironment
+	byName := make(map[string]*pipelineEnvironment)
+	for _, sub := range subs {
+		for _, env := range tgsConfig.Subscriptions[sub].Environments {
+			name := env.PipelineEnvironmentName()
+			entry, ok := byName[name]
+			if !ok {
+				entry = &pipelineEnvironment{Name: name}
+				byName[name] = entry
+				environments = append(environments, entry)
+			}
+			entry.Environments = append(entry.Environments, fmt.Sprintf("%s/%s", sub, env.Name))
+
+			approval := env.Approval
+			if approval == nil {
+				approval = defaultApproval(env)
+			}
+			if approval != nil && entry.Approval == nil {
+				withDefaults := *approval
+				if withDefaults.MinApprovers == 0 {
+					withDefaults.MinApprovers = defaultMinApprovers
+				}
+				if withDefaults.TimeoutMinutes == 0 {
+					withDefaults.TimeoutMinutes = defaultTimeoutMinutes
+				}
+				if withDefaults.Instructions == "" {
+					withDefaults.Instructions = "Review the plan artifact of each stage before approving."
+				}
+				entry.Approval = &withDefaults
+			}
+		}
+	}
+
+	f, err := project.Create(filepath.Join(".azure-pipelines", "environments.yml"))
+	if err != nil {
+		return fmt.Errorf("failed to create environments config: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(environmentsHeader); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	encoder := yaml.NewEncoder(f)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(map[string]interface{}{"environments": environments}); err != nil {
+		return fmt.Errorf("failed to write environments config: %w", err)
+	}
+	return nil
+}
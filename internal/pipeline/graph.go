@@ -0,0 +1,16 @@
+package pipeline
+
+import (
+	"fmt"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/graph"
+)
+
+// nodeStage returns the stage deploying a node of the dependency graph,
+// matching the stage names of the stack templates
+func nodeStage(node *graph.Node) string {
+	if node.App != "" {
+		return fmt.Sprintf("%s_%s_%s", node.Region, node.Component, node.App)
+	}
+	return fmt.Sprintf("%s_%s", node.Region, node.Component)
+}
@@ -7,7 +7,12 @@ import (
 	"strings"
 
 	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
-	"github.com/davoodharun/terragrunt-scaffolder/internal/scaffold"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/events"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/lock"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/naming"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/workspace"
 )
 
 // Component represents a component in the infrastructure
@@ -19,6 +24,8 @@ type Component struct {
 	Sub    string
 	Deps   []string
 	Path   string
+	// PairedRegion is the paired region of Region, if any
+	PairedRegion string
 }
 
 // Stage represents a pipeline stage
@@ -68,13 +75,14 @@ func AnalyzeInfrastructure() (map[string][]Component, error) {
 				for _, comp := range components {
 					// Create component instance
 					component := Component{
-						Name:   comp.Component,
-						Apps:   comp.Apps,
-						Region: region,
-						Env:    envName,
-						Sub:    subName,
-						Deps:   mainConfig.Stack.Components[comp.Component].Deps,
-						Path:   filepath.Join(".infrastructure", subName, region, envName, comp.Component),
+						Name:         comp.Component,
+						Apps:         comp.Apps,
+						Region:       region,
+						Env:          envName,
+						Sub:          subName,
+						Deps:         mainConfig.Stack.Components[comp.Component].Deps,
+						Path:         filepath.ToSlash(output.Path(subName, region, envName, comp.Component)),
+						PairedRegion: mainConfig.Stack.Architecture.PairedRegions[region],
 					}
 
 					// Add to environment components
@@ -137,7 +145,7 @@ func BuildDependencyChain(components []Component) []Stage {
 				continue
 			}
 
-			region := parts[0]
+			region := config.DependencyRegion(parts[0], comp.Region, comp.PairedRegion)
 			depComp := parts[1]
 			app := ""
 			if len(parts) > 2 {
@@ -145,9 +153,6 @@ func BuildDependencyChain(components []Component) []Stage {
 			}
 
 			// Handle special placeholders
-			if region == "{region}" {
-				region = comp.Region
-			}
 			if app == "{app}" {
 				// Add dependency for each app of the component
 				for _, compApp := range comp.Apps {
@@ -213,9 +218,9 @@ func BuildDependencyChain(components []Component) []Stage {
 }
 
 // generateStackTemplate generates a deployment template for a specific stack
-func generateStackTemplate(stackName string, mainConfig *config.MainConfig) error {
+func generateStackTemplate(stackName string, tgsConfig *config.TGSConfig, mainConfig *config.MainConfig, prefixes *naming.Prefixes, agent agentProfile) error {
 	// Create templates directory if it doesn't exist
-	if err := os.MkdirAll(".azure-pipelines/templates", 0755); err != nil {
+	if err := project.MkdirAll(".azure-pipelines/templates", 0755); err != nil {
 		return fmt.Errorf("failed to create templates directory: %w", err)
 	}
 
@@ -233,6 +238,24 @@ parameters:
       - plan
       - apply
       - destroy
+  - name: changedOnly
+    type: boolean
+    default: true
+  - name: pipelineEnvironment
+    type: string
+    default: ''
+  - name: serviceConnection
+    type: string
+    default: ''
+  - name: stateAccount
+    type: string
+    default: ''
+  - name: stateBackupAccount
+    type: string
+    default: ''
+  - name: stateBackupContainer
+    type: string
+    default: ''
 `, stackName)
 
 	// Add component-specific parameters for apps
@@ -259,6 +282,12 @@ parameters:
 
 	template += "\nstages:\n"
 
+	// Detect the components affected by the change
+	template += generateChangeDetectionStage(stackName, mainConfig, agent)
+	template += generateStateBackupJob(strings.ToLower(tgsConfig.Name), agent)
+	template += generateCostJob(stackName, tgsConfig.Tooling.Infracost, agent)
+	template += generateSecurityScanJob(tgsConfig.Security, agent)
+
 	// Group components by region
 	regionComponents := make(map[string][]string)
 	for region, components := range mainConfig.Stack.Architecture.Regions {
@@ -269,7 +298,7 @@ parameters:
 
 	// Add stages for each region's components
 	for region, components := range regionComponents {
-		regionPrefix := scaffold.GetRegionPrefix(region)
+		regionPrefix := prefixes.Region(region)
 		template += fmt.Sprintf(`  # Region: %s (%s)
 `, region, regionPrefix)
 		for _, comp := range components {
@@ -285,17 +314,14 @@ parameters:
 			}
 
 			// Helper function to get stage dependencies
-			getDependencies := func(depString string, currentApp string) string {
+			getDependencies := func(depString string, currentApp string) []string {
 				depParts := strings.Split(depString, ".")
 				if len(depParts) < 2 {
-					return ""
+					return nil
 				}
 
-				depRegion := depParts[0]
+				depRegion := config.DependencyRegion(depParts[0], region, mainConfig.Stack.Architecture.PairedRegions[region])
 				depComp := depParts[1]
-				if depRegion == "{region}" {
-					depRegion = region
-				}
 
 				// Check if the dependency component has apps
 				hasApps := false
@@ -310,6 +336,14 @@ parameters:
 					// Check if the component has apps in the architecture
 					for _, rc := range mainConfig.Stack.Architecture.Regions[depRegion] {
 						if rc.Component == depComp && len(rc.Apps) > 0 {
+							if currentApp == "" {
+								// A component without apps waits for every app
+								var stages []string
+								for _, app := range rc.Apps {
+									stages = append(stages, fmt.Sprintf("'%s_%s_%s'", depRegion, depComp, app))
+								}
+								return stages
+							}
 							hasApps = true
 							depApp = currentApp // Use the current app for the dependency
 							break
@@ -318,9 +352,9 @@ parameters:
 				}
 
 				if hasApps {
-					return fmt.Sprintf("'%s_%s_%s'", depRegion, depComp, depApp)
+					return []string{fmt.Sprintf("'%s_%s_%s'", depRegion, depComp, depApp)}
 				}
-				return fmt.Sprintf("'%s_%s'", depRegion, depComp)
+				return []string{fmt.Sprintf("'%s_%s'", depRegion, depComp)}
 			}
 
 			// If component has apps, create a stage for each app
@@ -329,11 +363,9 @@ parameters:
 				stageName := fmt.Sprintf("%s_%s", region, comp)
 
 				// Add dependencies
-				var deps []string
+				deps := []string{fmt.Sprintf("'%s'", changeStage)}
 				for _, dep := range componentConfig.Deps {
-					if depStage := getDependencies(dep, "${{ app }}"); depStage != "" {
-						deps = append(deps, depStage)
-					}
+					deps = append(deps, getDependencies(dep, "${{ app }}")...)
 				}
 
 				template += fmt.Sprintf(`  - ${{ each app in parameters.%s_apps }}:
@@ -344,71 +376,86 @@ parameters:
         environment: ${{ parameters.environment }}
         subscription: ${{ parameters.subscription }}
         runMode: ${{ parameters.runMode }}
+        pipelineEnvironment: ${{ parameters.pipelineEnvironment }}
+        serviceConnection: ${{ parameters.serviceConnection }}
         app: ${{ app }}
         displayName: '%s/${{ app }}'
         dependsOn: %s
         stageName: '%s_${{ app }}'
-
-`, comp, comp, region, displayName, formatDependencies(deps), stageName)
+        condition: "%s"
+%s
+`, comp, comp, region, displayName, formatDependencies(deps), stageName, changeCondition(region, comp), swapSlotParameter(componentConfig, "        "))
 			} else {
 				// Create single stage for component without apps
 				stageName := fmt.Sprintf("%s_%s", region, comp)
 				displayName := fmt.Sprintf("%s/%s", regionPrefix, comp)
 
 				// Add dependencies
-				var deps []string
+				deps := []string{fmt.Sprintf("'%s'", changeStage)}
 				for _, dep := range componentConfig.Deps {
-					if depStage := getDependencies(dep, ""); depStage != "" {
-						deps = append(deps, depStage)
-					}
+					deps = append(deps, getDependencies(dep, "")...)
 				}
 
 				template += fmt.Sprintf(`  - stage: '%s'
     displayName: '%s'
 `, stageName, displayName)
 
-				// Always add dependsOn section
-				if len(deps) > 0 {
-					template += "    dependsOn:\n"
-					for _, dep := range deps {
-						template += fmt.Sprintf("      - %s\n", dep)
-					}
-				} else {
-					template += "    dependsOn: []\n"
+				template += "    dependsOn:\n"
+				for _, dep := range deps {
+					template += fmt.Sprintf("      - %s\n", dep)
 				}
+				template += fmt.Sprintf("    condition: %s\n", changeCondition(region, comp))
 
 				template += fmt.Sprintf(`    jobs:
-      - job: Deploy
-        displayName: 'Deploy Infrastructure (${{ parameters.runMode }})'
-        pool:
-          vmImage: ubuntu-latest
-        steps:
-          - template: component-deploy.yml
-            parameters:
-              component: '%s'
-              region: '%s'
-              environment: ${{ parameters.environment }}
-              subscription: ${{ parameters.subscription }}
-              runMode: ${{ parameters.runMode }}
-
-`, comp, region)
+      - template: component-jobs.yml
+        parameters:
+          component: '%s'
+          region: '%s'
+          environment: ${{ parameters.environment }}
+          subscription: ${{ parameters.subscription }}
+          runMode: ${{ parameters.runMode }}
+          pipelineEnvironment: ${{ parameters.pipelineEnvironment }}
+          serviceConnection: ${{ parameters.serviceConnection }}
+%s
+`, comp, region, swapSlotParameter(componentConfig, "          "))
 			}
 		}
 	}
 
 	// Write the template file
 	templatePath := filepath.Join(".azure-pipelines/templates", fmt.Sprintf("stack-%s.yml", stackName))
-	if err := os.WriteFile(templatePath, []byte(template), 0644); err != nil {
+	if err := writeFile(templatePath, template, 0644); err != nil {
 		return fmt.Errorf("failed to write stack template: %w", err)
 	}
 
 	return nil
 }
 
-// GeneratePipelineTemplates generates all pipeline templates
-func GeneratePipelineTemplates() error {
+// swapSlotParameter returns the swapSlot template parameter of a component
+// that swaps a deployment slot into production after apply, or nothing
+func swapSlotParameter(comp config.Component, indent string) string {
+	if comp.SlotSwap == "" {
+		return ""
+	}
+	return fmt.Sprintf("%sswapSlot: '%s'\n", indent, comp.SlotSwap)
+}
+
+// GeneratePipelineTemplates generates all pipeline templates for the given
+// build agent OS (linux or windows)
+func GeneratePipelineTemplates(agentName string) error {
+	release, err := lock.Acquire("pipeline")
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	agent, err := agentFor(agentName)
+	if err != nil {
+		return err
+	}
+
 	// Create .azure-pipelines directory if it doesn't exist
-	if err := os.MkdirAll(".azure-pipelines", 0755); err != nil {
+	if err := project.MkdirAll(".azure-pipelines", 0755); err != nil {
 		return fmt.Errorf("failed to create pipeline directory: %w", err)
 	}
 
@@ -418,6 +465,8 @@ func GeneratePipelineTemplates() error {
 		return fmt.Errorf("failed to read TGS config: %w", err)
 	}
 
+	prefixes := naming.NewPrefixes(tgsConfig.Prefixes)
+
 	// Track processed stacks to avoid duplicates
 	processedStacks := make(map[string]bool)
 
@@ -435,17 +484,21 @@ func GeneratePipelineTemplates() error {
 					return fmt.Errorf("failed to read stack config %s: %w", stackName, err)
 				}
 
-				if err := generateStackTemplate(stackName, mainConfig); err != nil {
+				if err := generateStackTemplate(stackName, tgsConfig, mainConfig, prefixes, agent); err != nil {
 					return fmt.Errorf("failed to generate stack template for %s: %w", stackName, err)
 				}
 
+				if err := generateDestroyTemplate(stackName, mainConfig, agent); err != nil {
+					return fmt.Errorf("failed to generate stack destroy template for %s: %w", stackName, err)
+				}
+
 				processedStacks[stackName] = true
 			}
 		}
 	}
 
 	// Generate the component deployment template
-	if err := generateDeploymentTemplate(); err != nil {
+	if err := generateDeploymentTemplate(tgsConfig.Tooling, agent); err != nil {
 		return fmt.Errorf("failed to generate deployment template: %w", err)
 	}
 
@@ -462,71 +515,50 @@ func GeneratePipelineTemplates() error {
 		}
 	}
 
+	// Generate the Azure DevOps environments and approvals snippet
+	if err := generateEnvironmentsConfig(tgsConfig); err != nil {
+		return fmt.Errorf("failed to generate environments config: %w", err)
+	}
+
+	return nil
+}
+
+// writeFile writes a generated pipeline file and publishes it
+func writeFile(path, content string, perm os.FileMode) error {
+	if err := project.WriteFile(path, []byte(content), perm); err != nil {
+		return err
+	}
+	events.FileWritten(path)
 	return nil
 }
 
+// projectDirectory returns the directory pipeline scripts run in: the
+// repository root, or the project's directory when it's a workspace
+func projectDirectory() string {
+	return strings.TrimSuffix("$(Build.SourcesDirectory)/"+workspace.Prefix(), "/")
+}
+
 // generateDeploymentTemplate generates the deployment template YAML
-func generateDeploymentTemplate() error {
+func generateDeploymentTemplate(tooling config.ToolingConfig, agent agentProfile) error {
 	// Create templates directory if it doesn't exist
-	if err := os.MkdirAll(".azure-pipelines/templates", 0755); err != nil {
+	if err := project.MkdirAll(".azure-pipelines/templates", 0755); err != nil {
 		return fmt.Errorf("failed to create templates directory: %w", err)
 	}
 
 	// Create scripts directory if it doesn't exist
-	if err := os.MkdirAll(".azure-pipelines/scripts", 0755); err != nil {
+	if err := project.MkdirAll(".azure-pipelines/scripts", 0755); err != nil {
 		return fmt.Errorf("failed to create scripts directory: %w", err)
 	}
 
-	// Generate deploy script
-	deployScript := `#!/bin/bash
-set -e
-
-# Set the working directory
-if [ -n "$1" ]; then
-  cd .infrastructure/architecture/$2/$3/$4/$5/$1
-else
-  cd .infrastructure/architecture/$2/$3/$4/$5
-fi
+	// Generate deploy script, pointed at the output directory
+	deployScript := strings.ReplaceAll(agent.deployScript, ".infrastructure/", output.Dir()+"/")
 
-# Function to convert JSON to terragrunt var arguments
-convert_json_to_vars() {
-  if [ -n "$INLINE_VARS" ] && [ "$INLINE_VARS" != '""' ]; then
-    # Use jq to parse the JSON and convert it to var arguments
-    echo "$INLINE_VARS" | jq -r 'to_entries | .[] | "-var=\"\(.key)=\(.value)\""' | tr '\n' ' '
-  fi
-}
-
-# Get the var arguments
-VAR_ARGS=$(convert_json_to_vars)
-
-# Always run init
-terragrunt init
-
-# Run the appropriate command based on runMode
-case "$6" in
-  "plan")
-    terragrunt plan $VAR_ARGS
-    ;;
-  "apply")
-    terragrunt plan $VAR_ARGS
-    terragrunt apply --auto-approve $VAR_ARGS
-    terragrunt output
-    ;;
-  "destroy")
-    terragrunt destroy --auto-approve $VAR_ARGS
-    ;;
-  *)
-    echo "Invalid runMode: $6"
-    exit 1
-    ;;
-esac`
-
-	if err := os.WriteFile(".azure-pipelines/scripts/deploy.sh", []byte(deployScript), 0755); err != nil {
+	if err := writeFile(filepath.Join(".azure-pipelines/scripts", agent.deployScriptName), deployScript, 0755); err != nil {
 		return fmt.Errorf("failed to create deploy script: %w", err)
 	}
 
 	// Generate component deployment template
-	componentTemplate := `parameters:
+	componentTemplate := fmt.Sprintf(`parameters:
   - name: component
     type: string
   - name: region
@@ -540,10 +572,10 @@ esac`
     default: ''
   - name: terraform_version
     type: string
-    default: '1.11.2'
+    default: '%s'
   - name: terragrunt_version
     type: string
-    default: 'v0.69.10'
+    default: '%s'
   - name: runMode
     type: string
     default: 'plan'
@@ -551,35 +583,167 @@ esac`
       - plan
       - apply
       - destroy
+      - swap
+  - name: planFile
+    type: string
+    default: ''
+  - name: swapSlot
+    type: string
+    default: ''
+  - name: serviceConnection
+    type: string
+    default: ''
+  - name: workingDirectory
+    type: string
+    default: '%s'
 
 steps:
-  - script: |
-      # Install Terraform
-      wget -O- https://apt.releases.hashicorp.com/gpg | gpg --dearmor | sudo tee /usr/share/keyrings/hashicorp-archive-keyring.gpg
-      echo "deb [signed-by=/usr/share/keyrings/hashicorp-archive-keyring.gpg] https://apt.releases.hashicorp.com $(lsb_release -cs) main" | sudo tee /etc/apt/sources.list.d/hashicorp.list
-      sudo apt update && sudo apt install -y terraform=${{ parameters.terraform_version }}
-
-      # Install Terragrunt
-      wget https://github.com/gruntwork-io/terragrunt/releases/download/${{ parameters.terragrunt_version }}/terragrunt_linux_amd64
-      chmod +x terragrunt_linux_amd64
-      sudo mv terragrunt_linux_amd64 /usr/local/bin/terragrunt
-    displayName: Install Terraform and Terragrunt
-
-  - script: |
-      chmod +x .azure-pipelines/scripts/deploy.sh
-      .azure-pipelines/scripts/deploy.sh "${{ parameters.app }}" "${{ parameters.subscription }}" "${{ parameters.region }}" "${{ parameters.environment }}" "${{ parameters.component }}" "${{ parameters.runMode }}"
-    displayName: Deploy Infrastructure
-    env:
-      ARM_CLIENT_ID: $(ARM_CLIENT_ID)
-      ARM_CLIENT_SECRET: $(ARM_CLIENT_SECRET)
-      ARM_SUBSCRIPTION_ID: $(ARM_SUBSCRIPTION_ID)
-      ARM_TENANT_ID: $(ARM_TENANT_ID)
-`
+  - template: install-tools.yml
+    parameters:
+      terraform_version: ${{ parameters.terraform_version }}
+      terragrunt_version: ${{ parameters.terragrunt_version }}
+
+%s`, tooling.Terraform, tooling.TerragruntTag(), projectDirectory(), agent.deploySteps)
 
-	if err := os.WriteFile(".azure-pipelines/templates/component-deploy.yml", []byte(componentTemplate), 0644); err != nil {
+	if err := writeFile(".azure-pipelines/templates/component-deploy.yml", componentTemplate, 0644); err != nil {
 		return fmt.Errorf("failed to create component deployment template: %w", err)
 	}
 
+	// Generate tool installation template, caching the binaries by version
+	// so they're only downloaded once
+	installTemplate := agent.installTemplate
+
+	if err := writeFile(".azure-pipelines/templates/install-tools.yml", installTemplate, 0644); err != nil {
+		return fmt.Errorf("failed to create tool installation template: %w", err)
+	}
+
+	// Generate component jobs template, splitting plan and apply so apply
+	// runs exactly the plan published by the plan job
+	jobsTemplate := fmt.Sprintf(`parameters:
+  - name: component
+    type: string
+  - name: region
+    type: string
+  - name: environment
+    type: string
+  - name: subscription
+    type: string
+  - name: app
+    type: string
+    default: ''
+  - name: runMode
+    type: string
+    default: plan
+    values:
+      - plan
+      - apply
+      - destroy
+  - name: pipelineEnvironment
+    type: string
+    default: ''
+  - name: serviceConnection
+    type: string
+    default: ''
+  - name: swapSlot
+    type: string
+    default: ''
+
+jobs:
+  - ${{ if eq(parameters.runMode, 'destroy') }}:
+    - deployment: Destroy
+      displayName: 'Destroy Infrastructure'
+      ${{ if ne(parameters.pipelineEnvironment, '') }}:
+        environment: ${{ parameters.pipelineEnvironment }}
+      ${{ else }}:
+        environment: ${{ parameters.environment }}
+      pool:
+        vmImage: %s
+      strategy:
+        runOnce:
+          deploy:
+            steps:
+              - checkout: self
+
+              - template: component-deploy.yml
+                parameters:
+                  component: ${{ parameters.component }}
+                  region: ${{ parameters.region }}
+                  environment: ${{ parameters.environment }}
+                  subscription: ${{ parameters.subscription }}
+                  app: ${{ parameters.app }}
+                  runMode: destroy
+                  serviceConnection: ${{ parameters.serviceConnection }}
+
+  - ${{ if ne(parameters.runMode, 'destroy') }}:
+    - job: Plan
+      displayName: 'Plan Infrastructure'
+      pool:
+        vmImage: %s
+      steps:
+        - template: component-deploy.yml
+          parameters:
+            component: ${{ parameters.component }}
+            region: ${{ parameters.region }}
+            environment: ${{ parameters.environment }}
+            subscription: ${{ parameters.subscription }}
+            app: ${{ parameters.app }}
+            runMode: plan
+            planFile: $(Build.ArtifactStagingDirectory)/tfplan
+            serviceConnection: ${{ parameters.serviceConnection }}
+
+        - publish: $(Build.ArtifactStagingDirectory)/tfplan
+          artifact: plan_$(System.StageName)
+          displayName: Publish Plan
+
+  - ${{ if eq(parameters.runMode, 'apply') }}:
+    - deployment: Apply
+      displayName: 'Apply Infrastructure'
+      dependsOn: Plan
+      ${{ if ne(parameters.pipelineEnvironment, '') }}:
+        environment: ${{ parameters.pipelineEnvironment }}
+      ${{ else }}:
+        environment: ${{ parameters.environment }}
+      pool:
+        vmImage: %s
+      strategy:
+        runOnce:
+          deploy:
+            steps:
+              - checkout: self
+
+              - download: current
+                artifact: plan_$(System.StageName)
+                displayName: Download Plan
+
+              - template: component-deploy.yml
+                parameters:
+                  component: ${{ parameters.component }}
+                  region: ${{ parameters.region }}
+                  environment: ${{ parameters.environment }}
+                  subscription: ${{ parameters.subscription }}
+                  app: ${{ parameters.app }}
+                  runMode: apply
+                  planFile: $(Pipeline.Workspace)/plan_$(System.StageName)/tfplan
+                  serviceConnection: ${{ parameters.serviceConnection }}
+
+              # Blue/green: swap the deployment slot into production
+              - ${{ if ne(parameters.swapSlot, '') }}:
+                - template: component-deploy.yml
+                  parameters:
+                    component: ${{ parameters.component }}
+                    region: ${{ parameters.region }}
+                    environment: ${{ parameters.environment }}
+                    subscription: ${{ parameters.subscription }}
+                    app: ${{ parameters.app }}
+                    runMode: swap
+                    swapSlot: ${{ parameters.swapSlot }}
+                    serviceConnection: ${{ parameters.serviceConnection }}
+`, agent.vmImage, agent.vmImage, agent.vmImage)
+
+	if err := writeFile(".azure-pipelines/templates/component-jobs.yml", jobsTemplate, 0644); err != nil {
+		return fmt.Errorf("failed to create component jobs template: %w", err)
+	}
+
 	// Generate app deployment template
 	appTemplate := `parameters:
   - name: component
@@ -606,28 +770,39 @@ steps:
     default: []
   - name: stageName
     type: string
+  - name: condition
+    type: string
+    default: succeeded()
+  - name: pipelineEnvironment
+    type: string
+    default: ''
+  - name: serviceConnection
+    type: string
+    default: ''
+  - name: swapSlot
+    type: string
+    default: ''
 
 stages:
   - stage: ${{ parameters.stageName }}
     displayName: ${{ parameters.displayName }}
     dependsOn: ${{ parameters.dependsOn }}
+    condition: ${{ parameters.condition }}
     jobs:
-      - job: Deploy
-        displayName: 'Deploy Infrastructure (${{ parameters.runMode }})'
-        pool:
-          vmImage: ubuntu-latest
-        steps:
-          - template: component-deploy.yml
-            parameters:
-              component: ${{ parameters.component }}
-              region: ${{ parameters.region }}
-              environment: ${{ parameters.environment }}
-              subscription: ${{ parameters.subscription }}
-              runMode: ${{ parameters.runMode }}
-              app: ${{ parameters.app }}
+      - template: component-jobs.yml
+        parameters:
+          component: ${{ parameters.component }}
+          region: ${{ parameters.region }}
+          environment: ${{ parameters.environment }}
+          subscription: ${{ parameters.subscription }}
+          runMode: ${{ parameters.runMode }}
+          pipelineEnvironment: ${{ parameters.pipelineEnvironment }}
+          serviceConnection: ${{ parameters.serviceConnection }}
+          app: ${{ parameters.app }}
+          swapSlot: ${{ parameters.swapSlot }}
 `
 
-	if err := os.WriteFile(".azure-pipelines/templates/app-deploy.yml", []byte(appTemplate), 0644); err != nil {
+	if err := writeFile(".azure-pipelines/templates/app-deploy.yml", appTemplate, 0644); err != nil {
 		return fmt.Errorf("failed to create app deployment template: %w", err)
 	}
 
@@ -652,15 +827,23 @@ func generateEnvironmentPipeline(envName string, components []Component) error {
 	// Find stack name and variable group for this environment
 	stackName := "main"
 	varGroup := "terraform-variables" // Default value
+	pipelineEnv := envName
+	serviceConnection := ""
+	var remoteState config.RemoteState
+	protected := false
 	for subName, subscription := range tgsConfig.Subscriptions {
 		for _, env := range subscription.Environments {
 			if env.Name == envName && subName == sub {
 				if env.Stack != "" {
 					stackName = env.Stack
 				}
+				pipelineEnv = env.PipelineEnvironmentName()
+				protected = env.Protected
 				if subscription.CIVariableGroup != "" {
 					varGroup = subscription.CIVariableGroup
 				}
+				serviceConnection = subscription.ServiceConnection
+				remoteState = subscription.RemoteState
 				break
 			}
 		}
@@ -678,7 +861,10 @@ parameters:
     values:
       - plan
       - apply
-      - destroy
+  - name: changedOnly
+    displayName: Deploy only components affected by the change
+    type: boolean
+    default: true
 
 variables:
   - name: environment
@@ -687,9 +873,9 @@ variables:
     value: '%s'
   - group: %s
   - name: terraform_version
-    value: '1.11.2'
+    value: '%s'
   - name: terragrunt_version
-    value: 'v0.69.10'
+    value: '%s'
 
 stages:
   - template: templates/stack-%s.yml
@@ -697,14 +883,30 @@ stages:
       environment: $(environment)
       subscription: $(subscription)
       runMode: ${{ parameters.runMode }}
-`, envName, envName, sub, varGroup, stackName)
+      changedOnly: ${{ parameters.changedOnly }}
+      pipelineEnvironment: '%s'
+      serviceConnection: '%s'
+`, envName, envName, sub, varGroup, tgsConfig.Tooling.Terraform, tgsConfig.Tooling.TerragruntTag(), stackName, pipelineEnv, serviceConnection)
+
+	// Back up the remote state before applying
+	if backup := remoteState.Backup; backup != nil {
+		pipeline += fmt.Sprintf(`      stateAccount: '%s'
+      stateBackupAccount: '%s'
+      stateBackupContainer: '%s'
+`, remoteState.Name, remoteState.BackupAccount(), backup.Container)
+	}
 
 	// Write the pipeline file
 	pipelinePath := filepath.Join(".azure-pipelines", fmt.Sprintf("%s-pipeline.yml", envName))
-	if err := os.WriteFile(pipelinePath, []byte(pipeline), 0644); err != nil {
+	if err := writeFile(pipelinePath, pipeline, 0644); err != nil {
 		return fmt.Errorf("failed to write pipeline file: %w", err)
 	}
 
+	// Write the destroy pipeline
+	if err := generateDestroyPipeline(envName, sub, stackName, varGroup, pipelineEnv, serviceConnection, protected); err != nil {
+		return err
+	}
+
 	return nil
 }
 
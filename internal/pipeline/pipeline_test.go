@@ -0,0 +1,611 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/naming"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"gopkg.in/yaml.v3"
+)
+
+// testStack has a cross-region dependency, a paired region dependency, an
+// app component and a dependency cycle
+func testStack() *config.MainConfig {
+	return &config.MainConfig{Stack: config.StackConfig{
+		Components: map[string]config.Component{
+			"redis":      {Source: "azurerm_redis_cache", Provider: "azurerm", Version: "4.22.0"},
+			"appservice": {Source: "azurerm_linux_web_app", Provider: "azurerm", Version: "4.22.0", Deps: []string{"{region}.redis", "{paired_region}.redis"}},
+			"frontdoor":  {Source: "azurerm_cdn_frontdoor_profile", Provider: "azurerm", Version: "4.22.0", Deps: []string{"eastus2.appservice"}},
+			"a":          {Source: "azurerm_resource_group", Provider: "azurerm", Version: "4.22.0", Deps: []string{"{region}.b"}},
+			"b":          {Source: "azurerm_resource_group", Provider: "azurerm", Version: "4.22.0", Deps: []string{"{region}.a"}},
+		},
+		Architecture: config.ArchitectureConfig{
+			Regions: map[string][]config.RegionComponent{
+				"eastus2": {{Component: "redis"}, {Component: "appservice", Apps: []string{"api", "web"}}, {Component: "a"}, {Component: "b"}},
+				"westus2": {{Component: "redis"}, {Component: "frontdoor"}},
+			},
+			PairedRegions: map[string]string{"eastus2": "westus2"},
+		},
+	}}
+}
+
+// useProject makes a temporary directory the project root for a test
+func useProject(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	project.SetRoot(dir)
+	output.SetDir("")
+	t.Cleanup(func() { project.SetRoot("") })
+	return dir
+}
+
+// pipelineStage is a stage of a generated template
+type pipelineStage struct {
+	Stage     string    `yaml:"stage"`
+	DependsOn yaml.Node `yaml:"dependsOn"`
+	Condition string    `yaml:"condition"`
+	Jobs      []struct {
+		Job   string `yaml:"job"`
+		Steps []map[string]interface{}
+	} `yaml:"jobs"`
+}
+
+// parseStages parses the dependencies of the stages of a generated template
+// by name. App stages are keyed by the stageName of their template.
+func parseStages(t *testing.T, path string) map[string][]string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	var template struct {
+		Stages []yaml.Node `yaml:"stages"`
+	}
+	if err := yaml.Unmarshal(data, &template); err != nil {
+		t.Fatalf("Failed to parse %s: %v\n%s", path, err, data)
+	}
+
+	stages := make(map[string][]string)
+	for _, item := range template.Stages {
+		var stage struct {
+			Stage     string   `yaml:"stage"`
+			DependsOn []string `yaml:"dependsOn"`
+		}
+		if err := item.Decode(&stage); err != nil {
+			t.Fatalf("Failed to decode stage: %v", err)
+		}
+		if stage.Stage != "" {
+			stages[stage.Stage] = stage.DependsOn
+			continue
+		}
+
+		// ${{ each app in parameters.<component>_apps }} expanding app stages
+		var expanded map[string][]struct {
+			Parameters struct {
+				StageName string   `yaml:"stageName"`
+				DependsOn []string `yaml:"dependsOn"`
+			} `yaml:"parameters"`
+		}
+		if err := item.Decode(&expanded); err != nil {
+			t.Fatalf("Failed to decode app stages: %v", err)
+		}
+		for _, templates := range expanded {
+			for _, app := range templates {
+				stages[app.Parameters.StageName] = app.Parameters.DependsOn
+			}
+		}
+	}
+	return stages
+}
+
+func TestChangeCondition(t *testing.T) {
+	want := "and(not(failed()), not(canceled()), eq(dependencies.DetectChanges.outputs['detect.changes.eastus2_redis'], 'true'))"
+	if got := changeCondition("eastus2", "redis"); got != want {
+		t.Errorf("changeCondition() = %s, want %s", got, want)
+	}
+}
+
+func TestAffectedPaths(t *testing.T) {
+	useProject(t)
+	stack := testStack()
+
+	dirs := func(paths []string) []string {
+		var components []string
+		for _, path := range paths {
+			if strings.Contains(path, "/_components/") {
+				components = append(components, path)
+			}
+		}
+		return components
+	}
+
+	testCases := []struct {
+		name   string
+		region string
+		comp   string
+		want   []string
+	}{
+		{name: "No dependencies", region: "eastus2", comp: "redis", want: []string{".infrastructure/_components/main/redis/"}},
+		{
+			name:   "Same and paired region dependencies",
+			region: "eastus2",
+			comp:   "appservice",
+			want:   []string{".infrastructure/_components/main/appservice/", ".infrastructure/_components/main/redis/", ".infrastructure/_components/main/redis/"},
+		},
+		{
+			name:   "Transitive cross-region dependencies",
+			region: "westus2",
+			comp:   "frontdoor",
+			want:   []string{".infrastructure/_components/main/frontdoor/", ".infrastructure/_components/main/appservice/", ".infrastructure/_components/main/redis/", ".infrastructure/_components/main/redis/"},
+		},
+		{name: "Cycle", region: "eastus2", comp: "a", want: []string{".infrastructure/_components/main/a/", ".infrastructure/_components/main/b/"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			paths := affectedPaths("main", stack, tc.region, tc.comp, make(map[string]bool))
+			if got := dirs(paths); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("affectedPaths() components = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	// The architecture folders are those of the deployed environment in each region
+	paths := affectedPaths("main", stack, "westus2", "frontdoor", make(map[string]bool))
+	for _, want := range []string{
+		".infrastructure/architecture/main/${{ parameters.subscription }}/westus2/${{ parameters.environment }}/frontdoor/",
+		".infrastructure/architecture/main/${{ parameters.subscription }}/eastus2/${{ parameters.environment }}/appservice/",
+		".infrastructure/architecture/main/${{ parameters.subscription }}/westus2/${{ parameters.environment }}/redis/",
+		".infrastructure/config/main/app_settings_appservice/",
+	} {
+		found := false
+		for _, path := range paths {
+			found = found || path == want
+		}
+		if !found {
+			t.Errorf("affectedPaths() = %v, want it to include %s", paths, want)
+		}
+	}
+}
+
+func TestChangeDetectionStage(t *testing.T) {
+	useProject(t)
+	stack := testStack()
+
+	testCases := []struct {
+		agent string
+		step  string
+		check string
+	}{
+		{agent: AgentLinux, step: "bash", check: "detect westus2_frontdoor '.infrastructure/_components/main/frontdoor/' "},
+		{agent: AgentWindows, step: "pwsh", check: "Detect westus2_frontdoor @('.infrastructure/_components/main/frontdoor/', "},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.agent, func(t *testing.T) {
+			agent, err := agentFor(tc.agent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			content := "stages:\n" + generateChangeDetectionStage("main", stack, agent)
+
+			var template struct {
+				Stages []pipelineStage `yaml:"stages"`
+			}
+			if err := yaml.Unmarshal([]byte(content), &template); err != nil {
+				t.Fatalf("Failed to parse change detection stage: %v\n%s", err, content)
+			}
+			if len(template.Stages) != 1 || template.Stages[0].Stage != changeStage {
+				t.Fatalf("stages = %+v, want the %s stage", template.Stages, changeStage)
+			}
+			stage := template.Stages[0]
+			if stage.DependsOn.Kind != yaml.SequenceNode || len(stage.DependsOn.Content) != 0 {
+				t.Errorf("%s dependsOn = %v, want []", changeStage, stage.DependsOn.Value)
+			}
+			if len(stage.Jobs) != 1 || stage.Jobs[0].Job != "detect" || len(stage.Jobs[0].Steps) != 2 {
+				t.Fatalf("jobs = %+v, want the detect job with checkout and its script", stage.Jobs)
+			}
+
+			// The step and job names are those of the stage conditions
+			step := stage.Jobs[0].Steps[1]
+			if step["name"] != "changes" {
+				t.Errorf("script step name = %v, want changes", step["name"])
+			}
+			script, ok := step[tc.step].(string)
+			if !ok {
+				t.Fatalf("script step = %v, want a %s script", step, tc.step)
+			}
+			var keys []string
+			for _, line := range strings.Split(script, "\n") {
+				if fields := strings.Fields(line); len(fields) > 1 && strings.EqualFold(fields[0], "detect") {
+					keys = append(keys, fields[1])
+				}
+			}
+			sort.Strings(keys)
+			want := []string{"eastus2_a", "eastus2_appservice", "eastus2_b", "eastus2_redis", "westus2_frontdoor", "westus2_redis"}
+			if !reflect.DeepEqual(keys, want) {
+				t.Errorf("detected keys = %v, want %v", keys, want)
+			}
+			if !strings.Contains(script, tc.check) {
+				t.Errorf("script doesn't contain %q:\n%s", tc.check, script)
+			}
+			if !strings.Contains(script, `^\.infrastructure/(root\.hcl|config/global\.hcl|`) {
+				t.Errorf("script doesn't check the shared files:\n%s", script)
+			}
+		})
+	}
+}
+
+func TestStackTemplate(t *testing.T) {
+	tgsConfig := &config.TGSConfig{Name: "projecta"}
+	prefixes := naming.NewPrefixes(config.PrefixConfig{})
+
+	want := map[string][]string{
+		"eastus2_redis":                 {changeStage},
+		"eastus2_appservice_${{ app }}": {changeStage, "eastus2_redis", "westus2_redis"},
+		"eastus2_a":                     {changeStage, "eastus2_b"},
+		"eastus2_b":                     {changeStage, "eastus2_a"},
+		"westus2_redis":                 {changeStage},
+		"westus2_frontdoor":             {changeStage, "eastus2_appservice_api", "eastus2_appservice_web"},
+		changeStage:                     {},
+	}
+
+	for _, agentName := range []string{AgentLinux, AgentWindows} {
+		t.Run(agentName, func(t *testing.T) {
+			dir := useProject(t)
+			agent, err := agentFor(agentName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := generateStackTemplate("main", tgsConfig, testStack(), prefixes, agent); err != nil {
+				t.Fatalf("generateStackTemplate() unexpected error: %v", err)
+			}
+
+			stages := parseStages(t, filepath.Join(dir, ".azure-pipelines", "templates", "stack-main.yml"))
+			if !reflect.DeepEqual(stages, want) {
+				t.Errorf("stage dependencies = %v, want %v", stages, want)
+			}
+		})
+	}
+}
+
+func TestDestroyTemplate(t *testing.T) {
+	// Every component waits for the ones depending on it
+	want := map[string][]string{
+		"ConfirmDestroy":         {},
+		"eastus2_redis":          {"ConfirmDestroy", "eastus2_appservice_api", "eastus2_appservice_web"},
+		"eastus2_appservice_api": {"ConfirmDestroy", "westus2_frontdoor"},
+		"eastus2_appservice_web": {"ConfirmDestroy", "westus2_frontdoor"},
+		"eastus2_a":              {"ConfirmDestroy", "eastus2_b"},
+		"eastus2_b":              {"ConfirmDestroy", "eastus2_a"},
+		"westus2_redis":          {"ConfirmDestroy", "eastus2_appservice_api", "eastus2_appservice_web"},
+		"westus2_frontdoor":      {"ConfirmDestroy"},
+	}
+
+	for _, agentName := range []string{AgentLinux, AgentWindows} {
+		t.Run(agentName, func(t *testing.T) {
+			dir := useProject(t)
+			agent, err := agentFor(agentName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.MkdirAll(filepath.Join(dir, ".azure-pipelines", "templates"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := generateDestroyTemplate("main", testStack(), agent); err != nil {
+				t.Fatalf("generateDestroyTemplate() unexpected error: %v", err)
+			}
+
+			path := filepath.Join(dir, ".azure-pipelines", "templates", "stack-main-destroy.yml")
+			stages := parseStages(t, path)
+			for stage, deps := range stages {
+				sort.Strings(deps)
+				stages[stage] = deps
+			}
+			if !reflect.DeepEqual(stages, want) {
+				t.Errorf("destroy stage dependencies = %v, want %v", stages, want)
+			}
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			confirm := map[string]string{AgentLinux: `if [ "$CONFIRM" != "$ENVIRONMENT" ]`, AgentWindows: `if ($env:CONFIRM -ne $env:ENVIRONMENT)`}[agentName]
+			if !strings.Contains(string(content), confirm) {
+				t.Errorf("destroy template doesn't check the confirmation with %q", confirm)
+			}
+		})
+	}
+}
+
+// writeProject writes tgs.yaml and testStack as the main stack
+func writeProject(t *testing.T, dir, tgsYAML string) {
+	t.Helper()
+
+	stack, err := yaml.Marshal(testStack())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, ".tgs", "stacks"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".tgs", "tgs.yaml"), []byte(tgsYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".tgs", "stacks", "main.yaml"), stack, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGenerateSpacelift(t *testing.T) {
+	dir := useProject(t)
+	writeProject(t, dir, `name: projecta
+tooling:
+  terraform: 1.9.8
+  terragrunt: 0.68.0
+subscriptions:
+  nonprod:
+    remotestate:
+      name: stprojectanonprodtf
+      resource_group: rg-projecta-nonprod-tf
+    environments:
+      - name: dev
+`)
+
+	if err := GenerateSpacelift(); err != nil {
+		t.Fatalf("GenerateSpacelift() unexpected error: %v", err)
+	}
+
+	path := filepath.Join(dir, SpaceliftDir, "stacks.tf")
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	file, diags := hclsyntax.ParseConfig(content, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("Failed to parse %s: %v", path, diags)
+	}
+
+	// literal evaluates an attribute without variables
+	literal := func(body *hclsyntax.Body, name string) cty.Value {
+		t.Helper()
+		attr, ok := body.Attributes[name]
+		if !ok {
+			t.Fatalf("missing attribute %s", name)
+		}
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			t.Fatalf("attribute %s: %v", name, diags)
+		}
+		return value
+	}
+	// reference returns the spacelift_stack an attribute refers to
+	reference := func(body *hclsyntax.Body, name string) string {
+		t.Helper()
+		traversal, diags := hcl.AbsTraversalForExpr(body.Attributes[name].Expr)
+		if diags.HasErrors() || len(traversal) != 3 || traversal.RootName() != "spacelift_stack" {
+			t.Fatalf("attribute %s = %v, want a spacelift_stack reference", name, traversal)
+		}
+		return traversal[1].(hcl.TraverseAttr).Name
+	}
+
+	stacks := make(map[string]string)
+	deps := make(map[string][]string)
+	for _, block := range file.Body.(*hclsyntax.Body).Blocks {
+		if block.Type != "resource" {
+			continue
+		}
+		switch block.Labels[0] {
+		case "spacelift_stack":
+			stacks[block.Labels[1]] = literal(block.Body, "name").AsString()
+		case "spacelift_stack_dependency":
+			stack := reference(block.Body, "stack_id")
+			deps[stack] = append(deps[stack], reference(block.Body, "depends_on_stack_id"))
+		}
+	}
+
+	// A stack per leaf, with the dependencies of the graph
+	wantStacks := map[string]string{
+		"nonprod_dev_eastus2_redis":          "projecta-nonprod-dev-eastus2-redis",
+		"nonprod_dev_eastus2_appservice_api": "projecta-nonprod-dev-eastus2-appservice-api",
+		"nonprod_dev_eastus2_appservice_web": "projecta-nonprod-dev-eastus2-appservice-web",
+		"nonprod_dev_eastus2_a":              "projecta-nonprod-dev-eastus2-a",
+		"nonprod_dev_eastus2_b":              "projecta-nonprod-dev-eastus2-b",
+		"nonprod_dev_westus2_redis":          "projecta-nonprod-dev-westus2-redis",
+		"nonprod_dev_westus2_frontdoor":      "projecta-nonprod-dev-westus2-frontdoor",
+	}
+	if !reflect.DeepEqual(stacks, wantStacks) {
+		t.Errorf("spacelift stacks = %v, want %v", stacks, wantStacks)
+	}
+	for stack := range deps {
+		sort.Strings(deps[stack])
+	}
+	wantDeps := map[string][]string{
+		"nonprod_dev_eastus2_appservice_api": {"nonprod_dev_eastus2_redis", "nonprod_dev_westus2_redis"},
+		"nonprod_dev_eastus2_appservice_web": {"nonprod_dev_eastus2_redis", "nonprod_dev_westus2_redis"},
+		"nonprod_dev_eastus2_a":              {"nonprod_dev_eastus2_b"},
+		"nonprod_dev_eastus2_b":              {"nonprod_dev_eastus2_a"},
+		"nonprod_dev_westus2_frontdoor":      {"nonprod_dev_eastus2_appservice_api", "nonprod_dev_eastus2_appservice_web"},
+	}
+	if !reflect.DeepEqual(deps, wantDeps) {
+		t.Errorf("spacelift stack dependencies = %v, want %v", deps, wantDeps)
+	}
+
+	// Stacks run terragrunt in the leaf folder with the pinned versions
+	for _, block := range file.Body.(*hclsyntax.Body).Blocks {
+		if block.Type != "resource" || block.Labels[1] != "nonprod_dev_eastus2_appservice_api" {
+			continue
+		}
+		if got := literal(block.Body, "project_root").AsString(); got != ".infrastructure/architecture/main/nonprod/eastus2/dev/appservice/api" {
+			t.Errorf("project_root = %s, want the app folder", got)
+		}
+		var labels []string
+		for _, label := range literal(block.Body, "labels").AsValueSlice() {
+			labels = append(labels, label.AsString())
+		}
+		wantLabels := []string{"tgs", "stack:main", "subscription:nonprod", "environment:dev", "region:eastus2", "component:appservice", "app:api"}
+		if !reflect.DeepEqual(labels, wantLabels) {
+			t.Errorf("labels = %v, want %v", labels, wantLabels)
+		}
+		terragrunt := block.Body.Blocks[0].Body
+		if got := literal(terragrunt, "terraform_version").AsString() + " " + literal(terragrunt, "terragrunt_version").AsString(); got != "1.9.8 0.68.0" {
+			t.Errorf("terragrunt versions = %s, want the tooling of tgs.yaml", got)
+		}
+	}
+}
+
+func TestGenerateSpaceliftStacksLayout(t *testing.T) {
+	dir := useProject(t)
+	writeProject(t, dir, "name: projecta\nlayout: stacks\nsubscriptions:\n  nonprod:\n    environments:\n      - name: dev\n")
+
+	if err := GenerateSpacelift(); err == nil || !strings.Contains(err.Error(), "require the folders layout") {
+		t.Errorf("GenerateSpacelift() error = %v, want a layout error", err)
+	}
+}
+
+func TestAgentFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		vmImage string
+		script  string
+	}{
+		{"", "ubuntu-latest", "deploy.sh"},
+		{AgentLinux, "ubuntu-latest", "deploy.sh"},
+		{AgentWindows, "windows-latest", "deploy.ps1"},
+	}
+	for _, tt := range tests {
+		agent, err := agentFor(tt.name)
+		if err != nil {
+			t.Errorf("agentFor(%q) unexpected error: %v", tt.name, err)
+			continue
+		}
+		if agent.vmImage != tt.vmImage || agent.deployScriptName != tt.script {
+			t.Errorf("agentFor(%q) = %s, %s, want %s, %s", tt.name, agent.vmImage, agent.deployScriptName, tt.vmImage, tt.script)
+		}
+	}
+
+	want := `unsupported agent "macos": must be one of linux, windows`
+	if _, err := agentFor("macos"); err == nil || err.Error() != want {
+		t.Errorf("agentFor(macos) error = %v, want %s", err, want)
+	}
+}
+
+// scriptSteps returns the script step types of a generated template, with
+// the script types of its AzureCLI tasks, by walking its steps and their
+// template expressions
+func scriptSteps(t *testing.T, path string) []string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	var template interface{}
+	if err := yaml.Unmarshal(data, &template); err != nil {
+		t.Fatalf("Failed to parse %s: %v\n%s", path, err, data)
+	}
+
+	var steps []string
+	var walk func(node interface{})
+	walk = func(node interface{}) {
+		switch node := node.(type) {
+		case []interface{}:
+			for _, item := range node {
+				walk(item)
+			}
+		case map[string]interface{}:
+			for key, value := range node {
+				switch key {
+				case "script", "bash", "pwsh", "powershell":
+					steps = append(steps, key)
+				case "scriptType":
+					steps = append(steps, "AzureCLI "+value.(string))
+				}
+				walk(value)
+			}
+		}
+	}
+	walk(template)
+	sort.Strings(steps)
+	return steps
+}
+
+func TestDeploymentTemplate(t *testing.T) {
+	tooling := config.ToolingConfig{Terraform: "1.9.8", Terragrunt: "0.68.0"}
+
+	tests := []struct {
+		agent   string
+		script  string
+		other   string
+		deploy  []string
+		install []string
+	}{
+		{AgentLinux, "deploy.sh", "deploy.ps1", []string{"AzureCLI bash", "script"}, []string{"script", "script"}},
+		{AgentWindows, "deploy.ps1", "deploy.sh", []string{"AzureCLI pscore", "pwsh"}, []string{"pwsh", "pwsh"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.agent, func(t *testing.T) {
+			dir := useProject(t)
+			output.SetDir("infra")
+			t.Cleanup(func() { output.SetDir("") })
+
+			agent, err := agentFor(tt.agent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := generateDeploymentTemplate(tooling, agent); err != nil {
+				t.Fatalf("generateDeploymentTemplate() unexpected error: %v", err)
+			}
+
+			// Only the deploy script of the agent is written, pointed at the
+			// output directory
+			scripts := filepath.Join(dir, ".azure-pipelines", "scripts")
+			content, err := os.ReadFile(filepath.Join(scripts, tt.script))
+			if err != nil {
+				t.Fatalf("%s not written: %v", tt.script, err)
+			}
+			if strings.Contains(string(content), ".infrastructure/") || !strings.Contains(string(content), "infra/architecture/") {
+				t.Errorf("%s doesn't run in the output directory:\n%s", tt.script, content)
+			}
+			if _, err := os.Stat(filepath.Join(scripts, tt.other)); !os.IsNotExist(err) {
+				t.Errorf("%s written for the %s agent", tt.other, tt.agent)
+			}
+
+			// Every step runs in the shell of the agent
+			templates := filepath.Join(dir, ".azure-pipelines", "templates")
+			if got := scriptSteps(t, filepath.Join(templates, "component-deploy.yml")); !reflect.DeepEqual(got, tt.deploy) {
+				t.Errorf("component-deploy.yml steps = %v, want %v", got, tt.deploy)
+			}
+			if got := scriptSteps(t, filepath.Join(templates, "install-tools.yml")); !reflect.DeepEqual(got, tt.install) {
+				t.Errorf("install-tools.yml steps = %v, want %v", got, tt.install)
+			}
+			deploy, err := os.ReadFile(filepath.Join(templates, "component-deploy.yml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(deploy), ".azure-pipelines/scripts/"+tt.script) {
+				t.Errorf("component-deploy.yml doesn't run %s", tt.script)
+			}
+
+			jobs, err := os.ReadFile(filepath.Join(templates, "component-jobs.yml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Count(string(jobs), "vmImage: "+agent.vmImage); got != 3 {
+				t.Errorf("component-jobs.yml has %d jobs on %s, want 3", got, agent.vmImage)
+			}
+		})
+	}
+}
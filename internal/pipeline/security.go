@@ -0,0 +1,94 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/scan"
+)
+
+// Scanner releases installed by the security scan job
+const (
+	tfsecVersion    = "1.28.11"
+	conftestVersion = "0.56.0"
+)
+
+// linuxScannerInstalls installs a scanner into $tools on Linux agents
+var linuxScannerInstalls = map[string]string{
+	config.SecurityToolTfsec: fmt.Sprintf(`curl -fsSLo "$tools/tfsec" https://github.com/aquasecurity/tfsec/releases/download/v%s/tfsec-linux-amd64
+chmod +x "$tools/tfsec"
+`, tfsecVersion),
+	config.SecurityToolCheckov: `pip3 install --quiet checkov
+`,
+	config.SecurityToolConftest: fmt.Sprintf(`curl -fsSL https://github.com/open-policy-agent/conftest/releases/download/v%[1]s/conftest_%[1]s_Linux_x86_64.tar.gz | tar -xz -C "$tools" conftest
+`, conftestVersion),
+}
+
+// windowsScannerInstalls installs a scanner into $tools on Windows agents
+var windowsScannerInstalls = map[string]string{
+	config.SecurityToolTfsec: fmt.Sprintf(`Invoke-WebRequest -Uri https://github.com/aquasecurity/tfsec/releases/download/v%s/tfsec-windows-amd64.exe -OutFile "$tools/tfsec.exe"
+`, tfsecVersion),
+	config.SecurityToolCheckov: `pip install --quiet checkov
+if ($LASTEXITCODE -ne 0) { exit $LASTEXITCODE }
+`,
+	config.SecurityToolConftest: fmt.Sprintf(`Invoke-WebRequest -Uri https://github.com/open-policy-agent/conftest/releases/download/v%[1]s/conftest_%[1]s_Windows_x86_64.zip -OutFile "$tools/conftest.zip"
+Expand-Archive -Path "$tools/conftest.zip" -DestinationPath $tools -Force
+`, conftestVersion),
+}
+
+// generateSecurityScanJob returns the job of the change detection stage that
+// runs the scanners of tgs.yaml over the component modules, with the command
+// lines of tgs scan. A failed scan fails the stage, so no component is
+// planned or applied. It's only generated when security.tools is set.
+func generateSecurityScanJob(security config.SecurityConfig, agent agentProfile) string {
+	if len(security.Tools) == 0 {
+		return ""
+	}
+
+	scriptStep := "bash"
+	install := `set -e
+tools="$AGENT_TEMPDIRECTORY/scanners"
+mkdir -p "$tools"
+`
+	installs := linuxScannerInstalls
+	prependPath := `echo "##vso[task.prependpath]$tools"
+`
+	if agent.name == AgentWindows {
+		scriptStep = "pwsh"
+		install = `$ErrorActionPreference = 'Stop'
+$tools = Join-Path $env:AGENT_TEMPDIRECTORY 'scanners'
+New-Item -ItemType Directory -Force -Path $tools | Out-Null
+`
+		installs = windowsScannerInstalls
+		prependPath = `Write-Host "##vso[task.prependpath]$tools"
+`
+	}
+	for _, tool := range security.Tools {
+		install += installs[tool]
+	}
+	install += prependPath
+
+	var scans strings.Builder
+	for _, tool := range security.Tools {
+		args := scan.Args(tool, security, output.Dir()+"/_components")
+		scans.WriteString(fmt.Sprintf(`            - script: %s
+              displayName: '%s'
+              condition: succeededOrFailed()
+              workingDirectory: %s
+`, strings.Join(args, " "), tool, projectDirectory()))
+	}
+
+	return fmt.Sprintf(`      - ${{ if ne(parameters.runMode, 'destroy') }}:
+        - job: securityScan
+          displayName: 'Scan component modules'
+          pool:
+            vmImage: %s
+          steps:
+            - checkout: self
+            - %s: |
+%s              displayName: 'Install scanners'
+%s
+`, agent.vmImage, scriptStep, indentLines(install, "                "), scans.String())
+}
@@ -0,0 +1,189 @@
+package pipeline
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/graph"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/lock"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/workspace"
+)
+
+// SpaceliftDir is where the Spacelift stack definitions are generated
+const SpaceliftDir = ".spacelift"
+
+// identifierPattern matches characters not allowed in Terraform identifiers
+var identifierPattern = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// spaceliftStack is a Spacelift stack managing one leaf of the architecture
+type spaceliftStack struct {
+	Resource    string
+	Name        string
+	ProjectRoot string
+	Labels      []string
+	DependsOn   []string
+}
+
+// GenerateSpacelift writes .spacelift/stacks.tf defining a Spacelift stack
+// for every environment, region and component leaf, with stack dependencies
+// wired from the dependency graph of the tgs stacks
+func GenerateSpacelift() error {
+	release, err := lock.Acquire("spacelift")
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	tgsConfig, err := config.ReadTGSConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read TGS config: %w", err)
+	}
+	if tgsConfig.Layout == config.LayoutStacks {
+		return fmt.Errorf("spacelift stacks require the folders layout: set layout to folders in tgs.yaml")
+	}
+
+	var subs []string
+	for sub := range tgsConfig.Subscriptions {
+		subs = append(subs, sub)
+	}
+	sort.Strings(subs)
+
+	var stacks []spaceliftStack
+	for _, sub := range subs {
+		for _, env := range tgsConfig.Subscriptions[sub].Environments {
+			stackName := "main"
+			if env.Stack != "" {
+				stackName = env.Stack
+			}
+
+			mainConfig, err := config.ReadMainConfig(stackName)
+			if err != nil {
+				return fmt.Errorf("failed to read stack config %s: %w", stackName, err)
+			}
+
+			// Stack resources of a leaf are unique per subscription and environment
+			resource := func(stage string) string {
+				return identifierPattern.ReplaceAllString(fmt.Sprintf("%s_%s_%s", sub, env.Name, stage), "_")
+			}
+
+			g := graph.Build(mainConfig)
+			for _, id := range g.NodeIDs() {
+				node := g.Nodes[id]
+				projectRoot := workspace.Prefix() + filepath.ToSlash(output.Path("architecture", stackName, sub, node.Region, env.Name, node.Component, node.App))
+				name := strings.Join([]string{tgsConfig.Name, sub, env.Name, node.Region, node.Component}, "-")
+				labels := []string{
+					"tgs",
+					"stack:" + stackName,
+					"subscription:" + sub,
+					"environment:" + env.Name,
+					"region:" + node.Region,
+					"component:" + node.Component,
+				}
+				if node.App != "" {
+					name += "-" + node.App
+					labels = append(labels, "app:"+node.App)
+				}
+
+				stack := spaceliftStack{
+					Resource:    resource(nodeStage(node)),
+					Name:        name,
+					ProjectRoot: projectRoot,
+					Labels:      labels,
+				}
+				for _, dep := range g.Edges[id] {
+					stack.DependsOn = append(stack.DependsOn, resource(nodeStage(g.Nodes[dep])))
+				}
+				stacks = append(stacks, stack)
+			}
+		}
+	}
+
+	if err := project.MkdirAll(SpaceliftDir, 0755); err != nil {
+		return fmt.Errorf("failed to create Spacelift directory: %w", err)
+	}
+
+	path := filepath.Join(SpaceliftDir, "stacks.tf")
+	if err := writeFile(path, renderSpacelift(stacks, tgsConfig.Tooling), 0644); err != nil {
+		return fmt.Errorf("failed to write Spacelift stacks: %w", err)
+	}
+
+	return nil
+}
+
+// renderSpacelift renders the Terraform configuration of the Spacelift stacks
+func renderSpacelift(stacks []spaceliftStack, tooling config.ToolingConfig) string {
+	var b strings.Builder
+
+	b.WriteString(`# Spacelift stacks generated by tgs. Apply this configuration from an
+# administrative Spacelift stack to manage one stack per environment, region
+# and component with dependencies matching the tgs dependency graph.
+
+terraform {
+  required_providers {
+    spacelift = {
+      source = "spacelift-io/spacelift"
+    }
+  }
+}
+
+variable "repository" {
+  type        = string
+  description = "Repository containing the generated infrastructure"
+}
+
+variable "branch" {
+  type        = string
+  description = "Branch the stacks track"
+  default     = "main"
+}
+
+variable "space_id" {
+  type        = string
+  description = "Space the stacks are created in"
+  default     = "root"
+}
+`)
+
+	for _, stack := range stacks {
+		var labels []string
+		for _, label := range stack.Labels {
+			labels = append(labels, fmt.Sprintf("%q", label))
+		}
+
+		b.WriteString(fmt.Sprintf(`
+resource "spacelift_stack" "%s" {
+  name         = %q
+  repository   = var.repository
+  branch       = var.branch
+  space_id     = var.space_id
+  project_root = %q
+  labels       = [%s]
+
+  terragrunt {
+    terraform_version  = %q
+    terragrunt_version = %q
+    tool               = "TERRAFORM_FOSS"
+  }
+}
+`, stack.Resource, stack.Name, stack.ProjectRoot, strings.Join(labels, ", "), tooling.Terraform, tooling.Terragrunt))
+	}
+
+	for _, stack := range stacks {
+		for _, dep := range stack.DependsOn {
+			b.WriteString(fmt.Sprintf(`
+resource "spacelift_stack_dependency" "%s__%s" {
+  stack_id            = spacelift_stack.%s.id
+  depends_on_stack_id = spacelift_stack.%s.id
+}
+`, stack.Resource, dep, stack.Resource, dep))
+		}
+	}
+
+	return b.String()
+}
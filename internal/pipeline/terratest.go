@@ -0,0 +1,94 @@
+package pipeline
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/lock"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/workspace"
+)
+
+// GenerateTestPipeline writes .azure-pipelines/terratest.yml, running the
+// tests of tgs test scaffold in testDir on pull requests changing them or the
+// component modules. It uses the install-tools template of tgs pipeline and
+// the variable group of the first subscription.
+func GenerateTestPipeline(agentName, testDir string) error {
+	release, err := lock.Acquire("test scaffold")
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	agent, err := agentFor(agentName)
+	if err != nil {
+		return err
+	}
+
+	tgsConfig, err := config.ReadTGSConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read TGS config: %w", err)
+	}
+
+	varGroup := "terraform-variables"
+	var subs []string
+	for name := range tgsConfig.Subscriptions {
+		subs = append(subs, name)
+	}
+	sort.Strings(subs)
+	if len(subs) > 0 && tgsConfig.Subscriptions[subs[0]].CIVariableGroup != "" {
+		varGroup = tgsConfig.Subscriptions[subs[0]].CIVariableGroup
+	}
+
+	testDir = filepath.ToSlash(filepath.Clean(testDir))
+	content := fmt.Sprintf(`# Runs the terratest suite generated by tgs test scaffold
+trigger: none
+
+pr:
+  paths:
+    include:
+      - %s%s/*
+      - %s/_components/*
+
+variables:
+  - group: %s
+
+stages:
+  - stage: Terratest
+    displayName: 'Terratest'
+    jobs:
+      - job: terratest
+        displayName: 'Plan component modules'
+        timeoutInMinutes: 90
+        pool:
+          vmImage: %s
+        steps:
+          - task: GoTool@0
+            displayName: 'Install Go'
+            inputs:
+              version: '1.22'
+          - template: templates/install-tools.yml
+            parameters:
+              terraform_version: '%s'
+              terragrunt_version: '%s'
+          - script: go test ./... -v -timeout 60m
+            displayName: 'Run terratest'
+            workingDirectory: %s/%s
+            env:
+              ARM_CLIENT_ID: $(ARM_CLIENT_ID)
+              ARM_CLIENT_SECRET: $(ARM_CLIENT_SECRET)
+              ARM_TENANT_ID: $(ARM_TENANT_ID)
+              ARM_SUBSCRIPTION_ID: $(ARM_SUBSCRIPTION_ID)
+`, workspace.Prefix(), testDir, output.RepoPath(), varGroup, agent.vmImage, tgsConfig.Tooling.Terraform, tgsConfig.Tooling.TerragruntTag(), projectDirectory(), testDir)
+
+	if err := project.MkdirAll(".azure-pipelines", 0755); err != nil {
+		return fmt.Errorf("failed to create pipeline directory: %w", err)
+	}
+	if err := writeFile(filepath.Join(".azure-pipelines", "terratest.yml"), content, 0644); err != nil {
+		return fmt.Errorf("failed to write test pipeline: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+// Package project resolves the relative paths tgs reads and writes against
+// the project directory, so a project can be generated without changing the
+// working directory of the process. Its functions mirror those of os,
+// path/filepath and os/exec; paths they return stay relative to the project
+// like the paths they were given.
+package project
+
+import (
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// root is the project directory, the working directory when empty
+var root string
+
+// SetRoot makes relative paths resolve against dir, or against the working
+// directory when dir is empty
+func SetRoot(dir string) {
+	root = dir
+}
+
+// Root returns the project directory, "" for the working directory
+func Root() string {
+	return root
+}
+
+// Path returns name resolved against the project directory. Absolute names
+// and names outside a project with a root are returned unchanged.
+func Path(name string) string {
+	if root == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(root, name)
+}
+
+// Abs returns the absolute path of name in the project directory
+func Abs(name string) (string, error) {
+	return filepath.Abs(Path(name))
+}
+
+// relative maps a path below resolved, the result of Path(name), back to
+// the form of name
+func relative(name, resolved, path string) string {
+	if resolved == name {
+		return path
+	}
+	rest := strings.TrimPrefix(path, resolved)
+	if rest == path {
+		return path
+	}
+	return filepath.Join(name, rest)
+}
+
+// ReadFile reads a file of the project, see os.ReadFile
+func ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(Path(name))
+}
+
+// WriteFile writes a file of the project, see os.WriteFile
+func WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(Path(name), data, perm)
+}
+
+// MkdirAll creates a directory of the project and its parents, see os.MkdirAll
+func MkdirAll(name string, perm fs.FileMode) error {
+	return os.MkdirAll(Path(name), perm)
+}
+
+// Mkdir creates a directory of the project, see os.Mkdir
+func Mkdir(name string, perm fs.FileMode) error {
+	return os.Mkdir(Path(name), perm)
+}
+
+// Stat describes a file of the project, see os.Stat
+func Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(Path(name))
+}
+
+// Lstat describes a file of the project without following links, see os.Lstat
+func Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(Path(name))
+}
+
+// ReadDir lists a directory of the project, see os.ReadDir
+func ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(Path(name))
+}
+
+// Remove removes a file of the project, see os.Remove
+func Remove(name string) error {
+	return os.Remove(Path(name))
+}
+
+// RemoveAll removes a path of the project and its children, see os.RemoveAll
+func RemoveAll(name string) error {
+	return os.RemoveAll(Path(name))
+}
+
+// Rename moves a path of the project, see os.Rename
+func Rename(oldpath, newpath string) error {
+	return os.Rename(Path(oldpath), Path(newpath))
+}
+
+// Chmod changes the mode of a file of the project, see os.Chmod
+func Chmod(name string, mode fs.FileMode) error {
+	return os.Chmod(Path(name), mode)
+}
+
+// Open opens a file of the project for reading, see os.Open
+func Open(name string) (*os.File, error) {
+	return os.Open(Path(name))
+}
+
+// Create creates a file of the project, see os.Create
+func Create(name string) (*os.File, error) {
+	return os.Create(Path(name))
+}
+
+// OpenFile opens a file of the project, see os.OpenFile
+func OpenFile(name string, flag int, perm fs.FileMode) (*os.File, error) {
+	return os.OpenFile(Path(name), flag, perm)
+}
+
+// Glob returns the paths of the project matching pattern, see filepath.Glob
+func Glob(pattern string) ([]string, error) {
+	resolved := Path(pattern)
+	matches, err := filepath.Glob(resolved)
+	if err != nil || resolved == pattern {
+		return matches, err
+	}
+	for i, match := range matches {
+		if rel, err := filepath.Rel(root, match); err == nil {
+			matches[i] = rel
+		}
+	}
+	return matches, nil
+}
+
+// WalkDir walks a directory tree of the project, passing fn paths in the
+// form of dir, see filepath.WalkDir
+func WalkDir(dir string, fn fs.WalkDirFunc) error {
+	resolved := Path(dir)
+	return filepath.WalkDir(resolved, func(path string, d fs.DirEntry, err error) error {
+		return fn(relative(dir, resolved, path), d, err)
+	})
+}
+
+// Walk walks a directory tree of the project, passing fn paths in the form
+// of dir, see filepath.Walk
+func Walk(dir string, fn filepath.WalkFunc) error {
+	resolved := Path(dir)
+	return filepath.Walk(resolved, func(path string, info fs.FileInfo, err error) error {
+		return fn(relative(dir, resolved, path), info, err)
+	})
+}
+
+// Command returns a command running in the project directory, see
+// exec.Command. Set its Dir with Path to run it in another directory of the
+// project.
+func Command(name string, arg ...string) *exec.Cmd {
+	cmd := exec.Command(name, arg...)
+	cmd.Dir = root
+	return cmd
+}
@@ -0,0 +1,75 @@
+package project
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPath(t *testing.T) {
+	defer SetRoot("")
+
+	SetRoot("")
+	if got := Path(".tgs/tgs.yaml"); got != ".tgs/tgs.yaml" {
+		t.Errorf("Path() without root = %s, want .tgs/tgs.yaml", got)
+	}
+
+	root := t.TempDir()
+	SetRoot(root)
+	if got, want := Path(".tgs/tgs.yaml"), filepath.Join(root, ".tgs", "tgs.yaml"); got != want {
+		t.Errorf("Path() = %s, want %s", got, want)
+	}
+	abs := filepath.Join(t.TempDir(), "file")
+	if got := Path(abs); got != abs {
+		t.Errorf("Path(%s) = %s, want it unchanged", abs, got)
+	}
+}
+
+func TestRelativePaths(t *testing.T) {
+	defer SetRoot("")
+	root := t.TempDir()
+	SetRoot(root)
+
+	if err := MkdirAll(filepath.Join(".tgs", "stacks"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"main.yaml", "web.yaml"} {
+		if err := WriteFile(filepath.Join(".tgs", "stacks", name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, ".tgs", "stacks", "main.yaml")); err != nil {
+		t.Errorf("WriteFile() didn't write below the root: %v", err)
+	}
+
+	matches, err := Glob(filepath.Join(".tgs", "stacks", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(".tgs", "stacks", "main.yaml"), filepath.Join(".tgs", "stacks", "web.yaml")}
+	if !reflect.DeepEqual(matches, want) {
+		t.Errorf("Glob() = %v, want %v", matches, want)
+	}
+
+	var walked []string
+	err = WalkDir(".tgs", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		walked = append(walked, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = append([]string{".tgs", filepath.Join(".tgs", "stacks")}, want...)
+	if !reflect.DeepEqual(walked, want) {
+		t.Errorf("WalkDir() paths = %v, want %v", walked, want)
+	}
+
+	if cmd := Command("git", "status"); cmd.Dir != root {
+		t.Errorf("Command() dir = %s, want %s", cmd.Dir, root)
+	}
+}
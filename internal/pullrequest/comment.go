@@ -0,0 +1,179 @@
+package pullrequest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Comment size limits of the providers, in bytes
+const (
+	gitHubCommentLimit = 65536
+	azureCommentLimit  = 150000
+)
+
+// gitHubPullRef matches the ref GitHub Actions checks pull requests out at
+var gitHubPullRef = regexp.MustCompile(`^refs/pull/(\d+)/`)
+
+// Current returns the repository and number of the pull request a CI run
+// builds, from the variables of GitHub Actions or Azure Pipelines. It fails
+// outside a pull request build.
+func Current() (*Remote, int, error) {
+	if repository := os.Getenv("GITHUB_REPOSITORY"); repository != "" {
+		owner, repo, ok := strings.Cut(repository, "/")
+		if !ok {
+			return nil, 0, fmt.Errorf("unrecognized GITHUB_REPOSITORY %s", repository)
+		}
+		number, err := gitHubPullNumber()
+		if err != nil {
+			return nil, 0, err
+		}
+		return &Remote{Provider: ProviderGitHub, Owner: owner, Repo: repo}, number, nil
+	}
+
+	if id := os.Getenv("SYSTEM_PULLREQUEST_PULLREQUESTID"); id != "" {
+		number, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, 0, fmt.Errorf("unrecognized SYSTEM_PULLREQUEST_PULLREQUESTID %s", id)
+		}
+		org, err := azureOrganization(os.Getenv("SYSTEM_COLLECTIONURI"))
+		if err != nil {
+			return nil, 0, err
+		}
+		return azureRemote(org, os.Getenv("SYSTEM_TEAMPROJECT"), os.Getenv("BUILD_REPOSITORY_NAME")), number, nil
+	}
+
+	return nil, 0, fmt.Errorf("not running in a pull request build of GitHub Actions or Azure Pipelines")
+}
+
+// gitHubPullNumber returns the number of the pull request of a GitHub
+// Actions run from GITHUB_REF, or the event payload for pull_request_target
+// runs, which check out the base branch
+func gitHubPullNumber() (int, error) {
+	if match := gitHubPullRef.FindStringSubmatch(os.Getenv("GITHUB_REF")); match != nil {
+		return strconv.Atoi(match[1])
+	}
+	if path := os.Getenv("GITHUB_EVENT_PATH"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read GitHub event: %w", err)
+		}
+		var event struct {
+			PullRequest struct {
+				Number int `json:"number"`
+			} `json:"pull_request"`
+		}
+		if err := json.Unmarshal(data, &event); err != nil {
+			return 0, fmt.Errorf("failed to parse GitHub event: %w", err)
+		}
+		if event.PullRequest.Number > 0 {
+			return event.PullRequest.Number, nil
+		}
+	}
+	return 0, fmt.Errorf("GitHub Actions run isn't building a pull request")
+}
+
+// azureOrganization returns the organization of an Azure DevOps collection
+// URI, https://dev.azure.com/{org}/ or https://{org}.visualstudio.com/
+func azureOrganization(collectionURI string) (string, error) {
+	parsed, err := url.Parse(collectionURI)
+	if err == nil {
+		if org, ok := strings.CutSuffix(parsed.Hostname(), ".visualstudio.com"); ok {
+			return org, nil
+		}
+		if org := strings.Trim(parsed.Path, "/"); parsed.Hostname() == "dev.azure.com" && org != "" {
+			return org, nil
+		}
+	}
+	return "", fmt.Errorf("unrecognized SYSTEM_COLLECTIONURI %s", collectionURI)
+}
+
+// Comment posts body as a comment on pull request number of remote. A
+// comment already containing marker, e.g. an HTML comment, is updated
+// instead, so reruns don't add comments. It reports whether a comment was
+// updated.
+func Comment(remote *Remote, number int, marker, body string) (bool, error) {
+	auth, err := authorization(remote.Provider, "comment on a pull request")
+	if err != nil {
+		return false, err
+	}
+	switch remote.Provider {
+	case ProviderGitHub:
+		return commentGitHub(remote, number, marker, truncate(body, gitHubCommentLimit), auth)
+	case ProviderAzureDevOps:
+		return commentAzureDevOps(remote, number, marker, truncate(body, azureCommentLimit), auth)
+	}
+	return false, fmt.Errorf("unsupported pull request provider: %s", remote.Provider)
+}
+
+func commentGitHub(remote *Remote, number int, marker, body, auth string) (bool, error) {
+	api := gitHubRepoAPI(remote)
+	request := map[string]string{"body": body}
+
+	for page := 1; ; page++ {
+		var comments []struct {
+			ID   int64  `json:"id"`
+			Body string `json:"body"`
+		}
+		if err := send(http.MethodGet, fmt.Sprintf("%s/issues/%d/comments?per_page=100&page=%d", api, number, page), auth, nil, &comments); err != nil {
+			return false, err
+		}
+		for _, comment := range comments {
+			if strings.Contains(comment.Body, marker) {
+				return true, send(http.MethodPatch, fmt.Sprintf("%s/issues/comments/%d", api, comment.ID), auth, request, &struct{}{})
+			}
+		}
+		if len(comments) < 100 {
+			break
+		}
+	}
+	return false, send(http.MethodPost, fmt.Sprintf("%s/issues/%d/comments", api, number), auth, request, &struct{}{})
+}
+
+func commentAzureDevOps(remote *Remote, number int, marker, body, auth string) (bool, error) {
+	threadsURL := fmt.Sprintf("%s/pullRequests/%d/threads", azureRepoAPI(remote), number)
+
+	var threads struct {
+		Value []struct {
+			ID       int `json:"id"`
+			Comments []struct {
+				ID      int    `json:"id"`
+				Content string `json:"content"`
+			} `json:"comments"`
+		} `json:"value"`
+	}
+	if err := send(http.MethodGet, threadsURL+"?api-version=7.1", auth, nil, &threads); err != nil {
+		return false, err
+	}
+	for _, thread := range threads.Value {
+		if len(thread.Comments) > 0 && strings.Contains(thread.Comments[0].Content, marker) {
+			endpoint := fmt.Sprintf("%s/%d/comments/%d?api-version=7.1", threadsURL, thread.ID, thread.Comments[0].ID)
+			return true, send(http.MethodPatch, endpoint, auth, map[string]string{"content": body}, &struct{}{})
+		}
+	}
+
+	// Threads without a status don't count as active comments to resolve
+	request := map[string]interface{}{
+		"comments": []map[string]interface{}{{"parentCommentId": 0, "content": body, "commentType": 1}},
+	}
+	return false, send(http.MethodPost, threadsURL+"?api-version=7.1", auth, request, &struct{}{})
+}
+
+// truncate shortens body to limit bytes, noting that it was cut
+func truncate(body string, limit int) string {
+	const note = "\n\n_Truncated, run tgs plan for the complete output._\n"
+	if len(body) <= limit {
+		return body
+	}
+	cut := body[:limit-len(note)]
+	// Don't split a line, or a UTF-8 sequence within it
+	if i := strings.LastIndex(cut, "\n"); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + note
+}
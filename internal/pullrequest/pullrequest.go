@@ -0,0 +1,235 @@
+// Package pullrequest opens pull requests on GitHub and Azure DevOps for the
+// git remote of a project and comments on them
+package pullrequest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Providers of git remotes
+const (
+	ProviderGitHub      = "github"
+	ProviderAzureDevOps = "azuredevops"
+)
+
+// azureDescriptionLimit is the longest description Azure DevOps accepts
+const azureDescriptionLimit = 4000
+
+var (
+	// gitHubURL and azureDevOpsURL are the APIs pull requests are opened with
+	gitHubURL      = "https://api.github.com"
+	azureDevOpsURL = "https://dev.azure.com"
+
+	// httpClient is used for all API requests
+	httpClient = &http.Client{Timeout: 30 * time.Second}
+)
+
+// Remote is a repository on GitHub or Azure DevOps. Owner is the GitHub
+// owner or the Azure DevOps organization; Project is only set for Azure
+// DevOps.
+type Remote struct {
+	Provider string
+	Owner    string
+	Project  string
+	Repo     string
+}
+
+// PullRequest is a pull request to open from the Head branch into Base
+type PullRequest struct {
+	Title string
+	Body  string
+	Head  string
+	Base  string
+}
+
+// ParseRemote parses the URL of a git remote, e.g. the output of git remote
+// get-url origin. HTTPS and SSH URLs of github.com, dev.azure.com and
+// visualstudio.com are recognized.
+func ParseRemote(remote string) (*Remote, error) {
+	remote = strings.TrimSuffix(strings.TrimSpace(remote), "/")
+
+	// git@host:path is shorthand for ssh://git@host/path
+	var host, path string
+	if at := strings.Index(remote, "@"); at >= 0 && !strings.Contains(remote, "://") {
+		hostPath := remote[at+1:]
+		colon := strings.Index(hostPath, ":")
+		if colon < 0 {
+			return nil, fmt.Errorf("unrecognized git remote %s", remote)
+		}
+		host, path = hostPath[:colon], hostPath[colon+1:]
+	} else {
+		parsed, err := url.Parse(remote)
+		if err != nil || parsed.Host == "" {
+			return nil, fmt.Errorf("unrecognized git remote %s", remote)
+		}
+		host, path = parsed.Hostname(), parsed.Path
+	}
+	parts := strings.Split(strings.Trim(strings.TrimSuffix(path, ".git"), "/"), "/")
+
+	switch {
+	case host == "github.com" && len(parts) == 2:
+		return &Remote{Provider: ProviderGitHub, Owner: parts[0], Repo: parts[1]}, nil
+	case host == "ssh.dev.azure.com" && len(parts) == 4 && parts[0] == "v3":
+		// git@ssh.dev.azure.com:v3/{org}/{project}/{repo}
+		return azureRemote(parts[1], parts[2], parts[3]), nil
+	case host == "dev.azure.com" && len(parts) == 4 && parts[2] == "_git":
+		// https://{org}@dev.azure.com/{org}/{project}/_git/{repo}
+		return azureRemote(parts[0], parts[1], parts[3]), nil
+	case strings.HasSuffix(host, ".visualstudio.com") && len(parts) >= 3 && parts[len(parts)-2] == "_git":
+		// https://{org}.visualstudio.com/[DefaultCollection/]{project}/_git/{repo}
+		org := strings.TrimSuffix(strings.TrimPrefix(host, "vs-ssh."), ".visualstudio.com")
+		return azureRemote(org, parts[len(parts)-3], parts[len(parts)-1]), nil
+	}
+	return nil, fmt.Errorf("git remote %s is neither a GitHub nor an Azure DevOps repository", remote)
+}
+
+func azureRemote(org, project, repo string) *Remote {
+	project, _ = url.PathUnescape(project)
+	repo, _ = url.PathUnescape(repo)
+	return &Remote{Provider: ProviderAzureDevOps, Owner: org, Project: project, Repo: repo}
+}
+
+// Open opens a pull request on remote and returns its web URL. GitHub is
+// authenticated with GITHUB_TOKEN or GH_TOKEN, Azure DevOps with
+// AZURE_DEVOPS_EXT_PAT or the SYSTEM_ACCESSTOKEN of a pipeline.
+func Open(remote *Remote, pr PullRequest) (string, error) {
+	switch remote.Provider {
+	case ProviderGitHub:
+		return openGitHub(remote, pr)
+	case ProviderAzureDevOps:
+		return openAzureDevOps(remote, pr)
+	}
+	return "", fmt.Errorf("unsupported pull request provider: %s", remote.Provider)
+}
+
+func openGitHub(remote *Remote, pr PullRequest) (string, error) {
+	auth, err := authorization(remote.Provider, "open a pull request")
+	if err != nil {
+		return "", err
+	}
+	request := map[string]string{"title": pr.Title, "body": pr.Body, "head": pr.Head, "base": pr.Base}
+	var response struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if err := send(http.MethodPost, gitHubRepoAPI(remote)+"/pulls", auth, request, &response); err != nil {
+		return "", err
+	}
+	return response.HTMLURL, nil
+}
+
+func openAzureDevOps(remote *Remote, pr PullRequest) (string, error) {
+	auth, err := authorization(remote.Provider, "open a pull request")
+	if err != nil {
+		return "", err
+	}
+
+	description := pr.Body
+	if len(description) > azureDescriptionLimit {
+		description = description[:azureDescriptionLimit-4] + "\n..."
+	}
+	request := map[string]string{
+		"title":         pr.Title,
+		"description":   description,
+		"sourceRefName": "refs/heads/" + pr.Head,
+		"targetRefName": "refs/heads/" + pr.Base,
+	}
+	var response struct {
+		PullRequestID int `json:"pullRequestId"`
+	}
+	if err := send(http.MethodPost, azureRepoAPI(remote)+"/pullrequests?api-version=7.1", auth, request, &response); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%s/%s/_git/%s/pullrequest/%d", azureDevOpsURL, url.PathEscape(remote.Owner), url.PathEscape(remote.Project), url.PathEscape(remote.Repo), response.PullRequestID), nil
+}
+
+// authorization returns the Authorization header of the provider from the
+// environment, failing with what it was needed for when no token is set
+func authorization(provider, purpose string) (string, error) {
+	switch provider {
+	case ProviderGitHub:
+		if token := firstEnv("GITHUB_TOKEN", "GH_TOKEN"); token != "" {
+			return "Bearer " + token, nil
+		}
+		return "", fmt.Errorf("GITHUB_TOKEN or GH_TOKEN must be set to %s", purpose)
+	case ProviderAzureDevOps:
+		if pat := os.Getenv("AZURE_DEVOPS_EXT_PAT"); pat != "" {
+			return "Basic " + base64.StdEncoding.EncodeToString([]byte(":"+pat)), nil
+		}
+		if token := os.Getenv("SYSTEM_ACCESSTOKEN"); token != "" {
+			return "Bearer " + token, nil
+		}
+		return "", fmt.Errorf("AZURE_DEVOPS_EXT_PAT or SYSTEM_ACCESSTOKEN must be set to %s", purpose)
+	}
+	return "", fmt.Errorf("unsupported pull request provider: %s", provider)
+}
+
+// gitHubRepoAPI returns the API URL of a GitHub repository, on the server
+// of GITHUB_API_URL when set
+func gitHubRepoAPI(remote *Remote) string {
+	base := gitHubURL
+	if env := os.Getenv("GITHUB_API_URL"); env != "" {
+		base = env
+	}
+	return fmt.Sprintf("%s/repos/%s/%s", strings.TrimSuffix(base, "/"), remote.Owner, remote.Repo)
+}
+
+// azureRepoAPI returns the API URL of an Azure DevOps repository
+func azureRepoAPI(remote *Remote) string {
+	return fmt.Sprintf("%s/%s/%s/_apis/git/repositories/%s", azureDevOpsURL, url.PathEscape(remote.Owner), url.PathEscape(remote.Project), url.PathEscape(remote.Repo))
+}
+
+// send sends request, if any, as JSON to endpoint and decodes the response
+// into response
+func send(method, endpoint, auth string, request, response interface{}) error {
+	var body io.Reader
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s: %s", endpoint, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if err := json.Unmarshal(data, response); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
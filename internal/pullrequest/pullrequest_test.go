@@ -0,0 +1,109 @@
+package pullrequest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseRemote(t *testing.T) {
+	tests := []struct {
+		remote string
+		want   Remote
+	}{
+		{"https://github.com/contoso/infra.git", Remote{Provider: ProviderGitHub, Owner: "contoso", Repo: "infra"}},
+		{"git@github.com:contoso/infra.git", Remote{Provider: ProviderGitHub, Owner: "contoso", Repo: "infra"}},
+		{"https://contoso@dev.azure.com/contoso/Platform%20Team/_git/infra", Remote{Provider: ProviderAzureDevOps, Owner: "contoso", Project: "Platform Team", Repo: "infra"}},
+		{"git@ssh.dev.azure.com:v3/contoso/platform/infra", Remote{Provider: ProviderAzureDevOps, Owner: "contoso", Project: "platform", Repo: "infra"}},
+		{"https://contoso.visualstudio.com/DefaultCollection/platform/_git/infra", Remote{Provider: ProviderAzureDevOps, Owner: "contoso", Project: "platform", Repo: "infra"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseRemote(tt.remote)
+		if err != nil {
+			t.Errorf("ParseRemote(%s) unexpected error: %v", tt.remote, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("ParseRemote(%s) = %+v, want %+v", tt.remote, *got, tt.want)
+		}
+	}
+
+	if _, err := ParseRemote("https://gitlab.com/contoso/infra.git"); err == nil {
+		t.Error("Expected an error for a GitLab remote")
+	}
+}
+
+func TestOpenGitHub(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]string
+		json.NewDecoder(r.Body).Decode(&request)
+		if r.URL.Path != "/repos/contoso/infra/pulls" || r.Header.Get("Authorization") != "Bearer token" || request["head"] != "tgs/generate" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"html_url":"https://github.com/contoso/infra/pull/7"}`))
+	}))
+	defer server.Close()
+	t.Setenv("GITHUB_API_URL", server.URL)
+	t.Setenv("GITHUB_TOKEN", "token")
+
+	remote := &Remote{Provider: ProviderGitHub, Owner: "contoso", Repo: "infra"}
+	got, err := Open(remote, PullRequest{Title: "Regenerate", Head: "tgs/generate", Base: "main"})
+	if err != nil {
+		t.Fatalf("Open() unexpected error: %v", err)
+	}
+	if got != "https://github.com/contoso/infra/pull/7" {
+		t.Errorf("Open() = %s", got)
+	}
+}
+
+func TestCurrent(t *testing.T) {
+	t.Setenv("GITHUB_REPOSITORY", "")
+	t.Setenv("SYSTEM_PULLREQUEST_PULLREQUESTID", "42")
+	t.Setenv("SYSTEM_COLLECTIONURI", "https://contoso.visualstudio.com/")
+	t.Setenv("SYSTEM_TEAMPROJECT", "platform")
+	t.Setenv("BUILD_REPOSITORY_NAME", "infra")
+
+	remote, number, err := Current()
+	if err != nil {
+		t.Fatalf("Current() unexpected error: %v", err)
+	}
+	if want := (Remote{Provider: ProviderAzureDevOps, Owner: "contoso", Project: "platform", Repo: "infra"}); *remote != want || number != 42 {
+		t.Errorf("Current() = %+v, %d, want %+v, 42", *remote, number, want)
+	}
+
+	t.Setenv("GITHUB_REPOSITORY", "contoso/infra")
+	t.Setenv("GITHUB_REF", "refs/pull/7/merge")
+	if remote, number, err := Current(); err != nil || remote.Provider != ProviderGitHub || number != 7 {
+		t.Errorf("Current() = %+v, %d, %v, want the GitHub pull request 7", remote, number, err)
+	}
+}
+
+func TestCommentUpdatesExisting(t *testing.T) {
+	var patched string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/contoso/infra/issues/7/comments":
+			w.Write([]byte(`[{"id":1,"body":"LGTM"},{"id":2,"body":"<!-- tgs-plan -->\nold"}]`))
+		case r.Method == http.MethodPatch:
+			patched = r.URL.Path
+			w.Write([]byte(`{}`))
+		default:
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("GITHUB_API_URL", server.URL)
+	t.Setenv("GITHUB_TOKEN", "token")
+
+	remote := &Remote{Provider: ProviderGitHub, Owner: "contoso", Repo: "infra"}
+	updated, err := Comment(remote, 7, "<!-- tgs-plan -->", "<!-- tgs-plan -->\nnew")
+	if err != nil {
+		t.Fatalf("Comment() unexpected error: %v", err)
+	}
+	if !updated || patched != "/repos/contoso/infra/issues/comments/2" {
+		t.Errorf("Comment() updated = %v, patched %q, want comment 2 updated", updated, patched)
+	}
+}
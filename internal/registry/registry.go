@@ -0,0 +1,163 @@
+// Package registry looks up provider versions in the Terraform Registry,
+// caching responses under .tgs/cache/registry
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+)
+
+const (
+	// CacheDir is where registry responses are cached
+	CacheDir = ".tgs/cache/registry"
+
+	// cacheTTL is how long cached versions are used before refreshing
+	cacheTTL = 24 * time.Hour
+)
+
+var (
+	// baseURL is the registry API used for lookups
+	baseURL = "https://registry.terraform.io"
+
+	// httpClient is used for all registry requests
+	httpClient = &http.Client{Timeout: 15 * time.Second}
+)
+
+// ErrNotCached is returned in offline mode when a provider has no cached versions
+var ErrNotCached = fmt.Errorf("provider versions not cached")
+
+// NotFoundError is returned when the registry doesn't publish a provider
+type NotFoundError struct {
+	Namespace string
+	Name      string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("provider %s/%s not found in registry", e.Namespace, e.Name)
+}
+
+// cacheEntry is the on-disk format of cached provider versions
+type cacheEntry struct {
+	FetchedAt time.Time `json:"fetched_at"`
+	Versions  []string  `json:"versions"`
+}
+
+// ProviderAddress splits a provider into namespace and name, defaulting to
+// the hashicorp namespace (e.g. "azurerm" is hashicorp/azurerm)
+func ProviderAddress(provider string) (string, string) {
+	if parts := strings.SplitN(provider, "/", 2); len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return "hashicorp", provider
+}
+
+// Versions returns the published versions of a provider. Fresh cached
+// versions are used when available; in offline mode the cache is used
+// regardless of age and the registry is never contacted.
+func Versions(provider string, offline bool) ([]string, error) {
+	return versionsIn(CacheDir, provider, offline)
+}
+
+func versionsIn(cacheDir, provider string, offline bool) ([]string, error) {
+	namespace, name := ProviderAddress(provider)
+	cachePath := filepath.Join(cacheDir, fmt.Sprintf("%s-%s.json", namespace, name))
+
+	cached, cacheErr := readCache(cachePath)
+	if cacheErr == nil && (offline || time.Since(cached.FetchedAt) < cacheTTL) {
+		return cached.Versions, nil
+	}
+	if offline {
+		return nil, ErrNotCached
+	}
+
+	versions, err := fetchVersions(namespace, name)
+	if err != nil {
+		// Fall back to stale cached versions if the registry is unreachable
+		var notFound *NotFoundError
+		if cacheErr == nil && !errors.As(err, &notFound) {
+			return cached.Versions, nil
+		}
+		return nil, err
+	}
+
+	if err := writeCache(cachePath, cacheEntry{FetchedAt: time.Now(), Versions: versions}); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// fetchVersions queries the registry provider versions API
+func fetchVersions(namespace, name string) ([]string, error) {
+	url := fmt.Sprintf("%s/v1/providers/%s/%s/versions", baseURL, namespace, name)
+
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query registry for %s/%s: %w", namespace, name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, &NotFoundError{Namespace: namespace, Name: name}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to query registry for %s/%s: %s", namespace, name, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry response: %w", err)
+	}
+
+	var body struct {
+		Versions []struct {
+			Version string `json:"version"`
+		} `json:"versions"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("failed to parse registry response: %w", err)
+	}
+
+	versions := make([]string, 0, len(body.Versions))
+	for _, v := range body.Versions {
+		versions = append(versions, v.Version)
+	}
+	return versions, nil
+}
+
+func readCache(path string) (*cacheEntry, error) {
+	data, err := project.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse registry cache: %w", err)
+	}
+	return &entry, nil
+}
+
+func writeCache(path string, entry cacheEntry) error {
+	if err := project.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create registry cache directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal registry cache: %w", err)
+	}
+
+	if err := project.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write registry cache: %w", err)
+	}
+	return nil
+}
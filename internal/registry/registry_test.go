@@ -0,0 +1,69 @@
+package registry
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// newTestRegistry serves a versions response for hashicorp/azurerm and counts requests
+func newTestRegistry(t *testing.T, requests *int) {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		if r.URL.Path != "/v1/providers/hashicorp/azurerm/versions" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"versions":[{"version":"4.21.0"},{"version":"4.22.0"}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	oldURL := baseURL
+	baseURL = server.URL
+	t.Cleanup(func() { baseURL = oldURL })
+}
+
+func TestVersions(t *testing.T) {
+	var requests int
+	newTestRegistry(t, &requests)
+	cacheDir := t.TempDir()
+
+	// Offline lookups fail until the provider has been cached
+	if _, err := versionsIn(cacheDir, "azurerm", true); err != ErrNotCached {
+		t.Fatalf("Expected ErrNotCached offline, got %v", err)
+	}
+
+	want := []string{"4.21.0", "4.22.0"}
+	versions, err := versionsIn(cacheDir, "azurerm", false)
+	if err != nil {
+		t.Fatalf("Failed to fetch versions: %v", err)
+	}
+	if !reflect.DeepEqual(versions, want) {
+		t.Errorf("Expected %v, got %v", want, versions)
+	}
+
+	// Cached versions are used without contacting the registry
+	for _, offline := range []bool{false, true} {
+		versions, err = versionsIn(cacheDir, "hashicorp/azurerm", offline)
+		if err != nil {
+			t.Fatalf("Failed to read cached versions (offline=%v): %v", offline, err)
+		}
+		if !reflect.DeepEqual(versions, want) {
+			t.Errorf("Expected cached %v, got %v", want, versions)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("Expected 1 registry request, got %d", requests)
+	}
+
+	var notFound *NotFoundError
+	if _, err := versionsIn(cacheDir, "example/missing", false); !errors.As(err, &notFound) {
+		t.Errorf("Expected a NotFoundError for an unknown provider, got %v", err)
+	} else if notFound.Namespace != "example" || notFound.Name != "missing" {
+		t.Errorf("NotFoundError = %s/%s, want example/missing", notFound.Namespace, notFound.Name)
+	}
+}
@@ -0,0 +1,293 @@
+package scaffold
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/catalog"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/validate"
+	"gopkg.in/yaml.v3"
+)
+
+// ComponentSpec describes a component added to a stack
+type ComponentSpec struct {
+	Name        string
+	Source      string
+	Provider    string
+	Version     string
+	Description string
+	Deps        []string
+	// Regions the component is deployed to, each with Apps
+	Regions []string
+	Apps    []string
+}
+
+// AddComponent appends a component to a stack file and places it in the
+// architecture of the given regions. The resource type is checked against
+// the provider schema and the resulting stack is validated before it's
+// written.
+func AddComponent(stackName string, spec ComponentSpec) error {
+	mainConfig, err := ReadMainConfig(stackName)
+	if err != nil {
+		return fmt.Errorf("failed to read stack config %s: %w", stackName, err)
+	}
+	if _, ok := mainConfig.Stack.Components[spec.Name]; ok {
+		return fmt.Errorf("component %s is already defined in stack %s", spec.Name, stackName)
+	}
+
+	if spec.Provider == "" {
+		spec.Provider = "azurerm"
+	}
+	if spec.Version == "" {
+		spec.Version = stackProviderVersion(mainConfig, spec.Provider)
+		if spec.Version == "" {
+			return fmt.Errorf("no version of provider %s used in stack %s, set one with --version", spec.Provider, stackName)
+		}
+	}
+
+	if spec.Provider == "azurerm" {
+		if err := checkResourceType(spec.Provider, spec.Version, spec.Source); err != nil {
+			return err
+		}
+	}
+
+	component := config.Component{
+		Source:      spec.Source,
+		Provider:    spec.Provider,
+		Version:     spec.Version,
+		Description: spec.Description,
+		Deps:        spec.Deps,
+	}
+	return addComponents(stackName, mainConfig, []stackAddition{
+		{Name: spec.Name, Component: &component, Regions: spec.Regions, Apps: spec.Apps},
+	})
+}
+
+// stackAddition is a component added to a stack and the regions it's
+// placed in. A nil Component only adds placements of an existing component.
+type stackAddition struct {
+	Name      string
+	Component *config.Component
+	Regions   []string
+	Apps      []string
+}
+
+// addComponents validates the stack with the additions and writes them to
+// the stack file
+func addComponents(stackName string, mainConfig *config.MainConfig, additions []stackAddition) error {
+	// Validate the stack as it will be written
+	if mainConfig.Stack.Components == nil {
+		mainConfig.Stack.Components = make(map[string]config.Component)
+	}
+	if mainConfig.Stack.Architecture.Regions == nil {
+		mainConfig.Stack.Architecture.Regions = make(map[string][]config.RegionComponent)
+	}
+	for _, addition := range additions {
+		if addition.Component != nil {
+			mainConfig.Stack.Components[addition.Name] = *addition.Component
+		}
+		for _, region := range addition.Regions {
+			mainConfig.Stack.Architecture.Regions[region] = append(mainConfig.Stack.Architecture.Regions[region], config.RegionComponent{Component: addition.Name, Apps: addition.Apps})
+		}
+	}
+	findings := validate.ValidateStack(mainConfig)
+	if tgsConfig, err := config.ReadTGSConfig(); err == nil {
+		findings = append(findings, validate.ValidateStackRegions(tgsConfig, stackName, mainConfig)...)
+	}
+	for _, warning := range validate.Warnings(findings) {
+		logger.Warning("%v", warning)
+	}
+	if errors := validate.Errors(findings); len(errors) > 0 {
+		return fmt.Errorf("stack '%s' validation failed: %v", stackName, errors[0])
+	}
+
+	stackPath := filepath.Join(".tgs", "stacks", fmt.Sprintf("%s.yaml", stackName))
+	data, err := project.ReadFile(stackPath)
+	if err != nil {
+		return fmt.Errorf("failed to read stack config: %w", err)
+	}
+	updated, err := addToStack(data, additions)
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", stackPath, err)
+	}
+	if err := project.WriteFile(stackPath, updated, 0644); err != nil {
+		return fmt.Errorf("failed to write stack config: %w", err)
+	}
+
+	for _, addition := range additions {
+		if addition.Component != nil {
+			logger.Success("Added component %s to %s", addition.Name, stackPath)
+		}
+	}
+	return nil
+}
+
+// stackProviderVersion returns the version of a provider most components of
+// the stack use, so added components match their neighbours
+func stackProviderVersion(mainConfig *config.MainConfig, provider string) string {
+	counts := make(map[string]int)
+	for _, comp := range mainConfig.Stack.Components {
+		if comp.Provider == provider && comp.Version != "" {
+			counts[comp.Version]++
+		}
+	}
+
+	var best string
+	for version, count := range counts {
+		if count > counts[best] || (count == counts[best] && config.CompareVersions(version, best) > 0) {
+			best = version
+		}
+	}
+	return best
+}
+
+// checkResourceType fails when the provider schema doesn't define the
+// resource type. A schema that can't be fetched only produces a warning.
+func checkResourceType(provider, version, resourceType string) error {
+	schema, err := fetchProviderSchema(provider, version, resourceType)
+	defer cleanupSchemaCache()
+	if err != nil || schema == nil {
+		logger.Warning("Could not verify resource type %s: %v", resourceType, err)
+		return nil
+	}
+
+	for _, p := range schema.ProviderSchema {
+		if _, ok := p.ResourceSchemas[resourceType]; ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("resource type %s is not defined by provider %s %s", resourceType, provider, version)
+}
+
+// addToStack appends components and their placements to a stack file,
+// keeping its comments and layout
+func addToStack(data []byte, additions []stackAddition) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse stack config: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, fmt.Errorf("stack config is empty")
+	}
+
+	stack := mappingValue(doc.Content[0], "stack")
+	if stack == nil {
+		return nil, fmt.Errorf("stack config has no stack")
+	}
+
+	for _, addition := range additions {
+		if addition.Component != nil {
+			var value yaml.Node
+			if err := value.Encode(addition.Component); err != nil {
+				return nil, fmt.Errorf("failed to encode component: %w", err)
+			}
+			if deps := mappingValue(&value, "deps"); deps != nil {
+				// Quote dependencies like the stack templates do
+				for _, dep := range deps.Content {
+					dep.Style = yaml.DoubleQuotedStyle
+				}
+			}
+			components := ensureMapping(stack, "components")
+			components.Content = append(components.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: addition.Name}, &value)
+		}
+
+		regionsNode := ensureMapping(ensureMapping(stack, "architecture"), "regions")
+		regions := append([]string{}, addition.Regions...)
+		sort.Strings(regions)
+		for _, region := range regions {
+			placement := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Value: "component"},
+				{Kind: yaml.ScalarNode, Value: addition.Name},
+			}}
+			if len(addition.Apps) > 0 {
+				appsNode := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+				for _, app := range addition.Apps {
+					appsNode.Content = append(appsNode.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: app})
+				}
+				placement.Content = append(placement.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "apps"}, appsNode)
+			}
+
+			placements := mappingValue(regionsNode, region)
+			if placements == nil {
+				placements = &yaml.Node{Kind: yaml.SequenceNode}
+				regionsNode.Content = append(regionsNode.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: region}, placements)
+			}
+			placements.Content = append(placements.Content, placement)
+		}
+	}
+
+	return encodeStack(&doc)
+}
+
+// ensureMapping returns the mapping value of key in a YAML mapping node,
+// adding an empty one when it's missing
+func ensureMapping(node *yaml.Node, key string) *yaml.Node {
+	if value := mappingValue(node, key); value != nil {
+		if value.Kind != yaml.MappingNode {
+			// Replace null values such as "components:" with an empty mapping
+			*value = yaml.Node{Kind: yaml.MappingNode}
+		}
+		return value
+	}
+
+	value := &yaml.Node{Kind: yaml.MappingNode}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+	return value
+}
+
+// AddCatalogEntry adds the components of a catalog entry to a stack and
+// places them in the given regions. Components the stack already defines
+// with the same resource type are reused; the entry's apps get the app
+// instances.
+func AddCatalogEntry(stackName string, entry *catalog.Entry, regions, apps []string) error {
+	mainConfig, err := ReadMainConfig(stackName)
+	if err != nil {
+		return fmt.Errorf("failed to read stack config %s: %w", stackName, err)
+	}
+
+	appComponents := make(map[string]bool)
+	for _, name := range entry.Apps {
+		appComponents[name] = true
+	}
+
+	var additions []stackAddition
+	for _, name := range entry.ComponentNames() {
+		component := entry.Components[name]
+		addition := stackAddition{Name: name}
+		if appComponents[name] {
+			addition.Apps = apps
+		}
+
+		if existing, ok := mainConfig.Stack.Components[name]; ok {
+			if existing.Source != component.Source {
+				return fmt.Errorf("stack %s already defines component %s as %s", stackName, name, existing.Source)
+			}
+			logger.Info("Reusing component %s of stack %s", name, stackName)
+		} else {
+			// Keep the provider version the stack already uses
+			if version := stackProviderVersion(mainConfig, component.Provider); version != "" {
+				component.Version = version
+			}
+			addition.Component = &component
+		}
+
+		// Only place components in regions they aren't deployed to yet
+		for _, region := range regions {
+			placed := false
+			for _, rc := range mainConfig.Stack.Architecture.Regions[region] {
+				placed = placed || rc.Component == name
+			}
+			if !placed {
+				addition.Regions = append(addition.Regions, region)
+			}
+		}
+
+		additions = append(additions, addition)
+	}
+
+	return addComponents(stackName, mainConfig, additions)
+}
@@ -0,0 +1,130 @@
+package scaffold
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/lock"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+)
+
+// Apply reconciles the generated .infrastructure tree with the configuration.
+// The planned changes are printed and passed to confirm, which must return
+// true for them to be applied.
+func Apply(confirm func([]Change) (bool, error)) error {
+	release, err := lock.Acquire("apply")
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	start := time.Now()
+	logger.Info("Analyzing infrastructure changes...")
+
+	renderedPath, err := renderTree(PlanFormatText)
+	if err != nil {
+		return err
+	}
+	defer project.RemoveAll(renderedPath)
+
+	changes, err := computeChanges(renderedPath)
+	if err != nil {
+		return err
+	}
+
+	printPlan(changes)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	approved, err := confirm(changes)
+	if err != nil {
+		return err
+	}
+	if !approved {
+		logger.Warning("Apply cancelled, no changes were made")
+		return nil
+	}
+
+	tgsConfig, err := config.ReadTGSConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read TGS config: %w", err)
+	}
+	infraPath := getInfrastructurePath()
+	if err := runHooks("pre_generate", tgsConfig.Hooks.PreGenerate, infraPath); err != nil {
+		return err
+	}
+
+	// Move folders of bumped stacks so they're updated rather than recreated
+	if err := migrate(infraPath); err != nil {
+		return fmt.Errorf("failed to migrate infrastructure: %w", err)
+	}
+
+	output.ResetSummary()
+	if err := applyChanges(renderedPath, infraPath, changes); err != nil {
+		return err
+	}
+
+	summary := summarize(changes)
+	logger.Success("Apply complete: %d added, %d removed, %d modified", summary.Add, summary.Remove, summary.Modify)
+
+	// Write the files outside the tree and the manifest like generate does
+	return finishGeneration(tgsConfig, infraPath, start)
+}
+
+// applyChanges deletes removed paths and then syncs every rendered file that
+// differs from disk into infraPath
+func applyChanges(renderedPath, infraPath string, changes []Change) error {
+	for _, change := range changes {
+		if change.Type != "remove" || change.Path == "" {
+			continue
+		}
+
+		target := filepath.Join(infraPath, filepath.FromSlash(change.Path))
+		if err := project.RemoveAll(target); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", change.Path, err)
+		}
+		logger.Info("Removed %s", change.Path)
+	}
+
+	return project.WalkDir(renderedPath, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(renderedPath, path)
+		if err != nil {
+			return err
+		}
+
+		want, err := project.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read rendered %s: %w", rel, err)
+		}
+
+		target := filepath.Join(infraPath, rel)
+		if have, err := project.ReadFile(target); err == nil && string(have) == string(want) {
+			return nil
+		}
+
+		// A directory in the way of a file is replaced
+		if info, err := project.Stat(target); err == nil && info.IsDir() {
+			if err := project.RemoveAll(target); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", rel, err)
+			}
+		}
+
+		if err := createFile(target, string(want)); err != nil {
+			return fmt.Errorf("failed to write %s: %w", rel, err)
+		}
+		return nil
+	})
+}
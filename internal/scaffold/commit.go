@@ -0,0 +1,287 @@
+package scaffold
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/lock"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/pullrequest"
+)
+
+// CommitOptions configures GenerateAndCommit
+type CommitOptions struct {
+	// Branch receives the commit, tgs/generate-<timestamp> when empty
+	Branch string
+	// PullRequest pushes the branch to origin and opens a pull request into
+	// the branch generate ran on
+	PullRequest bool
+}
+
+// GenerateAndCommit generates the infrastructure and commits the files it
+// changed to a new branch, with the stack versions and the plan summary in
+// the commit message. Other changes of the working tree are left
+// uncommitted; the index must be clean so the commit holds nothing else.
+func GenerateAndCommit(opts CommitOptions) error {
+	release, err := lock.Acquire("generate")
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	toplevel, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return fmt.Errorf("generate --commit must run in a git repository: %w", err)
+	}
+	prefix, err := git("rev-parse", "--show-prefix")
+	if err != nil {
+		return err
+	}
+	if _, err := git("diff", "--cached", "--quiet"); err != nil {
+		return fmt.Errorf("the index has staged changes, commit or unstage them before generate --commit")
+	}
+	base, err := git("rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return err
+	}
+
+	renderedPath, err := renderTree(PlanFormatText)
+	if err != nil {
+		return err
+	}
+	defer project.RemoveAll(renderedPath)
+	changes, err := computeChanges(renderedPath)
+	if err != nil {
+		return err
+	}
+
+	if err := Generate(); err != nil {
+		return err
+	}
+
+	paths, err := generatedChanges(toplevel, prefix)
+	if err != nil {
+		return err
+	}
+	// The manifest records every run, it alone isn't worth a commit
+	manifest := repoRelative(toplevel, prefix, filepath.Join(output.Dir(), manifestFile))
+	if len(paths) == 0 || (len(paths) == 1 && paths[0] == manifest) {
+		logger.Info("Generated tree is unchanged, nothing to commit")
+		return nil
+	}
+
+	tgsConfig, err := config.ReadTGSConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read TGS config: %w", err)
+	}
+	versions := make(map[string]string)
+	for _, stackName := range tgsConfig.UsedStacks() {
+		mainConfig, err := ReadMainConfig(stackName)
+		if err != nil {
+			return fmt.Errorf("failed to read stack config %s: %w", stackName, err)
+		}
+		versions[stackName] = mainConfig.Stack.Version
+	}
+	subject, body := commitMessage(versions, changes)
+
+	branch := opts.Branch
+	if branch == "" {
+		branch = "tgs/generate-" + time.Now().Format("20060102-150405")
+	}
+	if branch != base {
+		if _, err := git("checkout", "-b", branch); err != nil {
+			return fmt.Errorf("failed to create branch %s: %w", branch, err)
+		}
+	}
+
+	add := project.Command("git", "--literal-pathspecs", "add", "-A", "--pathspec-from-file=-", "--pathspec-file-nul")
+	add.Dir = toplevel
+	add.Stdin = strings.NewReader(strings.Join(paths, "\x00"))
+	if out, err := add.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to stage generated files: %s", strings.TrimSpace(string(out)))
+	}
+	commit := project.Command("git", "commit", "--quiet", "-F", "-")
+	commit.Stdin = strings.NewReader(subject + "\n\n" + body)
+	if out, err := commit.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to commit generated files: %s", strings.TrimSpace(string(out)))
+	}
+	logger.Success("Committed %d generated files to %s: %s", len(paths), branch, subject)
+
+	if !opts.PullRequest {
+		return nil
+	}
+	if branch == base || base == "HEAD" {
+		return fmt.Errorf("a pull request needs a base branch other than %s, pass another --branch", branch)
+	}
+	remoteURL, err := git("remote", "get-url", "origin")
+	if err != nil {
+		return fmt.Errorf("failed to read the origin remote: %w", err)
+	}
+	remote, err := pullrequest.ParseRemote(remoteURL)
+	if err != nil {
+		return err
+	}
+	if _, err := git("push", "--quiet", "-u", "origin", branch); err != nil {
+		return fmt.Errorf("failed to push %s: %w", branch, err)
+	}
+	url, err := pullrequest.Open(remote, pullrequest.PullRequest{
+		Title: subject,
+		Body:  pullRequestBody(versions, changes),
+		Head:  branch,
+		Base:  base,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open pull request: %w", err)
+	}
+	logger.Success("Opened pull request %s", url)
+	return nil
+}
+
+// generatedChanges returns the files generate wrote that differ from HEAD,
+// and the deleted files of the output directory, relative to the root of
+// the repository
+func generatedChanges(toplevel, prefix string) ([]string, error) {
+	// Entries start with their status, which may be a space
+	status, err := project.Command("git", "status", "--porcelain", "-z", "--untracked-files=all").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read git status: %w", err)
+	}
+	dirty := make(map[string]bool)
+	var deleted []string
+	entries := strings.Split(string(status), "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		dirty[entry[3:]] = true
+		if entry[1] == 'D' {
+			deleted = append(deleted, entry[3:])
+		}
+		// Renames and copies are followed by their source
+		if entry[0] == 'R' || entry[0] == 'C' {
+			i++
+		}
+	}
+
+	seen := make(map[string]bool)
+	var paths []string
+	add := func(p string) {
+		if dirty[p] && !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+	for _, written := range output.WrittenFiles() {
+		add(repoRelative(toplevel, prefix, written))
+	}
+	outputDir := repoRelative(toplevel, prefix, output.Dir()) + "/"
+	for _, p := range deleted {
+		if strings.HasPrefix(p, outputDir) {
+			add(p)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// repoRelative returns p, relative to the working directory at prefix of the
+// repository or absolute, relative to the root of the repository
+func repoRelative(toplevel, prefix, p string) string {
+	if filepath.IsAbs(p) {
+		if resolved, err := filepath.EvalSymlinks(filepath.Dir(p)); err == nil {
+			p = filepath.Join(resolved, filepath.Base(p))
+		}
+		if root, err := filepath.EvalSymlinks(toplevel); err == nil {
+			toplevel = root
+		}
+		if rel, err := filepath.Rel(toplevel, p); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return path.Join(prefix, filepath.ToSlash(p))
+}
+
+// commitMessage renders the subject and body of the commit of a generate
+// run from the versions of its stacks and its planned changes
+func commitMessage(versions map[string]string, changes []Change) (string, string) {
+	summary := summarize(changes)
+	subject := fmt.Sprintf("Regenerate infrastructure: %d to add, %d to remove, %d to modify", summary.Add, summary.Remove, summary.Modify)
+
+	var b strings.Builder
+	b.WriteString("Generated by tgs generate --commit.\n\nStacks:\n")
+	for _, stackName := range sortedVersions(versions) {
+		fmt.Fprintf(&b, "  %s %s\n", stackName, stackVersion(versions[stackName]))
+	}
+
+	if len(changes) == 0 {
+		b.WriteString("\nNo planned changes, only generated file contents changed.\n")
+		return subject, b.String()
+	}
+
+	symbols := map[string]string{"add": "+", "remove": "-", "modify": "~"}
+	keys, groups := changeGroups(changes)
+	for _, key := range keys {
+		if key == "" {
+			b.WriteString("\nShared configuration:\n")
+		} else {
+			fmt.Fprintf(&b, "\n%s:\n", key)
+		}
+		for _, change := range groups[key] {
+			fmt.Fprintf(&b, "  %s %s\n", symbols[change.Type], changeLabel(change))
+		}
+	}
+	return subject, b.String()
+}
+
+// pullRequestBody renders the description of the pull request of a generate
+// run: the stack versions and the plan in Markdown
+func pullRequestBody(versions map[string]string, changes []Change) string {
+	var b strings.Builder
+	b.WriteString("Generated by `tgs generate --commit --pr`.\n\n| Stack | Version |\n|---|---|\n")
+	for _, stackName := range sortedVersions(versions) {
+		fmt.Fprintf(&b, "| %s | %s |\n", stackName, stackVersion(versions[stackName]))
+	}
+	b.WriteString("\n" + formatPlanMarkdown(changes))
+	return b.String()
+}
+
+func sortedVersions(versions map[string]string) []string {
+	var names []string
+	for name := range versions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func stackVersion(version string) string {
+	if version == "" {
+		return "(unversioned)"
+	}
+	return version
+}
+
+// git runs a git command in the working directory and returns its trimmed
+// output, or its error output in the error
+func git(args ...string) (string, error) {
+	cmd := project.Command("git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
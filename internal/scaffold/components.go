@@ -1,13 +1,22 @@
 package scaffold
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
-	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/davoodharun/terragrunt-scaffolder/internal/apim"
 	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/envconfig"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/events"
 	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/naming"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
 	"github.com/davoodharun/terragrunt-scaffolder/internal/templates"
 )
 
@@ -26,13 +35,13 @@ func generateComponents(mainConfig *config.MainConfig, infraPath string) error {
 
 	// Create components directory
 	componentsDir := filepath.Join(infraPath, "_components")
-	if err := os.MkdirAll(componentsDir, 0755); err != nil {
+	if err := project.MkdirAll(componentsDir, 0755); err != nil {
 		return fmt.Errorf("failed to create components directory: %w", err)
 	}
 
 	// Create stack-specific components directory
 	stackComponentsDir := filepath.Join(componentsDir, mainConfig.Stack.Name)
-	if err := os.MkdirAll(stackComponentsDir, 0755); err != nil {
+	if err := project.MkdirAll(stackComponentsDir, 0755); err != nil {
 		return fmt.Errorf("failed to create stack components directory: %w", err)
 	}
 
@@ -59,34 +68,84 @@ func generateComponents(mainConfig *config.MainConfig, infraPath string) error {
 			continue
 		}
 
-		// Create component directory
+		// Keep the files of components whose configuration didn't change
 		componentPath := filepath.Join(stackComponentsDir, compName)
-		if err := os.MkdirAll(componentPath, 0755); err != nil {
+		unchanged, err := fingerprints.unchanged(componentKey(mainConfig.Stack.Name, compName), filepath.Join(componentPath, "component.hcl"), componentInputs(mainConfig, compName)...)
+		if err != nil {
+			return err
+		}
+		if unchanged {
+			if shared, ok := output.SharedModule(componentPath); ok {
+				usedSharedModules[shared] = true
+			}
+			logger.UpdateProgress()
+			validatedComponents[compName] = true
+			continue
+		}
+
+		// Create component directory
+		if err := project.MkdirAll(componentPath, 0755); err != nil {
 			return fmt.Errorf("failed to create component directory: %w", err)
 		}
 
 		// Generate Terraform files
-		if err := generateTerraformFiles(componentPath, comp); err != nil {
+		if err := generateTerraformFiles(componentPath, comp, tgsConfig.GenerationModeOf(comp)); err != nil {
 			return fmt.Errorf("failed to generate terraform files: %w", err)
 		}
 
 		// Use only explicit dependencies from the stack file
 		var dependencyBlocks string
 		if len(comp.Deps) > 0 {
-			deps := generateDependencyBlocks(comp.Deps, infraPath)
+			deps := generateDependencyBlocks(comp, mainConfig.Stack.Components, infraPath, tgsConfig.Layout)
 			dependencyBlocks = deps
 		}
 
+		// Add dependencies on infrastructure managed outside this repo
+		if len(comp.ExternalDeps) > 0 {
+			externalBlocks, err := generateExternalDependencies(comp, mainConfig.Stack.ExternalDependencies, componentPath, renderer)
+			if err != nil {
+				return fmt.Errorf("failed to generate external dependencies for %s: %w", compName, err)
+			}
+			if externalBlocks != "" {
+				dependencyBlocks = strings.TrimSpace(dependencyBlocks + "\n" + externalBlocks)
+			}
+		}
+
+		// Document the module from the generated files
+		if err := generateComponentReadme(componentPath, mainConfig.Stack.Name, compName, comp); err != nil {
+			return fmt.Errorf("failed to generate README for %s: %w", compName, err)
+		}
+
+		// Move the module to the shared module of identical components
+		modulePath := mainConfig.Stack.Name + "/" + compName
+		moduleDir := componentPath
+		if tgsConfig.SharedModules {
+			shared, err := shareModule(componentsDir, componentPath)
+			if err != nil {
+				return fmt.Errorf("failed to share the module of %s: %w", compName, err)
+			}
+			modulePath = shared
+			moduleDir = filepath.Join(componentsDir, filepath.FromSlash(shared))
+		}
+
+		envConfigInputs, err := generateEnvConfigInputs(compName, comp, dependencyOutputs(comp, mainConfig.Stack.ExternalDependencies))
+		if err != nil {
+			return fmt.Errorf("failed to generate inputs for %s: %w", compName, err)
+		}
+
 		// Prepare component data
+		namingFormat, namingSeparator := naming.ForComponent(tgsConfig.Naming, compName)
 		componentData := &templates.ComponentData{
 			StackName:        mainConfig.Stack.Name,
 			ComponentName:    compName,
 			Source:           comp.Source,
 			Version:          comp.Version,
-			ResourceType:     getResourceTypeAbbreviation(compName),
+			ResourceType:     naming.Abbreviation(compName),
 			DependencyBlocks: dependencyBlocks,
-			EnvConfigInputs:  generateEnvConfigInputs(comp),
-			NamingFormat:     tgsConfig.Naming.Format,
+			EnvConfigInputs:  envConfigInputs,
+			NamingFormat:     escapeHCL(namingFormat),
+			NamingSeparator:  escapeHCL(namingSeparator),
+			ModulePath:       modulePath,
 		}
 
 		// Render component.hcl template
@@ -96,6 +155,7 @@ func generateComponents(mainConfig *config.MainConfig, infraPath string) error {
 		}
 
 		// Write component.hcl file
+		componentHcl = appendExtraHCL(componentHcl, comp.ExtraHCL)
 		if err := createFile(filepath.Join(componentPath, "component.hcl"), componentHcl); err != nil {
 			return fmt.Errorf("failed to create component.hcl: %w", err)
 		}
@@ -103,7 +163,7 @@ func generateComponents(mainConfig *config.MainConfig, infraPath string) error {
 		// Generate app settings structure if enabled
 		if comp.AppSettings {
 			// Get apps for this component from the architecture config
-			var apps []string
+			var apps []config.App
 			appMap := make(map[string]bool) // Use map to deduplicate apps
 
 			// Ensure we have a valid architecture configuration
@@ -117,7 +177,7 @@ func generateComponents(mainConfig *config.MainConfig, infraPath string) error {
 					if regionComp.Component == compName {
 						for _, app := range regionComp.Apps {
 							if !appMap[app] {
-								apps = append(apps, app)
+								apps = append(apps, regionComp.App(app))
 								appMap[app] = true
 							}
 						}
@@ -133,7 +193,7 @@ func generateComponents(mainConfig *config.MainConfig, infraPath string) error {
 		// Generate policy files structure if enabled
 		if comp.PolicyFiles {
 			// Get apps for this component from the architecture config
-			var apps []string
+			var apps []config.App
 			appMap := make(map[string]bool) // Use map to deduplicate apps
 
 			// Ensure we have a valid architecture configuration
@@ -147,7 +207,7 @@ func generateComponents(mainConfig *config.MainConfig, infraPath string) error {
 					if regionComp.Component == compName {
 						for _, app := range regionComp.Apps {
 							if !appMap[app] {
-								apps = append(apps, app)
+								apps = append(apps, regionComp.App(app))
 								appMap[app] = true
 							}
 						}
@@ -155,18 +215,19 @@ func generateComponents(mainConfig *config.MainConfig, infraPath string) error {
 				}
 			}
 
-			if err := generatePolicyFilesStructure(compName, infraPath, tgsConfig, apps, mainConfig.Stack.Name); err != nil {
+			if err := generatePolicyFilesStructure(compName, comp, infraPath, tgsConfig, apps, mainConfig.Stack.Name); err != nil {
 				return fmt.Errorf("failed to generate policy files structure: %w", err)
 			}
 		}
 
 		// Validate component structure
-		if err := ValidateComponentStructure(componentPath); err != nil {
+		if err := ValidateComponentStructure(componentPath, moduleDir); err != nil {
 			return fmt.Errorf("component structure validation failed for %s: %w", compName, err)
 		}
 
 		logger.Success("Generated and validated component: %s", compName)
 		logger.UpdateProgress()
+		events.ComponentGenerated(mainConfig.Stack.Name, compName)
 
 		// Mark this component as validated
 		validatedComponents[compName] = true
@@ -175,165 +236,205 @@ func generateComponents(mainConfig *config.MainConfig, infraPath string) error {
 	return nil
 }
 
-// Helper function to get resource type abbreviation
-func getResourceTypeAbbreviation(componentName string) string {
-	abbreviations := map[string]string{
-		"serviceplan": "asp",
-		"appservice":  "app",
-		"functionapp": "func",
-		"redis":       "redis",
-		"storage":     "st",
-		"keyvault":    "kv",
-		"sql":         "sql",
-		"cosmos":      "cos",
+// shareModule moves the Terraform files of a component to the shared module
+// of their content under _components/_shared/<hash>, written by the first
+// identical component, and returns its path relative to _components
+func shareModule(componentsDir, componentPath string) (string, error) {
+	files, err := project.Glob(filepath.Join(componentPath, "*.tf"))
+	if err != nil {
+		return "", err
 	}
+	sort.Strings(files)
 
-	for key, abbr := range abbreviations {
-		if strings.Contains(strings.ToLower(componentName), key) {
-			return abbr
+	hash := sha256.New()
+	contents := make(map[string][]byte)
+	for _, file := range files {
+		content, err := project.ReadFile(file)
+		if err != nil {
+			return "", err
 		}
+		name := filepath.Base(file)
+		contents[name] = content
+		fmt.Fprintf(hash, "%s\x00%s\x00", name, content)
 	}
 
-	// Default to first three letters if no match
-	if len(componentName) >= 3 {
-		return strings.ToLower(componentName[0:3])
+	shared := "_shared/" + hex.EncodeToString(hash.Sum(nil))[:12]
+	sharedDir := filepath.Join(componentsDir, filepath.FromSlash(shared))
+	if err := project.MkdirAll(sharedDir, 0755); err != nil {
+		return "", err
 	}
-	return strings.ToLower(componentName)
-}
-
-// Helper function to analyze required inputs and their dependencies
-func analyzeRequiredInputs(comp config.Component) ([]string, map[string]string) {
-	// Map of input names to their dependency sources
-	dependencyMap := map[string]string{
-		"service_plan_id":     "serviceplan",
-		"server_id":           "sqlserver",
-		"key_vault_id":        "keyvault",
-		"storage_account_id":  "storage",
-		"cosmosdb_account_id": "cosmos",
+	for name, content := range contents {
+		if err := createFile(filepath.Join(sharedDir, name), string(content)); err != nil {
+			return "", err
+		}
+		if err := output.RemoveFile(filepath.Join(componentPath, name)); err != nil {
+			return "", err
+		}
 	}
+	usedSharedModules[shared] = true
+	return shared, nil
+}
 
-	// Extract component type from source
-	compType := strings.TrimPrefix(comp.Source, "azurerm_")
-
-	// Define required inputs for each resource type
-	requiredInputs := make(map[string][]string)
-	requiredInputs["linux_web_app"] = []string{"service_plan_id"}
-	requiredInputs["windows_web_app"] = []string{"service_plan_id"}
-	requiredInputs["app_service"] = []string{"service_plan_id"}
-	requiredInputs["function_app"] = []string{"service_plan_id"}
-	requiredInputs["sql_database"] = []string{"server_id"}
-	requiredInputs["key_vault_access_policy"] = []string{"key_vault_id"}
-	requiredInputs["storage_container"] = []string{"storage_account_id"}
-	requiredInputs["cosmosdb_sql_container"] = []string{"cosmosdb_account_id"}
+// usedSharedModules holds the shared modules of the current run
+var usedSharedModules = make(map[string]bool)
 
-	// Get required inputs for this component type
-	inputs := requiredInputs[compType]
-	if inputs == nil {
-		return nil, nil
+// pruneSharedModules removes the shared modules the current run didn't use
+func pruneSharedModules(componentsDir string) error {
+	entries, err := project.ReadDir(filepath.Join(componentsDir, "_shared"))
+	if err != nil {
+		return nil
 	}
-
-	// Find dependencies needed for required inputs
-	var deps []string
-	inputDeps := make(map[string]string)
-	for _, input := range inputs {
-		if dep, exists := dependencyMap[input]; exists {
-			deps = append(deps, dep)
-			inputDeps[input] = dep
+	for _, entry := range entries {
+		if !usedSharedModules["_shared/"+entry.Name()] {
+			if err := project.RemoveAll(filepath.Join(componentsDir, "_shared", entry.Name())); err != nil {
+				return fmt.Errorf("failed to remove shared module %s: %w", entry.Name(), err)
+			}
 		}
 	}
-
-	return deps, inputDeps
+	return nil
 }
 
-// Helper function to generate environment-specific inputs based on component type
-func generateEnvConfigInputs(comp config.Component) string {
-	// Extract component type from source
-	compType := strings.TrimPrefix(comp.Source, "azurerm_")
-
-	// Analyze required inputs and their dependencies
-	_, inputDeps := analyzeRequiredInputs(comp)
+// dependencyOutputs maps the dependency blocks of a component to the
+// expression holding their outputs, for {dep:name.output} inputs
+func dependencyOutputs(comp config.Component, external map[string]config.ExternalDependency) map[string]string {
+	outputs := make(map[string]string)
+	for _, name := range config.DependencyNames(comp.Deps) {
+		outputs[name] = fmt.Sprintf("dependency.%s.outputs", name)
+	}
+	for _, name := range comp.ExternalDeps {
+		// Remote state data sources live in the module, not in component.hcl
+		if ext, ok := external[name]; ok && ext.RemoteState == nil {
+			outputs[name] = fmt.Sprintf("dependency.%s.outputs", name)
+		}
+	}
+	return outputs
+}
 
-	// Handle web app variants
-	if strings.Contains(compType, "web_app") || compType == "app_service" {
-		var inputs []string
-		inputs = append(inputs, `# Web App specific settings`)
+// Helper function to generate the inputs read from the environment config
+// schema of a component, followed by the inputs set in the stack file
+func generateEnvConfigInputs(compName string, comp config.Component, outputs map[string]string) (string, error) {
+	schema := envconfig.For(comp)
+	var inputs []string
+	if len(schema.Fields) > 0 {
+		inputs = append(inputs, "# "+schema.Title)
+	} else {
+		inputs = append(inputs, "# No specific inputs required for this component type")
+	}
+	for _, input := range schema.Inputs(compName) {
+		inputs = append(inputs, "    "+input)
+	}
 
-		// Add service_plan_id with dependency if needed
-		if dep, exists := inputDeps["service_plan_id"]; exists {
-			inputs = append(inputs, fmt.Sprintf(`    service_plan_id = dependency.%s.outputs.id`, dep))
-		} else {
-			inputs = append(inputs, `    service_plan_id = try(local.env_config.locals.serviceplan.id, "") # Required: Set this in environment config`)
+	var names []string
+	for name, value := range comp.Inputs {
+		// Inputs read from data sources are resolved in the module
+		if _, ok := config.ParseDataReference(value); !ok {
+			names = append(names, name)
 		}
+	}
+	sort.Strings(names)
+	if len(names) > 0 {
+		inputs = append(inputs, "", "    # Inputs set in the stack file")
+	}
+	for _, name := range names {
+		expr, err := config.ResolveInput(comp.Inputs[name], outputs)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve input %s: %w", name, err)
+		}
+		inputs = append(inputs, fmt.Sprintf("    %s = %s", name, expr))
+	}
 
-		inputs = append(inputs, `    app_settings = try(local.env_config.locals.appservice.app_settings, {})`,
-			`    site_config = try(local.env_config.locals.appservice.site_config, {})`)
+	if len(comp.Instances) > 0 {
+		instances, err := generateInstancesInput(comp.Instances, outputs)
+		if err != nil {
+			return "", err
+		}
+		inputs = append(inputs, "", "    # Instances of the resource and their inputs", "    instances = "+instances)
+	}
 
-		return strings.Join(inputs, "\n")
+	if len(comp.Origins) > 0 {
+		inputs = append(inputs, "", fmt.Sprintf("    # Origins, the regional instances of %s, and the endpoints routing to them", comp.Routing.Origins))
+		inputs = append(inputs, generateRoutingInputs(comp.Origins, comp.Routing.HostOutputName())...)
 	}
 
-	switch compType {
-	case "service_plan":
-		return `# Service Plan specific settings
-    sku_name = try(local.env_config.locals.serviceplan.sku_name, "B1")
-    os_type = try(local.env_config.locals.serviceplan.os_type, "Linux")`
-	case "function_app":
-		var inputs []string
-		inputs = append(inputs, `# Function App specific settings`)
+	return strings.Join(inputs, "\n"), nil
+}
 
-		// Add service_plan_id with dependency if needed
-		if dep, exists := inputDeps["service_plan_id"]; exists {
-			inputs = append(inputs, fmt.Sprintf(`    service_plan_id = dependency.%s.outputs.id`, dep))
-		} else {
-			inputs = append(inputs, `    service_plan_id = try(local.env_config.locals.serviceplan.id, "") # Required: Set this in environment config`)
+// generateRoutingInputs renders the origins of a routing component, keyed by
+// name with the host name output of their dependency, and its endpoints, the
+// names of the origins of each endpoint
+func generateRoutingInputs(origins []config.Origin, hostOutput string) []string {
+	lines := []string{"    origins = {"}
+	endpoints := make(map[string][]string)
+	var endpointNames []string
+	for _, origin := range origins {
+		lines = append(lines,
+			fmt.Sprintf("      %q = {", origin.Name),
+			fmt.Sprintf("        host_name = dependency.%s.outputs.%s", origin.Dependency, hostOutput),
+			fmt.Sprintf("        region    = %q", origin.Region),
+			fmt.Sprintf("        endpoint  = %q", origin.Endpoint),
+			fmt.Sprintf("        priority  = %d", origin.Priority),
+			"        weight    = 1000",
+			"      }")
+		if _, ok := endpoints[origin.Endpoint]; !ok {
+			endpointNames = append(endpointNames, origin.Endpoint)
 		}
+		endpoints[origin.Endpoint] = append(endpoints[origin.Endpoint], fmt.Sprintf("%q", origin.Name))
+	}
+	lines = append(lines, "    }", "    endpoints = {")
+	sort.Strings(endpointNames)
+	for _, endpoint := range endpointNames {
+		lines = append(lines, fmt.Sprintf("      %q = [%s]", endpoint, strings.Join(endpoints[endpoint], ", ")))
+	}
+	return append(lines, "    }")
+}
 
-		inputs = append(inputs, `    app_settings = try(local.env_config.locals.functionapp.app_settings, {})`)
-		return strings.Join(inputs, "\n")
-	case "sql_database":
-		var inputs []string
-		inputs = append(inputs, `# SQL Database specific settings`)
+// generateInstancesInput renders the instances of a component as an object
+// of the inputs of each instance, sorted by name
+func generateInstancesInput(instances map[string]map[string]string, outputs map[string]string) (string, error) {
+	var names []string
+	for name := range instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-		// Add server_id with dependency if needed
-		if dep, exists := inputDeps["server_id"]; exists {
-			inputs = append(inputs, fmt.Sprintf(`    server_id = dependency.%s.outputs.id`, dep))
-		} else {
-			inputs = append(inputs, `    server_id = try(local.env_config.locals.sql.server_id, "") # Required: Set this in environment config`)
-		}
-
-		inputs = append(inputs, `    sku_name = try(local.env_config.locals.sql.sku_name, "Basic")`)
-		return strings.Join(inputs, "\n")
-	case "redis_cache":
-		return `# Redis Cache specific settings
-    sku_name = try(local.env_config.locals.redis.sku_name, "Basic")
-    family = try(local.env_config.locals.redis.family, "C")`
-	case "key_vault":
-		return `# Key Vault specific settings
-    sku_name = try(local.env_config.locals.keyvault.sku_name, "standard")
-    purge_protection_enabled = try(local.env_config.locals.keyvault.purge_protection_enabled, false)`
-	case "storage_account":
-		return `# Storage Account specific settings
-    account_tier = try(local.env_config.locals.storage.account_tier, "Standard")
-    account_replication_type = try(local.env_config.locals.storage.account_replication_type, "LRS")`
-	case "sql_server":
-		return `# SQL Server specific settings
-    version = try(local.env_config.locals.sql.version, "12.0")
-    administrator_login = try(local.env_config.locals.sql.administrator_login, "sqladmin")
-    administrator_login_password = try(local.env_config.locals.sql.administrator_login_password, "") # Required: Set this in environment config`
-	case "cosmosdb_account":
-		return `# Cosmos DB specific settings
-    offer_type = try(local.env_config.locals.cosmos.offer_type, "Standard")
-    consistency_level = try(local.env_config.locals.cosmos.consistency_level, "Session")`
-	default:
-		return "# No specific inputs required for this component type"
+	lines := []string{"{"}
+	for _, name := range names {
+		var keys []string
+		for key := range instances[name] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if len(keys) == 0 {
+			lines = append(lines, fmt.Sprintf("      %q = {}", name))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("      %q = {", name))
+		for _, key := range keys {
+			expr, err := config.ResolveInput(instances[name][key], outputs)
+			if err != nil {
+				return "", fmt.Errorf("failed to resolve input %s of instance %s: %w", key, name, err)
+			}
+			lines = append(lines, fmt.Sprintf("        %s = %s", key, expr))
+		}
+		lines = append(lines, "      }")
 	}
+	lines = append(lines, "    }")
+	return strings.Join(lines, "\n"), nil
 }
 
 // Helper function to generate dependency blocks
-func generateDependencyBlocks(deps []string, infraPath string) string {
+func generateDependencyBlocks(comp config.Component, components map[string]config.Component, infraPath string, layout string) string {
+	deps := comp.Deps
 	if len(deps) == 0 {
 		return ""
 	}
 
+	// Units of the stacks layout are generated into .terragrunt-stack
+	units := ""
+	if layout == config.LayoutStacks {
+		units = "/" + terragruntStackDir
+	}
+
 	// Initialize template renderer
 	renderer, err := templates.NewRenderer()
 	if err != nil {
@@ -342,8 +443,9 @@ func generateDependencyBlocks(deps []string, infraPath string) string {
 	}
 
 	var blocks []string
-	usedNames := make(map[string]bool)
-	for _, dep := range deps {
+	names := config.DependencyNames(deps)
+	for i, dep := range deps {
+		depName := names[i]
 		// Handle both explicit dependencies and analyzed dependencies
 		if strings.Contains(dep, ".") {
 			// Handle explicit dependencies (region.component.app format)
@@ -362,37 +464,35 @@ func generateDependencyBlocks(deps []string, infraPath string) string {
 			}
 
 			// Replace placeholders
-			if region == "{region}" {
+			switch region {
+			case "{region}":
 				region = "${local.region_vars.locals.region_name}"
+			case "{paired_region}":
+				region = "${local.region_vars.locals.paired_region}"
 			}
 
-			depName := component
 			configPath := ""
 
 			if app == "" || app == "{app}" {
 				if app == "{app}" {
 					// App-specific dependency using current app
-					configPath = fmt.Sprintf("${get_repo_root()}/.infrastructure/architecture/${local.stack_name}/${local.subscription_vars.locals.subscription_name}/%s/${local.environment_vars.locals.environment_name}/%s/${local.app_name}", region, component)
+					configPath = fmt.Sprintf("${get_repo_root()}/"+output.RepoPath()+"/architecture/${local.stack_name}/${local.subscription_vars.locals.subscription_name}/%s/${local.environment_vars.locals.environment_name}%s/%s/${local.app_name}", region, units, component)
 				} else {
 					// Component-level dependency
-					configPath = fmt.Sprintf("${get_repo_root()}/.infrastructure/architecture/${local.stack_name}/${local.subscription_vars.locals.subscription_name}/%s/${local.environment_vars.locals.environment_name}/%s", region, component)
+					configPath = fmt.Sprintf("${get_repo_root()}/"+output.RepoPath()+"/architecture/${local.stack_name}/${local.subscription_vars.locals.subscription_name}/%s/${local.environment_vars.locals.environment_name}%s/%s", region, units, component)
 				}
 			} else {
 				// App-specific dependency with fixed app name
-				configPath = fmt.Sprintf("${get_repo_root()}/.infrastructure/architecture/${local.stack_name}/${local.subscription_vars.locals.subscription_name}/%s/${local.environment_vars.locals.environment_name}/%s/%s", region, component, app)
-				depName = fmt.Sprintf("%s_%s", component, app)
+				configPath = fmt.Sprintf("${get_repo_root()}/"+output.RepoPath()+"/architecture/${local.stack_name}/${local.subscription_vars.locals.subscription_name}/%s/${local.environment_vars.locals.environment_name}%s/%s/%s", region, units, component, app)
 			}
 
-			// Ensure unique dependency name
-			if usedNames[depName] {
-				depName = fmt.Sprintf("%s_%d", depName, len(usedNames)+1)
-			}
-			usedNames[depName] = true
-
 			// Render dependency template
+			options := comp.DependencyOptions[dep]
 			dependencyData := &templates.DependencyData{
-				Name:       depName,
-				ConfigPath: configPath,
+				Name:        depName,
+				ConfigPath:  configPath,
+				SkipOutputs: options.SkipOutputs,
+				MockOutputs: mockOutputs(components[component], component, options),
 			}
 			block, err := renderer.RenderTemplate("components/dependency.hcl.tmpl", dependencyData)
 			if err != nil {
@@ -402,18 +502,14 @@ func generateDependencyBlocks(deps []string, infraPath string) string {
 			blocks = append(blocks, block)
 		} else {
 			// Handle analyzed dependencies (component name only)
-			configPath := fmt.Sprintf("${get_repo_root()}/.infrastructure/architecture/${local.stack_name}/${local.subscription_vars.locals.subscription_name}/${local.region_vars.locals.region_name}/${local.environment_vars.locals.environment_name}/%s", dep)
-
-			// Ensure unique dependency name
-			depName := dep
-			if usedNames[depName] {
-				depName = fmt.Sprintf("%s_%d", depName, len(usedNames)+1)
-			}
-			usedNames[depName] = true
+			configPath := fmt.Sprintf("${get_repo_root()}/"+output.RepoPath()+"/architecture/${local.stack_name}/${local.subscription_vars.locals.subscription_name}/${local.region_vars.locals.region_name}/${local.environment_vars.locals.environment_name}%s/%s", units, dep)
 
+			options := comp.DependencyOptions[dep]
 			dependencyData := &templates.DependencyData{
-				Name:       depName,
-				ConfigPath: configPath,
+				Name:        depName,
+				ConfigPath:  configPath,
+				SkipOutputs: options.SkipOutputs,
+				MockOutputs: mockOutputs(components[dep], dep, options),
 			}
 			block, err := renderer.RenderTemplate("components/dependency.hcl.tmpl", dependencyData)
 			if err != nil {
@@ -427,11 +523,130 @@ func generateDependencyBlocks(deps []string, infraPath string) string {
 	return strings.Join(blocks, "\n")
 }
 
+// generateExternalDependencies renders dependency blocks for external
+// dependencies referenced by config path, and writes a terraform_remote_state
+// data source for those referenced by remote state into external.tf
+func generateExternalDependencies(comp config.Component, external map[string]config.ExternalDependency, componentPath string, renderer *templates.TemplateRenderer) (string, error) {
+	var blocks []string
+	var dataSources []string
+
+	for _, name := range comp.ExternalDeps {
+		ext, ok := external[name]
+		if !ok {
+			return "", fmt.Errorf("external dependency %s is not defined in the stack", name)
+		}
+
+		if ext.RemoteState != nil {
+			dataSource, err := renderer.RenderTemplate("components/external_state.tf.tmpl", &templates.ExternalStateData{
+				Name:           name,
+				ResourceGroup:  ext.RemoteState.ResourceGroup,
+				StorageAccount: ext.RemoteState.StorageAccount,
+				Container:      ext.RemoteState.Container,
+				Key:            ext.RemoteState.Key,
+			})
+			if err != nil {
+				return "", fmt.Errorf("failed to render external state template: %w", err)
+			}
+			dataSources = append(dataSources, dataSource)
+			continue
+		}
+
+		block, err := renderer.RenderTemplate("components/dependency.hcl.tmpl", &templates.DependencyData{
+			Name:        name,
+			ConfigPath:  ext.ConfigPath,
+			SkipOutputs: ext.SkipOutputs,
+			MockOutputs: ext.MockOutputs,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to render dependency template: %w", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	if len(dataSources) > 0 {
+		if err := createFile(filepath.Join(componentPath, "external.tf"), strings.Join(dataSources, "")); err != nil {
+			return "", fmt.Errorf("failed to create external.tf: %w", err)
+		}
+	}
+
+	return strings.Join(blocks, "\n"), nil
+}
+
+// armResourceTypes maps Terraform resource types to the ARM types used to
+// build realistic mock resource IDs
+var armResourceTypes = map[string]string{
+	"azurerm_service_plan":            "Microsoft.Web/serverFarms",
+	"azurerm_app_service_plan":        "Microsoft.Web/serverFarms",
+	"azurerm_linux_web_app":           "Microsoft.Web/sites",
+	"azurerm_windows_web_app":         "Microsoft.Web/sites",
+	"azurerm_app_service":             "Microsoft.Web/sites",
+	"azurerm_linux_function_app":      "Microsoft.Web/sites",
+	"azurerm_windows_function_app":    "Microsoft.Web/sites",
+	"azurerm_function_app":            "Microsoft.Web/sites",
+	"azurerm_redis_cache":             "Microsoft.Cache/redis",
+	"azurerm_key_vault":               "Microsoft.KeyVault/vaults",
+	"azurerm_storage_account":         "Microsoft.Storage/storageAccounts",
+	"azurerm_sql_server":              "Microsoft.Sql/servers",
+	"azurerm_cosmosdb_account":        "Microsoft.DocumentDB/databaseAccounts",
+	"azurerm_servicebus_namespace":    "Microsoft.ServiceBus/namespaces",
+	"azurerm_eventhub_namespace":      "Microsoft.EventHub/namespaces",
+	"azurerm_log_analytics_workspace": "Microsoft.OperationalInsights/workspaces",
+	"azurerm_virtual_network":         "Microsoft.Network/virtualNetworks",
+	"azurerm_api_management":          "Microsoft.ApiManagement/service",
+	"azurerm_cdn_frontdoor_profile":   "Microsoft.Cdn/profiles",
+	"azurerm_traffic_manager_profile": "Microsoft.Network/trafficManagerProfiles",
+}
+
+// mockOutputs returns the mock outputs for a dependency block: a mock of
+// every string output of the module generated for the dependency, with
+// resource IDs shaped like ARM IDs, overridden by the mock_outputs of the
+// dependency in the stack file. Outputs exported with all: true are read from
+// the provider schema, which generating the dependency's module fetches too.
+func mockOutputs(depComp config.Component, depName string, options config.DependencyOptions) map[string]string {
+	outputs := make(map[string]string)
+
+	if depComp.Source != "" {
+		attributes := make(map[string]map[string]SchemaAttribute)
+		if depComp.Outputs.All {
+			if schema, err := fetchProviderSchema(depComp.Provider, depComp.Version, depComp.Source); err == nil {
+				for _, resourceType := range append([]string{depComp.Source}, depComp.AdditionalResources...) {
+					if rs, ok := lookupResourceSchema(schema, resourceType); ok {
+						attributes[resourceType] = rs.Block.Attributes
+					}
+				}
+			}
+		}
+
+		// Outputs the module can't generate are reported when generating it
+		moduleOutputs, _ := moduleOutputs(depComp, attributes)
+		for _, output := range moduleOutputs {
+			switch output.Attribute {
+			case "":
+				// Slot outputs are maps, mock_outputs must set them
+			case "id":
+				armType, ok := armResourceTypes[output.ResourceType]
+				if !ok {
+					armType = "Microsoft.Resources/" + strings.TrimPrefix(output.ResourceType, "azurerm_")
+				}
+				outputs[output.Name] = fmt.Sprintf("/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/mock-rg/providers/%s/mock-%s", armType, depName)
+			default:
+				outputs[output.Name] = "mock-" + depName
+			}
+		}
+	}
+
+	for key, value := range options.MockOutputs {
+		outputs[key] = value
+	}
+
+	return outputs
+}
+
 // generateAppSettingsStructure creates the app settings folder structure for a component
-func generateAppSettingsStructure(compName string, infraPath string, tgsConfig *config.TGSConfig, apps []string, stackName string) error {
+func generateAppSettingsStructure(compName string, infraPath string, tgsConfig *config.TGSConfig, apps []config.App, stackName string) error {
 	// Create app settings directory under the stack's config folder
 	appSettingsDir := filepath.Join(infraPath, "config", stackName, "app_settings_"+compName)
-	if err := os.MkdirAll(appSettingsDir, 0755); err != nil {
+	if err := project.MkdirAll(appSettingsDir, 0755); err != nil {
 		return fmt.Errorf("failed to create app settings directory: %w", err)
 	}
 
@@ -461,7 +676,7 @@ func generateAppSettingsStructure(compName string, infraPath string, tgsConfig *
 
 			// Create environment directory
 			envDir := filepath.Join(appSettingsDir, subName, env.Name)
-			if err := os.MkdirAll(envDir, 0755); err != nil {
+			if err := project.MkdirAll(envDir, 0755); err != nil {
 				return fmt.Errorf("failed to create environment directory: %w", err)
 			}
 
@@ -471,10 +686,18 @@ func generateAppSettingsStructure(compName string, infraPath string, tgsConfig *
 				return fmt.Errorf("failed to create environment app settings file: %w", err)
 			}
 
-			// Create app-specific settings files
+			// Create app-specific settings files, seeded with the settings of the app
 			for _, app := range apps {
-				appSettingsPath := filepath.Join(envDir, app+".appsettings.json")
-				if err := createFile(appSettingsPath, "{}"); err != nil {
+				settings := "{}"
+				if values := app.Settings.Values(); len(values) > 0 {
+					data, err := json.MarshalIndent(values, "", "  ")
+					if err != nil {
+						return fmt.Errorf("failed to encode settings of app %s: %w", app.Name, err)
+					}
+					settings = string(data)
+				}
+				appSettingsPath := filepath.Join(envDir, app.Name+".appsettings.json")
+				if err := createFile(appSettingsPath, settings); err != nil {
 					return fmt.Errorf("failed to create app settings file: %w", err)
 				}
 			}
@@ -499,11 +722,13 @@ func generateAppSettingsStructure(compName string, infraPath string, tgsConfig *
 	return nil
 }
 
-// generatePolicyFilesStructure creates the policy files folder structure for a component
-func generatePolicyFilesStructure(compName string, infraPath string, tgsConfig *config.TGSConfig, apps []string, stackName string) error {
+// generatePolicyFilesStructure creates the policy files folder structure for a
+// component: the policy of each app per environment, the component's policy
+// fragments and the operation policies of each app
+func generatePolicyFilesStructure(compName string, comp config.Component, infraPath string, tgsConfig *config.TGSConfig, apps []config.App, stackName string) error {
 	// Create policy files directory under the stack's config folder
 	policyFilesDir := filepath.Join(infraPath, "config", stackName, "policy_files_"+compName)
-	if err := os.MkdirAll(policyFilesDir, 0755); err != nil {
+	if err := project.MkdirAll(policyFilesDir, 0755); err != nil {
 		return fmt.Errorf("failed to create policy files directory: %w", err)
 	}
 
@@ -527,20 +752,43 @@ func generatePolicyFilesStructure(compName string, infraPath string, tgsConfig *
 
 			// Create environment directory
 			envDir := filepath.Join(policyFilesDir, subName, env.Name)
-			if err := os.MkdirAll(envDir, 0755); err != nil {
+			if err := project.MkdirAll(envDir, 0755); err != nil {
 				return fmt.Errorf("failed to create environment directory: %w", err)
 			}
 
 			// Create app-specific policy files
 			for _, app := range apps {
-				policyFilePath := filepath.Join(envDir, app+".policy.xml")
-				if err := createFile(policyFilePath, "<?xml version=\"1.0\" encoding=\"utf-8\"?>\n<configuration>\n</configuration>"); err != nil {
+				policyFilePath := filepath.Join(envDir, app.Name+".policy.xml")
+				if err := createFile(policyFilePath, apim.PolicySkeleton); err != nil {
 					return fmt.Errorf("failed to create policy file: %w", err)
 				}
 			}
 		}
 	}
 
+	// Create the policy fragments shared by the apps
+	for id, fragment := range comp.PolicyFragments {
+		if strings.TrimSpace(fragment) == "" {
+			fragment = apim.FragmentSkeleton
+		}
+		if err := createFile(filepath.Join(policyFilesDir, "fragments", id+".xml"), fragment); err != nil {
+			return fmt.Errorf("failed to create policy fragment %s: %w", id, err)
+		}
+	}
+
+	// Create the operation policies of each app, in <api>/<operation>.policy.xml
+	for _, app := range apps {
+		for operation, policy := range app.Operations {
+			if strings.TrimSpace(policy) == "" {
+				policy = apim.PolicySkeleton
+			}
+			path := filepath.Join(policyFilesDir, "operations", app.Name, filepath.FromSlash(operation)+".policy.xml")
+			if err := createFile(path, policy); err != nil {
+				return fmt.Errorf("failed to create policy of operation %s of app %s: %w", operation, app.Name, err)
+			}
+		}
+	}
+
 	// Generate policies.hcl file
 	policyData := templates.PolicyData{
 		ComponentName: compName,
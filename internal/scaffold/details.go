@@ -0,0 +1,119 @@
+package scaffold
+
+import (
+	"sort"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/naming"
+)
+
+// StackDetails is the structured output of tgs details
+type StackDetails struct {
+	Name         string               `json:"name" yaml:"name"`
+	Version      string               `json:"version" yaml:"version"`
+	Description  string               `json:"description" yaml:"description"`
+	Components   []ComponentDetails   `json:"components" yaml:"components"`
+	Regions      []RegionDetails      `json:"regions" yaml:"regions"`
+	Environments []EnvironmentDetails `json:"environments" yaml:"environments"`
+}
+
+// ComponentDetails describes a component of a stack
+type ComponentDetails struct {
+	Name                string   `json:"name" yaml:"name"`
+	Source              string   `json:"source" yaml:"source"`
+	Provider            string   `json:"provider" yaml:"provider"`
+	Version             string   `json:"version" yaml:"version"`
+	Description         string   `json:"description" yaml:"description"`
+	Deps                []string `json:"deps,omitempty" yaml:"deps,omitempty"`
+	ExternalDeps        []string `json:"external_deps,omitempty" yaml:"external_deps,omitempty"`
+	AdditionalResources []string `json:"additional_resources,omitempty" yaml:"additional_resources,omitempty"`
+}
+
+// RegionDetails lists the components deployed to a region and their apps
+type RegionDetails struct {
+	Name string `json:"name" yaml:"name"`
+	// PairedRegion is the region the region fails over to
+	PairedRegion string                   `json:"paired_region,omitempty" yaml:"paired_region,omitempty"`
+	Components   []RegionComponentDetails `json:"components" yaml:"components"`
+}
+
+// RegionComponentDetails is a component of a region and its apps
+type RegionComponentDetails struct {
+	Component string   `json:"component" yaml:"component"`
+	Apps      []string `json:"apps,omitempty" yaml:"apps,omitempty"`
+}
+
+// EnvironmentDetails holds the computed resource names of an environment
+// deploying the stack
+type EnvironmentDetails struct {
+	Subscription string         `json:"subscription" yaml:"subscription"`
+	Name         string         `json:"name" yaml:"name"`
+	Resources    []naming.Entry `json:"resources" yaml:"resources"`
+}
+
+// Details returns the components, regions and resource names per environment
+// of a stack, sorted for stable output
+func Details(tgsConfig *config.TGSConfig, stackName string, mainConfig *config.MainConfig) StackDetails {
+	details := StackDetails{
+		Name:         mainConfig.Stack.Name,
+		Version:      mainConfig.Stack.Version,
+		Description:  mainConfig.Stack.Description,
+		Components:   []ComponentDetails{},
+		Regions:      []RegionDetails{},
+		Environments: []EnvironmentDetails{},
+	}
+
+	var compNames []string
+	for name := range mainConfig.Stack.Components {
+		compNames = append(compNames, name)
+	}
+	sort.Strings(compNames)
+	for _, name := range compNames {
+		comp := mainConfig.Stack.Components[name]
+		details.Components = append(details.Components, ComponentDetails{
+			Name:                name,
+			Source:              comp.Source,
+			Provider:            comp.Provider,
+			Version:             comp.Version,
+			Description:         comp.Description,
+			Deps:                comp.Deps,
+			ExternalDeps:        comp.ExternalDeps,
+			AdditionalResources: comp.AdditionalResources,
+		})
+	}
+
+	var regions []string
+	for region := range mainConfig.Stack.Architecture.Regions {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	for _, region := range regions {
+		regionDetails := RegionDetails{Name: region, PairedRegion: mainConfig.Stack.Architecture.PairedRegions[region], Components: []RegionComponentDetails{}}
+		for _, comp := range mainConfig.Stack.Architecture.Regions[region] {
+			regionDetails.Components = append(regionDetails.Components, RegionComponentDetails{
+				Component: comp.Component,
+				Apps:      comp.Apps,
+			})
+		}
+		details.Regions = append(details.Regions, regionDetails)
+	}
+
+	if tgsConfig == nil {
+		return details
+	}
+	index := make(map[string]int)
+	for _, entry := range naming.Resolved(tgsConfig, stackName, mainConfig) {
+		key := entry.Subscription + "/" + entry.Environment
+		i, ok := index[key]
+		if !ok {
+			i = len(details.Environments)
+			index[key] = i
+			details.Environments = append(details.Environments, EnvironmentDetails{
+				Subscription: entry.Subscription,
+				Name:         entry.Environment,
+			})
+		}
+		details.Environments[i].Resources = append(details.Environments[i].Resources, entry)
+	}
+	return details
+}
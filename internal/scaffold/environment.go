@@ -4,25 +4,46 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/davoodharun/terragrunt-scaffolder/internal/azure"
 	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/envconfig"
 	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/naming"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
 	"github.com/davoodharun/terragrunt-scaffolder/internal/templates"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/workspace"
 )
 
 type EnvironmentTemplateData struct {
-	EnvironmentName           string
-	EnvironmentPrefix         string
-	Region                    string
-	RegionPrefix              string
+	EnvironmentName   string
+	EnvironmentPrefix string
+	Region            string
+	RegionPrefix      string
+	// PairedRegion is the region Region fails over to, if any
+	PairedRegion              string
+	PairedRegionPrefix        string
 	Subscription              string
+	AzureEnvironment          string
+	SubscriptionID            string
+	TenantID                  string
 	RemoteStateResourceGroup  string
 	RemoteStateStorageAccount string
-	StackName                 string
-	Component                 string
-	HasAppSettings            bool
-	HasPolicyFiles            bool
+	// RemoteState holds the backend options of the subscription
+	RemoteState    config.RemoteState
+	StackName      string
+	Component      string
+	HasAppSettings bool
+	HasPolicyFiles bool
+	// Inputs are set by the metadata of an app
+	Inputs map[string]interface{}
+	// Unit is set for the shared terragrunt.hcl of a stacks layout unit,
+	// which reads the inputs of an app from the unit values
+	Unit bool
+	// Tags are the tags of the subscription or environment
+	Tags map[string]string
 }
 
 func generateEnvironment(subscription, region string, envName string, components []config.RegionComponent, infraPath string) error {
@@ -32,14 +53,17 @@ func generateEnvironment(subscription, region string, envName string, components
 	if err != nil {
 		return fmt.Errorf("failed to read TGS config: %w", err)
 	}
+	prefixes := naming.NewPrefixes(tgsConfig.Prefixes)
 
-	// Find the stack name for this environment
+	// Find the stack name and tags of this environment
+	var envTags map[string]string
 	if sub, ok := tgsConfig.Subscriptions[subscription]; ok {
 		for _, env := range sub.Environments {
 			if env.Name == envName {
 				if env.Stack != "" {
 					stackName = env.Stack
 				}
+				envTags = env.Tags
 				break
 			}
 		}
@@ -47,26 +71,27 @@ func generateEnvironment(subscription, region string, envName string, components
 
 	// Create architecture folder structure
 	architecturePath := filepath.Join(infraPath, "architecture")
-	if err := os.MkdirAll(architecturePath, 0755); err != nil {
+	if err := project.MkdirAll(architecturePath, 0755); err != nil {
 		return fmt.Errorf("failed to create architecture directory: %w", err)
 	}
 
 	// Create stack folder within architecture
 	stackPath := filepath.Join(architecturePath, stackName)
-	if err := os.MkdirAll(stackPath, 0755); err != nil {
+	if err := project.MkdirAll(stackPath, 0755); err != nil {
 		return fmt.Errorf("failed to create stack directory: %w", err)
 	}
 
 	// Create environment base path
 	basePath := filepath.Join(stackPath, subscription, region, envName)
-	if err := os.MkdirAll(basePath, 0755); err != nil {
+	if err := project.MkdirAll(basePath, 0755); err != nil {
 		return fmt.Errorf("failed to create environment directory: %w", err)
 	}
 
 	// Create environment.hcl
 	envData := EnvironmentTemplateData{
 		EnvironmentName:   envName,
-		EnvironmentPrefix: getEnvironmentPrefix(envName),
+		EnvironmentPrefix: prefixes.Environment(envName),
+		Tags:              envTags,
 	}
 	if err := templates.Render("environment/environment.hcl.tmpl", filepath.Join(basePath, "environment.hcl"), envData); err != nil {
 		return fmt.Errorf("failed to create environment.hcl: %w", err)
@@ -74,13 +99,21 @@ func generateEnvironment(subscription, region string, envName string, components
 
 	// Create region.hcl in the region directory
 	regionPath := filepath.Join(stackPath, subscription, region)
-	if err := os.MkdirAll(regionPath, 0755); err != nil {
+	if err := project.MkdirAll(regionPath, 0755); err != nil {
 		return fmt.Errorf("failed to create region directory: %w", err)
 	}
 
 	regionData := EnvironmentTemplateData{
 		Region:       region,
-		RegionPrefix: GetRegionPrefix(region),
+		RegionPrefix: prefixes.Region(region),
+	}
+	stackConfig, err := ReadMainConfig(stackName)
+	if err != nil {
+		return fmt.Errorf("failed to read stack config %s: %w", stackName, err)
+	}
+	if pair := stackConfig.Stack.Architecture.PairedRegions[region]; pair != "" {
+		regionData.PairedRegion = pair
+		regionData.PairedRegionPrefix = prefixes.Region(pair)
 	}
 	if err := templates.Render("environment/region.hcl.tmpl", filepath.Join(regionPath, "region.hcl"), regionData); err != nil {
 		return fmt.Errorf("failed to create region.hcl: %w", err)
@@ -88,7 +121,7 @@ func generateEnvironment(subscription, region string, envName string, components
 
 	// Create subscription.hcl in the subscription directory
 	subPath := filepath.Join(stackPath, subscription)
-	if err := os.MkdirAll(subPath, 0755); err != nil {
+	if err := project.MkdirAll(subPath, 0755); err != nil {
 		return fmt.Errorf("failed to create subscription directory: %w", err)
 	}
 
@@ -97,19 +130,38 @@ func generateEnvironment(subscription, region string, envName string, components
 		return fmt.Errorf("subscription %s not found in TGS config", subscription)
 	}
 
+	cloud, err := azure.CloudFor(sub.Cloud)
+	if err != nil {
+		return fmt.Errorf("invalid cloud for subscription %s: %w", subscription, err)
+	}
+
 	subData := EnvironmentTemplateData{
 		Subscription:              subscription,
+		AzureEnvironment:          cloud.TerraformEnvironment,
+		SubscriptionID:            sub.SubscriptionID,
+		TenantID:                  sub.TenantID,
 		RemoteStateResourceGroup:  sub.RemoteState.ResourceGroup,
 		RemoteStateStorageAccount: sub.RemoteState.Name,
+		RemoteState:               sub.RemoteState,
+		Tags:                      sub.Tags,
 	}
 	if err := templates.Render("environment/subscription.hcl.tmpl", filepath.Join(subPath, "subscription.hcl"), subData); err != nil {
 		return fmt.Errorf("failed to create subscription.hcl: %w", err)
 	}
 
+	// Generate a Terragrunt stack of units instead of component directories
+	if tgsConfig.Layout == config.LayoutStacks {
+		mainConfig, err := ReadMainConfig(stackName)
+		if err != nil {
+			return fmt.Errorf("failed to read stack config %s: %w", stackName, err)
+		}
+		return generateTerragruntStack(mainConfig, stackName, region, envName, components, basePath, infraPath)
+	}
+
 	// Generate component directories and their apps
 	for _, comp := range components {
 		compPath := filepath.Join(basePath, comp.Component)
-		if err := os.MkdirAll(compPath, 0755); err != nil {
+		if err := project.MkdirAll(compPath, 0755); err != nil {
 			return fmt.Errorf("failed to create component directory: %w", err)
 		}
 
@@ -120,47 +172,67 @@ func generateEnvironment(subscription, region string, envName string, components
 		}
 
 		// Check if the component has app_settings or policy_files enabled
-		hasAppSettings := false
-		hasPolicyFiles := false
-		if compConfig, ok := mainConfig.Stack.Components[comp.Component]; ok {
-			hasAppSettings = compConfig.AppSettings
-			hasPolicyFiles = compConfig.PolicyFiles
-		}
+		compConfig := mainConfig.Stack.Components[comp.Component]
+		stateKeyPrefix := compConfig.StateKeyPrefix
 
 		compData := EnvironmentTemplateData{
 			StackName:      stackName,
 			Component:      comp.Component,
-			HasAppSettings: hasAppSettings,
-			HasPolicyFiles: hasPolicyFiles,
+			HasAppSettings: compConfig.AppSettings,
+			HasPolicyFiles: compConfig.PolicyFiles,
 		}
 
 		if len(comp.Apps) > 0 {
 			// Create app-specific folders and terragrunt files
 			for _, app := range comp.Apps {
 				appPath := filepath.Join(compPath, app)
-				if err := os.MkdirAll(appPath, 0755); err != nil {
+				if err := project.MkdirAll(appPath, 0755); err != nil {
 					return fmt.Errorf("failed to create app directory %s: %w", appPath, err)
 				}
 
-				if err := templates.Render("environment/terragrunt.hcl.tmpl", filepath.Join(appPath, "terragrunt.hcl"), compData); err != nil {
+				appData := compData
+				appData.Inputs = comp.App(app).Inputs(compConfig)
+				if err := templates.Render("environment/terragrunt.hcl.tmpl", filepath.Join(appPath, "terragrunt.hcl"), appData); err != nil {
 					return fmt.Errorf("failed to create terragrunt.hcl for app: %w", err)
 				}
+				if err := generateStateConfig(appPath, stateKeyPrefix); err != nil {
+					return err
+				}
 			}
 		} else {
 			// Create single terragrunt.hcl for components without apps
 			if err := templates.Render("environment/terragrunt.hcl.tmpl", filepath.Join(compPath, "terragrunt.hcl"), compData); err != nil {
 				return fmt.Errorf("failed to create terragrunt.hcl for component: %w", err)
 			}
+			if err := generateStateConfig(compPath, stateKeyPrefix); err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
+// generateStateConfig writes the state.hcl root.hcl reads the state key
+// prefix of a component from, removing a previous one when prefix is empty
+func generateStateConfig(dir, prefix string) error {
+	path := filepath.Join(dir, "state.hcl")
+	if prefix == "" {
+		if err := project.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove state.hcl: %w", err)
+		}
+		return nil
+	}
+	if err := createFile(path, fmt.Sprintf("locals {\n  key_prefix = %q\n}\n", prefix)); err != nil {
+		return fmt.Errorf("failed to create state.hcl: %w", err)
+	}
+	return nil
+}
+
 func generateEnvironmentConfigs(tgsConfig *config.TGSConfig, infraPath string) error {
 	// Create config directory
 	configDir := filepath.Join(infraPath, "config")
-	if err := os.MkdirAll(configDir, 0755); err != nil {
+	if err := project.MkdirAll(configDir, 0755); err != nil {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
@@ -168,8 +240,11 @@ func generateEnvironmentConfigs(tgsConfig *config.TGSConfig, infraPath string) e
 	globalData := templates.GlobalConfigData{
 		ProjectName: tgsConfig.Name,
 		Stacks:      make(map[string]templates.StackConfig),
+		Tags:        tgsConfig.Tags,
 	}
 
+	prefixes := naming.NewPrefixes(tgsConfig.Prefixes)
+
 	// Track unique stacks and their environments
 	uniqueStacks := make(map[string]bool)
 	stackEnvironments := make(map[string]map[string]bool)
@@ -199,7 +274,7 @@ func generateEnvironmentConfigs(tgsConfig *config.TGSConfig, infraPath string) e
 		// Add environments for this stack
 		for envName := range stackEnvironments[stackName] {
 			envConfig := templates.EnvironmentConfig{
-				Prefix:  getEnvironmentPrefix(envName),
+				Prefix:  prefixes.Environment(envName),
 				Regions: make(map[string]templates.RegionConfig),
 			}
 
@@ -212,7 +287,7 @@ func generateEnvironmentConfigs(tgsConfig *config.TGSConfig, infraPath string) e
 
 			for region := range mainConfig.Stack.Architecture.Regions {
 				envConfig.Regions[region] = templates.RegionConfig{
-					Prefix: GetRegionPrefix(region),
+					Prefix: prefixes.Region(region),
 				}
 			}
 
@@ -243,7 +318,7 @@ func generateEnvironmentConfigs(tgsConfig *config.TGSConfig, infraPath string) e
 
 			// Create environments directory under the stack's config folder
 			environmentsDir := filepath.Join(configDir, stackName, "environments", subName)
-			if err := os.MkdirAll(environmentsDir, 0755); err != nil {
+			if err := project.MkdirAll(environmentsDir, 0755); err != nil {
 				return fmt.Errorf("failed to create environments directory: %w", err)
 			}
 
@@ -259,77 +334,23 @@ func generateEnvironmentConfigs(tgsConfig *config.TGSConfig, infraPath string) e
 			configContent.WriteString("# Override these values as needed for your environment\n\n")
 			configContent.WriteString("locals {\n")
 
-			// Add configurations only for components that exist in the stack
-			for compName, comp := range mainConfig.Stack.Components {
-				if comp.Provider == "" {
-					continue
-				}
-
-				// Fetch provider schema for this component
-				schema, err := fetchProviderSchema(comp.Provider, comp.Version, comp.Source)
-				if err != nil || schema == nil {
-					logger.Warning("Failed to fetch provider schema for %s: %v", compName, err)
-					continue
-				}
-
-				// Try different provider keys
-				providerKeys := []string{
-					"registry.terraform.io/hashicorp/azurerm",
-					"hashicorp/azurerm",
-				}
-
-				var resourceSchema struct {
-					Block struct {
-						Attributes map[string]SchemaAttribute `json:"attributes"`
-						BlockTypes map[string]struct {
-							Block struct {
-								Attributes map[string]SchemaAttribute `json:"attributes"`
-							} `json:"block"`
-							NestingMode string `json:"nesting_mode"`
-						} `json:"block_types"`
-					} `json:"block"`
-				}
-
-				found := false
-				for _, key := range providerKeys {
-					if provider, ok := schema.ProviderSchema[key]; ok {
-						if rs, ok := provider.ResourceSchemas[comp.Source]; ok {
-							resourceSchema = rs
-							found = true
-							break
-						}
-					}
-				}
-
-				if !found {
-					continue
-				}
-
-				// Start component configuration block
-				configContent.WriteString(fmt.Sprintf("  # %s Configuration\n", compName))
-				configContent.WriteString(fmt.Sprintf("  %s = {\n", compName))
-
-				// Add required attributes with default values
-				for name, attr := range resourceSchema.Block.Attributes {
-					if attr.Required && !shouldSkipVariable(name, comp.Source) {
-						defaultValue := getDefaultValueForType(attr.Type, name, envName)
-						configContent.WriteString(fmt.Sprintf("    %s = %s\n", name, defaultValue))
-					}
-				}
+			secrets, err := environmentSecrets(env, mainConfig)
+			if err != nil {
+				return fmt.Errorf("environment %s: %w", envName, err)
+			}
 
-				// Add block types (nested configurations)
-				for blockName, blockType := range resourceSchema.Block.BlockTypes {
-					configContent.WriteString(fmt.Sprintf("    %s = {\n", blockName))
-					for attrName, attr := range blockType.Block.Attributes {
-						if attr.Required {
-							defaultValue := getDefaultValueForType(attr.Type, attrName, envName)
-							configContent.WriteString(fmt.Sprintf("      %s = %s\n", attrName, defaultValue))
-						}
-					}
-					configContent.WriteString("    }\n")
+			// Add the documented schema of the components of the stack,
+			// with the secrets resolved from their references
+			var compNames []string
+			for compName, comp := range mainConfig.Stack.Components {
+				if comp.Provider != "" {
+					compNames = append(compNames, compName)
 				}
-
-				configContent.WriteString("  }\n\n")
+			}
+			sort.Strings(compNames)
+			for _, compName := range compNames {
+				comp := mainConfig.Stack.Components[compName]
+				envconfig.For(comp).Skeleton(&configContent, compName, comp.Source, envName, secrets[compName])
 			}
 
 			configContent.WriteString("}")
@@ -347,89 +368,37 @@ func generateEnvironmentConfigs(tgsConfig *config.TGSConfig, infraPath string) e
 	return nil
 }
 
-// Helper function to get default value based on type and environment
-func getDefaultValueForType(attrType interface{}, name string, env string) string {
-	switch t := attrType.(type) {
-	case string:
-		switch t {
-		case "string":
-			// Special cases for known attributes
-			switch name {
-			case "sku_name":
-				if strings.Contains(env, "redis") || strings.Contains(env, "cache") {
-					return fmt.Sprintf(`"%s"`, getDefaultRedisSkuForEnvironment(env))
-				}
-				return fmt.Sprintf(`"%s"`, getDefaultSkuForEnvironment(env))
-			case "family":
-				return `"C"`
-			case "tier":
-				return `"Standard"`
-			case "os_type":
-				return `"Linux"`
-			case "service_plan_id":
-				return `"" # Required: Set this in environment config`
-			default:
-				return `""`
-			}
-		case "number":
-			return "0"
-		case "bool":
-			return "false"
-		case "list":
-			return "[]"
-		case "map":
-			return "{}"
-		default:
-			return "null"
+// environmentSecrets returns the Terragrunt expressions of the secrets of an
+// environment by component and attribute. Secrets of components the stack
+// doesn't define are skipped with a warning.
+func environmentSecrets(env config.Environment, mainConfig *config.MainConfig) (map[string]map[string]string, error) {
+	secrets := make(map[string]map[string]string)
+	for key, value := range env.Secrets {
+		compName, attribute, err := config.SecretKey(key)
+		if err != nil {
+			return nil, err
 		}
-	case map[string]interface{}:
-		if t["type"] == "string" {
-			return `""`
+		secret, err := config.ParseSecret(value)
+		if err != nil {
+			return nil, fmt.Errorf("secrets.%s: %w", key, err)
 		}
-		return "null"
-	default:
-		return "null"
-	}
-}
-
-// Helper function to determine default SKU based on environment
-func getDefaultSkuForEnvironment(env string) string {
-	switch env {
-	case "prod":
-		return "P1v2"
-	case "stage":
-		return "P1v2"
-	case "test":
-		return "S1"
-	case "dev":
-		return "B1"
-	default:
-		return "B1"
-	}
-}
-
-// Helper function to determine default Redis SKU based on environment
-func getDefaultRedisSkuForEnvironment(env string) string {
-	switch env {
-	case "prod":
-		return "Premium"
-	case "stage":
-		return "Standard"
-	case "test":
-		return "Standard"
-	case "dev":
-		return "Basic"
-	default:
-		return "Basic"
+		if _, ok := mainConfig.Stack.Components[compName]; !ok {
+			logger.Warning("Secret %s of environment %s references a component the stack doesn't define", key, env.Name)
+			continue
+		}
+		if secrets[compName] == nil {
+			secrets[compName] = make(map[string]string)
+		}
+		secrets[compName][attribute] = secret.Expression(workspace.Prefix())
 	}
+	return secrets, nil
 }
 
 func generateRootHCL(tgsConfig *config.TGSConfig, infraPath string) error {
 	logger.Info("Generating root.hcl configuration")
 
 	// Ensure the .infrastructure directory exists
-	baseDir := filepath.Base(infraPath)
-	if err := os.MkdirAll(baseDir, 0755); err != nil {
+	if err := project.MkdirAll(infraPath, 0755); err != nil {
 		return fmt.Errorf("failed to create infrastructure directory: %w", err)
 	}
 
@@ -440,19 +409,43 @@ func generateRootHCL(tgsConfig *config.TGSConfig, infraPath string) error {
 	}
 
 	// Render the root.hcl template
-	rootHCL, err := renderer.RenderTemplate("environment/root.hcl.tmpl", nil)
+	rootData := templates.RootData{
+		StacksLayout: tgsConfig.Layout == config.LayoutStacks,
+		Options:      tgsConfig.Root,
+	}
+	rootHCL, err := renderer.RenderTemplate("environment/root.hcl.tmpl", rootData)
 	if err != nil {
 		return fmt.Errorf("failed to render root.hcl template: %w", err)
 	}
 
-	return createFile(filepath.Join(baseDir, "root.hcl"), rootHCL)
+	return createFile(filepath.Join(infraPath, "root.hcl"), rootHCL)
+}
+
+// generateToolVersions writes the version files pinning Terraform and
+// Terragrunt for tfenv/tgenv or asdf/mise next to root.hcl
+func generateToolVersions(tooling config.ToolingConfig, infraPath string) error {
+	switch tooling.VersionFiles {
+	case config.VersionFilesTfenv:
+		if err := createFile(filepath.Join(infraPath, ".terraform-version"), tooling.Terraform+"\n"); err != nil {
+			return fmt.Errorf("failed to write .terraform-version: %w", err)
+		}
+		if err := createFile(filepath.Join(infraPath, ".terragrunt-version"), tooling.Terragrunt+"\n"); err != nil {
+			return fmt.Errorf("failed to write .terragrunt-version: %w", err)
+		}
+	case config.VersionFilesAsdf:
+		content := fmt.Sprintf("terraform %s\nterragrunt %s\n", tooling.Terraform, tooling.Terragrunt)
+		if err := createFile(filepath.Join(infraPath, ".tool-versions"), content); err != nil {
+			return fmt.Errorf("failed to write .tool-versions: %w", err)
+		}
+	}
+	return nil
 }
 
 // generateEnvironmentConfig creates environment-specific configuration files
 func generateEnvironmentConfig(infraPath string, tgsConfig *config.TGSConfig, stackName string) error {
 	// Create environments directory under the stack's config folder
 	environmentsDir := filepath.Join(infraPath, "config", stackName, "environments")
-	if err := os.MkdirAll(environmentsDir, 0755); err != nil {
+	if err := project.MkdirAll(environmentsDir, 0755); err != nil {
 		return fmt.Errorf("failed to create environments directory: %w", err)
 	}
 
@@ -466,7 +459,7 @@ func generateEnvironmentConfig(infraPath string, tgsConfig *config.TGSConfig, st
 	for subName, sub := range tgsConfig.Subscriptions {
 		// Create subscription directory
 		subDir := filepath.Join(environmentsDir, subName)
-		if err := os.MkdirAll(subDir, 0755); err != nil {
+		if err := project.MkdirAll(subDir, 0755); err != nil {
 			return fmt.Errorf("failed to create subscription directory: %w", err)
 		}
 
@@ -0,0 +1,175 @@
+package scaffold
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/templates"
+)
+
+// fullGeneration makes generate regenerate every subtree
+var fullGeneration bool
+
+// SetFullGeneration makes Generate regenerate the whole tree instead of only
+// the components and environments whose configuration changed
+func SetFullGeneration(enabled bool) {
+	fullGeneration = enabled
+}
+
+// fingerprintSet holds the fingerprints of the subtrees of a generated tree:
+// the ones recorded by the previous run and the ones of the current run
+type fingerprintSet struct {
+	// global covers the inputs of every subtree: tgs.yaml, the template set
+	// and the tgs build
+	global   string
+	previous map[string]string
+	current  map[string]string
+	skipped  map[string]int
+}
+
+// fingerprints holds the fingerprints of the current run, written to the
+// manifest
+var fingerprints = &fingerprintSet{current: make(map[string]string), skipped: make(map[string]int)}
+
+// newFingerprints fingerprints tgs.yaml and the template set of a run and
+// reads the fingerprints of the previous run from the manifest of infraPath.
+// Trees without a manifest, or generated with SetFullGeneration, have none.
+func newFingerprints(tgsConfig *config.TGSConfig, infraPath string) (*fingerprintSet, error) {
+	templateSet, err := templates.Fingerprint()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fingerprint templates: %w", err)
+	}
+
+	set := &fingerprintSet{current: make(map[string]string), skipped: make(map[string]int)}
+	tgsSum, err := set.record("tgs.yaml", tgsConfig)
+	if err != nil {
+		return nil, err
+	}
+	templatesSum, err := set.record("templates", generatorVersion(), templateSet)
+	if err != nil {
+		return nil, err
+	}
+	set.global = tgsSum + templatesSum
+
+	if fullGeneration {
+		return set, nil
+	}
+	manifest, err := readManifest(infraPath)
+	if err != nil {
+		return nil, err
+	}
+	if manifest != nil {
+		set.previous = manifest.Fingerprints
+	}
+	return set, nil
+}
+
+// record records the fingerprint of key computed from inputs
+func (f *fingerprintSet) record(key string, inputs ...interface{}) (string, error) {
+	sum, err := fingerprint(append([]interface{}{f.global, key}, inputs...)...)
+	if err != nil {
+		return "", fmt.Errorf("failed to fingerprint %s: %w", key, err)
+	}
+	f.current[key] = sum
+	return sum, nil
+}
+
+// unchanged records the fingerprint of the subtree key generated from
+// inputs and reports whether the previous run generated it from the same
+// inputs. path must exist for the subtree to count as unchanged.
+func (f *fingerprintSet) unchanged(key, path string, inputs ...interface{}) (bool, error) {
+	sum, err := f.record(key, inputs...)
+	if err != nil || f.previous[key] != sum {
+		return false, err
+	}
+	if _, err := project.Stat(path); err != nil {
+		return false, nil
+	}
+	f.skipped[strings.SplitN(key, ":", 2)[0]]++
+	return true, nil
+}
+
+// fingerprint hashes the JSON encoding of values
+func fingerprint(values ...interface{}) (string, error) {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// generatorVersion identifies the tgs build, so upgrading tgs regenerates
+// the tree
+func generatorVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	version := info.Main.Version
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" || setting.Key == "vcs.modified" {
+			version += " " + setting.Value
+		}
+	}
+	return version
+}
+
+// componentInputs returns the configuration the generated files of a
+// component depend on: the component, the components it depends on, the
+// external dependencies of the stack and its placements in the architecture
+func componentInputs(mainConfig *config.MainConfig, compName string) []interface{} {
+	comp := mainConfig.Stack.Components[compName]
+	deps := make(map[string]config.Component)
+	for _, dep := range comp.Deps {
+		name := dep
+		if parts := strings.Split(dep, "."); len(parts) >= 2 {
+			name = parts[1]
+		}
+		if depComp, ok := mainConfig.Stack.Components[name]; ok {
+			deps[name] = depComp
+		}
+	}
+
+	placements := make(map[string][]config.RegionComponent)
+	for region, regionComps := range mainConfig.Stack.Architecture.Regions {
+		for _, regionComp := range regionComps {
+			if regionComp.Component == compName {
+				placements[region] = append(placements[region], regionComp)
+			}
+		}
+	}
+	return []interface{}{comp, deps, mainConfig.Stack.ExternalDependencies, placements}
+}
+
+// environmentInputs returns the configuration the generated files of an
+// environment in a region depend on: the placed components and their
+// configuration and the paired region, or the whole stack for the stacks
+// layout
+func environmentInputs(tgsConfig *config.TGSConfig, mainConfig *config.MainConfig, region string, components []config.RegionComponent) []interface{} {
+	if tgsConfig.Layout == config.LayoutStacks {
+		return []interface{}{components, mainConfig.Stack}
+	}
+	placed := make(map[string]config.Component)
+	for _, comp := range components {
+		placed[comp.Component] = mainConfig.Stack.Components[comp.Component]
+	}
+	return []interface{}{components, placed, mainConfig.Stack.Architecture.PairedRegions[region]}
+}
+
+// componentKey names the fingerprint of a component under _components
+func componentKey(stackName, compName string) string {
+	return "component:" + stackName + "/" + compName
+}
+
+// environmentKey names the fingerprint of an environment in a region
+func environmentKey(stackName, subscription, region, envName string) string {
+	return "environment:" + filepath.ToSlash(filepath.Join(stackName, subscription, region, envName))
+}
@@ -0,0 +1,46 @@
+package scaffold
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+)
+
+// runHooks runs the commands of a generate hook in order, stopping at the
+// first failure. Commands run through the shell from the project directory
+// with TGS_OUTPUT_DIR set to the generated tree.
+func runHooks(stage string, commands []string, infraPath string) error {
+	for _, command := range commands {
+		logger.Info("Running %s hook: %s", stage, command)
+
+		cmd := hookCommand(command)
+		cmd.Env = append(os.Environ(), "TGS_OUTPUT_DIR="+infraPath)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s hook %q failed: %w", stage, command, err)
+		}
+	}
+	return nil
+}
+
+// hookCommand runs command through cmd on Windows and sh elsewhere
+func hookCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return project.Command("cmd", "/C", command)
+	}
+	return project.Command("sh", "-c", command)
+}
+
+// appendExtraHCL appends the extra_hcl of a component to its component.hcl
+func appendExtraHCL(hcl, extra string) string {
+	if strings.TrimSpace(extra) == "" {
+		return hcl
+	}
+	return strings.TrimRight(hcl, "\n") + "\n\n# Custom HCL from the stack file\n" + strings.TrimRight(extra, "\n") + "\n"
+}
@@ -0,0 +1,247 @@
+package scaffold
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+)
+
+// makefileHeader marks Makefiles generated by tgs, which are safe to overwrite
+const makefileHeader = "# Generated by tgs from .tgs/tgs.yaml. Run tgs generate to update it."
+
+// tasksScript is the PowerShell alternative of the Makefile
+const tasksScript = "tasks.ps1"
+
+// makefileCommands are the terragrunt run-all commands exposed as targets
+var makefileCommands = []string{"validate", "plan", "apply"}
+
+// makefileTarget is a make target running terragrunt run-all for an
+// environment, or a region of an environment
+type makefileTarget struct {
+	Name       string
+	WorkingDir string
+	Excludes   []string
+	// StackDirs are the terragrunt.stack.hcl folders whose units are
+	// generated before running, in the stacks layout
+	StackDirs []string
+}
+
+// generateMakefile writes a Makefile at the repository root wrapping
+// terragrunt run-all for every environment and region, and tasks.ps1 with the
+// same targets. A Makefile that wasn't generated by tgs is left alone and the
+// targets are written to tgs.mk.
+func generateMakefile(tgsConfig *config.TGSConfig) error {
+	targets, err := makefileTargets(tgsConfig)
+	if err != nil {
+		return err
+	}
+
+	path := "Makefile"
+	if data, err := project.ReadFile(path); err == nil && !strings.HasPrefix(string(data), makefileHeader) {
+		path = "tgs.mk"
+		logger.Warning("Makefile exists and wasn't generated by tgs, writing targets to %s; add 'include %s' to use them", path, path)
+	}
+
+	if err := createFile(path, renderMakefile(targets)); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	logger.Success("Generated %s", path)
+
+	// The same targets for Windows shells without make
+	if data, err := project.ReadFile(tasksScript); err == nil && !strings.HasPrefix(string(data), makefileHeader) {
+		logger.Warning("%s exists and wasn't generated by tgs, skipping it", tasksScript)
+		return nil
+	}
+	if err := createFile(tasksScript, renderTasksScript(targets)); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tasksScript, err)
+	}
+	logger.Success("Generated %s", tasksScript)
+	return nil
+}
+
+// makefileTargets returns a target per environment running every region of
+// the environment in one run-all, so cross-region dependencies are resolved,
+// plus a target per environment and region
+func makefileTargets(tgsConfig *config.TGSConfig) ([]makefileTarget, error) {
+	var subs []string
+	for sub := range tgsConfig.Subscriptions {
+		subs = append(subs, sub)
+	}
+	sort.Strings(subs)
+
+	// Environment names used by more than one subscription are prefixed
+	// with the subscription to keep targets unique
+	envCount := make(map[string]int)
+	for _, sub := range subs {
+		for _, env := range tgsConfig.Subscriptions[sub].Environments {
+			envCount[env.Name]++
+		}
+	}
+
+	var targets []makefileTarget
+	for _, sub := range subs {
+		envs := tgsConfig.Subscriptions[sub].Environments
+		for _, env := range envs {
+			stackName := stackOf(env)
+			mainConfig, err := ReadMainConfig(stackName)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read stack config %s: %w", stackName, err)
+			}
+
+			var regions []string
+			for region := range mainConfig.Stack.Architecture.Regions {
+				regions = append(regions, region)
+			}
+			sort.Strings(regions)
+
+			name := env.Name
+			if envCount[env.Name] > 1 {
+				name = sub + "-" + env.Name
+			}
+			subDir := filepath.ToSlash(output.Path("architecture", stackName, sub))
+
+			// Other environments of the subscription sharing the stack's
+			// architecture folder are excluded from the environment run
+			target := makefileTarget{Name: name, WorkingDir: subDir}
+			for _, region := range regions {
+				if tgsConfig.Layout == config.LayoutStacks {
+					target.StackDirs = append(target.StackDirs, fmt.Sprintf("%s/%s/%s", subDir, region, env.Name))
+				}
+				for _, other := range envs {
+					if other.Name != env.Name && stackOf(other) == stackName {
+						target.Excludes = append(target.Excludes, fmt.Sprintf("%s/%s/**", region, other.Name))
+					}
+				}
+			}
+			targets = append(targets, target)
+
+			for _, region := range regions {
+				regionTarget := makefileTarget{
+					Name:       name + "-" + region,
+					WorkingDir: fmt.Sprintf("%s/%s/%s", subDir, region, env.Name),
+				}
+				if tgsConfig.Layout == config.LayoutStacks {
+					regionTarget.StackDirs = []string{regionTarget.WorkingDir}
+				}
+				targets = append(targets, regionTarget)
+			}
+		}
+	}
+	return targets, nil
+}
+
+// stackOf returns the stack deployed by an environment
+func stackOf(env config.Environment) string {
+	if env.Stack != "" {
+		return env.Stack
+	}
+	return "main"
+}
+
+// renderMakefile renders the Makefile of the targets
+func renderMakefile(targets []makefileTarget) string {
+	var b strings.Builder
+
+	b.WriteString(makefileHeader + `
+#
+# Wraps terragrunt run-all for each environment and region so local runs
+# match the pipelines. Pass extra flags with TG_FLAGS, e.g.
+#   make plan-dev TG_FLAGS=--terragrunt-non-interactive
+
+TERRAGRUNT ?= terragrunt
+TG_FLAGS ?=
+
+.PHONY: help
+help:
+	@echo "Targets:"
+`)
+	for _, target := range targets {
+		for _, command := range makefileCommands {
+			b.WriteString(fmt.Sprintf("\t@echo \"  %s-%s\"\n", command, target.Name))
+		}
+	}
+
+	for _, target := range targets {
+		b.WriteString("\n")
+		for _, command := range makefileCommands {
+			name := command + "-" + target.Name
+			b.WriteString(fmt.Sprintf(".PHONY: %s\n%s:\n", name, name))
+			for _, dir := range target.StackDirs {
+				b.WriteString(fmt.Sprintf("\t$(TERRAGRUNT) stack generate --terragrunt-working-dir %s\n", dir))
+			}
+			b.WriteString(fmt.Sprintf("\t$(TERRAGRUNT) run-all %s --terragrunt-working-dir %s", command, target.WorkingDir))
+			for _, exclude := range target.Excludes {
+				b.WriteString(fmt.Sprintf(" --terragrunt-exclude-dir '%s'", exclude))
+			}
+			b.WriteString(" $(TG_FLAGS)\n")
+		}
+	}
+
+	return b.String()
+}
+
+// renderTasksScript renders tasks.ps1, running the targets of the Makefile
+// with PowerShell
+func renderTasksScript(targets []makefileTarget) string {
+	var b strings.Builder
+
+	b.WriteString(makefileHeader + `
+#
+# Wraps terragrunt run-all for each environment and region like the Makefile,
+# for Windows shells without make. Extra arguments are passed to terragrunt,
+# e.g.
+#   ./tasks.ps1 plan-dev --terragrunt-non-interactive
+param(
+    [Parameter(Position = 0)]
+    [string]$Target = 'help',
+    [Parameter(ValueFromRemainingArguments = $true)]
+    [string[]]$TgFlags = @()
+)
+
+$ErrorActionPreference = 'Stop'
+$Terragrunt = if ($env:TERRAGRUNT) { $env:TERRAGRUNT } else { 'terragrunt' }
+
+function Invoke-Terragrunt {
+    & $Terragrunt @args
+    if ($LASTEXITCODE -ne 0) { exit $LASTEXITCODE }
+}
+
+switch ($Target) {
+`)
+	for _, target := range targets {
+		for _, command := range makefileCommands {
+			b.WriteString(fmt.Sprintf("    '%s-%s' {\n", command, target.Name))
+			for _, dir := range target.StackDirs {
+				b.WriteString(fmt.Sprintf("        Invoke-Terragrunt stack generate --terragrunt-working-dir %s\n", powerShellQuote(dir)))
+			}
+			b.WriteString(fmt.Sprintf("        Invoke-Terragrunt run-all %s --terragrunt-working-dir %s", command, powerShellQuote(target.WorkingDir)))
+			for _, exclude := range target.Excludes {
+				b.WriteString(" --terragrunt-exclude-dir " + powerShellQuote(exclude))
+			}
+			b.WriteString(" @TgFlags\n    }\n")
+		}
+	}
+
+	b.WriteString(`    default {
+        if ($Target -ne 'help') {
+            Write-Error "Unknown target $Target" -ErrorAction Continue
+        }
+        Write-Output 'Targets:'
+`)
+	for _, target := range targets {
+		for _, command := range makefileCommands {
+			b.WriteString(fmt.Sprintf("        Write-Output '  %s-%s'\n", command, target.Name))
+		}
+	}
+	b.WriteString(`        if ($Target -ne 'help') { exit 1 }
+    }
+}
+`)
+	return b.String()
+}
@@ -0,0 +1,419 @@
+package scaffold
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"gopkg.in/yaml.v3"
+)
+
+// manifestFile records the stack versions the tree was generated from. It's
+// hidden so plan doesn't report it as unmanaged.
+const manifestFile = ".tgs-manifest.yaml"
+
+// migrationsDir holds the state migration scripts written by generate
+const migrationsDir = ".tgs/migrations"
+
+// Manifest describes what a generated tree was generated from
+type Manifest struct {
+	Stacks  map[string]ManifestStack `yaml:"stacks"`
+	LastRun *ManifestRun             `yaml:"last_run,omitempty"`
+	// Fingerprints hash the configuration each component and environment
+	// was generated from, so the next run can skip the unchanged ones
+	Fingerprints map[string]string `yaml:"fingerprints,omitempty"`
+}
+
+// ManifestRun records the files the last tgs generate wrote and how long it
+// took
+type ManifestRun struct {
+	Created   int    `yaml:"created"`
+	Updated   int    `yaml:"updated"`
+	Unchanged int    `yaml:"unchanged"`
+	Duration  string `yaml:"duration"`
+}
+
+// ManifestStack records a stack of a generated tree
+type ManifestStack struct {
+	Version string `yaml:"version"`
+}
+
+// readManifest reads the manifest of a generated tree, returning nil when
+// the tree has none
+func readManifest(infraPath string) (*Manifest, error) {
+	data, err := project.ReadFile(filepath.Join(infraPath, manifestFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var manifest Manifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// writeManifest records the versions of the stacks deployed by the
+// environments, the files the run wrote and the fingerprints of its subtrees
+func writeManifest(tgsConfig *config.TGSConfig, infraPath string, run *ManifestRun) error {
+	manifest := Manifest{Stacks: make(map[string]ManifestStack), LastRun: run, Fingerprints: fingerprints.current}
+	for _, stackName := range tgsConfig.UsedStacks() {
+		mainConfig, err := ReadMainConfig(stackName)
+		if err != nil {
+			return fmt.Errorf("failed to read stack config %s: %w", stackName, err)
+		}
+		manifest.Stacks[stackName] = ManifestStack{Version: mainConfig.Stack.Version}
+	}
+
+	data, err := yaml.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	return createFile(filepath.Join(infraPath, manifestFile), "# Generated by tgs, do not edit\n"+string(data))
+}
+
+// pendingMigration is a migration of a stack not yet applied to the tree
+type pendingMigration struct {
+	Stack     string
+	From      string
+	Migration config.Migration
+}
+
+// pendingMigrations returns the migrations of stacks whose version was bumped
+// since the tree was generated, in version order. Trees without a manifest
+// have no pending migrations.
+func pendingMigrations(tgsConfig *config.TGSConfig, infraPath string) ([]pendingMigration, error) {
+	manifest, err := readManifest(infraPath)
+	if err != nil || manifest == nil {
+		return nil, err
+	}
+
+	var pending []pendingMigration
+	for _, stackName := range tgsConfig.UsedStacks() {
+		previous := manifest.Stacks[stackName].Version
+		if previous == "" {
+			continue
+		}
+		mainConfig, err := ReadMainConfig(stackName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stack config %s: %w", stackName, err)
+		}
+		if config.CompareVersions(previous, mainConfig.Stack.Version) >= 0 {
+			continue
+		}
+
+		var migrations []config.Migration
+		for _, migration := range mainConfig.Stack.Migrations {
+			if config.CompareVersions(migration.Version, previous) > 0 && config.CompareVersions(migration.Version, mainConfig.Stack.Version) <= 0 {
+				migrations = append(migrations, migration)
+			}
+		}
+		sort.SliceStable(migrations, func(i, j int) bool {
+			return config.CompareVersions(migrations[i].Version, migrations[j].Version) < 0
+		})
+		for _, migration := range migrations {
+			pending = append(pending, pendingMigration{Stack: stackName, From: previous, Migration: migration})
+		}
+	}
+	return pending, nil
+}
+
+// migrate runs the migrations of stacks bumped since infraPath was generated
+func migrate(infraPath string) error {
+	tgsConfig, err := config.ReadTGSConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read TGS config: %w", err)
+	}
+
+	pending, err := pendingMigrations(tgsConfig, infraPath)
+	if err != nil {
+		return err
+	}
+	return runMigrations(tgsConfig, infraPath, pending)
+}
+
+// folderMove is a generated folder moved by a migration, relative to the
+// infrastructure folder
+type folderMove struct {
+	From string
+	To   string
+}
+
+// runMigrations moves the folders of the pending migrations so
+// configuration kept next to generated files survives, and writes a script
+// per migration copying the Terraform state of every moved component and
+// renaming resource addresses
+func runMigrations(tgsConfig *config.TGSConfig, infraPath string, pending []pendingMigration) error {
+	for _, p := range pending {
+		logger.Info("Running migration %s of stack %s", p.Migration.Version, p.Stack)
+
+		moves, err := migrationMoves(infraPath, p.Stack, p.Migration)
+		if err != nil {
+			return fmt.Errorf("failed to plan migration %s of stack %s: %w", p.Migration.Version, p.Stack, err)
+		}
+
+		stateCopies, err := moveFolders(infraPath, moves)
+		if err != nil {
+			return err
+		}
+
+		if len(stateCopies) == 0 && len(p.Migration.StateMoves) == 0 {
+			continue
+		}
+
+		migration, err := migrationScript(tgsConfig, infraPath, p, stateCopies)
+		if err != nil {
+			return err
+		}
+		if err := writeMigrationScript(filepath.Join(migrationsDir, fmt.Sprintf("%s-%s.sh", p.Stack, p.Migration.Version)), migration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveFolders moves generated folders within infraPath, returning the
+// terragrunt leaves they contained with their new locations
+func moveFolders(infraPath string, moves []folderMove) ([]folderMove, error) {
+	// Leaves are collected before moving so their state keys can be copied
+	var leaves []folderMove
+	for _, move := range moves {
+		if strings.HasPrefix(move.From, "architecture/") {
+			leaves = append(leaves, leafMoves(infraPath, move)...)
+		}
+	}
+
+	for _, move := range moves {
+		from := filepath.Join(infraPath, filepath.FromSlash(move.From))
+		to := filepath.Join(infraPath, filepath.FromSlash(move.To))
+		if _, err := project.Stat(to); err == nil {
+			return nil, fmt.Errorf("failed to move %s to %s: destination already exists", move.From, move.To)
+		}
+		if err := project.MkdirAll(filepath.Dir(to), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", filepath.Dir(move.To), err)
+		}
+		if err := project.Rename(from, to); err != nil {
+			return nil, fmt.Errorf("failed to move %s to %s: %w", move.From, move.To, err)
+		}
+		logger.Info("Moved %s to %s", move.From, move.To)
+	}
+	return leaves, nil
+}
+
+// writeMigrationScript writes a state migration script to path, an
+// executable bash script, and its PowerShell alternative next to it
+func writeMigrationScript(path string, migration script) error {
+	if err := createFile(path, migration.Bash()); err != nil {
+		return fmt.Errorf("failed to write migration script: %w", err)
+	}
+	if err := project.Chmod(path, 0755); err != nil {
+		return fmt.Errorf("failed to make migration script executable: %w", err)
+	}
+	powerShellPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".ps1"
+	if err := createFile(powerShellPath, migration.PowerShell()); err != nil {
+		return fmt.Errorf("failed to write migration script: %w", err)
+	}
+	logger.Warning("Review and run %s (%s on Windows) to migrate the Terraform state before planning", path, filepath.Base(powerShellPath))
+	return nil
+}
+
+// migrationMoves returns the folders moved by a migration that exist on disk
+func migrationMoves(infraPath, stackName string, migration config.Migration) ([]folderMove, error) {
+	var moves []folderMove
+	glob := func(from, to func(parts []string) string, pattern ...string) error {
+		matches, err := project.Glob(filepath.Join(append([]string{infraPath}, pattern...)...))
+		if err != nil {
+			return err
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			rel, err := filepath.Rel(infraPath, match)
+			if err != nil {
+				return err
+			}
+			parts := strings.Split(filepath.ToSlash(rel), "/")
+			moves = append(moves, folderMove{From: from(parts), To: to(parts)})
+		}
+		return nil
+	}
+	join := func(parts []string) string { return strings.Join(parts, "/") }
+
+	var renames []string
+	for from := range migration.Renames {
+		renames = append(renames, from)
+	}
+	sort.Strings(renames)
+
+	for _, oldName := range renames {
+		newName := migration.Renames[oldName]
+		rename := func(index int, name string) func([]string) string {
+			return func(parts []string) string {
+				moved := append([]string{}, parts...)
+				moved[index] = name
+				return join(moved)
+			}
+		}
+
+		// architecture/<stack>/<sub>/<region>/<env>/<component>
+		if err := glob(join, rename(5, newName), "architecture", stackName, "*", "*", "*", oldName); err != nil {
+			return nil, err
+		}
+		for _, dir := range []string{"_components", "_units"} {
+			if err := glob(join, rename(2, newName), dir, stackName, oldName); err != nil {
+				return nil, err
+			}
+		}
+		for _, prefix := range []string{"app_settings_", "policy_files_"} {
+			if err := glob(join, rename(2, prefix+newName), "config", stackName, prefix+oldName); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, move := range migration.Moves {
+		from := strings.Split(move.From, ".")
+		to := strings.Split(move.To, ".")
+		if len(from) < 2 || len(to) < 2 {
+			return nil, fmt.Errorf("invalid move %s -> %s", move.From, move.To)
+		}
+
+		pattern := []string{"architecture", stackName, "*", from[0], "*", from[1]}
+		if len(from) > 2 {
+			pattern = append(pattern, from[2])
+		}
+		target := func(parts []string) string {
+			// Keep the subscription and environment of the moved folder
+			moved := []string{parts[0], parts[1], parts[2], to[0], parts[4], to[1]}
+			if len(to) > 2 {
+				moved = append(moved, to[2])
+			}
+			return join(moved)
+		}
+		if err := glob(join, target, pattern...); err != nil {
+			return nil, err
+		}
+	}
+
+	return moves, nil
+}
+
+// leafMoves returns the terragrunt leaves below a moved architecture folder
+// with their new locations
+func leafMoves(infraPath string, move folderMove) []folderMove {
+	var leaves []folderMove
+	root := filepath.Join(infraPath, filepath.FromSlash(move.From))
+	project.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if info.Name() != "terragrunt.hcl" {
+			return nil
+		}
+		rel, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		leaf := folderMove{From: move.From, To: move.To}
+		if rel != "." {
+			leaf.From += "/" + rel
+			leaf.To += "/" + rel
+		}
+		leaves = append(leaves, leaf)
+		return nil
+	})
+	return leaves
+}
+
+// migrationScript returns the script copying the remote state of moved
+// leaves to their new keys and running the state moves of a migration
+func migrationScript(tgsConfig *config.TGSConfig, infraPath string, p pendingMigration, stateCopies []folderMove) (script, error) {
+	infraDir := filepath.Base(infraPath)
+	if cwd, err := project.Abs("."); err == nil {
+		if rel, err := filepath.Rel(cwd, infraPath); err == nil {
+			infraDir = filepath.ToSlash(rel)
+		}
+	}
+
+	migration := script{Header: []string{
+		fmt.Sprintf("Migrates the Terraform state of stack %s from %s to %s. Generated by tgs.", p.Stack, p.From, p.Migration.Version),
+		"Review, then run once from the repository root before planning. Copied",
+		"state is left at its previous key; delete it once the new one is verified.",
+	}}
+
+	mainConfig, err := ReadMainConfig(p.Stack)
+	if err != nil {
+		return script{}, fmt.Errorf("failed to read stack config %s: %w", p.Stack, err)
+	}
+	migration.Steps = stateCopySteps(tgsConfig, mainConfig.Stack.Components, stateCopies)
+
+	var leaves []string
+	for _, stateMove := range p.Migration.StateMoves {
+		matches, err := project.Glob(filepath.Join(infraPath, "architecture", p.Stack, "*", "*", "*", stateMove.Component))
+		if err != nil {
+			return script{}, fmt.Errorf("failed to find instances of %s: %w", stateMove.Component, err)
+		}
+		sort.Strings(matches)
+		leaves = leaves[:0]
+		for _, match := range matches {
+			rel, _ := filepath.Rel(infraPath, match)
+			for _, leaf := range leafMoves(infraPath, folderMove{From: filepath.ToSlash(rel), To: filepath.ToSlash(rel)}) {
+				leaves = append(leaves, leaf.To)
+			}
+		}
+
+		for i, leaf := range leaves {
+			step := scriptStep{Dir: infraDir + "/" + leaf, Args: []string{"terragrunt", "state", "mv", stateMove.From, stateMove.To}}
+			if i == 0 {
+				step.Comment = fmt.Sprintf("%s: %s -> %s", stateMove.Component, stateMove.From, stateMove.To)
+			}
+			migration.Steps = append(migration.Steps, step)
+		}
+	}
+
+	return migration, nil
+}
+
+// stateCopySteps returns the commands copying the state blobs of moved
+// leaves to their new keys. A renamed component keeps its state_key_prefix,
+// so the name missing from components uses the prefix of the other.
+func stateCopySteps(tgsConfig *config.TGSConfig, components map[string]config.Component, leaves []folderMove) []scriptStep {
+	container := strings.ToLower(tgsConfig.Name)
+
+	var steps []scriptStep
+	for _, leaf := range leaves {
+		// architecture/<stack>/<sub>/<region>/<env>/<component>/...
+		from := strings.Split(leaf.From, "/")
+		to := strings.Split(leaf.To, "/")
+		fromComp, ok := components[from[5]]
+		if !ok {
+			fromComp = components[to[5]]
+		}
+		toComp, ok := components[to[5]]
+		if !ok {
+			toComp = fromComp
+		}
+		remoteState := tgsConfig.Subscriptions[from[2]].RemoteState
+		step := scriptStep{Args: []string{
+			"az", "storage", "blob", "copy", "start", "--auth-mode", "login", "--account-name", remoteState.Name,
+			"--source-container", container, "--source-blob", remoteState.StateKey(fromComp.StateKeyPrefix, leaf.From),
+			"--destination-container", container, "--destination-blob", remoteState.StateKey(toComp.StateKeyPrefix, leaf.To),
+		}}
+		if len(steps) == 0 {
+			step.Comment = "Copy the state of moved components to their new keys"
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
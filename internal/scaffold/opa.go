@@ -0,0 +1,123 @@
+package scaffold
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/naming"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/templates"
+)
+
+// opaPolicyFile is the policy written into the conftest policy folder
+const opaPolicyFile = "tgs.rego"
+
+// requiredTags are the tags component.hcl and config/global.hcl set on every
+// resource
+var requiredTags = []string{"Component", "Environment", "ManagedBy", "Project", "Region", "Stack"}
+
+// generateOPAPolicies writes the Rego policies enforcing the naming convention
+// and required tags into the conftest policy folder, when conftest is one of
+// the security tools
+func generateOPAPolicies(tgsConfig *config.TGSConfig) error {
+	enabled := false
+	for _, tool := range tgsConfig.Security.Tools {
+		if tool == config.SecurityToolConftest {
+			enabled = true
+		}
+	}
+	if !enabled {
+		return nil
+	}
+
+	data, err := opaData(tgsConfig)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(tgsConfig.Security.PolicyDir(), opaPolicyFile)
+	if err := templates.Render("opa/tgs.rego.tmpl", path, data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	logger.Success("Generated %s", path)
+	return nil
+}
+
+// opaData collects the required tags of the project and the name prefixes
+// and resource types of every stack
+func opaData(tgsConfig *config.TGSConfig) (*templates.OPAData, error) {
+	stacks := make(map[string]bool)
+	for _, sub := range tgsConfig.Subscriptions {
+		for _, env := range sub.Environments {
+			stacks[stackOf(env)] = true
+		}
+	}
+
+	prefixes := naming.NewPrefixes(tgsConfig.Prefixes)
+	data := &templates.OPAData{RequiredTags: append([]string{}, requiredTags...), NamePrefixes: make(map[string][]string)}
+	for _, tag := range tgsConfig.RequiredTags {
+		if !hasString(data.RequiredTags, tag) {
+			data.RequiredTags = append(data.RequiredTags, tag)
+		}
+	}
+	sort.Strings(data.RequiredTags)
+	types := make(map[string]bool)
+	for stackName := range stacks {
+		mainConfig, err := ReadMainConfig(stackName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stack config %s: %w", stackName, err)
+		}
+		for _, comp := range mainConfig.Stack.Components {
+			if comp.Source != "" {
+				types[comp.Source] = true
+			}
+		}
+
+		// Apps extend the name of their component, so the names of the
+		// component without an app are the prefixes
+		for _, sub := range tgsConfig.Subscriptions {
+			for _, env := range sub.Environments {
+				if stackOf(env) != stackName {
+					continue
+				}
+				for region, regionComps := range mainConfig.Stack.Architecture.Regions {
+					for _, regionComp := range regionComps {
+						format, separator := naming.ForComponent(tgsConfig.Naming, regionComp.Component)
+						name := naming.Resolve(format, naming.Values{
+							Project:     tgsConfig.Name,
+							Region:      prefixes.Region(region),
+							Environment: prefixes.Environment(env.Name),
+							Type:        naming.Abbreviation(regionComp.Component),
+							Separator:   separator,
+						})
+						key := fmt.Sprintf("%s/%s/%s/%s", stackName, env.Name, region, regionComp.Component)
+						if !hasString(data.NamePrefixes[key], name) {
+							data.NamePrefixes[key] = append(data.NamePrefixes[key], name)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	for key := range data.NamePrefixes {
+		sort.Strings(data.NamePrefixes[key])
+	}
+	for resourceType := range types {
+		data.PrimaryTypes = append(data.PrimaryTypes, resourceType)
+	}
+	sort.Strings(data.PrimaryTypes)
+	return data, nil
+}
+
+// hasString reports whether values contains value
+func hasString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,69 +1,147 @@
 package scaffold
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/cost"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/docs"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/events"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/lock"
 	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/pullrequest"
+)
+
+// Plan output formats
+const (
+	PlanFormatText     = "text"
+	PlanFormatJSON     = "json"
+	PlanFormatMarkdown = "markdown"
 )
 
 type Change struct {
-	Type         string // "add", "remove", "modify"
-	Category     string // "component", "app", "config", "subscription", "environment"
-	Component    string
-	App          string
-	Region       string
-	Environment  string
-	Subscription string
-	Details      string
+	Type         string `json:"type"`     // "add", "remove", "modify"
+	Category     string `json:"category"` // "component", "app", "file", "subscription", "environment", "region"
+	Component    string `json:"component,omitempty"`
+	App          string `json:"app,omitempty"`
+	Region       string `json:"region,omitempty"`
+	Environment  string `json:"environment,omitempty"`
+	Subscription string `json:"subscription,omitempty"`
+	Path         string `json:"path,omitempty"`
+	Details      string `json:"details"`
 }
 
-// Plan analyzes changes that would be applied to the infrastructure
-func Plan() error {
-	logger.Info("Analyzing infrastructure changes...")
+// Plan analyzes changes that would be applied to the infrastructure, prints
+// them in the given format and returns them. With withCost the output also
+// carries the infracost estimates of the generated environments, and with
+// prComment the plan is also posted to the pull request the CI run builds.
+func Plan(format string, withCost, prComment bool) ([]Change, error) {
+	if format == "" {
+		format = PlanFormatText
+	}
+	if format != PlanFormatText && format != PlanFormatJSON && format != PlanFormatMarkdown {
+		return nil, fmt.Errorf("unsupported output format: %s (use text, json or markdown)", format)
+	}
+
+	release, err := lock.Acquire("plan")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if format == PlanFormatText {
+		logger.Info("Analyzing infrastructure changes...")
+	}
+
+	renderedPath, err := renderTree(format)
+	if err != nil {
+		return nil, err
+	}
+	defer project.RemoveAll(renderedPath)
+
+	changes, err := computeChanges(renderedPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var estimates []cost.Estimate
+	if withCost {
+		tgsConfig, err := config.ReadTGSConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TGS config: %w", err)
+		}
+		if estimates, err = cost.Environments(tgsConfig, output.Dir()); err != nil {
+			return nil, err
+		}
+	}
+
+	switch format {
+	case PlanFormatJSON:
+		output, err := formatPlanJSON(changes, estimates)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println(output)
+	case PlanFormatMarkdown:
+		fmt.Print(formatPlanMarkdown(changes))
+		fmt.Print(formatCostMarkdown(estimates))
+	default:
+		printPlan(changes)
+		printCost(estimates)
+	}
+
+	if prComment {
+		if err := postPlanComment(changes, estimates); err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
 
+// computeChanges compares the configuration and the rendered tree against the
+// generated .infrastructure tree and returns the changes in a stable order.
+// Removals carry the path to delete relative to .infrastructure.
+func computeChanges(renderedPath string) ([]Change, error) {
 	// Read TGS config
 	tgsConfig, err := config.ReadTGSConfig()
 	if err != nil {
-		return fmt.Errorf("failed to read TGS config: %w", err)
+		return nil, fmt.Errorf("failed to read TGS config: %w", err)
 	}
 
 	// Track all changes
 	var changes []Change
 
+	architecturePath := output.Path("architecture")
+
 	// Check if .infrastructure directory exists
 	infraExists := false
-	if _, err := os.Stat(".infrastructure"); err == nil {
+	if _, err := project.Stat(architecturePath); err == nil {
 		infraExists = true
 	}
 
 	if !infraExists {
 		// If infrastructure doesn't exist, show what would be created
-		logger.Info("No existing infrastructure found. This will create a new infrastructure with the following structure:")
-
-		// Add changes for all planned subscriptions
 		for subName, sub := range tgsConfig.Subscriptions {
 			changes = append(changes, Change{
 				Type:         "add",
 				Category:     "subscription",
 				Subscription: subName,
-				Details:      fmt.Sprintf("New subscription will be created"),
+				Details:      "New subscription will be created",
 			})
 
 			// Process each environment with its specified stack
 			for _, env := range sub.Environments {
-				stackName := "main"
-				if env.Stack != "" {
-					stackName = env.Stack
-				}
-
-				// Read the stack configuration
-				mainConfig, err := ReadMainConfig(stackName)
+				mainConfig, err := ReadMainConfig(envStack(env))
 				if err != nil {
-					return fmt.Errorf("failed to read stack config %s: %w", stackName, err)
+					return nil, fmt.Errorf("failed to read stack config %s: %w", envStack(env), err)
 				}
 
 				// Add changes for each region and component
@@ -74,10 +152,9 @@ func Plan() error {
 						Subscription: subName,
 						Environment:  env.Name,
 						Region:       region,
-						Details:      fmt.Sprintf("New environment will be created"),
+						Details:      "New environment will be created",
 					})
 
-					// Add changes for each component
 					for _, comp := range components {
 						changes = append(changes, Change{
 							Type:         "add",
@@ -86,373 +163,731 @@ func Plan() error {
 							Region:       region,
 							Environment:  env.Name,
 							Subscription: subName,
-							Details:      fmt.Sprintf("New component will be created"),
+							Details:      "New component will be created",
 						})
 
-						// Add changes for each app if specified
-						if len(comp.Apps) > 0 {
-							for _, app := range comp.Apps {
-								changes = append(changes, Change{
-									Type:         "add",
-									Category:     "app",
-									Component:    comp.Component,
-									App:          app,
-									Region:       region,
-									Environment:  env.Name,
-									Subscription: subName,
-									Details:      fmt.Sprintf("New application instance will be created"),
-								})
-							}
+						for _, app := range comp.Apps {
+							changes = append(changes, Change{
+								Type:         "add",
+								Category:     "app",
+								Component:    comp.Component,
+								App:          app,
+								Region:       region,
+								Environment:  env.Name,
+								Subscription: subName,
+								Details:      "New application instance will be created",
+							})
 						}
 					}
 				}
 			}
 		}
-	} else {
-		// Track all changes
-		var changes []Change
 
-		// Get existing subscriptions from .infrastructure directory
-		entries, err := os.ReadDir(".infrastructure")
+		sortChanges(changes)
+		return changes, nil
+	}
+
+	// Find existing subscriptions across all generated stacks
+	existingSubs := make(map[string][]string)
+	stackDirs, err := project.ReadDir(architecturePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read infrastructure directory: %w", err)
+	}
+	for _, stackDir := range stackDirs {
+		if !stackDir.IsDir() {
+			continue
+		}
+		subDirs, err := project.ReadDir(filepath.Join(architecturePath, stackDir.Name()))
 		if err != nil {
-			return fmt.Errorf("failed to read infrastructure directory: %w", err)
+			continue
 		}
+		for _, subDir := range subDirs {
+			if subDir.IsDir() {
+				existingSubs[subDir.Name()] = append(existingSubs[subDir.Name()], filepath.Join("architecture", stackDir.Name(), subDir.Name()))
+			}
+		}
+	}
 
-		// Track existing and planned subscriptions
-		existingSubs := make(map[string]bool)
-		plannedSubs := make(map[string]bool)
+	// Process planned subscriptions and their contents
+	plannedSubs := make(map[string]bool)
+	for subName, sub := range tgsConfig.Subscriptions {
+		plannedSubs[subName] = true
 
-		// Find existing subscriptions (excluding special directories)
-		for _, entry := range entries {
-			if entry.IsDir() && !strings.HasPrefix(entry.Name(), "_") && !strings.HasPrefix(entry.Name(), ".") && entry.Name() != "config" && entry.Name() != "diagrams" {
-				existingSubs[entry.Name()] = true
-			}
+		// Check if this is a new subscription
+		if len(existingSubs[subName]) == 0 {
+			changes = append(changes, Change{
+				Type:         "add",
+				Category:     "subscription",
+				Subscription: subName,
+				Details:      "New subscription will be created",
+			})
+			continue
 		}
 
-		// Process planned subscriptions and their contents
-		for subName, sub := range tgsConfig.Subscriptions {
-			plannedSubs[subName] = true
-
-			// Check if this is a new subscription
-			if !existingSubs[subName] {
-				changes = append(changes, Change{
-					Type:         "add",
-					Category:     "subscription",
-					Subscription: subName,
-					Details:      fmt.Sprintf("New subscription will be created"),
-				})
+		// Existing environments of this subscription, keyed by stack, region and env
+		existingEnvs := make(map[string]bool)
+		for _, env := range sub.Environments {
+			subPath := filepath.Join(architecturePath, envStack(env), subName)
+			regions, err := project.ReadDir(subPath)
+			if err != nil {
 				continue
 			}
-
-			// Get existing environments for this subscription
-			subPath := filepath.Join(".infrastructure", subName)
-			existingEnvs := make(map[string]map[string]bool) // map[region]map[env]bool
-
-			// Read regions in the subscription
-			regions, err := os.ReadDir(subPath)
-			if err == nil {
-				for _, region := range regions {
-					if region.IsDir() {
-						regionPath := filepath.Join(subPath, region.Name())
-						envs, err := os.ReadDir(regionPath)
-						if err == nil {
-							if existingEnvs[region.Name()] == nil {
-								existingEnvs[region.Name()] = make(map[string]bool)
-							}
-							for _, env := range envs {
-								if env.IsDir() {
-									existingEnvs[region.Name()][env.Name()] = true
-								}
-							}
-						}
+			for _, region := range regions {
+				if !region.IsDir() {
+					continue
+				}
+				envs, err := project.ReadDir(filepath.Join(subPath, region.Name()))
+				if err != nil {
+					continue
+				}
+				for _, envDir := range envs {
+					if envDir.IsDir() {
+						existingEnvs[filepath.Join(envStack(env), region.Name(), envDir.Name())] = true
 					}
 				}
 			}
+		}
 
-			// Process each environment with its specified stack
-			for _, env := range sub.Environments {
-				stackName := "main"
-				if env.Stack != "" {
-					stackName = env.Stack
-				}
+		// Regions of this subscription's stacks, keyed by stack and region
+		plannedRegions := make(map[string]bool)
 
-				// Read the stack configuration
-				mainConfig, err := ReadMainConfig(stackName)
-				if err != nil {
-					return fmt.Errorf("failed to read stack config %s: %w", stackName, err)
+		// Process each environment with its specified stack
+		for _, env := range sub.Environments {
+			stackName := envStack(env)
+
+			mainConfig, err := ReadMainConfig(stackName)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read stack config %s: %w", stackName, err)
+			}
+
+			// Compare components and apps in each region
+			for region, components := range mainConfig.Stack.Architecture.Regions {
+				plannedRegions[filepath.Join(stackName, region)] = true
+
+				// Remove environment from existing map to track removals
+				delete(existingEnvs, filepath.Join(stackName, region, env.Name))
+
+				// Check if this environment exists in this region
+				envPath := filepath.Join(architecturePath, stackName, subName, region, env.Name)
+				if _, err := project.Stat(envPath); os.IsNotExist(err) {
+					changes = append(changes, Change{
+						Type:         "add",
+						Category:     "environment",
+						Subscription: subName,
+						Environment:  env.Name,
+						Region:       region,
+						Details:      "New environment will be created",
+					})
+					continue
 				}
 
-				// Compare components and apps in each region
-				for region, components := range mainConfig.Stack.Architecture.Regions {
-					// Remove environment from existing map to track removals
-					if existingEnvs[region] != nil {
-						delete(existingEnvs[region], env.Name)
-					}
+				// Track planned components
+				plannedComponents := make(map[string]bool)
+
+				// Check for new or modified components
+				for _, comp := range components {
+					plannedComponents[comp.Component] = true
 
-					// Check if this environment exists in this region
-					envPath := filepath.Join(".infrastructure", subName, region, env.Name)
-					if _, err := os.Stat(envPath); os.IsNotExist(err) {
+					componentPath := filepath.Join(envPath, comp.Component)
+					if _, err := project.Stat(componentPath); err != nil {
 						changes = append(changes, Change{
 							Type:         "add",
-							Category:     "environment",
-							Subscription: subName,
-							Environment:  env.Name,
+							Category:     "component",
+							Component:    comp.Component,
 							Region:       region,
-							Details:      fmt.Sprintf("New environment will be created"),
+							Environment:  env.Name,
+							Subscription: subName,
+							Details:      "New component will be created",
 						})
 						continue
 					}
 
-					// Track planned components
-					plannedComponents := make(map[string]bool)
-
-					// Check for new or modified components
-					for _, comp := range components {
-						plannedComponents[comp.Component] = true
-
-						// Check if component directory exists
-						componentPath := filepath.Join(envPath, comp.Component)
-						componentExists := false
-						if _, err := os.Stat(componentPath); err == nil {
-							componentExists = true
-						}
-
-						if !componentExists {
-							changes = append(changes, Change{
-								Type:         "add",
-								Category:     "component",
-								Component:    comp.Component,
-								Region:       region,
-								Environment:  env.Name,
-								Subscription: subName,
-								Details:      fmt.Sprintf("New component will be created"),
-							})
-							continue
-						}
-
-						// Compare apps if component exists
-						if len(comp.Apps) > 0 {
-							existingApps := make(map[string]bool)
-							// Read existing app directories
-							entries, err := os.ReadDir(componentPath)
-							if err == nil {
-								for _, entry := range entries {
-									if entry.IsDir() {
-										existingApps[entry.Name()] = true
-									}
-								}
-							}
-
-							// Check for new apps
-							for _, app := range comp.Apps {
-								if !existingApps[app] {
-									changes = append(changes, Change{
-										Type:         "add",
-										Category:     "app",
-										Component:    comp.Component,
-										App:          app,
-										Region:       region,
-										Environment:  env.Name,
-										Subscription: subName,
-										Details:      fmt.Sprintf("New application instance will be created"),
-									})
-								}
-							}
-
-							// Check for removed apps
-							for existingApp := range existingApps {
-								found := false
-								for _, plannedApp := range comp.Apps {
-									if plannedApp == existingApp {
-										found = true
-										break
-									}
-								}
-								if !found {
-									changes = append(changes, Change{
-										Type:         "remove",
-										Category:     "app",
-										Component:    comp.Component,
-										App:          existingApp,
-										Region:       region,
-										Environment:  env.Name,
-										Subscription: subName,
-										Details:      fmt.Sprintf("Application instance will be removed"),
-									})
+					// Compare apps if component exists
+					if len(comp.Apps) > 0 {
+						existingApps := make(map[string]bool)
+						entries, err := project.ReadDir(componentPath)
+						if err == nil {
+							for _, entry := range entries {
+								if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+									existingApps[entry.Name()] = true
 								}
 							}
 						}
 
-						// Check for configuration changes
-						if configChanges := checkComponentConfigChanges(mainConfig.Stack.Components[comp.Component], componentPath); len(configChanges) > 0 {
-							for _, detail := range configChanges {
+						// Check for new apps
+						plannedApps := make(map[string]bool)
+						for _, app := range comp.Apps {
+							plannedApps[app] = true
+							if !existingApps[app] {
 								changes = append(changes, Change{
-									Type:         "modify",
-									Category:     "config",
+									Type:         "add",
+									Category:     "app",
 									Component:    comp.Component,
+									App:          app,
 									Region:       region,
 									Environment:  env.Name,
 									Subscription: subName,
-									Details:      detail,
+									Details:      "New application instance will be created",
 								})
 							}
 						}
-					}
 
-					// Check for removed components
-					entries, err := os.ReadDir(envPath)
-					if err == nil {
-						for _, entry := range entries {
-							if entry.IsDir() && !plannedComponents[entry.Name()] {
+						// Check for removed apps
+						for existingApp := range existingApps {
+							if !plannedApps[existingApp] {
 								changes = append(changes, Change{
 									Type:         "remove",
-									Category:     "component",
-									Component:    entry.Name(),
+									Category:     "app",
+									Component:    comp.Component,
+									App:          existingApp,
 									Region:       region,
 									Environment:  env.Name,
 									Subscription: subName,
-									Details:      fmt.Sprintf("Component will be removed"),
+									Path:         filepath.ToSlash(filepath.Join("architecture", stackName, subName, region, env.Name, comp.Component, existingApp)),
+									Details:      "Application instance will be removed",
 								})
 							}
 						}
 					}
 				}
 
-				// Add changes for environments that will be removed
-				for region, envs := range existingEnvs {
-					for env := range envs {
-						changes = append(changes, Change{
-							Type:         "remove",
-							Category:     "environment",
-							Subscription: subName,
-							Environment:  env,
-							Region:       region,
-							Details:      fmt.Sprintf("Environment will be removed"),
-						})
+				// Check for removed components
+				entries, err := project.ReadDir(envPath)
+				if err == nil {
+					for _, entry := range entries {
+						if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") && !plannedComponents[entry.Name()] {
+							changes = append(changes, Change{
+								Type:         "remove",
+								Category:     "component",
+								Component:    entry.Name(),
+								Region:       region,
+								Environment:  env.Name,
+								Subscription: subName,
+								Path:         filepath.ToSlash(filepath.Join("architecture", stackName, subName, region, env.Name, entry.Name())),
+								Details:      "Component will be removed",
+							})
+						}
 					}
 				}
 			}
+		}
 
-			// Check for removed subscriptions
-			for existingSub := range existingSubs {
-				if !plannedSubs[existingSub] {
+		// Add changes for environments that will be removed. Regions no
+		// environment deploys to anymore are removed as a whole.
+		removedRegions := make(map[string]bool)
+		for key := range existingEnvs {
+			parts := strings.Split(filepath.ToSlash(key), "/")
+			if region := filepath.Join(parts[0], parts[1]); !plannedRegions[region] {
+				if !removedRegions[region] {
+					removedRegions[region] = true
 					changes = append(changes, Change{
 						Type:         "remove",
-						Category:     "subscription",
-						Subscription: existingSub,
-						Details:      fmt.Sprintf("Subscription will be removed"),
+						Category:     "region",
+						Subscription: subName,
+						Region:       parts[1],
+						Path:         filepath.ToSlash(filepath.Join("architecture", parts[0], subName, parts[1])),
+						Details:      "Region will be removed",
 					})
 				}
+				continue
 			}
+			changes = append(changes, Change{
+				Type:         "remove",
+				Category:     "environment",
+				Subscription: subName,
+				Environment:  parts[2],
+				Region:       parts[1],
+				Path:         filepath.ToSlash(filepath.Join("architecture", parts[0], subName, parts[1], parts[2])),
+				Details:      "Environment will be removed",
+			})
 		}
 	}
 
-	// Print changes
-	if len(changes) == 0 {
-		fmt.Println("\nNo changes detected. Infrastructure is up to date.")
-		return nil
+	// Check for removed subscriptions
+	for existingSub, paths := range existingSubs {
+		if plannedSubs[existingSub] {
+			continue
+		}
+		for _, path := range paths {
+			changes = append(changes, Change{
+				Type:         "remove",
+				Category:     "subscription",
+				Subscription: existingSub,
+				Path:         filepath.ToSlash(path),
+				Details:      "Subscription will be removed",
+			})
+		}
 	}
 
-	fmt.Println("\nPlanned changes:")
-	fmt.Println("================")
+	// Compare every rendered file against disk so template, naming and
+	// input changes show up as modifications
+	contentChanges, err := diffTrees(renderedPath, output.Dir(), "")
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, contentChanges...)
+
+	sortChanges(changes)
+	return changes, nil
+}
+
+// renderTree generates the complete infrastructure tree into a temporary
+// directory and returns its path, for a plan output in format
+func renderTree(format string) (string, error) {
+	tmpDir, err := os.MkdirTemp("", "tgs-plan")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp dir: %w", err)
+	}
+
+	// Only report the warnings of rendering, on stderr when stdout is the
+	// plan of a machine readable format
+	logger.SetQuiet(true)
+	defer logger.SetQuiet(false)
+	if format != PlanFormatText {
+		previous := logger.Output()
+		logger.SetOutput(os.Stderr)
+		defer logger.SetOutput(previous)
+	}
+	events.SetQuiet(true)
+	defer events.SetQuiet(false)
+
+	if err := generate(tmpDir); err != nil {
+		project.RemoveAll(tmpDir)
+		return "", fmt.Errorf("failed to render infrastructure: %w", err)
+	}
+
+	return tmpDir, nil
+}
+
+// unmanagedDirs are the directories of the output root written by other
+// commands than generate, tgs diagram and tgs docs
+var unmanagedDirs = map[string]bool{"diagrams": true, docs.DefaultDir: true}
+
+// diffTrees compares the rendered tree against the tree on disk below rel.
+// Directories that only exist on one side are reported once instead of per
+// file; those below architecture/ are already covered by the structural
+// changes. Hidden entries on disk (e.g. .terragrunt-cache) and the
+// unmanaged directories of the output root are ignored.
+func diffTrees(renderedRoot, diskRoot, rel string) ([]Change, error) {
+	rendered, err := readDirNames(filepath.Join(renderedRoot, rel))
+	if err != nil {
+		return nil, err
+	}
+	disk, err := readDirNames(filepath.Join(diskRoot, rel))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	for name := range rendered {
+		names[name] = true
+	}
+	for name := range disk {
+		if !strings.HasPrefix(name, ".") && !(rel == "" && unmanagedDirs[name]) {
+			names[name] = true
+		}
+	}
+
+	var sorted []string
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var changes []Change
+	for _, name := range sorted {
+		path := filepath.Join(rel, name)
+		renderedIsDir, inRendered := rendered[name]
+		diskIsDir, onDisk := disk[name]
+		structural := strings.HasPrefix(filepath.ToSlash(path), "architecture/")
+
+		switch {
+		case inRendered && !onDisk:
+			if renderedIsDir {
+				if !structural {
+					changes = append(changes, fileChange("add", path, true, "Directory will be created"))
+				}
+			} else {
+				changes = append(changes, fileChange("add", path, false, "File will be created"))
+			}
+		case onDisk && !inRendered:
+			if diskIsDir {
+				if !structural {
+					changes = append(changes, fileChange("remove", path, true, "Directory will be removed"))
+				}
+			} else {
+				changes = append(changes, fileChange("remove", path, false, "File will be removed"))
+			}
+		case renderedIsDir && diskIsDir:
+			nested, err := diffTrees(renderedRoot, diskRoot, path)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, nested...)
+		case renderedIsDir != diskIsDir:
+			changes = append(changes, fileChange("modify", path, false, "Will be replaced"))
+		default:
+			want, err := project.ReadFile(filepath.Join(renderedRoot, path))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read rendered %s: %w", path, err)
+			}
+			have, err := project.ReadFile(filepath.Join(diskRoot, path))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", path, err)
+			}
+			if string(want) != string(have) {
+				added, removed := lineDiffStats(string(have), string(want))
+				changes = append(changes, fileChange("modify", path, false, fmt.Sprintf("File will be updated (+%d -%d lines)", added, removed)))
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// readDirNames returns the entries of a directory mapped to whether they are
+// directories; a missing directory has no entries
+func readDirNames(dir string) (map[string]bool, error) {
+	entries, err := project.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return map[string]bool{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory %s: %w", dir, err)
+	}
+
+	names := make(map[string]bool)
+	for _, entry := range entries {
+		names[entry.Name()] = entry.IsDir()
+	}
+	return names, nil
+}
+
+// fileChange creates a file level change, filling in the location fields
+// from the path inside .infrastructure
+func fileChange(changeType, path string, isDir bool, details string) Change {
+	change := Change{
+		Type:     changeType,
+		Category: "file",
+		Path:     filepath.ToSlash(path),
+		Details:  details,
+	}
+
+	parts := strings.Split(change.Path, "/")
+	if !isDir {
+		parts = parts[:len(parts)-1]
+	}
+
+	switch {
+	case len(parts) > 0 && parts[0] == "architecture":
+		// architecture/<stack>/<subscription>/<region>/<env>/<component>/<app>
+		fields := []*string{nil, nil, &change.Subscription, &change.Region, &change.Environment, &change.Component, &change.App}
+		for i, part := range parts {
+			if i < len(fields) && fields[i] != nil {
+				*fields[i] = part
+			}
+		}
+	case len(parts) > 2 && parts[0] == "_components":
+		change.Component = parts[2]
+	}
+
+	return change
+}
+
+// lineDiffStats returns the number of lines added and removed between two
+// versions of a file, based on their longest common subsequence
+func lineDiffStats(before, after string) (int, int) {
+	a := strings.Split(before, "\n")
+	b := strings.Split(after, "\n")
+
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			if a[i-1] == b[j-1] {
+				curr[j] = prev[j-1] + 1
+			} else if prev[j] >= curr[j-1] {
+				curr[j] = prev[j]
+			} else {
+				curr[j] = curr[j-1]
+			}
+		}
+		prev, curr = curr, prev
+	}
 
-	// Group changes by subscription and environment
-	bySubEnvRegion := make(map[string][]Change)
+	common := prev[len(b)]
+	return len(b) - common, len(a) - common
+}
+
+// envStack returns the stack an environment uses
+func envStack(env config.Environment) string {
+	if env.Stack != "" {
+		return env.Stack
+	}
+	return "main"
+}
+
+// sortChanges orders changes by location so output is deterministic
+func sortChanges(changes []Change) {
+	sort.SliceStable(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		keyA := []string{a.Subscription, a.Environment, a.Region, a.Component, a.App, a.Path, a.Type, a.Details}
+		keyB := []string{b.Subscription, b.Environment, b.Region, b.Component, b.App, b.Path, b.Type, b.Details}
+		for k := range keyA {
+			if keyA[k] != keyB[k] {
+				return keyA[k] < keyB[k]
+			}
+		}
+		return false
+	})
+}
+
+// changeGroups groups changes by subscription, environment and region,
+// returning the group keys in order
+func changeGroups(changes []Change) ([]string, map[string][]Change) {
+	var keys []string
+	groups := make(map[string][]Change)
 	for _, change := range changes {
 		var key string
-		if change.Category == "subscription" {
+		switch {
+		case change.Subscription == "":
+			key = ""
+		case change.Category == "subscription" || change.Environment == "":
 			key = change.Subscription
-		} else {
+		default:
 			key = fmt.Sprintf("%s/%s/%s", change.Subscription, change.Environment, change.Region)
 		}
-		bySubEnvRegion[key] = append(bySubEnvRegion[key], change)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], change)
+	}
+	return keys, groups
+}
+
+// changeLabel returns the short description of what a change affects
+func changeLabel(change Change) string {
+	switch change.Category {
+	case "subscription":
+		return fmt.Sprintf("Subscription %s", change.Subscription)
+	case "environment":
+		return fmt.Sprintf("Environment %s", change.Environment)
+	case "region":
+		return fmt.Sprintf("Region %s", change.Region)
+	case "app":
+		return fmt.Sprintf("%s/%s", change.Component, change.App)
+	case "file":
+		return change.Path
+	default:
+		return change.Component
+	}
+}
+
+// printPlan prints changes as human readable text
+func printPlan(changes []Change) {
+	if len(changes) == 0 {
+		fmt.Println("\nNo changes detected. Infrastructure is up to date.")
+		return
 	}
 
+	fmt.Println("\nPlanned changes:")
+	fmt.Println("================")
+
 	// Print changes organized by subscription, environment, and region
-	for key, changes := range bySubEnvRegion {
+	keys, groups := changeGroups(changes)
+	for _, key := range keys {
 		parts := strings.Split(key, "/")
-		if len(parts) == 1 {
-			// Subscription-level changes
+		if key == "" {
+			fmt.Println("\nShared configuration")
+		} else if len(parts) == 1 {
 			fmt.Printf("\nSubscription: %s\n", parts[0])
-			fmt.Println(strings.Repeat("-", 40))
 		} else {
-			// Environment-level changes
-			sub, env, region := parts[0], parts[1], parts[2]
-			fmt.Printf("\nSubscription: %s, Environment: %s, Region: %s\n", sub, env, region)
-			fmt.Println(strings.Repeat("-", 40))
+			fmt.Printf("\nSubscription: %s, Environment: %s, Region: %s\n", parts[0], parts[1], parts[2])
 		}
+		fmt.Println(strings.Repeat("-", 40))
 
 		// Group by change type
 		for _, changeType := range []string{"add", "remove", "modify"} {
 			var typeChanges []Change
-			for _, change := range changes {
+			for _, change := range groups[key] {
 				if change.Type == changeType {
 					typeChanges = append(typeChanges, change)
 				}
 			}
 
-			if len(typeChanges) > 0 {
-				switch changeType {
-				case "add":
-					fmt.Println("\n  + Additions:")
-				case "remove":
-					fmt.Println("\n  - Removals:")
-				case "modify":
-					fmt.Println("\n  ~ Modifications:")
-				}
+			if len(typeChanges) == 0 {
+				continue
+			}
 
-				for _, change := range typeChanges {
-					switch change.Category {
-					case "subscription":
-						fmt.Printf("    Subscription %s: %s\n", change.Subscription, change.Details)
-					case "environment":
-						fmt.Printf("    Environment %s: %s\n", change.Environment, change.Details)
-					case "component":
-						fmt.Printf("    %s: %s\n", change.Component, change.Details)
-					case "app":
-						fmt.Printf("    %s/%s: %s\n", change.Component, change.App, change.Details)
-					case "config":
-						fmt.Printf("    %s: %s\n", change.Component, change.Details)
-					}
-				}
+			switch changeType {
+			case "add":
+				fmt.Println("\n  + Additions:")
+			case "remove":
+				fmt.Println("\n  - Removals:")
+			case "modify":
+				fmt.Println("\n  ~ Modifications:")
+			}
+
+			for _, change := range typeChanges {
+				fmt.Printf("    %s: %s\n", changeLabel(change), change.Details)
 			}
 		}
 	}
+}
 
-	return nil
+// planSummary counts changes by type
+type planSummary struct {
+	Add    int `json:"add"`
+	Remove int `json:"remove"`
+	Modify int `json:"modify"`
 }
 
-// checkComponentConfigChanges checks for configuration changes in component.hcl and terragrunt.hcl files
-func checkComponentConfigChanges(comp config.Component, componentPath string) []string {
-	var changes []string
+func summarize(changes []Change) planSummary {
+	var summary planSummary
+	for _, change := range changes {
+		switch change.Type {
+		case "add":
+			summary.Add++
+		case "remove":
+			summary.Remove++
+		case "modify":
+			summary.Modify++
+		}
+	}
+	return summary
+}
 
-	// Read the existing component.hcl file
-	componentHclPath := filepath.Join(componentPath, "component.hcl")
-	content, err := os.ReadFile(componentHclPath)
+// formatPlanJSON renders changes and a summary as JSON, with the cost
+// estimates when there are any
+func formatPlanJSON(changes []Change, estimates []cost.Estimate) (string, error) {
+	if changes == nil {
+		changes = []Change{}
+	}
+
+	out := struct {
+		HasChanges bool            `json:"has_changes"`
+		Summary    planSummary     `json:"summary"`
+		Changes    []Change        `json:"changes"`
+		Costs      []cost.Estimate `json:"costs,omitempty"`
+	}{
+		HasChanges: len(changes) > 0,
+		Summary:    summarize(changes),
+		Changes:    changes,
+		Costs:      estimates,
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
 	if err != nil {
-		return changes
+		return "", fmt.Errorf("failed to marshal plan: %w", err)
 	}
+	return string(data), nil
+}
 
-	currentContent := string(content)
+// formatPlanMarkdown renders changes as Markdown suitable for PR comments
+func formatPlanMarkdown(changes []Change) string {
+	var b strings.Builder
+	b.WriteString("## Infrastructure Plan\n\n")
 
-	// Check for version changes
-	if comp.Version != "" && !strings.Contains(currentContent, fmt.Sprintf(`version = "%s"`, comp.Version)) {
-		changes = append(changes, fmt.Sprintf("Provider version will be updated to %s", comp.Version))
+	if len(changes) == 0 {
+		b.WriteString("No changes detected. Infrastructure is up to date.\n")
+		return b.String()
 	}
 
-	// Check for dependency changes
-	if len(comp.Deps) > 0 {
-		missingDeps := false
-		for _, dep := range comp.Deps {
-			if !strings.Contains(currentContent, fmt.Sprintf(`dependency "%s"`, strings.Split(dep, ".")[1])) {
-				missingDeps = true
-				break
-			}
+	summary := summarize(changes)
+	b.WriteString(fmt.Sprintf("**%d to add, %d to remove, %d to modify**\n", summary.Add, summary.Remove, summary.Modify))
+
+	symbols := map[string]string{"add": "+", "remove": "-", "modify": "~"}
+
+	keys, groups := changeGroups(changes)
+	for _, key := range keys {
+		parts := strings.Split(key, "/")
+		if key == "" {
+			b.WriteString("\n### Shared configuration\n\n")
+		} else if len(parts) == 1 {
+			b.WriteString(fmt.Sprintf("\n### Subscription `%s`\n\n", parts[0]))
+		} else {
+			b.WriteString(fmt.Sprintf("\n### `%s` / `%s` / `%s`\n\n", parts[0], parts[1], parts[2]))
 		}
-		if missingDeps {
-			changes = append(changes, "Component dependencies will be updated")
+
+		b.WriteString("| | Resource | Details |\n")
+		b.WriteString("|---|---|---|\n")
+		for _, change := range groups[key] {
+			b.WriteString(fmt.Sprintf("| `%s` | %s | %s |\n", symbols[change.Type], changeLabel(change), change.Details))
 		}
 	}
 
-	return changes
+	return b.String()
+}
+
+// planCommentMarker identifies the pull request comment of tgs plan, so
+// reruns update it
+const planCommentMarker = "<!-- tgs-plan -->"
+
+// postPlanComment posts the plan as a comment on the pull request the CI run
+// builds, updating the comment of an earlier run
+func postPlanComment(changes []Change, estimates []cost.Estimate) error {
+	remote, number, err := pullrequest.Current()
+	if err != nil {
+		return err
+	}
+	updated, err := pullrequest.Comment(remote, number, planCommentMarker, formatPlanComment(changes, estimates))
+	if err != nil {
+		return fmt.Errorf("failed to comment on pull request %d: %w", number, err)
+	}
+	if updated {
+		logger.Success("Updated the plan comment of pull request %d", number)
+	} else {
+		logger.Success("Posted the plan to pull request %d", number)
+	}
+	return nil
+}
+
+// formatPlanComment renders the plan as a pull request comment, collapsed
+// below a one line summary
+func formatPlanComment(changes []Change, estimates []cost.Estimate) string {
+	summary := "tgs plan: no changes, the generated tree is up to date"
+	if len(changes) > 0 {
+		counts := summarize(changes)
+		summary = fmt.Sprintf("tgs plan: %d to add, %d to remove, %d to modify", counts.Add, counts.Remove, counts.Modify)
+	}
+
+	var b strings.Builder
+	b.WriteString(planCommentMarker + "\n")
+	fmt.Fprintf(&b, "<details>\n<summary>%s</summary>\n\n", summary)
+	b.WriteString(formatPlanMarkdown(changes))
+	b.WriteString(formatCostMarkdown(estimates))
+	b.WriteString("\n</details>\n")
+	return b.String()
+}
+
+// printCost prints the monthly cost estimates of the environments
+func printCost(estimates []cost.Estimate) {
+	if len(estimates) == 0 {
+		return
+	}
+
+	fmt.Println("\nEstimated monthly cost:")
+	fmt.Println("=======================")
+	for _, estimate := range estimates {
+		fmt.Printf("  %s/%s: %.2f %s\n", estimate.Subscription, estimate.Environment, estimate.MonthlyCost, estimate.Currency)
+	}
+	fmt.Printf("  Total: %.2f %s\n", cost.Total(estimates), estimates[0].Currency)
+}
+
+// formatCostMarkdown renders the monthly cost estimates of the environments
+// as a Markdown table
+func formatCostMarkdown(estimates []cost.Estimate) string {
+	if len(estimates) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\n### Estimated monthly cost\n\n")
+	b.WriteString("| Subscription | Environment | Regions | Monthly cost |\n")
+	b.WriteString("|---|---|---|---|\n")
+	for _, estimate := range estimates {
+		b.WriteString(fmt.Sprintf("| `%s` | `%s` | %s | %.2f %s |\n", estimate.Subscription, estimate.Environment, strings.Join(estimate.Regions, ", "), estimate.MonthlyCost, estimate.Currency))
+	}
+	b.WriteString(fmt.Sprintf("| | | **Total** | **%.2f %s** |\n", cost.Total(estimates), estimates[0].Currency))
+	return b.String()
 }
@@ -3,9 +3,11 @@ package scaffold
 import (
 	"encoding/json"
 	"fmt"
-	"os"
-	"os/exec"
 	"path/filepath"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/mirror"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
 )
 
 // Move SchemaCache and all provider-related functions here
@@ -21,6 +23,23 @@ func fetchProviderSchema(provider, version, resource string) (*ProviderSchema, e
 		return cache.Schema, nil
 	}
 
+	// Prefer a pre-baked schema synced from the mirror
+	if path, ok := mirror.Lookup(mirror.KindSchema, mirror.SchemaPath(provider, version)); ok {
+		data, err := project.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mirrored schema: %w", err)
+		}
+
+		var schema ProviderSchema
+		if err := json.Unmarshal(data, &schema); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal mirrored schema: %w", err)
+		}
+
+		logger.Info("Using mirrored provider schema for %s %s", provider, version)
+		cache.Schema = &schema
+		return &schema, nil
+	}
+
 	// Create provider.tf in cache directory
 	providerConfig := fmt.Sprintf(`
 terraform {
@@ -37,18 +56,18 @@ provider "azurerm" {
 }`, version)
 
 	providerPath := filepath.Join(cache.CachePath, "provider.tf")
-	if err := os.WriteFile(providerPath, []byte(providerConfig), 0644); err != nil {
+	if err := project.WriteFile(providerPath, []byte(providerConfig), 0644); err != nil {
 		return nil, fmt.Errorf("failed to write provider.tf: %w", err)
 	}
 
-	cmd := exec.Command("terraform", "init")
-	cmd.Dir = cache.CachePath
+	cmd := project.Command("terraform", "init")
+	cmd.Dir = project.Path(cache.CachePath)
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return nil, fmt.Errorf("terraform init failed: %s: %w", string(out), err)
 	}
 
-	cmd = exec.Command("terraform", "providers", "schema", "-json")
-	cmd.Dir = cache.CachePath
+	cmd = project.Command("terraform", "providers", "schema", "-json")
+	cmd.Dir = project.Path(cache.CachePath)
 	out, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("terraform providers schema failed: %w", err)
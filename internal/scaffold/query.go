@@ -0,0 +1,164 @@
+package scaffold
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/graph"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/naming"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+)
+
+// QueryKeys are the keys selectors of tgs query match on
+var QueryKeys = []string{"stack", "subscription", "env", "region", "component", "app", "type", "name"}
+
+// Selector matches the entries of tgs query whose key matches Value, a
+// path.Match pattern, or doesn't when Negate is set
+type Selector struct {
+	Key    string
+	Value  string
+	Negate bool
+}
+
+// QueryEntry is a deployed component or app of the generated estate
+type QueryEntry struct {
+	Stack        string `json:"stack"`
+	Subscription string `json:"subscription"`
+	Environment  string `json:"environment"`
+	Region       string `json:"region"`
+	Component    string `json:"component"`
+	App          string `json:"app,omitempty"`
+	ResourceType string `json:"resource_type"`
+	Name         string `json:"name"`
+	// Path is the generated terragrunt folder, relative to the project
+	Path     string `json:"path"`
+	StateKey string `json:"state_key"`
+	// Deps are the paths of the folders the entry depends on
+	Deps []string `json:"deps"`
+}
+
+// ParseSelector parses a key=value or key!=value selector. env, environment
+// and sub are accepted for the environment and subscription keys.
+func ParseSelector(s string) (Selector, error) {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || key == "" {
+		return Selector{}, fmt.Errorf("invalid selector %q: must be key=value or key!=value", s)
+	}
+	selector := Selector{Key: strings.ToLower(key), Value: value}
+	if trimmed, negate := strings.CutSuffix(selector.Key, "!"); negate {
+		selector.Key, selector.Negate = trimmed, true
+	}
+	switch selector.Key {
+	case "environment":
+		selector.Key = "env"
+	case "sub":
+		selector.Key = "subscription"
+	}
+	if !hasString(QueryKeys, selector.Key) {
+		return Selector{}, fmt.Errorf("unknown selector key %q: must be one of %s", key, strings.Join(QueryKeys, ", "))
+	}
+	if _, err := path.Match(selector.Value, ""); err != nil {
+		return Selector{}, fmt.Errorf("invalid pattern in selector %q: %w", s, err)
+	}
+	return selector, nil
+}
+
+// Matches reports whether the entry matches the selector
+func (s Selector) Matches(entry QueryEntry) bool {
+	matched, _ := path.Match(s.Value, entry.field(s.Key))
+	return matched != s.Negate
+}
+
+func (e QueryEntry) field(key string) string {
+	switch key {
+	case "stack":
+		return e.Stack
+	case "subscription":
+		return e.Subscription
+	case "env":
+		return e.Environment
+	case "region":
+		return e.Region
+	case "component":
+		return e.Component
+	case "app":
+		return e.App
+	case "type":
+		return e.ResourceType
+	case "name":
+		return e.Name
+	}
+	return ""
+}
+
+// Query returns the components and apps of stacks deployed by the
+// environments of tgs.yaml that match every selector, with their generated
+// folders, resource names, dependencies and state keys, ordered by stack
+// and the order of tgs name preview
+func Query(tgsConfig *config.TGSConfig, stacks map[string]*config.MainConfig, selectors []Selector) []QueryEntry {
+	var stackNames []string
+	for name := range stacks {
+		stackNames = append(stackNames, name)
+	}
+	sort.Strings(stackNames)
+
+	entries := []QueryEntry{}
+	for _, stackName := range stackNames {
+		mainConfig := stacks[stackName]
+		g := graph.Build(mainConfig)
+
+		for _, resolved := range naming.Resolved(tgsConfig, stackName, mainConfig) {
+			folder := func(node *graph.Node) string {
+				return path.Join("architecture", stackName, resolved.Subscription, node.Region, resolved.Environment, node.Component, node.App)
+			}
+			node := &graph.Node{Region: resolved.Region, Component: resolved.Component, App: resolved.App}
+
+			entry := QueryEntry{
+				Stack:        stackName,
+				Subscription: resolved.Subscription,
+				Environment:  resolved.Environment,
+				Region:       resolved.Region,
+				Component:    resolved.Component,
+				App:          resolved.App,
+				ResourceType: resolved.ResourceType,
+				Name:         resolved.Name,
+				Path:         queryPath(tgsConfig, folder(node)),
+				StateKey:     tgsConfig.Subscriptions[resolved.Subscription].RemoteState.StateKey(mainConfig.Stack.Components[resolved.Component].StateKeyPrefix, folder(node)),
+				Deps:         []string{},
+			}
+			for _, dep := range g.Edges[graph.NodeID(resolved.Region, resolved.Component, resolved.App)] {
+				entry.Deps = append(entry.Deps, queryPath(tgsConfig, folder(g.Nodes[dep])))
+			}
+
+			matched := true
+			for _, selector := range selectors {
+				if !selector.Matches(entry) {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return entries
+}
+
+// queryPath returns the generated folder of an architecture folder, relative
+// to the project. Units of the stacks layout are generated into
+// .terragrunt-stack but keep the state key of their folder.
+func queryPath(tgsConfig *config.TGSConfig, folder string) string {
+	if tgsConfig.Layout == config.LayoutStacks {
+		// architecture/<stack>/<subscription>/<region>/<environment>/...
+		parts := strings.SplitN(folder, "/", 6)
+		if len(parts) == 6 {
+			folder = path.Join(path.Join(parts[:5]...), terragruntStackDir, parts[5])
+		}
+	}
+	return path.Join(filepath.ToSlash(output.Dir()), folder)
+}
@@ -0,0 +1,150 @@
+package scaffold
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// moduleDoc is a variable or output of a component module as documented in
+// its README
+type moduleDoc struct {
+	name        string
+	description string
+	typ         string
+	defaultExpr string
+	hasDefault  bool
+}
+
+// generateComponentReadme writes the README.md of a component module,
+// documenting its resources, providers, dependencies, inputs and outputs in
+// the layout of terraform-docs. It's rewritten on every run from the module
+// files, so it must be generated after them.
+func generateComponentReadme(componentPath, stackName, compName string, comp config.Component) error {
+	var inputs []moduleDoc
+	for _, file := range []string{"variables.tf", "provider.tf"} {
+		docs, err := moduleDocs(filepath.Join(componentPath, file), "variable")
+		if err != nil {
+			return fmt.Errorf("failed to read inputs of %s: %w", compName, err)
+		}
+		inputs = append(inputs, docs...)
+	}
+	sort.Slice(inputs, func(i, j int) bool { return inputs[i].name < inputs[j].name })
+
+	var outputs []moduleDoc
+	if _, err := project.Stat(filepath.Join(componentPath, "outputs.tf")); err == nil {
+		docs, err := moduleDocs(filepath.Join(componentPath, "outputs.tf"), "output")
+		if err != nil {
+			return fmt.Errorf("failed to read outputs of %s: %w", compName, err)
+		}
+		outputs = docs
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", compName)
+	fmt.Fprintf(&b, "<!-- Generated by tgs generate from the %s stack. Changes are overwritten on the next run. -->\n\n", stackName)
+	if comp.Description != "" {
+		fmt.Fprintf(&b, "%s\n\n", comp.Description)
+	}
+
+	b.WriteString("## Resources\n\n| Type | Role |\n|------|------|\n")
+	fmt.Fprintf(&b, "| `%s` | primary |\n", comp.Source)
+	for _, resource := range comp.AdditionalResources {
+		fmt.Fprintf(&b, "| `%s` | additional |\n", resource)
+	}
+
+	b.WriteString("\n## Providers\n\n| Name | Source | Version |\n|------|--------|---------|\n")
+	fmt.Fprintf(&b, "| azurerm | hashicorp/azurerm | `%s` |\n", comp.Version)
+	for _, provider := range comp.Providers {
+		fmt.Fprintf(&b, "| %s | %s | `%s` |\n", provider.Name, provider.SourceAddress(), provider.Version)
+	}
+
+	b.WriteString("\n## Dependencies\n\n")
+	if len(comp.Deps) == 0 && len(comp.ExternalDeps) == 0 {
+		b.WriteString("No dependencies.\n")
+	} else {
+		b.WriteString("| Name | Reference | Kind |\n|------|-----------|------|\n")
+		names := config.DependencyNames(comp.Deps)
+		for i, dep := range comp.Deps {
+			fmt.Fprintf(&b, "| %s | `%s` | stack |\n", names[i], dep)
+		}
+		for _, name := range comp.ExternalDeps {
+			fmt.Fprintf(&b, "| %s | `%s` | external |\n", name, name)
+		}
+	}
+
+	b.WriteString("\n## Inputs\n\n| Name | Description | Type | Default | Required |\n|------|-------------|------|---------|:--------:|\n")
+	for _, input := range inputs {
+		defaultValue, required := "n/a", "yes"
+		if input.hasDefault {
+			defaultValue, required = "`"+markdownCell(input.defaultExpr)+"`", "no"
+		}
+		typ := "any"
+		if input.typ != "" {
+			typ = input.typ
+		}
+		fmt.Fprintf(&b, "| %s | %s | `%s` | %s | %s |\n", input.name, markdownCell(input.description), markdownCell(typ), defaultValue, required)
+	}
+
+	b.WriteString("\n## Outputs\n\n")
+	if len(outputs) == 0 {
+		b.WriteString("No outputs.\n")
+	} else {
+		b.WriteString("| Name | Description |\n|------|-------------|\n")
+		for _, output := range outputs {
+			fmt.Fprintf(&b, "| %s | %s |\n", output.name, markdownCell(output.description))
+		}
+	}
+
+	return createFile(filepath.Join(componentPath, "README.md"), b.String())
+}
+
+// moduleDocs returns the blocks of a type, variable or output, of a module
+// file in the order they're declared
+func moduleDocs(path, blockType string) ([]moduleDoc, error) {
+	body, content, err := parseModuleFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []moduleDoc
+	for _, block := range body.Blocks {
+		if block.Type != blockType || len(block.Labels) != 1 {
+			continue
+		}
+		doc := moduleDoc{name: block.Labels[0]}
+		if attr, ok := block.Body.Attributes["description"]; ok {
+			doc.description = attributeString(attr, content)
+		}
+		if attr, ok := block.Body.Attributes["type"]; ok {
+			doc.typ = strings.TrimSpace(string(attr.Expr.Range().SliceBytes(content)))
+		}
+		if attr, ok := block.Body.Attributes["default"]; ok {
+			doc.hasDefault = true
+			doc.defaultExpr = strings.TrimSpace(string(attr.Expr.Range().SliceBytes(content)))
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// attributeString returns the value of a string attribute, or its source
+// text when it isn't a literal
+func attributeString(attr *hclsyntax.Attribute, content []byte) string {
+	if value, diags := attr.Expr.Value(nil); !diags.HasErrors() && value.Type() == cty.String && value.IsKnown() && !value.IsNull() {
+		return value.AsString()
+	}
+	return strings.TrimSpace(string(attr.Expr.Range().SliceBytes(content)))
+}
+
+// markdownCell makes a value fit a single cell of a markdown table
+func markdownCell(value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+	return strings.ReplaceAll(value, "|", "\\|")
+}
@@ -0,0 +1,279 @@
+package scaffold
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"gopkg.in/yaml.v3"
+)
+
+// RemoveComponent removes a component and its placements from a stack and
+// prunes its folders from the tree
+func RemoveComponent(stackName, name string, confirm func([]Change) (bool, error)) error {
+	return removeFromStack(stackName, confirm, func(stack *yaml.Node) error {
+		if !deleteKey(mappingValue(stack, "components"), name) {
+			return fmt.Errorf("component %s is not defined in stack %s", name, stackName)
+		}
+		forEachRegion(stack, func(region string, placements *yaml.Node) {
+			kept := placements.Content[:0]
+			for _, placement := range placements.Content {
+				if component := mappingValue(placement, "component"); component == nil || component.Value != name {
+					kept = append(kept, placement)
+				}
+			}
+			placements.Content = kept
+		})
+		return nil
+	})
+}
+
+// RemoveApp removes an app instance of a component from a stack, in every
+// region or only the given one
+func RemoveApp(stackName, component, app, region string, confirm func([]Change) (bool, error)) error {
+	return removeFromStack(stackName, confirm, func(stack *yaml.Node) error {
+		if !removeApp(stack, component, app, region) {
+			return fmt.Errorf("app %s of component %s is not deployed by stack %s", app, component, stackName)
+		}
+		return nil
+	})
+}
+
+// removeApp removes an app from the placements of a component in a stack
+// node, reporting whether it was deployed
+func removeApp(stack *yaml.Node, component, app, region string) bool {
+	found := false
+	forEachRegion(stack, func(name string, placements *yaml.Node) {
+		if region != "" && name != region {
+			return
+		}
+		for _, placement := range placements.Content {
+			if c := mappingValue(placement, "component"); c == nil || c.Value != component {
+				continue
+			}
+			apps := mappingValue(placement, "apps")
+			if apps == nil {
+				continue
+			}
+			kept := apps.Content[:0]
+			for _, a := range apps.Content {
+				if appName(a) == app {
+					found = true
+					continue
+				}
+				kept = append(kept, a)
+			}
+			apps.Content = kept
+		}
+	})
+	return found
+}
+
+// appName returns the name of an app of a placement, a name or a mapping
+// with a name and metadata
+func appName(node *yaml.Node) string {
+	if node.Kind == yaml.MappingNode {
+		if name := mappingValue(node, "name"); name != nil {
+			return name.Value
+		}
+		return ""
+	}
+	return node.Value
+}
+
+// RemoveRegion removes a region from the architecture of a stack and prunes
+// its folders from the tree
+func RemoveRegion(stackName, region string, confirm func([]Change) (bool, error)) error {
+	return removeFromStack(stackName, confirm, func(stack *yaml.Node) error {
+		if !deleteKey(mappingValue(mappingValue(stack, "architecture"), "regions"), region) {
+			return fmt.Errorf("stack %s doesn't deploy to region %s", stackName, region)
+		}
+		return nil
+	})
+}
+
+// RemoveEnvironment removes an environment from a subscription in tgs.yaml, or
+// the included file defining the subscription's environments, and prunes its
+// folders from the tree
+func RemoveEnvironment(subscription, environment string, confirm func([]Change) (bool, error)) error {
+	path, err := environmentsFile(subscription)
+	if err != nil {
+		return err
+	}
+	return removeFrom(path, confirm, func(root *yaml.Node) error {
+		envs := mappingValue(mappingValue(mappingValue(root, "subscriptions"), subscription), "environments")
+		if envs == nil {
+			return fmt.Errorf("subscription %s has no environments", subscription)
+		}
+
+		kept := envs.Content[:0]
+		for _, env := range envs.Content {
+			if name := mappingValue(env, "name"); name == nil || name.Value != environment {
+				kept = append(kept, env)
+			}
+		}
+		if len(kept) == len(envs.Content) {
+			return fmt.Errorf("environment %s is not defined in subscription %s", environment, subscription)
+		}
+		envs.Content = kept
+		return nil
+	})
+}
+
+// environmentsFile returns the file whose environments list of a
+// subscription takes effect: tgs.yaml, or else the last included file that
+// sets one
+func environmentsFile(subscription string) (string, error) {
+	tgsConfig, err := config.ReadTGSConfig()
+	if err != nil {
+		return "", err
+	}
+
+	files := []string{filepath.Join(".tgs", "tgs.yaml")}
+	for i := len(tgsConfig.IncludedFiles) - 1; i >= 0; i-- {
+		files = append(files, tgsConfig.IncludedFiles[i])
+	}
+	for _, file := range files {
+		data, err := project.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return "", fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		if len(doc.Content) > 0 && mappingValue(mappingValue(mappingValue(doc.Content[0], "subscriptions"), subscription), "environments") != nil {
+			return file, nil
+		}
+	}
+	return files[0], nil
+}
+
+// removeFromStack edits the stack node of a stack file and prunes the tree
+func removeFromStack(stackName string, confirm func([]Change) (bool, error), edit func(stack *yaml.Node) error) error {
+	path := filepath.Join(".tgs", "stacks", fmt.Sprintf("%s.yaml", stackName))
+	return removeFrom(path, confirm, func(root *yaml.Node) error {
+		stack := mappingValue(root, "stack")
+		if stack == nil {
+			return fmt.Errorf("stack config has no stack")
+		}
+		return edit(stack)
+	})
+}
+
+// removeFrom edits a configuration file and applies the resulting changes to
+// the tree. The planned changes and the deployed state they orphan are shown
+// before confirm is asked; when the removal is declined or fails the file is
+// restored.
+func removeFrom(path string, confirm func([]Change) (bool, error), edit func(root *yaml.Node) error) error {
+	original, err := project.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(original, &doc); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return fmt.Errorf("%s is empty", path)
+	}
+	if err := edit(doc.Content[0]); err != nil {
+		return err
+	}
+	edited, err := encodeStack(&doc)
+	if err != nil {
+		return err
+	}
+
+	if err := project.WriteFile(path, edited, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	approved := false
+	err = Apply(func(changes []Change) (bool, error) {
+		printDeployedImpact(changes)
+		ok, err := confirm(changes)
+		approved = ok
+		return ok, err
+	})
+	if err != nil || !approved {
+		if restoreErr := project.WriteFile(path, original, 0644); restoreErr != nil {
+			return fmt.Errorf("failed to restore %s: %w", path, restoreErr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if approved {
+		logger.Success("Updated %s", path)
+	}
+	return nil
+}
+
+// printDeployedImpact lists the terragrunt folders a plan removes. Their
+// deployed resources are left running without configuration unless they're
+// destroyed before the folders are pruned.
+func printDeployedImpact(changes []Change) {
+	var leaves []string
+	for _, change := range changes {
+		if change.Type != "remove" || !strings.HasPrefix(change.Path, "architecture/") {
+			continue
+		}
+		root := output.Path(filepath.FromSlash(change.Path))
+		project.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info.IsDir() && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if info.Name() == "terragrunt.hcl" {
+				leaves = append(leaves, filepath.ToSlash(filepath.Dir(path)))
+			}
+			return nil
+		})
+	}
+	if len(leaves) == 0 {
+		return
+	}
+
+	fmt.Println("\nDeployed resources of these folders are no longer managed once they're removed.")
+	fmt.Println("Destroy them first if they should be deleted:")
+	for _, leaf := range leaves {
+		fmt.Printf("  (cd %s && terragrunt destroy)\n", leaf)
+	}
+}
+
+// forEachRegion calls fn with the placements of every region of a stack
+func forEachRegion(stack *yaml.Node, fn func(region string, placements *yaml.Node)) {
+	regions := mappingValue(mappingValue(stack, "architecture"), "regions")
+	if regions == nil {
+		return
+	}
+	for i := 0; i+1 < len(regions.Content); i += 2 {
+		if regions.Content[i+1].Kind == yaml.SequenceNode {
+			fn(regions.Content[i].Value, regions.Content[i+1])
+		}
+	}
+}
+
+// deleteKey removes key from a YAML mapping node, reporting whether it was
+// present
+func deleteKey(node *yaml.Node, key string) bool {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return false
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return true
+		}
+	}
+	return false
+}
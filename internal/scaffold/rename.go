@@ -0,0 +1,185 @@
+package scaffold
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"gopkg.in/yaml.v3"
+)
+
+// RenameComponent renames a component of a stack. The stack file is updated
+// in place, the generated folders of the component are moved and the tree is
+// regenerated. A script per environment copies the Terraform state of the
+// moved instances to their new keys.
+func RenameComponent(stackName, oldName, newName string) error {
+	if newName == "" || strings.ContainsAny(newName, "./\\{} ") {
+		return fmt.Errorf("invalid component name %q", newName)
+	}
+
+	tgsConfig, err := config.ReadTGSConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read TGS config: %w", err)
+	}
+	mainConfig, err := ReadMainConfig(stackName)
+	if err != nil {
+		return fmt.Errorf("failed to read stack config %s: %w", stackName, err)
+	}
+	if _, ok := mainConfig.Stack.Components[oldName]; !ok {
+		return fmt.Errorf("component %s is not defined in stack %s", oldName, stackName)
+	}
+	if _, ok := mainConfig.Stack.Components[newName]; ok {
+		return fmt.Errorf("component %s is already defined in stack %s", newName, stackName)
+	}
+
+	stackPath := filepath.Join(".tgs", "stacks", fmt.Sprintf("%s.yaml", stackName))
+	data, err := project.ReadFile(stackPath)
+	if err != nil {
+		return fmt.Errorf("failed to read stack config: %w", err)
+	}
+	renamed, err := renameInStack(data, oldName, newName)
+	if err != nil {
+		return fmt.Errorf("failed to rename %s in %s: %w", oldName, stackPath, err)
+	}
+
+	infraPath := getInfrastructurePath()
+	moves, err := migrationMoves(infraPath, stackName, config.Migration{Renames: map[string]string{oldName: newName}})
+	if err != nil {
+		return fmt.Errorf("failed to find folders of %s: %w", oldName, err)
+	}
+	leaves, err := moveFolders(infraPath, moves)
+	if err != nil {
+		return err
+	}
+
+	if err := project.WriteFile(stackPath, renamed, 0644); err != nil {
+		return fmt.Errorf("failed to write stack config: %w", err)
+	}
+	logger.Success("Renamed %s to %s in %s", oldName, newName, stackPath)
+
+	if err := Generate(); err != nil {
+		return fmt.Errorf("failed to regenerate infrastructure: %w", err)
+	}
+
+	// One script per environment so state can be migrated as each is rolled out
+	envLeaves := make(map[string][]folderMove)
+	for _, leaf := range leaves {
+		// architecture/<stack>/<sub>/<region>/<env>/...
+		parts := strings.Split(leaf.From, "/")
+		key := parts[2] + "-" + parts[4]
+		envLeaves[key] = append(envLeaves[key], leaf)
+	}
+	var envs []string
+	for env := range envLeaves {
+		envs = append(envs, env)
+	}
+	sort.Strings(envs)
+
+	for _, env := range envs {
+		migration := script{
+			Header: []string{
+				fmt.Sprintf("Moves the Terraform state of component %s of stack %s to %s in %s.", oldName, stackName, newName, env),
+				"Generated by tgs rename. Review, then run once from the repository root",
+				"before planning. Copied state is left at its previous key; delete it once",
+				"the new one is verified.",
+			},
+			Steps: stateCopySteps(tgsConfig, mainConfig.Stack.Components, envLeaves[env]),
+		}
+
+		path := filepath.Join(migrationsDir, fmt.Sprintf("rename-%s-%s-%s-%s.sh", stackName, oldName, newName, env))
+		if err := writeMigrationScript(path, migration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renameInStack renames a component in a stack file, keeping its comments
+// and layout. Dependencies, dependency options and architecture placements
+// referencing the component are updated too.
+func renameInStack(data []byte, oldName, newName string) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse stack config: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, fmt.Errorf("stack config is empty")
+	}
+
+	stack := mappingValue(doc.Content[0], "stack")
+	components := mappingValue(stack, "components")
+	if components == nil {
+		return nil, fmt.Errorf("stack defines no components")
+	}
+
+	renameDep := func(dep string) string {
+		parts := strings.Split(dep, ".")
+		if len(parts) >= 2 && parts[1] == oldName {
+			parts[1] = newName
+		}
+		return strings.Join(parts, ".")
+	}
+
+	for i := 0; i+1 < len(components.Content); i += 2 {
+		if components.Content[i].Value == oldName {
+			components.Content[i].Value = newName
+		}
+
+		component := components.Content[i+1]
+		if deps := mappingValue(component, "deps"); deps != nil {
+			for _, dep := range deps.Content {
+				dep.Value = renameDep(dep.Value)
+			}
+		}
+		if options := mappingValue(component, "dependency_options"); options != nil {
+			for j := 0; j < len(options.Content); j += 2 {
+				options.Content[j].Value = renameDep(options.Content[j].Value)
+			}
+		}
+	}
+
+	if regions := mappingValue(mappingValue(stack, "architecture"), "regions"); regions != nil {
+		for i := 1; i < len(regions.Content); i += 2 {
+			for _, placement := range regions.Content[i].Content {
+				if component := mappingValue(placement, "component"); component != nil && component.Value == oldName {
+					component.Value = newName
+				}
+			}
+		}
+	}
+
+	return encodeStack(&doc)
+}
+
+// encodeStack encodes an edited stack file with the two space indentation of
+// the stack templates
+func encodeStack(doc *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, fmt.Errorf("failed to encode stack config: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode stack config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// mappingValue returns the value of key in a YAML mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
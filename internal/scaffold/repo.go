@@ -0,0 +1,208 @@
+package scaffold
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+)
+
+// repoHeader marks the repository files generated by tgs scaffold repo, which
+// are safe to overwrite
+const repoHeader = "Generated by tgs from .tgs/tgs.yaml. Run tgs scaffold repo to update it."
+
+// gitignoreEntries are the caches and local files of terragrunt, terraform
+// and tgs kept out of git
+var gitignoreEntries = []string{
+	".terragrunt-cache/",
+	".terragrunt-stack/",
+	".terraform/",
+	"*.tfplan",
+	"crash.log",
+	".tgs/lock",
+	".tgs/cache/",
+}
+
+// ScaffoldRepo writes the repository files around the generated tree: a
+// .gitignore for the terragrunt caches, a CODEOWNERS from the owners of
+// tgs.yaml and a README describing the layout. Entries missing from an
+// existing .gitignore are appended; a CODEOWNERS or README that wasn't
+// generated by tgs is left alone.
+func ScaffoldRepo() error {
+	tgsConfig, err := config.ReadTGSConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read TGS config: %w", err)
+	}
+
+	if err := updateGitignore(".gitignore"); err != nil {
+		return err
+	}
+
+	owners := tgsConfig.Owners
+	if len(owners.Default) > 0 || len(owners.Stacks) > 0 || len(owners.Environments) > 0 {
+		if err := writeRepoFile("CODEOWNERS", "# "+repoHeader+"\n"+renderCodeowners(tgsConfig)); err != nil {
+			return err
+		}
+	}
+
+	return writeRepoFile("README.md", "<!-- "+repoHeader+" -->\n"+renderRepoReadme(tgsConfig))
+}
+
+// updateGitignore appends the missing gitignoreEntries to path
+func updateGitignore(path string) error {
+	data, err := project.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	existing := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		existing[strings.TrimSpace(line)] = true
+	}
+
+	var missing []string
+	for _, entry := range gitignoreEntries {
+		if !existing[entry] {
+			missing = append(missing, entry)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	content := string(data)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	if content != "" {
+		content += "\n"
+	}
+	content += "# Terragrunt caches and local tgs files\n" + strings.Join(missing, "\n") + "\n"
+	if err := createFile(path, content); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	logger.Success("Added %d entries to %s", len(missing), path)
+	return nil
+}
+
+// writeRepoFile writes a repository file unless one that wasn't generated by
+// tgs exists
+func writeRepoFile(path, content string) error {
+	if data, err := project.ReadFile(path); err == nil && !strings.Contains(firstLine(string(data)), repoHeader) {
+		logger.Warning("%s exists and wasn't generated by tgs, leaving it alone", path)
+		return nil
+	}
+	if err := createFile(path, content); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	logger.Success("Generated %s", path)
+	return nil
+}
+
+func firstLine(content string) string {
+	line, _, _ := strings.Cut(content, "\n")
+	return line
+}
+
+// renderCodeowners renders the rules of CODEOWNERS. Paths are relative to
+// the repository root, so a workspace's rules can be merged into the
+// CODEOWNERS of its repository.
+func renderCodeowners(tgsConfig *config.TGSConfig) string {
+	owners := tgsConfig.Owners
+	root := "/" + output.RepoPath()
+
+	var b strings.Builder
+	if len(owners.Default) > 0 {
+		fmt.Fprintf(&b, "\n* %s\n", strings.Join(owners.Default, " "))
+	}
+
+	var stacks []string
+	for stack := range owners.Stacks {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+	for _, stack := range stacks {
+		teams := strings.Join(owners.Stacks[stack], " ")
+		fmt.Fprintf(&b, "\n# Stack %s\n", stack)
+		fmt.Fprintf(&b, "/.tgs/stacks/%s.yaml %s\n", stack, teams)
+		for _, dir := range []string{"_components", "_units", "architecture", "config"} {
+			fmt.Fprintf(&b, "%s/%s/%s/ %s\n", root, dir, stack, teams)
+		}
+	}
+
+	var envs []string
+	for env := range owners.Environments {
+		envs = append(envs, env)
+	}
+	sort.Strings(envs)
+	for _, env := range envs {
+		teams := strings.Join(owners.Environments[env], " ")
+		fmt.Fprintf(&b, "\n# Environment %s\n", env)
+		fmt.Fprintf(&b, "%s/architecture/*/*/*/%s/ %s\n", root, env, teams)
+		fmt.Fprintf(&b, "%s/config/*/environments/*/%s.env.hcl %s\n", root, env, teams)
+	}
+	return b.String()
+}
+
+// renderRepoReadme renders the README of the repository: the layout of the
+// generated tree, its stacks and environments and the common commands
+func renderRepoReadme(tgsConfig *config.TGSConfig) string {
+	dir := output.Dir()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", tgsConfig.Name)
+	fmt.Fprintf(&b, "Terragrunt infrastructure generated by [tgs](https://github.com/davoodharun/terragrunt-scaffolder) from the configuration in `.tgs`. Don't edit the files in `%s`: change `.tgs/tgs.yaml` or a stack file and run `tgs generate`.\n\n", dir)
+
+	b.WriteString("## Layout\n\n```\n")
+	rows := [][2]string{
+		{".tgs/tgs.yaml", "project, subscriptions, environments and naming"},
+		{".tgs/stacks/<stack>.yaml", "components of a stack and the regions they're deployed to"},
+		{dir + "/root.hcl", "remote state and provider settings shared by every unit"},
+		{dir + "/_components/<stack>/<component>/", "Terraform module and component.hcl of a component"},
+		{dir + "/architecture/<stack>/<subscription>/<region>/<environment>/<component>/[<app>/]", "terragrunt.hcl of a deployed component"},
+		{dir + "/config/<stack>/", "environment, app settings and policy files"},
+		{"Makefile, tasks.ps1", "terragrunt run-all targets per environment and region"},
+	}
+	for _, row := range rows {
+		fmt.Fprintf(&b, "%s\n    %s\n", row[0], row[1])
+	}
+	b.WriteString("```\n")
+
+	var subs []string
+	for sub := range tgsConfig.Subscriptions {
+		subs = append(subs, sub)
+	}
+	sort.Strings(subs)
+
+	b.WriteString("\n## Environments\n\n| Subscription | Environment | Stack | Components |\n| --- | --- | --- | --- |\n")
+	for _, sub := range subs {
+		for _, env := range tgsConfig.Subscriptions[sub].Environments {
+			stackName := stackOf(env)
+			var components []string
+			if mainConfig, err := ReadMainConfig(stackName); err == nil {
+				for name := range mainConfig.Stack.Components {
+					components = append(components, name)
+				}
+				sort.Strings(components)
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", sub, env.Name, stackName, strings.Join(components, ", "))
+		}
+	}
+
+	b.WriteString(`
+## Common Tasks
+
+` + "```bash" + `
+tgs validate            # check the configuration
+tgs plan                # preview the changes to the generated tree
+tgs generate            # regenerate the tree
+make plan-<env>         # terragrunt plan of every region of an environment
+./tasks.ps1 plan-<env>  # the same on Windows
+` + "```" + `
+`)
+	return b.String()
+}
@@ -4,12 +4,18 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
+	"text/template"
+	"time"
 
 	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/events"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/lock"
 	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/naming"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/templates"
 	"github.com/davoodharun/terragrunt-scaffolder/internal/validate"
-	"gopkg.in/yaml.v3"
 )
 
 type TerraformProvider struct {
@@ -23,22 +29,35 @@ type SchemaAttribute struct {
 	Required    bool        `json:"required"`
 	Optional    bool        `json:"optional"`
 	Computed    bool        `json:"computed"`
+	Sensitive   bool        `json:"sensitive"`
 	Description string      `json:"description"`
 }
 
+// SchemaBlock is a block of a resource schema, the resource itself or one
+// of its nested blocks
+type SchemaBlock struct {
+	Attributes map[string]SchemaAttribute `json:"attributes"`
+	BlockTypes map[string]SchemaBlockType `json:"block_types"`
+}
+
+// SchemaBlockType is a nested block of a resource schema. NestingMode is
+// single, group, list, set or map; MinItems and MaxItems bound the number of
+// blocks, a MinItems of 1 makes the block required.
+type SchemaBlockType struct {
+	Block       SchemaBlock `json:"block"`
+	NestingMode string      `json:"nesting_mode"`
+	MinItems    int         `json:"min_items"`
+	MaxItems    int         `json:"max_items"`
+}
+
+// ResourceSchema is the schema of a resource type
+type ResourceSchema struct {
+	Block SchemaBlock `json:"block"`
+}
+
 type ProviderSchema struct {
 	ProviderSchema map[string]struct {
-		ResourceSchemas map[string]struct {
-			Block struct {
-				Attributes map[string]SchemaAttribute `json:"attributes"`
-				BlockTypes map[string]struct {
-					Block struct {
-						Attributes map[string]SchemaAttribute `json:"attributes"`
-					} `json:"block"`
-					NestingMode string `json:"nesting_mode"`
-				} `json:"block_types"`
-			} `json:"block"`
-		} `json:"resource_schemas"`
+		ResourceSchemas map[string]ResourceSchema `json:"resource_schemas"`
 	} `json:"provider_schemas"`
 }
 
@@ -49,6 +68,23 @@ type SchemaCache struct {
 
 var schemaCache *SchemaCache
 
+func init() {
+	registerTemplateFuncs(naming.NewPrefixes(config.PrefixConfig{}))
+}
+
+// registerTemplateFuncs exposes the naming helpers and the output path to
+// templates, including user overrides
+func registerTemplateFuncs(prefixes *naming.Prefixes) {
+	templates.RegisterFuncs(template.FuncMap{
+		"regionPrefix": prefixes.Region,
+		"envPrefix":    prefixes.Environment,
+		"abbreviation": naming.Abbreviation,
+		"outputPath":   output.RepoPath,
+		"hclString":    hclString,
+		"hclKey":       hclKey,
+	})
+}
+
 func initSchemaCache() (*SchemaCache, error) {
 	if schemaCache != nil {
 		return schemaCache, nil
@@ -66,78 +102,173 @@ func initSchemaCache() (*SchemaCache, error) {
 	return schemaCache, nil
 }
 
-// Update the function to get the infrastructure path
+// getInfrastructurePath returns the absolute path of the output directory,
+// creating it if needed
 func getInfrastructurePath() string {
-	// Get the current working directory
-	cwd, err := os.Getwd()
+	// Resolve the output directory in the project directory
+	infraPath, err := project.Abs(output.Dir())
 	if err != nil {
-		logger.Warning("Failed to get current working directory: %v", err)
-		return ".infrastructure"
+		logger.Warning("Failed to get project directory: %v", err)
+		return output.Dir()
 	}
 
-	// Check if .infrastructure exists in the current directory
-	infraPath := filepath.Join(cwd, ".infrastructure")
-	if _, err := os.Stat(infraPath); err == nil {
+	// Check if the output directory exists
+	if _, err := project.Stat(infraPath); err == nil {
 		return infraPath
 	}
 
 	// If not found, create it
-	if err := os.MkdirAll(infraPath, 0755); err != nil {
-		logger.Warning("Failed to create .infrastructure directory: %v", err)
-		return ".infrastructure"
+	if err := project.MkdirAll(infraPath, 0755); err != nil {
+		logger.Warning("Failed to create %s directory: %v", output.Dir(), err)
+		return output.Dir()
 	}
 
 	return infraPath
 }
 
 func Generate() error {
-	// Get the infrastructure path
+	release, err := lock.Acquire("generate")
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	start := time.Now()
+	output.ResetSummary()
 	infraPath := getInfrastructurePath()
 
-	// Read TGS config
 	tgsConfig, err := config.ReadTGSConfig()
 	if err != nil {
 		return fmt.Errorf("failed to read TGS config: %w", err)
 	}
+	if err := runHooks("pre_generate", tgsConfig.Hooks.PreGenerate, infraPath); err != nil {
+		return err
+	}
 
-	// Validate TGS config
-	if errors := validate.ValidateTGSConfig(tgsConfig); len(errors) > 0 {
-		return fmt.Errorf("TGS config validation failed: %v", errors[0])
+	// Move folders of bumped stacks before regenerating over them
+	if err := migrate(infraPath); err != nil {
+		return fmt.Errorf("failed to migrate infrastructure: %w", err)
 	}
-	logger.Success("TGS configuration validation passed")
 
-	// Track processed stacks to avoid duplicate validation
-	processedStacks := make(map[string]bool)
+	if err := generate(infraPath); err != nil {
+		return err
+	}
+	return finishGeneration(tgsConfig, infraPath, start)
+}
 
-	// Validate all stacks referenced in environments
+// finishGeneration runs the steps following the generation of the tree into
+// infraPath, shared by generate and apply: it reports unresolved variables,
+// writes the files outside the tree and the manifest and runs the
+// post_generate hooks
+func finishGeneration(tgsConfig *config.TGSConfig, infraPath string, start time.Time) error {
+	reportUnresolvedVariables(tgsConfig)
+
+	// The Makefile lives at the repository root, outside the rendered tree
+	if err := generateMakefile(tgsConfig); err != nil {
+		return err
+	}
+	if err := generateOPAPolicies(tgsConfig); err != nil {
+		return err
+	}
+
+	// Record the stack versions so later version bumps can be migrated, and
+	// what this run changed
+	summary := output.CurrentSummary()
+	duration := time.Since(start).Round(time.Millisecond)
+	if err := writeManifest(tgsConfig, infraPath, &ManifestRun{
+		Created:   summary.Created,
+		Updated:   summary.Updated,
+		Unchanged: summary.Unchanged,
+		Duration:  duration.String(),
+	}); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	logger.Info("Wrote %d files in %s: %d created, %d updated, %d unchanged", summary.Total(), duration, summary.Created, summary.Updated, summary.Unchanged)
+
+	return runHooks("post_generate", tgsConfig.Hooks.PostGenerate, infraPath)
+}
+
+// reportUnresolvedVariables warns about the required variables of the
+// generated modules that no input sets, which would stop terragrunt plan
+func reportUnresolvedVariables(tgsConfig *config.TGSConfig) {
+	reported := make(map[string]bool)
 	for _, sub := range tgsConfig.Subscriptions {
 		for _, env := range sub.Environments {
 			stackName := "main"
 			if env.Stack != "" {
 				stackName = env.Stack
 			}
-
-			// Skip if we've already validated this stack
-			if processedStacks[stackName] {
+			if reported[stackName] {
 				continue
 			}
-			processedStacks[stackName] = true
+			reported[stackName] = true
 
-			// Read and validate the stack
 			mainConfig, err := ReadMainConfig(stackName)
 			if err != nil {
-				return fmt.Errorf("failed to read stack config %s: %w", stackName, err)
+				continue
 			}
-
-			if errors := validate.ValidateStack(mainConfig); len(errors) > 0 {
-				return fmt.Errorf("stack '%s' validation failed: %v", stackName, errors[0])
+			for _, finding := range validate.ValidateRequiredVariables(stackName, mainConfig, false) {
+				logger.Warning("%v", finding)
 			}
-			logger.Success("Stack '%s' validation passed", stackName)
 		}
 	}
+}
+
+// checkReport publishes the findings of a validation report and logs its
+// warnings, returning its first error
+func checkReport(report validate.Report) error {
+	events.ValidationFindings(report.File, report.Findings)
+	for _, warning := range validate.Warnings(report.Findings) {
+		logger.Warning("%v", warning)
+	}
+	if errors := validate.Errors(report.Findings); len(errors) > 0 {
+		return errors[0]
+	}
+	return nil
+}
+
+// generate renders the complete infrastructure tree into infraPath
+func generate(infraPath string) error {
+	// Read TGS config
+	tgsConfig, err := config.ReadTGSConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read TGS config: %w", err)
+	}
+
+	// Validate TGS config, the stacks of its environments and their prefixes
+	report := validate.Project(tgsConfig, validate.Options{Stacks: true})
+	if err := checkReport(report.Config); err != nil {
+		return fmt.Errorf("TGS config validation failed: %v", err)
+	}
+	logger.Success("TGS configuration validation passed")
+
+	// Render prefixes configured in tgs.yaml in templates
+	registerTemplateFuncs(naming.NewPrefixes(tgsConfig.Prefixes))
+
+	// Compare the configuration with the one the tree was generated from
+	fingerprints, err = newFingerprints(tgsConfig, infraPath)
+	if err != nil {
+		return err
+	}
+
+	// Validate all stacks referenced in environments
+	for _, stackReport := range report.Stacks {
+		if err := checkReport(stackReport); err != nil {
+			return fmt.Errorf("stack '%s' validation failed: %v", stackReport.Stack, err)
+		}
+		if _, err := fingerprints.record("stack:"+stackReport.Stack, report.StackConfigs[stackReport.Stack].Stack); err != nil {
+			return err
+		}
+		logger.Success("Stack '%s' validation passed", stackReport.Stack)
+	}
+
+	// Prefixes must tell the deployments of all stacks apart
+	if err := checkReport(report.Prefixes); err != nil {
+		return fmt.Errorf("naming validation failed: %v", err)
+	}
 
 	// Create infrastructure directory if it doesn't exist
-	if err := os.MkdirAll(infraPath, 0755); err != nil {
+	if err := project.MkdirAll(infraPath, 0755); err != nil {
 		return fmt.Errorf("failed to create infrastructure directory: %w", err)
 	}
 	logger.Success("Infrastructure folder created")
@@ -148,6 +279,11 @@ func Generate() error {
 	}
 	logger.Success("Generated root.hcl")
 
+	// Pin tool versions for version managers
+	if err := generateToolVersions(tgsConfig.Tooling, infraPath); err != nil {
+		return fmt.Errorf("failed to generate tool version files: %w", err)
+	}
+
 	// Generate environment config files
 	if err := generateEnvironmentConfigs(tgsConfig, infraPath); err != nil {
 		return fmt.Errorf("failed to generate environment config files: %w", err)
@@ -156,6 +292,7 @@ func Generate() error {
 	// First pass: collect all unique components and their configurations by stack
 	stackComponents := make(map[string]map[string]config.Component)
 	stackArchitectures := make(map[string]config.ArchitectureConfig)
+	stackExternalDependencies := make(map[string]map[string]config.ExternalDependency)
 	for _, sub := range tgsConfig.Subscriptions {
 		for _, env := range sub.Environments {
 			stackName := "main"
@@ -180,15 +317,18 @@ func Generate() error {
 
 			// Store the architecture configuration
 			stackArchitectures[stackName] = mainConfig.Stack.Architecture
+			stackExternalDependencies[stackName] = mainConfig.Stack.ExternalDependencies
 		}
 	}
 
 	// Create components directory
 	componentsDir := filepath.Join(infraPath, "_components")
-	if err := os.MkdirAll(componentsDir, 0755); err != nil {
+	if err := project.MkdirAll(componentsDir, 0755); err != nil {
 		return fmt.Errorf("failed to create components directory: %w", err)
 	}
 
+	usedSharedModules = make(map[string]bool)
+
 	// Generate components for each stack
 	for stackName, components := range stackComponents {
 		// Start progress bar for component generation
@@ -196,9 +336,10 @@ func Generate() error {
 
 		mainConfig := &config.MainConfig{
 			Stack: config.StackConfig{
-				Name:         stackName,
-				Components:   components,
-				Architecture: stackArchitectures[stackName],
+				Name:                 stackName,
+				Components:           components,
+				Architecture:         stackArchitectures[stackName],
+				ExternalDependencies: stackExternalDependencies[stackName],
 			},
 		}
 
@@ -208,6 +349,11 @@ func Generate() error {
 		}
 	}
 
+	// Remove the shared modules no component uses anymore
+	if err := pruneSharedModules(componentsDir); err != nil {
+		return err
+	}
+
 	// Process each subscription for environment structure
 	for subName, sub := range tgsConfig.Subscriptions {
 		// Process each environment with its specified stack
@@ -225,6 +371,15 @@ func Generate() error {
 
 			// Generate environment structure without re-validating components
 			for region, components := range mainConfig.Stack.Architecture.Regions {
+				key := environmentKey(stackName, subName, region, env.Name)
+				envPath := filepath.Join(infraPath, "architecture", stackName, subName, region, env.Name)
+				unchanged, err := fingerprints.unchanged(key, envPath, environmentInputs(tgsConfig, mainConfig, region, components)...)
+				if err != nil {
+					return err
+				}
+				if unchanged {
+					continue
+				}
 				if err := generateEnvironment(subName, region, env.Name, components, infraPath); err != nil {
 					return fmt.Errorf("failed to generate environment structure: %w", err)
 				}
@@ -232,6 +387,9 @@ func Generate() error {
 		}
 	}
 	logger.Success("Generated architecture scaffolding")
+	if skipped := fingerprints.skipped; len(skipped) > 0 {
+		logger.Info("Skipped %d components and %d environments whose configuration didn't change", skipped["component"], skipped["environment"])
+	}
 
 	return nil
 }
@@ -240,59 +398,49 @@ func cleanupSchemaCache() {
 	if schemaCache != nil {
 		// Clean up .terraform directory
 		tfDir := filepath.Join(schemaCache.CachePath, ".terraform")
-		if err := os.RemoveAll(tfDir); err != nil {
-			fmt.Printf("Warning: failed to remove .terraform directory: %v\n", err)
+		if err := project.RemoveAll(tfDir); err != nil {
+			logger.Warning("Failed to remove .terraform directory: %v", err)
 		}
 		// Clean up cache directory
-		if err := os.RemoveAll(schemaCache.CachePath); err != nil {
-			fmt.Printf("Warning: failed to remove cache directory: %v\n", err)
+		if err := project.RemoveAll(schemaCache.CachePath); err != nil {
+			logger.Warning("Failed to remove cache directory: %v", err)
 		}
 	}
 }
 
 // ReadMainConfig reads the stack configuration from the .tgs/stacks directory
 func ReadMainConfig(stackName string) (*config.MainConfig, error) {
-	stackPath := filepath.Join(".tgs", "stacks", fmt.Sprintf("%s.yaml", stackName))
-	data, err := os.ReadFile(stackPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read stack config: %w", err)
-	}
-
-	var mainConfig config.MainConfig
-	if err := yaml.Unmarshal(data, &mainConfig); err != nil {
-		return nil, fmt.Errorf("failed to parse stack config: %w", err)
-	}
-
-	return &mainConfig, nil
+	return config.ReadMainConfig(stackName)
 }
 
 func createFile(path string, content string) error {
-	// Ensure the parent directory exists
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	// Files already holding the content aren't rewritten
+	changed, err := output.WriteFile(path, []byte(content))
+	if err != nil {
+		return err
 	}
-
-	return os.WriteFile(path, []byte(content), 0644)
+	if changed {
+		events.FileWritten(path)
+	}
+	return nil
 }
 
 // getConfigDir returns the path to the .tgs config directory
 func getConfigDir() string {
-	// Get the current working directory
-	cwd, err := os.Getwd()
+	// Resolve .tgs in the project directory
+	configPath, err := project.Abs(".tgs")
 	if err != nil {
-		logger.Warning("Failed to get current working directory: %v", err)
+		logger.Warning("Failed to get project directory: %v", err)
 		return ".tgs"
 	}
 
-	// Check if .tgs exists in the current directory
-	configPath := filepath.Join(cwd, ".tgs")
-	if _, err := os.Stat(configPath); err == nil {
+	// Check if .tgs exists
+	if _, err := project.Stat(configPath); err == nil {
 		return configPath
 	}
 
 	// If not found, create it
-	if err := os.MkdirAll(configPath, 0755); err != nil {
+	if err := project.MkdirAll(configPath, 0755); err != nil {
 		logger.Warning("Failed to create .tgs directory: %v", err)
 		return ".tgs"
 	}
@@ -306,65 +454,10 @@ func getStacksDir() string {
 	stacksDir := filepath.Join(configDir, "stacks")
 
 	// Create stacks directory if it doesn't exist
-	if err := os.MkdirAll(stacksDir, 0755); err != nil {
+	if err := project.MkdirAll(stacksDir, 0755); err != nil {
 		logger.Warning("Failed to create stacks directory: %v", err)
 		return filepath.Join(".tgs", "stacks")
 	}
 
 	return stacksDir
 }
-
-// GetRegionPrefix returns a prefix for a region
-func GetRegionPrefix(region string) string {
-	regionPrefixMap := map[string]string{
-		"eastus":        "E",
-		"eastus2":       "E2",
-		"canadacentral": "CC",
-		"canadaeast":    "CE",
-		"westus":        "W",
-		"westus2":       "W2",
-		"centralus":     "C",
-		"northeurope":   "NE",
-		"westeurope":    "WE",
-		"uksouth":       "UKS",
-		"ukwest":        "UKW",
-		"southeastasia": "SEA",
-		"eastasia":      "EA",
-	}
-
-	// Check if we have a predefined prefix
-	if prefix, ok := regionPrefixMap[region]; ok {
-		return prefix
-	}
-
-	// Default to first letter uppercase if not in map
-	if len(region) > 0 {
-		return strings.ToUpper(region[0:1])
-	}
-
-	return "R" // Default fallback
-}
-
-// Helper function to get a single letter prefix for an environment
-func getEnvironmentPrefix(env string) string {
-	envPrefixMap := map[string]string{
-		"dev":   "D",
-		"test":  "T",
-		"stage": "S",
-		"prod":  "P",
-		"qa":    "Q",
-		"uat":   "U",
-	}
-
-	// Check if we have a predefined prefix
-	if prefix, ok := envPrefixMap[env]; ok {
-		return prefix
-	}
-
-	// Default to first letter uppercase if not in map
-	if len(env) > 0 {
-		return strings.ToUpper(env[0:1])
-	}
-
-	return "E" // Default fallback
-}
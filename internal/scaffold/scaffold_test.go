@@ -1,10 +1,29 @@
 package scaffold
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
 	"strings"
 	"testing"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/naming"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/template"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/templates"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/tryfunc"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+	"gopkg.in/yaml.v3"
 )
 
 // TestPath defines the structure for test path validation
@@ -128,7 +147,7 @@ subscriptions:
 			errContains: "version property must be filled",
 		},
 		{
-			name: "Missing component description",
+			name: "Missing component description is only a warning",
 			tgsConfig: `name: projecta
 subscriptions:
   nonprod:
@@ -146,9 +165,13 @@ subscriptions:
     redis:
       source: azurerm_redis_cache
       provider: azurerm
-      version: 4.22.0`,
-			wantErr:     true,
-			errContains: "description property must be filled",
+      version: 4.22.0
+  architecture:
+    regions:
+      eastus2:
+        - component: redis
+          apps: []`,
+			wantErr: false,
 		},
 		{
 			name: "Invalid dependency format",
@@ -236,6 +259,44 @@ subscriptions:
 			wantErr:     true,
 			errContains: "invalid region in dependency",
 		},
+		{
+			name: "Circular dependency",
+			tgsConfig: `name: projecta
+subscriptions:
+  nonprod:
+    remotestate:
+      name: stprojectanonprodtf
+      resource_group: rg-projecta-nonprod-tf
+    environments:
+      - name: dev
+        stack: main`,
+			stackConfig: `stack:
+  name: main
+  version: "1.0.0"
+  description: "Test stack"
+  components:
+    appservice:
+      source: azurerm_app_service
+      provider: azurerm
+      version: 4.22.0
+      description: "App service"
+      deps:
+        - "{region}.functionapp"
+    functionapp:
+      source: azurerm_linux_function_app
+      provider: azurerm
+      version: 4.22.0
+      description: "Function app"
+      deps:
+        - "{region}.appservice"
+  architecture:
+    regions:
+      eastus2:
+        - component: appservice
+        - component: functionapp`,
+			wantErr:     true,
+			errContains: "dependency cycle detected: eastus2.appservice -> eastus2.functionapp -> eastus2.appservice",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -286,7 +347,2129 @@ subscriptions:
 				}
 			} else if err != nil {
 				t.Errorf("Generate() unexpected error: %v", err)
+			} else {
+				checkForwardSlashes(t, filepath.Join(tmpDir, ".infrastructure"))
+			}
+		})
+	}
+}
+
+// checkForwardSlashes fails for paths of generated HCL using backslashes,
+// which break trees generated on Windows everywhere else
+func checkForwardSlashes(t *testing.T, root string) {
+	t.Helper()
+	pathAttribute := regexp.MustCompile(`^\s*(source|config_path|path)\s*=\s*".*\\`)
+	filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || filepath.Ext(path) != ".hcl" {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			if pathAttribute.MatchString(line) {
+				t.Errorf("%s uses a backslash in a path: %s", path, strings.TrimSpace(line))
+			}
+		}
+		return nil
+	})
+}
+
+func TestMigrationMoves(t *testing.T) {
+	infraPath := t.TempDir()
+	for _, dir := range []string{
+		"architecture/main/nonprod/eastus2/dev/redis",
+		"architecture/main/nonprod/westus2/dev/keyvault",
+		"_components/main/redis",
+		"config/main/app_settings_redis",
+	} {
+		if err := os.MkdirAll(filepath.Join(infraPath, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	moves, err := migrationMoves(infraPath, "main", config.Migration{
+		Version: "1.1.0",
+		Renames: map[string]string{"redis": "cache"},
+		Moves:   []config.Move{{From: "westus2.keyvault", To: "eastus2.keyvault"}},
+	})
+	if err != nil {
+		t.Fatalf("migrationMoves() unexpected error: %v", err)
+	}
+
+	want := []folderMove{
+		{From: "architecture/main/nonprod/eastus2/dev/redis", To: "architecture/main/nonprod/eastus2/dev/cache"},
+		{From: "_components/main/redis", To: "_components/main/cache"},
+		{From: "config/main/app_settings_redis", To: "config/main/app_settings_cache"},
+		{From: "architecture/main/nonprod/westus2/dev/keyvault", To: "architecture/main/nonprod/eastus2/dev/keyvault"},
+	}
+	if !reflect.DeepEqual(moves, want) {
+		t.Errorf("migrationMoves() =\n%+v\nwant\n%+v", moves, want)
+	}
+}
+
+func TestRenameInStack(t *testing.T) {
+	stack := `stack:
+  name: main
+  components:
+    # Cache of the API
+    redis:
+      source: azurerm_redis_cache
+    appservice:
+      source: azurerm_linux_web_app
+      deps:
+        - "{region}.redis"
+        - "eastus2.redis.{app}"
+        - "{region}.serviceplan"
+      dependency_options:
+        "{region}.redis":
+          skip_outputs: true
+  architecture:
+    regions:
+      eastus2:
+        - component: redis
+        - component: appservice
+          apps: [api]
+`
+
+	got, err := renameInStack([]byte(stack), "redis", "cache")
+	if err != nil {
+		t.Fatalf("renameInStack() unexpected error: %v", err)
+	}
+
+	want := strings.NewReplacer(
+		"    redis:", "    cache:",
+		"{region}.redis", "{region}.cache",
+		"eastus2.redis.{app}", "eastus2.cache.{app}",
+		"component: redis", "component: cache",
+	).Replace(stack)
+	if string(got) != want {
+		t.Errorf("renameInStack() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRemoveApp(t *testing.T) {
+	stack := `stack:
+  name: main
+  architecture:
+    regions:
+      eastus2:
+        - component: appservice
+          apps:
+            - api
+            - name: web
+              sku: P1v3
+      westus2:
+        - component: appservice
+          apps: [api, web]
+`
+
+	testCases := []struct {
+		name   string
+		app    string
+		region string
+		found  bool
+		want   map[string][]string
+	}{
+		{name: "scalar app in every region", app: "api", found: true, want: map[string][]string{"eastus2": {"web"}, "westus2": {"web"}}},
+		{name: "object app", app: "web", region: "eastus2", found: true, want: map[string][]string{"eastus2": {"api"}, "westus2": {"api", "web"}}},
+		{name: "object app in every region", app: "web", found: true, want: map[string][]string{"eastus2": {"api"}, "westus2": {"api"}}},
+		{name: "unknown app", app: "worker", want: map[string][]string{"eastus2": {"api", "web"}, "westus2": {"api", "web"}}},
+		{name: "other region", app: "web", region: "centralus", want: map[string][]string{"eastus2": {"api", "web"}, "westus2": {"api", "web"}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(stack), &doc); err != nil {
+				t.Fatal(err)
+			}
+			if found := removeApp(mappingValue(doc.Content[0], "stack"), "appservice", tc.app, tc.region); found != tc.found {
+				t.Errorf("removeApp(%s) = %v, want %v", tc.app, found, tc.found)
+			}
+
+			data, err := encodeStack(&doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var edited config.MainConfig
+			if err := yaml.Unmarshal(data, &edited); err != nil {
+				t.Fatalf("edited stack doesn't parse: %v\n%s", err, data)
+			}
+			got := make(map[string][]string)
+			for region, placements := range edited.Stack.Architecture.Regions {
+				for _, placement := range placements {
+					got[region] = append(got[region], placement.Apps...)
+				}
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("apps after removeApp(%s) = %v, want %v", tc.app, got, tc.want)
 			}
 		})
 	}
 }
+
+func TestAddToStack(t *testing.T) {
+	stack := `stack:
+  name: main
+  components:
+    redis:
+      source: azurerm_redis_cache
+  architecture:
+    regions:
+      eastus2:
+        - component: redis
+`
+
+	got, err := addToStack([]byte(stack), []stackAddition{{
+		Name: "keyvault",
+		Component: &config.Component{
+			Source:      "azurerm_key_vault",
+			Provider:    "azurerm",
+			Version:     "4.22.0",
+			Description: "Secrets",
+			Deps:        []string{"{region}.redis"},
+		},
+		Regions: []string{"westus2", "eastus2"},
+		Apps:    []string{"api"},
+	}})
+	if err != nil {
+		t.Fatalf("addToStack() unexpected error: %v", err)
+	}
+
+	want := `stack:
+  name: main
+  components:
+    redis:
+      source: azurerm_redis_cache
+    keyvault:
+      source: azurerm_key_vault
+      provider: azurerm
+      version: 4.22.0
+      description: Secrets
+      deps:
+        - "{region}.redis"
+  architecture:
+    regions:
+      eastus2:
+        - component: redis
+        - component: keyvault
+          apps: [api]
+      westus2:
+        - component: keyvault
+          apps: [api]
+`
+	if string(got) != want {
+		t.Errorf("addToStack() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGenerateOutputsTF(t *testing.T) {
+	attributes := map[string]map[string]SchemaAttribute{
+		"azurerm_redis_cache": {
+			"id":                        {Computed: true},
+			"name":                      {Required: true},
+			"hostname":                  {Computed: true, Description: "The Hostname of the Redis Instance"},
+			"primary_connection_string": {Computed: true, Sensitive: true},
+			"capacity":                  {Required: true},
+		},
+	}
+	comp := config.Component{Source: "azurerm_redis_cache", Outputs: config.Outputs{All: true}}
+
+	content, err := generateOutputsTF(comp, attributes)
+	if err != nil {
+		t.Fatalf("generateOutputsTF() unexpected error: %v", err)
+	}
+	for _, want := range []string{`output "id"`, `output "azurerm_redis_cache_name"`, `output "hostname"`, "resource.azurerm_redis_cache.this.primary_connection_string\n  description = \"The primary_connection_string of the azurerm_redis_cache\"\n  sensitive   = true"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("outputs.tf is missing %q:\n%s", want, content)
+		}
+	}
+	if strings.Contains(content, `output "capacity"`) {
+		t.Errorf("outputs.tf exports the non-computed capacity:\n%s", content)
+	}
+
+	comp.Outputs = config.Outputs{Names: []string{"port"}}
+	if _, err := generateOutputsTF(comp, attributes); err == nil {
+		t.Error("generateOutputsTF() with an unknown attribute should fail")
+	}
+	comp.Outputs = config.Outputs{Names: []string{"azurerm_key_vault.vault_uri"}}
+	if _, err := generateOutputsTF(comp, attributes); err == nil {
+		t.Error("generateOutputsTF() with an output of another resource should fail")
+	}
+
+	webApp := config.Component{Source: "azurerm_linux_web_app", Slots: []string{"staging"}}
+	content, err = generateOutputsTF(webApp, nil)
+	if err != nil {
+		t.Fatalf("generateOutputsTF() unexpected error: %v", err)
+	}
+	if !strings.Contains(content, "for name, slot in resource.azurerm_linux_web_app_slot.this : name => slot.default_hostname") {
+		t.Errorf("outputs.tf is missing the slot hostnames:\n%s", content)
+	}
+}
+
+func TestGenerateProviderTF(t *testing.T) {
+	comp := config.Component{
+		Provider: "azurerm",
+		Version:  "4.22.0",
+		Providers: []config.ProviderRequirement{
+			{Name: "azapi", Source: "Azure/azapi", Version: "2.2.0"},
+			{Name: "random", Version: "3.6.3"},
+		},
+	}
+
+	content := generateProviderTF(comp)
+	want := `  required_providers {
+    azurerm = {
+      source  = "hashicorp/azurerm"
+      version = "4.22.0"
+    }
+    azapi = {
+      source  = "Azure/azapi"
+      version = "2.2.0"
+    }
+    random = {
+      source  = "hashicorp/random"
+      version = "3.6.3"
+    }
+  }
+`
+	if !strings.Contains(content, want) {
+		t.Errorf("provider.tf required_providers = %s, want:\n%s", content, want)
+	}
+	// Only azurerm is configured, others use their default configuration
+	if strings.Count(content, "provider \"") != 1 {
+		t.Errorf("provider.tf configures more than azurerm:\n%s", content)
+	}
+
+	comp.Providers = nil
+	if content := generateProviderTF(comp); strings.Contains(content, "azapi") || !strings.Contains(content, "      version = \"4.22.0\"\n    }\n  }\n") {
+		t.Errorf("provider.tf without providers = %s, want only azurerm", content)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	got := appendExtraHCL("locals {}\n", "generate \"extra\" {}\n")
+	want := "locals {}\n\n# Custom HCL from the stack file\ngenerate \"extra\" {}\n"
+	if got != want {
+		t.Errorf("appendExtraHCL() = %q, want %q", got, want)
+	}
+	if got := appendExtraHCL("locals {}\n", ""); got != "locals {}\n" {
+		t.Errorf("appendExtraHCL() without extra_hcl = %q", got)
+	}
+
+	marker := filepath.Join(t.TempDir(), "marker")
+	if err := runHooks("pre_generate", []string{"echo $TGS_OUTPUT_DIR > " + marker}, ".infrastructure"); err != nil {
+		t.Fatalf("runHooks() error = %v", err)
+	}
+	if data, err := os.ReadFile(marker); err != nil || strings.TrimSpace(string(data)) != ".infrastructure" {
+		t.Errorf("hook wrote %q, %v, want .infrastructure", data, err)
+	}
+	if err := runHooks("post_generate", []string{"exit 3", "touch " + marker + "2"}, ".infrastructure"); err == nil {
+		t.Error("runHooks() with a failing command returned no error")
+	}
+	if _, err := os.Stat(marker + "2"); err == nil {
+		t.Error("runHooks() ran commands after a failure")
+	}
+}
+
+func TestVerifyModules(t *testing.T) {
+	infraPath := t.TempDir()
+	for _, path := range []string{
+		"_components/main/redis/main.tf",
+		"_components/main/redis/.terraform.lock.hcl",
+		"_components/main/appservice/main.tf",
+		"_components/main/empty/component.hcl",
+	} {
+		path = filepath.Join(infraPath, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("# test\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	components, err := componentModules(infraPath)
+	if err != nil {
+		t.Fatalf("componentModules() error = %v", err)
+	}
+	if want := []string{"main/appservice", "main/redis"}; !reflect.DeepEqual(components, want) {
+		t.Errorf("componentModules() = %v, want %v", components, want)
+	}
+
+	dst := t.TempDir()
+	if err := copyModule(filepath.Join(infraPath, "_components", "main", "redis"), dst); err != nil {
+		t.Fatalf("copyModule() error = %v", err)
+	}
+	entries, _ := os.ReadDir(dst)
+	if len(entries) != 1 || entries[0].Name() != "main.tf" {
+		t.Errorf("copyModule() copied %v, want only main.tf", entries)
+	}
+}
+
+func TestVerifyPluginCaches(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake tools are shell scripts")
+	}
+	root := t.TempDir()
+	currentDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(currentDir)
+
+	// terraform init fails when another init uses its plugin cache
+	bin := filepath.Join(root, "bin")
+	tools := map[string]string{
+		"terragrunt": "#!/bin/sh\nexit 0\n",
+		"terraform": `#!/bin/sh
+[ "$1" = init ] || exit 0
+mkdir "$TF_PLUGIN_CACHE_DIR/.lock" || { echo "plugin cache in use"; exit 1; }
+sleep 0.05
+rmdir "$TF_PLUGIN_CACHE_DIR/.lock"
+`,
+	}
+	for name, script := range tools {
+		if err := os.MkdirAll(bin, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	for _, comp := range []string{"redis", "cosmos", "sql", "keyvault", "storage", "appservice"} {
+		path := filepath.Join(root, ".infrastructure", "_components", "main", comp, "main.tf")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("# test\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := Verify(VerifyOptions{Parallel: 4})
+	if err != nil {
+		t.Fatalf("Verify() unexpected error: %v", err)
+	}
+	if len(results) != 7 {
+		t.Errorf("Verify() returned %d results, want 7", len(results))
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			t.Errorf("Verify() %s: %v\n%s", result.Name, result.Err, result.Output)
+		}
+	}
+	caches, _ := os.ReadDir(filepath.Join(root, ".tgs", "cache", "plugins"))
+	if len(caches) != 4 {
+		t.Errorf("Verify() created %d plugin caches, want one per worker", len(caches))
+	}
+}
+
+func TestTerratestMocks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "variables.tf")
+	variables := `variable "name" {
+  type = string
+}
+
+variable "service_plan_id" {
+  type = string
+}
+
+variable "tags" {
+  type    = map(string)
+  default = {}
+}
+`
+	if err := os.WriteFile(path, []byte(variables), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := moduleVariables(path)
+	if err != nil {
+		t.Fatalf("moduleVariables() error = %v", err)
+	}
+	want := []moduleVariable{{name: "name", typ: "string"}, {name: "service_plan_id", typ: "string"}, {name: "tags", typ: "map(string)", hasDefault: true}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("moduleVariables() = %+v, want %+v", got, want)
+	}
+
+	mainConfig := &config.MainConfig{Stack: config.StackConfig{Components: map[string]config.Component{
+		"serviceplan": {Source: "azurerm_service_plan"},
+		"appservice": {
+			Source: "azurerm_linux_web_app",
+			Deps:   []string{"{region}.serviceplan"},
+			Inputs: map[string]string{"service_plan_id": "{dep:serviceplan.id}"},
+		},
+	}}}
+	comp := mainConfig.Stack.Components["appservice"]
+	value, comment := mockValue(mainConfig, "appservice", comp, got[1], dependencyMocks(mainConfig, comp))
+	if !strings.Contains(value, "Microsoft.Web/serverFarms/mock-serviceplan") || comment != "Mocked output of the serviceplan dependency" {
+		t.Errorf("mockValue() = %s, %q", value, comment)
+	}
+	if name := testName("app_service"); name != "AppService" {
+		t.Errorf("testName() = %q, want AppService", name)
+	}
+}
+
+func TestOPAPolicies(t *testing.T) {
+	tmpDir := t.TempDir()
+	currentDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(currentDir)
+
+	stack := `stack:
+  name: main
+  version: "1.0.0"
+  components:
+    redis:
+      source: azurerm_redis_cache
+  architecture:
+    regions:
+      eastus2:
+        - component: redis
+`
+	if err := os.MkdirAll(filepath.Join(".tgs", "stacks"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(".tgs", "stacks", "main.yaml"), []byte(stack), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tgsConfig := &config.TGSConfig{
+		Name:          "projecta",
+		Naming:        config.NamingConfig{Format: "${project}-${region}${env}-${type}"},
+		Subscriptions: map[string]config.Subscription{"nonprod": {Environments: []config.Environment{{Name: "dev"}}}},
+	}
+	if err := generateOPAPolicies(tgsConfig); err != nil {
+		t.Fatalf("generateOPAPolicies() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(".tgs", "policies", opaPolicyFile)); err == nil {
+		t.Fatal("generateOPAPolicies() wrote policies without conftest")
+	}
+
+	tgsConfig.Security.Tools = []string{config.SecurityToolConftest}
+	if err := generateOPAPolicies(tgsConfig); err != nil {
+		t.Fatalf("generateOPAPolicies() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(".tgs", "policies", opaPolicyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"main/dev/eastus2/redis": ["projecta-E2D-redis"]`, `"azurerm_redis_cache",`, `"ManagedBy"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("tgs.rego is missing %s:\n%s", want, data)
+		}
+	}
+}
+
+func TestComponentReadme(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"variables.tf": `variable "name" {
+  type        = string
+  description = "The name of the resource"
+}
+
+variable "tags" {
+  type        = map(string)
+  description = "Tags to apply | merge"
+  default     = {}
+}
+`,
+		"provider.tf": `variable "tenant_id" {
+  type    = string
+  default = null
+}
+`,
+		"outputs.tf": `output "id" {
+  value       = resource.azurerm_linux_web_app.this.id
+  description = "The ID of the azurerm_linux_web_app"
+}
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	comp := config.Component{
+		Source:       "azurerm_linux_web_app",
+		Version:      "4.22.0",
+		Description:  "App service for API",
+		Deps:         []string{"{region}.serviceplan.{app}"},
+		ExternalDeps: []string{"network"},
+	}
+	if err := generateComponentReadme(dir, "main", "appservice", comp); err != nil {
+		t.Fatalf("generateComponentReadme() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "README.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"App service for API",
+		"| `azurerm_linux_web_app` | primary |",
+		"| azurerm | hashicorp/azurerm | `4.22.0` |",
+		"| serviceplan | `{region}.serviceplan.{app}` | stack |",
+		"| network | `network` | external |",
+		"| name | The name of the resource | `string` | n/a | yes |",
+		"| tags | Tags to apply \\| merge | `map(string)` | `{}` | no |",
+		"| tenant_id |  | `string` | `null` | no |",
+		"| id | The ID of the azurerm_linux_web_app |",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("README.md is missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestDetails(t *testing.T) {
+	tgsConfig := &config.TGSConfig{
+		Name:   "projecta",
+		Naming: config.NamingConfig{Format: "${project}-${region}${env}-${type}", DefaultSeparator: "-"},
+		Subscriptions: map[string]config.Subscription{
+			"nonprod": {Environments: []config.Environment{{Name: "dev"}, {Name: "test"}}},
+		},
+	}
+	mainConfig := &config.MainConfig{}
+	mainConfig.Stack.Name = "main"
+	mainConfig.Stack.Version = "1.0.0"
+	mainConfig.Stack.Components = map[string]config.Component{
+		"serviceplan": {Source: "azurerm_service_plan", Version: "4.22.0"},
+		"appservice":  {Source: "azurerm_linux_web_app", Version: "4.22.0", Deps: []string{"{region}.serviceplan"}},
+	}
+	mainConfig.Stack.Architecture.Regions = map[string][]config.RegionComponent{
+		"eastus2": {{Component: "serviceplan"}, {Component: "appservice", Apps: []string{"api"}}},
+	}
+
+	details := Details(tgsConfig, "main", mainConfig)
+	if len(details.Components) != 2 || details.Components[0].Name != "appservice" || !reflect.DeepEqual(details.Components[0].Deps, []string{"{region}.serviceplan"}) {
+		t.Errorf("Details() components = %+v", details.Components)
+	}
+	if len(details.Regions) != 1 || !reflect.DeepEqual(details.Regions[0].Components[1], RegionComponentDetails{Component: "appservice", Apps: []string{"api"}}) {
+		t.Errorf("Details() regions = %+v", details.Regions)
+	}
+	if len(details.Environments) != 2 || details.Environments[0].Name != "dev" || details.Environments[1].Name != "test" {
+		t.Fatalf("Details() environments = %+v", details.Environments)
+	}
+	var names []string
+	for _, entry := range details.Environments[0].Resources {
+		names = append(names, entry.Name)
+	}
+	if want := []string{"projecta-E2D-asp", "projecta-E2D-app-api"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Details() dev resource names = %v, want %v", names, want)
+	}
+}
+
+func TestGenerationModes(t *testing.T) {
+	var schema ProviderSchema
+	data := `{"provider_schemas": {"registry.terraform.io/hashicorp/azurerm": {"resource_schemas": {"azurerm_redis_cache": {"block": {
+		"attributes": {
+			"capacity": {"type": "number", "required": true},
+			"minimum_tls_version": {"type": "string", "optional": true},
+			"hostname": {"type": "string", "computed": true}
+		},
+		"block_types": {"patch_schedule": {"nesting_mode": "list", "block": {"attributes": {
+			"day_of_week": {"type": "string", "required": true},
+			"start_hour_utc": {"type": "number", "optional": true}
+		}}}}
+	}}}}}}`
+	if err := json.Unmarshal([]byte(data), &schema); err != nil {
+		t.Fatal(err)
+	}
+	schemaCache = &SchemaCache{CachePath: t.TempDir(), Schema: &schema}
+	defer func() { schemaCache = nil }()
+
+	comp := config.Component{Source: "azurerm_redis_cache", Provider: "azurerm", Version: "4.22.0", SchemaGeneration: true}
+	tests := []struct {
+		mode     string
+		main     []string
+		variable string
+	}{
+		{config.GenerationModeCompact, []string{"  # minimum_tls_version = var.minimum_tls_version", "      # start_hour_utc = patch_schedule.value.start_hour_utc"}, `default = "latest"`},
+		{config.GenerationModeFull, []string{"  minimum_tls_version = var.minimum_tls_version", "      start_hour_utc = patch_schedule.value.start_hour_utc"}, "default = null"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		if err := generateTerraformFiles(dir, comp, tt.mode); err != nil {
+			t.Fatalf("generateTerraformFiles(%s) unexpected error: %v", tt.mode, err)
+		}
+		mainTF, _ := os.ReadFile(filepath.Join(dir, "main.tf"))
+		for _, line := range append(tt.main, "  capacity = var.capacity") {
+			if !strings.Contains(string(mainTF), line+"\n") {
+				t.Errorf("%s main.tf is missing %q:\n%s", tt.mode, line, mainTF)
+			}
+		}
+		variablesTF, _ := os.ReadFile(filepath.Join(dir, "variables.tf"))
+		if want := "variable \"minimum_tls_version\" {\n  type        = string\n  description = \"\"\n  " + tt.variable + "\n}"; !strings.Contains(string(variablesTF), want) {
+			t.Errorf("%s variables.tf is missing %q:\n%s", tt.mode, want, variablesTF)
+		}
+	}
+}
+
+func TestNestedBlocks(t *testing.T) {
+	var schema ProviderSchema
+	data := `{"provider_schemas": {"registry.terraform.io/hashicorp/azurerm": {"resource_schemas": {"azurerm_linux_web_app": {"block": {
+		"attributes": {"name": {"type": "string", "required": true}},
+		"block_types": {
+			"site_config": {"nesting_mode": "list", "min_items": 1, "max_items": 1, "block": {"attributes": {
+				"always_on": {"type": "bool", "optional": true}
+			}}},
+			"backup": {"nesting_mode": "list", "max_items": 1, "block": {"attributes": {
+				"name": {"type": "string", "required": true}
+			}}},
+			"connection_string": {"nesting_mode": "set", "max_items": 5, "block": {"attributes": {
+				"name": {"type": "string", "required": true}
+			}}}
+		}
+	}}}}}}`
+	if err := json.Unmarshal([]byte(data), &schema); err != nil {
+		t.Fatal(err)
+	}
+	schemaCache = &SchemaCache{CachePath: t.TempDir(), Schema: &schema}
+	defer func() { schemaCache = nil }()
+
+	dir := t.TempDir()
+	comp := config.Component{Source: "azurerm_linux_web_app", Provider: "azurerm", Version: "4.22.0", SchemaGeneration: true}
+	if err := generateTerraformFiles(dir, comp, config.GenerationModeCompact); err != nil {
+		t.Fatalf("generateTerraformFiles() unexpected error: %v", err)
+	}
+	mainTF, _ := os.ReadFile(filepath.Join(dir, "main.tf"))
+	variablesTF, _ := os.ReadFile(filepath.Join(dir, "variables.tf"))
+
+	// Required single blocks are concrete, optional ones dynamic over an object
+	for _, want := range []string{
+		"  site_config {\n    # always_on = var.site_config.always_on\n  }",
+		"    for_each = var.backup == null ? [] : [var.backup]\n",
+		"    for_each = var.connection_string\n",
+	} {
+		if !strings.Contains(string(mainTF), want) {
+			t.Errorf("main.tf is missing %q:\n%s", want, mainTF)
+		}
+	}
+	for _, want := range []string{
+		"variable \"site_config\" {\n  type = object({\n    always_on = optional(bool)\n  })\n  description = \"site_config configuration block\"\n  default     = {}\n}",
+		"variable \"backup\" {\n  type = object({\n    name = string\n  })\n  description = \"backup configuration block\"\n  default     = null\n}",
+		"  type = set(object({\n",
+		"    condition     = length(var.connection_string) <= 5\n",
+	} {
+		if !strings.Contains(string(variablesTF), want) {
+			t.Errorf("variables.tf is missing %q:\n%s", want, variablesTF)
+		}
+	}
+}
+
+func TestCuratedModules(t *testing.T) {
+	schemaCache = &SchemaCache{CachePath: t.TempDir(), Schema: &ProviderSchema{}}
+	defer func() { schemaCache = nil }()
+
+	dir := t.TempDir()
+	comp := config.Component{Source: "azurerm_linux_web_app", Provider: "azurerm", Version: "4.22.0", KeyVaultSecrets: true}
+	if err := generateTerraformFiles(dir, comp, config.GenerationModeCompact); err != nil {
+		t.Fatalf("generateTerraformFiles() unexpected error: %v", err)
+	}
+	mainTF, _ := os.ReadFile(filepath.Join(dir, "main.tf"))
+	for _, want := range []string{"  service_plan_id     = var.service_plan_id\n", "  app_settings        = local.app_settings\n", "  site_config {\n", "resource \"azurerm_key_vault_secret\" \"app_settings\""} {
+		if !strings.Contains(string(mainTF), want) {
+			t.Errorf("main.tf is missing %q:\n%s", want, mainTF)
+		}
+	}
+
+	// Variables are declared once, whether curated or added by features
+	variablesTF, _ := os.ReadFile(filepath.Join(dir, "variables.tf"))
+	for _, name := range []string{"name", "service_plan_id", "app_settings", config.KeyVaultInput} {
+		if got := strings.Count(string(variablesTF), fmt.Sprintf("variable %q {", name)); got != 1 {
+			t.Errorf("variables.tf declares %s %d times, want once:\n%s", name, got, variablesTF)
+		}
+	}
+
+	if !curatedModule(comp) || curatedModule(config.Component{Source: "azurerm_dns_zone"}) {
+		t.Error("curatedModule() should only hold for resource types with curated templates")
+	}
+	comp.SchemaGeneration = true
+	if curatedModule(comp) {
+		t.Error("curatedModule() should not hold with schema_generation")
+	}
+}
+
+func TestDataSources(t *testing.T) {
+	schemaCache = &SchemaCache{CachePath: t.TempDir(), Schema: &ProviderSchema{}}
+	defer func() { schemaCache = nil }()
+
+	dir := t.TempDir()
+	comp := config.Component{
+		Source:   "azurerm_linux_web_app",
+		Provider: "azurerm",
+		Version:  "4.22.0",
+		Inputs:   map[string]string{"service_plan_id": "{data:plan.id}"},
+		DataSources: map[string]config.DataSource{
+			"plan": {Type: "azurerm_service_plan", Arguments: map[string]string{
+				"name":                "asp-${shared}",
+				"resource_group_name": "var.resource_group_name",
+			}},
+		},
+	}
+	if err := generateTerraformFiles(dir, comp, config.GenerationModeCompact); err != nil {
+		t.Fatalf("generateTerraformFiles() unexpected error: %v", err)
+	}
+
+	dataTF, _ := os.ReadFile(filepath.Join(dir, "data.tf"))
+	want := "data \"azurerm_service_plan\" \"plan\" {\n  name                = \"asp-$${shared}\"\n  resource_group_name = var.resource_group_name\n}\n"
+	if !strings.HasSuffix(string(dataTF), want) {
+		t.Errorf("data.tf = %q, want suffix %q", dataTF, want)
+	}
+	mainTF, _ := os.ReadFile(filepath.Join(dir, "main.tf"))
+	if want := "  service_plan_id     = data.azurerm_service_plan.plan.id\n"; !strings.Contains(string(mainTF), want) {
+		t.Errorf("main.tf is missing %q:\n%s", want, mainTF)
+	}
+	variablesTF, _ := os.ReadFile(filepath.Join(dir, "variables.tf"))
+	if strings.Contains(string(variablesTF), `variable "service_plan_id"`) {
+		t.Errorf("variables.tf still declares service_plan_id:\n%s", variablesTF)
+	}
+
+	// data.tf is removed with the last data source
+	comp.DataSources, comp.Inputs = nil, nil
+	if err := generateTerraformFiles(dir, comp, config.GenerationModeCompact); err != nil {
+		t.Fatalf("generateTerraformFiles() unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "data.tf")); !os.IsNotExist(err) {
+		t.Errorf("data.tf should be removed, got %v", err)
+	}
+}
+
+func TestInstances(t *testing.T) {
+	schemaCache = &SchemaCache{CachePath: t.TempDir(), Schema: &ProviderSchema{}}
+	defer func() { schemaCache = nil }()
+
+	dir := t.TempDir()
+	comp := config.Component{
+		Source:      "azurerm_storage_account",
+		Provider:    "azurerm",
+		Version:     "4.22.0",
+		Diagnostics: true,
+		Instances: map[string]map[string]string{
+			"logs": {"account_replication_type": "GRS"},
+			"data": {},
+		},
+	}
+	if err := generateTerraformFiles(dir, comp, config.GenerationModeCompact); err != nil {
+		t.Fatalf("generateTerraformFiles() unexpected error: %v", err)
+	}
+
+	mainTF, _ := os.ReadFile(filepath.Join(dir, "main.tf"))
+	for _, want := range []string{
+		"resource \"azurerm_storage_account\" \"this\" {\n  for_each = var.instances\n\n",
+		`  name                            = try(each.value.name, "${var.name}-${each.key}")` + "\n",
+		"  account_replication_type        = try(each.value.account_replication_type, var.account_replication_type)\n",
+		"  target_resource_id         = each.value.id\n",
+	} {
+		if !strings.Contains(string(mainTF), want) {
+			t.Errorf("main.tf is missing %q:\n%s", want, mainTF)
+		}
+	}
+	outputsTF, _ := os.ReadFile(filepath.Join(dir, "outputs.tf"))
+	if want := "  value       = { for key, instance in resource.azurerm_storage_account.this : key => instance.id }\n"; !strings.Contains(string(outputsTF), want) {
+		t.Errorf("outputs.tf is missing %q:\n%s", want, outputsTF)
+	}
+
+	input, err := generateInstancesInput(comp.Instances, nil)
+	if err != nil {
+		t.Fatalf("generateInstancesInput() unexpected error: %v", err)
+	}
+	want := "{\n      \"data\" = {}\n      \"logs\" = {\n        account_replication_type = \"GRS\"\n      }\n    }"
+	if input != want {
+		t.Errorf("generateInstancesInput() = %q, want %q", input, want)
+	}
+}
+
+func TestShareModule(t *testing.T) {
+	componentsDir := t.TempDir()
+	var paths []string
+	for _, compName := range []string{"redis", "cache", "plan"} {
+		dir := filepath.Join(componentsDir, "main", compName)
+		content := `resource "azurerm_redis_cache" "this" {}`
+		if compName == "plan" {
+			content = `resource "azurerm_service_plan" "this" {}`
+		}
+		if err := createFile(filepath.Join(dir, "main.tf"), content); err != nil {
+			t.Fatal(err)
+		}
+		if err := createFile(filepath.Join(dir, "component.hcl"), "inputs = {}"); err != nil {
+			t.Fatal(err)
+		}
+
+		path, err := shareModule(componentsDir, dir)
+		if err != nil {
+			t.Fatalf("shareModule(%s) unexpected error: %v", compName, err)
+		}
+		paths = append(paths, path)
+		if _, err := os.Stat(filepath.Join(dir, "main.tf")); !os.IsNotExist(err) {
+			t.Errorf("main.tf of %s should move to the shared module", compName)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "component.hcl")); err != nil {
+			t.Errorf("component.hcl of %s should stay: %v", compName, err)
+		}
+		if err := ValidateComponentStructure(dir, filepath.Join(componentsDir, path)); err == nil {
+			t.Errorf("ValidateComponentStructure(%s) should report the missing variables.tf", compName)
+		}
+	}
+
+	if paths[0] != paths[1] || paths[0] == paths[2] || !strings.HasPrefix(paths[0], "_shared/") {
+		t.Errorf("shareModule() paths = %v, want identical modules to share one", paths)
+	}
+}
+
+func TestFingerprints(t *testing.T) {
+	dir := t.TempDir()
+	mainConfig := &config.MainConfig{Stack: config.StackConfig{
+		Name: "main",
+		Components: map[string]config.Component{
+			"redis":      {Source: "azurerm_redis_cache"},
+			"appservice": {Source: "azurerm_linux_web_app", Deps: []string{"{region}.redis"}},
+			"keyvault":   {Source: "azurerm_key_vault"},
+		},
+	}}
+
+	previous := &fingerprintSet{current: make(map[string]string), skipped: make(map[string]int)}
+	for compName := range mainConfig.Stack.Components {
+		if _, err := previous.unchanged(componentKey("main", compName), dir, componentInputs(mainConfig, compName)...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A changed component regenerates the components depending on it
+	mainConfig.Stack.Components["redis"] = config.Component{Source: "azurerm_redis_cache", Version: "4.22.0"}
+	current := &fingerprintSet{previous: previous.current, current: make(map[string]string), skipped: make(map[string]int)}
+	for compName, want := range map[string]bool{"redis": false, "appservice": false, "keyvault": true} {
+		unchanged, err := current.unchanged(componentKey("main", compName), dir, componentInputs(mainConfig, compName)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if unchanged != want {
+			t.Errorf("unchanged(%s) = %v, want %v", compName, unchanged, want)
+		}
+	}
+	if current.skipped["component"] != 1 {
+		t.Errorf("skipped = %v, want 1 component", current.skipped)
+	}
+
+	// Missing subtrees are regenerated
+	if unchanged, _ := current.unchanged(componentKey("main", "keyvault"), filepath.Join(dir, "missing"), componentInputs(mainConfig, "keyvault")...); unchanged {
+		t.Error("unchanged() should report a missing subtree as changed")
+	}
+}
+
+func TestIncrementalPairedRegion(t *testing.T) {
+	tmpDir := t.TempDir()
+	currentDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(currentDir)
+
+	stacksDir := filepath.Join(tmpDir, ".tgs", "stacks")
+	if err := os.MkdirAll(stacksDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	tgsConfig := `name: projecta
+subscriptions:
+  nonprod:
+    remotestate:
+      name: stprojectanonprodtf
+      resource_group: rg-projecta-nonprod-tf
+    environments:
+      - name: dev
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, ".tgs", "tgs.yaml"), []byte(tgsConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeStack := func(pair string) {
+		stack := fmt.Sprintf(`stack:
+  name: main
+  version: "1.0.0"
+  description: "Test stack"
+  components:
+    redis:
+      source: azurerm_redis_cache
+      provider: azurerm
+      version: 4.22.0
+      description: "Redis cache"
+  architecture:
+    regions:
+      eastus2:
+        - component: redis
+      %[1]s:
+        - component: redis
+    paired_regions:
+      eastus2: %[1]s
+`, pair)
+		if err := os.WriteFile(filepath.Join(stacksDir, "main.yaml"), []byte(stack), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	regionHCL := filepath.Join(tmpDir, ".infrastructure", "architecture", "main", "nonprod", "eastus2", "region.hcl")
+	for _, pair := range []string{"westus2", "centralus"} {
+		writeStack(pair)
+		if err := Generate(); err != nil {
+			t.Fatalf("Generate() with pair %s unexpected error: %v", pair, err)
+		}
+		data, err := os.ReadFile(regionHCL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("paired_region = %q", pair); !strings.Contains(string(data), want) {
+			t.Errorf("region.hcl after pairing eastus2 with %s is missing %s:\n%s", pair, want, data)
+		}
+	}
+}
+
+func TestScript(t *testing.T) {
+	migration := script{
+		Header: []string{"Moves state.", ""},
+		Steps: []scriptStep{
+			{Comment: "redis: a -> b", Dir: ".infrastructure/architecture/main/nonprod/eastus2/dev/redis", Args: []string{"terragrunt", "state", "mv", `azurerm_redis_cache.this["a"]`, "azurerm_redis_cache.main"}},
+			{Args: []string{"az", "storage", "blob", "copy", "start", "--source-blob", "it's"}},
+		},
+	}
+
+	wantBash := `#!/bin/bash
+# Moves state.
+#
+set -e
+
+# redis: a -> b
+(cd .infrastructure/architecture/main/nonprod/eastus2/dev/redis && terragrunt state mv 'azurerm_redis_cache.this["a"]' azurerm_redis_cache.main)
+az storage blob copy start --source-blob 'it'\''s'
+`
+	if got := migration.Bash(); got != wantBash {
+		t.Errorf("Bash() = %s, want %s", got, wantBash)
+	}
+
+	wantPowerShell := `# Moves state.
+#
+$ErrorActionPreference = 'Stop'
+
+# redis: a -> b
+Push-Location .infrastructure/architecture/main/nonprod/eastus2/dev/redis; try { & terragrunt state mv 'azurerm_redis_cache.this["a"]' azurerm_redis_cache.main; if ($LASTEXITCODE -ne 0) { exit $LASTEXITCODE } } finally { Pop-Location }
+& az storage blob copy start --source-blob 'it''s'; if ($LASTEXITCODE -ne 0) { exit $LASTEXITCODE }
+`
+	if got := migration.PowerShell(); got != wantPowerShell {
+		t.Errorf("PowerShell() = %s, want %s", got, wantPowerShell)
+	}
+}
+
+func TestScaffoldRepoFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".gitignore")
+	if err := os.WriteFile(path, []byte("node_modules/\n.terraform/"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := updateGitignore(path); err != nil {
+			t.Fatalf("updateGitignore() unexpected error: %v", err)
+		}
+	}
+	content, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(content), "node_modules/\n.terraform/\n\n") || strings.Count(string(content), ".terraform/") != 1 || !strings.Contains(string(content), ".tgs/lock\n") {
+		t.Errorf("updateGitignore() = %q, want the missing entries appended once", content)
+	}
+
+	codeowners := renderCodeowners(&config.TGSConfig{Owners: config.OwnersConfig{
+		Default:      []string{"@contoso/platform"},
+		Stacks:       map[string][]string{"main": {"@contoso/app"}},
+		Environments: map[string][]string{"prod": {"@contoso/sre"}},
+	}})
+	for _, want := range []string{
+		"* @contoso/platform\n",
+		"/.infrastructure/_components/main/ @contoso/app\n",
+		"/.infrastructure/architecture/*/*/*/prod/ @contoso/sre\n",
+	} {
+		if !strings.Contains(codeowners, want) {
+			t.Errorf("renderCodeowners() = %s, want it to contain %q", codeowners, want)
+		}
+	}
+	// Environments come last so they override the stacks
+	if strings.Index(codeowners, "prod/") < strings.Index(codeowners, "architecture/main/") {
+		t.Errorf("renderCodeowners() = %s, want environment rules after stack rules", codeowners)
+	}
+}
+
+func TestCommitMessage(t *testing.T) {
+	changes := []Change{
+		{Type: "add", Category: "component", Component: "redis", Subscription: "nonprod", Environment: "dev", Region: "eastus2"},
+		{Type: "modify", Category: "file", Path: "root.hcl"},
+	}
+	subject, body := commitMessage(map[string]string{"main": "1.2.0", "data": ""}, changes)
+
+	if subject != "Regenerate infrastructure: 1 to add, 0 to remove, 1 to modify" {
+		t.Errorf("commitMessage() subject = %s", subject)
+	}
+	for _, want := range []string{
+		"Stacks:\n  data (unversioned)\n  main 1.2.0\n",
+		"\nnonprod/dev/eastus2:\n  + redis\n",
+		"\nShared configuration:\n  ~ root.hcl\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("commitMessage() body = %s, want it to contain %q", body, want)
+		}
+	}
+
+	if got := repoRelative("/repo", "infra/", filepath.Join(".infrastructure", "root.hcl")); got != "infra/.infrastructure/root.hcl" {
+		t.Errorf("repoRelative() = %s, want infra/.infrastructure/root.hcl", got)
+	}
+}
+
+func TestFormatPlanComment(t *testing.T) {
+	comment := formatPlanComment([]Change{{Type: "add", Category: "component", Component: "redis", Subscription: "nonprod", Environment: "dev", Region: "eastus2"}}, nil)
+	for _, want := range []string{planCommentMarker + "\n", "<summary>tgs plan: 1 to add, 0 to remove, 0 to modify</summary>", "## Infrastructure Plan", "</details>\n"} {
+		if !strings.Contains(comment, want) {
+			t.Errorf("formatPlanComment() = %s, want it to contain %q", comment, want)
+		}
+	}
+}
+
+func TestComponentNaming(t *testing.T) {
+	renderer, err := templates.NewRenderer()
+	if err != nil {
+		t.Fatalf("NewRenderer() unexpected error: %v", err)
+	}
+	none := ""
+	var initConfig config.TGSConfig
+	if err := yaml.Unmarshal([]byte(template.TGSYamlTemplate), &initConfig); err != nil {
+		t.Fatalf("init template doesn't parse: %v", err)
+	}
+	configs := map[string]config.NamingConfig{
+		"dollar": {
+			Format:           "${project}-${region}${env}-${type}",
+			DefaultSeparator: "-",
+			ComponentFormats: map[string]config.ComponentFormat{"storage": {Format: "${project}${type}${env}", Separator: &none}},
+		},
+		"braced": {
+			Format:           "{project}-{region}{env}-{type}",
+			DefaultSeparator: "-",
+			ComponentFormats: map[string]config.ComponentFormat{"storage": {Format: "{project}{type}{env}", Separator: &none}},
+		},
+		"init": initConfig.Naming,
+	}
+	wants := map[string]string{"appservice": "myproject-E2D-app-api", "storage": "myprojectstDapi"}
+
+	for cfgName, cfg := range configs {
+		for _, compName := range []string{"appservice", "storage"} {
+			testComponentNaming(t, renderer, cfgName, cfg, compName, wants[compName])
+		}
+	}
+}
+
+// testComponentNaming checks that the resource name of a rendered
+// component.hcl is the one tgs name preview resolves
+func testComponentNaming(t *testing.T, renderer *templates.TemplateRenderer, cfgName string, cfg config.NamingConfig, compName, wantName string) {
+	t.Helper()
+	format, separator := naming.ForComponent(cfg, compName)
+	content, err := renderer.RenderTemplate("components/component.hcl.tmpl", &templates.ComponentData{
+		StackName:       "main",
+		ComponentName:   compName,
+		ResourceType:    naming.Abbreviation(compName),
+		NamingFormat:    escapeHCL(format),
+		NamingSeparator: escapeHCL(separator),
+	})
+	if err != nil {
+		t.Fatalf("%s: RenderTemplate() unexpected error: %v", cfgName, err)
+	}
+
+	// Evaluate the naming locals as Terragrunt would
+	file, diags := hclsyntax.ParseConfig([]byte(content), "component.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("%s: component.hcl of %s doesn't parse: %v", cfgName, compName, diags)
+	}
+	attrs := file.Body.(*hclsyntax.Body).Blocks[0].Body.Attributes
+	locals := map[string]cty.Value{
+		"project_name":       cty.StringVal("myproject"),
+		"region_prefix":      cty.StringVal("E2"),
+		"environment_prefix": cty.StringVal("D"),
+		"resource_type":      cty.StringVal(naming.Abbreviation(compName)),
+		"app_name":           cty.StringVal("api"),
+	}
+	ctx := &hcl.EvalContext{Functions: map[string]function.Function{"replace": stdlib.ReplaceFunc}}
+	for _, name := range []string{"name_format", "name_separator", "name_prefix", "resource_name"} {
+		ctx.Variables = map[string]cty.Value{"local": cty.ObjectVal(locals)}
+		value, diags := attrs[name].Expr.Value(ctx)
+		if diags.HasErrors() {
+			t.Fatalf("%s: %s of %s: %v", cfgName, name, compName, diags)
+		}
+		locals[name] = value
+	}
+
+	want := naming.Resolve(format, naming.Values{Project: "myproject", Region: "E2", Environment: "D", Type: naming.Abbreviation(compName), App: "api", Separator: separator})
+	if got := locals["resource_name"].AsString(); got != want || got != wantName {
+		t.Errorf("%s: resource_name of %s = %s, want %s as tgs name preview shows", cfgName, compName, got, wantName)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	tgsConfig := &config.TGSConfig{
+		Name:   "myproject",
+		Naming: config.NamingConfig{Format: "${project}-${region}${env}-${type}", DefaultSeparator: "-"},
+		Subscriptions: map[string]config.Subscription{
+			"nonprod": {RemoteState: config.RemoteState{KeyPrefix: "nonprod"}, Environments: []config.Environment{{Name: "dev"}, {Name: "test"}}},
+		},
+	}
+	mainConfig := &config.MainConfig{Stack: config.StackConfig{
+		Name: "main",
+		Components: map[string]config.Component{
+			"serviceplan": {Source: "azurerm_service_plan"},
+			"appservice":  {Source: "azurerm_linux_web_app", Deps: []string{"{region}.serviceplan"}},
+		},
+		Architecture: config.ArchitectureConfig{Regions: map[string][]config.RegionComponent{
+			"eastus2": {{Component: "serviceplan"}, {Component: "appservice", Apps: []string{"api", "web"}}},
+		}},
+	}}
+
+	var selectors []Selector
+	for _, arg := range []string{"component=appservice", "env=dev", "app!=w*"} {
+		selector, err := ParseSelector(arg)
+		if err != nil {
+			t.Fatalf("ParseSelector(%s) unexpected error: %v", arg, err)
+		}
+		selectors = append(selectors, selector)
+	}
+	got := Query(tgsConfig, map[string]*config.MainConfig{"main": mainConfig}, selectors)
+	want := []QueryEntry{{
+		Stack:        "main",
+		Subscription: "nonprod",
+		Environment:  "dev",
+		Region:       "eastus2",
+		Component:    "appservice",
+		App:          "api",
+		ResourceType: "azurerm_linux_web_app",
+		Name:         "myproject-E2D-app-api",
+		Path:         ".infrastructure/architecture/main/nonprod/eastus2/dev/appservice/api",
+		StateKey:     "nonprod/architecture/main/nonprod/eastus2/dev/appservice/api/terraform.tfstate",
+		Deps:         []string{".infrastructure/architecture/main/nonprod/eastus2/dev/serviceplan"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Query() = %+v, want %+v", got, want)
+	}
+
+	if _, err := ParseSelector("owner=platform"); err == nil {
+		t.Error("Expected an error for an unknown selector key")
+	}
+}
+
+func TestApplyChanges(t *testing.T) {
+	rendered, infra := t.TempDir(), t.TempDir()
+	writeTree := func(root string, files map[string]string) {
+		for path, content := range files {
+			full := filepath.Join(root, filepath.FromSlash(path))
+			if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	writeTree(rendered, map[string]string{
+		"root.hcl":                      "root",
+		"architecture/dev/app/api.hcl":  "api",
+		"_components/main/app/main.tf":  "new",
+		"_components/main/plan/main.tf": "plan",
+	})
+	writeTree(infra, map[string]string{
+		"root.hcl":                            "root",
+		"architecture/dev/app/stale.hcl":      "stale",
+		"architecture/dev/old/terragrunt.hcl": "old",
+		"_components/main/app/main.tf":        "old",
+		// A directory in the way of a rendered file
+		"_components/main/plan/main.tf/leftover": "leftover",
+		".terragrunt-cache/keep":                 "cache",
+	})
+
+	changes := []Change{
+		// Removed folders are deleted before syncing, so a removed folder that
+		// is rendered again loses the files it no longer has
+		{Type: "remove", Category: "app", Path: "architecture/dev/app"},
+		{Type: "remove", Category: "component", Path: "architecture/dev/old"},
+		{Type: "modify", Category: "file", Path: "_components/main/app/main.tf"},
+	}
+	if err := applyChanges(rendered, infra, changes); err != nil {
+		t.Fatalf("applyChanges() unexpected error: %v", err)
+	}
+
+	want := map[string]string{
+		"root.hcl":                      "root",
+		"architecture/dev/app/api.hcl":  "api",
+		"_components/main/app/main.tf":  "new",
+		"_components/main/plan/main.tf": "plan",
+		".terragrunt-cache/keep":        "cache",
+	}
+	got := make(map[string]string)
+	err := filepath.WalkDir(infra, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(infra, path)
+		got[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("applyChanges() tree = %v, want %v", got, want)
+	}
+}
+
+func TestMockOutputs(t *testing.T) {
+	depComp := config.Component{
+		Source:              "azurerm_linux_web_app",
+		AdditionalResources: []string{"azurerm_app_service_custom_hostname_binding"},
+		Slots:               []string{"staging"},
+		Outputs:             config.Outputs{Names: []string{"default_hostname", "azurerm_app_service_custom_hostname_binding.hostname"}},
+	}
+	options := config.DependencyOptions{MockOutputs: map[string]string{"default_hostname": "api.example.com", "slot_ids": "{}"}}
+
+	siteID := "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/mock-rg/providers/Microsoft.Web/sites/mock-appservice"
+	want := map[string]string{
+		"id":                         siteID,
+		"name":                       "mock-appservice",
+		"azurerm_linux_web_app_id":   siteID,
+		"azurerm_linux_web_app_name": "mock-appservice",
+		"azurerm_app_service_custom_hostname_binding_id":       "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/mock-rg/providers/Microsoft.Resources/app_service_custom_hostname_binding/mock-appservice",
+		"azurerm_app_service_custom_hostname_binding_name":     "mock-appservice",
+		"azurerm_app_service_custom_hostname_binding_hostname": "mock-appservice",
+		"default_hostname": "api.example.com",
+		"slot_ids":         "{}",
+	}
+	if got := mockOutputs(depComp, "appservice", options); !reflect.DeepEqual(got, want) {
+		t.Errorf("mockOutputs() = %v, want %v", got, want)
+	}
+
+	// Every string output of the module has a mock
+	outputs, err := moduleOutputs(depComp, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mocks := mockOutputs(depComp, "appservice", config.DependencyOptions{})
+	for _, output := range outputs {
+		if _, ok := mocks[output.Name]; !ok && output.Attribute != "" {
+			t.Errorf("mockOutputs() has no mock of output %s", output.Name)
+		}
+	}
+	if _, ok := mocks["slot_hostnames"]; ok {
+		t.Error("mockOutputs() mocks the slot_hostnames map with a string")
+	}
+}
+
+func TestDependencyTemplateEscapesMockOutputs(t *testing.T) {
+	renderer, err := templates.NewRenderer()
+	if err != nil {
+		t.Fatalf("NewRenderer() unexpected error: %v", err)
+	}
+	mocks := map[string]string{
+		"id":        `/subscriptions/x/"quoted"`,
+		"template":  "${local.secret} and %{ if true }",
+		"multiline": "a\\b\nc",
+		"with.dot":  "dotted",
+	}
+	content, err := renderer.RenderTemplate("components/dependency.hcl.tmpl", &templates.DependencyData{
+		Name:        "network",
+		ConfigPath:  "../network",
+		MockOutputs: mocks,
+	})
+	if err != nil {
+		t.Fatalf("RenderTemplate() unexpected error: %v", err)
+	}
+
+	file, diags := hclsyntax.ParseConfig([]byte(content), "component.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("dependency block doesn't parse: %v\n%s", diags, content)
+	}
+	value, diags := file.Body.(*hclsyntax.Body).Blocks[0].Body.Attributes["mock_outputs"].Expr.Value(nil)
+	if diags.HasErrors() {
+		t.Fatalf("mock_outputs doesn't evaluate: %v", diags)
+	}
+	got := make(map[string]string)
+	for key, v := range value.AsValueMap() {
+		got[key] = v.AsString()
+	}
+	if !reflect.DeepEqual(got, mocks) {
+		t.Errorf("mock_outputs = %v, want %v", got, mocks)
+	}
+}
+
+func TestLineDiffStats(t *testing.T) {
+	testCases := []struct {
+		name        string
+		before      string
+		after       string
+		wantAdded   int
+		wantRemoved int
+	}{
+		{name: "Unchanged", before: "a\nb\nc", after: "a\nb\nc"},
+		{name: "Both empty", before: "", after: ""},
+		{name: "Added line", before: "a\nc", after: "a\nb\nc", wantAdded: 1},
+		{name: "Removed line", before: "a\nb\nc", after: "a\nc", wantRemoved: 1},
+		{name: "Changed line", before: "a\nb\nc", after: "a\nx\nc", wantAdded: 1, wantRemoved: 1},
+		{name: "Moved line", before: "a\nb\nc", after: "b\nc\na", wantAdded: 1, wantRemoved: 1},
+		{name: "From empty", before: "", after: "a\nb", wantAdded: 2, wantRemoved: 1},
+		{name: "Trailing newline", before: "a", after: "a\n", wantAdded: 1},
+		{name: "Repeated lines", before: "x\nx\nx", after: "x\ny\nx", wantAdded: 1, wantRemoved: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			added, removed := lineDiffStats(tc.before, tc.after)
+			if added != tc.wantAdded || removed != tc.wantRemoved {
+				t.Errorf("lineDiffStats() = +%d -%d, want +%d -%d", added, removed, tc.wantAdded, tc.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestDiffTrees(t *testing.T) {
+	component := "_components/main/redis/"
+	architecture := "architecture/main/nonprod/eastus2/dev/redis/"
+
+	testCases := []struct {
+		name     string
+		rendered map[string]string
+		disk     map[string]string
+		want     []Change
+	}{
+		{
+			name:     "Identical trees",
+			rendered: map[string]string{"root.hcl": "x", component + "main.tf": "y"},
+			disk:     map[string]string{"root.hcl": "x", component + "main.tf": "y"},
+		},
+		{
+			name:     "Updated file",
+			rendered: map[string]string{component + "main.tf": "a\nb\nc"},
+			disk:     map[string]string{component + "main.tf": "a\nc"},
+			want: []Change{
+				{Type: "modify", Category: "file", Component: "redis", Path: component + "main.tf", Details: "File will be updated (+1 -0 lines)"},
+			},
+		},
+		{
+			name:     "New and removed files",
+			rendered: map[string]string{"root.hcl": "x", component + "variables.tf": "v"},
+			disk:     map[string]string{"root.hcl": "x", component + "outputs.tf": "o"},
+			want: []Change{
+				{Type: "remove", Category: "file", Component: "redis", Path: component + "outputs.tf", Details: "File will be removed"},
+				{Type: "add", Category: "file", Component: "redis", Path: component + "variables.tf", Details: "File will be created"},
+			},
+		},
+		{
+			name:     "New component directory is reported once",
+			rendered: map[string]string{"_components/main/cosmos/main.tf": "c", component + "main.tf": "y", component + "variables.tf": "v"},
+			disk:     map[string]string{"_components/main/cosmos/main.tf": "c", "root.hcl": "x"},
+			want: []Change{
+				{Type: "add", Category: "file", Component: "redis", Path: "_components/main/redis", Details: "Directory will be created"},
+				{Type: "remove", Category: "file", Path: "root.hcl", Details: "File will be removed"},
+			},
+		},
+		{
+			name:     "Architecture directories are structural changes",
+			rendered: map[string]string{architecture + "terragrunt.hcl": "t", "architecture/main/README.md": "r"},
+			disk:     map[string]string{"architecture/main/README.md": "r", "architecture/main/nonprod/westus2/dev/redis/terragrunt.hcl": "t"},
+		},
+		{
+			name:     "File in an existing architecture directory",
+			rendered: map[string]string{architecture + "terragrunt.hcl": "t", architecture + "api/terragrunt.hcl": "a"},
+			disk:     map[string]string{architecture + "terragrunt.hcl": "t"},
+		},
+		{
+			name:     "Hidden entries and diagrams on disk are ignored",
+			rendered: map[string]string{"root.hcl": "x", component + "main.tf": "y"},
+			disk:     map[string]string{"root.hcl": "x", component + "main.tf": "y", "diagrams/main_dev.md": "d", component + ".terragrunt-cache/x": "c", component + ".terraform.lock.hcl": "l"},
+		},
+		{
+			name:     "Docs site on disk is ignored at the output root",
+			rendered: map[string]string{"root.hcl": "x", "config/global.hcl": "g"},
+			disk:     map[string]string{"root.hcl": "x", "config/global.hcl": "g", "docs/mkdocs.yml": "m", "docs/pages/index.md": "i", "config/docs/x": "x"},
+			want: []Change{
+				{Type: "remove", Category: "file", Path: "config/docs", Details: "Directory will be removed"},
+			},
+		},
+		{
+			name:     "File replaced by a directory",
+			rendered: map[string]string{"config/dev.hcl/x": "x"},
+			disk:     map[string]string{"config/dev.hcl": "x"},
+			want: []Change{
+				{Type: "modify", Category: "file", Path: "config/dev.hcl", Details: "Will be replaced"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			renderedRoot, diskRoot := t.TempDir(), t.TempDir()
+			for root, files := range map[string]map[string]string{renderedRoot: tc.rendered, diskRoot: tc.disk} {
+				for name, content := range files {
+					path := filepath.Join(root, filepath.FromSlash(name))
+					if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+						t.Fatal(err)
+					}
+					if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			changes, err := diffTrees(renderedRoot, diskRoot, "")
+			if err != nil {
+				t.Fatalf("diffTrees() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(changes, tc.want) {
+				t.Errorf("diffTrees() = %+v, want %+v", changes, tc.want)
+			}
+		})
+	}
+}
+
+func TestRootOptions(t *testing.T) {
+	renderer, err := templates.NewRenderer()
+	if err != nil {
+		t.Fatalf("NewRenderer() unexpected error: %v", err)
+	}
+	parse := func(options config.RootConfig) *hclsyntax.Body {
+		t.Helper()
+		content, err := renderer.RenderTemplate("environment/root.hcl.tmpl", templates.RootData{Options: options})
+		if err != nil {
+			t.Fatalf("RenderTemplate() unexpected error: %v", err)
+		}
+		file, diags := hclsyntax.ParseConfig([]byte(content), "root.hcl", hcl.InitialPos)
+		if diags.HasErrors() {
+			t.Fatalf("root.hcl doesn't parse: %v\n%s", diags, content)
+		}
+		return file.Body.(*hclsyntax.Body)
+	}
+	blockTypes := func(body *hclsyntax.Body) []string {
+		var types []string
+		for _, block := range body.Blocks {
+			types = append(types, strings.Join(append([]string{block.Type}, block.Labels...), " "))
+		}
+		return types
+	}
+
+	// Without options root.hcl only has its locals and remote state
+	body := parse(config.RootConfig{})
+	if len(body.Attributes) != 0 {
+		t.Errorf("root.hcl without options has attributes %v", body.Attributes)
+	}
+	if got, want := blockTypes(body), []string{"locals", "remote_state"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("root.hcl without options blocks = %v, want %v", got, want)
+	}
+
+	body = parse(config.RootConfig{
+		TerraformVersionConstraint:  ">= 1.9.0",
+		TerragruntVersionConstraint: ">= 0.77.0",
+		RetryableErrors:             []string{"(?s).*Error: 429.*", `(?s).*"quoted".*`},
+		RetryMaxAttempts:            5,
+		RetrySleepIntervalSec:       10,
+		ExtraArguments: []config.ExtraArguments{{
+			Name:      "plan_vars",
+			Commands:  []string{"plan", "apply"},
+			Arguments: []string{"-lock-timeout=5m"},
+			EnvVars:   map[string]string{"TF_LOG": "WARN"},
+		}},
+		Generate: []config.GenerateBlock{{
+			Name:     "azapi",
+			Path:     "azapi.tf",
+			IfExists: "skip",
+			Contents: "provider \"azapi\" {}\n",
+		}, {
+			Name:     "versions",
+			Path:     "versions_override.tf",
+			Contents: "terraform {}",
+		}},
+	})
+
+	want := map[string]cty.Value{
+		"terraform_version_constraint":  cty.StringVal(">= 1.9.0"),
+		"terragrunt_version_constraint": cty.StringVal(">= 0.77.0"),
+		"retryable_errors":              cty.TupleVal([]cty.Value{cty.StringVal("(?s).*Error: 429.*"), cty.StringVal(`(?s).*"quoted".*`)}),
+		"retry_max_attempts":            cty.NumberIntVal(5),
+		"retry_sleep_interval_sec":      cty.NumberIntVal(10),
+	}
+	if len(body.Attributes) != len(want) {
+		t.Errorf("root.hcl has %d attributes, want %d", len(body.Attributes), len(want))
+	}
+	for name, wantValue := range want {
+		attr, ok := body.Attributes[name]
+		if !ok {
+			t.Errorf("root.hcl is missing %s", name)
+			continue
+		}
+		if value, diags := attr.Expr.Value(nil); diags.HasErrors() || !value.RawEquals(wantValue) {
+			t.Errorf("root.hcl %s = %#v, want %#v", name, value, wantValue)
+		}
+	}
+
+	if got, want := blockTypes(body), []string{"locals", "remote_state", "terraform", "generate azapi", "generate versions"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("root.hcl blocks = %v, want %v", got, want)
+	}
+
+	extraArguments := body.Blocks[2].Body.Blocks
+	if len(extraArguments) != 1 || extraArguments[0].Type != "extra_arguments" || !reflect.DeepEqual(extraArguments[0].Labels, []string{"plan_vars"}) {
+		t.Fatalf("terraform block = %v, want the plan_vars extra_arguments", extraArguments)
+	}
+	wantArgs := map[string]cty.Value{
+		"commands":  cty.TupleVal([]cty.Value{cty.StringVal("plan"), cty.StringVal("apply")}),
+		"arguments": cty.TupleVal([]cty.Value{cty.StringVal("-lock-timeout=5m")}),
+		"env_vars":  cty.ObjectVal(map[string]cty.Value{"TF_LOG": cty.StringVal("WARN")}),
+	}
+	for name, wantValue := range wantArgs {
+		value, diags := extraArguments[0].Body.Attributes[name].Expr.Value(nil)
+		if diags.HasErrors() || !value.RawEquals(wantValue) {
+			t.Errorf("extra_arguments %s = %#v, want %#v", name, value, wantValue)
+		}
+	}
+
+	wantGenerate := []map[string]string{
+		{"path": "azapi.tf", "if_exists": "skip", "contents": "provider \"azapi\" {}\n"},
+		{"path": "versions_override.tf", "if_exists": "overwrite_terragrunt", "contents": "terraform {}\n"},
+	}
+	for i, wantAttrs := range wantGenerate {
+		block := body.Blocks[3+i]
+		for name, wantValue := range wantAttrs {
+			value, diags := block.Body.Attributes[name].Expr.Value(nil)
+			if diags.HasErrors() || value.AsString() != wantValue {
+				t.Errorf("generate %s %s = %q, want %q", block.Labels[0], name, value.AsString(), wantValue)
+			}
+		}
+	}
+}
+
+func TestRootStateKey(t *testing.T) {
+	renderer, err := templates.NewRenderer()
+	if err != nil {
+		t.Fatalf("NewRenderer() unexpected error: %v", err)
+	}
+	leaf := "architecture/main/nonprod/eastus2/dev/redis"
+
+	testCases := []struct {
+		name            string
+		stacksLayout    bool
+		path            string
+		keyPrefix       string
+		componentPrefix string
+		options         map[string]bool
+	}{
+		{name: "no prefix", path: leaf},
+		{name: "stacks layout", stacksLayout: true, path: "architecture/main/nonprod/eastus2/dev/.terragrunt-stack/redis"},
+		{name: "subscription prefix", path: leaf, keyPrefix: "nonprod"},
+		{name: "component prefix", path: leaf, keyPrefix: "nonprod", componentPrefix: "shared/cache"},
+		{name: "backend options", path: leaf, options: map[string]bool{"use_azuread_auth": true, "use_oidc": true, "snapshot": true}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			content, err := renderer.RenderTemplate("environment/root.hcl.tmpl", templates.RootData{StacksLayout: tc.stacksLayout})
+			if err != nil {
+				t.Fatalf("RenderTemplate() unexpected error: %v", err)
+			}
+			file, diags := hclsyntax.ParseConfig([]byte(content), "root.hcl", hcl.InitialPos)
+			if diags.HasErrors() {
+				t.Fatalf("root.hcl doesn't parse: %v", diags)
+			}
+			body := file.Body.(*hclsyntax.Body)
+
+			// Evaluate the state locals and remote state as Terragrunt would,
+			// with the subscription.hcl and state.hcl generate writes
+			subscriptionLocals := map[string]cty.Value{}
+			if tc.keyPrefix != "" {
+				subscriptionLocals["remote_state_key_prefix"] = cty.StringVal(tc.keyPrefix)
+			}
+			for name, enabled := range tc.options {
+				subscriptionLocals["remote_state_"+name] = cty.BoolVal(enabled)
+			}
+			stateLocals := map[string]cty.Value{}
+			if tc.componentPrefix != "" {
+				stateLocals["key_prefix"] = cty.StringVal(tc.componentPrefix)
+			}
+			locals := map[string]cty.Value{
+				"subscription_vars":            cty.ObjectVal(map[string]cty.Value{"locals": cty.ObjectVal(subscriptionLocals)}),
+				"state_vars":                   cty.ObjectVal(map[string]cty.Value{"locals": cty.ObjectVal(stateLocals)}),
+				"project_name":                 cty.StringVal("MyProject"),
+				"remote_state_resource_group":  cty.StringVal("rg-tfstate"),
+				"remote_state_storage_account": cty.StringVal("sttfstate"),
+				"azure_environment":            cty.StringVal("public"),
+			}
+			ctx := &hcl.EvalContext{Functions: map[string]function.Function{
+				"try":     tryfunc.TryFunc,
+				"join":    stdlib.JoinFunc,
+				"compact": stdlib.CompactFunc,
+				"lower":   stdlib.LowerFunc,
+				"replace": stdlib.ReplaceFunc,
+				"path_relative_to_include": function.New(&function.Spec{
+					Type: function.StaticReturnType(cty.String),
+					Impl: func([]cty.Value, cty.Type) (cty.Value, error) { return cty.StringVal(tc.path), nil },
+				}),
+			}}
+			ctx.Variables = map[string]cty.Value{"local": cty.ObjectVal(locals)}
+			prefix, diags := body.Blocks[0].Body.Attributes["state_key_prefix"].Expr.Value(ctx)
+			if diags.HasErrors() {
+				t.Fatalf("state_key_prefix: %v", diags)
+			}
+			locals["state_key_prefix"] = prefix
+			ctx.Variables = map[string]cty.Value{"local": cty.ObjectVal(locals)}
+
+			value, diags := body.Blocks[1].Body.Attributes["config"].Expr.Value(ctx)
+			if diags.HasErrors() {
+				t.Fatalf("remote_state config: %v", diags)
+			}
+			remoteState := value.AsValueMap()
+
+			// The key of the migration scripts, and the key of the folder
+			// without a prefix, so existing state stays in place
+			want := config.RemoteState{KeyPrefix: tc.keyPrefix}.StateKey(tc.componentPrefix, leaf)
+			if tc.keyPrefix == "" && tc.componentPrefix == "" && want != leaf+"/terraform.tfstate" {
+				t.Errorf("StateKey() = %s, want %s/terraform.tfstate", want, leaf)
+			}
+			if got := remoteState["key"].AsString(); got != want {
+				t.Errorf("remote_state key = %s, want %s", got, want)
+			}
+			for _, name := range []string{"use_azuread_auth", "use_oidc", "snapshot"} {
+				if got := remoteState[name]; !got.RawEquals(cty.BoolVal(tc.options[name])) {
+					t.Errorf("remote_state %s = %#v, want %v", name, got, tc.options[name])
+				}
+			}
+		})
+	}
+}
+
+func TestMakefile(t *testing.T) {
+	tmpDir := t.TempDir()
+	currentDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(currentDir)
+
+	if err := os.MkdirAll(filepath.Join(".tgs", "stacks"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tgsYAML := `name: projecta
+subscriptions:
+  nonprod:
+    environments:
+      - name: dev
+      - name: test
+  sandbox:
+    environments:
+      - name: dev
+`
+	stackYAML := `stack:
+  name: main
+  components:
+    redis:
+      source: azurerm_redis_cache
+      provider: azurerm
+      version: 4.22.0
+  architecture:
+    regions:
+      westus2:
+        - component: redis
+      eastus2:
+        - component: redis
+`
+	if err := os.WriteFile(filepath.Join(".tgs", "tgs.yaml"), []byte(tgsYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(".tgs", "stacks", "main.yaml"), []byte(stackYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tgsConfig, err := config.ReadTGSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := generateMakefile(tgsConfig); err != nil {
+		t.Fatalf("generateMakefile() unexpected error: %v", err)
+	}
+	makefile, err := os.ReadFile("Makefile")
+	if err != nil {
+		t.Fatalf("Failed to read Makefile: %v", err)
+	}
+
+	// Environment names shared by subscriptions are prefixed with them, and
+	// environment runs exclude the other environments of the subscription
+	for _, want := range []string{
+		"plan-test:\n\t$(TERRAGRUNT) run-all plan --terragrunt-working-dir .infrastructure/architecture/main/nonprod --terragrunt-exclude-dir 'eastus2/dev/**' --terragrunt-exclude-dir 'westus2/dev/**' $(TG_FLAGS)\n",
+		"apply-nonprod-dev-westus2:\n\t$(TERRAGRUNT) run-all apply --terragrunt-working-dir .infrastructure/architecture/main/nonprod/westus2/dev $(TG_FLAGS)\n",
+		"validate-sandbox-dev:\n\t$(TERRAGRUNT) run-all validate --terragrunt-working-dir .infrastructure/architecture/main/sandbox $(TG_FLAGS)\n",
+		"\t@echo \"  plan-sandbox-dev-eastus2\"\n",
+	} {
+		if !strings.Contains(string(makefile), want) {
+			t.Errorf("Makefile doesn't contain %q:\n%s", want, makefile)
+		}
+	}
+	if strings.Contains(string(makefile), "plan-dev:") {
+		t.Errorf("Makefile has an ambiguous plan-dev target:\n%s", makefile)
+	}
+
+	// make runs the targets
+	if _, err := exec.LookPath("make"); err == nil {
+		out, err := exec.Command("make", "--no-print-directory", "plan-test-eastus2", "TERRAGRUNT=echo", "TG_FLAGS=--terragrunt-non-interactive").CombinedOutput()
+		if err != nil {
+			t.Fatalf("make plan-test-eastus2 failed: %v\n%s", err, out)
+		}
+		want := "echo run-all plan --terragrunt-working-dir .infrastructure/architecture/main/nonprod/eastus2/test --terragrunt-non-interactive\n" +
+			"run-all plan --terragrunt-working-dir .infrastructure/architecture/main/nonprod/eastus2/test --terragrunt-non-interactive\n"
+		if string(out) != want {
+			t.Errorf("make plan-test-eastus2 = %q, want %q", out, want)
+		}
+	}
+
+	tasks, err := os.ReadFile(tasksScript)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", tasksScript, err)
+	}
+	want := "    'plan-test' {\n        Invoke-Terragrunt run-all plan --terragrunt-working-dir .infrastructure/architecture/main/nonprod --terragrunt-exclude-dir 'eastus2/dev/**' --terragrunt-exclude-dir 'westus2/dev/**' @TgFlags\n    }\n"
+	if !strings.Contains(string(tasks), want) {
+		t.Errorf("%s doesn't contain %q:\n%s", tasksScript, want, tasks)
+	}
+
+	// The stacks layout generates the units before running
+	tgsConfig.Layout = config.LayoutStacks
+	if err := generateMakefile(tgsConfig); err != nil {
+		t.Fatalf("generateMakefile() unexpected error: %v", err)
+	}
+	makefile, err = os.ReadFile("Makefile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "plan-test:\n" +
+		"\t$(TERRAGRUNT) stack generate --terragrunt-working-dir .infrastructure/architecture/main/nonprod/eastus2/test\n" +
+		"\t$(TERRAGRUNT) stack generate --terragrunt-working-dir .infrastructure/architecture/main/nonprod/westus2/test\n" +
+		"\t$(TERRAGRUNT) run-all plan --terragrunt-working-dir .infrastructure/architecture/main/nonprod"
+	if !strings.Contains(string(makefile), want) {
+		t.Errorf("Makefile of the stacks layout doesn't contain %q:\n%s", want, makefile)
+	}
+
+	// A Makefile of the project is kept, the targets going to tgs.mk
+	if err := os.WriteFile("Makefile", []byte("build:\n\tgo build\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := generateMakefile(tgsConfig); err != nil {
+		t.Fatalf("generateMakefile() unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile("Makefile"); string(data) != "build:\n\tgo build\n" {
+		t.Errorf("generateMakefile() overwrote the project Makefile: %q", data)
+	}
+	if data, err := os.ReadFile("tgs.mk"); err != nil || !strings.HasPrefix(string(data), makefileHeader) {
+		t.Errorf("generateMakefile() didn't write tgs.mk: %v", err)
+	}
+}
+
+func TestStacksLayout(t *testing.T) {
+	tmpDir := t.TempDir()
+	currentDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(currentDir)
+
+	if err := os.MkdirAll(filepath.Join(".tgs", "stacks"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tgsYAML := `name: projecta
+layout: stacks
+subscriptions:
+  nonprod:
+    remotestate:
+      name: stprojectanonprodtf
+      resource_group: rg-projecta-nonprod-tf
+    environments:
+      - name: dev
+`
+	stackYAML := `stack:
+  name: main
+  version: "1.0.0"
+  description: "Test stack"
+  components:
+    redis:
+      source: azurerm_redis_cache
+      provider: azurerm
+      version: 4.22.0
+      description: "Redis cache"
+    appservice:
+      source: azurerm_linux_web_app
+      provider: azurerm
+      version: 4.22.0
+      description: "App service"
+      deps:
+        - "{region}.redis"
+  architecture:
+    regions:
+      eastus2:
+        - component: redis
+        - component: appservice
+          apps:
+            - api
+            - name: web
+              sku: P1v3
+`
+	if err := os.WriteFile(filepath.Join(".tgs", "tgs.yaml"), []byte(tgsYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(".tgs", "stacks", "main.yaml"), []byte(stackYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Generate(); err != nil {
+		t.Fatalf("Generate() unexpected error: %v", err)
+	}
+
+	envDir := filepath.Join(".infrastructure", "architecture", "main", "nonprod", "eastus2", "dev")
+	stackPath := filepath.Join(envDir, "terragrunt.stack.hcl")
+	content, err := os.ReadFile(stackPath)
+	if err != nil {
+		t.Fatalf("Failed to read terragrunt.stack.hcl: %v", err)
+	}
+	file, diags := hclsyntax.ParseConfig(content, stackPath, hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("Failed to parse terragrunt.stack.hcl: %v\n%s", diags, content)
+	}
+
+	// A unit per component and app, sourced from _units
+	type unit struct {
+		Source string
+		Path   string
+		Inputs map[string]string
+	}
+	units := make(map[string]unit)
+	for _, block := range file.Body.(*hclsyntax.Body).Blocks {
+		if block.Type != "unit" {
+			t.Errorf("terragrunt.stack.hcl has a %s block", block.Type)
+			continue
+		}
+		var u unit
+		for name, attr := range block.Body.Attributes {
+			value, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() {
+				t.Fatalf("unit %s attribute %s: %v", block.Labels[0], name, diags)
+			}
+			switch name {
+			case "source":
+				u.Source = filepath.ToSlash(filepath.Join(envDir, value.AsString()))
+			case "path":
+				u.Path = value.AsString()
+			case "values":
+				u.Inputs = make(map[string]string)
+				for key, input := range value.GetAttr("inputs").AsValueMap() {
+					u.Inputs[key] = input.AsString()
+				}
+			}
+		}
+		units[block.Labels[0]] = u
+	}
+	want := map[string]unit{
+		"redis":          {Source: ".infrastructure/_units/main/redis", Path: "redis"},
+		"appservice_api": {Source: ".infrastructure/_units/main/appservice", Path: "appservice/api"},
+		"appservice_web": {Source: ".infrastructure/_units/main/appservice", Path: "appservice/web", Inputs: map[string]string{"sku_name": "P1v3"}},
+	}
+	if !reflect.DeepEqual(units, want) {
+		t.Errorf("units = %+v, want %+v", units, want)
+	}
+
+	// Units replace the component folders of the environment
+	for _, name := range []string{"redis", "appservice"} {
+		if _, err := os.Stat(filepath.Join(envDir, name)); !os.IsNotExist(err) {
+			t.Errorf("stacks layout generated the %s folder: %v", name, err)
+		}
+		data, err := os.ReadFile(filepath.Join(".infrastructure", "_units", "main", name, "terragrunt.hcl"))
+		if err != nil {
+			t.Fatalf("Failed to read the %s unit: %v", name, err)
+		}
+		if want := "/.infrastructure/_components/main/" + name + "/component.hcl"; !strings.Contains(string(data), want) {
+			t.Errorf("%s unit doesn't include %s:\n%s", name, want, data)
+		}
+	}
+
+	// Dependencies and state keys point to the generated units
+	for path, want := range map[string]string{
+		filepath.Join(".infrastructure", "_components", "main", "appservice", "component.hcl"): "${local.environment_vars.locals.environment_name}/.terragrunt-stack/redis\"",
+		filepath.Join(".infrastructure", "root.hcl"):                                           `replace(path_relative_to_include(), "/.terragrunt-stack", "")`,
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), want) {
+			t.Errorf("%s doesn't contain %s:\n%s", path, want, data)
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	tmpDir := t.TempDir()
+	currentDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(currentDir)
+
+	if err := os.MkdirAll(filepath.Join(".tgs", "stacks"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tgsYAML := `name: projecta
+subscriptions:
+  nonprod:
+    remotestate:
+      name: stprojectanonprodtf
+      resource_group: rg-projecta-nonprod-tf
+    environments:
+      - name: dev
+      - name: test
+`
+	stackYAML := `stack:
+  name: main
+  version: "1.0.0"
+  description: "Test stack"
+  components:
+    redis:
+      source: azurerm_redis_cache
+      provider: azurerm
+      version: 4.22.0
+      description: "Redis cache"
+    appservice:
+      source: azurerm_linux_web_app
+      provider: azurerm
+      version: 4.22.0
+      description: "App service"
+  architecture:
+    regions:
+      eastus2:
+        - component: redis
+        - component: appservice
+          apps:
+            - api
+            - name: web
+              sku: P1v3
+      westus2:
+        - component: redis
+`
+	tgsPath := filepath.Join(".tgs", "tgs.yaml")
+	stackPath := filepath.Join(".tgs", "stacks", "main.yaml")
+	if err := os.WriteFile(tgsPath, []byte(tgsYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stackPath, []byte(stackYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Generate(); err != nil {
+		t.Fatalf("Generate() unexpected error: %v", err)
+	}
+
+	arch := filepath.Join(".infrastructure", "architecture", "main", "nonprod")
+	exists := func(path string) bool {
+		_, err := os.Stat(filepath.Join(arch, filepath.FromSlash(path)))
+		return err == nil
+	}
+	approve := func([]Change) (bool, error) { return true, nil }
+
+	// A declined removal shows the impact and leaves everything in place
+	var planned []Change
+	err = RemoveComponent("main", "appservice", func(changes []Change) (bool, error) {
+		planned = changes
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("RemoveComponent() unexpected error: %v", err)
+	}
+	var removed []string
+	for _, change := range planned {
+		if change.Type == "remove" && change.Category == "component" {
+			removed = append(removed, change.Path)
+		}
+	}
+	sort.Strings(removed)
+	wantRemoved := []string{"architecture/main/nonprod/eastus2/dev/appservice", "architecture/main/nonprod/eastus2/test/appservice"}
+	if !reflect.DeepEqual(removed, wantRemoved) {
+		t.Errorf("RemoveComponent() planned component removals %v, want %v", removed, wantRemoved)
+	}
+	if data, _ := os.ReadFile(stackPath); string(data) != stackYAML || !exists("eastus2/dev/appservice/web") {
+		t.Errorf("declined RemoveComponent() changed the stack or tree:\n%s", data)
+	}
+
+	// Removing an app written as an object prunes its folder only
+	if err := RemoveApp("main", "appservice", "web", "", approve); err != nil {
+		t.Fatalf("RemoveApp() unexpected error: %v", err)
+	}
+	if exists("eastus2/dev/appservice/web") || !exists("eastus2/dev/appservice/api") {
+		t.Error("RemoveApp() should prune the web folder and keep api")
+	}
+	stack, err := ReadMainConfig("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if apps := stack.Stack.Architecture.Regions["eastus2"][1].Apps; !reflect.DeepEqual(apps, []string{"api"}) {
+		t.Errorf("apps after RemoveApp() = %v, want [api]", apps)
+	}
+
+	// Regions and environments go with their folders
+	if err := RemoveRegion("main", "westus2", approve); err != nil {
+		t.Fatalf("RemoveRegion() unexpected error: %v", err)
+	}
+	if exists("westus2") || !exists("eastus2/dev/redis") {
+		t.Error("RemoveRegion() should prune westus2 only")
+	}
+	if err := RemoveEnvironment("nonprod", "test", approve); err != nil {
+		t.Fatalf("RemoveEnvironment() unexpected error: %v", err)
+	}
+	if exists("eastus2/test") || !exists("eastus2/dev/redis") {
+		t.Error("RemoveEnvironment() should prune the test folders only")
+	}
+	tgsConfig, err := config.ReadTGSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if envs := tgsConfig.Subscriptions["nonprod"].Environments; len(envs) != 1 || envs[0].Name != "dev" {
+		t.Errorf("environments after RemoveEnvironment() = %+v, want dev", envs)
+	}
+
+	// Unknown targets fail without editing the configuration
+	stackData, _ := os.ReadFile(stackPath)
+	for name, remove := range map[string]func() error{
+		"component":   func() error { return RemoveComponent("main", "cosmos", approve) },
+		"app":         func() error { return RemoveApp("main", "appservice", "web", "", approve) },
+		"region":      func() error { return RemoveRegion("main", "centralus", approve) },
+		"environment": func() error { return RemoveEnvironment("nonprod", "prod", approve) },
+	} {
+		if err := remove(); err == nil {
+			t.Errorf("removing an unknown %s expected an error", name)
+		}
+	}
+	if data, _ := os.ReadFile(stackPath); string(data) != string(stackData) {
+		t.Errorf("failed removals changed the stack:\n%s", data)
+	}
+}
@@ -0,0 +1,101 @@
+package scaffold
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// script is a state migration script, written as a bash script and a
+// PowerShell alternative for Windows
+type script struct {
+	// Header is the comment opening the script, one line per entry
+	Header []string
+	Steps  []scriptStep
+}
+
+// scriptStep is a command of a script, run in Dir when set and preceded by
+// a comment when Comment is set
+type scriptStep struct {
+	Comment string
+	Dir     string
+	Args    []string
+}
+
+// plainArgument matches arguments neither shell needs quoted
+var plainArgument = regexp.MustCompile(`^[A-Za-z0-9_./:=-]+$`)
+
+// Bash renders the script for bash
+func (s script) Bash() string {
+	var b strings.Builder
+	b.WriteString("#!/bin/bash\n")
+	for _, line := range s.Header {
+		b.WriteString(comment(line))
+	}
+	b.WriteString("set -e\n")
+
+	for _, step := range s.Steps {
+		if step.Comment != "" {
+			b.WriteString("\n" + comment(step.Comment))
+		}
+		command := joinArgs(step.Args, bashQuote)
+		if step.Dir != "" {
+			command = fmt.Sprintf("(cd %s && %s)", bashQuote(step.Dir), command)
+		}
+		b.WriteString(command + "\n")
+	}
+	return b.String()
+}
+
+// PowerShell renders the script for PowerShell, stopping at the first
+// command that fails like set -e
+func (s script) PowerShell() string {
+	var b strings.Builder
+	for _, line := range s.Header {
+		b.WriteString(comment(line))
+	}
+	b.WriteString("$ErrorActionPreference = 'Stop'\n")
+
+	for _, step := range s.Steps {
+		if step.Comment != "" {
+			b.WriteString("\n" + comment(step.Comment))
+		}
+		command := "& " + joinArgs(step.Args, powerShellQuote) + "; if ($LASTEXITCODE -ne 0) { exit $LASTEXITCODE }"
+		if step.Dir != "" {
+			command = fmt.Sprintf("Push-Location %s; try { %s } finally { Pop-Location }", powerShellQuote(step.Dir), command)
+		}
+		b.WriteString(command + "\n")
+	}
+	return b.String()
+}
+
+func comment(line string) string {
+	if line == "" {
+		return "#\n"
+	}
+	return "# " + line + "\n"
+}
+
+func joinArgs(args []string, quote func(string) string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = quote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// bashQuote single-quotes an argument for bash when needed
+func bashQuote(arg string) string {
+	if plainArgument.MatchString(arg) {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// powerShellQuote single-quotes an argument for PowerShell when needed
+func powerShellQuote(arg string) string {
+	if plainArgument.MatchString(arg) {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", "''") + "'"
+}
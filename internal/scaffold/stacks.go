@@ -0,0 +1,70 @@
+package scaffold
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/templates"
+)
+
+// terragruntStackDir is where terragrunt stack generate creates the units of
+// a terragrunt.stack.hcl
+const terragruntStackDir = ".terragrunt-stack"
+
+// generateTerragruntStack writes the terragrunt.stack.hcl of an environment
+// in a region with a unit per component and app. Units are sourced from
+// _units/<stack>/<component>, which holds the terragrunt.hcl of the
+// component generated by the folders layout.
+func generateTerragruntStack(mainConfig *config.MainConfig, stackName, region, envName string, components []config.RegionComponent, basePath, infraPath string) error {
+	stackData := templates.TerragruntStackData{
+		EnvironmentName: envName,
+		Region:          region,
+	}
+
+	for _, comp := range components {
+		compConfig := mainConfig.Stack.Components[comp.Component]
+		unitPath := filepath.Join(infraPath, "_units", stackName, comp.Component)
+		compData := EnvironmentTemplateData{
+			StackName:      stackName,
+			Component:      comp.Component,
+			HasAppSettings: compConfig.AppSettings,
+			HasPolicyFiles: compConfig.PolicyFiles,
+			Unit:           len(comp.Apps) > 0,
+		}
+		if err := templates.Render("environment/terragrunt.hcl.tmpl", filepath.Join(unitPath, "terragrunt.hcl"), compData); err != nil {
+			return fmt.Errorf("failed to create terragrunt.hcl for unit %s: %w", comp.Component, err)
+		}
+		if err := generateStateConfig(unitPath, compConfig.StateKeyPrefix); err != nil {
+			return err
+		}
+
+		source, err := filepath.Rel(basePath, unitPath)
+		if err != nil {
+			return fmt.Errorf("failed to resolve source of unit %s: %w", comp.Component, err)
+		}
+		source = filepath.ToSlash(source)
+
+		if len(comp.Apps) == 0 {
+			stackData.Units = append(stackData.Units, templates.StackUnit{
+				Name:   comp.Component,
+				Source: source,
+				Path:   comp.Component,
+			})
+			continue
+		}
+		for _, app := range comp.Apps {
+			stackData.Units = append(stackData.Units, templates.StackUnit{
+				Name:   fmt.Sprintf("%s_%s", comp.Component, app),
+				Source: source,
+				Path:   fmt.Sprintf("%s/%s", comp.Component, app),
+				Inputs: comp.App(app).Inputs(compConfig),
+			})
+		}
+	}
+
+	if err := templates.Render("environment/terragrunt.stack.hcl.tmpl", filepath.Join(basePath, "terragrunt.stack.hcl"), stackData); err != nil {
+		return fmt.Errorf("failed to create terragrunt.stack.hcl: %w", err)
+	}
+	return nil
+}
@@ -4,75 +4,85 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
 	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/templates"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
 )
 
 // Move all terraform file generation functions here
 // (generateMainTF, generateVariablesTF, generateProviderTF, etc.)
 
-func generateTerraformFiles(compPath string, comp config.Component) error {
+// generateTerraformFiles writes the module of a component. In the full
+// generation mode optional attributes are assigned instead of commented out.
+func generateTerraformFiles(compPath string, comp config.Component, mode string) error {
+	full := mode == config.GenerationModeFull
 	if comp.Provider == "" {
 		return fmt.Errorf("no provider specified for component")
 	}
 
+	// Curated modules replace schema generation for their resource, the
+	// schema is still needed by additional resources and all outputs
+	curated := curatedModule(comp)
+	moduleData := templates.ModuleData{ResourceType: comp.Source, KeyVaultSecrets: comp.KeyVaultSecrets}
+
 	// Fetch provider schema from Terraform Registry
-	schema, err := fetchProviderSchema(comp.Provider, comp.Version, comp.Source)
-	if err != nil {
-		logger.Warning("Failed to fetch provider schema: %v, generating basic terraform files", err)
-		schema = nil
+	var schema *ProviderSchema
+	if !curated || len(comp.AdditionalResources) > 0 || comp.Outputs.All {
+		var err error
+		schema, err = fetchProviderSchema(comp.Provider, comp.Version, comp.Source)
+		if err != nil {
+			logger.Warning("Failed to fetch provider schema: %v, generating basic terraform files", err)
+			schema = nil
+		}
 	}
 
 	// Create a slice of all resources to generate
 	allResources := append([]string{comp.Source}, comp.AdditionalResources...)
 	var resourceContents []string
-	var outputContents []string
+	// attributes holds the schema attributes of the resources that have one
+	attributes := make(map[string]map[string]SchemaAttribute)
 
 	// Generate content for each resource
 	for _, resourceType := range allResources {
-		var resourceSchema struct {
-			Block struct {
-				Attributes map[string]SchemaAttribute `json:"attributes"`
-				BlockTypes map[string]struct {
-					Block struct {
-						Attributes map[string]SchemaAttribute `json:"attributes"`
-					} `json:"block"`
-					NestingMode string `json:"nesting_mode"`
-				} `json:"block_types"`
-			} `json:"block"`
-		}
-
-		// Try different provider keys
-		providerKeys := []string{
-			"registry.terraform.io/hashicorp/azurerm",
-			"hashicorp/azurerm",
+		resourceSchema, found := lookupResourceSchema(schema, resourceType)
+		if found {
+			attributes[resourceType] = resourceSchema.Block.Attributes
 		}
 
-		var found bool
-		if schema != nil && schema.ProviderSchema != nil {
-			for _, key := range providerKeys {
-				if provider, ok := schema.ProviderSchema[key]; ok {
-					if rs, ok := provider.ResourceSchemas[resourceType]; ok {
-						resourceSchema = rs
-						found = true
-						break
-					}
-				}
+		if curated && resourceType == comp.Source {
+			content, err := templates.RenderModule(comp.Source, "main.tf", moduleData)
+			if err != nil {
+				return err
 			}
-		}
-
-		if !found {
+			resourceContents = append(resourceContents, "\n"+strings.TrimRight(content, "\n"))
+		} else if !found {
 			logger.Warning("Schema not found for resource %s, generating basic resource", resourceType)
+			var keyVaultLines string
+			if resourceType == comp.Source && comp.KeyVaultSecrets {
+				keyVaultLines = `
+  app_settings = local.app_settings
+
+  identity {
+    type = "SystemAssigned"
+  }
+`
+			}
 			resourceContents = append(resourceContents, fmt.Sprintf(`
 resource "%s" "this" {
   name                = var.name
   resource_group_name = var.resource_group_name
   location            = var.location
-
+%s
   tags = var.tags
-}`, resourceType))
+}`, resourceType, keyVaultLines))
 		} else {
 			var requiredAttributes []string
 			var optionalAttributes []string
@@ -96,7 +106,10 @@ resource "%s" "this" {
 					continue
 				}
 
-				if attr.Required {
+				if resourceType == comp.Source && comp.KeyVaultSecrets && name == "app_settings" {
+					// Secret settings are merged in as Key Vault references
+					requiredAttributes = append(requiredAttributes, "  app_settings = local.app_settings")
+				} else if attr.Required {
 					// Special handling for Redis Cache family attribute
 					if isRedisCache && name == "family" {
 						requiredAttributes = append(requiredAttributes, fmt.Sprintf("  %s = coalesce(var.family, \"C\")", name))
@@ -104,40 +117,21 @@ resource "%s" "this" {
 						requiredAttributes = append(requiredAttributes, fmt.Sprintf("  %s = var.%s", name, name))
 					}
 				} else if attr.Optional && !attr.Computed {
-					// Only include purely optional fields (not computed) as comments
-					optionalAttributes = append(optionalAttributes, fmt.Sprintf("  # %s = var.%s", name, name))
+					// Only include purely optional fields (not computed), as
+					// comments unless generating the full module
+					optionalAttributes = append(optionalAttributes, optionalAssignment(full, "  ", name, "var."+name))
 				}
 			}
 
-			// Generate dynamic blocks - separate required and optional
-			for blockName, blockType := range resourceSchema.Block.BlockTypes {
-				var requiredBlockAttrs []string
-				var optionalBlockAttrs []string
-
-				for attrName, attr := range blockType.Block.Attributes {
-					if attr.Required {
-						requiredBlockAttrs = append(requiredBlockAttrs, fmt.Sprintf("      %s = %s.value.%s", attrName, blockName, attrName))
-					} else if attr.Optional && !attr.Computed {
-						optionalBlockAttrs = append(optionalBlockAttrs, fmt.Sprintf("      # %s = %s.value.%s", attrName, blockName, attrName))
-					}
-				}
-
-				if len(requiredBlockAttrs) > 0 || len(optionalBlockAttrs) > 0 {
-					block := fmt.Sprintf(`
-  dynamic "%s" {
-    for_each = var.%s
-    content {
-%s
-%s
-    }
-  }`, blockName, blockName,
-						strings.Join(requiredBlockAttrs, "\n"),
-						strings.Join(optionalBlockAttrs, "\n"))
+			// Generate nested blocks from their variables
+			for _, blockName := range sortedBlockTypes(resourceSchema.Block.BlockTypes) {
+				if block := generateNestedBlock(blockName, resourceSchema.Block.BlockTypes[blockName], full); block != "" {
 					blocks = append(blocks, block)
 				}
 			}
 
-			// Combine all attributes with optional ones as comments
+			// Combine all attributes, optional ones commented out in the
+			// compact mode
 			allAttributes := append(requiredAttributes, optionalAttributes...)
 
 			resourceContents = append(resourceContents, fmt.Sprintf(`
@@ -155,52 +149,207 @@ resource "%s" "this" {
 }`, resourceType, strings.Join(allAttributes, "\n"), strings.Join(blocks, "\n")))
 		}
 
-		// Add outputs for each resource
-		outputContents = append(outputContents, fmt.Sprintf(`
-output "%s_id" {
-  value = resource.%s.this.id
-  description = "The ID of the %s"
+	}
+
+	// Deploy the primary resource once per instance
+	if len(comp.Instances) > 0 {
+		resourceContents[0] = instancedResource(resourceContents[0], comp.Source)
+	}
+
+	// Add the deployment slots of web and function apps
+	if slotResource, appAttribute, ok := comp.SlotResource(); ok && len(comp.Slots) > 0 {
+		resourceContents = append(resourceContents, fmt.Sprintf(`
+# Deployment slots of the app, one per entry of var.slots
+resource "%s" "this" {
+  for_each = toset(var.slots)
+
+  name = each.value
+  %s = resource.%s.this.id
+  tags = var.tags
+
+  site_config {}
+
+  lifecycle {
+    ignore_changes = [
+      tags["CreatedDate"],
+      tags["Environment"]
+    ]
+  }
+}`, slotResource, appAttribute, comp.Source))
+	}
+
+	// Send the diagnostics of the primary resource to the stack's workspace
+	if comp.Diagnostics && len(comp.Instances) > 0 {
+		resourceContents = append(resourceContents, fmt.Sprintf(`
+# Diagnostic settings sending every log and metric category of each instance
+# to Log Analytics
+data "azurerm_monitor_diagnostic_categories" "this" {
+  for_each = resource.%s.this
+
+  resource_id = each.value.id
 }
 
-output "%s_name" {
-  value = resource.%s.this.name
-  description = "The name of the %s"
-}`, resourceType, resourceType, resourceType, resourceType, resourceType, resourceType))
+resource "azurerm_monitor_diagnostic_setting" "this" {
+  for_each = resource.%s.this
+
+  name                       = "${each.value.name}-diagnostics"
+  target_resource_id         = each.value.id
+  log_analytics_workspace_id = var.%s
+
+  dynamic "enabled_log" {
+    for_each = data.azurerm_monitor_diagnostic_categories.this[each.key].log_category_types
+    content {
+      category = enabled_log.value
+    }
+  }
+
+  dynamic "metric" {
+    for_each = data.azurerm_monitor_diagnostic_categories.this[each.key].metrics
+    content {
+      category = metric.value
+    }
+  }
+}`, comp.Source, comp.Source, config.WorkspaceInput))
+	} else if comp.Diagnostics {
+		resourceContents = append(resourceContents, fmt.Sprintf(`
+# Diagnostic setting sending every log and metric category to Log Analytics
+data "azurerm_monitor_diagnostic_categories" "this" {
+  resource_id = resource.%s.this.id
+}
+
+resource "azurerm_monitor_diagnostic_setting" "this" {
+  name                       = "${var.name}-diagnostics"
+  target_resource_id         = resource.%s.this.id
+  log_analytics_workspace_id = var.%s
+
+  dynamic "enabled_log" {
+    for_each = data.azurerm_monitor_diagnostic_categories.this.log_category_types
+    content {
+      category = enabled_log.value
+    }
+  }
+
+  dynamic "metric" {
+    for_each = data.azurerm_monitor_diagnostic_categories.this.metrics
+    content {
+      category = metric.value
+    }
+  }
+}`, comp.Source, comp.Source, config.WorkspaceInput))
+	}
+
+	// Apply the policy files of API Management instances
+	if comp.PolicyFiles && comp.Source == "azurerm_api_management" {
+		resourceContents = append(resourceContents, apimPoliciesTF)
 	}
 
-	// Generate main.tf with all resources
-	mainContent := strings.Join(resourceContents, "\n") + strings.Join(outputContents, "\n")
+	// Create the Key Vault secrets of the secret app settings
+	if comp.KeyVaultSecrets {
+		resourceContents = append(resourceContents, generateKeyVaultSecretsTF(comp))
+	}
+
+	// Generate main.tf with all resources, inputs read from data sources
+	// replacing their variables
+	mainContent := strings.Join(resourceContents, "\n")
+	dataInputs := comp.DataInputs()
+	for name, expr := range dataInputs {
+		reference := regexp.MustCompile(`\bvar\.` + regexp.QuoteMeta(name) + `\b`)
+		if !reference.MatchString(mainContent) {
+			logger.Warning("Input %s reads a data source, but the module of %s doesn't use var.%s", name, comp.Source, name)
+		}
+		mainContent = reference.ReplaceAllLiteralString(mainContent, expr)
+	}
 	mainPath := filepath.Join(compPath, "main.tf")
 	if err := createFile(mainPath, mainContent); err != nil {
 		return fmt.Errorf("failed to create main.tf: %w", err)
 	}
 
+	// Generate outputs.tf
+	outputsContent, err := generateOutputsTF(comp, attributes)
+	if err != nil {
+		return err
+	}
+	if err := createFile(filepath.Join(compPath, "outputs.tf"), outputsContent); err != nil {
+		return fmt.Errorf("failed to create outputs.tf: %w", err)
+	}
+
 	// Generate variables.tf
 	var varsContent string
 	if schema != nil {
-		varsContent = generateVariablesTF(schema, comp)
+		varsContent = generateVariablesTF(schema, comp, full)
 	} else {
-		varsContent = `
-variable "name" {
-  type        = string
-  description = "The name of the resource"
-}
+		varsContent = commonVariablesTF
+	}
+	if curated {
+		curatedVars, err := templates.RenderModule(comp.Source, "variables.tf", moduleData)
+		if err != nil {
+			return err
+		}
+		varsContent += "\n\n" + strings.TrimRight(curatedVars, "\n")
+	}
 
-variable "resource_group_name" {
+	if _, _, ok := comp.SlotResource(); ok && len(comp.Slots) > 0 {
+		varsContent += generateSlotsVariable(comp.Slots)
+	}
+	if len(comp.Instances) > 0 {
+		varsContent += `
+
+variable "instances" {
+  type        = any
+  description = "The instances of the resource keyed by name, each with the inputs it replaces"
+  default     = {}
+}`
+	}
+	// Resources with a workspace attribute of their own already declare it
+	if comp.Diagnostics && !declaresVariable(varsContent, config.WorkspaceInput) {
+		varsContent += fmt.Sprintf(`
+
+variable "%s" {
   type        = string
-  description = "The name of the resource group"
-}
+  description = "The Log Analytics workspace receiving the diagnostics"
+}`, config.WorkspaceInput)
+	}
 
-variable "location" {
+	if comp.KeyVaultSecrets {
+		varsContent += fmt.Sprintf(`
+
+variable "%s" {
   type        = string
-  description = "The location/region of the resource"
+  description = "The Key Vault holding the secrets of the secret app settings"
 }
 
-variable "tags" {
+variable "%s" {
   type        = map(string)
-  description = "Tags to apply to the resource"
+  description = "The Key Vault secret of each secret app setting"
+  default     = {}
+}`, config.KeyVaultInput, config.KeyVaultSecretsInput)
+		if !declaresVariable(varsContent, "app_settings") {
+			varsContent += `
+
+variable "app_settings" {
+  type        = map(string)
+  description = "The app settings of the app"
   default     = {}
 }`
+		}
+	}
+
+	if comp.PolicyFiles && comp.Source == "azurerm_api_management" {
+		varsContent += apimPoliciesVariablesTF
+	}
+
+	for name := range dataInputs {
+		varsContent = removeVariable(varsContent, name)
+	}
+
+	// Generate data.tf with the data sources
+	dataPath := filepath.Join(compPath, "data.tf")
+	if len(comp.DataSources) > 0 {
+		if err := createFile(dataPath, generateDataTF(comp.DataSources)); err != nil {
+			return fmt.Errorf("failed to create data.tf: %w", err)
+		}
+	} else if err := project.Remove(dataPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove data.tf: %w", err)
 	}
 
 	varsPath := filepath.Join(compPath, "variables.tf")
@@ -216,10 +365,10 @@ variable "tags" {
 	}
 
 	// Verify all required files exist
-	requiredFiles := []string{"main.tf", "variables.tf", "provider.tf"}
+	requiredFiles := []string{"main.tf", "outputs.tf", "variables.tf", "provider.tf"}
 	for _, file := range requiredFiles {
 		filePath := filepath.Join(compPath, file)
-		if _, err := os.Stat(filePath); err != nil {
+		if _, err := project.Stat(filePath); err != nil {
 			return fmt.Errorf("failed to verify required file %s: %w", file, err)
 		}
 	}
@@ -227,6 +376,403 @@ variable "tags" {
 	return nil
 }
 
+// generateDataTF renders the data sources of a component, sorted by name
+func generateDataTF(dataSources map[string]config.DataSource) string {
+	var names []string
+	for name := range dataSources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var blocks []string
+	for _, name := range names {
+		source := dataSources[name]
+		var args []string
+		width := 0
+		for arg := range source.Arguments {
+			args = append(args, arg)
+			if len(arg) > width {
+				width = len(arg)
+			}
+		}
+		sort.Strings(args)
+
+		var lines []string
+		for _, arg := range args {
+			lines = append(lines, fmt.Sprintf("  %-*s = %s", width, arg, dataArgument(source.Arguments[arg])))
+		}
+		blocks = append(blocks, fmt.Sprintf("data %q %q {\n%s\n}", source.Type, name, strings.Join(lines, "\n")))
+	}
+	return "# Data sources of the component, {data:name.attribute} inputs read them\n" + strings.Join(blocks, "\n\n") + "\n"
+}
+
+// dataArgument renders the value of a data source argument: references to
+// var., local. or data. and number and bool literals as they are, other
+// values as strings
+func dataArgument(value string) string {
+	expr, diags := hclsyntax.ParseExpression([]byte(value), "", hcl.InitialPos)
+	if !diags.HasErrors() {
+		switch e := expr.(type) {
+		case *hclsyntax.ScopeTraversalExpr:
+			if root := e.Traversal.RootName(); root == "var" || root == "local" || root == "data" {
+				return value
+			}
+		case *hclsyntax.LiteralValueExpr:
+			if e.Val.Type() == cty.Number || e.Val.Type() == cty.Bool {
+				return value
+			}
+		}
+	}
+	return hclString(value)
+}
+
+// escapeHCL escapes value for a quoted HCL string, keeping ${ and %{ literal
+func escapeHCL(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`, "${", "$${", "%{", "%%{").Replace(value)
+}
+
+// hclString returns a value as a quoted HCL string written literally
+func hclString(value string) string {
+	return `"` + escapeHCL(value) + `"`
+}
+
+// hclIdentifier matches the keys HCL object constructors accept unquoted
+var hclIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// hclKey returns a value as an HCL object key, quoted unless it's an
+// identifier
+func hclKey(value string) string {
+	if hclIdentifier.MatchString(value) {
+		return value
+	}
+	return hclString(value)
+}
+
+// removeVariable removes the declaration of a variable from generated
+// Terraform content, whose blocks close at the start of a line
+func removeVariable(content, name string) string {
+	start := strings.Index(content, fmt.Sprintf("variable %q {", name))
+	if start < 0 {
+		return content
+	}
+	end := strings.Index(content[start:], "\n}")
+	if end < 0 {
+		return content
+	}
+	end += start + len("\n}")
+	return strings.TrimRight(content[:start], "\n") + content[end:]
+}
+
+// variableReference matches the variable references of Terraform content
+var variableReference = regexp.MustCompile(`\bvar\.([A-Za-z_][A-Za-z0-9_-]*)\b`)
+
+// instancedResource adds for_each over var.instances to the block of a
+// resource, its variables read from the instance when it sets them. Instance
+// names are appended to the name.
+func instancedResource(content, resourceType string) string {
+	header := fmt.Sprintf("resource %q \"this\" {\n", resourceType)
+	start := strings.Index(content, header)
+	if start < 0 {
+		return content
+	}
+	start += len(header)
+	end := strings.Index(content[start:], "\n}")
+	if end < 0 {
+		return content
+	}
+	end += start
+
+	body := variableReference.ReplaceAllStringFunc(content[start:end], func(reference string) string {
+		name := strings.TrimPrefix(reference, "var.")
+		if name == "name" {
+			return `try(each.value.name, "${var.name}-${each.key}")`
+		}
+		return fmt.Sprintf("try(each.value.%s, %s)", name, reference)
+	})
+	return content[:start] + "  for_each = var.instances\n\n" + body + content[end:]
+}
+
+// commonVariablesTF declares the variables every generated module takes
+const commonVariablesTF = `
+variable "name" {
+  type        = string
+  description = "The name of the resource"
+}
+
+variable "resource_group_name" {
+  type        = string
+  description = "The name of the resource group"
+}
+
+variable "location" {
+  type        = string
+  description = "The location/region of the resource"
+}
+
+variable "tags" {
+  type        = map(string)
+  description = "Tags to apply to the resource"
+  default     = {}
+}`
+
+// curatedModule reports whether the module of a component is rendered from
+// the curated templates of its resource type instead of the provider schema
+func curatedModule(comp config.Component) bool {
+	return !comp.SchemaGeneration && templates.HasModule(comp.Source)
+}
+
+// declaresVariable reports whether Terraform content declares a variable
+func declaresVariable(content, name string) bool {
+	return strings.Contains(content, fmt.Sprintf("variable %q {", name))
+}
+
+// apimPoliciesTF applies the policy, fragments and operation policies read
+// from the policy files of an API Management instance. Fragments are created
+// first, since policies include them.
+const apimPoliciesTF = `
+# Policy fragments, included with <include-fragment fragment-id="..." />
+resource "azurerm_api_management_policy_fragment" "this" {
+  for_each = var.policy_fragments
+
+  api_management_id = resource.azurerm_api_management.this.id
+  name              = each.key
+  value             = each.value
+}
+
+# Policy of the instance
+resource "azurerm_api_management_policy" "this" {
+  count = var.policy_file == null ? 0 : 1
+
+  api_management_id = resource.azurerm_api_management.this.id
+  xml_content       = var.policy_file
+
+  depends_on = [azurerm_api_management_policy_fragment.this]
+}
+
+# Policies of single operations, keyed by <api>/<operation>
+resource "azurerm_api_management_api_operation_policy" "this" {
+  for_each = var.operation_policies
+
+  api_name            = split("/", each.key)[0]
+  operation_id        = split("/", each.key)[1]
+  api_management_name = resource.azurerm_api_management.this.name
+  resource_group_name = var.resource_group_name
+  xml_content         = each.value
+
+  depends_on = [azurerm_api_management_policy_fragment.this]
+}`
+
+// apimPoliciesVariablesTF declares the inputs of apimPoliciesTF set by
+// policies.hcl
+const apimPoliciesVariablesTF = `
+
+variable "policy_file" {
+  type        = string
+  description = "The policy of the API Management instance"
+  default     = null
+}
+
+variable "policy_fragments" {
+  type        = map(string)
+  description = "The policy fragments of the instance keyed by fragment id"
+  default     = {}
+}
+
+variable "operation_policies" {
+  type        = map(string)
+  description = "The operation policies of the instance keyed by <api>/<operation>"
+  default     = {}
+}`
+
+// generateKeyVaultSecretsTF renders the Key Vault secrets of the secret app
+// settings of an app, the access policy letting the app's managed identity
+// read them and the app settings referencing them. Secrets are created with a
+// placeholder value, the real values are set in the vault.
+func generateKeyVaultSecretsTF(comp config.Component) string {
+	return fmt.Sprintf(`
+# Key Vault secrets of the secret app settings, set their values in the vault
+resource "azurerm_key_vault_secret" "app_settings" {
+  for_each = var.%s
+
+  name         = each.value
+  value        = "placeholder"
+  key_vault_id = var.%s
+
+  lifecycle {
+    ignore_changes = [value]
+  }
+}
+
+# Lets the managed identity of the app read the secrets
+resource "azurerm_key_vault_access_policy" "app_settings" {
+  key_vault_id = var.%s
+  tenant_id    = resource.%s.this.identity[0].tenant_id
+  object_id    = resource.%s.this.identity[0].principal_id
+
+  secret_permissions = ["Get"]
+}
+
+locals {
+  # Secret app settings reference their Key Vault secret
+  app_settings = merge(var.app_settings, {
+    for setting, secret in azurerm_key_vault_secret.app_settings :
+    setting => "@Microsoft.KeyVault(SecretUri=${secret.versionless_id})"
+  })
+}`, config.KeyVaultSecretsInput, config.KeyVaultInput, config.KeyVaultInput, comp.Source, comp.Source)
+}
+
+// lookupResourceSchema returns the schema of a resource type in a provider
+// schema, which may be nil
+func lookupResourceSchema(schema *ProviderSchema, resourceType string) (ResourceSchema, bool) {
+	if schema == nil || schema.ProviderSchema == nil {
+		return ResourceSchema{}, false
+	}
+	// Try different provider keys
+	for _, key := range []string{"registry.terraform.io/hashicorp/azurerm", "hashicorp/azurerm"} {
+		if provider, ok := schema.ProviderSchema[key]; ok {
+			if rs, ok := provider.ResourceSchemas[resourceType]; ok {
+				return rs, true
+			}
+		}
+	}
+	return ResourceSchema{}, false
+}
+
+// moduleOutput is an output of the module generated for a component
+type moduleOutput struct {
+	Name         string
+	Value        string
+	Description  string
+	Sensitive    bool
+	ResourceType string
+	// Attribute is the attribute of ResourceType output, empty for the map
+	// outputs of deployment slots
+	Attribute string
+}
+
+// moduleOutputs returns the id and name outputs of every resource and the
+// attributes selected with the component's outputs, in the order of
+// outputs.tf. attributes holds the schema of each resource, missing when it
+// couldn't be fetched
+func moduleOutputs(comp config.Component, attributes map[string]map[string]SchemaAttribute) ([]moduleOutput, error) {
+	var outputs []moduleOutput
+	output := func(name, resourceType, attribute, description string, sensitive bool) {
+		value := fmt.Sprintf("resource.%s.this.%s", resourceType, attribute)
+		// Instanced resources output a map keyed by instance
+		if len(comp.Instances) > 0 && resourceType == comp.Source {
+			value = fmt.Sprintf("{ for key, instance in resource.%s.this : key => instance.%s }", resourceType, attribute)
+		}
+		outputs = append(outputs, moduleOutput{Name: name, Value: value, Description: description, Sensitive: sensitive, ResourceType: resourceType, Attribute: attribute})
+	}
+
+	// Generated inputs reference the primary resource as outputs.id/name
+	output("id", comp.Source, "id", "The ID of the "+comp.Source, false)
+	output("name", comp.Source, "name", "The name of the "+comp.Source, false)
+	for _, resourceType := range append([]string{comp.Source}, comp.AdditionalResources...) {
+		output(resourceType+"_id", resourceType, "id", "The ID of the "+resourceType, false)
+		output(resourceType+"_name", resourceType, "name", "The name of the "+resourceType, false)
+	}
+
+	if slotResource, _, ok := comp.SlotResource(); ok && len(comp.Slots) > 0 {
+		outputs = append(outputs, moduleOutput{
+			Name:         "slot_ids",
+			Value:        fmt.Sprintf("{ for name, slot in resource.%s.this : name => slot.id }", slotResource),
+			Description:  "The IDs of the deployment slots by name",
+			ResourceType: slotResource,
+		}, moduleOutput{
+			Name:         "slot_hostnames",
+			Value:        fmt.Sprintf("{ for name, slot in resource.%s.this : name => slot.default_hostname }", slotResource),
+			Description:  "The default hostnames of the deployment slots by name",
+			ResourceType: slotResource,
+		})
+	}
+
+	selected := comp.Outputs.Names
+	if comp.Outputs.All {
+		if _, ok := attributes[comp.Source]; !ok {
+			logger.Warning("Schema not found for resource %s, only generating the listed outputs", comp.Source)
+		}
+		var computed []string
+		for name, attr := range attributes[comp.Source] {
+			if attr.Computed && name != "id" && name != "name" {
+				computed = append(computed, name)
+			}
+		}
+		sort.Strings(computed)
+		selected = append(computed, selected...)
+	}
+
+	seen := map[string]bool{"id": true, "name": true}
+	for _, entry := range selected {
+		resourceType, attribute := comp.Source, entry
+		name := entry
+		if i := strings.LastIndex(entry, "."); i >= 0 {
+			resourceType, attribute = entry[:i], entry[i+1:]
+			name = resourceType + "_" + attribute
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		isResource := resourceType == comp.Source
+		for _, additional := range comp.AdditionalResources {
+			isResource = isResource || additional == resourceType
+		}
+		if !isResource {
+			return nil, fmt.Errorf("output %s refers to %s, which is not a resource of the component", entry, resourceType)
+		}
+		attr, ok := attributes[resourceType][attribute]
+		if _, known := attributes[resourceType]; known && !ok {
+			return nil, fmt.Errorf("output %s: %s has no attribute %s", entry, resourceType, attribute)
+		}
+		description := attr.Description
+		if description == "" {
+			description = fmt.Sprintf("The %s of the %s", attribute, resourceType)
+		}
+		output(name, resourceType, attribute, description, attr.Sensitive)
+	}
+
+	return outputs, nil
+}
+
+// generateOutputsTF renders the outputs of the module of a component, see
+// moduleOutputs
+func generateOutputsTF(comp config.Component, attributes map[string]map[string]SchemaAttribute) (string, error) {
+	outputs, err := moduleOutputs(comp, attributes)
+	if err != nil {
+		return "", err
+	}
+
+	var blocks []string
+	for _, output := range outputs {
+		block := fmt.Sprintf(`output "%s" {
+  value       = %s
+  description = "%s"`, output.Name, output.Value, sanitizeDescription(output.Description))
+		if output.Sensitive {
+			block += "\n  sensitive   = true"
+		}
+		blocks = append(blocks, block+"\n}")
+	}
+	return strings.Join(blocks, "\n\n") + "\n", nil
+}
+
+// generateSlotsVariable declares the deployment slots of an app, defaulting
+// to the slots of the component. Apps override them with their slots input.
+func generateSlotsVariable(slots []string) string {
+	quoted := make([]string, len(slots))
+	for i, slot := range slots {
+		quoted[i] = fmt.Sprintf("%q", slot)
+	}
+	return fmt.Sprintf(`
+
+variable "slots" {
+  type        = list(string)
+  description = "The deployment slots of the app"
+  default     = [%s]
+}`, strings.Join(quoted, ", "))
+}
+
 func generateBasicTerraformFiles(compPath string, comp config.Component) error {
 	// Generate basic main.tf
 	mainContent := fmt.Sprintf(`
@@ -279,36 +825,56 @@ variable "tags" {
 }
 
 func generateProviderTF(comp config.Component) string {
+	var required strings.Builder
+	for _, provider := range comp.Providers {
+		required.WriteString(fmt.Sprintf(`    %s = {
+      source  = "%s"
+      version = "%s"
+    }
+`, provider.Name, provider.SourceAddress(), provider.Version))
+	}
+
 	return fmt.Sprintf(`terraform {
   required_providers {
     azurerm = {
       source  = "hashicorp/azurerm"
       version = "%s"
     }
-  }
+%s  }
 }
 
 provider "azurerm" {
   	features {}
 	skip_provider_registration = true
+	environment = var.azure_environment
+	subscription_id = var.subscription_id
+	tenant_id = var.tenant_id
+}
+
+variable "azure_environment" {
+  type        = string
+  description = "The Azure cloud to deploy to (public, usgovernment or china)"
+  default     = "public"
+}
+
+variable "subscription_id" {
+  type        = string
+  description = "The subscription to deploy to, defaults to ARM_SUBSCRIPTION_ID"
+  default     = null
+}
+
+variable "tenant_id" {
+  type        = string
+  description = "The tenant of the subscription, defaults to ARM_TENANT_ID"
+  default     = null
 }
 
 data "azurerm_client_config" "current" {}
-`, comp.Version)
+`, comp.Version, required.String())
 }
 
 func generateMainTF(comp config.Component, schema *ProviderSchema) string {
-	var resourceSchema struct {
-		Block struct {
-			Attributes map[string]SchemaAttribute `json:"attributes"`
-			BlockTypes map[string]struct {
-				Block struct {
-					Attributes map[string]SchemaAttribute `json:"attributes"`
-				} `json:"block"`
-				NestingMode string `json:"nesting_mode"`
-			} `json:"block_types"`
-		} `json:"block"`
-	}
+	var resourceSchema ResourceSchema
 
 	// Try different provider keys
 	providerKeys := []string{
@@ -328,7 +894,7 @@ func generateMainTF(comp config.Component, schema *ProviderSchema) string {
 	}
 
 	if !found {
-		fmt.Printf("Warning: Schema not found for resource %s\n", comp.Source)
+		logger.Warning("Schema not found for resource %s", comp.Source)
 		return fmt.Sprintf(`
 resource "%s" "this" {
   name                = var.name
@@ -374,30 +940,9 @@ resource "%s" "this" {
 		}
 	}
 
-	// Generate dynamic blocks - separate required and optional
-	for blockName, blockType := range resourceSchema.Block.BlockTypes {
-		var requiredBlockAttrs []string
-		var optionalBlockAttrs []string
-
-		for attrName, attr := range blockType.Block.Attributes {
-			if attr.Required {
-				requiredBlockAttrs = append(requiredBlockAttrs, fmt.Sprintf("      %s = %s.value.%s", attrName, blockName, attrName))
-			} else if attr.Optional && !attr.Computed {
-				optionalBlockAttrs = append(optionalBlockAttrs, fmt.Sprintf("      # %s = %s.value.%s", attrName, blockName, attrName))
-			}
-		}
-
-		if len(requiredBlockAttrs) > 0 || len(optionalBlockAttrs) > 0 {
-			block := fmt.Sprintf(`
-  dynamic "%s" {
-    for_each = var.%s
-    content {
-%s
-%s
-    }
-  }`, blockName, blockName,
-				strings.Join(requiredBlockAttrs, "\n"),
-				strings.Join(optionalBlockAttrs, "\n"))
+	// Generate nested blocks from their variables
+	for _, blockName := range sortedBlockTypes(resourceSchema.Block.BlockTypes) {
+		if block := generateNestedBlock(blockName, resourceSchema.Block.BlockTypes[blockName], false); block != "" {
 			blocks = append(blocks, block)
 		}
 	}
@@ -432,6 +977,15 @@ output "name" {
 		comp.Source, comp.Source, comp.Source, comp.Source)
 }
 
+// optionalAssignment returns the assignment of an optional attribute,
+// commented out unless full
+func optionalAssignment(full bool, indent, name, value string) string {
+	if full {
+		return fmt.Sprintf("%s%s = %s", indent, name, value)
+	}
+	return fmt.Sprintf("%s# %s = %s", indent, name, value)
+}
+
 func shouldSkipVariable(name string, resourceType string) bool {
 	// Skip common variables that are handled separately
 	commonVars := []string{
@@ -465,46 +1019,23 @@ func shouldSkipVariable(name string, resourceType string) bool {
 	return false
 }
 
-func generateVariablesTF(schema *ProviderSchema, comp config.Component) string {
+// generateVariablesTF writes the variables of a module. Variables of
+// optional attributes default to null in the full generation mode, so the
+// provider defaults apply until an input sets them.
+func generateVariablesTF(schema *ProviderSchema, comp config.Component, full bool) string {
 	// Common variables that most Azure resources need
-	variables := []string{`
-variable "name" {
-  type        = string
-  description = "The name of the resource"
-}
-
-variable "resource_group_name" {
-  type        = string
-  description = "The name of the resource group"
-}
-
-variable "location" {
-  type        = string
-  description = "The location/region of the resource"
-}
-
-variable "tags" {
-  type        = map(string)
-  description = "Tags to apply to the resource"
-  default     = {}
-}`}
+	variables := []string{commonVariablesTF}
 
 	// Create a slice of all resources to generate variables for
 	allResources := append([]string{comp.Source}, comp.AdditionalResources...)
 
 	// Generate variables for each resource
 	for _, resourceType := range allResources {
-		var resourceSchema struct {
-			Block struct {
-				Attributes map[string]SchemaAttribute `json:"attributes"`
-				BlockTypes map[string]struct {
-					Block struct {
-						Attributes map[string]SchemaAttribute `json:"attributes"`
-					} `json:"block"`
-					NestingMode string `json:"nesting_mode"`
-				} `json:"block_types"`
-			} `json:"block"`
+		// Curated modules declare the variables of their resource
+		if resourceType == comp.Source && curatedModule(comp) {
+			continue
 		}
+		var resourceSchema ResourceSchema
 
 		// Try different provider keys
 		providerKeys := []string{
@@ -538,6 +1069,9 @@ variable "tags" {
 
 				// Generate smart defaults based on attribute name and type
 				defaultValue := generateSmartDefault(name, attr)
+				if full && !attr.Required {
+					defaultValue = "default = null"
+				}
 
 				varBlock := fmt.Sprintf(`
 variable "%s" {
@@ -552,8 +1086,17 @@ variable "%s" {
 			}
 
 			// Handle nested blocks
-			for blockName, blockType := range resourceSchema.Block.BlockTypes {
-				variables = append(variables, generateNestedBlockVariable(blockName, blockType))
+			for _, blockName := range sortedBlockTypes(resourceSchema.Block.BlockTypes) {
+				variable := generateNestedBlockVariable(blockName, resourceSchema.Block.BlockTypes[blockName])
+				// Apps reading Key Vault secrets need a managed identity
+				if resourceType == comp.Source && comp.KeyVaultSecrets && blockName == "identity" {
+					if singleBlock(resourceSchema.Block.BlockTypes[blockName]) {
+						variable = strings.Replace(variable, "default     = null", `default     = { type = "SystemAssigned" }`, 1)
+					} else {
+						variable = strings.Replace(variable, "default     = []", `default     = [{ type = "SystemAssigned" }]`, 1)
+					}
+				}
+				variables = append(variables, variable)
 			}
 		}
 	}
@@ -665,25 +1208,175 @@ func sanitizeDescription(desc string) string {
 	return strings.ReplaceAll(desc, `"`, `\"`)
 }
 
-func generateNestedBlockVariable(blockName string, blockType struct {
-	Block struct {
-		Attributes map[string]SchemaAttribute `json:"attributes"`
-	} `json:"block"`
-	NestingMode string `json:"nesting_mode"`
-}) string {
+// singleBlock reports whether a nested block holds at most one block, so
+// its variable is an object rather than a collection of objects
+func singleBlock(blockType SchemaBlockType) bool {
+	switch blockType.NestingMode {
+	case "single", "group":
+		return true
+	case "list", "set":
+		return blockType.MaxItems == 1
+	default:
+		return false
+	}
+}
+
+// hasRequiredAttributes reports whether a nested block has required attributes
+func hasRequiredAttributes(blockType SchemaBlockType) bool {
+	for _, attr := range blockType.Block.Attributes {
+		if attr.Required {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedBlockTypes returns the names of nested blocks sorted
+func sortedBlockTypes(blockTypes map[string]SchemaBlockType) []string {
+	names := make([]string, 0, len(blockTypes))
+	for name := range blockTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// generateNestedBlock renders a nested block of a resource from its
+// variable: required single blocks as a concrete block, others as a dynamic
+// block over the variable. In the full generation mode optional attributes
+// are assigned instead of commented out.
+func generateNestedBlock(blockName string, blockType SchemaBlockType, full bool) string {
+	single := singleBlock(blockType)
+	concrete := single && blockType.MinItems > 0
+
+	var names []string
+	for name := range blockType.Block.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	indent := "      "
+	value := blockName + ".value."
+	if concrete {
+		indent = "    "
+		value = "var." + blockName + "."
+	}
+	var attrs []string
+	for _, name := range names {
+		attr := blockType.Block.Attributes[name]
+		if attr.Required {
+			attrs = append(attrs, fmt.Sprintf("%s%s = %s%s", indent, name, value, name))
+		} else if attr.Optional && !attr.Computed {
+			attrs = append(attrs, optionalAssignment(full, indent, name, value+name))
+		}
+	}
+
+	switch {
+	case concrete:
+		return fmt.Sprintf(`
+  %s {
+%s
+  }`, blockName, strings.Join(attrs, "\n"))
+	case len(attrs) == 0:
+		return ""
+	case single:
+		return fmt.Sprintf(`
+  dynamic "%s" {
+    for_each = var.%s == null ? [] : [var.%s]
+    content {
+%s
+    }
+  }`, blockName, blockName, blockName, strings.Join(attrs, "\n"))
+	default:
+		return fmt.Sprintf(`
+  dynamic "%s" {
+    for_each = var.%s
+    content {
+%s
+    }
+  }`, blockName, blockName, strings.Join(attrs, "\n"))
+	}
+}
+
+// generateNestedBlockVariable declares the variable of a nested block: an
+// object for blocks holding at most one block, otherwise a list, set or map
+// of objects bounded by the block's min and max items. Required blocks
+// default to empty ones unless they have required attributes.
+func generateNestedBlockVariable(blockName string, blockType SchemaBlockType) string {
+	var names []string
+	for name := range blockType.Block.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
 	var attrs []string
-	for attrName, attr := range blockType.Block.Attributes {
-		if attr.Required || attr.Optional {
-			attrs = append(attrs, fmt.Sprintf("      %s = optional(%s)", attrName, convertType(attr.Type)))
+	for _, name := range names {
+		attr := blockType.Block.Attributes[name]
+		if attr.Required {
+			attrs = append(attrs, fmt.Sprintf("    %s = %s", name, convertType(attr.Type)))
+		} else if attr.Optional {
+			attrs = append(attrs, fmt.Sprintf("    %s = optional(%s)", name, convertType(attr.Type)))
+		}
+	}
+	object := fmt.Sprintf("object({\n%s\n  })", strings.Join(attrs, "\n"))
+
+	required := blockType.MinItems > 0
+	if singleBlock(blockType) {
+		defaultValue := "\n  default     = null"
+		if required && hasRequiredAttributes(blockType) {
+			defaultValue = ""
+		} else if required {
+			defaultValue = "\n  default     = {}"
 		}
+		return fmt.Sprintf(`
+variable "%s" {
+  type = %s
+  description = "%s configuration block"%s
+}`, blockName, object, blockName, defaultValue)
+	}
+
+	collection := "list"
+	switch blockType.NestingMode {
+	case "set":
+		collection = "set"
+	case "map":
+		collection = "map"
+	}
+	defaultValue := "\n  default     = []"
+	if collection == "map" {
+		defaultValue = "\n  default     = {}"
+	}
+	if required && hasRequiredAttributes(blockType) {
+		defaultValue = ""
+	} else if required {
+		defaultValue = "\n  default     = [{}]"
+	}
+
+	var validation string
+	if blockType.MinItems > 0 || blockType.MaxItems > 0 {
+		var conditions []string
+		bounds := fmt.Sprintf("at least %d", blockType.MinItems)
+		if blockType.MinItems > 0 {
+			conditions = append(conditions, fmt.Sprintf("length(var.%s) >= %d", blockName, blockType.MinItems))
+		}
+		if blockType.MaxItems > 0 {
+			conditions = append(conditions, fmt.Sprintf("length(var.%s) <= %d", blockName, blockType.MaxItems))
+			bounds = fmt.Sprintf("at most %d", blockType.MaxItems)
+			if blockType.MinItems > 0 {
+				bounds = fmt.Sprintf("between %d and %d", blockType.MinItems, blockType.MaxItems)
+			}
+		}
+		validation = fmt.Sprintf(`
+
+  validation {
+    condition     = %s
+    error_message = "%s must have %s blocks."
+  }`, strings.Join(conditions, " && "), blockName, bounds)
 	}
 
 	return fmt.Sprintf(`
 variable "%s" {
-  type = list(object({
-%s
-  }))
-  description = "%s configuration block"
-  default     = []
-}`, blockName, strings.Join(attrs, "\n"), blockName)
+  type = %s(%s)
+  description = "%s configuration blocks"%s%s
+}`, blockName, collection, object, blockName, defaultValue, validation)
 }
@@ -0,0 +1,309 @@
+package scaffold
+
+import (
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// terratestVersion is the terratest release required by the generated go.mod
+const terratestVersion = "v0.47.2"
+
+// moduleVariable is a variable of a component module
+type moduleVariable struct {
+	name       string
+	typ        string
+	hasDefault bool
+}
+
+// GenerateTests writes a terratest file per component of every stack into
+// testDir/<stack>, planning the component module with mocked inputs. Existing
+// files are kept, so the generated tests can be edited.
+func GenerateTests(testDir string) error {
+	tgsConfig, err := config.ReadTGSConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read TGS config: %w", err)
+	}
+
+	stacks := make(map[string]bool)
+	for _, sub := range tgsConfig.Subscriptions {
+		for _, env := range sub.Environments {
+			stacks[stackOf(env)] = true
+		}
+	}
+	var stackNames []string
+	for name := range stacks {
+		stackNames = append(stackNames, name)
+	}
+	sort.Strings(stackNames)
+
+	goMod := filepath.Join(testDir, "go.mod")
+	if _, err := project.Stat(goMod); os.IsNotExist(err) {
+		module := strings.ToLower(tgsConfig.Name) + "/test"
+		content := fmt.Sprintf("module %s\n\ngo 1.22\n\nrequire github.com/gruntwork-io/terratest %s\n", module, terratestVersion)
+		if err := createFile(goMod, content); err != nil {
+			return fmt.Errorf("failed to write %s: %w", goMod, err)
+		}
+		logger.Success("Generated %s, run go mod tidy in %s to resolve its dependencies", goMod, testDir)
+	}
+
+	for _, stackName := range stackNames {
+		mainConfig, err := ReadMainConfig(stackName)
+		if err != nil {
+			return fmt.Errorf("failed to read stack config %s: %w", stackName, err)
+		}
+
+		var compNames []string
+		for name := range mainConfig.Stack.Components {
+			compNames = append(compNames, name)
+		}
+		sort.Strings(compNames)
+
+		for _, compName := range compNames {
+			path := filepath.Join(testDir, stackName, compName+"_test.go")
+			if _, err := project.Stat(path); err == nil {
+				logger.Info("Keeping existing %s", path)
+				continue
+			}
+
+			content, err := renderComponentTest(testDir, mainConfig, compName)
+			if err != nil {
+				return fmt.Errorf("failed to generate test for %s/%s: %w", stackName, compName, err)
+			}
+			if err := createFile(path, content); err != nil {
+				return fmt.Errorf("failed to write %s: %w", path, err)
+			}
+			logger.Success("Generated %s", path)
+		}
+	}
+	return nil
+}
+
+// renderComponentTest renders the terratest file of a component, planning a
+// copy of its module with a mock value for every variable without a default
+func renderComponentTest(testDir string, mainConfig *config.MainConfig, compName string) (string, error) {
+	stackName := mainConfig.Stack.Name
+	comp := mainConfig.Stack.Components[compName]
+	moduleDir := output.ModuleDir(stackName, compName)
+
+	variables, err := moduleVariables(filepath.Join(moduleDir, "variables.tf"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read module variables, run tgs generate first: %w", err)
+	}
+	resources, err := moduleResources(filepath.Join(moduleDir, "main.tf"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read module resources: %w", err)
+	}
+
+	componentsDir, err := filepath.Rel(filepath.Join(testDir, stackName), filepath.Dir(moduleDir))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve components directory: %w", err)
+	}
+
+	mocks := dependencyMocks(mainConfig, comp)
+	var vars strings.Builder
+	for _, variable := range variables {
+		if variable.hasDefault {
+			continue
+		}
+		value, comment := mockValue(mainConfig, compName, comp, variable, mocks)
+		if comment != "" {
+			comment = " // " + comment
+		}
+		fmt.Fprintf(&vars, "\t\t\t%q: %s,%s\n", variable.name, value, comment)
+	}
+
+	var assertions strings.Builder
+	for _, resource := range resources {
+		fmt.Fprintf(&assertions, "\tterraform.RequirePlannedValuesMapKeyExists(t, plan, %q)\n", resource)
+	}
+
+	source := fmt.Sprintf(`// Generated by tgs test scaffold as a starting point. Edit it freely, tgs
+// doesn't overwrite existing tests.
+
+package test
+
+import (
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+)
+
+// Test%s plans the %s component module of the %s stack with mocked inputs
+func Test%s(t *testing.T) {
+	t.Parallel()
+
+	// The module is planned in a copy, so runs leave no .terraform folder in the tree
+	dir := test_structure.CopyTerraformFolderToTemp(t, %q, %q)
+	options := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: dir,
+		NoColor:      true,
+		Vars: map[string]interface{}{
+%s		},
+	})
+
+	plan := terraform.InitAndPlanAndShowWithStruct(t, options)
+%s}
+`, testName(compName), compName, stackName, testName(compName), filepath.ToSlash(componentsDir), filepath.Base(moduleDir), vars.String(), assertions.String())
+
+	formatted, err := format.Source([]byte(source))
+	if err != nil {
+		return "", fmt.Errorf("failed to format test: %w", err)
+	}
+	return string(formatted), nil
+}
+
+// dependencyMocks returns the mock outputs of the dependencies of a
+// component by dependency block name
+func dependencyMocks(mainConfig *config.MainConfig, comp config.Component) map[string]map[string]string {
+	mocks := make(map[string]map[string]string)
+	names := config.DependencyNames(comp.Deps)
+	for i, dep := range comp.Deps {
+		depComp := dep
+		if parts := strings.Split(dep, "."); len(parts) >= 2 {
+			depComp = parts[1]
+		}
+		mocks[names[i]] = mockOutputs(mainConfig.Stack.Components[depComp], depComp, comp.DependencyOptions[dep])
+	}
+	for _, name := range comp.ExternalDeps {
+		if ext, ok := mainConfig.Stack.ExternalDependencies[name]; ok {
+			mocks[name] = ext.MockOutputs
+		}
+	}
+	return mocks
+}
+
+// mockValue returns the Go literal passed for a variable, and a comment saying
+// where it comes from. Inputs of the stack file that reference a dependency
+// get the dependency's mock output, other variables a placeholder of their
+// type.
+func mockValue(mainConfig *config.MainConfig, compName string, comp config.Component, variable moduleVariable, mocks map[string]map[string]string) (string, string) {
+	if input, ok := comp.Inputs[variable.name]; ok {
+		refs := config.DependencyReferences(input)
+		if len(refs) == 0 {
+			return fmt.Sprintf("%q", input), "Input of the stack file"
+		}
+		if len(refs) == 1 {
+			if value, ok := mocks[refs[0].Name][refs[0].Output]; ok {
+				return fmt.Sprintf("%q", value), fmt.Sprintf("Mocked output of the %s dependency", refs[0].Name)
+			}
+		}
+	}
+
+	switch variable.name {
+	case "name":
+		return fmt.Sprintf("%q", "mock-"+compName), ""
+	case "resource_group_name":
+		return `"mock-rg"`, ""
+	case "location":
+		var regions []string
+		for region := range mainConfig.Stack.Architecture.Regions {
+			regions = append(regions, region)
+		}
+		sort.Strings(regions)
+		if len(regions) > 0 {
+			return fmt.Sprintf("%q", regions[0]), ""
+		}
+		return `"eastus2"`, ""
+	}
+
+	typ := strings.ReplaceAll(variable.typ, " ", "")
+	switch {
+	case strings.HasSuffix(variable.name, "_id") && (typ == "" || typ == "string"):
+		return fmt.Sprintf("%q", "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/mock-rg/providers/Microsoft.Resources/mock-"+strings.TrimSuffix(variable.name, "_id")), "TODO: set a real ID"
+	case typ == "number":
+		return "1", "TODO: set a realistic value"
+	case typ == "bool":
+		return "false", "TODO: set a realistic value"
+	case strings.HasPrefix(typ, "list(") || strings.HasPrefix(typ, "set(") || strings.HasPrefix(typ, "tuple("):
+		return "[]interface{}{}", "TODO: set a realistic value"
+	case strings.HasPrefix(typ, "map(") || strings.HasPrefix(typ, "object("):
+		return "map[string]interface{}{}", "TODO: set a realistic value"
+	default:
+		return fmt.Sprintf("%q", "mock-"+variable.name), "TODO: set a realistic value"
+	}
+}
+
+// moduleVariables returns the variables of a variables.tf, sorted by name
+func moduleVariables(path string) ([]moduleVariable, error) {
+	body, content, err := parseModuleFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var variables []moduleVariable
+	for _, block := range body.Blocks {
+		if block.Type != "variable" || len(block.Labels) != 1 {
+			continue
+		}
+		variable := moduleVariable{name: block.Labels[0]}
+		if attr, ok := block.Body.Attributes["type"]; ok {
+			variable.typ = strings.TrimSpace(string(attr.Expr.Range().SliceBytes(content)))
+		}
+		_, variable.hasDefault = block.Body.Attributes["default"]
+		variables = append(variables, variable)
+	}
+	sort.Slice(variables, func(i, j int) bool { return variables[i].name < variables[j].name })
+	return variables, nil
+}
+
+// moduleResources returns the addresses of the resources of a main.tf that
+// are planned once, skipping those with count or for_each
+func moduleResources(path string) ([]string, error) {
+	body, _, err := parseModuleFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []string
+	for _, block := range body.Blocks {
+		if block.Type != "resource" || len(block.Labels) != 2 {
+			continue
+		}
+		_, count := block.Body.Attributes["count"]
+		_, forEach := block.Body.Attributes["for_each"]
+		if count || forEach {
+			continue
+		}
+		resources = append(resources, block.Labels[0]+"."+block.Labels[1])
+	}
+	return resources, nil
+}
+
+// parseModuleFile parses a Terraform file of a component module
+func parseModuleFile(path string) (*hclsyntax.Body, []byte, error) {
+	content, err := project.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, diags := hclparse.NewParser().ParseHCL(content, path)
+	if diags.HasErrors() {
+		return nil, nil, fmt.Errorf("failed to parse %s: %s", path, diags.Error())
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, nil, fmt.Errorf("failed to parse %s", path)
+	}
+	return body, content, nil
+}
+
+// testName returns the Go name of a component for its test function, e.g.
+// AppService for app_service
+func testName(compName string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(compName, func(r rune) bool { return r == '_' || r == '-' || r == '.' }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
 	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
 	"github.com/hashicorp/hcl/v2/hclparse"
 )
 
@@ -37,7 +38,7 @@ func ValidateGeneratedConfigs() error {
 // validateHCLFiles validates HCL syntax for all files matching the pattern in the given directory
 func validateHCLFiles(dir, pattern string) error {
 	// Walk through all files in the directory
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+	err := project.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -55,7 +56,7 @@ func validateHCLFiles(dir, pattern string) error {
 		}
 
 		// Read file content
-		content, err := os.ReadFile(path)
+		content, err := project.ReadFile(path)
 		if err != nil {
 			return fmt.Errorf("failed to read file %s: %w", path, err)
 		}
@@ -157,7 +158,7 @@ func validateStackConfigs() error {
 	stacksDir := getStacksDir()
 
 	// Read all stack files
-	entries, err := os.ReadDir(stacksDir)
+	entries, err := project.ReadDir(stacksDir)
 	if err != nil {
 		return fmt.Errorf("failed to read stacks directory: %w", err)
 	}
@@ -207,18 +208,19 @@ func validateStackConfigs() error {
 }
 
 // ValidateComponentStructure validates the structure and content of a component directory
-func ValidateComponentStructure(componentPath string) error {
+// and its module directory, the same unless the module is shared
+func ValidateComponentStructure(componentPath, moduleDir string) error {
 	// Check required files exist
 	requiredFiles := []string{
-		"main.tf",
-		"variables.tf",
-		"provider.tf",
-		"component.hcl",
+		filepath.Join(moduleDir, "main.tf"),
+		filepath.Join(moduleDir, "variables.tf"),
+		filepath.Join(moduleDir, "provider.tf"),
+		filepath.Join(componentPath, "component.hcl"),
 	}
 
-	for _, file := range requiredFiles {
-		filePath := filepath.Join(componentPath, file)
-		if _, err := os.Stat(filePath); err != nil {
+	for _, filePath := range requiredFiles {
+		file := filepath.Base(filePath)
+		if _, err := project.Stat(filePath); err != nil {
 			if os.IsNotExist(err) {
 				return fmt.Errorf("required file %s is missing in component", file)
 			}
@@ -277,7 +279,7 @@ func getRequiredVariablesForResource(resourceType string) map[string]bool {
 // ValidateComponentVariables validates component variables against environment config
 func ValidateComponentVariables(componentPath string, envConfigPath string) error {
 	// Check if the environment config file exists
-	if _, err := os.Stat(envConfigPath); err != nil {
+	if _, err := project.Stat(envConfigPath); err != nil {
 		if os.IsNotExist(err) {
 			return fmt.Errorf("environment config file %s does not exist", envConfigPath)
 		}
@@ -286,7 +288,7 @@ func ValidateComponentVariables(componentPath string, envConfigPath string) erro
 
 	// Check if the component.hcl file exists
 	compPath := filepath.Join(componentPath, "component.hcl")
-	if _, err := os.Stat(compPath); err != nil {
+	if _, err := project.Stat(compPath); err != nil {
 		if os.IsNotExist(err) {
 			return fmt.Errorf("component.hcl file does not exist in %s", componentPath)
 		}
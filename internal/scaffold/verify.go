@@ -0,0 +1,192 @@
+package scaffold
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+)
+
+// VerifyOptions configures Verify
+type VerifyOptions struct {
+	// Parallel is the number of components verified at once
+	Parallel int
+	// Changed only verifies components with uncommitted changes
+	Changed bool
+}
+
+// VerifyResult is the outcome of a verification step
+type VerifyResult struct {
+	// Name is the component, <stack>/<component>, or the terragrunt check
+	Name   string
+	Err    error
+	Output string
+}
+
+// hclValidateCheck is the name of the terragrunt check of the tree
+const hclValidateCheck = "terragrunt hclvalidate"
+
+// Verify checks the generated tree without touching remote state: terragrunt
+// hclvalidate over the tree, and terraform init -backend=false and terraform
+// validate in a copy of every component module, so the tree keeps no
+// .terraform folders or lock files
+func Verify(opts VerifyOptions) ([]VerifyResult, error) {
+	for _, tool := range []string{"terraform", "terragrunt"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return nil, fmt.Errorf("%s is required to verify the generated tree: %w", tool, err)
+		}
+	}
+
+	infraPath := output.Dir()
+	components, err := componentModules(infraPath)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Changed {
+		var changed []string
+		for _, comp := range components {
+			if hasChanges(filepath.Join(infraPath, "_components", filepath.FromSlash(comp))) {
+				changed = append(changed, comp)
+			}
+		}
+		components = changed
+	}
+
+	results := []VerifyResult{runCheck(hclValidateCheck, infraPath, nil, "terragrunt", "hclvalidate")}
+
+	parallel := opts.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+	if parallel > len(components) {
+		parallel = len(components)
+	}
+
+	// Providers are downloaded once per worker: Terraform's plugin cache
+	// isn't safe for concurrent inits, so every worker has its own
+	pluginCache, err := project.Abs(filepath.Join(".tgs", "cache", "plugins"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve plugin cache: %w", err)
+	}
+
+	workerCaches := make([]string, parallel)
+	for worker := range workerCaches {
+		workerCaches[worker] = filepath.Join(pluginCache, fmt.Sprintf("worker-%d", worker))
+		if err := project.MkdirAll(workerCaches[worker], 0755); err != nil {
+			return nil, fmt.Errorf("failed to create plugin cache: %w", err)
+		}
+	}
+
+	componentResults := make([]VerifyResult, len(components))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for _, workerCache := range workerCaches {
+		wg.Add(1)
+		go func(workerCache string) {
+			defer wg.Done()
+			for i := range jobs {
+				componentResults[i] = verifyComponent(infraPath, components[i], workerCache)
+			}
+		}(workerCache)
+	}
+	for i := range components {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return append(results, componentResults...), nil
+}
+
+// componentModules returns the component modules of the tree as
+// <stack>/<component>, sorted
+func componentModules(infraPath string) ([]string, error) {
+	matches, err := project.Glob(filepath.Join(infraPath, "_components", "*", "*", "main.tf"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find component modules: %w", err)
+	}
+	var components []string
+	for _, match := range matches {
+		rel, err := filepath.Rel(filepath.Join(infraPath, "_components"), filepath.Dir(match))
+		if err != nil {
+			continue
+		}
+		components = append(components, filepath.ToSlash(rel))
+	}
+	sort.Strings(components)
+	return components, nil
+}
+
+// hasChanges reports whether git sees uncommitted or untracked changes in
+// dir. Outside a git repository every component counts as changed.
+func hasChanges(dir string) bool {
+	cmd := project.Command("git", "status", "--porcelain", "--untracked-files=all", ".")
+	cmd.Dir = project.Path(dir)
+	out, err := cmd.Output()
+	return err != nil || len(bytes.TrimSpace(out)) > 0
+}
+
+// verifyComponent runs terraform init and validate in a copy of a component
+// module
+func verifyComponent(infraPath, comp, pluginCache string) VerifyResult {
+	tmpDir, err := os.MkdirTemp("", "tgs-verify")
+	if err != nil {
+		return VerifyResult{Name: comp, Err: fmt.Errorf("failed to create temp dir: %w", err)}
+	}
+	defer project.RemoveAll(tmpDir)
+
+	if err := copyModule(filepath.Join(infraPath, "_components", filepath.FromSlash(comp)), tmpDir); err != nil {
+		return VerifyResult{Name: comp, Err: err}
+	}
+
+	env := []string{"TF_PLUGIN_CACHE_DIR=" + pluginCache, "TF_IN_AUTOMATION=1"}
+	if result := runCheck(comp, tmpDir, env, "terraform", "init", "-backend=false", "-input=false", "-no-color"); result.Err != nil {
+		return result
+	}
+	return runCheck(comp, tmpDir, env, "terraform", "validate", "-no-color")
+}
+
+// runCheck runs a command in dir, keeping its output when it fails
+func runCheck(name, dir string, env []string, command string, args ...string) VerifyResult {
+	cmd := project.Command(command, args...)
+	cmd.Dir = project.Path(dir)
+	cmd.Env = append(os.Environ(), env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return VerifyResult{
+			Name:   name,
+			Err:    fmt.Errorf("%s %s failed: %w", command, strings.Join(args, " "), err),
+			Output: strings.TrimSpace(string(out)),
+		}
+	}
+	return VerifyResult{Name: name}
+}
+
+// copyModule copies the files of a module directory, skipping hidden entries
+// such as .terraform
+func copyModule(src, dst string) error {
+	entries, err := project.ReadDir(src)
+	if err != nil {
+		return fmt.Errorf("failed to read module %s: %w", src, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		data, err := project.ReadFile(filepath.Join(src, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", entry.Name(), err)
+		}
+		if err := project.WriteFile(filepath.Join(dst, entry.Name()), data, 0644); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// Package scan runs the policy-as-code scanners of tgs.yaml over the
+// component modules
+package scan
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+)
+
+// Args returns the command line of a scanner over componentsDir, failing on
+// findings of the severity threshold or above. tgs scan and the generated
+// pipelines run the same command lines.
+func Args(tool string, security config.SecurityConfig, componentsDir string) []string {
+	severity := strings.ToUpper(security.SeverityThreshold())
+	switch tool {
+	case config.SecurityToolTfsec:
+		return []string{"tfsec", componentsDir, "--minimum-severity", severity, "--no-color"}
+	case config.SecurityToolCheckov:
+		return []string{"checkov", "--directory", componentsDir, "--framework", "terraform", "--compact", "--quiet", "--hard-fail-on", severity}
+	case config.SecurityToolConftest:
+		// Rego rules have no severity: deny rules always fail, warn rules
+		// only at the lowest threshold
+		args := []string{"conftest", "test", "--policy", security.PolicyDir(), "--all-namespaces"}
+		if security.SeverityThreshold() == "low" {
+			args = append(args, "--fail-on-warn")
+		}
+		return append(args, componentsDir)
+	}
+	return nil
+}
+
+// Run runs the scanners over componentsDir, all of them unless tools are
+// given, streaming their output. It fails when a scanner reports findings.
+func Run(security config.SecurityConfig, componentsDir string, tools []string) error {
+	if len(tools) == 0 {
+		tools = security.Tools
+	}
+	if len(tools) == 0 {
+		return fmt.Errorf("no scanners configured: set security.tools in tgs.yaml or pass --tool")
+	}
+
+	var failed []string
+	for _, tool := range tools {
+		args := Args(tool, security, componentsDir)
+		if args == nil {
+			return fmt.Errorf("unsupported tool %q: must be one of %s", tool, strings.Join(config.SecurityTools, ", "))
+		}
+		if _, err := exec.LookPath(args[0]); err != nil {
+			return fmt.Errorf("%s is required to scan the components: %w", tool, err)
+		}
+
+		logger.Section(tool)
+		cmd := project.Command(args[0], args[1:]...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			logger.Error("%s reported findings: %v", tool, err)
+			failed = append(failed, tool)
+			continue
+		}
+		logger.Success("%s passed", tool)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("security scan failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
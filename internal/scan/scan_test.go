@@ -0,0 +1,23 @@
+package scan
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+)
+
+func TestArgs(t *testing.T) {
+	security := config.SecurityConfig{}
+	if got, want := Args(config.SecurityToolTfsec, security, "_components"), []string{"tfsec", "_components", "--minimum-severity", "HIGH", "--no-color"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Args(tfsec) = %v, want %v", got, want)
+	}
+
+	security = config.SecurityConfig{Severity: "low", Policies: "policy"}
+	if got, want := Args(config.SecurityToolConftest, security, "_components"), []string{"conftest", "test", "--policy", "policy", "--all-namespaces", "--fail-on-warn", "_components"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Args(conftest) = %v, want %v", got, want)
+	}
+	if got := Args("kics", security, "_components"); got != nil {
+		t.Errorf("Args(kics) = %v, want nil", got)
+	}
+}
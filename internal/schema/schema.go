@@ -0,0 +1,264 @@
+// Package schema derives JSON Schemas for tgs.yaml and stack files from the
+// config structs, and checks YAML documents against them
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"gopkg.in/yaml.v3"
+)
+
+// Dir is where tgs schema export writes the schemas by default
+const Dir = ".tgs/schema"
+
+// Schema files written by Export
+const (
+	TGSFile   = "tgs.schema.json"
+	StackFile = "stack.schema.json"
+)
+
+// Schema is the subset of JSON Schema draft-07 the config files need
+type Schema struct {
+	Draft       string             `json:"$schema,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	// AdditionalProperties is false for structs and the value schema for maps
+	AdditionalProperties interface{} `json:"additionalProperties,omitempty"`
+	Items                *Schema     `json:"items,omitempty"`
+	Enum                 []string    `json:"enum,omitempty"`
+	OneOf                []*Schema   `json:"oneOf,omitempty"`
+}
+
+// enums lists the values of fields that only accept a fixed set, keyed by
+// struct and field name
+var enums = map[string][]string{
+	"TGSConfig.Layout":           {config.LayoutFolders, config.LayoutStacks},
+	"ToolingConfig.VersionFiles": {config.VersionFilesTfenv, config.VersionFilesAsdf, config.VersionFilesNone},
+	"Subscription.Cloud":         {"public", "usgov", "china"},
+	"SecurityConfig.Severity":    config.SecuritySeverities,
+}
+
+// override returns the schema of fields with a custom YAML form, keyed by
+// struct and field name, or nil for fields derived from their type
+func override(key string) *Schema {
+	switch key {
+	case "Component.Outputs":
+		return &Schema{OneOf: []*Schema{
+			{Type: "array", Items: &Schema{Type: "string"}},
+			forType(reflect.TypeOf(config.Outputs{})),
+		}}
+	case "SecurityConfig.Tools":
+		return &Schema{Type: "array", Items: &Schema{Type: "string", Enum: config.SecurityTools}}
+	case "RegionComponent.Apps":
+		return &Schema{Type: "array", Items: &Schema{OneOf: []*Schema{
+			{Type: "string"},
+			forType(reflect.TypeOf(config.App{})),
+		}}}
+	}
+	return nil
+}
+
+// TGS returns the schema of .tgs/tgs.yaml
+func TGS() *Schema {
+	s := forType(reflect.TypeOf(config.TGSConfig{}))
+	s.Draft = "http://json-schema.org/draft-07/schema#"
+	s.Title = "tgs.yaml"
+	s.Description = "TGS project configuration"
+	return s
+}
+
+// Stack returns the schema of the stack files in .tgs/stacks
+func Stack() *Schema {
+	s := forType(reflect.TypeOf(config.MainConfig{}))
+	s.Draft = "http://json-schema.org/draft-07/schema#"
+	s.Title = "TGS stack"
+	s.Description = "TGS stack configuration"
+	return s
+}
+
+// forType derives the schema of a config type from its yaml tags
+func forType(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return forType(t.Elem())
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		return &Schema{Type: "integer"}
+	case reflect.Slice:
+		return &Schema{Type: "array", Items: forType(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: forType(t.Elem())}
+	case reflect.Struct:
+		s := &Schema{Type: "object", Properties: make(map[string]*Schema), AdditionalProperties: false}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			prop := forType(field.Type)
+			if o := override(t.Name() + "." + field.Name); o != nil {
+				prop = o
+			}
+			prop.Enum = enums[t.Name()+"."+field.Name]
+			s.Properties[name] = prop
+		}
+		return s
+	}
+	return &Schema{}
+}
+
+// Export writes the tgs.yaml and stack schemas to dir
+func Export(dir string) ([]string, error) {
+	if err := project.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create schema directory: %w", err)
+	}
+
+	var paths []string
+	for _, file := range []string{TGSFile, StackFile} {
+		s := TGS()
+		if file == StackFile {
+			s = Stack()
+		}
+		data, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode schema %s: %w", file, err)
+		}
+		path := filepath.Join(dir, file)
+		if err := project.WriteFile(path, append(data, '\n'), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write schema %s: %w", path, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// Problem is a part of a document that doesn't match its schema
+type Problem struct {
+	// Path is the dotted path of the offending key, e.g. stack.components.redis
+	Path    string
+	Line    int
+	Message string
+}
+
+// Check parses a YAML document and reports where it doesn't match s
+func Check(data []byte, s *Schema) ([]Problem, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+
+	// Check values as TGS reads them, after expanding ${env:VAR} placeholders
+	config.ExpandNode(&doc)
+
+	var problems []Problem
+	check(doc.Content[0], s, "", &problems)
+	return problems, nil
+}
+
+// check compares a node with its schema, appending every mismatch
+func check(node *yaml.Node, s *Schema, path string, problems *[]Problem) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "" {
+		node.Tag = node.ShortTag()
+	}
+	report := func(format string, args ...interface{}) {
+		*problems = append(*problems, Problem{Path: path, Line: node.Line, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.OneOf) > 0 {
+		var types []string
+		for _, alternative := range s.OneOf {
+			if alternative.Type == nodeType(node) {
+				check(node, alternative, path, problems)
+				return
+			}
+			types = append(types, alternative.Type)
+		}
+		report("expected %s, got %s", strings.Join(types, " or "), nodeType(node))
+		return
+	}
+
+	if got := nodeType(node); s.Type != "" && got != s.Type {
+		report("expected %s, got %s", s.Type, got)
+		return
+	}
+
+	switch s.Type {
+	case "string":
+		if len(s.Enum) > 0 && !contains(s.Enum, node.Value) {
+			report("%q is not one of %s", node.Value, strings.Join(s.Enum, ", "))
+		}
+	case "array":
+		for i, item := range node.Content {
+			check(item, s.Items, fmt.Sprintf("%s[%d]", path, i), problems)
+		}
+	case "object":
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			childPath := key.Value
+			if path != "" {
+				childPath = path + "." + key.Value
+			}
+
+			if prop, ok := s.Properties[key.Value]; ok {
+				check(value, prop, childPath, problems)
+				continue
+			}
+			switch additional := s.AdditionalProperties.(type) {
+			case *Schema:
+				check(value, additional, childPath, problems)
+			case bool:
+				if !additional {
+					*problems = append(*problems, Problem{Path: path, Line: key.Line, Message: fmt.Sprintf("unknown property '%s'", key.Value)})
+				}
+			}
+		}
+	}
+}
+
+// nodeType returns the JSON Schema type of a YAML node
+func nodeType(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "object"
+	case yaml.SequenceNode:
+		return "array"
+	}
+	switch node.Tag {
+	case "!!null":
+		return "null"
+	case "!!bool":
+		return "boolean"
+	case "!!int":
+		return "integer"
+	case "!!float":
+		return "number"
+	}
+	return "string"
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
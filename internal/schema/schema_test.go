@@ -0,0 +1,57 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckReportsUnknownKeysAndTypes(t *testing.T) {
+	stack := `stack:
+  name: web
+  version: 1.0.0
+  description: Web
+  components:
+    redis:
+      sorce: azurerm_redis_cache
+      provider: azurerm
+      version: 4.22.0
+      description: Cache
+      app_settings: "yes"
+  architecture:
+    regions:
+      eastus2:
+        - component: redis
+          apps: web
+`
+	problems, err := Check([]byte(stack), Stack())
+	if err != nil {
+		t.Fatalf("Check() unexpected error: %v", err)
+	}
+
+	want := map[string]string{
+		"stack.components.redis":                     "unknown property 'sorce'",
+		"stack.components.redis.app_settings":        "expected boolean, got string",
+		"stack.architecture.regions.eastus2[0].apps": "expected array, got string",
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("Check() = %+v, want %d problems", problems, len(want))
+	}
+	for _, problem := range problems {
+		if want[problem.Path] != problem.Message {
+			t.Errorf("unexpected problem %+v", problem)
+		}
+		if problem.Line == 0 {
+			t.Errorf("problem %+v has no line", problem)
+		}
+	}
+}
+
+func TestCheckEnums(t *testing.T) {
+	problems, err := Check([]byte("name: proj\nlayout: nested\n"), TGS())
+	if err != nil {
+		t.Fatalf("Check() unexpected error: %v", err)
+	}
+	if len(problems) != 1 || !strings.Contains(problems[0].Message, "folders, stacks") || problems[0].Line != 2 {
+		t.Errorf("Check() = %+v, want a layout enum problem on line 2", problems)
+	}
+}
@@ -0,0 +1,386 @@
+package stackdiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats of a diff
+const (
+	FormatText     = "text"
+	FormatJSON     = "json"
+	FormatMarkdown = "markdown"
+)
+
+// Change is a difference between two stack configurations
+type Change struct {
+	Type      string `json:"type"`     // "add", "remove", "modify"
+	Category  string `json:"category"` // "stack", "component", "version", "dependency", "architecture", "external_dependency"
+	Component string `json:"component,omitempty"`
+	Region    string `json:"region,omitempty"`
+	Details   string `json:"details"`
+}
+
+// ReadRevision reads a stack configuration as of a git revision
+func ReadRevision(stackName, ref string) (*config.MainConfig, error) {
+	// A ref starting with a dash would be parsed as an option of git show
+	if ref == "" || strings.HasPrefix(ref, "-") {
+		return nil, fmt.Errorf("invalid git ref %q", ref)
+	}
+
+	path := filepath.ToSlash(filepath.Join(".tgs", "stacks", stackName+".yaml"))
+	out, err := project.Command("git", "show", fmt.Sprintf("%s:./%s", ref, path)).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("failed to read %s at %s: %s", path, ref, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("failed to run git: %w", err)
+	}
+
+	var mainConfig config.MainConfig
+	if err := yaml.Unmarshal(out, &mainConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse %s at %s: %w", path, ref, err)
+	}
+	return &mainConfig, nil
+}
+
+// Compare returns the changes from stack a to stack b
+func Compare(a, b *config.MainConfig) []Change {
+	var changes []Change
+
+	if a.Stack.Version != b.Stack.Version {
+		changes = append(changes, Change{
+			Type:     "modify",
+			Category: "stack",
+			Details:  fmt.Sprintf("version %s -> %s", a.Stack.Version, b.Stack.Version),
+		})
+	}
+
+	for _, name := range union(keys(a.Stack.Components), keys(b.Stack.Components)) {
+		before, inA := a.Stack.Components[name]
+		after, inB := b.Stack.Components[name]
+		switch {
+		case !inA:
+			changes = append(changes, Change{Type: "add", Category: "component", Component: name, Details: describe(after)})
+		case !inB:
+			changes = append(changes, Change{Type: "remove", Category: "component", Component: name, Details: describe(before)})
+		default:
+			changes = append(changes, compareComponent(name, before, after)...)
+		}
+	}
+
+	changes = append(changes, compareArchitecture(a.Stack.Architecture, b.Stack.Architecture)...)
+
+	for _, name := range union(keys(a.Stack.ExternalDependencies), keys(b.Stack.ExternalDependencies)) {
+		before, inA := a.Stack.ExternalDependencies[name]
+		after, inB := b.Stack.ExternalDependencies[name]
+		switch {
+		case !inA:
+			changes = append(changes, Change{Type: "add", Category: "external_dependency", Component: name, Details: "external dependency added"})
+		case !inB:
+			changes = append(changes, Change{Type: "remove", Category: "external_dependency", Component: name, Details: "external dependency removed"})
+		case !equalYAML(before, after):
+			changes = append(changes, Change{Type: "modify", Category: "external_dependency", Component: name, Details: "external dependency changed"})
+		}
+	}
+
+	return changes
+}
+
+// compareComponent returns the changes of a component present in both stacks
+func compareComponent(name string, a, b config.Component) []Change {
+	var changes []Change
+	modify := func(category, details string) {
+		changes = append(changes, Change{Type: "modify", Category: category, Component: name, Details: details})
+	}
+
+	if a.Source != b.Source {
+		modify("component", fmt.Sprintf("source %s -> %s", a.Source, b.Source))
+	}
+	if a.Provider != b.Provider {
+		modify("component", fmt.Sprintf("provider %s -> %s", a.Provider, b.Provider))
+	}
+	if a.Version != b.Version {
+		modify("version", fmt.Sprintf("%s %s -> %s", a.Provider, a.Version, b.Version))
+	}
+	if a.AppSettings != b.AppSettings {
+		modify("component", fmt.Sprintf("app_settings %t -> %t", a.AppSettings, b.AppSettings))
+	}
+	if a.PolicyFiles != b.PolicyFiles {
+		modify("component", fmt.Sprintf("policy_files %t -> %t", a.PolicyFiles, b.PolicyFiles))
+	}
+
+	before := make(map[string]config.ProviderRequirement)
+	for _, p := range a.Providers {
+		before[p.Name] = p
+	}
+	after := make(map[string]config.ProviderRequirement)
+	for _, p := range b.Providers {
+		after[p.Name] = p
+	}
+	for _, provider := range union(keys(before), keys(after)) {
+		pa, inA := before[provider]
+		pb, inB := after[provider]
+		switch {
+		case !inA:
+			modify("version", fmt.Sprintf("provider %s %s added", provider, pb.Version))
+		case !inB:
+			modify("version", fmt.Sprintf("provider %s removed", provider))
+		case pa.Version != pb.Version || pa.SourceAddress() != pb.SourceAddress():
+			modify("version", fmt.Sprintf("%s %s -> %s", provider, pa.Version, pb.Version))
+		}
+	}
+
+	added, removed := listDiff(a.Deps, b.Deps)
+	for _, dep := range added {
+		changes = append(changes, Change{Type: "add", Category: "dependency", Component: name, Details: "depends on " + dep})
+	}
+	for _, dep := range removed {
+		changes = append(changes, Change{Type: "remove", Category: "dependency", Component: name, Details: "no longer depends on " + dep})
+	}
+	added, removed = listDiff(a.ExternalDeps, b.ExternalDeps)
+	for _, dep := range added {
+		changes = append(changes, Change{Type: "add", Category: "dependency", Component: name, Details: "depends on external " + dep})
+	}
+	for _, dep := range removed {
+		changes = append(changes, Change{Type: "remove", Category: "dependency", Component: name, Details: "no longer depends on external " + dep})
+	}
+	if !equalYAML(a.DependencyOptions, b.DependencyOptions) {
+		modify("dependency", "dependency options changed")
+	}
+
+	return changes
+}
+
+// compareArchitecture returns the regions, components and apps added or
+// removed. A component leaving a single region for another is reported as a
+// move.
+func compareArchitecture(a, b config.ArchitectureConfig) []Change {
+	var changes []Change
+
+	placements := func(arch config.ArchitectureConfig) map[string]map[string][]string {
+		byComponent := make(map[string]map[string][]string)
+		for region, components := range arch.Regions {
+			for _, rc := range components {
+				if byComponent[rc.Component] == nil {
+					byComponent[rc.Component] = make(map[string][]string)
+				}
+				byComponent[rc.Component][region] = rc.Apps
+			}
+		}
+		return byComponent
+	}
+	before, after := placements(a), placements(b)
+
+	for _, region := range union(keys(a.Regions), keys(b.Regions)) {
+		if _, ok := a.Regions[region]; !ok {
+			changes = append(changes, Change{Type: "add", Category: "architecture", Region: region, Details: "region added"})
+		} else if _, ok := b.Regions[region]; !ok {
+			changes = append(changes, Change{Type: "remove", Category: "architecture", Region: region, Details: "region removed"})
+		}
+	}
+
+	for _, comp := range union(keys(before), keys(after)) {
+		added, removed := listDiff(keys(before[comp]), keys(after[comp]))
+		if len(added) == 1 && len(removed) == 1 {
+			changes = append(changes, Change{Type: "modify", Category: "architecture", Component: comp, Region: added[0], Details: fmt.Sprintf("moved from %s to %s", removed[0], added[0])})
+		} else {
+			for _, region := range added {
+				changes = append(changes, Change{Type: "add", Category: "architecture", Component: comp, Region: region, Details: "deployed to " + region + apps(after[comp][region])})
+			}
+			for _, region := range removed {
+				changes = append(changes, Change{Type: "remove", Category: "architecture", Component: comp, Region: region, Details: "removed from " + region})
+			}
+		}
+
+		for _, region := range keys(before[comp]) {
+			appsAfter, ok := after[comp][region]
+			if !ok {
+				continue
+			}
+			addedApps, removedApps := listDiff(before[comp][region], appsAfter)
+			for _, app := range addedApps {
+				changes = append(changes, Change{Type: "add", Category: "architecture", Component: comp, Region: region, Details: "app " + app + " added"})
+			}
+			for _, app := range removedApps {
+				changes = append(changes, Change{Type: "remove", Category: "architecture", Component: comp, Region: region, Details: "app " + app + " removed"})
+			}
+		}
+	}
+
+	return changes
+}
+
+// Format renders changes from stack a to stack b as text, JSON or Markdown
+func Format(changes []Change, format, a, b string) (string, error) {
+	switch format {
+	case "", FormatText:
+		return formatText(changes, a, b), nil
+	case FormatJSON:
+		if changes == nil {
+			changes = []Change{}
+		}
+		data, err := json.MarshalIndent(struct {
+			From       string   `json:"from"`
+			To         string   `json:"to"`
+			HasChanges bool     `json:"has_changes"`
+			Changes    []Change `json:"changes"`
+		}{a, b, len(changes) > 0, changes}, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal diff: %w", err)
+		}
+		return string(data) + "\n", nil
+	case FormatMarkdown:
+		return formatMarkdown(changes, a, b), nil
+	default:
+		return "", fmt.Errorf("unsupported output format: %s (use text, json or markdown)", format)
+	}
+}
+
+// symbols prefix changes by type
+var symbols = map[string]string{"add": "+", "remove": "-", "modify": "~"}
+
+// sections orders the categories of the report
+var sections = []struct{ category, title string }{
+	{"stack", "Stack"},
+	{"component", "Components"},
+	{"version", "Versions"},
+	{"dependency", "Dependencies"},
+	{"architecture", "Architecture"},
+	{"external_dependency", "External dependencies"},
+}
+
+// formatText renders changes as a human readable report grouped by category
+func formatText(changes []Change, a, b string) string {
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("Comparing %s -> %s\n", a, b))
+	if len(changes) == 0 {
+		out.WriteString("\nNo differences.\n")
+		return out.String()
+	}
+
+	for _, section := range sections {
+		var lines []string
+		for _, change := range changes {
+			if change.Category == section.category {
+				lines = append(lines, fmt.Sprintf("  %s %s", symbols[change.Type], label(change)))
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		out.WriteString(fmt.Sprintf("\n%s:\n%s\n", section.title, strings.Join(lines, "\n")))
+	}
+	return out.String()
+}
+
+// formatMarkdown renders changes as Markdown tables suitable for PR comments
+func formatMarkdown(changes []Change, a, b string) string {
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("## Stack diff `%s` -> `%s`\n", a, b))
+	if len(changes) == 0 {
+		out.WriteString("\nNo differences.\n")
+		return out.String()
+	}
+
+	for _, section := range sections {
+		var rows []string
+		for _, change := range changes {
+			if change.Category == section.category {
+				rows = append(rows, fmt.Sprintf("| `%s` | %s |", symbols[change.Type], label(change)))
+			}
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		out.WriteString(fmt.Sprintf("\n### %s\n\n| | Change |\n|---|---|\n%s\n", section.title, strings.Join(rows, "\n")))
+	}
+	return out.String()
+}
+
+// label returns the description of a change with what it affects
+func label(change Change) string {
+	switch {
+	case change.Component != "":
+		return fmt.Sprintf("%s: %s", change.Component, change.Details)
+	case change.Region != "":
+		return fmt.Sprintf("%s: %s", change.Region, change.Details)
+	default:
+		return change.Details
+	}
+}
+
+// describe summarises a component
+func describe(comp config.Component) string {
+	return fmt.Sprintf("%s (%s %s)", comp.Source, comp.Provider, comp.Version)
+}
+
+// apps describes the apps of a component in a region
+func apps(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" with apps %s", strings.Join(names, ", "))
+}
+
+// listDiff returns the values added to and removed from a list
+func listDiff(a, b []string) (added, removed []string) {
+	inA := make(map[string]bool)
+	for _, v := range a {
+		inA[v] = true
+	}
+	inB := make(map[string]bool)
+	for _, v := range b {
+		inB[v] = true
+		if !inA[v] {
+			added = append(added, v)
+		}
+	}
+	for _, v := range a {
+		if !inB[v] {
+			removed = append(removed, v)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// keys returns the sorted keys of a map
+func keys[V any](m map[string]V) []string {
+	var out []string
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// union returns the sorted union of two sorted key lists
+func union(a, b []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, k := range append(append([]string{}, a...), b...) {
+		if !seen[k] {
+			seen[k] = true
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// equalYAML compares values by their YAML encoding
+func equalYAML(a, b interface{}) bool {
+	da, errA := yaml.Marshal(a)
+	db, errB := yaml.Marshal(b)
+	return errA == nil && errB == nil && string(da) == string(db)
+}
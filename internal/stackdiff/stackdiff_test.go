@@ -0,0 +1,65 @@
+package stackdiff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+)
+
+func TestCompare(t *testing.T) {
+	a := &config.MainConfig{Stack: config.StackConfig{
+		Version: "1.0.0",
+		Components: map[string]config.Component{
+			"redis":      {Source: "azurerm_redis_cache", Provider: "azurerm", Version: "4.22.0"},
+			"appservice": {Source: "azurerm_linux_web_app", Provider: "azurerm", Version: "4.22.0", Deps: []string{"{region}.redis"}},
+			"keyvault":   {Source: "azurerm_key_vault", Provider: "azurerm", Version: "4.22.0"},
+		},
+		Architecture: config.ArchitectureConfig{Regions: map[string][]config.RegionComponent{
+			"eastus2": {{Component: "redis"}, {Component: "appservice", Apps: []string{"api"}}},
+			"westus2": {{Component: "keyvault"}},
+		}},
+	}}
+	b := &config.MainConfig{Stack: config.StackConfig{
+		Version: "1.0.0",
+		Components: map[string]config.Component{
+			"redis":      {Source: "azurerm_redis_cache", Provider: "azurerm", Version: "4.30.0"},
+			"appservice": {Source: "azurerm_linux_web_app", Provider: "azurerm", Version: "4.22.0", Deps: []string{"{region}.keyvault"}},
+			"serviceplan": {
+				Source: "azurerm_service_plan", Provider: "azurerm", Version: "4.22.0",
+			},
+		},
+		Architecture: config.ArchitectureConfig{Regions: map[string][]config.RegionComponent{
+			"eastus2":   {{Component: "redis"}, {Component: "appservice", Apps: []string{"api", "web"}}},
+			"centralus": {{Component: "keyvault"}},
+		}},
+	}}
+
+	want := []Change{
+		{Type: "add", Category: "dependency", Component: "appservice", Details: "depends on {region}.keyvault"},
+		{Type: "remove", Category: "dependency", Component: "appservice", Details: "no longer depends on {region}.redis"},
+		{Type: "remove", Category: "component", Component: "keyvault", Details: "azurerm_key_vault (azurerm 4.22.0)"},
+		{Type: "modify", Category: "version", Component: "redis", Details: "azurerm 4.22.0 -> 4.30.0"},
+		{Type: "add", Category: "component", Component: "serviceplan", Details: "azurerm_service_plan (azurerm 4.22.0)"},
+		{Type: "add", Category: "architecture", Region: "centralus", Details: "region added"},
+		{Type: "remove", Category: "architecture", Region: "westus2", Details: "region removed"},
+		{Type: "add", Category: "architecture", Component: "appservice", Region: "eastus2", Details: "app web added"},
+		{Type: "modify", Category: "architecture", Component: "keyvault", Region: "centralus", Details: "moved from westus2 to centralus"},
+	}
+	if got := Compare(a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("Compare() =\n%+v\nwant\n%+v", got, want)
+	}
+
+	if got := Compare(a, a); len(got) != 0 {
+		t.Errorf("Compare() of identical stacks = %+v, want no changes", got)
+	}
+}
+
+func TestReadRevisionRejectsOptions(t *testing.T) {
+	for _, ref := range []string{"", "--output=/tmp/x", "-p"} {
+		if _, err := ReadRevision("main", ref); err == nil || !strings.Contains(err.Error(), "invalid git ref") {
+			t.Errorf("ReadRevision(%q) error = %v, want invalid git ref", ref, err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package state
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/azure"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+)
+
+// BackupPrefix returns the folder of the backup container a backup taken at
+// t is written to, e.g. 20261014T091500Z/
+func BackupPrefix(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z") + "/"
+}
+
+// BackupSubscriptions returns the subscriptions with a remotestate.backup,
+// or the named ones, failing for a named subscription without a backup
+func BackupSubscriptions(tgsConfig *config.TGSConfig, names []string) ([]string, error) {
+	if len(names) == 0 {
+		for name, sub := range tgsConfig.Subscriptions {
+			if sub.RemoteState.Backup != nil {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		return names, nil
+	}
+
+	for _, name := range names {
+		sub, ok := tgsConfig.Subscriptions[name]
+		if !ok {
+			return nil, fmt.Errorf("subscription %s is not defined in tgs.yaml", name)
+		}
+		if sub.RemoteState.Backup == nil {
+			return nil, fmt.Errorf("subscription %s has no remotestate.backup", name)
+		}
+	}
+	return names, nil
+}
+
+// Backup copies every state blob of a subscription's container to its backup
+// container under BackupPrefix(now), returning the number of blobs copied
+func Backup(tgsConfig *config.TGSConfig, subscription string, now time.Time) (int, error) {
+	sub := tgsConfig.Subscriptions[subscription]
+	if sub.RemoteState.Backup == nil {
+		return 0, fmt.Errorf("subscription %s has no remotestate.backup", subscription)
+	}
+
+	container := strings.ToLower(tgsConfig.Name)
+	blobs, err := azure.ListBlobs(sub.RemoteState.Name, container, sub.Cloud)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list state of subscription %s: %w", subscription, err)
+	}
+
+	var names []string
+	for _, blob := range blobs {
+		if strings.HasSuffix(blob.Name, stateSuffix) {
+			names = append(names, blob.Name)
+		}
+	}
+	if len(names) == 0 {
+		return 0, nil
+	}
+
+	backup := sub.RemoteState.Backup
+	if err := azure.CopyBlobs(sub.RemoteState.Name, container, names, sub.RemoteState.BackupAccount(), backup.Container, BackupPrefix(now), sub.Cloud); err != nil {
+		return 0, fmt.Errorf("failed to back up state of subscription %s: %w", subscription, err)
+	}
+	return len(names), nil
+}
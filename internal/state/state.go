@@ -0,0 +1,235 @@
+// Package state inventories the remote state of the generated tree
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/azure"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// Statuses of a state key
+const (
+	// StatusTracked is a state blob of a generated terragrunt folder
+	StatusTracked = "tracked"
+	// StatusOrphaned is a state blob no generated folder uses
+	StatusOrphaned = "orphaned"
+	// StatusMissing is a generated folder without state, e.g. not applied yet
+	StatusMissing = "missing"
+)
+
+// stateSuffix ends the keys of Terraform state blobs
+const stateSuffix = "terraform.tfstate"
+
+// Entry is a state key of a subscription's container
+type Entry struct {
+	Subscription string    `json:"subscription"`
+	Account      string    `json:"account"`
+	Container    string    `json:"container"`
+	Key          string    `json:"key"`
+	Status       string    `json:"status"`
+	Size         int64     `json:"size,omitempty"`
+	LastModified time.Time `json:"last_modified,omitempty"`
+}
+
+// List lists the state blobs of every subscription's container and
+// cross-references them with the terragrunt folders generated in infraPath
+func List(tgsConfig *config.TGSConfig, infraPath string) ([]Entry, error) {
+	expected, err := ExpectedKeys(tgsConfig, infraPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var subs []string
+	for name := range tgsConfig.Subscriptions {
+		subs = append(subs, name)
+	}
+	sort.Strings(subs)
+
+	// The container of root.hcl is the lowercase project name
+	container := strings.ToLower(tgsConfig.Name)
+	var entries []Entry
+	for _, name := range subs {
+		sub := tgsConfig.Subscriptions[name]
+		blobs, err := azure.ListBlobs(sub.RemoteState.Name, container, sub.Cloud)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list state of subscription %s: %w", name, err)
+		}
+		for _, entry := range Compare(expected[name], blobs) {
+			entry.Subscription = name
+			entry.Account = sub.RemoteState.Name
+			entry.Container = container
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// Compare cross-references the state blobs of a container with the keys the
+// generated tree expects, sorted by key
+func Compare(expected []string, blobs []azure.Blob) []Entry {
+	wanted := make(map[string]bool)
+	for _, key := range expected {
+		wanted[key] = true
+	}
+
+	var entries []Entry
+	found := make(map[string]bool)
+	for _, blob := range blobs {
+		if !strings.HasSuffix(blob.Name, stateSuffix) {
+			continue
+		}
+		status := StatusOrphaned
+		if wanted[blob.Name] {
+			status = StatusTracked
+			found[blob.Name] = true
+		}
+		entries = append(entries, Entry{Key: blob.Name, Status: status, Size: blob.Size, LastModified: blob.LastModified})
+	}
+	for _, key := range expected {
+		if !found[key] {
+			entries = append(entries, Entry{Key: key, Status: StatusMissing})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries
+}
+
+// ExpectedKeys returns the state keys of the terragrunt folders generated in
+// infraPath by subscription, the way root.hcl computes them: the folder
+// relative to root.hcl, prefixed with the state_key_prefix of its state.hcl
+// or the key_prefix of the subscription
+func ExpectedKeys(tgsConfig *config.TGSConfig, infraPath string) (map[string][]string, error) {
+	expected := make(map[string][]string)
+	add := func(dir, stateDir string) {
+		rel, err := filepath.Rel(infraPath, dir)
+		if err != nil {
+			return
+		}
+		rel = filepath.ToSlash(rel)
+		// architecture/<stack>/<subscription>/...
+		parts := strings.Split(rel, "/")
+		if len(parts) < 3 {
+			return
+		}
+		sub, ok := tgsConfig.Subscriptions[parts[2]]
+		if !ok {
+			return
+		}
+		expected[parts[2]] = append(expected[parts[2]], sub.RemoteState.StateKey(keyPrefix(stateDir), rel))
+	}
+
+	root := filepath.Join(infraPath, "architecture")
+	err := project.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		switch info.Name() {
+		case "terragrunt.hcl":
+			add(filepath.Dir(path), filepath.Dir(path))
+		case "terragrunt.stack.hcl":
+			// Units keep the state keys of the folders layout, and the state.hcl
+			// of their source
+			units, err := stackUnits(path)
+			if err != nil {
+				return err
+			}
+			for _, unit := range units {
+				add(filepath.Join(filepath.Dir(path), filepath.FromSlash(unit.path)), filepath.Join(filepath.Dir(path), filepath.FromSlash(unit.source)))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read generated tree: %w", err)
+	}
+
+	for _, keys := range expected {
+		sort.Strings(keys)
+	}
+	return expected, nil
+}
+
+// unit is a unit block of a terragrunt.stack.hcl
+type unit struct {
+	source string
+	path   string
+}
+
+// stackUnits returns the units of a terragrunt.stack.hcl
+func stackUnits(path string) ([]unit, error) {
+	body, content, err := parseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var units []unit
+	for _, block := range body.Blocks {
+		if block.Type != "unit" {
+			continue
+		}
+		var u unit
+		if attr, ok := block.Body.Attributes["source"]; ok {
+			u.source = expressionText(attr.Expr, content)
+		}
+		if attr, ok := block.Body.Attributes["path"]; ok {
+			u.path = expressionText(attr.Expr, content)
+		}
+		units = append(units, u)
+	}
+	return units, nil
+}
+
+// keyPrefix returns the key_prefix of the state.hcl in dir, or "" without one
+func keyPrefix(dir string) string {
+	body, content, err := parseFile(filepath.Join(dir, "state.hcl"))
+	if err != nil {
+		return ""
+	}
+	for _, block := range body.Blocks {
+		if block.Type != "locals" {
+			continue
+		}
+		if attr, ok := block.Body.Attributes["key_prefix"]; ok {
+			return expressionText(attr.Expr, content)
+		}
+	}
+	return ""
+}
+
+// parseFile parses an HCL file
+func parseFile(path string) (*hclsyntax.Body, []byte, error) {
+	content, err := project.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, diags := hclparse.NewParser().ParseHCL(content, path)
+	if diags.HasErrors() {
+		return nil, nil, fmt.Errorf("failed to parse %s: %s", path, diags.Error())
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, nil, fmt.Errorf("failed to parse %s", path)
+	}
+	return body, content, nil
+}
+
+// expressionText returns the source of an expression without quotes
+func expressionText(expr hclsyntax.Expression, content []byte) string {
+	text := strings.TrimSpace(string(expr.Range().SliceBytes(content)))
+	return strings.TrimSuffix(strings.TrimPrefix(text, `"`), `"`)
+}
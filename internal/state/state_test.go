@@ -0,0 +1,90 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/azure"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExpectedKeys(t *testing.T) {
+	infraPath := t.TempDir()
+	env := filepath.Join(infraPath, "architecture", "main", "nonprod", "eastus2", "dev")
+	writeFile(t, filepath.Join(env, "redis", "terragrunt.hcl"), "")
+	writeFile(t, filepath.Join(env, "appservice", "api", "terragrunt.hcl"), "")
+	writeFile(t, filepath.Join(env, "appservice", "api", "state.hcl"), "locals {\n  key_prefix = \"legacy\"\n}\n")
+	writeFile(t, filepath.Join(env, "redis", ".terragrunt-cache", "x", "terragrunt.hcl"), "")
+
+	stackEnv := filepath.Join(infraPath, "architecture", "main", "prod", "eastus2", "prod")
+	writeFile(t, filepath.Join(stackEnv, "terragrunt.stack.hcl"), `unit "redis" {
+  source = "../../../../../_units/main/redis"
+  path   = "redis"
+}
+`)
+	writeFile(t, filepath.Join(infraPath, "_units", "main", "redis", "state.hcl"), "locals {\n  key_prefix = \"units\"\n}\n")
+
+	tgsConfig := &config.TGSConfig{Subscriptions: map[string]config.Subscription{
+		"nonprod": {RemoteState: config.RemoteState{Name: "stnonprod"}},
+		"prod":    {RemoteState: config.RemoteState{Name: "stprod", KeyPrefix: "project"}},
+	}}
+
+	got, err := ExpectedKeys(tgsConfig, infraPath)
+	if err != nil {
+		t.Fatalf("ExpectedKeys() error = %v", err)
+	}
+	want := map[string][]string{
+		"nonprod": {
+			"architecture/main/nonprod/eastus2/dev/redis/terraform.tfstate",
+			"legacy/architecture/main/nonprod/eastus2/dev/appservice/api/terraform.tfstate",
+		},
+		"prod": {"units/architecture/main/prod/eastus2/prod/redis/terraform.tfstate"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExpectedKeys() = %v, want %v", got, want)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	expected := []string{"a/terraform.tfstate", "b/terraform.tfstate"}
+	blobs := []azure.Blob{{Name: "a/terraform.tfstate"}, {Name: "old/terraform.tfstate"}, {Name: "notes.txt"}}
+
+	var got []string
+	for _, entry := range Compare(expected, blobs) {
+		got = append(got, entry.Status+" "+entry.Key)
+	}
+	want := []string{"tracked a/terraform.tfstate", "missing b/terraform.tfstate", "orphaned old/terraform.tfstate"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Compare() = %v, want %v", got, want)
+	}
+}
+
+func TestBackupSubscriptions(t *testing.T) {
+	tgsConfig := &config.TGSConfig{Subscriptions: map[string]config.Subscription{
+		"prod":    {RemoteState: config.RemoteState{Name: "stprod", Backup: &config.StateBackup{Container: "backup"}}},
+		"nonprod": {RemoteState: config.RemoteState{Name: "stnonprod"}},
+	}}
+
+	if got, err := BackupSubscriptions(tgsConfig, nil); err != nil || !reflect.DeepEqual(got, []string{"prod"}) {
+		t.Errorf("BackupSubscriptions() = %v, %v, want [prod]", got, err)
+	}
+	if _, err := BackupSubscriptions(tgsConfig, []string{"nonprod"}); err == nil {
+		t.Error("BackupSubscriptions() of a subscription without backup returned no error")
+	}
+	if got := BackupPrefix(time.Date(2026, 10, 14, 9, 15, 0, 0, time.UTC)); got != "20261014T091500Z/" {
+		t.Errorf("BackupPrefix() = %q", got)
+	}
+}
@@ -2,12 +2,16 @@
 package template
 
 import (
+	"embed"
 	"fmt"
-	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	texttemplate "text/template"
 
-	"gopkg.in/yaml.v3"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
 )
 
 // TGSYamlTemplate is the default template for tgs.yaml
@@ -22,7 +26,7 @@ naming:
   # ${env} - Environment prefix
   # ${type} - Resource type prefix
   # ${app} - Application name (if applicable)
-  format: "{project}-{region}{env}-{type}"
+  format: "${project}-${region}${env}-${type}"
   separator: "-"  # Default separator between name parts
   
   # Resource type prefixes
@@ -41,9 +45,9 @@ naming:
   # Optional: Custom formats for specific components
   component_formats:
     keyvault:
-      format: "{project}-{type}-{env}"  # Custom format for Key Vault
+      format: "${project}-${type}-${env}"  # Custom format for Key Vault
     storage:
-      format: "{project}{type}{env}"    # Custom format for Storage Account
+      format: "${project}${type}${env}"    # Custom format for Storage Account
       separator: ""                        # No separator for Storage Account names
 
 subscriptions:
@@ -127,18 +131,18 @@ func getStacksDir() string {
 // CreateFileIfNotExists creates a file with the given content if it doesn't exist
 func CreateFileIfNotExists(path string, content string) error {
 	// Check if file already exists
-	if _, err := os.Stat(path); err == nil {
+	if _, err := project.Stat(path); err == nil {
 		return fmt.Errorf("file %s already exists", path)
 	}
 
 	// Create directory if it doesn't exist
 	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	if err := project.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("failed to create directory %s: %w", dir, err)
 	}
 
 	// Create the file
-	return os.WriteFile(path, []byte(content), 0644)
+	return project.WriteFile(path, []byte(content), 0644)
 }
 
 // InitProject initializes a new project with tgs.yaml
@@ -147,7 +151,7 @@ func InitProject() error {
 
 	// Create .tgs directory
 	configDir := getConfigDir()
-	if err := os.MkdirAll(configDir, 0755); err != nil {
+	if err := project.MkdirAll(configDir, 0755); err != nil {
 		return fmt.Errorf("failed to create config directory %s: %w", configDir, err)
 	}
 
@@ -159,13 +163,13 @@ func InitProject() error {
 
 	// Create .tgs/stacks directory
 	stacksDir := getStacksDir()
-	if err := os.MkdirAll(stacksDir, 0755); err != nil {
+	if err := project.MkdirAll(stacksDir, 0755); err != nil {
 		return fmt.Errorf("failed to create stacks directory %s: %w", stacksDir, err)
 	}
 
 	// Create default main.yaml in .tgs/stacks directory
 	mainStackPath := filepath.Join(stacksDir, "main.yaml")
-	if err := CreateStack("main"); err != nil {
+	if err := CreateStack("main", DefaultStackTemplate); err != nil {
 		return fmt.Errorf("failed to create main.yaml: %w", err)
 	}
 
@@ -175,257 +179,119 @@ func InitProject() error {
 	return nil
 }
 
-// CreateStack creates a new stack configuration file
-func CreateStack(name string) error {
-	// Create stacks directory if it doesn't exist
-	stacksDir := ".tgs/stacks"
-	if err := os.MkdirAll(stacksDir, 0755); err != nil {
-		return fmt.Errorf("failed to create stacks directory: %w", err)
-	}
+//go:embed stacks/*.yaml
+var stackTemplatesFS embed.FS
 
-	// Create the YAML structure with ordered nodes
-	root := &yaml.Node{
-		Kind: yaml.DocumentNode,
-		Content: []*yaml.Node{
-			{
-				Kind: yaml.MappingNode,
-				Content: []*yaml.Node{
-					{Kind: yaml.ScalarNode, Value: "stack"},
-					{
-						Kind: yaml.MappingNode,
-						Content: []*yaml.Node{
-							// Stack metadata first
-							{Kind: yaml.ScalarNode, Value: "name"},
-							{Kind: yaml.ScalarNode, Value: name},
-							{Kind: yaml.ScalarNode, Value: "version"},
-							{Kind: yaml.ScalarNode, Value: "1.0.0"},
-							{Kind: yaml.ScalarNode, Value: "description"},
-							{Kind: yaml.ScalarNode, Value: "Default infrastructure stack with web applications and supporting services"},
-							// Components section second
-							{Kind: yaml.ScalarNode, Value: "components"},
-							{
-								Kind: yaml.MappingNode,
-								Content: []*yaml.Node{
-									{Kind: yaml.ScalarNode, Value: "serviceplan"},
-									{
-										Kind: yaml.MappingNode,
-										Content: []*yaml.Node{
-											{Kind: yaml.ScalarNode, Value: "source"},
-											{Kind: yaml.ScalarNode, Value: "azurerm_service_plan"},
-											{Kind: yaml.ScalarNode, Value: "provider"},
-											{Kind: yaml.ScalarNode, Value: "azurerm"},
-											{Kind: yaml.ScalarNode, Value: "version"},
-											{Kind: yaml.ScalarNode, Value: "3.0.0"},
-											{Kind: yaml.ScalarNode, Value: "description"},
-											{Kind: yaml.ScalarNode, Value: "Shared service plan for web applications"},
-										},
-									},
-									{Kind: yaml.ScalarNode, Value: "appservice"},
-									{
-										Kind: yaml.MappingNode,
-										Content: []*yaml.Node{
-											{Kind: yaml.ScalarNode, Value: "source"},
-											{Kind: yaml.ScalarNode, Value: "azurerm_linux_web_app"},
-											{Kind: yaml.ScalarNode, Value: "provider"},
-											{Kind: yaml.ScalarNode, Value: "azurerm"},
-											{Kind: yaml.ScalarNode, Value: "version"},
-											{Kind: yaml.ScalarNode, Value: "3.0.0"},
-											{Kind: yaml.ScalarNode, Value: "description"},
-											{Kind: yaml.ScalarNode, Value: "Web application service"},
-											{Kind: yaml.ScalarNode, Value: "deps"},
-											{
-												Kind: yaml.SequenceNode,
-												Content: []*yaml.Node{
-													{Kind: yaml.ScalarNode, Value: "{region}.serviceplan"},
-												},
-											},
-										},
-									},
-									{Kind: yaml.ScalarNode, Value: "rediscache"},
-									{
-										Kind: yaml.MappingNode,
-										Content: []*yaml.Node{
-											{Kind: yaml.ScalarNode, Value: "source"},
-											{Kind: yaml.ScalarNode, Value: "azurerm_redis_cache"},
-											{Kind: yaml.ScalarNode, Value: "provider"},
-											{Kind: yaml.ScalarNode, Value: "azurerm"},
-											{Kind: yaml.ScalarNode, Value: "version"},
-											{Kind: yaml.ScalarNode, Value: "3.0.0"},
-											{Kind: yaml.ScalarNode, Value: "description"},
-											{Kind: yaml.ScalarNode, Value: "Redis cache for application caching"},
-										},
-									},
-									{Kind: yaml.ScalarNode, Value: "appservice_api"},
-									{
-										Kind: yaml.MappingNode,
-										Content: []*yaml.Node{
-											{Kind: yaml.ScalarNode, Value: "source"},
-											{Kind: yaml.ScalarNode, Value: "azurerm_linux_web_app"},
-											{Kind: yaml.ScalarNode, Value: "provider"},
-											{Kind: yaml.ScalarNode, Value: "azurerm"},
-											{Kind: yaml.ScalarNode, Value: "version"},
-											{Kind: yaml.ScalarNode, Value: "3.0.0"},
-											{Kind: yaml.ScalarNode, Value: "description"},
-											{Kind: yaml.ScalarNode, Value: "Backend API service"},
-											{Kind: yaml.ScalarNode, Value: "deps"},
-											{
-												Kind: yaml.SequenceNode,
-												Content: []*yaml.Node{
-													{Kind: yaml.ScalarNode, Value: "{region}.serviceplan"},
-													{Kind: yaml.ScalarNode, Value: "{region}.rediscache"},
-													{Kind: yaml.ScalarNode, Value: "westus2.appservice.web"},
-												},
-											},
-										},
-									},
-								},
-							},
-							// Architecture section third
-							{Kind: yaml.ScalarNode, Value: "architecture"},
-							{
-								Kind: yaml.MappingNode,
-								Content: []*yaml.Node{
-									{Kind: yaml.ScalarNode, Value: "regions"},
-									{
-										Kind: yaml.MappingNode,
-										Content: []*yaml.Node{
-											{Kind: yaml.ScalarNode, Value: "eastus2"},
-											{
-												Kind: yaml.SequenceNode,
-												Content: []*yaml.Node{
-													{
-														Kind: yaml.MappingNode,
-														Content: []*yaml.Node{
-															{Kind: yaml.ScalarNode, Value: "component"},
-															{Kind: yaml.ScalarNode, Value: "serviceplan"},
-															{Kind: yaml.ScalarNode, Value: "apps"},
-															{Kind: yaml.SequenceNode},
-														},
-													},
-													{
-														Kind: yaml.MappingNode,
-														Content: []*yaml.Node{
-															{Kind: yaml.ScalarNode, Value: "component"},
-															{Kind: yaml.ScalarNode, Value: "rediscache"},
-															{Kind: yaml.ScalarNode, Value: "apps"},
-															{Kind: yaml.SequenceNode},
-														},
-													},
-													{
-														Kind: yaml.MappingNode,
-														Content: []*yaml.Node{
-															{Kind: yaml.ScalarNode, Value: "component"},
-															{Kind: yaml.ScalarNode, Value: "appservice_api"},
-															{Kind: yaml.ScalarNode, Value: "apps"},
-															{
-																Kind: yaml.SequenceNode,
-																Content: []*yaml.Node{
-																	{Kind: yaml.ScalarNode, Value: "api"},
-																},
-															},
-														},
-													},
-												},
-											},
-											{Kind: yaml.ScalarNode, Value: "westus2"},
-											{
-												Kind: yaml.SequenceNode,
-												Content: []*yaml.Node{
-													{
-														Kind: yaml.MappingNode,
-														Content: []*yaml.Node{
-															{Kind: yaml.ScalarNode, Value: "component"},
-															{Kind: yaml.ScalarNode, Value: "serviceplan"},
-															{Kind: yaml.ScalarNode, Value: "apps"},
-															{Kind: yaml.SequenceNode},
-														},
-													},
-													{
-														Kind: yaml.MappingNode,
-														Content: []*yaml.Node{
-															{Kind: yaml.ScalarNode, Value: "component"},
-															{Kind: yaml.ScalarNode, Value: "appservice"},
-															{Kind: yaml.ScalarNode, Value: "apps"},
-															{
-																Kind: yaml.SequenceNode,
-																Content: []*yaml.Node{
-																	{Kind: yaml.ScalarNode, Value: "web"},
-																},
-															},
-														},
-													},
-												},
-											},
-										},
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-		},
-	}
+// DefaultStackTemplate is the stack template used when none is chosen
+const DefaultStackTemplate = "default"
 
-	// Add a comment header
-	header := `# Stack Configuration
-# This example demonstrates a multi-region architecture with dependencies:
-#
-# East US 2 Region:
-# - Service Plan for hosting applications
-# - Redis Cache for caching
-# - Key Vault for secrets
-# - API App Service with dependencies on:
-#   - Local Service Plan
-#   - Local Redis Cache
-#   - Local Key Vault
-#   - Web App in West US 2 (cross-region dependency)
-#
-# West US 2 Region:
-# - Service Plan for hosting applications
-# - Web App Service (frontend)
-#
-# This setup shows both:
-# 1. Dependencies within the same region (API -> Service Plan, Redis, Key Vault)
-# 2. Cross-region dependencies (API -> Web App)
+// StackTemplates returns the names of the built-in stack templates
+func StackTemplates() []string {
+	entries, _ := stackTemplatesFS.ReadDir("stacks")
+	var names []string
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".yaml"))
+	}
+	sort.Strings(names)
+	return names
+}
 
-`
+// CreateStack creates a new stack configuration file from a stack template
+func CreateStack(name, templateName string) error {
+	if templateName == "" {
+		templateName = DefaultStackTemplate
+	}
+	data, err := stackTemplatesFS.ReadFile(path.Join("stacks", templateName+".yaml"))
+	if err != nil {
+		return fmt.Errorf("unknown stack template %s, available templates: %s", templateName, strings.Join(StackTemplates(), ", "))
+	}
 
-	// Write the configuration to file
-	filename := filepath.Join(stacksDir, fmt.Sprintf("%s.yaml", name))
-	f, err := os.Create(filename)
+	tmpl, err := texttemplate.New(templateName).Parse(string(data))
 	if err != nil {
-		return fmt.Errorf("failed to create stack file: %w", err)
+		return fmt.Errorf("failed to parse stack template %s: %w", templateName, err)
+	}
+	var content strings.Builder
+	if err := tmpl.Execute(&content, struct{ Name string }{Name: name}); err != nil {
+		return fmt.Errorf("failed to render stack template %s: %w", templateName, err)
 	}
-	defer f.Close()
 
-	if _, err := f.WriteString(header); err != nil {
-		return fmt.Errorf("failed to write header: %w", err)
+	// Create stacks directory if it doesn't exist
+	stacksDir := getStacksDir()
+	if err := project.MkdirAll(stacksDir, 0755); err != nil {
+		return fmt.Errorf("failed to create stacks directory: %w", err)
 	}
 
-	encoder := yaml.NewEncoder(f)
-	encoder.SetIndent(2)
-	if err := encoder.Encode(root); err != nil {
-		return fmt.Errorf("failed to write stack config: %w", err)
+	filename := filepath.Join(stacksDir, fmt.Sprintf("%s.yaml", name))
+	if err := CreateFileIfNotExists(filename, content.String()); err != nil {
+		return fmt.Errorf("failed to create stack file: %w", err)
 	}
 
 	fmt.Printf("Created stack configuration: %s\n", filename)
 	return nil
 }
 
-// ListStacks lists all available stacks in the .tgs/stacks directory
-func ListStacks() error {
-	files, err := os.ReadDir(".tgs/stacks")
+// StackSummary describes a stack file of .tgs/stacks as listed by tgs list
+type StackSummary struct {
+	Name         string             `json:"name"`
+	Version      string             `json:"version"`
+	Description  string             `json:"description"`
+	Components   int                `json:"components"`
+	Environments []StackEnvironment `json:"environments"`
+	Error        string             `json:"error,omitempty"`
+}
+
+// StackEnvironment is an environment of tgs.yaml deploying a stack
+type StackEnvironment struct {
+	Subscription string `json:"subscription"`
+	Name         string `json:"name"`
+}
+
+// ListStacks summarizes the stacks in the .tgs/stacks directory, sorted by
+// name, with the environments of tgsConfig using them. tgsConfig may be nil
+// when the project has no tgs.yaml. A stack file that can't be read is listed
+// with its error.
+func ListStacks(tgsConfig *config.TGSConfig) ([]StackSummary, error) {
+	files, err := project.ReadDir(".tgs/stacks")
 	if err != nil {
-		return fmt.Errorf("failed to read stacks directory: %w", err)
+		return nil, fmt.Errorf("failed to read stacks directory: %w", err)
 	}
 
-	fmt.Println("\nAvailable stacks:")
-	for _, file := range files {
-		if !file.IsDir() && filepath.Ext(file.Name()) == ".yaml" {
-			fmt.Printf("- %s\n", strings.TrimSuffix(file.Name(), ".yaml"))
+	environments := make(map[string][]StackEnvironment)
+	if tgsConfig != nil {
+		var subs []string
+		for name := range tgsConfig.Subscriptions {
+			subs = append(subs, name)
+		}
+		sort.Strings(subs)
+		for _, sub := range subs {
+			for _, env := range tgsConfig.Subscriptions[sub].Environments {
+				stack := env.Stack
+				if stack == "" {
+					stack = "main"
+				}
+				environments[stack] = append(environments[stack], StackEnvironment{Subscription: sub, Name: env.Name})
+			}
 		}
 	}
 
-	return nil
+	stacks := []StackSummary{}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".yaml" {
+			continue
+		}
+		name := strings.TrimSuffix(file.Name(), ".yaml")
+		summary := StackSummary{Name: name, Environments: environments[name]}
+		if summary.Environments == nil {
+			summary.Environments = []StackEnvironment{}
+		}
+		if mainConfig, err := config.ReadMainConfig(name); err != nil {
+			summary.Error = err.Error()
+		} else {
+			summary.Version = mainConfig.Stack.Version
+			summary.Description = mainConfig.Stack.Description
+			summary.Components = len(mainConfig.Stack.Components)
+		}
+		stacks = append(stacks, summary)
+	}
+	return stacks, nil
 }
@@ -0,0 +1,143 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/schema"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/validate"
+	"gopkg.in/yaml.v3"
+)
+
+func TestStackTemplatesAreValid(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for _, name := range StackTemplates() {
+		if err := CreateStack(name, name); err != nil {
+			t.Fatalf("CreateStack(%s) unexpected error: %v", name, err)
+		}
+
+		data, err := os.ReadFile(filepath.Join(".tgs", "stacks", name+".yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var mainConfig config.MainConfig
+		if err := yaml.Unmarshal(data, &mainConfig); err != nil {
+			t.Fatalf("stack template %s: %v", name, err)
+		}
+		if mainConfig.Stack.Name != name {
+			t.Errorf("stack template %s: name = %q", name, mainConfig.Stack.Name)
+		}
+		for _, finding := range validate.Errors(validate.ValidateStack(&mainConfig)) {
+			t.Errorf("stack template %s: %v", name, finding)
+		}
+		problems, err := schema.Check(data, schema.Stack())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, problem := range problems {
+			t.Errorf("stack template %s: %s (line %d): %s", name, problem.Path, problem.Line, problem.Message)
+		}
+	}
+
+	if err := CreateStack("other", "missing"); err == nil {
+		t.Error("CreateStack() with an unknown template should fail")
+	}
+}
+
+func TestListStacks(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	if err := os.MkdirAll(filepath.Join(".tgs", "stacks"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"main.yaml": `stack:
+  name: main
+  version: "1.0.0"
+  description: Main stack
+  components:
+    redis:
+      source: azurerm_redis_cache
+      provider: azurerm
+      version: 4.22.0
+  architecture:
+    regions:
+      eastus2:
+        - component: redis
+`,
+		"bad.yaml":  "stack: [\n",
+		"notes.txt": "not a stack",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(".tgs", "stacks", name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tgsConfig := &config.TGSConfig{Subscriptions: map[string]config.Subscription{
+		"prod":    {Environments: []config.Environment{{Name: "prod"}}},
+		"nonprod": {Environments: []config.Environment{{Name: "dev"}, {Name: "sandbox", Stack: "sandbox"}}},
+	}}
+	stacks, err := ListStacks(tgsConfig)
+	if err != nil {
+		t.Fatalf("ListStacks() unexpected error: %v", err)
+	}
+	if len(stacks) != 2 || stacks[0].Name != "bad" || stacks[0].Error == "" {
+		t.Fatalf("ListStacks() = %+v", stacks)
+	}
+	main := stacks[1]
+	if main.Version != "1.0.0" || main.Description != "Main stack" || main.Components != 1 {
+		t.Errorf("ListStacks() main = %+v", main)
+	}
+	want := []StackEnvironment{{Subscription: "nonprod", Name: "dev"}, {Subscription: "prod", Name: "prod"}}
+	if !reflect.DeepEqual(main.Environments, want) {
+		t.Errorf("ListStacks() main environments = %+v, want %+v", main.Environments, want)
+	}
+}
+
+func TestInitProjectValidates(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	if err := InitProject(); err != nil {
+		t.Fatalf("InitProject() unexpected error: %v", err)
+	}
+	tgsConfig, err := config.ReadTGSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := validate.Project(tgsConfig, validate.Options{Stacks: true, Full: true, Providers: true, Offline: true})
+	for _, r := range report.Reports() {
+		for _, finding := range validate.Errors(r.Findings) {
+			t.Errorf("%s: %v", r.File, finding)
+		}
+	}
+}
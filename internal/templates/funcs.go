@@ -0,0 +1,229 @@
+package templates
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// helperFuncs holds tgs specific functions registered by other packages,
+// e.g. the naming helpers owned by scaffold
+var helperFuncs = template.FuncMap{}
+
+// RegisterFuncs makes additional functions available to every template
+func RegisterFuncs(funcs template.FuncMap) {
+	for name, fn := range funcs {
+		helperFuncs[name] = fn
+	}
+}
+
+// funcMap returns the functions available to templates: a curated subset of
+// sprig (same names and argument order) plus the registered tgs helpers
+func funcMap() template.FuncMap {
+	funcs := template.FuncMap{
+		// Strings
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+		"title":      title,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"repeat":     func(count int, s string) string { return strings.Repeat(s, count) },
+		"trunc":      trunc,
+		"quote":      func(s interface{}) string { return fmt.Sprintf("%q", fmt.Sprint(s)) },
+		"squote":     func(s interface{}) string { return fmt.Sprintf("'%v'", s) },
+		"indent":     indent,
+		"nindent":    func(spaces int, s string) string { return "\n" + indent(spaces, s) },
+		"snakecase":  func(s string) string { return delimit(s, '_') },
+		"kebabcase":  func(s string) string { return delimit(s, '-') },
+		"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+		"join":       join,
+
+		// Lists and maps
+		"list":  func(items ...interface{}) []interface{} { return items },
+		"dict":  dict,
+		"keys":  keys,
+		"first": first,
+		"last":  last,
+
+		// Defaults and logic
+		"default":  func(def, value interface{}) interface{} { return ternary(value, def, !empty(value)) },
+		"empty":    empty,
+		"coalesce": coalesce,
+		"ternary": func(whenTrue, whenFalse interface{}, condition bool) interface{} {
+			return ternary(whenTrue, whenFalse, condition)
+		},
+
+		// Math
+		"add": func(a, b int) int { return a + b },
+		"sub": func(a, b int) int { return a - b },
+
+		// Encoding
+		"toJson":    toJSON,
+		"b64enc":    func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"sha256sum": func(s string) string { sum := sha256.Sum256([]byte(s)); return hex.EncodeToString(sum[:]) },
+	}
+
+	for name, fn := range helperFuncs {
+		funcs[name] = fn
+	}
+
+	return funcs
+}
+
+func title(s string) string {
+	words := strings.Fields(s)
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
+
+// trunc keeps the first length characters of s, or the last ones when
+// length is negative, without splitting multibyte characters
+func trunc(length int, s string) string {
+	runes := []rune(s)
+	if length >= 0 && len(runes) > length {
+		return string(runes[:length])
+	}
+	if length < 0 && len(runes) > -length {
+		return string(runes[len(runes)+length:])
+	}
+	return s
+}
+
+func indent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// delimit converts camelCase, spaces and dashes/underscores to lower case
+// words joined by sep
+func delimit(s string, sep rune) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i, r := range runes {
+		switch {
+		case r == ' ' || r == '-' || r == '_':
+			b.WriteRune(sep)
+		case unicode.IsUpper(r):
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])) {
+				b.WriteRune(sep)
+			}
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func join(sep string, items interface{}) string {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fmt.Sprint(items)
+	}
+
+	parts := make([]string, v.Len())
+	for i := range parts {
+		parts[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(parts, sep)
+}
+
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("dict requires an even number of arguments")
+	}
+
+	m := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		m[fmt.Sprint(pairs[i])] = pairs[i+1]
+	}
+	return m, nil
+}
+
+// keys returns the sorted keys of a map
+func keys(m interface{}) []string {
+	v := reflect.ValueOf(m)
+	if v.Kind() != reflect.Map {
+		return nil
+	}
+
+	result := make([]string, 0, v.Len())
+	for _, key := range v.MapKeys() {
+		result = append(result, fmt.Sprint(key.Interface()))
+	}
+	sort.Strings(result)
+	return result
+}
+
+func first(items interface{}) interface{} {
+	v := reflect.ValueOf(items)
+	if (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) || v.Len() == 0 {
+		return nil
+	}
+	return v.Index(0).Interface()
+}
+
+func last(items interface{}) interface{} {
+	v := reflect.ValueOf(items)
+	if (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) || v.Len() == 0 {
+		return nil
+	}
+	return v.Index(v.Len() - 1).Interface()
+}
+
+// empty reports whether a value is nil or the zero value of its type
+func empty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	default:
+		return v.IsZero()
+	}
+}
+
+func coalesce(values ...interface{}) interface{} {
+	for _, value := range values {
+		if !empty(value) {
+			return value
+		}
+	}
+	return nil
+}
+
+func ternary(whenTrue, whenFalse interface{}, condition bool) interface{} {
+	if condition {
+		return whenTrue
+	}
+	return whenFalse
+}
+
+func toJSON(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal value: %w", err)
+	}
+	return string(data), nil
+}
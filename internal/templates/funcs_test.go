@@ -0,0 +1,138 @@
+package templates
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+)
+
+// render executes a template using the template functions
+func render(text string, data interface{}) (string, error) {
+	tmpl, err := template.New("test").Funcs(funcMap()).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func TestFuncs(t *testing.T) {
+	data := map[string]interface{}{
+		"names":  []string{"redis", "cosmos", "sql"},
+		"empty":  []string{},
+		"tags":   map[string]string{"team": "platform", "env": "dev", "cost": "shared"},
+		"nested": map[string]interface{}{"sku": "Standard", "capacity": 2},
+		"zero":   0,
+		"nil":    nil,
+	}
+
+	testCases := map[string][]struct {
+		tmpl string
+		want string
+	}{
+		"lower":      {{`{{ lower "RedisCache" }}`, "rediscache"}},
+		"upper":      {{`{{ upper "eus2" }}`, "EUS2"}},
+		"title":      {{`{{ title "redis cache  tier" }}`, "Redis Cache Tier"}, {`{{ title "élan vital" }}`, "Élan Vital"}, {`{{ title "" }}`, ""}},
+		"trim":       {{`{{ trim "  redis \n" }}`, "redis"}},
+		"trimPrefix": {{`{{ trimPrefix "azurerm_" "azurerm_redis_cache" }}`, "redis_cache"}, {`{{ trimPrefix "x" "redis" }}`, "redis"}},
+		"trimSuffix": {{`{{ trimSuffix ".tmpl" "main.tf.tmpl" }}`, "main.tf"}},
+		"replace":    {{`{{ replace "_" "-" "redis_cache_tier" }}`, "redis-cache-tier"}},
+		"contains":   {{`{{ contains "cache" "redis_cache" }}`, "true"}, {`{{ contains "sql" "redis_cache" }}`, "false"}},
+		"hasPrefix":  {{`{{ hasPrefix "azurerm_" "azurerm_redis_cache" }}`, "true"}, {`{{ hasPrefix "azapi_" "azurerm_redis_cache" }}`, "false"}},
+		"hasSuffix":  {{`{{ hasSuffix "_cache" "azurerm_redis_cache" }}`, "true"}, {`{{ hasSuffix "_app" "azurerm_redis_cache" }}`, "false"}},
+		"repeat":     {{`{{ repeat 3 "ab" }}`, "ababab"}, {`{{ repeat 0 "ab" }}`, ""}},
+		"trunc": {
+			{`{{ trunc 5 "redis_cache" }}`, "redis"},
+			{`{{ trunc -5 "redis_cache" }}`, "cache"},
+			{`{{ trunc 20 "redis" }}`, "redis"},
+			{`{{ trunc -20 "redis" }}`, "redis"},
+			{`{{ trunc 0 "redis" }}`, ""},
+			{`{{ trunc 3 "café-crème" }}`, "caf"},
+			{`{{ trunc 4 "café-crème" }}`, "café"},
+			{`{{ trunc -5 "café-crème" }}`, "crème"},
+			{`{{ trunc 2 "日本語" }}`, "日本"},
+		},
+		"quote":     {{`{{ quote "a \"b\"" }}`, `"a \"b\""`}, {`{{ quote 2 }}`, `"2"`}},
+		"squote":    {{`{{ squote "redis" }}`, "'redis'"}, {`{{ squote 2 }}`, "'2'"}},
+		"indent":    {{`{{ indent 2 "a\nb" }}`, "  a\n  b"}, {`{{ indent 0 "a" }}`, "a"}},
+		"nindent":   {{`{{ nindent 4 "a\nb" }}`, "\n    a\n    b"}},
+		"snakecase": {{`{{ snakecase "redisCache tier-name" }}`, "redis_cache_tier_name"}, {`{{ snakecase "sku2Name" }}`, "sku2_name"}, {`{{ snakecase "SKU" }}`, "sku"}},
+		"kebabcase": {{`{{ kebabcase "redisCache tier_name" }}`, "redis-cache-tier-name"}},
+		"split":     {{`{{ index (split "." "eastus2.redis.api") 1 }}`, "redis"}, {`{{ len (split "," "") }}`, "1"}},
+		"join":      {{`{{ join ", " .names }}`, "redis, cosmos, sql"}, {`{{ join "," (list 1 2) }}`, "1,2"}, {`{{ join "," "redis" }}`, "redis"}},
+		"list":      {{`{{ len (list "a" "b" 3) }}`, "3"}, {`{{ index (list "a" "b") 1 }}`, "b"}},
+		"dict":      {{`{{ $d := dict "sku" "Premium" "capacity" 2 }}{{ $d.sku }}/{{ $d.capacity }}`, "Premium/2"}, {`{{ len (dict) }}`, "0"}},
+		"keys":      {{`{{ join "," (keys .tags) }}`, "cost,env,team"}, {`{{ len (keys "redis") }}`, "0"}},
+		"first":     {{`{{ first .names }}`, "redis"}, {`{{ first .empty }}`, "<no value>"}},
+		"last":      {{`{{ last .names }}`, "sql"}, {`{{ last .empty }}`, "<no value>"}},
+		"default":   {{`{{ default "Standard" "" }}`, "Standard"}, {`{{ default "Standard" "Premium" }}`, "Premium"}, {`{{ default 1 .zero }}`, "1"}, {`{{ default "none" .empty }}`, "none"}},
+		"empty": {
+			{`{{ empty "" }}`, "true"},
+			{`{{ empty "x" }}`, "false"},
+			{`{{ empty .empty }}`, "true"},
+			{`{{ empty .names }}`, "false"},
+			{`{{ empty .zero }}`, "true"},
+			{`{{ empty .nil }}`, "true"},
+			{`{{ empty .nested }}`, "false"},
+			{`{{ empty false }}`, "true"},
+		},
+		"coalesce": {{`{{ coalesce "" .zero "redis" "sql" }}`, "redis"}, {`{{ coalesce "" .empty }}`, "<no value>"}},
+		"ternary":  {{`{{ ternary "yes" "no" true }}`, "yes"}, {`{{ ternary "yes" "no" false }}`, "no"}},
+		"add":      {{`{{ add 2 3 }}`, "5"}, {`{{ add -2 1 }}`, "-1"}},
+		"sub":      {{`{{ sub 5 3 }}`, "2"}, {`{{ sub 3 5 }}`, "-2"}},
+		"toJson":   {{`{{ toJson .nested }}`, `{"capacity":2,"sku":"Standard"}`}, {`{{ toJson .names }}`, `["redis","cosmos","sql"]`}, {`{{ toJson "a\"b" }}`, `"a\"b"`}},
+		"b64enc":   {{`{{ b64enc "redis" }}`, "cmVkaXM="}, {`{{ b64enc "" }}`, ""}},
+		"sha256sum": {
+			{`{{ sha256sum "" }}`, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+			{`{{ sha256sum "redis" }}`, "34fb46c847bb9df96e5205a39d382f648a6e8dce1e014cd85b4ca6a88d88ed03"},
+		},
+	}
+
+	for name := range funcMap() {
+		if _, ok := testCases[name]; !ok && helperFuncs[name] == nil {
+			t.Errorf("template function %s has no test", name)
+		}
+	}
+
+	for name, cases := range testCases {
+		t.Run(name, func(t *testing.T) {
+			for _, tc := range cases {
+				got, err := render(tc.tmpl, data)
+				if err != nil {
+					t.Errorf("%s: unexpected error: %v", tc.tmpl, err)
+					continue
+				}
+				if got != tc.want {
+					t.Errorf("%s = %q, want %q", tc.tmpl, got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFuncErrors(t *testing.T) {
+	for _, tmpl := range []string{
+		`{{ dict "sku" }}`,
+		`{{ toJson .func }}`,
+	} {
+		if _, err := render(tmpl, map[string]interface{}{"func": func() {}}); err == nil {
+			t.Errorf("%s: expected an error", tmpl)
+		}
+	}
+}
+
+func TestRegisterFuncs(t *testing.T) {
+	RegisterFuncs(template.FuncMap{"shout": func(s string) string { return strings.ToUpper(s) + "!" }})
+	t.Cleanup(func() { delete(helperFuncs, "shout") })
+
+	got, err := render(`{{ shout (lower "Redis") }}`, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "REDIS!" {
+		t.Errorf("registered function = %q, want REDIS!", got)
+	}
+}
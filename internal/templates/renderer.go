@@ -2,21 +2,55 @@ package templates
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
 	"fmt"
-	"os"
+	"io/fs"
 	"path/filepath"
 	"text/template"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/mirror"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
 )
 
-//go:embed components/* environment/* *.tmpl
+//go:embed components/* environment/* modules/*/* opa/* *.tmpl
 var templateFS embed.FS
 
+// OverrideDir holds user customized copies of the embedded templates, using
+// the same relative paths (e.g. .tgs/templates/components/component.hcl.tmpl)
+const OverrideDir = ".tgs/templates"
+
 // TemplateRenderer handles loading and rendering of templates
 type TemplateRenderer struct {
 	templates map[string]*template.Template
 }
 
+// templateNames lists the templates loaded by NewRenderer
+var templateNames = []string{
+	"components/component.hcl.tmpl",
+	"components/resource_naming.hcl.tmpl",
+	"components/dependency.hcl.tmpl",
+	"components/external_state.tf.tmpl",
+	"environment/terragrunt.hcl.tmpl",
+	"environment/terragrunt.stack.hcl.tmpl",
+	"environment/environment.hcl.tmpl",
+	"environment/region.hcl.tmpl",
+	"environment/subscription.hcl.tmpl",
+	"environment/root.hcl.tmpl",
+	"environment/global.hcl.tmpl",
+	"appsettings.hcl.tmpl",
+	"policies.hcl.tmpl",
+}
+
+// IsTemplate reports whether name is the path of a built-in template
+func IsTemplate(name string) bool {
+	info, err := fs.Stat(templateFS, name)
+	return err == nil && !info.IsDir()
+}
+
 // NewRenderer creates a new template renderer
 func NewRenderer() (*TemplateRenderer, error) {
 	r := &TemplateRenderer{
@@ -24,27 +58,13 @@ func NewRenderer() (*TemplateRenderer, error) {
 	}
 
 	// Load all templates from the embedded filesystem
-	templates := []string{
-		"components/component.hcl.tmpl",
-		"components/resource_naming.hcl.tmpl",
-		"components/dependency.hcl.tmpl",
-		"environment/terragrunt.hcl.tmpl",
-		"environment/environment.hcl.tmpl",
-		"environment/region.hcl.tmpl",
-		"environment/subscription.hcl.tmpl",
-		"environment/root.hcl.tmpl",
-		"environment/global.hcl.tmpl",
-		"appsettings.hcl.tmpl",
-		"policies.hcl.tmpl",
-	}
-
-	for _, tmpl := range templates {
-		content, err := templateFS.ReadFile(tmpl)
+	for _, tmpl := range templateNames {
+		content, err := readTemplate(tmpl)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read template %s: %w", tmpl, err)
 		}
 
-		t, err := template.New(filepath.Base(tmpl)).Parse(string(content))
+		t, err := template.New(filepath.Base(tmpl)).Funcs(funcMap()).Parse(string(content))
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse template %s: %w", tmpl, err)
 		}
@@ -55,6 +75,41 @@ func NewRenderer() (*TemplateRenderer, error) {
 	return r, nil
 }
 
+// readTemplate reads a template, preferring a local override, then a copy
+// synced from the mirror, over the one embedded in the binary
+func readTemplate(name string) ([]byte, error) {
+	override := filepath.Join(OverrideDir, filepath.FromSlash(name))
+	if info, err := project.Stat(override); err == nil && !info.IsDir() {
+		return project.ReadFile(override)
+	}
+	if path, ok := mirror.Lookup(mirror.KindTemplate, name); ok {
+		return project.ReadFile(path)
+	}
+	return templateFS.ReadFile(name)
+}
+
+// Fingerprint returns a hash of the template set generate renders, taking
+// local overrides and mirrored copies into account
+func Fingerprint() (string, error) {
+	hash := sha256.New()
+	err := fs.WalkDir(templateFS, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := readTemplate(name)
+		if err != nil {
+			return fmt.Errorf("failed to read template %s: %w", name, err)
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00", name, len(content))
+		hash.Write(content)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
 // RenderTemplate renders a template with the given data
 func (r *TemplateRenderer) RenderTemplate(name string, data interface{}) (string, error) {
 	tmpl, ok := r.templates[name]
@@ -79,7 +134,12 @@ type ComponentData struct {
 	ResourceType     string
 	DependencyBlocks string
 	EnvConfigInputs  string
-	NamingFormat     string
+	// NamingFormat and NamingSeparator are the component's naming, escaped
+	// for a quoted HCL string
+	NamingFormat    string
+	NamingSeparator string
+	// ModulePath is the module directory relative to _components
+	ModulePath string
 }
 
 // ResourceNamingData represents the data needed for resource naming templates
@@ -90,8 +150,19 @@ type ResourceNamingData struct {
 
 // DependencyData represents the data needed for dependency templates
 type DependencyData struct {
-	Name       string
-	ConfigPath string
+	Name        string
+	ConfigPath  string
+	SkipOutputs bool
+	MockOutputs map[string]string
+}
+
+// ExternalStateData represents the data needed for external remote state templates
+type ExternalStateData struct {
+	Name           string
+	ResourceGroup  string
+	StorageAccount string
+	Container      string
+	Key            string
 }
 
 // EnvironmentTemplateData represents the data needed for environment templates
@@ -108,10 +179,36 @@ type EnvironmentTemplateData struct {
 	HasAppSettings            bool
 }
 
+// RootData represents the data needed for the root.hcl template
+type RootData struct {
+	StacksLayout bool
+	// Options are the root options of tgs.yaml
+	Options config.RootConfig
+}
+
+// TerragruntStackData represents the data needed for the terragrunt.stack.hcl
+// template of an environment in a region
+type TerragruntStackData struct {
+	EnvironmentName string
+	Region          string
+	Units           []StackUnit
+}
+
+// StackUnit represents a unit of a Terragrunt stack
+type StackUnit struct {
+	Name   string
+	Source string
+	Path   string
+	// Inputs are passed to the unit as values.inputs
+	Inputs map[string]interface{}
+}
+
 // GlobalConfigData represents the data needed for global configuration templates
 type GlobalConfigData struct {
 	ProjectName string
 	Stacks      map[string]StackConfig
+	// Tags are the project tags of tgs.yaml
+	Tags map[string]string
 }
 
 // StackConfig represents the configuration for a stack
@@ -130,36 +227,63 @@ type RegionConfig struct {
 	Prefix string
 }
 
-// Render renders a template file with the given data and writes it to the output file
-func Render(templatePath, outputPath string, data interface{}) error {
-	// Read the template file from the embedded filesystem
-	templateContent, err := templateFS.ReadFile(templatePath)
+// moduleTemplate returns the path of a file of the curated module of a
+// resource type
+func moduleTemplate(resourceType, file string) string {
+	return "modules/" + resourceType + "/" + file + ".tmpl"
+}
+
+// HasModule reports whether a resource type has a curated module, hand-tuned
+// main.tf and variables.tf templates used instead of the generated ones
+func HasModule(resourceType string) bool {
+	return IsTemplate(moduleTemplate(resourceType, "main.tf"))
+}
+
+// RenderModule renders file, main.tf or variables.tf, of the curated module
+// of a resource type
+func RenderModule(resourceType, file string, data ModuleData) (string, error) {
+	name := moduleTemplate(resourceType, file)
+	content, err := readTemplate(name)
 	if err != nil {
-		return fmt.Errorf("failed to read template file %s: %w", templatePath, err)
+		return "", fmt.Errorf("failed to read template %s: %w", name, err)
 	}
 
-	// Parse the template
-	tmpl, err := template.New(templatePath).Parse(string(templateContent))
+	tmpl, err := template.New(name).Funcs(funcMap()).Parse(string(content))
 	if err != nil {
-		return fmt.Errorf("failed to parse template %s: %w", templatePath, err)
+		return "", fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %w", name, err)
 	}
+	return buf.String(), nil
+}
 
-	// Create the output directory if it doesn't exist
-	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+// Render renders a template file with the given data and writes it to the output file
+func Render(templatePath, outputPath string, data interface{}) error {
+	// Read the template file from the mirror cache or embedded filesystem
+	templateContent, err := readTemplate(templatePath)
+	if err != nil {
+		return fmt.Errorf("failed to read template file %s: %w", templatePath, err)
 	}
 
-	// Create the output file
-	outputFile, err := os.Create(outputPath)
+	// Parse the template
+	tmpl, err := template.New(templatePath).Funcs(funcMap()).Parse(string(templateContent))
 	if err != nil {
-		return fmt.Errorf("failed to create output file %s: %w", outputPath, err)
+		return fmt.Errorf("failed to parse template %s: %w", templatePath, err)
 	}
-	defer outputFile.Close()
 
 	// Execute the template
-	if err := tmpl.Execute(outputFile, data); err != nil {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
 		return fmt.Errorf("failed to execute template %s: %w", templatePath, err)
 	}
 
+	// Write the output file unless it's unchanged
+	if _, err := output.WriteFile(outputPath, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write output file %s: %w", outputPath, err)
+	}
+
 	return nil
 }
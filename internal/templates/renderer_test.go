@@ -0,0 +1,97 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+)
+
+// writeOverride writes a template override of the project at dir
+func writeOverride(t *testing.T, dir, name, content string) {
+	t.Helper()
+
+	path := filepath.Join(dir, OverrideDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTemplateOverrides(t *testing.T) {
+	dir := t.TempDir()
+	project.SetRoot(dir)
+	t.Cleanup(func() { project.SetRoot("") })
+
+	// The embedded templates use the helpers registered by generate
+	helpers := template.FuncMap{
+		"outputPath":   func() string { return ".infrastructure" },
+		"regionPrefix": strings.ToUpper,
+		"envPrefix":    strings.ToUpper,
+		"abbreviation": strings.ToLower,
+		"hclString":    func(s string) string { return `"` + s + `"` },
+		"hclKey":       func(s string) string { return s },
+	}
+	RegisterFuncs(helpers)
+	t.Cleanup(func() {
+		for name := range helpers {
+			delete(helperFuncs, name)
+		}
+	})
+
+	embedded, err := Fingerprint()
+	if err != nil {
+		t.Fatalf("Fingerprint() unexpected error: %v", err)
+	}
+
+	writeOverride(t, dir, "environment/region.hcl.tmpl", "# {{ upper .Region }} of {{ .Team }}\n")
+	writeOverride(t, dir, "modules/azurerm_redis_cache/main.tf.tmpl", "# custom redis module\n")
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("NewRenderer() unexpected error: %v", err)
+	}
+
+	// Overrides replace the built-in template and can use the helpers
+	got, err := renderer.RenderTemplate("environment/region.hcl.tmpl", map[string]string{"Region": "eastus2", "Team": "platform"})
+	if err != nil {
+		t.Fatalf("RenderTemplate() unexpected error: %v", err)
+	}
+	if want := "# EASTUS2 of platform\n"; got != want {
+		t.Errorf("RenderTemplate() of the override = %q, want %q", got, want)
+	}
+	if got, err := RenderModule("azurerm_redis_cache", "main.tf", ModuleData{}); err != nil || got != "# custom redis module\n" {
+		t.Errorf("RenderModule() = %q, %v, want the override", got, err)
+	}
+
+	// Templates without an override are the embedded ones
+	for _, name := range []string{"environment/root.hcl.tmpl", "modules/azurerm_redis_cache/variables.tf.tmpl"} {
+		want, err := templateFS.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := readTemplate(name); err != nil || string(got) != string(want) {
+			t.Errorf("readTemplate(%s) = %q, %v, want the embedded template", name, got, err)
+		}
+	}
+
+	// Overrides change the fingerprint so generate re-renders the tree
+	overridden, err := Fingerprint()
+	if err != nil {
+		t.Fatalf("Fingerprint() unexpected error: %v", err)
+	}
+	if overridden == embedded {
+		t.Error("Fingerprint() didn't change with template overrides")
+	}
+
+	// Broken overrides fail with their name
+	writeOverride(t, dir, "components/component.hcl.tmpl", "{{ .Component ")
+	if _, err := NewRenderer(); err == nil || !strings.Contains(err.Error(), "components/component.hcl.tmpl") {
+		t.Errorf("NewRenderer() with a broken override error = %v, want it to name the template", err)
+	}
+}
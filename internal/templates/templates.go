@@ -18,3 +18,20 @@ type EnvironmentConfigData struct {
 	EnvironmentPrefix string
 	StackName         string
 }
+
+// OPAData represents the data needed for the generated OPA policies
+type OPAData struct {
+	RequiredTags []string
+	// NamePrefixes are the allowed name prefixes by
+	// <stack>/<environment>/<region>/<component>
+	NamePrefixes map[string][]string
+	PrimaryTypes []string
+}
+
+// ModuleData represents the data needed for curated module templates
+type ModuleData struct {
+	ResourceType string
+	// KeyVaultSecrets is set when the app settings include Key Vault
+	// references, merged in by local.app_settings
+	KeyVaultSecrets bool
+}
@@ -0,0 +1,215 @@
+package tui
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/azure"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/catalog"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/template"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/validate"
+	"gopkg.in/yaml.v3"
+)
+
+// stackFile orders the sections of a written stack like the stack templates
+type stackFile struct {
+	Stack struct {
+		Name         string                      `yaml:"name"`
+		Version      string                      `yaml:"version"`
+		Description  string                      `yaml:"description"`
+		Components   map[string]config.Component `yaml:"components"`
+		Architecture config.ArchitectureConfig   `yaml:"architecture"`
+	} `yaml:"stack"`
+}
+
+// BuildStack walks through choosing catalog entries, regions, apps and
+// dependencies, then writes the stack file
+func BuildStack(name string) error {
+	if !IsTerminal() {
+		return fmt.Errorf("the interactive stack builder requires a terminal")
+	}
+
+	entries, err := catalog.List()
+	if err != nil {
+		return err
+	}
+
+	description := &Input{Title: fmt.Sprintf("Description of stack %s", name)}
+	if err := Run(description); err != nil {
+		return err
+	}
+
+	// Choose the catalog entries the stack is built from
+	labels := make(map[string]*catalog.Entry)
+	var items []string
+	for _, entry := range entries {
+		label := fmt.Sprintf("%s: %s", entry.Name, entry.Description)
+		labels[label] = entry
+		items = append(items, label)
+	}
+	entrySelect := NewSelect("Components to include", items, true)
+	if err := Run(entrySelect); err != nil {
+		return err
+	}
+
+	components := make(map[string]config.Component)
+	var names []string
+	appComponents := make(map[string]bool)
+	for _, label := range entrySelect.Chosen() {
+		entry := labels[label]
+		for _, compName := range entry.ComponentNames() {
+			if _, ok := components[compName]; !ok {
+				components[compName] = entry.Components[compName]
+				names = append(names, compName)
+			}
+		}
+		for _, app := range entry.Apps {
+			appComponents[app] = true
+		}
+	}
+	if len(components) == 0 {
+		return fmt.Errorf("no components chosen")
+	}
+
+	// Assign regions, limited to the allowlist of tgs.yaml when it has one
+	regions := azure.Regions(azure.CloudPublic).Regions
+	if tgsConfig, err := config.ReadTGSConfig(); err == nil && len(tgsConfig.Regions) > 0 {
+		regions = tgsConfig.Regions
+	}
+	regionSelect := NewSelect("Regions to deploy to", regions, true)
+	if err := Run(regionSelect); err != nil {
+		return err
+	}
+
+	// Name the app instances of app components
+	apps := make(map[string][]string)
+	for _, compName := range names {
+		if !appComponents[compName] {
+			continue
+		}
+		input := &Input{Title: fmt.Sprintf("App instances of %s", compName), Help: "comma separated, empty for a single instance"}
+		if err := Run(input); err != nil {
+			return err
+		}
+		for _, app := range strings.Split(input.Value, ",") {
+			if app = strings.TrimSpace(app); app != "" {
+				apps[compName] = append(apps[compName], app)
+			}
+		}
+	}
+
+	// Declare dependencies, starting from the catalog's
+	for _, compName := range names {
+		comp := components[compName]
+		existing := make(map[string]string)
+		var preselected []string
+		for _, dep := range comp.Deps {
+			if parts := strings.Split(dep, "."); len(parts) >= 2 {
+				existing[parts[1]] = dep
+				preselected = append(preselected, parts[1])
+			}
+		}
+
+		var others []string
+		for _, other := range names {
+			if other != compName {
+				others = append(others, other)
+			}
+		}
+		if len(others) == 0 {
+			continue
+		}
+
+		depSelect := NewSelect(fmt.Sprintf("Dependencies of %s (in the same region)", compName), others, true, preselected...)
+		if err := Run(depSelect); err != nil {
+			return err
+		}
+		comp.Deps = nil
+		for _, dep := range depSelect.Chosen() {
+			if notation, ok := existing[dep]; ok {
+				comp.Deps = append(comp.Deps, notation)
+			} else {
+				comp.Deps = append(comp.Deps, "{region}."+dep)
+			}
+		}
+		components[compName] = comp
+	}
+
+	var file stackFile
+	file.Stack.Name = name
+	file.Stack.Version = "1.0.0"
+	file.Stack.Description = description.Value
+	file.Stack.Components = components
+	file.Stack.Architecture.Regions = make(map[string][]config.RegionComponent)
+	for _, region := range regionSelect.Chosen() {
+		for _, compName := range names {
+			file.Stack.Architecture.Regions[region] = append(file.Stack.Architecture.Regions[region], config.RegionComponent{Component: compName, Apps: apps[compName]})
+		}
+	}
+
+	mainConfig := &config.MainConfig{}
+	mainConfig.Stack.Name = name
+	mainConfig.Stack.Version = file.Stack.Version
+	mainConfig.Stack.Description = file.Stack.Description
+	mainConfig.Stack.Components = file.Stack.Components
+	mainConfig.Stack.Architecture = file.Stack.Architecture
+	if errors := validate.Errors(validate.ValidateStack(mainConfig)); len(errors) > 0 {
+		return fmt.Errorf("stack '%s' validation failed: %v", name, errors[0])
+	}
+
+	var doc yaml.Node
+	if err := doc.Encode(file); err != nil {
+		return fmt.Errorf("failed to encode stack config: %w", err)
+	}
+	quotePlaceholders(&doc)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return fmt.Errorf("failed to encode stack config: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("failed to encode stack config: %w", err)
+	}
+
+	confirm := NewSelect(summary(&file)+"\n"+buf.String()+"\nWrite the stack?", []string{"Write stack", "Cancel"}, false)
+	if err := Run(confirm); err != nil {
+		return err
+	}
+	if !confirm.Selected["Write stack"] {
+		return ErrAborted
+	}
+
+	path := filepath.Join(".tgs", "stacks", name+".yaml")
+	if err := template.CreateFileIfNotExists(path, buf.String()); err != nil {
+		return fmt.Errorf("failed to create stack file: %w", err)
+	}
+	fmt.Printf("Created stack configuration: %s\n", path)
+	return nil
+}
+
+// quotePlaceholders double quotes values with placeholders like the stack
+// templates do
+func quotePlaceholders(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode && strings.Contains(node.Value, "{") {
+		node.Style = yaml.DoubleQuotedStyle
+	}
+	for _, child := range node.Content {
+		quotePlaceholders(child)
+	}
+}
+
+// summary describes the components and regions of a built stack
+func summary(file *stackFile) string {
+	var regions []string
+	for region := range file.Stack.Architecture.Regions {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return fmt.Sprintf("Stack %s: %d components in %s\n", file.Stack.Name, len(file.Stack.Components), strings.Join(regions, ", "))
+}
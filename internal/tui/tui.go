@@ -0,0 +1,271 @@
+// Package tui provides a minimal terminal UI in the model/update/view style
+// used by the interactive commands
+package tui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ErrAborted is returned when the user cancels a prompt
+var ErrAborted = errors.New("aborted")
+
+// Key is a key press read from the terminal
+type Key struct {
+	// Name is set for special keys: up, down, enter, space, backspace, tab, esc
+	Name string
+	// Rune is set for printable characters
+	Rune rune
+}
+
+// Model is a screen of the UI. Update handles a key press and reports
+// whether the screen is done; View renders the screen.
+type Model interface {
+	Update(key Key) (done bool, err error)
+	View() string
+}
+
+// IsTerminal reports whether stdin and stdout are attached to a terminal
+func IsTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// Run shows a model until it's done, reading keys in raw mode
+func Run(model Model) error {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("failed to switch the terminal to raw mode: %w", err)
+	}
+	defer term.Restore(fd, state)
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		render(os.Stdout, model.View())
+
+		key, err := readKey(reader)
+		if err != nil {
+			return err
+		}
+		done, err := model.Update(key)
+		if err != nil {
+			return err
+		}
+		if done {
+			render(os.Stdout, "")
+			return nil
+		}
+	}
+}
+
+// render clears the screen and draws a view, translating newlines for raw mode
+func render(w io.Writer, view string) {
+	fmt.Fprint(w, "\x1b[H\x1b[2J"+strings.ReplaceAll(view, "\n", "\r\n"))
+}
+
+// readKey reads a key press, decoding arrow key escape sequences
+func readKey(reader *bufio.Reader) (Key, error) {
+	r, _, err := reader.ReadRune()
+	if err != nil {
+		return Key{}, fmt.Errorf("failed to read key: %w", err)
+	}
+
+	switch r {
+	case 3: // ctrl+c
+		return Key{}, ErrAborted
+	case '\r', '\n':
+		return Key{Name: "enter"}, nil
+	case ' ':
+		return Key{Name: "space"}, nil
+	case '\t':
+		return Key{Name: "tab"}, nil
+	case 127, 8:
+		return Key{Name: "backspace"}, nil
+	case 27:
+		// Arrow keys are sent as ESC [ A..D
+		if reader.Buffered() >= 2 {
+			next, _ := reader.ReadByte()
+			code, _ := reader.ReadByte()
+			if next == '[' {
+				switch code {
+				case 'A':
+					return Key{Name: "up"}, nil
+				case 'B':
+					return Key{Name: "down"}, nil
+				}
+			}
+			return Key{}, nil
+		}
+		return Key{Name: "esc"}, nil
+	}
+	return Key{Rune: r}, nil
+}
+
+// Select lets the user pick items from a list. Typing filters the list, up
+// and down move the cursor, space toggles an item when Multi is set and
+// enter confirms.
+type Select struct {
+	Title    string
+	Items    []string
+	Multi    bool
+	Selected map[string]bool
+
+	filter string
+	cursor int
+}
+
+// NewSelect returns a select of items with the given items preselected
+func NewSelect(title string, items []string, multi bool, selected ...string) *Select {
+	s := &Select{Title: title, Items: items, Multi: multi, Selected: make(map[string]bool)}
+	for _, item := range selected {
+		s.Selected[item] = true
+	}
+	return s
+}
+
+// visible returns the items matching the filter
+func (s *Select) visible() []string {
+	var items []string
+	for _, item := range s.Items {
+		if strings.Contains(strings.ToLower(item), strings.ToLower(s.filter)) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Update implements Model
+func (s *Select) Update(key Key) (bool, error) {
+	items := s.visible()
+	switch key.Name {
+	case "esc":
+		return false, ErrAborted
+	case "up":
+		if s.cursor > 0 {
+			s.cursor--
+		}
+	case "down":
+		if s.cursor < len(items)-1 {
+			s.cursor++
+		}
+	case "space":
+		if s.Multi && s.cursor < len(items) {
+			item := items[s.cursor]
+			s.Selected[item] = !s.Selected[item]
+		}
+	case "enter":
+		if !s.Multi {
+			if s.cursor >= len(items) {
+				return false, nil
+			}
+			s.Selected = map[string]bool{items[s.cursor]: true}
+		}
+		return true, nil
+	case "backspace":
+		if s.filter != "" {
+			s.filter = s.filter[:len(s.filter)-1]
+			s.cursor = 0
+		}
+	case "":
+		if key.Rune != 0 {
+			s.filter += string(key.Rune)
+			s.cursor = 0
+		}
+	}
+	return false, nil
+}
+
+// View implements Model
+func (s *Select) View() string {
+	var b strings.Builder
+	b.WriteString(s.Title + "\n")
+	if s.Multi {
+		b.WriteString("(type to filter, up/down to move, space to toggle, enter to continue)\n")
+	} else {
+		b.WriteString("(type to filter, up/down to move, enter to choose)\n")
+	}
+	if s.filter != "" {
+		b.WriteString("Filter: " + s.filter + "\n")
+	}
+	b.WriteString("\n")
+
+	items := s.visible()
+	// Only show a window of the list around the cursor
+	start := 0
+	if s.cursor > 14 {
+		start = s.cursor - 14
+	}
+	for i := start; i < len(items) && i < start+15; i++ {
+		cursor := "  "
+		if i == s.cursor {
+			cursor = "> "
+		}
+		check := ""
+		if s.Multi {
+			check = "[ ] "
+			if s.Selected[items[i]] {
+				check = "[x] "
+			}
+		}
+		b.WriteString(cursor + check + items[i] + "\n")
+	}
+	if len(items) == 0 {
+		b.WriteString("  no matches\n")
+	}
+	return b.String()
+}
+
+// Chosen returns the selected items in list order
+func (s *Select) Chosen() []string {
+	var chosen []string
+	for _, item := range s.Items {
+		if s.Selected[item] {
+			chosen = append(chosen, item)
+		}
+	}
+	return chosen
+}
+
+// Input reads a line of text
+type Input struct {
+	Title string
+	Help  string
+	Value string
+}
+
+// Update implements Model
+func (i *Input) Update(key Key) (bool, error) {
+	switch key.Name {
+	case "esc":
+		return false, ErrAborted
+	case "enter":
+		return true, nil
+	case "space":
+		i.Value += " "
+	case "backspace":
+		if i.Value != "" {
+			runes := []rune(i.Value)
+			i.Value = string(runes[:len(runes)-1])
+		}
+	case "":
+		if key.Rune != 0 {
+			i.Value += string(key.Rune)
+		}
+	}
+	return false, nil
+}
+
+// View implements Model
+func (i *Input) View() string {
+	view := i.Title + "\n"
+	if i.Help != "" {
+		view += "(" + i.Help + ")\n"
+	}
+	return view + "\n> " + i.Value
+}
@@ -0,0 +1,55 @@
+package tui
+
+import (
+	"reflect"
+	"testing"
+)
+
+func typeKeys(t *testing.T, model Model, keys ...Key) bool {
+	t.Helper()
+	for _, key := range keys {
+		done, err := model.Update(key)
+		if err != nil {
+			t.Fatalf("Update(%+v) unexpected error: %v", key, err)
+		}
+		if done {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSelectFiltersAndToggles(t *testing.T) {
+	s := NewSelect("Regions", []string{"eastus", "eastus2", "westus2"}, true, "westus2")
+
+	done := typeKeys(t, s,
+		Key{Rune: 'e'}, Key{Rune: 'a'}, Key{Name: "down"}, Key{Name: "space"},
+		Key{Name: "backspace"}, Key{Name: "backspace"}, Key{Name: "enter"},
+	)
+	if !done {
+		t.Fatal("expected enter to finish the select")
+	}
+	if want := []string{"eastus2", "westus2"}; !reflect.DeepEqual(s.Chosen(), want) {
+		t.Errorf("Chosen() = %v, want %v", s.Chosen(), want)
+	}
+}
+
+func TestSelectSingleChoosesCursor(t *testing.T) {
+	s := NewSelect("Confirm", []string{"Write stack", "Cancel"}, false)
+	typeKeys(t, s, Key{Name: "down"}, Key{Name: "enter"})
+	if want := []string{"Cancel"}; !reflect.DeepEqual(s.Chosen(), want) {
+		t.Errorf("Chosen() = %v, want %v", s.Chosen(), want)
+	}
+
+	if _, err := s.Update(Key{Name: "esc"}); err != ErrAborted {
+		t.Errorf("expected esc to abort, got %v", err)
+	}
+}
+
+func TestInputEditsValue(t *testing.T) {
+	input := &Input{Title: "Description"}
+	typeKeys(t, input, Key{Rune: 'w'}, Key{Rune: 'e'}, Key{Name: "space"}, Key{Rune: 'x'}, Key{Name: "backspace"}, Key{Rune: 'b'}, Key{Name: "enter"})
+	if input.Value != "we b" {
+		t.Errorf("Value = %q, want %q", input.Value, "we b")
+	}
+}
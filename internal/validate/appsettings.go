@@ -0,0 +1,113 @@
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/appsettings"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+)
+
+// ValidateAppSettings checks the generated settings files of the components
+// with app_settings: each must be a JSON object of scalar settings, without
+// the settings the app resources manage themselves or secret settings the
+// Key Vault provides. Components that haven't been generated yet are skipped.
+func ValidateAppSettings(stackName string, stack *config.MainConfig) []error {
+	var findings []error
+
+	var compNames []string
+	for name, comp := range stack.Stack.Components {
+		if comp.AppSettings {
+			compNames = append(compNames, name)
+		}
+	}
+	sort.Strings(compNames)
+
+	for _, compName := range compNames {
+		dir := appsettings.Dir(stackName, compName)
+		if _, err := project.Stat(dir); err != nil {
+			continue
+		}
+		secrets := stack.AppSecrets(compName)
+		var appNames []string
+		for appName := range secrets {
+			appNames = append(appNames, appName)
+		}
+		sort.Strings(appNames)
+
+		err := project.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || !strings.HasSuffix(path, appsettings.FileSuffix) {
+				return nil
+			}
+			file := filepath.ToSlash(path)
+			context := fmt.Sprintf("App settings '%s'", file)
+
+			settings, err := appsettings.Read(path)
+			if err != nil {
+				finding := ValidationError{Context: context, File: file, Message: err.Error(), Rule: RuleAppSettingsFile}
+				var fileErr *appsettings.Error
+				if errors.As(err, &fileErr) {
+					finding.Message = fileErr.Message
+					finding.Line = fileErr.Line
+				}
+				findings = append(findings, finding)
+				return nil
+			}
+
+			// Secret settings of the apps the file applies to: the global and
+			// environment files apply to every app, the others to their app
+			app := strings.TrimSuffix(info.Name(), appsettings.FileSuffix)
+			everyApp := path == filepath.Join(dir, appsettings.LayerGlobal+appsettings.FileSuffix) || app == filepath.Base(filepath.Dir(path))
+			shadowed := make(map[string]string)
+			for _, appName := range appNames {
+				if everyApp || appName == app {
+					for name := range secrets[appName] {
+						if _, ok := shadowed[name]; !ok {
+							shadowed[name] = appName
+						}
+					}
+				}
+			}
+
+			var names []string
+			for name := range settings {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if appsettings.Reserved(name) {
+					findings = append(findings, ValidationError{
+						Context: context,
+						File:    file,
+						Message: fmt.Sprintf("setting %s is managed by the arguments of the app resource", name),
+						Rule:    RuleAppSettingsReserved,
+					})
+				} else if appName, ok := shadowed[name]; ok {
+					findings = append(findings, ValidationError{
+						Context: context,
+						File:    file,
+						Message: fmt.Sprintf("setting %s is a secret setting of app %s, read from the Key Vault", name, appName),
+						Rule:    RuleAppSettingsReserved,
+					})
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			findings = append(findings, ValidationError{
+				Context: fmt.Sprintf("Component '%s'", compName),
+				Message: fmt.Sprintf("failed to read app settings files: %v", err),
+				Rule:    RuleAppSettingsFile,
+			})
+		}
+	}
+	return applyRules(findings)
+}
@@ -0,0 +1,133 @@
+package validate
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/envconfig"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+)
+
+// envConfigKeyPattern matches the keys of environment configs, which are
+// also module inputs
+var envConfigKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validateEnvConfigFields checks the env_config keys components add to their
+// environment config schema
+func validateEnvConfigFields(stack *config.MainConfig) []error {
+	var errors []error
+
+	var compNames []string
+	for name := range stack.Stack.Components {
+		compNames = append(compNames, name)
+	}
+	sort.Strings(compNames)
+
+	for _, compName := range compNames {
+		fields := stack.Stack.Components[compName].EnvConfig
+		var names []string
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		context := fmt.Sprintf("Component '%s'", compName)
+		for _, name := range names {
+			field := fields[name]
+			if !envConfigKeyPattern.MatchString(name) {
+				errors = append(errors, ValidationError{
+					Context: context,
+					Message: fmt.Sprintf("env_config key %q must be an identifier of letters, digits and '_'", name),
+					Rule:    RuleComponentEnvConfig,
+				})
+			}
+			if !contains(envconfig.Types, field.Type) {
+				errors = append(errors, ValidationError{
+					Context: context,
+					Message: fmt.Sprintf("env_config key %s has type %q, must be one of %s", name, field.Type, strings.Join(envconfig.Types, ", ")),
+					Rule:    RuleComponentEnvConfig,
+				})
+			}
+			if field.Required && field.Default != "" {
+				errors = append(errors, ValidationError{
+					Context: context,
+					Message: fmt.Sprintf("env_config key %s is required, so its default is never used", name),
+					Rule:    RuleComponentEnvConfig,
+				})
+			}
+		}
+	}
+	return errors
+}
+
+// ValidateEnvConfigs checks the generated environment configs of a stack
+// against the schemas of its components: required keys must be set and keys
+// must have the type of the schema. Keys outside the schema, except
+// secrets, are reported as they aren't passed to the module. Environments
+// that haven't been generated yet are skipped.
+func ValidateEnvConfigs(cfg *config.TGSConfig, stackName string, stack *config.MainConfig) []error {
+	var findings []error
+
+	schemas := make(map[string]envconfig.Schema)
+	for compName, comp := range stack.Stack.Components {
+		if comp.Provider != "" {
+			schemas[compName] = envconfig.For(comp)
+		}
+	}
+
+	var subNames []string
+	for name := range cfg.Subscriptions {
+		subNames = append(subNames, name)
+	}
+	sort.Strings(subNames)
+
+	for _, subName := range subNames {
+		for _, env := range cfg.Subscriptions[subName].Environments {
+			envStack := env.Stack
+			if envStack == "" {
+				envStack = "main"
+			}
+			if envStack != stackName {
+				continue
+			}
+
+			path := output.Path("config", stackName, "environments", subName, env.Name+".env.hcl")
+			data, err := project.ReadFile(path)
+			if err != nil {
+				continue
+			}
+
+			// Secrets may set keys outside the schema
+			known := make(map[string]map[string]bool)
+			for key := range env.Secrets {
+				if compName, attribute, err := config.SecretKey(key); err == nil {
+					if known[compName] == nil {
+						known[compName] = make(map[string]bool)
+					}
+					known[compName][attribute] = true
+				}
+			}
+
+			file := filepath.ToSlash(path)
+			for _, problem := range envconfig.Check(data, path, schemas, known) {
+				finding := ValidationError{
+					Context: fmt.Sprintf("Environment config '%s'", file),
+					File:    file,
+					Line:    problem.Line,
+					Message: problem.Message,
+					Rule:    RuleEnvConfig,
+				}
+				if problem.Unknown {
+					finding.Rule = RuleEnvConfigUnknown
+				}
+				findings = append(findings, finding)
+			}
+		}
+	}
+	return applyRules(findings)
+}
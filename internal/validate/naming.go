@@ -0,0 +1,109 @@
+package validate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/naming"
+)
+
+// ValidateResourceNames resolves the resource name of every component and app
+// in each environment and region of a stack and checks it against the Azure
+// naming rules of its resource type. Globally unique resource types must also
+// resolve to a distinct name for every deployment.
+func ValidateResourceNames(cfg *config.TGSConfig, stackName string, stack *config.MainConfig) []error {
+	var errors []error
+
+	reported := make(map[string]bool)
+	claimed := make(map[string]string)
+
+	for _, entry := range naming.Resolved(cfg, stackName, stack) {
+		if violations := naming.Check(entry.ResourceType, entry.Name); len(violations) > 0 && !reported[entry.Name] {
+			reported[entry.Name] = true
+			errors = append(errors, ValidationError{
+				Context: fmt.Sprintf("Component '%s'", entry.Component),
+				Message: fmt.Sprintf("resource name %s (%s) is invalid for %s: %s", entry.Name, entry.Deployment(), entry.ResourceType, strings.Join(violations, ", ")),
+				Rule:    RuleResourceName,
+			})
+		}
+
+		rule, ok := naming.AzureRules[entry.ResourceType]
+		if !ok || rule.Scope != naming.ScopeGlobal {
+			continue
+		}
+
+		key := entry.ResourceType + "/" + strings.ToLower(entry.Name)
+		if other, taken := claimed[key]; taken {
+			errors = append(errors, ValidationError{
+				Context: fmt.Sprintf("Component '%s'", entry.Component),
+				Message: fmt.Sprintf("resource name %s of %s must be globally unique but is also used by %s", entry.Name, entry.Deployment(), other),
+				Rule:    RuleResourceNameCollision,
+			})
+			continue
+		}
+		claimed[key] = entry.Deployment()
+	}
+
+	return applyRules(errors)
+}
+
+// ValidatePrefixCollisions checks that every region prefix, environment
+// prefix and component abbreviation combination of the architecture comes
+// from a single region, environment and component across all stacks.
+// Distinct environments sharing a prefix, e.g. stage and sandbox both S,
+// resolve to identical resource names that only fail at apply time.
+func ValidatePrefixCollisions(cfg *config.TGSConfig, stacks map[string]*config.MainConfig) []error {
+	var stackNames []string
+	for stackName := range stacks {
+		stackNames = append(stackNames, stackName)
+	}
+	sort.Strings(stackNames)
+
+	type origin struct{ environment, region, component string }
+	prefixes := naming.NewPrefixes(cfg.Prefixes)
+	claimed := make(map[string]origin)
+	reported := make(map[string]bool)
+
+	var errors []error
+	for _, stackName := range stackNames {
+		for _, entry := range naming.Resolved(cfg, stackName, stacks[stackName]) {
+			current := origin{entry.Environment, entry.Region, entry.Component}
+			parts := []string{prefixes.Region(entry.Region), prefixes.Environment(entry.Environment), naming.Abbreviation(entry.Component), entry.App}
+			key := strings.ToLower(strings.Join(parts, "/"))
+
+			other, taken := claimed[key]
+			if !taken {
+				claimed[key] = current
+				continue
+			}
+			if other == current {
+				continue
+			}
+
+			var shared []string
+			if other.region != current.region {
+				shared = append(shared, fmt.Sprintf("regions %s and %s share the prefix %s", other.region, current.region, parts[0]))
+			}
+			if other.environment != current.environment {
+				shared = append(shared, fmt.Sprintf("environments %s and %s share the prefix %s", other.environment, current.environment, parts[1]))
+			}
+			if other.component != current.component {
+				shared = append(shared, fmt.Sprintf("components %s and %s share the abbreviation %s", other.component, current.component, parts[2]))
+			}
+			pair := strings.Join(shared, ", ")
+			if reported[pair] {
+				continue
+			}
+			reported[pair] = true
+			errors = append(errors, ValidationError{
+				Context: fmt.Sprintf("Component '%s'", entry.Component),
+				Message: fmt.Sprintf("%s resolves to the same name prefixes as %s/%s/%s: %s", entry.Deployment(), other.environment, other.region, other.component, pair),
+				Rule:    RulePrefixCollision,
+			})
+		}
+	}
+
+	return applyRules(errors)
+}
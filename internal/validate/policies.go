@@ -0,0 +1,200 @@
+package validate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/apim"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+)
+
+// validatePolicies checks the policy fragments of components and the
+// operation policies of their apps: they need policy_files on an API
+// Management component, valid names and policy documents that only include
+// fragments of the component
+func validatePolicies(stack *config.MainConfig) []error {
+	var errors []error
+
+	var compNames []string
+	for name := range stack.Stack.Components {
+		compNames = append(compNames, name)
+	}
+	sort.Strings(compNames)
+
+	for _, compName := range compNames {
+		comp := stack.Stack.Components[compName]
+		if len(comp.PolicyFragments) == 0 {
+			continue
+		}
+		context := fmt.Sprintf("Component '%s'", compName)
+		if !comp.PolicyFiles || comp.Source != "azurerm_api_management" {
+			errors = append(errors, ValidationError{
+				Context: context,
+				Message: "policy_fragments need policy_files on an azurerm_api_management component",
+				Rule:    RulePolicyFiles,
+			})
+		}
+		for _, id := range sortedKeys(comp.PolicyFragments) {
+			if !apim.ValidName(id) {
+				errors = append(errors, ValidationError{
+					Context: context,
+					Message: fmt.Sprintf("policy fragment id %q must be up to 80 letters, digits, '.', '_' and '-'", id),
+					Rule:    RulePolicyFiles,
+				})
+			}
+			if fragment := comp.PolicyFragments[id]; strings.TrimSpace(fragment) != "" {
+				errors = append(errors, policyProblems(context, "", fmt.Sprintf("policy fragment %s", id), apim.Check([]byte(fragment), apim.RootFragment), comp.PolicyFragments)...)
+			}
+		}
+	}
+
+	for region, comps := range stack.Stack.Architecture.Regions {
+		for _, rc := range comps {
+			comp := stack.Stack.Components[rc.Component]
+			for _, appName := range rc.Apps {
+				app := rc.App(appName)
+				if len(app.Operations) == 0 {
+					continue
+				}
+				context := fmt.Sprintf("Region '%s' Component '%s' App '%s'", region, rc.Component, appName)
+				if !comp.PolicyFiles || comp.Source != "azurerm_api_management" {
+					errors = append(errors, ValidationError{
+						Context: context,
+						Message: fmt.Sprintf("operations need policy_files on an azurerm_api_management component, %s isn't one", rc.Component),
+						Rule:    RulePolicyFiles,
+					})
+				}
+				for _, operation := range sortedKeys(app.Operations) {
+					api, op, ok := strings.Cut(operation, "/")
+					if !ok || !apim.ValidName(api) || !apim.ValidName(op) {
+						errors = append(errors, ValidationError{
+							Context: context,
+							Message: fmt.Sprintf("operation %q must be <api>/<operation> of letters, digits, '.', '_' and '-'", operation),
+							Rule:    RulePolicyFiles,
+						})
+					}
+					if policy := app.Operations[operation]; strings.TrimSpace(policy) != "" {
+						errors = append(errors, policyProblems(context, "", fmt.Sprintf("policy of operation %s", operation), apim.Check([]byte(policy), apim.RootPolicies), comp.PolicyFragments)...)
+					}
+				}
+			}
+		}
+	}
+	return errors
+}
+
+// ValidatePolicyFiles checks the generated policy files of the components
+// with policy_files: instance and operation policies and fragments must be
+// well-formed policy documents using known policies and fragments of the
+// component. Components that haven't been generated yet are skipped.
+func ValidatePolicyFiles(stackName string, stack *config.MainConfig) []error {
+	var findings []error
+
+	var compNames []string
+	for name, comp := range stack.Stack.Components {
+		if comp.PolicyFiles {
+			compNames = append(compNames, name)
+		}
+	}
+	sort.Strings(compNames)
+
+	for _, compName := range compNames {
+		dir := output.Path("config", stackName, "policy_files_"+compName)
+		if _, err := project.Stat(dir); err != nil {
+			continue
+		}
+
+		// Fragments of the stack file and those added to the fragments folder
+		fragments := make(map[string]string)
+		for id, fragment := range stack.Stack.Components[compName].PolicyFragments {
+			fragments[id] = fragment
+		}
+		fragmentsDir := filepath.Join(dir, "fragments")
+		if files, err := project.Glob(filepath.Join(fragmentsDir, "*.xml")); err == nil {
+			for _, file := range files {
+				fragments[strings.TrimSuffix(filepath.Base(file), ".xml")] = ""
+			}
+		}
+
+		err := project.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || !strings.HasSuffix(path, ".xml") {
+				return nil
+			}
+
+			root := apim.RootPolicies
+			if filepath.Dir(path) == fragmentsDir {
+				root = apim.RootFragment
+			} else if !strings.HasSuffix(path, ".policy.xml") {
+				return nil
+			}
+
+			data, err := project.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			file := filepath.ToSlash(path)
+			findings = append(findings, policyProblems(fmt.Sprintf("Policy '%s'", file), file, "policy", apim.Check(data, root), fragments)...)
+			return nil
+		})
+		if err != nil {
+			findings = append(findings, ValidationError{
+				Context: fmt.Sprintf("Component '%s'", compName),
+				Message: fmt.Sprintf("failed to read policy files: %v", err),
+				Rule:    RulePolicyXML,
+			})
+		}
+	}
+	return applyRules(findings)
+}
+
+// policyProblems converts the problems of a checked policy document, and the
+// fragments it includes that aren't in fragments, to findings. file is set
+// for documents read from a file, subject names the document in messages.
+func policyProblems(context, file, subject string, doc apim.Document, fragments map[string]string) []error {
+	var errors []error
+	for _, problem := range doc.Problems {
+		finding := ValidationError{Context: context, File: file, Line: problem.Line, Rule: RulePolicyXML}
+		if problem.Unknown {
+			finding.Rule = RulePolicyElement
+		}
+		finding.Message = problem.Message
+		if file == "" {
+			finding.Line = 0
+			finding.Message = fmt.Sprintf("%s: %s", subject, problem.Message)
+		}
+		errors = append(errors, finding)
+	}
+	for _, id := range doc.Fragments {
+		if _, ok := fragments[id]; !ok {
+			finding := ValidationError{
+				Context: context,
+				File:    file,
+				Message: fmt.Sprintf("includes fragment %s, which the component doesn't define", id),
+				Rule:    RulePolicyElement,
+			}
+			if file == "" {
+				finding.Message = fmt.Sprintf("%s %s", subject, finding.Message)
+			}
+			errors = append(errors, finding)
+		}
+	}
+	return errors
+}
+
+// sortedKeys returns the keys of a map sorted
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,133 @@
+package validate
+
+import (
+	"path/filepath"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/schema"
+)
+
+// ConfigFile is the path of tgs.yaml, the file of project findings
+const ConfigFile = ".tgs/tgs.yaml"
+
+// StackFile returns the path of the file of a stack
+func StackFile(stackName string) string {
+	return filepath.ToSlash(filepath.Join(".tgs", "stacks", stackName+".yaml"))
+}
+
+// Options selects the checks of a validation beyond those generate runs
+type Options struct {
+	// Stacks reports the findings of the stacks used by environments, whose
+	// name prefixes are otherwise checked when they can be read
+	Stacks bool
+	// Full adds the checks of tgs validate: resolved resource names, env
+	// configs, app settings, policy files and required module variables
+	Full bool
+	// Strict fails on required module variables without a value
+	Strict bool
+	// Providers checks provider versions against the Terraform Registry, or
+	// only its local cache when Offline is set
+	Providers bool
+	Offline   bool
+	// Schema checks the files against their JSON Schemas
+	Schema bool
+	// Online checks that the remote state of every subscription is readable
+	Online bool
+}
+
+// Report is the findings of a validated file
+type Report struct {
+	File string
+	// Stack is the stack of a stack file, empty for tgs.yaml
+	Stack    string
+	Findings []error
+}
+
+// ProjectReport is the result of validating a project
+type ProjectReport struct {
+	// Config is the report of tgs.yaml
+	Config Report
+	// Stacks are the reports of the stacks used by environments in order,
+	// with Options.Stacks
+	Stacks []Report
+	// Prefixes is the report of the name prefixes across the stacks
+	Prefixes Report
+	// StackConfigs are the stacks that could be read, by name
+	StackConfigs map[string]*config.MainConfig
+}
+
+// Reports returns the reports of a project in order
+func (r *ProjectReport) Reports() []Report {
+	reports := append([]Report{r.Config}, r.Stacks...)
+	return append(reports, r.Prefixes)
+}
+
+// Project validates tgs.yaml, the stacks its environments use and their name
+// prefixes. It's the validation of tgs generate, tgs validate-tgs and the
+// Go API; a stack that can't be read is an error of its report.
+func Project(tgsConfig *config.TGSConfig, opts Options) *ProjectReport {
+	report := &ProjectReport{
+		Config:       Config(tgsConfig, opts),
+		StackConfigs: make(map[string]*config.MainConfig),
+	}
+
+	for _, stackName := range tgsConfig.UsedStacks() {
+		stack, err := config.ReadMainConfig(stackName)
+		if err != nil {
+			if opts.Stacks {
+				report.Stacks = append(report.Stacks, Report{File: StackFile(stackName), Stack: stackName, Findings: []error{err}})
+			}
+			continue
+		}
+		report.StackConfigs[stackName] = stack
+		if opts.Stacks {
+			report.Stacks = append(report.Stacks, Stack(tgsConfig, stackName, stack, opts))
+		}
+	}
+
+	report.Prefixes = Report{File: ConfigFile, Findings: ValidatePrefixCollisions(tgsConfig, report.StackConfigs)}
+	return report
+}
+
+// Config validates tgs.yaml
+func Config(tgsConfig *config.TGSConfig, opts Options) Report {
+	findings := ValidateTGSConfig(tgsConfig)
+	if opts.Schema {
+		for _, file := range append([]string{ConfigFile}, tgsConfig.IncludedFiles...) {
+			findings = append(findings, ValidateSchema(file, schema.TGS())...)
+		}
+	}
+	if opts.Online {
+		findings = append(findings, ValidateRemoteStateOnline(tgsConfig)...)
+	}
+	return Report{File: ConfigFile, Findings: findings}
+}
+
+// Stack validates a stack. Without the project configuration the checks
+// needing it are skipped.
+func Stack(tgsConfig *config.TGSConfig, stackName string, stack *config.MainConfig, opts Options) Report {
+	findings := ValidateStack(stack)
+	if opts.Providers {
+		findings = append(findings, ValidateProviderVersions(stack, opts.Offline)...)
+	}
+	if tgsConfig != nil {
+		if opts.Full {
+			findings = append(findings, ValidateResourceNames(tgsConfig, stackName, stack)...)
+		}
+		findings = append(findings, ValidateStackRegions(tgsConfig, stackName, stack)...)
+		if opts.Full {
+			findings = append(findings, ValidateEnvConfigs(tgsConfig, stackName, stack)...)
+		}
+	}
+	if opts.Full {
+		findings = append(findings, ValidateAppSettings(stackName, stack)...)
+		findings = append(findings, ValidatePolicyFiles(stackName, stack)...)
+		findings = append(findings, ValidateRequiredVariables(stackName, stack, opts.Strict)...)
+	}
+
+	file := StackFile(stackName)
+	if opts.Schema {
+		findings = append(findings, ValidateSchema(file, schema.Stack())...)
+	}
+	return Report{File: file, Stack: stackName, Findings: findings}
+}
@@ -0,0 +1,220 @@
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+)
+
+// Result is a single validation finding in a machine readable report
+type Result struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Context  string `json:"context,omitempty"`
+	Message  string `json:"message"`
+}
+
+// NewResults converts validation errors into report results. Errors without
+// a file of their own are attributed to file.
+func NewResults(errs []error, file string) []Result {
+	var results []Result
+	for _, err := range errs {
+		result := Result{Severity: SeverityError, File: file, Message: err.Error()}
+
+		var validationErr ValidationError
+		if errors.As(err, &validationErr) {
+			result.Rule = validationErr.Rule
+			result.Context = validationErr.Context
+			result.Message = validationErr.Message
+			result.Severity = SeverityOf(validationErr)
+			if validationErr.File != "" {
+				result.File = validationErr.File
+			}
+		}
+
+		if validationErr.Line > 0 {
+			result.Line = validationErr.Line
+		} else {
+			result.Line = locate(result.File, result.Context)
+		}
+		results = append(results, result)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].File != results[j].File {
+			return results[i].File < results[j].File
+		}
+		if results[i].Line != results[j].Line {
+			return results[i].Line < results[j].Line
+		}
+		return results[i].Rule+results[i].Message < results[j].Rule+results[j].Message
+	})
+	return results
+}
+
+// locate returns the line of the YAML key named in a context such as
+// "Component 'redis'", or 0 if it can't be found
+func locate(file, context string) int {
+	start := strings.Index(context, "'")
+	end := strings.LastIndex(context, "'")
+	if start < 0 || end <= start {
+		return 0
+	}
+	key := context[start+1 : end]
+
+	data, err := project.ReadFile(file)
+	if err != nil {
+		return 0
+	}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimPrefix(strings.TrimSpace(line), "- ")
+		if strings.HasPrefix(trimmed, key+":") || strings.HasPrefix(trimmed, `"`+key+`":`) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// FormatJSON renders validation results as JSON
+func FormatJSON(results []Result) (string, error) {
+	if results == nil {
+		results = []Result{}
+	}
+
+	out := struct {
+		Valid   bool     `json:"valid"`
+		Results []Result `json:"results"`
+	}{
+		Valid:   !hasErrors(results),
+		Results: results,
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal validation results: %w", err)
+	}
+	return string(data), nil
+}
+
+// FormatSARIF renders validation results as a SARIF 2.1.0 log for code
+// scanning integrations
+func FormatSARIF(results []Result) (string, error) {
+	type message struct {
+		Text string `json:"text"`
+	}
+	type region struct {
+		StartLine int `json:"startLine"`
+	}
+	type physicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region *region `json:"region,omitempty"`
+	}
+	type location struct {
+		PhysicalLocation physicalLocation `json:"physicalLocation"`
+	}
+	type sarifResult struct {
+		RuleID    string     `json:"ruleId"`
+		Level     string     `json:"level"`
+		Message   message    `json:"message"`
+		Locations []location `json:"locations"`
+	}
+	type rule struct {
+		ID                   string  `json:"id"`
+		ShortDescription     message `json:"shortDescription"`
+		DefaultConfiguration struct {
+			Level string `json:"level"`
+		} `json:"defaultConfiguration"`
+	}
+
+	rules := []rule{}
+	seen := make(map[string]bool)
+	sarifResults := []sarifResult{}
+	for _, result := range results {
+		ruleID := result.Rule
+		if ruleID == "" {
+			ruleID = "validation"
+		}
+
+		if !seen[ruleID] {
+			seen[ruleID] = true
+			r := rule{ID: ruleID, ShortDescription: message{Text: RuleDescriptions[ruleID]}}
+			if r.ShortDescription.Text == "" {
+				r.ShortDescription.Text = ruleID
+			}
+			r.DefaultConfiguration.Level = sarifLevel(result.Severity)
+			rules = append(rules, r)
+		}
+
+		var loc location
+		loc.PhysicalLocation.ArtifactLocation.URI = result.File
+		if result.Line > 0 {
+			loc.PhysicalLocation.Region = &region{StartLine: result.Line}
+		}
+
+		text := result.Message
+		if result.Context != "" {
+			text = fmt.Sprintf("%s: %s", result.Context, result.Message)
+		}
+
+		sarifResults = append(sarifResults, sarifResult{
+			RuleID:    ruleID,
+			Level:     sarifLevel(result.Severity),
+			Message:   message{Text: text},
+			Locations: []location{loc},
+		})
+	}
+
+	log := map[string]interface{}{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []interface{}{
+			map[string]interface{}{
+				"tool": map[string]interface{}{
+					"driver": map[string]interface{}{
+						"name":           "tgs",
+						"informationUri": "https://github.com/davoodharun/terragrunt-scaffolder",
+						"rules":          rules,
+					},
+				},
+				"results": sarifResults,
+			},
+		},
+	}
+
+	data, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal SARIF log: %w", err)
+	}
+	return string(data), nil
+}
+
+// sarifLevel maps a severity to a SARIF result level
+func sarifLevel(severity string) string {
+	switch severity {
+	case SeverityWarning:
+		return "warning"
+	case SeverityInfo:
+		return "note"
+	default:
+		return "error"
+	}
+}
+
+// hasErrors reports whether any result has error severity
+func hasErrors(results []Result) bool {
+	for _, result := range results {
+		if result.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,320 @@
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+)
+
+// Validation rule IDs
+const (
+	RuleStackRequiredField             = "stack-required-field"
+	RuleStackDescription               = "stack-description"
+	RuleStackComponentsRequired        = "stack-components-required"
+	RuleComponentRequiredField         = "component-required-field"
+	RuleComponentDescription           = "component-description"
+	RuleComponentSource                = "component-source"
+	RuleComponentVersionFormat         = "component-version-format"
+	RuleComponentProviders             = "component-providers"
+	RuleComponentInputs                = "component-inputs"
+	RuleComponentDataSources           = "component-data-sources"
+	RuleComponentInstances             = "component-instances"
+	RuleComponentSlots                 = "component-slots"
+	RuleProviderVersion                = "provider-version"
+	RuleProviderRegistryUnavailable    = "provider-registry-unavailable"
+	RuleDependencyFormat               = "dependency-format"
+	RuleDependencyRegion               = "dependency-region"
+	RuleDependencyComponent            = "dependency-component"
+	RuleDependencyUnusedComponent      = "dependency-unused-component"
+	RuleDependencyApp                  = "dependency-app"
+	RuleDependencyOptionsUndeclared    = "dependency-options-undeclared"
+	RuleDependencyCycle                = "dependency-cycle"
+	RuleResourceName                   = "resource-name"
+	RuleResourceNameCollision          = "resource-name-collision"
+	RulePrefixCollision                = "prefix-collision"
+	RuleArchitectureRegionsRequired    = "architecture-regions-required"
+	RuleArchitectureRegionUnknown      = "architecture-region-unknown"
+	RulePairedRegion                   = "paired-region"
+	RuleArchitectureComponentUndefined = "architecture-component-undefined"
+	RuleRegionNotAllowed               = "region-not-allowed"
+	RuleRegionCloud                    = "region-cloud"
+	RuleRegionsAllowlistUnknown        = "regions-allowlist-unknown"
+	RuleExternalDependencyConflict     = "external-dependency-conflict"
+	RuleExternalDependencySource       = "external-dependency-source"
+	RuleExternalDependencyRemoteState  = "external-dependency-remote-state"
+	RuleExternalDependencyUndefined    = "external-dependency-undefined"
+	RuleStackMigration                 = "stack-migration"
+	RuleObservability                  = "observability"
+	RuleRouting                        = "routing"
+	RuleAppSettingsSecrets             = "app-settings-secrets"
+	RuleAppSettingsFile                = "app-settings-file"
+	RuleAppSettingsReserved            = "app-settings-reserved"
+	RulePolicyFiles                    = "policy-files"
+	RulePolicyXML                      = "policy-xml"
+	RulePolicyElement                  = "policy-element"
+	RuleComponentEnvConfig             = "component-env-config"
+	RuleEnvConfig                      = "env-config"
+	RuleEnvConfigUnknown               = "env-config-unknown"
+	RuleUnresolvedVariable             = "unresolved-variable"
+	RuleProjectNameRequired            = "project-name-required"
+	RuleSubscriptionsRequired          = "subscriptions-required"
+	RuleRemoteStateRequiredField       = "remote-state-required-field"
+	RuleSubscriptionCloud              = "subscription-cloud"
+	RuleSubscriptionIDFormat           = "subscription-id-format"
+	RuleEnvironmentsRequired           = "environments-required"
+	RuleEnvironmentNameRequired        = "environment-name-required"
+	RuleEnvironmentApproval            = "environment-approval"
+	RuleEnvironmentSecrets             = "environment-secrets"
+	RuleRequiredTags                   = "required-tags"
+	RuleTagName                        = "tag-name"
+	RulePrefixRegion                   = "prefix-region"
+	RulePrefixFormat                   = "prefix-format"
+	RuleToolingVersion                 = "tooling-version"
+	RuleToolingVersionFiles            = "tooling-version-files"
+	RuleSecurity                       = "security"
+	RuleLayout                         = "layout"
+	RuleGenerationMode                 = "generation-mode"
+	RuleOutputDir                      = "output-dir"
+	RuleOwners                         = "owners"
+	RuleRootOptions                    = "root-options"
+	RuleRemoteStateOptions             = "remote-state-options"
+	RuleRemoteStateSnapshot            = "remote-state-snapshot"
+	RuleRemoteStateStorageName         = "remote-state-storage-name"
+	RuleRemoteStateAccountGeneric      = "remote-state-account-generic"
+	RuleRemoteStateShared              = "remote-state-shared"
+	RuleRemoteStateUnreachable         = "remote-state-unreachable"
+	RuleMirrorHTTPS                    = "mirror-https"
+	RuleMirrorPublicKey                = "mirror-public-key"
+	RuleDiagramServer                  = "diagram-server"
+	RuleTemplateOverrideUnknown        = "template-override-unknown"
+	RuleSchema                         = "schema"
+	RuleUnresolvedPlaceholder          = "unresolved-placeholder"
+	RuleRulesConfig                    = "rules-config"
+)
+
+// RuleDescriptions describes every validation rule
+var RuleDescriptions = map[string]string{
+	RuleStackRequiredField:             "Stack name and version must be set",
+	RuleStackDescription:               "Stacks should have a description",
+	RuleStackComponentsRequired:        "A stack must define at least one component",
+	RuleComponentRequiredField:         "Component source, provider and version must be set",
+	RuleComponentDescription:           "Components should have a description",
+	RuleComponentSource:                "Component source must be a supported Azure resource type",
+	RuleComponentVersionFormat:         "Component versions must be exact semantic versions",
+	RuleComponentProviders:             "Additional component providers must set a unique name and an exact version",
+	RuleComponentInputs:                "Input placeholders must reference a dependency of the component and an output it exports",
+	RuleComponentDataSources:           "Data sources must have a resource type and identifier names, {data:name.attribute} inputs must be the whole value and reference one",
+	RuleComponentInstances:             "Instances need lowercase names and identifier inputs, and can't be combined with slots, policy files or secret app settings",
+	RuleComponentSlots:                 "Deployment slots are only set on web and function apps, with valid names including the swapped slot",
+	RuleProviderVersion:                "Provider versions must be published in the Terraform Registry",
+	RuleProviderRegistryUnavailable:    "Provider versions could not be checked against the Terraform Registry",
+	RuleDependencyFormat:               "Dependencies must use the region.component[.app] format",
+	RuleDependencyRegion:               "Dependencies must reference a valid region of the architecture",
+	RuleDependencyComponent:            "Dependencies must reference a defined component",
+	RuleDependencyUnusedComponent:      "Dependencies must reference a component deployed in the architecture",
+	RuleDependencyApp:                  "Dependencies must reference an app deployed in the architecture",
+	RuleDependencyOptionsUndeclared:    "dependency_options must only reference declared dependencies",
+	RuleDependencyCycle:                "Dependencies must not form a cycle",
+	RuleResourceName:                   "Resolved resource names must meet the Azure naming rules of their resource type",
+	RuleResourceNameCollision:          "Globally unique resources must resolve to a distinct name in every environment and region",
+	RulePrefixCollision:                "Region and environment prefixes and component abbreviations must identify a single region, environment and component",
+	RuleArchitectureRegionsRequired:    "The architecture must define at least one region",
+	RuleArchitectureRegionUnknown:      "Architecture regions must be in the Azure region catalog",
+	RulePairedRegion:                   "Paired regions must be other known regions deploying the targets of {paired_region} dependencies",
+	RuleArchitectureComponentUndefined: "Architecture entries must reference a defined component",
+	RuleRegionNotAllowed:               "Stacks must only deploy to regions in the tgs.yaml regions allowlist",
+	RuleRegionCloud:                    "Stacks must only deploy to regions available in the cloud of their subscriptions",
+	RuleRegionsAllowlistUnknown:        "The tgs.yaml regions allowlist must only contain regions of the Azure region catalog",
+	RuleExternalDependencyConflict:     "External dependency names must not collide with component names",
+	RuleExternalDependencySource:       "External dependencies must set exactly one of config_path or remote_state",
+	RuleExternalDependencyRemoteState:  "External remote state must set resource_group, storage_account, container and key",
+	RuleExternalDependencyUndefined:    "external_deps must reference a defined external dependency",
+	RuleStackMigration:                 "Stack migrations must target a version up to the stack version and reference components of the stack",
+	RuleObservability:                  "The observability workspace must be a Log Analytics workspace component in dependency notation",
+	RuleRouting:                        "Routing must name another component deployed to the architecture and apps it deploys, Traffic Manager a single app",
+	RuleAppSettingsSecrets:             "Secret app settings need app_settings and a Key Vault component in dependency notation, and valid secret names",
+	RuleAppSettingsFile:                "App settings files must be JSON objects of string, number or boolean settings",
+	RuleAppSettingsReserved:            "App settings files must not set settings managed by the app resource or secret settings of the app",
+	RulePolicyFiles:                    "Policy fragments and operation policies need policy_files on an API Management component and valid names",
+	RulePolicyXML:                      "API Management policy documents must be well-formed with a policies or fragment root and the sections of policies",
+	RulePolicyElement:                  "API Management policy documents should only use known policies and include fragments of their component",
+	RuleComponentEnvConfig:             "Environment config keys of components must have a valid name and type, and no default when required",
+	RuleEnvConfig:                      "Environment configs must set the required keys of their components with values of the right type",
+	RuleEnvConfigUnknown:               "Environment configs should only set keys of the schema of their components",
+	RuleUnresolvedVariable:             "Required variables of the generated modules should get a value from the inputs of every instance",
+	RuleProjectNameRequired:            "The project name must be set",
+	RuleSubscriptionsRequired:          "At least one subscription must be defined",
+	RuleRemoteStateRequiredField:       "Remote state name and resource group must be set",
+	RuleSubscriptionCloud:              "Subscription clouds must be public, usgov or china",
+	RuleSubscriptionIDFormat:           "Subscription and tenant IDs must be GUIDs",
+	RuleEnvironmentsRequired:           "Each subscription must define at least one environment",
+	RuleEnvironmentNameRequired:        "Environment names must be set",
+	RuleEnvironmentApproval:            "Environment approvals must require no more approvers than listed and a non-negative timeout",
+	RuleEnvironmentSecrets:             "Environment secrets must be keyvault://, sops:// or env:// references keyed by <component>.<attribute>",
+	RuleRequiredTags:                   "Every environment must set the required_tags with its project, subscription or environment tags",
+	RuleTagName:                        "Tag names must be valid Azure tag names other than the tags tgs sets, and values at most 256 characters",
+	RulePrefixRegion:                   "Region prefixes must be configured for a valid Azure region",
+	RulePrefixFormat:                   "Region and environment prefixes must only contain letters and numbers",
+	RuleToolingVersion:                 "Pinned Terraform, Terragrunt and infracost versions must be exact semantic versions",
+	RuleToolingVersionFiles:            "tooling.version_files must be tfenv, asdf or none",
+	RuleSecurity:                       "Security scans must use tfsec, checkov or conftest once each and a valid severity",
+	RuleLayout:                         "layout must be folders or stacks",
+	RuleGenerationMode:                 "generation_mode must be compact or full",
+	RuleOutputDir:                      "output_dir must be a directory inside the project, outside .tgs",
+	RuleOwners:                         "Owners must be @users, @org/teams or emails of the stacks and environments of tgs.yaml",
+	RuleRootOptions:                    "Root options must be valid Terragrunt settings that don't overwrite generated files",
+	RuleRemoteStateOptions:             "State key prefixes must be valid paths, use_oidc requires a service connection and backups another container",
+	RuleRemoteStateSnapshot:            "Blob snapshots of the state are redundant with blob versioning",
+	RuleRemoteStateStorageName:         "State storage accounts must be 3-24 lowercase letters and numbers, and containers valid container names",
+	RuleRemoteStateAccountGeneric:      "State storage account names made of generic words are likely taken, names are globally unique",
+	RuleRemoteStateShared:              "Subscriptions sharing a state storage account and container must use distinct key prefixes",
+	RuleRemoteStateUnreachable:         "State resource groups, storage accounts and containers must exist and be readable with the current credentials",
+	RuleMirrorHTTPS:                    "The mirror must be served over HTTPS",
+	RuleMirrorPublicKey:                "The mirror public key must be set",
+	RuleDiagramServer:                  "The PlantUML server must be an HTTP or HTTPS URL",
+	RuleTemplateOverrideUnknown:        "Template overrides must replace a built-in template",
+	RuleSchema:                         "Config files must match the JSON Schema of tgs schema export",
+	RuleUnresolvedPlaceholder:          "${env:VAR} placeholders must reference a set environment variable or have a default",
+	RuleRulesConfig:                    "Rules in .tgs/validate.yaml must exist and use a valid severity",
+}
+
+// Severity levels of validation results
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// SeverityOff disables a rule in .tgs/validate.yaml
+const SeverityOff = "off"
+
+// defaultSeverities lists rules that aren't errors by default
+var defaultSeverities = map[string]string{
+	RuleStackDescription:            SeverityWarning,
+	RuleComponentDescription:        SeverityWarning,
+	RuleProviderRegistryUnavailable: SeverityWarning,
+	RuleRemoteStateSnapshot:         SeverityWarning,
+	RuleRemoteStateAccountGeneric:   SeverityWarning,
+	RuleRemoteStateShared:           SeverityWarning,
+	RulePolicyElement:               SeverityWarning,
+	RuleEnvConfigUnknown:            SeverityWarning,
+	RuleUnresolvedVariable:          SeverityWarning,
+}
+
+// applyRules sets the severity of every finding from the rule defaults and
+// .tgs/validate.yaml, dropping findings of rules that are turned off
+func applyRules(errs []error) []error {
+	overrides := map[string]string{}
+	if cfg, err := config.ReadValidateConfig(); err == nil {
+		overrides = cfg.Rules
+	}
+
+	var result []error
+	for _, err := range errs {
+		var validationErr ValidationError
+		if !errors.As(err, &validationErr) {
+			result = append(result, err)
+			continue
+		}
+
+		severity := SeverityError
+		if s, ok := defaultSeverities[validationErr.Rule]; ok {
+			severity = s
+		}
+		// The rules file can't silence its own errors
+		if s, ok := overrides[validationErr.Rule]; ok && validSeverity(s) && validationErr.Rule != RuleRulesConfig {
+			severity = s
+		}
+
+		if severity == SeverityOff {
+			continue
+		}
+		validationErr.Severity = severity
+		result = append(result, validationErr)
+	}
+
+	return result
+}
+
+// validateRulesConfig checks .tgs/validate.yaml for unknown rules and
+// invalid severities
+func validateRulesConfig() []error {
+	var errs []error
+
+	cfg, err := config.ReadValidateConfig()
+	if err != nil {
+		return append(errs, ValidationError{
+			Context: "Rules file",
+			Message: err.Error(),
+			Rule:    RuleRulesConfig,
+			File:    ".tgs/validate.yaml",
+		})
+	}
+
+	var rules []string
+	for rule := range cfg.Rules {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+
+	for _, rule := range rules {
+		if _, ok := RuleDescriptions[rule]; !ok {
+			errs = append(errs, ValidationError{
+				Context: fmt.Sprintf("Rule '%s'", rule),
+				Message: "unknown rule",
+				Rule:    RuleRulesConfig,
+				File:    ".tgs/validate.yaml",
+			})
+		} else if !validSeverity(cfg.Rules[rule]) {
+			errs = append(errs, ValidationError{
+				Context: fmt.Sprintf("Rule '%s'", rule),
+				Message: fmt.Sprintf("invalid severity %q (use error, warning, info or off)", cfg.Rules[rule]),
+				Rule:    RuleRulesConfig,
+				File:    ".tgs/validate.yaml",
+			})
+		}
+	}
+
+	return errs
+}
+
+func validSeverity(severity string) bool {
+	switch severity {
+	case SeverityError, SeverityWarning, SeverityInfo, SeverityOff:
+		return true
+	}
+	return false
+}
+
+// SeverityOf returns the severity of a finding, defaulting to error
+func SeverityOf(err error) string {
+	var validationErr ValidationError
+	if errors.As(err, &validationErr) && validationErr.Severity != "" {
+		return validationErr.Severity
+	}
+	return SeverityError
+}
+
+// Errors returns the findings with error severity
+func Errors(errs []error) []error {
+	var result []error
+	for _, err := range errs {
+		if SeverityOf(err) == SeverityError {
+			result = append(result, err)
+		}
+	}
+	return result
+}
+
+// Warnings returns the findings with warning or info severity
+func Warnings(errs []error) []error {
+	var result []error
+	for _, err := range errs {
+		if SeverityOf(err) != SeverityError {
+			result = append(result, err)
+		}
+	}
+	return result
+}
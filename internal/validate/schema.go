@@ -0,0 +1,40 @@
+package validate
+
+import (
+	"fmt"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/schema"
+)
+
+// ValidateSchema checks a config file against its JSON Schema, catching
+// misspelled keys and values of the wrong type that parsing ignores
+func ValidateSchema(file string, s *schema.Schema) []error {
+	var errors []error
+
+	data, err := project.ReadFile(file)
+	if err != nil {
+		return append(errors, fmt.Errorf("failed to read %s: %w", file, err))
+	}
+	problems, err := schema.Check(data, s)
+	if err != nil {
+		return append(errors, fmt.Errorf("failed to check %s against its schema: %w", file, err))
+	}
+
+	for _, problem := range problems {
+		context := problem.Path
+		if context == "" {
+			context = "Document"
+		}
+		context = fmt.Sprintf("%s (line %d)", context, problem.Line)
+		errors = append(errors, ValidationError{
+			Context: context,
+			Message: problem.Message,
+			Rule:    RuleSchema,
+			File:    file,
+			Line:    problem.Line,
+		})
+	}
+
+	return applyRules(errors)
+}
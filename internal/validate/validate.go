@@ -1,44 +1,25 @@
 package validate
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
+	"github.com/davoodharun/terragrunt-scaffolder/internal/azure"
 	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/graph"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/naming"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/registry"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/templates"
 )
 
-// ValidAzureRegions is a map of valid Azure regions
-var ValidAzureRegions = map[string]bool{
-	"eastus":             true,
-	"eastus2":            true,
-	"westus":             true,
-	"westus2":            true,
-	"centralus":          true,
-	"northeurope":        true,
-	"westeurope":         true,
-	"southeastasia":      true,
-	"eastasia":           true,
-	"japaneast":          true,
-	"japanwest":          true,
-	"australiaeast":      true,
-	"australiasoutheast": true,
-	"southindia":         true,
-	"centralindia":       true,
-	"westindia":          true,
-	"canadacentral":      true,
-	"canadaeast":         true,
-	"uksouth":            true,
-	"ukwest":             true,
-	"francecentral":      true,
-	"francesouth":        true,
-	"germanywestcentral": true,
-	"norwayeast":         true,
-	"switzerlandnorth":   true,
-	"uaenorth":           true,
-	"brazilsouth":        true,
-	"southafricanorth":   true,
-}
-
 // ValidAzureResourceTypes is a map of valid Azure resource types
 var ValidAzureResourceTypes = map[string]bool{
 	"azurerm_service_plan":                          true,
@@ -82,12 +63,19 @@ var ValidAzureResourceTypes = map[string]bool{
 	"azurerm_cdn_frontdoor_origin":                  true,
 	"azurerm_cdn_frontdoor_route":                   true,
 	"azurerm_static_site":                           true,
+	"azurerm_traffic_manager_profile":               true,
+	"azurerm_traffic_manager_external_endpoint":     true,
 }
 
 // ValidationError represents a validation error with context
 type ValidationError struct {
-	Context string
-	Message string
+	Context  string
+	Message  string
+	Rule     string
+	File     string
+	Severity string
+	// Line is set when the finding knows its position in File
+	Line int
 }
 
 func (e ValidationError) Error() string {
@@ -106,6 +94,7 @@ func ValidateStack(stack *config.MainConfig) []error {
 		errors = append(errors, ValidationError{
 			Context: "Stack",
 			Message: "name property must be filled",
+			Rule:    RuleStackRequiredField,
 		})
 	}
 
@@ -114,6 +103,7 @@ func ValidateStack(stack *config.MainConfig) []error {
 		errors = append(errors, ValidationError{
 			Context: "Stack",
 			Message: "version property must be filled",
+			Rule:    RuleStackRequiredField,
 		})
 	}
 
@@ -122,6 +112,7 @@ func ValidateStack(stack *config.MainConfig) []error {
 		errors = append(errors, ValidationError{
 			Context: "Stack",
 			Message: "description property must be filled",
+			Rule:    RuleStackDescription,
 		})
 	}
 
@@ -130,6 +121,7 @@ func ValidateStack(stack *config.MainConfig) []error {
 		errors = append(errors, ValidationError{
 			Context: "Stack",
 			Message: "at least one component must be defined",
+			Rule:    RuleStackComponentsRequired,
 		})
 	}
 
@@ -144,94 +136,126 @@ func ValidateStack(stack *config.MainConfig) []error {
 		errors = append(errors, ValidationError{
 			Context: "Architecture",
 			Message: "at least one region must be defined",
+			Rule:    RuleArchitectureRegionsRequired,
 		})
 	}
 
+	// Validate architecture regions against the region catalog
+	errors = append(errors, validateArchitectureRegions(stack)...)
+	errors = append(errors, validatePairedRegions(stack)...)
+
 	// Validate component references in architecture
 	errors = append(errors, validateArchitectureComponents(stack)...)
 
 	// Validate dependencies
 	errors = append(errors, validateDependencies(stack)...)
 
-	return errors
-}
+	// Validate external dependencies
+	errors = append(errors, validateExternalDependencies(stack)...)
 
-// validateComponent validates a single component configuration
-func validateComponent(name string, comp config.Component) []error {
-	var errors []error
+	// Validate inputs reference dependencies of their component
+	errors = append(errors, validateInputs(stack)...)
+	errors = append(errors, validateDataSources(stack)...)
+	errors = append(errors, validateInstances(stack)...)
 
-	// Validate required fields
-	if comp.Source == "" {
-		errors = append(errors, ValidationError{
-			Context: fmt.Sprintf("Component '%s'", name),
-			Message: "source property must be filled",
-		})
-	}
+	// Validate deployment slots of components and apps
+	errors = append(errors, validateSlots(stack)...)
 
-	if comp.Provider == "" {
-		errors = append(errors, ValidationError{
-			Context: fmt.Sprintf("Component '%s'", name),
-			Message: "provider property must be filled",
-		})
-	}
+	// Validate the observability workspace
+	errors = append(errors, validateObservability(stack)...)
 
-	if comp.Version == "" {
-		errors = append(errors, ValidationError{
-			Context: fmt.Sprintf("Component '%s'", name),
-			Message: "version property must be filled",
-		})
-	}
+	// Validate the origins of routing components
+	errors = append(errors, validateRouting(stack)...)
 
-	if comp.Description == "" {
-		errors = append(errors, ValidationError{
-			Context: fmt.Sprintf("Component '%s'", name),
-			Message: "description property must be filled",
-		})
-	}
+	// Validate secret app settings and their Key Vaults
+	errors = append(errors, validateAppSecrets(stack)...)
 
-	// Validate source is a valid Azure resource type
-	if comp.Source != "" && !ValidAzureResourceTypes[comp.Source] {
-		errors = append(errors, ValidationError{
-			Context: fmt.Sprintf("Component '%s'", name),
-			Message: fmt.Sprintf("invalid Azure resource type: %s", comp.Source),
-		})
-	}
+	// Validate API Management policy fragments and operation policies
+	errors = append(errors, validatePolicies(stack)...)
 
-	// Validate dependencies format
-	for _, dep := range comp.Deps {
-		parts := strings.Split(dep, ".")
-		if len(parts) < 2 {
+	// Validate the keys components add to their environment config schema
+	errors = append(errors, validateEnvConfigFields(stack)...)
+
+	// Validate state key prefixes of components
+	for compName, comp := range stack.Stack.Components {
+		if comp.StateKeyPrefix != "" && !stateKeyPrefixPattern.MatchString(comp.StateKeyPrefix) {
 			errors = append(errors, ValidationError{
-				Context: fmt.Sprintf("Component '%s'", name),
-				Message: fmt.Sprintf("invalid dependency format: %s (should be 'region.component' or 'region.component.app')", dep),
+				Context: fmt.Sprintf("Component '%s'", compName),
+				Message: fmt.Sprintf("state_key_prefix %q must be path segments of letters, digits, '.', '_' and '-' separated by '/'", comp.StateKeyPrefix),
+				Rule:    RuleRemoteStateOptions,
 			})
-			continue
 		}
-
-		// Check if the region part is valid (could be a placeholder {region})
-		if parts[0] != "{region}" && !ValidAzureRegions[parts[0]] {
+		if !validGenerationMode(comp.GenerationMode) {
 			errors = append(errors, ValidationError{
-				Context: fmt.Sprintf("Component '%s'", name),
-				Message: fmt.Sprintf("invalid region in dependency: %s", parts[0]),
+				Context: fmt.Sprintf("Component '%s'", compName),
+				Message: fmt.Sprintf("unsupported generation_mode %q: must be compact or full", comp.GenerationMode),
+				Rule:    RuleGenerationMode,
 			})
 		}
 	}
 
-	return errors
+	// Validate the dependency graph is acyclic
+	errors = append(errors, validateDependencyCycles(stack)...)
+
+	// Validate migrations
+	errors = append(errors, validateMigrations(stack)...)
+
+	// Validate environment variable placeholders were expanded
+	errors = append(errors, validateUnresolved(stack.Unresolved)...)
+
+	return applyRules(errors)
 }
 
-// validateArchitectureComponents validates component references in the architecture
-func validateArchitectureComponents(stack *config.MainConfig) []error {
+// validateMigrations validates the migrations of a stack reference versions
+// up to the stack version and components of the stack
+func validateMigrations(stack *config.MainConfig) []error {
 	var errors []error
+	fail := func(version, message string) {
+		errors = append(errors, ValidationError{
+			Context: fmt.Sprintf("Migration '%s'", version),
+			Message: message,
+			Rule:    RuleStackMigration,
+		})
+	}
 
-	for region, components := range stack.Stack.Architecture.Regions {
-		for _, comp := range components {
-			// Check if component exists in components section
-			if _, exists := stack.Stack.Components[comp.Component]; !exists {
-				errors = append(errors, ValidationError{
-					Context: fmt.Sprintf("Region '%s'", region),
-					Message: fmt.Sprintf("component '%s' referenced in architecture but not defined in components section", comp.Component),
-				})
+	for _, migration := range stack.Stack.Migrations {
+		if !semverPattern.MatchString(migration.Version) {
+			fail(migration.Version, "version must be a semantic version (e.g. 2.0.0)")
+		} else if semverPattern.MatchString(stack.Stack.Version) && config.CompareVersions(migration.Version, stack.Stack.Version) > 0 {
+			fail(migration.Version, fmt.Sprintf("version is newer than the stack version %s", stack.Stack.Version))
+		}
+
+		var renames []string
+		for from := range migration.Renames {
+			renames = append(renames, from)
+		}
+		sort.Strings(renames)
+		for _, from := range renames {
+			if _, ok := stack.Stack.Components[migration.Renames[from]]; !ok {
+				fail(migration.Version, fmt.Sprintf("rename of %s targets undefined component %s", from, migration.Renames[from]))
+			}
+		}
+
+		for _, move := range migration.Moves {
+			for _, ref := range []string{move.From, move.To} {
+				parts := strings.Split(ref, ".")
+				if len(parts) < 2 || len(parts) > 3 || strings.Contains(ref, "{") {
+					fail(migration.Version, fmt.Sprintf("move %s must be in region.component[.app] format", ref))
+				}
+			}
+			if parts := strings.Split(move.To, "."); len(parts) >= 2 {
+				if _, ok := stack.Stack.Components[parts[1]]; !ok {
+					fail(migration.Version, fmt.Sprintf("move to %s targets undefined component %s", move.To, parts[1]))
+				}
+			}
+		}
+
+		for _, stateMove := range migration.StateMoves {
+			if _, ok := stack.Stack.Components[stateMove.Component]; !ok {
+				fail(migration.Version, fmt.Sprintf("state move targets undefined component %s", stateMove.Component))
+			}
+			if stateMove.From == "" || stateMove.To == "" {
+				fail(migration.Version, "state moves must set from and to")
 			}
 		}
 	}
@@ -239,107 +263,200 @@ func validateArchitectureComponents(stack *config.MainConfig) []error {
 	return errors
 }
 
-// validateDependencies validates component dependencies
-func validateDependencies(stack *config.MainConfig) []error {
+// semverPattern matches exact semantic versions like 4.22.0 or 1.0.0-beta1
+var semverPattern = regexp.MustCompile(`^(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(-[0-9A-Za-z.-]+)?$`)
+
+// ValidateProviderVersions checks that every component's provider/version
+// pair is published in the Terraform Registry. In offline mode only cached
+// registry responses are used.
+func ValidateProviderVersions(stack *config.MainConfig, offline bool) []error {
 	var errors []error
 
-	// First, build a map of components that are actually used in the architecture
-	usedComponents := make(map[string]bool)
-	for _, components := range stack.Stack.Architecture.Regions {
-		for _, comp := range components {
-			usedComponents[comp.Component] = true
-		}
+	var names []string
+	for name := range stack.Stack.Components {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	for compName, comp := range stack.Stack.Components {
-		for _, dep := range comp.Deps {
-			// Parse dependency string
-			parts := strings.Split(dep, ".")
-			if len(parts) < 2 {
+	published := make(map[string]map[string]bool)
+	unavailable := make(map[string]error)
+
+	for _, name := range names {
+		comp := stack.Stack.Components[name]
+
+		// Check azurerm and every additional provider of the component
+		requirements := []config.ProviderRequirement{{Name: comp.Provider, Source: comp.Provider, Version: comp.Version}}
+		requirements = append(requirements, comp.Providers...)
+
+		for _, req := range requirements {
+			source := req.SourceAddress()
+			if req.Name == "" || !semverPattern.MatchString(req.Version) {
+				continue
+			}
+
+			if _, done := published[source]; !done && unavailable[source] == nil {
+				versions, err := registry.Versions(source, offline)
+				if err != nil {
+					unavailable[source] = err
+					if !isNotFound(err) {
+						errors = append(errors, ValidationError{
+							Context: fmt.Sprintf("Provider '%s'", source),
+							Message: fmt.Sprintf("could not verify versions: %v", err),
+							Rule:    RuleProviderRegistryUnavailable,
+						})
+					}
+				} else {
+					published[source] = make(map[string]bool)
+					for _, v := range versions {
+						published[source][v] = true
+					}
+				}
+			}
+
+			// A provider the registry doesn't publish fails every component using it
+			if err := unavailable[source]; isNotFound(err) {
 				errors = append(errors, ValidationError{
-					Context: fmt.Sprintf("Component '%s'", compName),
-					Message: fmt.Sprintf("invalid dependency format: %s", dep),
+					Context: fmt.Sprintf("Component '%s'", name),
+					Message: err.Error(),
+					Rule:    RuleProviderVersion,
 				})
 				continue
 			}
 
-			// Get the component name from the dependency
-			depComponent := parts[1]
+			if versions, ok := published[source]; ok && !versions[req.Version] {
+				namespace, providerName := registry.ProviderAddress(source)
+				errors = append(errors, ValidationError{
+					Context: fmt.Sprintf("Component '%s'", name),
+					Message: fmt.Sprintf("version %s of provider %s/%s does not exist in the Terraform Registry", req.Version, namespace, providerName),
+					Rule:    RuleProviderVersion,
+				})
+			}
+		}
+	}
 
-			// Check if the component exists in the components section
-			if _, exists := stack.Stack.Components[depComponent]; !exists {
+	return applyRules(errors)
+}
+
+// isNotFound reports whether a registry lookup failed because the provider
+// isn't published
+func isNotFound(err error) bool {
+	var notFound *registry.NotFoundError
+	return errors.As(err, &notFound)
+}
+
+// validateDependencyCycles builds the dependency graph and reports the full
+// path of the first cycle found
+func validateDependencyCycles(stack *config.MainConfig) []error {
+	g := graph.Build(stack)
+
+	cycle := g.FindCycle()
+	if cycle == nil {
+		return nil
+	}
+
+	return []error{ValidationError{
+		Context: fmt.Sprintf("Component '%s'", g.Nodes[cycle[0]].Component),
+		Message: (&graph.CycleError{Path: cycle}).Error(),
+		Rule:    RuleDependencyCycle,
+	}}
+}
+
+// validateExternalDependencies validates the stack's external dependencies
+// and the components referencing them
+func validateExternalDependencies(stack *config.MainConfig) []error {
+	var errors []error
+
+	for name, ext := range stack.Stack.ExternalDependencies {
+		context := fmt.Sprintf("External dependency '%s'", name)
+
+		if _, exists := stack.Stack.Components[name]; exists {
+			errors = append(errors, ValidationError{
+				Context: context,
+				Message: "name conflicts with a component of the same name",
+				Rule:    RuleExternalDependencyConflict,
+			})
+		}
+
+		if (ext.ConfigPath == "") == (ext.RemoteState == nil) {
+			errors = append(errors, ValidationError{
+				Context: context,
+				Message: "exactly one of config_path or remote_state must be set",
+				Rule:    RuleExternalDependencySource,
+			})
+			continue
+		}
+
+		if rs := ext.RemoteState; rs != nil {
+			if rs.ResourceGroup == "" || rs.StorageAccount == "" || rs.Container == "" || rs.Key == "" {
 				errors = append(errors, ValidationError{
-					Context: fmt.Sprintf("Component '%s'", compName),
-					Message: fmt.Sprintf("dependency references non-existent component '%s'", depComponent),
+					Context: context,
+					Message: "remote_state requires resource_group, storage_account, container and key",
+					Rule:    RuleExternalDependencyRemoteState,
 				})
-				continue
 			}
+		}
+	}
 
-			// Check if the component is actually used in the architecture
-			if !usedComponents[depComponent] {
+	for compName, comp := range stack.Stack.Components {
+		for _, name := range comp.ExternalDeps {
+			if _, exists := stack.Stack.ExternalDependencies[name]; !exists {
 				errors = append(errors, ValidationError{
 					Context: fmt.Sprintf("Component '%s'", compName),
-					Message: fmt.Sprintf("dependency references component '%s' which is defined but not used in the architecture", depComponent),
+					Message: fmt.Sprintf("external dependency '%s' is not defined in external_dependencies", name),
+					Rule:    RuleExternalDependencyUndefined,
 				})
-				continue
 			}
+		}
+	}
 
-			// If using concrete region (not {region}), validate it exists
-			region := parts[0]
-			if !strings.Contains(region, "{region}") {
-				if _, exists := stack.Stack.Architecture.Regions[region]; !exists {
+	return errors
+}
+
+// validateInputs checks that the {dep:name.output} placeholders of component
+// inputs name a dependency block of the component and an output it exports
+func validateInputs(stack *config.MainConfig) []error {
+	var errors []error
+
+	for compName, comp := range stack.Stack.Components {
+		if len(comp.Inputs) == 0 {
+			continue
+		}
+
+		// Dependency block names mapped to the component they reference, or
+		// empty for external dependencies whose outputs are unknown
+		targets := make(map[string]string)
+		for i, name := range config.DependencyNames(comp.Deps) {
+			if parts := strings.Split(comp.Deps[i], "."); len(parts) >= 2 {
+				targets[name] = parts[1]
+			}
+		}
+		for _, name := range comp.ExternalDeps {
+			if ext, ok := stack.Stack.ExternalDependencies[name]; ok && ext.RemoteState == nil {
+				targets[name] = ""
+			}
+		}
+
+		var inputs []string
+		for input := range comp.Inputs {
+			inputs = append(inputs, input)
+		}
+		sort.Strings(inputs)
+		for _, input := range inputs {
+			for _, ref := range config.DependencyReferences(comp.Inputs[input]) {
+				target, ok := targets[ref.Name]
+				if !ok {
 					errors = append(errors, ValidationError{
 						Context: fmt.Sprintf("Component '%s'", compName),
-						Message: fmt.Sprintf("dependency references non-existent region: %s", region),
+						Message: fmt.Sprintf("input %s references %s, which is not a dependency of the component", input, ref.Name),
+						Rule:    RuleComponentInputs,
 					})
-				}
-			}
-
-			// If app is specified, validate it exists in the architecture
-			if len(parts) > 2 {
-				app := parts[2]
-				// Skip validation if using {app} template
-				if app == "{app}" {
 					continue
 				}
-
-				// For concrete apps, verify they exist in the architecture
-				found := false
-				// If using {region}, check all regions
-				if region == "{region}" {
-					for _, regionComps := range stack.Stack.Architecture.Regions {
-						for _, rc := range regionComps {
-							if rc.Component == depComponent {
-								for _, a := range rc.Apps {
-									if a == app {
-										found = true
-										break
-									}
-								}
-							}
-						}
-						if found {
-							break
-						}
-					}
-				} else if regionComps, exists := stack.Stack.Architecture.Regions[region]; exists {
-					// For concrete region, check only that region
-					for _, rc := range regionComps {
-						if rc.Component == depComponent {
-							for _, a := range rc.Apps {
-								if a == app {
-									found = true
-									break
-								}
-							}
-						}
-					}
-				}
-
-				if !found {
+				if dep, ok := stack.Stack.Components[target]; ok && !exportsOutput(dep, strings.Split(ref.Output, ".")[0]) {
 					errors = append(errors, ValidationError{
 						Context: fmt.Sprintf("Component '%s'", compName),
-						Message: fmt.Sprintf("dependency references non-existent app '%s' for component '%s'", app, depComponent),
+						Message: fmt.Sprintf("input %s references output %s, which %s doesn't export (add it to its outputs)", input, ref.Output, target),
+						Rule:    RuleComponentInputs,
 					})
 				}
 			}
@@ -349,61 +466,1684 @@ func validateDependencies(stack *config.MainConfig) []error {
 	return errors
 }
 
-// ValidateTGSConfig validates the TGS configuration file according to Testing-Framework.md specifications
-func ValidateTGSConfig(cfg *config.TGSConfig) []error {
-	var errors []error
+// dataSourceTypePattern matches data source types, e.g. azurerm_key_vault
+var dataSourceTypePattern = regexp.MustCompile(`^[a-z][a-z0-9]*_[a-z0-9_]+$`)
 
-	// Validate project name
-	if cfg.Name == "" {
-		errors = append(errors, ValidationError{
-			Context: "Project Name",
-			Message: "name property must be filled",
-		})
-	}
+// validateDataSources checks the data sources of components and the
+// {data:name.attribute} inputs reading them
+func validateDataSources(stack *config.MainConfig) []error {
+	var errors []error
 
-	// Validate subscriptions
-	if len(cfg.Subscriptions) == 0 {
-		errors = append(errors, ValidationError{
-			Context: "Subscriptions",
-			Message: "at least one subscription must be defined",
-		})
+	var compNames []string
+	for name := range stack.Stack.Components {
+		compNames = append(compNames, name)
 	}
+	sort.Strings(compNames)
 
-	// Validate each subscription
-	for subName, sub := range cfg.Subscriptions {
-		// Validate remote state
-		if sub.RemoteState.Name == "" {
-			errors = append(errors, ValidationError{
-				Context: fmt.Sprintf("Subscription '%s'", subName),
-				Message: "remotestate.name property must be filled",
-			})
-		}
-
-		if sub.RemoteState.ResourceGroup == "" {
-			errors = append(errors, ValidationError{
-				Context: fmt.Sprintf("Subscription '%s'", subName),
-				Message: "remotestate.resource_group property must be filled",
-			})
-		}
+	for _, compName := range compNames {
+		comp := stack.Stack.Components[compName]
+		context := fmt.Sprintf("Component '%s'", compName)
 
-		// Validate environments
-		if len(sub.Environments) == 0 {
-			errors = append(errors, ValidationError{
-				Context: fmt.Sprintf("Subscription '%s'", subName),
-				Message: "at least one environment must be defined",
-			})
+		var names []string
+		for name := range comp.DataSources {
+			names = append(names, name)
 		}
-
-		// Validate each environment
-		for i, env := range sub.Environments {
-			if env.Name == "" {
+		sort.Strings(names)
+		for _, name := range names {
+			source := comp.DataSources[name]
+			if !envConfigKeyPattern.MatchString(name) {
 				errors = append(errors, ValidationError{
-					Context: fmt.Sprintf("Subscription '%s' Environment %d", subName, i+1),
-					Message: "environment name must be filled",
+					Context: context,
+					Message: fmt.Sprintf("data source name %q must be an identifier of letters, digits and '_'", name),
+					Rule:    RuleComponentDataSources,
 				})
 			}
+			if !dataSourceTypePattern.MatchString(source.Type) {
+				errors = append(errors, ValidationError{
+					Context: context,
+					Message: fmt.Sprintf("data source %s has type %q, must be a provider data source such as azurerm_key_vault", name, source.Type),
+					Rule:    RuleComponentDataSources,
+				})
+			}
+			for arg := range source.Arguments {
+				if !envConfigKeyPattern.MatchString(arg) {
+					errors = append(errors, ValidationError{
+						Context: context,
+						Message: fmt.Sprintf("data source %s has argument %q, which is not an identifier", name, arg),
+						Rule:    RuleComponentDataSources,
+					})
+				}
+			}
+		}
+
+		var inputs []string
+		for input := range comp.Inputs {
+			inputs = append(inputs, input)
+		}
+		sort.Strings(inputs)
+		for _, input := range inputs {
+			value := comp.Inputs[input]
+			ref, ok := config.ParseDataReference(value)
+			_, declared := comp.DataSources[ref.Name]
+			switch {
+			case !ok && strings.Contains(value, "{data:"):
+				errors = append(errors, ValidationError{
+					Context: context,
+					Message: fmt.Sprintf("input %s must be a single {data:name.attribute} placeholder to read a data source", input),
+					Rule:    RuleComponentDataSources,
+				})
+			case ok && !declared:
+				errors = append(errors, ValidationError{
+					Context: context,
+					Message: fmt.Sprintf("input %s references data source %s, which the component doesn't declare in data_sources", input, ref.Name),
+					Rule:    RuleComponentDataSources,
+				})
+			}
+		}
+	}
+
+	return errors
+}
+
+// instancePattern matches the names of instances, appended to resource names
+var instancePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// validateInstances checks the instances of components. The features
+// referencing the single resource of a component don't support them.
+func validateInstances(stack *config.MainConfig) []error {
+	var errors []error
+
+	var compNames []string
+	for name, comp := range stack.Stack.Components {
+		if len(comp.Instances) > 0 {
+			compNames = append(compNames, name)
+		}
+	}
+	sort.Strings(compNames)
+
+	for _, compName := range compNames {
+		comp := stack.Stack.Components[compName]
+		context := fmt.Sprintf("Component '%s'", compName)
+
+		var names []string
+		for name := range comp.Instances {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !instancePattern.MatchString(name) {
+				errors = append(errors, ValidationError{
+					Context: context,
+					Message: fmt.Sprintf("instance name %q must be lowercase letters, digits and '-'", name),
+					Rule:    RuleComponentInstances,
+				})
+			}
+			var inputs []string
+			for input := range comp.Instances[name] {
+				inputs = append(inputs, input)
+			}
+			sort.Strings(inputs)
+			for _, input := range inputs {
+				if !envConfigKeyPattern.MatchString(input) {
+					errors = append(errors, ValidationError{
+						Context: context,
+						Message: fmt.Sprintf("instance %s has input %q, which is not an identifier", name, input),
+						Rule:    RuleComponentInstances,
+					})
+				}
+			}
+		}
+
+		var unsupported []string
+		if len(comp.Slots) > 0 {
+			unsupported = append(unsupported, "slots")
+		}
+		if comp.PolicyFiles {
+			unsupported = append(unsupported, "policy_files")
+		}
+		if comp.KeyVaultSecrets {
+			unsupported = append(unsupported, "secret app settings")
+		}
+		if len(unsupported) > 0 {
+			errors = append(errors, ValidationError{
+				Context: context,
+				Message: fmt.Sprintf("instances can't be combined with %s, which apply to a single resource", strings.Join(unsupported, ", ")),
+				Rule:    RuleComponentInstances,
+			})
+		}
+	}
+
+	return errors
+}
+
+// exportsOutput reports whether the outputs.tf generated for a component has
+// an output, assuming it does when all computed attributes are exported
+func exportsOutput(comp config.Component, output string) bool {
+	if comp.Outputs.All || output == "id" || output == "name" {
+		return true
+	}
+	if _, _, ok := comp.SlotResource(); ok && len(comp.Slots) > 0 && (output == "slot_ids" || output == "slot_hostnames") {
+		return true
+	}
+	for _, resourceType := range append([]string{comp.Source}, comp.AdditionalResources...) {
+		if output == resourceType+"_id" || output == resourceType+"_name" {
+			return true
+		}
+	}
+	for _, name := range comp.Outputs.Names {
+		if output == strings.ReplaceAll(name, ".", "_") {
+			return true
+		}
+	}
+	return false
+}
+
+// validateObservability checks that an enabled observability block targets a
+// Log Analytics workspace component and excludes components of the stack
+func validateObservability(stack *config.MainConfig) []error {
+	obs := stack.Stack.Observability
+	if obs == nil || !obs.Enabled {
+		return nil
+	}
+
+	var errors []error
+	workspace := obs.WorkspaceComponent()
+	if workspace == "" {
+		return append(errors, ValidationError{
+			Context: "Observability",
+			Message: fmt.Sprintf("workspace %q must name the Log Analytics workspace component in dependency notation, e.g. {region}.loganalytics", obs.Workspace),
+			Rule:    RuleObservability,
+		})
+	}
+	if comp, ok := stack.Stack.Components[workspace]; !ok {
+		errors = append(errors, ValidationError{
+			Context: "Observability",
+			Message: fmt.Sprintf("workspace component %s is not defined", workspace),
+			Rule:    RuleObservability,
+		})
+	} else if comp.Source != "azurerm_log_analytics_workspace" {
+		errors = append(errors, ValidationError{
+			Context: "Observability",
+			Message: fmt.Sprintf("workspace component %s is a %s, not an azurerm_log_analytics_workspace", workspace, comp.Source),
+			Rule:    RuleObservability,
+		})
+	}
+	for _, name := range obs.Exclude {
+		if _, ok := stack.Stack.Components[name]; !ok {
+			errors = append(errors, ValidationError{
+				Context: "Observability",
+				Message: fmt.Sprintf("excluded component %s is not defined", name),
+				Rule:    RuleObservability,
+			})
+		}
+	}
+	return errors
+}
+
+// validateRouting checks that routing components route to another component
+// deployed to the architecture, only to apps it deploys, and that Traffic
+// Manager profiles, which have a single DNS name, route to a single app
+func validateRouting(stack *config.MainConfig) []error {
+	var errors []error
+
+	var names []string
+	for name, comp := range stack.Stack.Components {
+		if comp.Routing != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		comp := stack.Stack.Components[name]
+		routing := comp.Routing
+		context := fmt.Sprintf("Component '%s'", name)
+		if _, ok := stack.Stack.Components[routing.Origins]; !ok || routing.Origins == name {
+			errors = append(errors, ValidationError{
+				Context: context,
+				Message: fmt.Sprintf("routing origins %q must name another component of the stack", routing.Origins),
+				Rule:    RuleRouting,
+			})
+			continue
+		}
+
+		deployed := false
+		apps := make(map[string]bool)
+		for _, comps := range stack.Stack.Architecture.Regions {
+			for _, rc := range comps {
+				if rc.Component == routing.Origins {
+					deployed = true
+					for _, app := range rc.Apps {
+						apps[app] = true
+					}
+				}
+			}
+		}
+		if !deployed {
+			errors = append(errors, ValidationError{
+				Context: context,
+				Message: fmt.Sprintf("routing origins %s isn't deployed to any region", routing.Origins),
+				Rule:    RuleRouting,
+			})
+			continue
+		}
+		for _, app := range routing.Apps {
+			if !apps[app] {
+				errors = append(errors, ValidationError{
+					Context: context,
+					Message: fmt.Sprintf("routing app %s isn't an app of %s in any region", app, routing.Origins),
+					Rule:    RuleRouting,
+				})
+			}
+		}
+
+		endpoints := make(map[string]bool)
+		for _, origin := range comp.Origins {
+			endpoints[origin.Endpoint] = true
+		}
+		if comp.Source == "azurerm_traffic_manager_profile" && len(endpoints) > 1 {
+			errors = append(errors, ValidationError{
+				Context: context,
+				Message: fmt.Sprintf("a Traffic Manager profile routes a single app, not %d apps of %s, limit routing apps to one", len(endpoints), routing.Origins),
+				Rule:    RuleRouting,
+			})
+		}
+	}
+	return errors
+}
+
+// keyVaultSecretPattern matches Key Vault secret names
+var keyVaultSecretPattern = regexp.MustCompile(`^[A-Za-z0-9-]{1,127}$`)
+
+// validateAppSecrets checks that secret app settings belong to components
+// with app_settings and a Key Vault component, carry no value and have valid
+// secret names
+func validateAppSecrets(stack *config.MainConfig) []error {
+	var errors []error
+
+	for compName, comp := range stack.Stack.Components {
+		if comp.KeyVault == "" {
+			continue
+		}
+		context := fmt.Sprintf("Component '%s'", compName)
+		vault := comp.KeyVaultComponent()
+		if vault == "" {
+			errors = append(errors, ValidationError{
+				Context: context,
+				Message: fmt.Sprintf("key_vault %q must name the Key Vault component in dependency notation, e.g. {region}.keyvault", comp.KeyVault),
+				Rule:    RuleAppSettingsSecrets,
+			})
+		} else if vaultComp, ok := stack.Stack.Components[vault]; !ok {
+			errors = append(errors, ValidationError{
+				Context: context,
+				Message: fmt.Sprintf("key_vault component %s is not defined", vault),
+				Rule:    RuleAppSettingsSecrets,
+			})
+		} else if vaultComp.Source != "azurerm_key_vault" {
+			errors = append(errors, ValidationError{
+				Context: context,
+				Message: fmt.Sprintf("key_vault component %s is a %s, not an azurerm_key_vault", vault, vaultComp.Source),
+				Rule:    RuleAppSettingsSecrets,
+			})
+		}
+	}
+
+	for region, comps := range stack.Stack.Architecture.Regions {
+		for _, rc := range comps {
+			comp := stack.Stack.Components[rc.Component]
+			for _, appName := range rc.Apps {
+				app := rc.App(appName)
+				context := fmt.Sprintf("Region '%s' Component '%s' App '%s'", region, rc.Component, appName)
+				var names []string
+				for name, setting := range app.Settings {
+					if setting.Secret {
+						names = append(names, name)
+					}
+				}
+				sort.Strings(names)
+				if len(names) > 0 && (!comp.AppSettings || comp.KeyVault == "") {
+					errors = append(errors, ValidationError{
+						Context: context,
+						Message: fmt.Sprintf("secret settings %s need app_settings and key_vault on component %s", strings.Join(names, ", "), rc.Component),
+						Rule:    RuleAppSettingsSecrets,
+					})
+				}
+				for _, name := range names {
+					setting := app.Settings[name]
+					if setting.Value != "" {
+						errors = append(errors, ValidationError{
+							Context: context,
+							Message: fmt.Sprintf("secret setting %s must not set a value, it's read from the Key Vault", name),
+							Rule:    RuleAppSettingsSecrets,
+						})
+					}
+					if secretName := app.Settings.Secrets()[name]; !keyVaultSecretPattern.MatchString(secretName) {
+						errors = append(errors, ValidationError{
+							Context: context,
+							Message: fmt.Sprintf("secret name %q of setting %s must be 1 to 127 letters, digits and '-'", secretName, name),
+							Rule:    RuleAppSettingsSecrets,
+						})
+					}
+				}
+			}
+		}
+	}
+	return errors
+}
+
+// slotPattern matches deployment slot names
+var slotPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// validateSlots checks that slots are only set on components with a slot
+// resource, that their names are valid and that every instance has the slot
+// the pipelines swap
+func validateSlots(stack *config.MainConfig) []error {
+	var errors []error
+
+	for compName, comp := range stack.Stack.Components {
+		context := fmt.Sprintf("Component '%s'", compName)
+		if _, _, ok := comp.SlotResource(); !ok && (len(comp.Slots) > 0 || comp.SlotSwap != "") {
+			errors = append(errors, ValidationError{
+				Context: context,
+				Message: fmt.Sprintf("%s has no deployment slots, slots are supported on web and function apps", comp.Source),
+				Rule:    RuleComponentSlots,
+			})
+			continue
+		}
+		errors = append(errors, validateSlotNames(context, comp.Slots)...)
+		if comp.SlotSwap != "" && !contains(comp.Slots, comp.SlotSwap) {
+			errors = append(errors, ValidationError{
+				Context: context,
+				Message: fmt.Sprintf("slot_swap %s is not one of the slots of the component", comp.SlotSwap),
+				Rule:    RuleComponentSlots,
+			})
+		}
+	}
+
+	for _, region := range sortedRegions(stack) {
+		for _, rc := range stack.Stack.Architecture.Regions[region] {
+			comp, ok := stack.Stack.Components[rc.Component]
+			if !ok {
+				continue
+			}
+			for _, name := range rc.Apps {
+				app := rc.App(name)
+				if len(app.Slots) == 0 {
+					continue
+				}
+				context := fmt.Sprintf("App '%s' of %s in %s", name, rc.Component, region)
+				if len(comp.Slots) == 0 {
+					errors = append(errors, ValidationError{
+						Context: context,
+						Message: "app slots need the component to set slots, which generates the slot resources",
+						Rule:    RuleComponentSlots,
+					})
+					continue
+				}
+				errors = append(errors, validateSlotNames(context, app.Slots)...)
+				if comp.SlotSwap != "" && !contains(app.Slots, comp.SlotSwap) {
+					errors = append(errors, ValidationError{
+						Context: context,
+						Message: fmt.Sprintf("app slots don't include %s, the slot_swap of the component", comp.SlotSwap),
+						Rule:    RuleComponentSlots,
+					})
+				}
+			}
+		}
+	}
+
+	return errors
+}
+
+// validateSlotNames checks slot names are valid app name suffixes
+func validateSlotNames(context string, slots []string) []error {
+	var errors []error
+	for _, slot := range slots {
+		if !slotPattern.MatchString(slot) || slot == "production" {
+			errors = append(errors, ValidationError{
+				Context: context,
+				Message: fmt.Sprintf("invalid slot name %q: use lowercase letters, digits and hyphens, other than production", slot),
+				Rule:    RuleComponentSlots,
+			})
+		}
+	}
+	return errors
+}
+
+// validGenerationMode reports whether mode is a generation mode, or unset
+func validGenerationMode(mode string) bool {
+	return mode == "" || mode == config.GenerationModeCompact || mode == config.GenerationModeFull
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// validateComponent validates a single component configuration
+func validateComponent(name string, comp config.Component) []error {
+	var errors []error
+
+	// Validate required fields
+	if comp.Source == "" {
+		errors = append(errors, ValidationError{
+			Context: fmt.Sprintf("Component '%s'", name),
+			Message: "source property must be filled",
+			Rule:    RuleComponentRequiredField,
+		})
+	}
+
+	if comp.Provider == "" {
+		errors = append(errors, ValidationError{
+			Context: fmt.Sprintf("Component '%s'", name),
+			Message: "provider property must be filled",
+			Rule:    RuleComponentRequiredField,
+		})
+	}
+
+	if comp.Version == "" {
+		errors = append(errors, ValidationError{
+			Context: fmt.Sprintf("Component '%s'", name),
+			Message: "version property must be filled",
+			Rule:    RuleComponentRequiredField,
+		})
+	}
+
+	if comp.Description == "" {
+		errors = append(errors, ValidationError{
+			Context: fmt.Sprintf("Component '%s'", name),
+			Message: "description property must be filled",
+			Rule:    RuleComponentDescription,
+		})
+	}
+
+	// Validate version is an exact semantic version
+	if comp.Version != "" && !semverPattern.MatchString(comp.Version) {
+		errors = append(errors, ValidationError{
+			Context: fmt.Sprintf("Component '%s'", name),
+			Message: fmt.Sprintf("version %s is not a valid semantic version (e.g. 4.22.0)", comp.Version),
+			Rule:    RuleComponentVersionFormat,
+		})
+	}
+
+	// Validate additional provider requirements
+	seenProviders := make(map[string]bool)
+	for i, provider := range comp.Providers {
+		var problem string
+		switch {
+		case provider.Name == "":
+			problem = fmt.Sprintf("providers entry %d must set a name", i+1)
+		case provider.Name == "azurerm":
+			problem = "azurerm is always required and configured by provider and version, remove it from providers"
+		case seenProviders[provider.Name]:
+			problem = fmt.Sprintf("provider %s is listed more than once", provider.Name)
+		case provider.Version == "":
+			problem = fmt.Sprintf("provider %s must set a version", provider.Name)
+		case !semverPattern.MatchString(provider.Version):
+			problem = fmt.Sprintf("version %s of provider %s is not a valid semantic version (e.g. 3.1.0)", provider.Version, provider.Name)
+		case strings.Count(provider.SourceAddress(), "/") != 1:
+			problem = fmt.Sprintf("source %s of provider %s must be in namespace/name format", provider.Source, provider.Name)
+		}
+		seenProviders[provider.Name] = true
+
+		if problem != "" {
+			errors = append(errors, ValidationError{
+				Context: fmt.Sprintf("Component '%s'", name),
+				Message: problem,
+				Rule:    RuleComponentProviders,
+			})
+		}
+	}
+
+	// Validate source is a valid Azure resource type
+	if comp.Source != "" && !ValidAzureResourceTypes[comp.Source] {
+		errors = append(errors, ValidationError{
+			Context: fmt.Sprintf("Component '%s'", name),
+			Message: fmt.Sprintf("invalid Azure resource type: %s", comp.Source),
+			Rule:    RuleComponentSource,
+		})
+	}
+
+	// Validate dependencies format
+	for _, dep := range comp.Deps {
+		parts := strings.Split(dep, ".")
+		if len(parts) < 2 {
+			errors = append(errors, ValidationError{
+				Context: fmt.Sprintf("Component '%s'", name),
+				Message: fmt.Sprintf("invalid dependency format: %s (should be 'region.component' or 'region.component.app')", dep),
+				Rule:    RuleDependencyFormat,
+			})
+			continue
+		}
+
+		// Check if the region part is valid (could be a placeholder {region}
+		// or {paired_region})
+		if parts[0] != "{region}" && parts[0] != "{paired_region}" && !azure.IsRegion(parts[0]) {
+			errors = append(errors, ValidationError{
+				Context: fmt.Sprintf("Component '%s'", name),
+				Message: fmt.Sprintf("invalid region in dependency: %s", parts[0]),
+				Rule:    RuleDependencyRegion,
+			})
+		}
+	}
+
+	// Validate dependency options refer to declared dependencies
+	for dep := range comp.DependencyOptions {
+		declared := false
+		for _, d := range comp.Deps {
+			if d == dep {
+				declared = true
+				break
+			}
+		}
+		if !declared {
+			errors = append(errors, ValidationError{
+				Context: fmt.Sprintf("Component '%s'", name),
+				Message: fmt.Sprintf("dependency_options references undeclared dependency: %s", dep),
+				Rule:    RuleDependencyOptionsUndeclared,
+			})
+		}
+	}
+
+	return errors
+}
+
+// validateArchitectureRegions checks that every architecture region is in
+// the region catalog of a supported cloud
+func validateArchitectureRegions(stack *config.MainConfig) []error {
+	var errors []error
+
+	for _, region := range sortedRegions(stack) {
+		if !azure.IsRegion(region) {
+			errors = append(errors, ValidationError{
+				Context: fmt.Sprintf("Region '%s'", region),
+				Message: fmt.Sprintf("unknown Azure region: %s (run 'tgs regions refresh' if it was added recently)", region),
+				Rule:    RuleArchitectureRegionUnknown,
+			})
+		}
+	}
+
+	return errors
+}
+
+// validatePairedRegions checks that regions are paired with other known
+// regions, and that every region deploying a component with {paired_region}
+// dependencies is paired with a region deploying them
+func validatePairedRegions(stack *config.MainConfig) []error {
+	var errors []error
+	pairs := stack.Stack.Architecture.PairedRegions
+
+	var paired []string
+	for region := range pairs {
+		paired = append(paired, region)
+	}
+	sort.Strings(paired)
+	for _, region := range paired {
+		context := fmt.Sprintf("Region '%s'", region)
+		switch pair := pairs[region]; {
+		case !azure.IsRegion(region):
+			errors = append(errors, ValidationError{Context: context, Message: fmt.Sprintf("paired_regions pairs unknown Azure region %s", region), Rule: RulePairedRegion})
+		case pair == region:
+			errors = append(errors, ValidationError{Context: context, Message: "region can't be paired with itself", Rule: RulePairedRegion})
+		case !azure.IsRegion(pair):
+			errors = append(errors, ValidationError{Context: context, Message: fmt.Sprintf("paired region %s is not a known Azure region", pair), Rule: RulePairedRegion})
+		}
+	}
+
+	deployed := func(region, component string) bool {
+		for _, rc := range stack.Stack.Architecture.Regions[region] {
+			if rc.Component == component {
+				return true
+			}
+		}
+		return false
+	}
+	for _, region := range sortedRegions(stack) {
+		for _, rc := range stack.Stack.Architecture.Regions[region] {
+			for _, dep := range stack.Stack.Components[rc.Component].Deps {
+				parts := strings.Split(dep, ".")
+				if len(parts) < 2 || parts[0] != "{paired_region}" {
+					continue
+				}
+				context := fmt.Sprintf("Component '%s'", rc.Component)
+				if pair, ok := pairs[region]; !ok {
+					errors = append(errors, ValidationError{Context: context, Message: fmt.Sprintf("dependency %s needs a paired region for %s in paired_regions", dep, region), Rule: RulePairedRegion})
+				} else if !deployed(pair, parts[1]) {
+					errors = append(errors, ValidationError{Context: context, Message: fmt.Sprintf("dependency %s references %s, which paired region %s of %s doesn't deploy", dep, parts[1], pair, region), Rule: RulePairedRegion})
+				}
+			}
+		}
+	}
+	return errors
+}
+
+// ValidateStackRegions checks that a stack only deploys to regions available
+// in the cloud of every subscription using it, and to the regions allowed by
+// the regions allowlist of tgs.yaml if there is one
+func ValidateStackRegions(cfg *config.TGSConfig, stackName string, stack *config.MainConfig) []error {
+	var errors []error
+	regions := sortedRegions(stack)
+	// Paired regions are failed over to, so they must be usable as well
+	for _, pair := range stack.Stack.Architecture.PairedRegions {
+		if !contains(regions, pair) {
+			regions = append(regions, pair)
+		}
+	}
+	sort.Strings(regions)
+
+	var subs []string
+	for sub := range cfg.Subscriptions {
+		subs = append(subs, sub)
+	}
+	sort.Strings(subs)
+
+	for _, subName := range subs {
+		sub := cfg.Subscriptions[subName]
+
+		usesStack := false
+		for _, env := range sub.Environments {
+			if env.Stack == stackName || (env.Stack == "" && stackName == "main") {
+				usesStack = true
+			}
+		}
+		cloud, err := azure.CloudFor(sub.Cloud)
+		if !usesStack || err != nil {
+			continue
+		}
+
+		catalog := azure.Regions(cloud.Name)
+		for _, region := range regions {
+			if azure.IsRegion(region) && !catalog.Has(region) {
+				errors = append(errors, ValidationError{
+					Context: fmt.Sprintf("Region '%s'", region),
+					Message: fmt.Sprintf("region %s is not available in the %s cloud of subscription '%s'", region, cloud.Name, subName),
+					Rule:    RuleRegionCloud,
+				})
+			}
+		}
+	}
+
+	if len(cfg.Regions) > 0 {
+		allowed := make(map[string]bool)
+		for _, region := range cfg.Regions {
+			allowed[region] = true
+		}
+
+		for _, region := range regions {
+			if !allowed[region] {
+				errors = append(errors, ValidationError{
+					Context: fmt.Sprintf("Region '%s'", region),
+					Message: fmt.Sprintf("region %s is not in the regions allowlist of tgs.yaml (%s)", region, strings.Join(cfg.Regions, ", ")),
+					Rule:    RuleRegionNotAllowed,
+				})
+			}
+		}
+	}
+
+	return applyRules(errors)
+}
+
+// sortedRegions returns the architecture regions of a stack in order
+func sortedRegions(stack *config.MainConfig) []string {
+	var regions []string
+	for region := range stack.Stack.Architecture.Regions {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// validateArchitectureComponents validates component references in the architecture
+func validateArchitectureComponents(stack *config.MainConfig) []error {
+	var errors []error
+
+	for region, components := range stack.Stack.Architecture.Regions {
+		for _, comp := range components {
+			// Check if component exists in components section
+			if _, exists := stack.Stack.Components[comp.Component]; !exists {
+				errors = append(errors, ValidationError{
+					Context: fmt.Sprintf("Region '%s'", region),
+					Message: fmt.Sprintf("component '%s' referenced in architecture but not defined in components section", comp.Component),
+					Rule:    RuleArchitectureComponentUndefined,
+				})
+			}
+		}
+	}
+
+	return errors
+}
+
+// validateDependencies validates component dependencies
+func validateDependencies(stack *config.MainConfig) []error {
+	var errors []error
+
+	// First, build a map of components that are actually used in the architecture
+	usedComponents := make(map[string]bool)
+	for _, components := range stack.Stack.Architecture.Regions {
+		for _, comp := range components {
+			usedComponents[comp.Component] = true
+		}
+	}
+
+	for compName, comp := range stack.Stack.Components {
+		for _, dep := range comp.Deps {
+			// Parse dependency string
+			parts := strings.Split(dep, ".")
+			if len(parts) < 2 {
+				errors = append(errors, ValidationError{
+					Context: fmt.Sprintf("Component '%s'", compName),
+					Message: fmt.Sprintf("invalid dependency format: %s", dep),
+					Rule:    RuleDependencyFormat,
+				})
+				continue
+			}
+
+			// Get the component name from the dependency
+			depComponent := parts[1]
+
+			// Check if the component exists in the components section
+			if _, exists := stack.Stack.Components[depComponent]; !exists {
+				errors = append(errors, ValidationError{
+					Context: fmt.Sprintf("Component '%s'", compName),
+					Message: fmt.Sprintf("dependency references non-existent component '%s'", depComponent),
+					Rule:    RuleDependencyComponent,
+				})
+				continue
+			}
+
+			// Check if the component is actually used in the architecture
+			if !usedComponents[depComponent] {
+				errors = append(errors, ValidationError{
+					Context: fmt.Sprintf("Component '%s'", compName),
+					Message: fmt.Sprintf("dependency references component '%s' which is defined but not used in the architecture", depComponent),
+					Rule:    RuleDependencyUnusedComponent,
+				})
+				continue
+			}
+
+			// If using concrete region (not {region} or {paired_region}),
+			// validate it exists
+			region := parts[0]
+			if region != "{region}" && region != "{paired_region}" {
+				if _, exists := stack.Stack.Architecture.Regions[region]; !exists {
+					errors = append(errors, ValidationError{
+						Context: fmt.Sprintf("Component '%s'", compName),
+						Message: fmt.Sprintf("dependency references non-existent region: %s", region),
+						Rule:    RuleDependencyRegion,
+					})
+				}
+			}
+
+			// If app is specified, validate it exists in the architecture
+			if len(parts) > 2 {
+				app := parts[2]
+				// Skip validation if using {app} template
+				if app == "{app}" {
+					continue
+				}
+
+				// For concrete apps, verify they exist in the architecture
+				found := false
+				// If using {region} or {paired_region}, check all regions
+				if region == "{region}" || region == "{paired_region}" {
+					for _, regionComps := range stack.Stack.Architecture.Regions {
+						for _, rc := range regionComps {
+							if rc.Component == depComponent {
+								for _, a := range rc.Apps {
+									if a == app {
+										found = true
+										break
+									}
+								}
+							}
+						}
+						if found {
+							break
+						}
+					}
+				} else if regionComps, exists := stack.Stack.Architecture.Regions[region]; exists {
+					// For concrete region, check only that region
+					for _, rc := range regionComps {
+						if rc.Component == depComponent {
+							for _, a := range rc.Apps {
+								if a == app {
+									found = true
+									break
+								}
+							}
+						}
+					}
+				}
+
+				if !found {
+					errors = append(errors, ValidationError{
+						Context: fmt.Sprintf("Component '%s'", compName),
+						Message: fmt.Sprintf("dependency references non-existent app '%s' for component '%s'", app, depComponent),
+						Rule:    RuleDependencyApp,
+					})
+				}
+			}
+		}
+	}
+
+	return errors
+}
+
+// ValidateTGSConfig validates the TGS configuration file according to Testing-Framework.md specifications
+func ValidateTGSConfig(cfg *config.TGSConfig) []error {
+	var errors []error
+
+	// Validate project name
+	if cfg.Name == "" {
+		errors = append(errors, ValidationError{
+			Context: "Project Name",
+			Message: "name property must be filled",
+			Rule:    RuleProjectNameRequired,
+		})
+	}
+
+	// The remote state container is the lowercase project name
+	if container := strings.ToLower(cfg.Name); container != "" && !storageContainerPattern.MatchString(container) {
+		errors = append(errors, ValidationError{
+			Context: "Project Name",
+			Message: fmt.Sprintf("remote state container %s, named after the project, %s", container, containerNameRules),
+			Rule:    RuleRemoteStateStorageName,
+		})
+	}
+
+	// Validate subscriptions
+	if len(cfg.Subscriptions) == 0 {
+		errors = append(errors, ValidationError{
+			Context: "Subscriptions",
+			Message: "at least one subscription must be defined",
+			Rule:    RuleSubscriptionsRequired,
+		})
+	}
+
+	// Validate each subscription
+	for subName, sub := range cfg.Subscriptions {
+		// Validate remote state
+		if sub.RemoteState.Name == "" {
+			errors = append(errors, ValidationError{
+				Context: fmt.Sprintf("Subscription '%s'", subName),
+				Message: "remotestate.name property must be filled",
+				Rule:    RuleRemoteStateRequiredField,
+			})
+		}
+
+		if sub.RemoteState.ResourceGroup == "" {
+			errors = append(errors, ValidationError{
+				Context: fmt.Sprintf("Subscription '%s'", subName),
+				Message: "remotestate.resource_group property must be filled",
+				Rule:    RuleRemoteStateRequiredField,
+			})
+		}
+
+		// Validate backend options
+		errors = append(errors, validateRemoteState(cfg.Name, subName, sub)...)
+
+		// Validate subscription and tenant IDs
+		ids := []struct{ field, id string }{
+			{"subscription_id", sub.SubscriptionID},
+			{"tenant_id", sub.TenantID},
+		}
+		for _, id := range ids {
+			if id.id != "" && !guidPattern.MatchString(id.id) {
+				errors = append(errors, ValidationError{
+					Context: fmt.Sprintf("Subscription '%s'", subName),
+					Message: fmt.Sprintf("%s %s must be a GUID", id.field, id.id),
+					Rule:    RuleSubscriptionIDFormat,
+				})
+			}
+		}
+
+		// Validate cloud
+		if _, err := azure.CloudFor(sub.Cloud); err != nil {
+			errors = append(errors, ValidationError{
+				Context: fmt.Sprintf("Subscription '%s'", subName),
+				Message: err.Error(),
+				Rule:    RuleSubscriptionCloud,
+			})
+		}
+
+		// Validate environments
+		if len(sub.Environments) == 0 {
+			errors = append(errors, ValidationError{
+				Context: fmt.Sprintf("Subscription '%s'", subName),
+				Message: "at least one environment must be defined",
+				Rule:    RuleEnvironmentsRequired,
+			})
+		}
+
+		// Validate each environment
+		for i, env := range sub.Environments {
+			if env.Name == "" {
+				errors = append(errors, ValidationError{
+					Context: fmt.Sprintf("Subscription '%s' Environment %d", subName, i+1),
+					Message: "environment name must be filled",
+					Rule:    RuleEnvironmentNameRequired,
+				})
+			}
+
+			if approval := env.Approval; approval != nil {
+				if approval.MinApprovers < 0 || (len(approval.Approvers) > 0 && approval.MinApprovers > len(approval.Approvers)) {
+					errors = append(errors, ValidationError{
+						Context: fmt.Sprintf("Subscription '%s' Environment '%s'", subName, env.Name),
+						Message: fmt.Sprintf("approval.min_approvers %d must be between 0 and the number of approvers (%d)", approval.MinApprovers, len(approval.Approvers)),
+						Rule:    RuleEnvironmentApproval,
+					})
+				}
+				if approval.TimeoutMinutes < 0 {
+					errors = append(errors, ValidationError{
+						Context: fmt.Sprintf("Subscription '%s' Environment '%s'", subName, env.Name),
+						Message: "approval.timeout_minutes must not be negative",
+						Rule:    RuleEnvironmentApproval,
+					})
+				}
+			}
+
+			errors = append(errors, validateSecrets(fmt.Sprintf("Subscription '%s' Environment '%s'", subName, env.Name), env.Secrets)...)
+			errors = append(errors, validateTags(fmt.Sprintf("Subscription '%s' Environment '%s'", subName, env.Name), env.Tags)...)
+
+			// Validate the required tags are set on the environment
+			tags := cfg.EnvironmentTags(subName, env)
+			for _, tag := range cfg.RequiredTags {
+				if tags[tag] == "" && !contains(contextTags, tag) {
+					errors = append(errors, ValidationError{
+						Context: fmt.Sprintf("Subscription '%s' Environment '%s'", subName, env.Name),
+						Message: fmt.Sprintf("required tag %s isn't set by the project, subscription or environment tags", tag),
+						Rule:    RuleRequiredTags,
+					})
+				}
+			}
+		}
+
+		errors = append(errors, validateTags(fmt.Sprintf("Subscription '%s'", subName), sub.Tags)...)
+	}
+
+	// Validate the project tags
+	errors = append(errors, validateTags("Tags", cfg.Tags)...)
+
+	// Validate the regions allowlist against the region catalog
+	for _, region := range cfg.Regions {
+		if !azure.IsRegion(region) {
+			errors = append(errors, ValidationError{
+				Context: "Regions",
+				Message: fmt.Sprintf("unknown Azure region in allowlist: %s", region),
+				Rule:    RuleRegionsAllowlistUnknown,
+			})
+		}
+	}
+
+	// Validate prefix overrides
+	errors = append(errors, validatePrefixes(cfg.Prefixes)...)
+
+	// Validate pinned tool versions
+	errors = append(errors, validateTooling(cfg.Tooling)...)
+	errors = append(errors, validateSecurity(cfg.Security)...)
+
+	// Validate root.hcl options
+	errors = append(errors, validateRoot(cfg.Root)...)
+
+	// Validate the architecture layout
+	switch cfg.Layout {
+	case "", config.LayoutFolders, config.LayoutStacks:
+	default:
+		errors = append(errors, ValidationError{
+			Context: "Layout",
+			Message: fmt.Sprintf("unsupported layout %q: must be folders or stacks", cfg.Layout),
+			Rule:    RuleLayout,
+		})
+	}
+
+	// Validate the generation mode of the component modules
+	if !validGenerationMode(cfg.GenerationMode) {
+		errors = append(errors, ValidationError{
+			Context: "Generation Mode",
+			Message: fmt.Sprintf("unsupported generation_mode %q: must be compact or full", cfg.GenerationMode),
+			Rule:    RuleGenerationMode,
+		})
+	}
+
+	// Validate the output directory stays inside the project, apart from .tgs
+	if cfg.OutputDir != "" {
+		if output.Check(cfg.OutputDir) != nil {
+			errors = append(errors, ValidationError{
+				Context: "Output Directory",
+				Message: fmt.Sprintf("output_dir %q must be a directory inside the project, outside .tgs", cfg.OutputDir),
+				Rule:    RuleOutputDir,
+			})
+		}
+	}
+
+	// Validate subscriptions don't mix their state blobs
+	errors = append(errors, validateSharedRemoteState(cfg)...)
+
+	// Validate the owners of the generated folders
+	errors = append(errors, validateOwners(cfg)...)
+
+	// Validate mirror settings
+	errors = append(errors, validateMirror(cfg.Mirror)...)
+
+	// Validate the PlantUML server rendering diagrams
+	if server := cfg.Diagrams.PlantUMLServer; server != "" {
+		if u, err := url.Parse(server); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errors = append(errors, ValidationError{
+				Context: "Diagrams",
+				Message: fmt.Sprintf("plantuml_server %q must be an http or https URL", server),
+				Rule:    RuleDiagramServer,
+			})
 		}
 	}
 
+	// Validate template overrides
+	errors = append(errors, validateTemplateOverrides()...)
+
+	// Validate the rules file
+	errors = append(errors, validateRulesConfig()...)
+
+	// Validate environment variable placeholders were expanded
+	errors = append(errors, validateUnresolved(cfg.Unresolved)...)
+
+	return applyRules(errors)
+}
+
+// ownerPattern matches CODEOWNERS owners: @user, @org/team or an email
+var ownerPattern = regexp.MustCompile(`^(@[A-Za-z0-9][A-Za-z0-9-]*(/[A-Za-z0-9._-]+)?|[^@\s]+@[^@\s]+\.[^@\s]+)$`)
+
+// validateOwners checks the owners of tgs.yaml reference the stacks and
+// environments of its subscriptions
+func validateOwners(cfg *config.TGSConfig) []error {
+	stacks := make(map[string]bool)
+	envs := make(map[string]bool)
+	for _, sub := range cfg.Subscriptions {
+		for _, env := range sub.Environments {
+			stack := env.Stack
+			if stack == "" {
+				stack = "main"
+			}
+			stacks[stack] = true
+			envs[env.Name] = true
+		}
+	}
+
+	var errors []error
+	check := func(context string, owners []string) {
+		if len(owners) == 0 {
+			errors = append(errors, ValidationError{
+				Context: context,
+				Message: "at least one owner must be listed",
+				Rule:    RuleOwners,
+			})
+		}
+		for _, owner := range owners {
+			if !ownerPattern.MatchString(owner) {
+				errors = append(errors, ValidationError{
+					Context: context,
+					Message: fmt.Sprintf("owner %q must be an @user, @org/team or email", owner),
+					Rule:    RuleOwners,
+				})
+			}
+		}
+	}
+
+	if len(cfg.Owners.Default) > 0 {
+		check("Owners", cfg.Owners.Default)
+	}
+	for _, stack := range ownedKeys(cfg.Owners.Stacks) {
+		if !stacks[stack] {
+			errors = append(errors, ValidationError{
+				Context: fmt.Sprintf("Owners of stack '%s'", stack),
+				Message: fmt.Sprintf("stack %s isn't deployed by any environment", stack),
+				Rule:    RuleOwners,
+			})
+		}
+		check(fmt.Sprintf("Owners of stack '%s'", stack), cfg.Owners.Stacks[stack])
+	}
+	for _, env := range ownedKeys(cfg.Owners.Environments) {
+		if !envs[env] {
+			errors = append(errors, ValidationError{
+				Context: fmt.Sprintf("Owners of environment '%s'", env),
+				Message: fmt.Sprintf("environment %s isn't defined in any subscription", env),
+				Rule:    RuleOwners,
+			})
+		}
+		check(fmt.Sprintf("Owners of environment '%s'", env), cfg.Owners.Environments[env])
+	}
+	return errors
+}
+
+// ownedKeys returns the folders of an owners map in order
+func ownedKeys(owners map[string][]string) []string {
+	var keys []string
+	for key := range owners {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validateUnresolved reports ${env:VAR} placeholders of unset variables
+// without a default
+func validateUnresolved(placeholders []string) []error {
+	var errors []error
+	for _, placeholder := range placeholders {
+		name := strings.TrimSuffix(strings.TrimPrefix(placeholder, "${env:"), "}")
+		errors = append(errors, ValidationError{
+			Context: fmt.Sprintf("Placeholder '%s'", placeholder),
+			Message: fmt.Sprintf("environment variable %s is not set and the placeholder has no default", name),
+			Rule:    RuleUnresolvedPlaceholder,
+		})
+	}
+	return errors
+}
+
+// guidPattern matches subscription and tenant IDs
+var guidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// prefixPattern matches region and environment prefixes
+var prefixPattern = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+// validatePrefixes validates the region and environment prefix overrides
+func validatePrefixes(prefixes config.PrefixConfig) []error {
+	var errors []error
+
+	var regions []string
+	for region := range prefixes.Regions {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+
+	for _, region := range regions {
+		if !azure.IsRegion(region) {
+			errors = append(errors, ValidationError{
+				Context: fmt.Sprintf("Region prefix '%s'", region),
+				Message: fmt.Sprintf("unknown Azure region: %s", region),
+				Rule:    RulePrefixRegion,
+			})
+		}
+		if prefix := prefixes.Regions[region]; !prefixPattern.MatchString(prefix) {
+			errors = append(errors, ValidationError{
+				Context: fmt.Sprintf("Region prefix '%s'", region),
+				Message: fmt.Sprintf("prefix %q must only contain letters and numbers", prefix),
+				Rule:    RulePrefixFormat,
+			})
+		}
+	}
+
+	var envs []string
+	for env := range prefixes.Environments {
+		envs = append(envs, env)
+	}
+	sort.Strings(envs)
+
+	for _, env := range envs {
+		if prefix := prefixes.Environments[env]; !prefixPattern.MatchString(prefix) {
+			errors = append(errors, ValidationError{
+				Context: fmt.Sprintf("Environment prefix '%s'", env),
+				Message: fmt.Sprintf("prefix %q must only contain letters and numbers", prefix),
+				Rule:    RulePrefixFormat,
+			})
+		}
+	}
+
+	return errors
+}
+
+// validateTooling validates the pinned Terraform, Terragrunt and infracost
+// versions
+func validateTooling(tooling config.ToolingConfig) []error {
+	var errors []error
+
+	versions := []struct{ tool, version string }{
+		{"terraform", tooling.Terraform},
+		{"terragrunt", tooling.Terragrunt},
+	}
+	if tooling.Infracost != "" {
+		versions = append(versions, struct{ tool, version string }{"infracost", tooling.Infracost})
+	}
+	for _, v := range versions {
+		if !semverPattern.MatchString(v.version) {
+			errors = append(errors, ValidationError{
+				Context: "Tooling",
+				Message: fmt.Sprintf("%s version %s is not a valid semantic version (e.g. 1.11.2)", v.tool, v.version),
+				Rule:    RuleToolingVersion,
+			})
+		}
+	}
+
+	switch tooling.VersionFiles {
+	case config.VersionFilesTfenv, config.VersionFilesAsdf, config.VersionFilesNone:
+	default:
+		errors = append(errors, ValidationError{
+			Context: "Tooling",
+			Message: fmt.Sprintf("unsupported version_files %q: must be tfenv, asdf or none", tooling.VersionFiles),
+			Rule:    RuleToolingVersionFiles,
+		})
+	}
+
+	return errors
+}
+
+// validateSecurity validates the scanners and severity threshold of the
+// policy-as-code scans
+func validateSecurity(security config.SecurityConfig) []error {
+	var errors []error
+
+	seen := make(map[string]bool)
+	for _, tool := range security.Tools {
+		if !contains(config.SecurityTools, tool) {
+			errors = append(errors, ValidationError{
+				Context: "Security",
+				Message: fmt.Sprintf("unsupported tool %q: must be one of %s", tool, strings.Join(config.SecurityTools, ", ")),
+				Rule:    RuleSecurity,
+			})
+		}
+		if seen[tool] {
+			errors = append(errors, ValidationError{
+				Context: "Security",
+				Message: fmt.Sprintf("tool %s is listed more than once", tool),
+				Rule:    RuleSecurity,
+			})
+		}
+		seen[tool] = true
+	}
+
+	if security.Severity != "" && !contains(config.SecuritySeverities, security.Severity) {
+		errors = append(errors, ValidationError{
+			Context: "Security",
+			Message: fmt.Sprintf("unsupported severity %q: must be one of %s", security.Severity, strings.Join(config.SecuritySeverities, ", ")),
+			Rule:    RuleSecurity,
+		})
+	}
+
+	return errors
+}
+
+// validateSecrets checks the keys and references of environment secrets, and
+// that referenced sops files exist
+func validateSecrets(context string, secrets map[string]string) []error {
+	var keys []string
+	for key := range secrets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errors []error
+	for _, key := range keys {
+		if _, _, err := config.SecretKey(key); err != nil {
+			errors = append(errors, ValidationError{Context: context, Message: err.Error(), Rule: RuleEnvironmentSecrets})
+			continue
+		}
+		secret, err := config.ParseSecret(secrets[key])
+		if err != nil {
+			errors = append(errors, ValidationError{Context: context, Message: fmt.Sprintf("secrets.%s: %v", key, err), Rule: RuleEnvironmentSecrets})
+			continue
+		}
+		if secret.Scheme == config.SecretSops {
+			if _, err := project.Stat(secret.File); err != nil {
+				errors = append(errors, ValidationError{Context: context, Message: fmt.Sprintf("secrets.%s: sops file %s not found", key, secret.File), Rule: RuleEnvironmentSecrets})
+			}
+		}
+	}
+	return errors
+}
+
+// contextTags are the tags component.hcl and config/global.hcl set on every
+// resource, which tags of tgs.yaml can't replace
+var contextTags = []string{"Application", "Component", "Environment", "ManagedBy", "Project", "Region", "Stack"}
+
+// validateTags validates tag names against the Azure tag rules and the
+// context tags, and tag values against the Azure length limit
+func validateTags(context string, tags map[string]string) []error {
+	var keys []string
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errors []error
+	for _, key := range keys {
+		lower := strings.ToLower(key)
+		var problem string
+		switch {
+		case key == "" || len(key) > 512:
+			problem = "must be 1-512 characters"
+		case strings.ContainsAny(key, `<>%&\?/`):
+			problem = `must not contain < > % & \ ? or /`
+		case strings.HasPrefix(lower, "microsoft") || strings.HasPrefix(lower, "azure") || strings.HasPrefix(lower, "windows"):
+			problem = "must not start with microsoft, azure or windows, which Azure reserves"
+		case containsFold(contextTags, key):
+			problem = "is set by tgs on every resource and can't be replaced"
+		case len(tags[key]) > 256:
+			errors = append(errors, ValidationError{Context: context, Message: fmt.Sprintf("value of tag %s must be at most 256 characters", key), Rule: RuleTagName})
+			continue
+		default:
+			continue
+		}
+		errors = append(errors, ValidationError{Context: context, Message: fmt.Sprintf("tag name %q %s", key, problem), Rule: RuleTagName})
+	}
+	return errors
+}
+
+// containsFold reports whether values contains value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// stateKeyPrefixPattern matches state key prefixes: path segments without
+// leading, trailing or empty segments
+var stateKeyPrefixPattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*(/[A-Za-z0-9_-][A-Za-z0-9._-]*)*$`)
+
+// storageContainerPattern matches blob container names: 3-63 lowercase
+// letters, numbers and single hyphens, starting and ending with a letter or
+// number
+var storageContainerPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9]|-[a-z0-9]){2,62}$`)
+
+const containerNameRules = "is not a valid blob container name: it must be 3-63 lowercase letters, numbers and single hyphens, starting and ending with a letter or number"
+
+// genericAccountWords are the words of storage account names that say
+// nothing about their owner. Names made only of them, e.g. sttfstateprod,
+// are likely taken by someone else.
+var genericAccountWords = regexp.MustCompile(`terraform|tfstates?|backend|storage|account|nonprod|states?|remote|prod|test|staging|stage|dev|qa|uat|tf|sa|st|[0-9]`)
+
+// validateRemoteState validates the backend options of a subscription.
+// Remote state containers are named after the project.
+func validateRemoteState(project, subName string, sub config.Subscription) []error {
+	var errors []error
+	state := sub.RemoteState
+
+	accounts := []struct{ field, name string }{{"remotestate.name", state.Name}}
+	if state.Backup != nil && state.Backup.StorageAccount != "" {
+		accounts = append(accounts, struct{ field, name string }{"remotestate.backup.storage_account", state.Backup.StorageAccount})
+	}
+	for _, account := range accounts {
+		if account.name == "" {
+			continue
+		}
+		if violations := naming.Check("azurerm_storage_account", account.name); len(violations) > 0 {
+			errors = append(errors, ValidationError{
+				Context: fmt.Sprintf("Subscription '%s'", subName),
+				Message: fmt.Sprintf("%s %s is not a valid storage account name: %s", account.field, account.name, strings.Join(violations, ", ")),
+				Rule:    RuleRemoteStateStorageName,
+			})
+		} else if len(genericAccountWords.ReplaceAllString(account.name, "")) < 3 {
+			errors = append(errors, ValidationError{
+				Context: fmt.Sprintf("Subscription '%s'", subName),
+				Message: fmt.Sprintf("%s %s is made of generic words and is likely taken, storage account names are globally unique: include the project or organization", account.field, account.name),
+				Rule:    RuleRemoteStateAccountGeneric,
+			})
+		}
+	}
+
+	if state.Backup != nil && state.Backup.Container != "" && !storageContainerPattern.MatchString(state.Backup.Container) {
+		errors = append(errors, ValidationError{
+			Context: fmt.Sprintf("Subscription '%s'", subName),
+			Message: fmt.Sprintf("remotestate.backup.container %s %s", state.Backup.Container, containerNameRules),
+			Rule:    RuleRemoteStateStorageName,
+		})
+	}
+
+	if state.KeyPrefix != "" && !stateKeyPrefixPattern.MatchString(state.KeyPrefix) {
+		errors = append(errors, ValidationError{
+			Context: fmt.Sprintf("Subscription '%s'", subName),
+			Message: fmt.Sprintf("remotestate.key_prefix %q must be path segments of letters, digits, '.', '_' and '-' separated by '/'", state.KeyPrefix),
+			Rule:    RuleRemoteStateOptions,
+		})
+	}
+
+	// Pipelines only provide an OIDC token through a service connection
+	if state.UseOIDC && sub.ServiceConnection == "" {
+		errors = append(errors, ValidationError{
+			Context: fmt.Sprintf("Subscription '%s'", subName),
+			Message: "remotestate.use_oidc requires a service_connection using workload identity federation",
+			Rule:    RuleRemoteStateOptions,
+		})
+	}
+
+	if backup := state.Backup; backup != nil {
+		if backup.Container == "" {
+			errors = append(errors, ValidationError{
+				Context: fmt.Sprintf("Subscription '%s'", subName),
+				Message: "remotestate.backup.container must be filled",
+				Rule:    RuleRemoteStateOptions,
+			})
+		} else if state.BackupAccount() == state.Name && backup.Container == strings.ToLower(project) {
+			errors = append(errors, ValidationError{
+				Context: fmt.Sprintf("Subscription '%s'", subName),
+				Message: fmt.Sprintf("remotestate.backup must not be the state container %s", backup.Container),
+				Rule:    RuleRemoteStateOptions,
+			})
+		}
+	}
+
+	if state.Snapshot && state.Versioning {
+		errors = append(errors, ValidationError{
+			Context: fmt.Sprintf("Subscription '%s'", subName),
+			Message: "remotestate.snapshot duplicates the versions kept by blob versioning of the storage account",
+			Rule:    RuleRemoteStateSnapshot,
+		})
+	}
+
+	return errors
+}
+
+// validateSharedRemoteState flags subscriptions sharing a storage account,
+// container and key prefix. Their keys then only differ by the subscription
+// folder, so no prefix separates their state for access conditions and
+// lifecycle rules.
+func validateSharedRemoteState(cfg *config.TGSConfig) []error {
+	var subNames []string
+	for subName := range cfg.Subscriptions {
+		subNames = append(subNames, subName)
+	}
+	sort.Strings(subNames)
+
+	shared := make(map[string][]string)
+	var locations []string
+	for _, subName := range subNames {
+		state := cfg.Subscriptions[subName].RemoteState
+		if state.Name == "" {
+			continue
+		}
+		location := strings.ToLower(state.Name) + "/" + strings.ToLower(cfg.Name) + "/" + state.KeyPrefix
+		if _, ok := shared[location]; !ok {
+			locations = append(locations, location)
+		}
+		shared[location] = append(shared[location], subName)
+	}
+
+	var errors []error
+	for _, location := range locations {
+		subs := shared[location]
+		if len(subs) < 2 {
+			continue
+		}
+		parts := strings.SplitN(location, "/", 3)
+		prefix := "no key prefix"
+		if parts[2] != "" {
+			prefix = "key prefix " + parts[2]
+		}
+		errors = append(errors, ValidationError{
+			Context: fmt.Sprintf("Subscriptions '%s'", strings.Join(subs, "', '")),
+			Message: fmt.Sprintf("subscriptions share storage account %s, container %s and %s: set distinct remotestate.key_prefix values to keep their state apart", parts[0], parts[1], prefix),
+			Rule:    RuleRemoteStateShared,
+		})
+	}
+	return errors
+}
+
+// ValidateRemoteStateOnline confirms that the remote state resource group,
+// storage account and container of every subscription exist and are
+// readable as the signed in Azure CLI account. Subscriptions without a
+// subscription_id are checked in the subscription of the Azure CLI.
+func ValidateRemoteStateOnline(cfg *config.TGSConfig) []error {
+	var subNames []string
+	for subName := range cfg.Subscriptions {
+		subNames = append(subNames, subName)
+	}
+	sort.Strings(subNames)
+
+	var errors []error
+	var cliSubscription string
+	var cliErr error
+	for _, subName := range subNames {
+		sub := cfg.Subscriptions[subName]
+		if sub.RemoteState.Name == "" || sub.RemoteState.ResourceGroup == "" {
+			continue
+		}
+
+		subscriptionID := sub.SubscriptionID
+		if subscriptionID == "" {
+			if cliSubscription == "" && cliErr == nil {
+				cliSubscription, cliErr = azure.CLISubscription()
+			}
+			if cliErr != nil {
+				errors = append(errors, ValidationError{
+					Context: fmt.Sprintf("Subscription '%s'", subName),
+					Message: fmt.Sprintf("subscription_id isn't set and %v", cliErr),
+					Rule:    RuleRemoteStateUnreachable,
+				})
+				continue
+			}
+			subscriptionID = cliSubscription
+		}
+
+		backend := azure.StateBackend{
+			SubscriptionID: subscriptionID,
+			ResourceGroup:  sub.RemoteState.ResourceGroup,
+			StorageAccount: sub.RemoteState.Name,
+			Container:      strings.ToLower(cfg.Name),
+			Cloud:          sub.Cloud,
+			AzureADAuth:    sub.RemoteState.UseAzureADAuth,
+		}
+		if err := azure.CheckStateBackend(backend); err != nil {
+			errors = append(errors, ValidationError{
+				Context: fmt.Sprintf("Subscription '%s'", subName),
+				Message: fmt.Sprintf("remote state: %v", err),
+				Rule:    RuleRemoteStateUnreachable,
+			})
+		}
+	}
+	return applyRules(errors)
+}
+
+// generatedFiles are written into components by tgs and root.hcl, so root
+// generate blocks must not use their paths
+var generatedFiles = []string{"main.tf", "variables.tf", "outputs.tf", "provider.tf", "backend.tf"}
+
+// validateRoot validates the Terragrunt options rendered in root.hcl
+func validateRoot(root config.RootConfig) []error {
+	var errors []error
+	invalid := func(message string) {
+		errors = append(errors, ValidationError{Context: "Root", Message: message, Rule: RuleRootOptions})
+	}
+
+	for _, pattern := range root.RetryableErrors {
+		if _, err := regexp.Compile(pattern); err != nil {
+			invalid(fmt.Sprintf("retryable error %q is not a valid regular expression: %v", pattern, err))
+		}
+	}
+	if root.RetryMaxAttempts < 0 || root.RetrySleepIntervalSec < 0 {
+		invalid("retry_max_attempts and retry_sleep_interval_sec must not be negative")
+	}
+
+	names := make(map[string]bool)
+	for i, args := range root.ExtraArguments {
+		if args.Name == "" {
+			invalid(fmt.Sprintf("extra_arguments %d must have a name", i+1))
+		} else if names[args.Name] {
+			invalid(fmt.Sprintf("extra_arguments %s is defined more than once", args.Name))
+		}
+		names[args.Name] = true
+		if len(args.Commands) == 0 {
+			invalid(fmt.Sprintf("extra_arguments %s must list the commands it applies to", args.Name))
+		}
+	}
+
+	names = make(map[string]bool)
+	for i, block := range root.Generate {
+		if block.Name == "" {
+			invalid(fmt.Sprintf("generate block %d must have a name", i+1))
+		} else if names[block.Name] {
+			invalid(fmt.Sprintf("generate block %s is defined more than once", block.Name))
+		}
+		names[block.Name] = true
+		if block.Path == "" {
+			invalid(fmt.Sprintf("generate block %s must have a path", block.Name))
+		} else if contains(generatedFiles, block.Path) {
+			invalid(fmt.Sprintf("generate block %s must not overwrite %s, which tgs generates", block.Name, block.Path))
+		}
+		switch block.IfExists {
+		case "", "overwrite", "overwrite_terragrunt", "skip", "error":
+		default:
+			invalid(fmt.Sprintf("generate block %s has unsupported if_exists %q: must be overwrite, overwrite_terragrunt, skip or error", block.Name, block.IfExists))
+		}
+	}
+
+	return errors
+}
+
+// validateMirror validates the optional template/schema mirror configuration
+func validateMirror(mirror config.MirrorConfig) []error {
+	var errors []error
+
+	if mirror.URL == "" && mirror.PublicKey == "" {
+		return errors
+	}
+
+	if !strings.HasPrefix(mirror.URL, "https://") {
+		errors = append(errors, ValidationError{
+			Context: "Mirror",
+			Message: "url property must be an https:// URL",
+			Rule:    RuleMirrorHTTPS,
+		})
+	}
+
+	if mirror.PublicKey == "" {
+		errors = append(errors, ValidationError{
+			Context: "Mirror",
+			Message: "public_key property must be filled to verify mirror signatures",
+			Rule:    RuleMirrorPublicKey,
+		})
+	}
+
+	return errors
+}
+
+// validateTemplateOverrides checks that every file in the template override
+// directory replaces a built-in template, so typos aren't silently ignored
+func validateTemplateOverrides() []error {
+	var errors []error
+
+	project.WalkDir(templates.OverrideDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(templates.OverrideDir, path)
+		if err != nil {
+			return nil
+		}
+
+		if !templates.IsTemplate(filepath.ToSlash(rel)) {
+			errors = append(errors, ValidationError{
+				Context: "Template override",
+				Message: fmt.Sprintf("%s does not match any built-in template", path),
+				Rule:    RuleTemplateOverrideUnknown,
+				File:    filepath.ToSlash(path),
+			})
+		}
+		return nil
+	})
+
 	return errors
 }
@@ -0,0 +1,675 @@
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/naming"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/templates"
+)
+
+func TestValidateOutputDir(t *testing.T) {
+	useProject(t, "")
+
+	testCases := []struct {
+		outputDir string
+		valid     bool
+	}{
+		{outputDir: "", valid: true},
+		{outputDir: "infra/generated", valid: true},
+		{outputDir: "../infra", valid: false},
+		{outputDir: "/infra", valid: false},
+		{outputDir: ".", valid: false},
+		{outputDir: ".tgs/infra", valid: false},
+	}
+
+	for _, tc := range testCases {
+		cfg := validTGSConfig()
+		cfg.OutputDir = tc.outputDir
+		findings := findingsOf(ValidateTGSConfig(cfg), RuleOutputDir)
+		if (len(findings) == 0) != tc.valid {
+			t.Errorf("ValidateTGSConfig() with output_dir %q = %v, want valid %v", tc.outputDir, findings, tc.valid)
+		}
+	}
+}
+
+// useProject makes a temporary directory the project root, writing
+// .tgs/validate.yaml when rules isn't empty
+func useProject(t *testing.T, rules string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	if rules != "" {
+		if err := os.MkdirAll(filepath.Join(dir, ".tgs"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, ".tgs", "validate.yaml"), []byte(rules), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	project.SetRoot(dir)
+	t.Cleanup(func() { project.SetRoot("") })
+}
+
+// findingsOf returns the findings of rule as "severity: message"
+func findingsOf(findings []error, rule string) []string {
+	var result []string
+	for _, finding := range findings {
+		var validationErr ValidationError
+		if errors.As(finding, &validationErr) && validationErr.Rule == rule {
+			result = append(result, fmt.Sprintf("%s: %s", SeverityOf(finding), validationErr.Message))
+		}
+	}
+	return result
+}
+
+// validTGSConfig returns a configuration without findings
+func validTGSConfig() *config.TGSConfig {
+	return &config.TGSConfig{
+		Name: "projecta",
+		Subscriptions: map[string]config.Subscription{
+			"nonprod": {
+				RemoteState:  config.RemoteState{Name: "stprojectanonprodtf", ResourceGroup: "rg-projecta-nonprod-tf"},
+				Environments: []config.Environment{{Name: "dev"}},
+			},
+		},
+		Tooling: config.ToolingConfig{Terraform: "1.11.2", Terragrunt: "0.69.10", VersionFiles: config.VersionFilesTfenv},
+	}
+}
+
+func TestValidTGSConfig(t *testing.T) {
+	useProject(t, "")
+	if findings := ValidateTGSConfig(validTGSConfig()); len(findings) != 0 {
+		t.Errorf("ValidateTGSConfig() = %v, want no findings", findings)
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	findings := []error{
+		ValidationError{Context: "Stack", Message: "description", Rule: RuleStackDescription},
+		ValidationError{Context: "Component 'redis'", Message: "version", Rule: RuleProviderVersion},
+		ValidationError{Context: "Environment 'dev'", Message: "unknown", Rule: RuleEnvConfigUnknown},
+		ValidationError{Context: "Rules file", Message: "unknown rule", Rule: RuleRulesConfig},
+		fmt.Errorf("plain error"),
+	}
+
+	testCases := []struct {
+		name  string
+		rules string
+		want  []string
+	}{
+		{
+			name: "Default severities",
+			want: []string{"warning: description", "error: version", "warning: unknown", "error: unknown rule", "error: plain error"},
+		},
+		{
+			name:  "Overrides",
+			rules: "rules:\n  stack-description: error\n  provider-version: info\n  env-config-unknown: off\n  rules-config: off\n",
+			want:  []string{"error: description", "info: version", "error: unknown rule", "error: plain error"},
+		},
+		{
+			name:  "Invalid severities are ignored",
+			rules: "rules:\n  stack-description: loud\n",
+			want:  []string{"warning: description", "error: version", "warning: unknown", "error: unknown rule", "error: plain error"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			useProject(t, tc.rules)
+
+			var got []string
+			for _, finding := range applyRules(findings) {
+				message := finding.Error()
+				var validationErr ValidationError
+				if errors.As(finding, &validationErr) {
+					message = validationErr.Message
+				}
+				got = append(got, fmt.Sprintf("%s: %s", SeverityOf(finding), message))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("applyRules() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateRulesConfig(t *testing.T) {
+	testCases := []struct {
+		name  string
+		rules string
+		want  []string
+	}{
+		{name: "No rules file"},
+		{name: "Valid rules", rules: "rules:\n  stack-description: off\n  provider-version: warning\n"},
+		{
+			name:  "Unknown rule and invalid severity",
+			rules: "rules:\n  no-such-rule: error\n  stack-description: loud\n",
+			want:  []string{"error: unknown rule", `error: invalid severity "loud" (use error, warning, info or off)`},
+		},
+		{name: "Unparsable file", rules: "rules: [", want: []string{"error: failed to parse validate config: yaml: line 1: did not find expected node content"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			useProject(t, tc.rules)
+			if got := findingsOf(validateRulesConfig(), RuleRulesConfig); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("validateRulesConfig() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSeverityOf(t *testing.T) {
+	testCases := []struct {
+		err  error
+		want string
+	}{
+		{err: fmt.Errorf("plain error"), want: SeverityError},
+		{err: ValidationError{Rule: RuleStackDescription}, want: SeverityError},
+		{err: ValidationError{Rule: RuleStackDescription, Severity: SeverityWarning}, want: SeverityWarning},
+		{err: fmt.Errorf("wrapped: %w", ValidationError{Severity: SeverityInfo}), want: SeverityInfo},
+	}
+
+	for _, tc := range testCases {
+		if got := SeverityOf(tc.err); got != tc.want {
+			t.Errorf("SeverityOf(%v) = %s, want %s", tc.err, got, tc.want)
+		}
+	}
+
+	findings := []error{
+		ValidationError{Message: "a", Severity: SeverityError},
+		ValidationError{Message: "b", Severity: SeverityWarning},
+		ValidationError{Message: "c", Severity: SeverityInfo},
+		fmt.Errorf("d"),
+	}
+	if got := len(Errors(findings)); got != 2 {
+		t.Errorf("Errors() returned %d findings, want 2", got)
+	}
+	if got := len(Warnings(findings)); got != 2 {
+		t.Errorf("Warnings() returned %d findings, want 2", got)
+	}
+}
+
+func TestFormatJSON(t *testing.T) {
+	useProject(t, "")
+
+	out, err := FormatJSON(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\n  \"valid\": true,\n  \"results\": []\n}"; out != want {
+		t.Errorf("FormatJSON(nil) = %s, want %s", out, want)
+	}
+
+	results := NewResults([]error{
+		ValidationError{Context: "Component 'redis'", Message: "b", Rule: RuleProviderVersion, Severity: SeverityError, File: ".tgs/stacks/main.yaml", Line: 7},
+		ValidationError{Context: "Stack", Message: "a", Rule: RuleStackDescription, Severity: SeverityWarning},
+		fmt.Errorf("plain error"),
+	}, ConfigFile)
+	out, err = FormatJSON(results)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var report struct {
+		Valid   bool     `json:"valid"`
+		Results []Result `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("FormatJSON() isn't valid JSON: %v\n%s", err, out)
+	}
+	// Sorted by file, line, rule and message
+	want := []Result{
+		{Rule: RuleProviderVersion, Severity: SeverityError, File: ".tgs/stacks/main.yaml", Line: 7, Context: "Component 'redis'", Message: "b"},
+		{Rule: "", Severity: SeverityError, File: ConfigFile, Message: "plain error"},
+		{Rule: RuleStackDescription, Severity: SeverityWarning, File: ConfigFile, Context: "Stack", Message: "a"},
+	}
+	if report.Valid || !reflect.DeepEqual(report.Results, want) {
+		t.Errorf("FormatJSON() = %+v, want invalid with %+v", report, want)
+	}
+}
+
+func TestFormatSARIF(t *testing.T) {
+	results := []Result{
+		{Rule: RuleProviderVersion, Severity: SeverityError, File: ".tgs/stacks/main.yaml", Line: 7, Context: "Component 'redis'", Message: "version missing"},
+		{Rule: RuleProviderVersion, Severity: SeverityError, File: ".tgs/stacks/main.yaml", Line: 9, Message: "another"},
+		{Rule: RuleStackDescription, Severity: SeverityWarning, File: ".tgs/stacks/main.yaml", Message: "no description"},
+		{Severity: SeverityInfo, File: ConfigFile, Message: "plain"},
+	}
+	out, err := FormatSARIF(results)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var log struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Name  string `json:"name"`
+					Rules []struct {
+						ID               string `json:"id"`
+						ShortDescription struct {
+							Text string `json:"text"`
+						} `json:"shortDescription"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID  string `json:"ruleId"`
+				Level   string `json:"level"`
+				Message struct {
+					Text string `json:"text"`
+				} `json:"message"`
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+						Region *struct {
+							StartLine int `json:"startLine"`
+						} `json:"region"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal([]byte(out), &log); err != nil {
+		t.Fatalf("FormatSARIF() isn't valid JSON: %v\n%s", err, out)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || log.Runs[0].Tool.Driver.Name != "tgs" {
+		t.Fatalf("FormatSARIF() = %s, want a 2.1.0 log of a tgs run", out)
+	}
+	run := log.Runs[0]
+
+	var ruleIDs []string
+	for _, rule := range run.Tool.Driver.Rules {
+		ruleIDs = append(ruleIDs, rule.ID)
+	}
+	if want := []string{RuleProviderVersion, RuleStackDescription, "validation"}; !reflect.DeepEqual(ruleIDs, want) {
+		t.Errorf("SARIF rules = %v, want %v", ruleIDs, want)
+	}
+	if got := run.Tool.Driver.Rules[0].ShortDescription.Text; got != RuleDescriptions[RuleProviderVersion] {
+		t.Errorf("SARIF rule description = %q, want %q", got, RuleDescriptions[RuleProviderVersion])
+	}
+
+	var levels []string
+	for _, result := range run.Results {
+		levels = append(levels, result.Level)
+	}
+	if want := []string{"error", "error", "warning", "note"}; !reflect.DeepEqual(levels, want) {
+		t.Errorf("SARIF levels = %v, want %v", levels, want)
+	}
+	first := run.Results[0]
+	if first.Message.Text != "Component 'redis': version missing" || first.Locations[0].PhysicalLocation.ArtifactLocation.URI != ".tgs/stacks/main.yaml" || first.Locations[0].PhysicalLocation.Region == nil || first.Locations[0].PhysicalLocation.Region.StartLine != 7 {
+		t.Errorf("SARIF result = %+v, want the message, file and line of the finding", first)
+	}
+	if run.Results[2].Locations[0].PhysicalLocation.Region != nil {
+		t.Errorf("SARIF result without a line has a region: %+v", run.Results[2])
+	}
+}
+
+func TestValidateSubscriptionIDs(t *testing.T) {
+	useProject(t, "")
+
+	testCases := []struct {
+		name           string
+		subscriptionID string
+		tenantID       string
+		want           []string
+	}{
+		{name: "Unset"},
+		{name: "GUIDs", subscriptionID: "00000000-0000-0000-0000-000000000000", tenantID: "ABCDEF01-2345-6789-abcd-ef0123456789"},
+		{
+			name:           "Not GUIDs",
+			subscriptionID: "00000000-0000-0000-0000-00000000000",
+			tenantID:       "{00000000-0000-0000-0000-000000000000}",
+			want: []string{
+				"error: subscription_id 00000000-0000-0000-0000-00000000000 must be a GUID",
+				"error: tenant_id {00000000-0000-0000-0000-000000000000} must be a GUID",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := validTGSConfig()
+			sub := cfg.Subscriptions["nonprod"]
+			sub.SubscriptionID, sub.TenantID = tc.subscriptionID, tc.tenantID
+			cfg.Subscriptions["nonprod"] = sub
+
+			if got := findingsOf(ValidateTGSConfig(cfg), RuleSubscriptionIDFormat); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ValidateTGSConfig() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateTooling(t *testing.T) {
+	testCases := []struct {
+		name    string
+		tooling config.ToolingConfig
+		want    []string
+	}{
+		{name: "Valid", tooling: config.ToolingConfig{Terraform: "1.11.2", Terragrunt: "0.69.10", Infracost: "0.10.41", VersionFiles: config.VersionFilesAsdf}},
+		{
+			name:    "Invalid versions",
+			tooling: config.ToolingConfig{Terraform: "1.11", Terragrunt: "latest", Infracost: "v0.10.41", VersionFiles: config.VersionFilesNone},
+			want: []string{
+				"terraform version 1.11 is not a valid semantic version (e.g. 1.11.2)",
+				"terragrunt version latest is not a valid semantic version (e.g. 1.11.2)",
+				"infracost version v0.10.41 is not a valid semantic version (e.g. 1.11.2)",
+			},
+		},
+		{
+			name:    "Unsupported version files",
+			tooling: config.ToolingConfig{Terraform: "1.11.2", Terragrunt: "0.69.10", VersionFiles: "mise"},
+			want:    []string{`unsupported version_files "mise": must be tfenv, asdf or none`},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, finding := range validateTooling(tc.tooling) {
+				got = append(got, finding.(ValidationError).Message)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("validateTooling() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidatePrefixes(t *testing.T) {
+	findings := validatePrefixes(config.PrefixConfig{
+		Regions:      map[string]string{"eastus2": "EUS2", "westus9": "W9", "westus2": "W-2"},
+		Environments: map[string]string{"dev": "D", "sandbox": "S B"},
+	})
+
+	var got []string
+	for _, finding := range findings {
+		validationErr := finding.(ValidationError)
+		got = append(got, fmt.Sprintf("%s %s: %s", validationErr.Rule, validationErr.Context, validationErr.Message))
+	}
+	want := []string{
+		`prefix-format Region prefix 'westus2': prefix "W-2" must only contain letters and numbers`,
+		"prefix-region Region prefix 'westus9': unknown Azure region: westus9",
+		`prefix-format Environment prefix 'sandbox': prefix "S B" must only contain letters and numbers`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("validatePrefixes() = %v, want %v", got, want)
+	}
+}
+
+func TestValidatePrefixCollisions(t *testing.T) {
+	useProject(t, "")
+
+	stack := &config.MainConfig{Stack: config.StackConfig{
+		Components: map[string]config.Component{
+			"redis":      {Source: "azurerm_redis_cache", Provider: "azurerm", Version: "4.22.0"},
+			"redisCache": {Source: "azurerm_redis_cache", Provider: "azurerm", Version: "4.22.0"},
+		},
+		Architecture: config.ArchitectureConfig{Regions: map[string][]config.RegionComponent{
+			"eastus2": {{Component: "redis"}},
+		}},
+	}}
+
+	testCases := []struct {
+		name     string
+		prefixes config.PrefixConfig
+		envs     []string
+		regions  []string
+		want     []string
+	}{
+		{name: "Distinct prefixes", envs: []string{"dev", "test"}},
+		{
+			name:     "Environments sharing a prefix",
+			prefixes: config.PrefixConfig{Environments: map[string]string{"stage": "S", "sandbox": "S"}},
+			envs:     []string{"stage", "sandbox"},
+			want:     []string{"error: sandbox/eastus2/redis resolves to the same name prefixes as stage/eastus2/redis: environments stage and sandbox share the prefix S"},
+		},
+		{
+			name:    "Components sharing an abbreviation",
+			envs:    []string{"dev"},
+			regions: []string{"redis", "redisCache"},
+			want:    []string{"error: dev/eastus2/redisCache resolves to the same name prefixes as dev/eastus2/redis: components redis and redisCache share the abbreviation redis"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := validTGSConfig()
+			cfg.Prefixes = tc.prefixes
+			sub := cfg.Subscriptions["nonprod"]
+			sub.Environments = nil
+			for _, env := range tc.envs {
+				sub.Environments = append(sub.Environments, config.Environment{Name: env})
+			}
+			cfg.Subscriptions["nonprod"] = sub
+
+			stack := *stack
+			if tc.regions != nil {
+				var components []config.RegionComponent
+				for _, comp := range tc.regions {
+					components = append(components, config.RegionComponent{Component: comp})
+				}
+				stack.Stack.Architecture.Regions = map[string][]config.RegionComponent{"eastus2": components}
+			}
+
+			got := findingsOf(ValidatePrefixCollisions(cfg, map[string]*config.MainConfig{"main": &stack}), RulePrefixCollision)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ValidatePrefixCollisions() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateRemoteStateNames(t *testing.T) {
+	useProject(t, "")
+
+	testCases := []struct {
+		name        string
+		projectName string
+		account     string
+		backup      *config.StateBackup
+		rule        string
+		want        []string
+	}{
+		{name: "Valid names", projectName: "ProjectA", account: "stprojectanonprodtf", backup: &config.StateBackup{StorageAccount: "stprojectabackup", Container: "projecta-backup"}, rule: RuleRemoteStateStorageName},
+		{
+			name:        "Container named after the project",
+			projectName: "project_a",
+			account:     "stprojectanonprodtf",
+			rule:        RuleRemoteStateStorageName,
+			want:        []string{"error: remote state container project_a, named after the project, " + containerNameRules},
+		},
+		{
+			name:        "Account name",
+			projectName: "projecta",
+			account:     "st-ProjectA",
+			rule:        RuleRemoteStateStorageName,
+			want:        []string{"error: remotestate.name st-ProjectA is not a valid storage account name: " + strings.Join(naming.Check("azurerm_storage_account", "st-ProjectA"), ", ")},
+		},
+		{
+			name:        "Backup account and container",
+			projectName: "projecta",
+			account:     "stprojectanonprodtf",
+			backup:      &config.StateBackup{StorageAccount: "st", Container: "Backup--1"},
+			rule:        RuleRemoteStateStorageName,
+			want: []string{
+				"error: remotestate.backup.storage_account st is not a valid storage account name: " + strings.Join(naming.Check("azurerm_storage_account", "st"), ", "),
+				"error: remotestate.backup.container Backup--1 " + containerNameRules,
+			},
+		},
+		{
+			name:        "Generic account name",
+			projectName: "projecta",
+			account:     "sttfstateprod",
+			rule:        RuleRemoteStateAccountGeneric,
+			want:        []string{"warning: remotestate.name sttfstateprod is made of generic words and is likely taken, storage account names are globally unique: include the project or organization"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := validTGSConfig()
+			cfg.Name = tc.projectName
+			sub := cfg.Subscriptions["nonprod"]
+			sub.RemoteState.Name = tc.account
+			sub.RemoteState.Backup = tc.backup
+			cfg.Subscriptions["nonprod"] = sub
+
+			if got := findingsOf(ValidateTGSConfig(cfg), tc.rule); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ValidateTGSConfig() %s = %v, want %v", tc.rule, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateComponentProviders(t *testing.T) {
+	testCases := []struct {
+		name      string
+		providers []config.ProviderRequirement
+		want      []string
+	}{
+		{
+			name: "valid",
+			providers: []config.ProviderRequirement{
+				{Name: "azapi", Source: "Azure/azapi", Version: "2.2.0"},
+				{Name: "random", Version: "3.6.3"},
+			},
+		},
+		{
+			name:      "azurerm",
+			providers: []config.ProviderRequirement{{Name: "azurerm", Version: "4.22.0"}},
+			want:      []string{"error: azurerm is always required and configured by provider and version, remove it from providers"},
+		},
+		{
+			name: "duplicate",
+			providers: []config.ProviderRequirement{
+				{Name: "random", Version: "3.6.3"},
+				{Name: "random", Version: "3.6.0"},
+			},
+			want: []string{"error: provider random is listed more than once"},
+		},
+		{
+			name: "incomplete",
+			providers: []config.ProviderRequirement{
+				{Version: "1.0.0"},
+				{Name: "random"},
+				{Name: "time", Version: "~> 0.12"},
+				{Name: "azapi", Source: "azapi", Version: "2.2.0"},
+			},
+			want: []string{
+				"error: providers entry 1 must set a name",
+				"error: provider random must set a version",
+				"error: version ~> 0.12 of provider time is not a valid semantic version (e.g. 3.1.0)",
+				"error: source azapi of provider azapi must be in namespace/name format",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			comp := config.Component{
+				Source:      "azurerm_redis_cache",
+				Provider:    "azurerm",
+				Version:     "4.22.0",
+				Description: "Redis cache",
+				Providers:   tc.providers,
+			}
+			got := findingsOf(validateComponent("redis", comp), RuleComponentProviders)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("validateComponent() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateProviderVersions(t *testing.T) {
+	useProject(t, "")
+
+	// Offline lookups only read the registry cache of the project
+	cacheDir := project.Path(filepath.Join(".tgs", "cache", "registry"))
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for file, versions := range map[string][]string{
+		"hashicorp-azurerm.json": {"4.21.0", "4.22.0"},
+		"hashicorp-random.json":  {"3.6.3"},
+		"Azure-azapi.json":       {"2.1.0", "2.2.0"},
+	} {
+		data, err := json.Marshal(map[string]interface{}{"versions": versions})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(cacheDir, file), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stack := &config.MainConfig{}
+	stack.Stack.Components = map[string]config.Component{
+		"cosmos": {Provider: "azurerm", Version: "4.22.0", Providers: []config.ProviderRequirement{
+			{Name: "azapi", Source: "Azure/azapi", Version: "2.0.0"},
+			{Name: "time", Version: "0.12.1"},
+		}},
+		"redis": {Provider: "azurerm", Version: "4.22.0", Providers: []config.ProviderRequirement{
+			{Name: "azapi", Source: "Azure/azapi", Version: "2.2.0"},
+			{Name: "random", Version: "3.6.3"},
+		}},
+		"sql": {Provider: "azurerm", Version: "4.20.0"},
+	}
+
+	findings := ValidateProviderVersions(stack, true)
+	got := findingsOf(findings, RuleProviderVersion)
+	want := []string{
+		"error: version 2.0.0 of provider Azure/azapi does not exist in the Terraform Registry",
+		"error: version 4.20.0 of provider hashicorp/azurerm does not exist in the Terraform Registry",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ValidateProviderVersions() = %v, want %v", got, want)
+	}
+
+	// Uncached providers can't be verified offline, once per provider
+	got = findingsOf(findings, RuleProviderRegistryUnavailable)
+	want = []string{"warning: could not verify versions: provider versions not cached"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ValidateProviderVersions() unavailable = %v, want %v", got, want)
+	}
+}
+
+func TestValidateTemplateOverrides(t *testing.T) {
+	useProject(t, "")
+
+	dir := project.Path(templates.OverrideDir)
+	for _, name := range []string{"environment/root.hcl.tmpl", "components/compnent.hcl.tmpl", "modules/azurerm_redis_cache/main.tf"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("# override\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Files not replacing a built-in template are reported
+	got := findingsOf(ValidateTGSConfig(validTGSConfig()), RuleTemplateOverrideUnknown)
+	want := []string{
+		"error: .tgs/templates/components/compnent.hcl.tmpl does not match any built-in template",
+		"error: .tgs/templates/modules/azurerm_redis_cache/main.tf does not match any built-in template",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ValidateTGSConfig() template override findings = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,222 @@
+package validate
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// ValidateRequiredVariables checks that every required variable of the
+// generated component modules of a stack, one without a default, gets a
+// value from the inputs of component.hcl, the included app settings and
+// policy files, root.hcl or the metadata of every app. Such variables make
+// terragrunt plan prompt or fail. strict reports them as errors instead of
+// warnings. Components that haven't been generated yet are skipped.
+func ValidateRequiredVariables(stackName string, stack *config.MainConfig, strict bool) []error {
+	var findings []error
+
+	var compNames []string
+	for name := range stack.Stack.Components {
+		compNames = append(compNames, name)
+	}
+	sort.Strings(compNames)
+
+	rootInputs, rootDynamic := inputNames(output.Path("root.hcl"))
+	for _, compName := range compNames {
+		comp := stack.Stack.Components[compName]
+		dir := output.Path("_components", stackName, compName)
+		variables, err := requiredVariables(output.ModuleDir(stackName, compName))
+		if err != nil || len(variables) == 0 {
+			continue
+		}
+
+		// Inputs shared by every instance of the component
+		files := []string{filepath.Join(dir, "component.hcl")}
+		if comp.AppSettings {
+			files = append(files, output.Path("config", stackName, "app_settings_"+compName, "appsettings.hcl"))
+		}
+		if comp.PolicyFiles {
+			files = append(files, output.Path("config", stackName, "policy_files_"+compName, "policies.hcl"))
+		}
+		set := make(map[string]bool)
+		for name := range rootInputs {
+			set[name] = true
+		}
+		dynamic := rootDynamic
+		for _, file := range files {
+			names, isDynamic := inputNames(file)
+			for name := range names {
+				set[name] = true
+			}
+			dynamic = dynamic || isDynamic
+		}
+		// Inputs computed when Terragrunt runs may set any variable
+		if dynamic {
+			continue
+		}
+
+		instances := componentInstances(stack, compName)
+		for _, variable := range variables {
+			if set[variable.name] {
+				continue
+			}
+			var missing []string
+			for _, instance := range instances {
+				if _, ok := instance.inputs[variable.name]; !ok {
+					missing = append(missing, instance.name)
+				}
+			}
+			if len(missing) == 0 {
+				continue
+			}
+
+			message := fmt.Sprintf("required variable %s has no default and no input in component.hcl", variable.name)
+			if len(missing) < len(instances) {
+				message = fmt.Sprintf("required variable %s has no default and isn't set by apps %s", variable.name, strings.Join(missing, ", "))
+			}
+			findings = append(findings, ValidationError{
+				Context: fmt.Sprintf("Component '%s'", compName),
+				File:    variable.file,
+				Line:    variable.line,
+				Message: message,
+				Rule:    RuleUnresolvedVariable,
+			})
+		}
+	}
+
+	findings = applyRules(findings)
+	if strict {
+		for i, finding := range findings {
+			if validationErr, ok := finding.(ValidationError); ok && validationErr.Severity == SeverityWarning {
+				validationErr.Severity = SeverityError
+				findings[i] = validationErr
+			}
+		}
+	}
+	return findings
+}
+
+// variable is a required variable of a module
+type variable struct {
+	name string
+	file string
+	line int
+}
+
+// requiredVariables returns the variables without a default declared in the
+// Terraform files of a module directory, sorted by name
+func requiredVariables(dir string) ([]variable, error) {
+	files, err := project.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+
+	var variables []variable
+	for _, path := range files {
+		body, ok := parseHCLBody(path)
+		if !ok {
+			continue
+		}
+		for _, block := range body.Blocks {
+			if block.Type != "variable" || len(block.Labels) != 1 {
+				continue
+			}
+			if _, ok := block.Body.Attributes["default"]; ok {
+				continue
+			}
+			variables = append(variables, variable{name: block.Labels[0], file: filepath.ToSlash(path), line: block.TypeRange.Start.Line})
+		}
+	}
+	sort.Slice(variables, func(i, j int) bool { return variables[i].name < variables[j].name })
+	return variables, nil
+}
+
+// inputNames returns the names set by the inputs of a Terragrunt file, and
+// whether its inputs are an expression other than an object, whose names
+// are only known when Terragrunt runs. Missing files set no inputs.
+func inputNames(path string) (map[string]bool, bool) {
+	names := make(map[string]bool)
+	body, ok := parseHCLBody(path)
+	if !ok {
+		return names, false
+	}
+	attr, ok := body.Attributes["inputs"]
+	if !ok {
+		return names, false
+	}
+	object, ok := attr.Expr.(*hclsyntax.ObjectConsExpr)
+	if !ok {
+		return names, true
+	}
+	for _, item := range object.Items {
+		if value, diags := item.KeyExpr.Value(nil); !diags.HasErrors() && value.IsKnown() && !value.IsNull() && value.Type().FriendlyName() == "string" {
+			names[value.AsString()] = true
+		} else {
+			return names, true
+		}
+	}
+	return names, false
+}
+
+// instance is a deployment of a component and the inputs its metadata sets
+type instance struct {
+	name   string
+	inputs map[string]interface{}
+}
+
+// componentInstances returns the instances of a component in the
+// architecture: its apps, or the component itself when it has none
+func componentInstances(stack *config.MainConfig, compName string) []instance {
+	comp := stack.Stack.Components[compName]
+	seen := make(map[string]bool)
+	var instances []instance
+
+	var regions []string
+	for region := range stack.Stack.Architecture.Regions {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	for _, region := range regions {
+		for _, rc := range stack.Stack.Architecture.Regions[region] {
+			if rc.Component != compName {
+				continue
+			}
+			if len(rc.Apps) == 0 && !seen[""] {
+				seen[""] = true
+				instances = append(instances, instance{name: compName})
+			}
+			for _, appName := range rc.Apps {
+				if !seen[appName] {
+					seen[appName] = true
+					instances = append(instances, instance{name: appName, inputs: rc.App(appName).Inputs(comp)})
+				}
+			}
+		}
+	}
+	if len(instances) == 0 {
+		instances = append(instances, instance{name: compName})
+	}
+	return instances
+}
+
+// parseHCLBody parses an HCL file, reporting false when it's missing or
+// invalid
+func parseHCLBody(path string) (*hclsyntax.Body, bool) {
+	content, err := project.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	file, diags := hclparse.NewParser().ParseHCL(content, path)
+	if diags.HasErrors() {
+		return nil, false
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	return body, ok
+}
@@ -0,0 +1,185 @@
+// Package workspace lets a repository host several TGS projects, each in its
+// own directory with its own .tgs configuration and generated output
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"gopkg.in/yaml.v3"
+)
+
+// File defines the workspaces of a repository, relative to its root
+const File = ".tgs/workspaces.yaml"
+
+// Config is the workspaces file
+type Config struct {
+	Workspaces map[string]Workspace `yaml:"workspaces"`
+}
+
+// Workspace is a TGS project in a directory of the repository
+type Workspace struct {
+	// Path is the project directory relative to the repository root
+	Path        string `yaml:"path"`
+	Description string `yaml:"description,omitempty"`
+}
+
+// Names returns the workspace names in order
+func (c *Config) Names() []string {
+	var names []string
+	for name := range c.Workspaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// prefix is the path of the current project relative to the root of its
+// workspaces, empty outside a workspace
+var prefix string
+
+// Prefix returns the path of the current project relative to the root of its
+// workspaces, with a trailing slash, or "" when the project isn't a workspace.
+// Generated files run from the repository root, such as pipelines, use it to
+// reach the project.
+func Prefix() string {
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "/"
+}
+
+// Read reads the workspaces file of a repository root
+func Read(root string) (*Config, error) {
+	data, err := project.ReadFile(filepath.Join(root, File))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspaces config: %w", err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse workspaces config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// Validate checks that workspaces have a path inside the repository and that
+// no two overlap, so their generated files can't collide
+func Validate(cfg *Config) error {
+	names := cfg.Names()
+	paths := make(map[string]string)
+	for _, name := range names {
+		path := filepath.ToSlash(filepath.Clean(cfg.Workspaces[name].Path))
+		if cfg.Workspaces[name].Path == "" || path == "." || filepath.IsAbs(path) || strings.HasPrefix(path, "../") || path == ".." {
+			return fmt.Errorf("workspace %s: path must be a directory inside the repository", name)
+		}
+		paths[name] = path
+	}
+
+	for i, name := range names {
+		for _, other := range names[i+1:] {
+			a, b := paths[name], paths[other]
+			if a == b || strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/") {
+				return fmt.Errorf("workspaces %s and %s overlap: %s and %s", name, other, a, b)
+			}
+		}
+	}
+	return nil
+}
+
+// Enter changes into the project directory of a workspace, or into dir when
+// name is empty, and records the project's path relative to its workspaces.
+// The workspaces file must pass Validate to enter one of its workspaces.
+func Enter(name, dir string) error {
+	if name != "" {
+		root, cfg, err := findRoot(".")
+		if err != nil {
+			return err
+		}
+		if cfg == nil {
+			return fmt.Errorf("workspace %s: no %s found", name, File)
+		}
+		if err := Validate(cfg); err != nil {
+			return err
+		}
+		ws, ok := cfg.Workspaces[name]
+		if !ok {
+			return fmt.Errorf("workspace %s is not defined in %s (defined: %s)", name, filepath.Join(root, File), strings.Join(cfg.Names(), ", "))
+		}
+		dir = filepath.Join(root, ws.Path)
+	}
+
+	if dir != "" {
+		if err := os.Chdir(dir); err != nil {
+			return fmt.Errorf("failed to change into project directory %s: %w", dir, err)
+		}
+	}
+	return Detect()
+}
+
+// Detect records the path of the project directory relative to its
+// workspaces when it's a workspace of a workspaces file in one of its parents
+func Detect() error {
+	prefix = ""
+	dir, err := project.Abs(".")
+	if err != nil {
+		return fmt.Errorf("failed to get project directory: %w", err)
+	}
+
+	root, cfg, err := findRoot(filepath.Dir(dir))
+	if err != nil || cfg == nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return nil
+	}
+	rel = filepath.ToSlash(rel)
+	for _, ws := range cfg.Workspaces {
+		if filepath.ToSlash(filepath.Clean(ws.Path)) == rel {
+			prefix = rel
+			return nil
+		}
+	}
+	return nil
+}
+
+// findRoot looks for a workspaces file in dir and its parents, returning the
+// directory holding it and its config, or a nil config if there's none
+func findRoot(dir string) (string, *Config, error) {
+	dir, err := project.Abs(dir)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+	for {
+		if _, err := project.Stat(filepath.Join(dir, File)); err == nil {
+			cfg, err := Read(dir)
+			if err != nil {
+				return "", nil, err
+			}
+			return dir, cfg, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil, nil
+		}
+		dir = parent
+	}
+}
+
+// List returns the directory holding the workspaces file above the current
+// directory and its config
+func List() (string, *Config, error) {
+	root, cfg, err := findRoot(".")
+	if err != nil {
+		return "", nil, err
+	}
+	if cfg == nil {
+		return "", nil, fmt.Errorf("no %s found in this directory or its parents", File)
+	}
+	return root, cfg, nil
+}
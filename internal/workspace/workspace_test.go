@@ -0,0 +1,96 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		workspaces map[string]Workspace
+		wantErr    bool
+	}{
+		{"separate", map[string]Workspace{"a": {Path: "infra/a"}, "b": {Path: "infra/b"}}, false},
+		{"nested", map[string]Workspace{"a": {Path: "infra"}, "b": {Path: "infra/b"}}, true},
+		{"same", map[string]Workspace{"a": {Path: "infra/a/"}, "b": {Path: "infra/a"}}, true},
+		{"outside", map[string]Workspace{"a": {Path: "../a"}}, true},
+		{"root", map[string]Workspace{"a": {Path: "."}}, true},
+	}
+	for _, tt := range tests {
+		err := Validate(&Config{Workspaces: tt.workspaces})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestEnter(t *testing.T) {
+	root := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	defer func() { prefix = "" }()
+
+	if err := os.MkdirAll(filepath.Join(root, ".tgs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "infra", "app", ".tgs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, File), []byte("workspaces:\n  app:\n    path: infra/app\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	if err := Enter("app", ""); err != nil {
+		t.Fatalf("Enter() unexpected error: %v", err)
+	}
+	if _, err := os.Stat(".tgs"); err != nil || Prefix() != "infra/app/" {
+		t.Errorf("Prefix() = %q after entering the workspace, want infra/app/", Prefix())
+	}
+
+	// Running from the project directory detects the workspace too
+	if err := Enter("", ""); err != nil {
+		t.Fatalf("Enter() unexpected error: %v", err)
+	}
+	if Prefix() != "infra/app/" {
+		t.Errorf("Prefix() = %q in the workspace directory, want infra/app/", Prefix())
+	}
+
+	if err := Enter("", filepath.Join(root, "infra")); err != nil {
+		t.Fatalf("Enter() unexpected error: %v", err)
+	}
+	if Prefix() != "" {
+		t.Errorf("Prefix() = %q outside a workspace, want empty", Prefix())
+	}
+
+	if err := Enter("missing", ""); err == nil {
+		t.Error("Enter() with an unknown workspace should fail")
+	}
+
+	// Workspaces outside the repository or overlapping others can't be entered
+	for workspaces, want := range map[string]string{
+		"workspaces:\n  app:\n    path: infra/../..\n":                          "path must be a directory inside the repository",
+		"workspaces:\n  app:\n    path: infra/app\n  infra:\n    path: infra\n": "workspaces app and infra overlap",
+	} {
+		if err := os.WriteFile(filepath.Join(root, File), []byte(workspaces), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chdir(root); err != nil {
+			t.Fatal(err)
+		}
+		if err := Enter("app", ""); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Enter() with workspaces %q error = %v, want %q", workspaces, err, want)
+		}
+		if cwd, _ := os.Getwd(); cwd != root {
+			t.Errorf("Enter() of an invalid workspace changed into %s", cwd)
+		}
+	}
+}
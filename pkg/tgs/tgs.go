@@ -0,0 +1,214 @@
+// Package tgs embeds TGS in other Go tools: it generates the infrastructure
+// tree, pipelines and diagrams of a project and validates its configuration
+// without shelling out to the CLI.
+//
+// A Project runs in its directory, from the files of its .tgs directory or
+// from configuration built in memory. Generated files are written below the
+// project directory, like the CLI does. Paths are resolved against the project
+// directory without changing the working directory of the process; calls set
+// the configuration, log and event handler of the package while they run, so
+// they're serialized.
+package tgs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/davoodharun/terragrunt-scaffolder/internal/config"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/diagram"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/events"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/logger"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/output"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/pipeline"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/project"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/scaffold"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/validate"
+	"github.com/davoodharun/terragrunt-scaffolder/internal/workspace"
+)
+
+type (
+	// Config is the project configuration of tgs.yaml
+	Config = config.TGSConfig
+	// Stack is a stack file of .tgs/stacks
+	Stack = config.MainConfig
+	// Event is a step of a run, see the Events field of Project
+	Event = events.Event
+	// Finding is an error or warning of Validate
+	Finding = validate.Result
+	// DiagramOptions selects the diagrams of GenerateDiagrams
+	DiagramOptions = diagram.Options
+)
+
+// Event types
+const (
+	EventFileWritten        = events.TypeFileWritten
+	EventComponentGenerated = events.TypeComponentGenerated
+	EventValidationFinding  = events.TypeValidationFinding
+)
+
+// Pipeline agents of GeneratePipelines
+const (
+	AgentLinux   = pipeline.AgentLinux
+	AgentWindows = pipeline.AgentWindows
+)
+
+// Project is a TGS project to generate
+type Project struct {
+	// Dir is the project directory, the current directory when empty
+	Dir string
+	// Config replaces .tgs/tgs.yaml when set, and Stacks then replace the
+	// stack files of .tgs/stacks, keyed by stack name
+	Config *Config
+	Stacks map[string]*Stack
+	// OutputDir overrides the output_dir of the configuration
+	OutputDir string
+	// Log receives the log messages, which are discarded when it's nil
+	Log io.Writer
+	// Events is called with every event of a run when set
+	Events func(Event)
+}
+
+// mu serializes runs, which set the project of the package
+var mu sync.Mutex
+
+// Load reads the configuration and stack files of the project in dir
+func Load(dir string) (*Config, map[string]*Stack, error) {
+	var tgsConfig *Config
+	stacks := make(map[string]*Stack)
+	err := (&Project{Dir: dir}).run(func() error {
+		var err error
+		if tgsConfig, err = config.ReadTGSConfig(); err != nil {
+			return err
+		}
+		files, err := project.Glob(filepath.Join(".tgs", "stacks", "*.yaml"))
+		if err != nil {
+			return fmt.Errorf("failed to list stacks: %w", err)
+		}
+		for _, file := range files {
+			name := strings.TrimSuffix(filepath.Base(file), ".yaml")
+			if stacks[name], err = config.ReadMainConfig(name); err != nil {
+				return fmt.Errorf("failed to read stack %s: %w", name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return tgsConfig, stacks, nil
+}
+
+// ParseConfig parses the content of a tgs.yaml, expanding ${env:VAR}
+// placeholders. Files it includes aren't read.
+func ParseConfig(data []byte) (*Config, error) {
+	var tgsConfig Config
+	unresolved, err := config.Unmarshal(data, &tgsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse TGS config: %w", err)
+	}
+	tgsConfig.Unresolved = unresolved
+	return &tgsConfig, nil
+}
+
+// ParseStack parses the content of a stack file, expanding ${env:VAR}
+// placeholders
+func ParseStack(data []byte) (*Stack, error) {
+	var stack Stack
+	unresolved, err := config.Unmarshal(data, &stack)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse stack config: %w", err)
+	}
+	stack.Unresolved = unresolved
+	return &stack, nil
+}
+
+// Generate validates the configuration and generates the infrastructure
+// tree, like tgs generate
+func (p *Project) Generate() error {
+	return p.run(scaffold.Generate)
+}
+
+// GeneratePipelines generates the Azure DevOps pipelines of the generated
+// tree for an agent, like tgs pipeline. Generate must have run first.
+func (p *Project) GeneratePipelines(agent string) error {
+	return p.run(func() error {
+		return pipeline.GeneratePipelineTemplates(agent)
+	})
+}
+
+// GenerateDiagrams generates the diagrams of opts, like tgs diagram
+func (p *Project) GenerateDiagrams(opts DiagramOptions) error {
+	return p.run(func() error {
+		return diagram.GenerateDiagram(opts)
+	})
+}
+
+// Validate checks the configuration and every stack used by an environment,
+// like tgs validate-tgs and tgs validate without the provider registry
+// checks. It only fails when the configuration can't be read; errors and
+// warnings, including stacks that can't be read, are returned as findings.
+func (p *Project) Validate() ([]Finding, error) {
+	var findings []Finding
+	err := p.run(func() error {
+		tgsConfig, err := config.ReadTGSConfig()
+		if err != nil {
+			return err
+		}
+		report := validate.Project(tgsConfig, validate.Options{Stacks: true, Full: true})
+		for _, r := range report.Reports() {
+			events.ValidationFindings(r.File, r.Findings)
+			findings = append(findings, validate.NewResults(r.Findings, r.File)...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return findings, nil
+}
+
+// run runs fn with the project directory, configuration, output directory,
+// log writer and event handler of the project, restoring the package state
+// afterwards
+func (p *Project) run(fn func() error) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	dir, err := filepath.Abs(p.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve project directory: %w", err)
+	}
+	project.SetRoot(dir)
+	defer func() {
+		project.SetRoot("")
+		workspace.Detect()
+	}()
+	if err := workspace.Detect(); err != nil {
+		return err
+	}
+
+	config.Use(p.Config, p.Stacks)
+	defer config.Use(nil, nil)
+
+	output.SetDir(p.OutputDir)
+	defer output.SetDir("")
+	if err := output.Resolve(); err != nil {
+		return err
+	}
+
+	log := p.Log
+	if log == nil {
+		log = io.Discard
+	}
+	logger.SetOutput(log)
+	defer logger.SetOutput(os.Stdout)
+
+	if p.Events != nil {
+		defer events.Subscribe(p.Events)()
+	}
+	return fn()
+}
@@ -0,0 +1,140 @@
+package tgs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testConfig = `name: projecta
+subscriptions:
+  nonprod:
+    remotestate:
+      name: stprojectanonprodtf
+      resource_group: rg-projecta-nonprod-tf
+    environments:
+      - name: dev
+`
+
+const testStack = `stack:
+  name: main
+  version: "1.0.0"
+  description: "Test stack"
+  components:
+    redis:
+      source: azurerm_redis_cache
+      provider: azurerm
+      version: 4.22.0
+      description: "Redis cache"
+  architecture:
+    regions:
+      eastus2:
+        - component: redis
+`
+
+func TestGenerateInMemory(t *testing.T) {
+	tgsConfig, err := ParseConfig([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stack, err := ParseStack([]byte(testStack))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var log bytes.Buffer
+	var generated []string
+	project := &Project{
+		Dir:    dir,
+		Config: tgsConfig,
+		Stacks: map[string]*Stack{"main": stack},
+		Log:    &log,
+		Events: func(e Event) {
+			if e.Type == EventComponentGenerated {
+				generated = append(generated, e.Component)
+			}
+		},
+	}
+
+	findings, err := project.Validate()
+	if err != nil {
+		t.Fatalf("Validate() unexpected error: %v", err)
+	}
+	for _, finding := range findings {
+		if finding.Severity == "error" {
+			t.Errorf("Validate() finding: %+v", finding)
+		}
+	}
+
+	if err := project.Generate(); err != nil {
+		t.Fatalf("Generate() unexpected error: %v\n%s", err, log.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".infrastructure", "root.hcl")); err != nil {
+		t.Errorf("Generate() didn't write root.hcl: %v", err)
+	}
+	if len(generated) != 1 || generated[0] != "redis" {
+		t.Errorf("Generate() component events = %v, want [redis]", generated)
+	}
+	if log.Len() == 0 {
+		t.Error("Generate() logged nothing to Log")
+	}
+	if cwd, _ := os.Getwd(); cwd != wd {
+		t.Errorf("working directory = %s after Generate(), want %s", cwd, wd)
+	}
+}
+
+func TestGenerateFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, ".tgs", "stacks"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".tgs", "tgs.yaml"), []byte(testConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".tgs", "stacks", "main.yaml"), []byte(testStack), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tgsConfig, stacks, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if tgsConfig.Name != "projecta" || stacks["main"] == nil {
+		t.Errorf("Load() = %s, %v, want projecta and the main stack", tgsConfig.Name, stacks)
+	}
+
+	var log bytes.Buffer
+	var moved bool
+	project := &Project{
+		Dir: dir,
+		Log: &log,
+		Events: func(e Event) {
+			if cwd, _ := os.Getwd(); cwd != wd {
+				moved = true
+			}
+		},
+	}
+	if err := project.Generate(); err != nil {
+		t.Fatalf("Generate() unexpected error: %v\n%s", err, log.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".infrastructure", "root.hcl")); err != nil {
+		t.Errorf("Generate() didn't write root.hcl: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(wd, ".infrastructure")); err == nil {
+		t.Error("Generate() wrote .infrastructure to the working directory")
+	}
+	if moved {
+		t.Error("Generate() changed the working directory while running")
+	}
+}